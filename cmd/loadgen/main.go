@@ -0,0 +1,256 @@
+// Command loadgen exercises a running server with the create, read and
+// share workflow of many concurrent clients and reports the latency of
+// each step. It logs in as -user with the password in
+// SECRETLY_LOADGEN_PASSWORD and removes the secrets it created.
+//
+//	SECRETLY_LOADGEN_PASSWORD=... loadgen -server https://secretly:8080 -concurrency 32 -duration 1m -share-with bob
+//
+// With -max-p99 it exits with status 1 when a step is slower, or when any
+// request failed, so that CI can run it against a staging server.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Steps of the workflow, in order
+const (
+	stepCreate = "create"
+	stepRead   = "read"
+	stepShare  = "share"
+	stepDelete = "delete"
+)
+
+type options struct {
+	server      string
+	user        string
+	shareWith   string
+	concurrency int
+	duration    time.Duration
+	iterations  int
+	valueSize   int
+	keep        bool
+	maxP99      time.Duration
+	asJSON      bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", "http://localhost:8080", "URL of the server")
+	flag.StringVar(&opts.user, "user", "admin", "User to log in as; the password is read from SECRETLY_LOADGEN_PASSWORD")
+	flag.StringVar(&opts.shareWith, "share-with", "", "User to grant read access to each secret; the share step is skipped without one")
+	flag.IntVar(&opts.concurrency, "concurrency", 8, "Number of concurrent clients")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "How long to run")
+	flag.IntVar(&opts.iterations, "iterations", 0, "Stop after this many workflows in total (0 = until -duration)")
+	flag.IntVar(&opts.valueSize, "value-size", 256, "Size of each secret value in bytes")
+	flag.BoolVar(&opts.keep, "keep", false, "Keep the created secrets instead of deleting them")
+	flag.DurationVar(&opts.maxP99, "max-p99", 0, "Fail when the p99 latency of a step exceeds this (0 = no budget)")
+	flag.BoolVar(&opts.asJSON, "json", false, "Print the report as JSON")
+	flag.Parse()
+
+	password := os.Getenv("SECRETLY_LOADGEN_PASSWORD")
+	if password == "" {
+		log.Fatal("❌ Set SECRETLY_LOADGEN_PASSWORD to the password of -user")
+	}
+	if opts.concurrency < 1 || opts.valueSize < 1 {
+		log.Fatal("❌ -concurrency and -value-size must be positive")
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.concurrency},
+	}
+	token, err := login(client, opts.server, opts.user, password)
+	if err != nil {
+		log.Fatalf("❌ Login failed: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	r := &runner{opts: opts, client: client, token: token, run: runID(), stats: newStats()}
+	started := time.Now()
+	r.start(ctx)
+	report := r.stats.report(time.Since(started))
+
+	if opts.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		report.print(os.Stdout)
+	}
+	if failures := report.check(opts.maxP99); len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "❌ %s\n", f)
+		}
+		os.Exit(1)
+	}
+}
+
+// runner runs the workflow from concurrent workers until ctx is done or
+// the iterations are used up
+type runner struct {
+	opts   options
+	client *http.Client
+	token  string
+	run    string
+	stats  *stats
+
+	mu   sync.Mutex
+	next int
+}
+
+func (r *runner) start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range r.opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				n, ok := r.take()
+				if !ok {
+					return
+				}
+				r.workflow(ctx, n)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// take numbers the next workflow, and reports false once -iterations ran
+func (r *runner) take() (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.opts.iterations > 0 && r.next >= r.opts.iterations {
+		return 0, false
+	}
+	r.next++
+	return r.next, true
+}
+
+// workflow creates a secret, reads its value, shares it and deletes it.
+// A failed step ends the workflow; the secret is still deleted.
+func (r *runner) workflow(ctx context.Context, n int) {
+	value := make([]byte, r.opts.valueSize)
+	_, _ = rand.Read(value)
+	create := map[string]string{
+		"name":  fmt.Sprintf("loadgen/%s/%d", r.run, n),
+		"value": base64.RawStdEncoding.EncodeToString(value)[:r.opts.valueSize],
+	}
+	var secret struct {
+		ID uint `json:"id"`
+	}
+	if !r.step(ctx, stepCreate, http.MethodPost, "/api/v1/secrets", create, &secret) {
+		return
+	}
+	path := "/api/v1/secrets/" + strconv.FormatUint(uint64(secret.ID), 10)
+	if !r.opts.keep {
+		// The deletion is measured too, but must not be cut short
+		defer r.step(context.WithoutCancel(ctx), stepDelete, http.MethodDelete, path, nil, nil)
+	}
+	if !r.step(ctx, stepRead, http.MethodGet, path+"/value", nil, nil) {
+		return
+	}
+	if r.opts.shareWith != "" {
+		r.step(ctx, stepShare, http.MethodPut, path+"/grants/"+url.PathEscape(r.opts.shareWith), map[string]string{"level": "read"}, nil)
+	}
+}
+
+// step sends one request, records its latency under name and reports
+// whether it succeeded. Requests interrupted by the end of the run are
+// not counted.
+func (r *runner) step(ctx context.Context, name, method, path string, body, out any) bool {
+	started := time.Now()
+	err := r.do(ctx, method, path, body, out)
+	if ctx.Err() != nil {
+		return false
+	}
+	r.stats.record(name, time.Since(started), err)
+	return err == nil
+}
+
+func (r *runner) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.opts.server, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	req.Header.Set("User-Agent", "secretly-loadgen")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func login(client *http.Client, server, user, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"username": user, "password": password})
+	resp, err := client.Post(strings.TrimSuffix(server, "/")+"/api/v1/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", err
+	}
+	if session.Token == "" {
+		return "", errors.New("no token in the response; a second factor is not supported")
+	}
+	return session.Token, nil
+}
+
+// runID tells the secrets of concurrent or repeated runs apart
+func runID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// maxErrorSamples bounds the distinct errors kept for the report
+const maxErrorSamples = 5
+
+// stats collects the latency of every request by step
+type stats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	samples   []string
+}
+
+func newStats() *stats {
+	return &stats{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (s *stats) record(step string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies[step] = append(s.latencies[step], latency)
+	if err != nil {
+		s.errors[step]++
+		if msg := err.Error(); len(s.samples) < maxErrorSamples && !slices.Contains(s.samples, msg) {
+			s.samples = append(s.samples, msg)
+		}
+	}
+}
+
+// stepReport summarizes the requests of one step. Latencies include
+// failed requests.
+type stepReport struct {
+	Step     string        `json:"step"`
+	Requests int           `json:"requests"`
+	Errors   int           `json:"errors"`
+	PerSec   float64       `json:"per_second"`
+	P50      time.Duration `json:"p50_ns"`
+	P95      time.Duration `json:"p95_ns"`
+	P99      time.Duration `json:"p99_ns"`
+	Max      time.Duration `json:"max_ns"`
+}
+
+type report struct {
+	Duration time.Duration `json:"duration_ns"`
+	Steps    []stepReport  `json:"steps"`
+	Samples  []string      `json:"error_samples,omitempty"`
+}
+
+func (s *stats) report(elapsed time.Duration) report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := report{Duration: elapsed, Samples: s.samples}
+	for _, step := range []string{stepCreate, stepRead, stepShare, stepDelete} {
+		latencies := slices.Clone(s.latencies[step])
+		if len(latencies) == 0 {
+			continue
+		}
+		slices.Sort(latencies)
+		r.Steps = append(r.Steps, stepReport{
+			Step:     step,
+			Requests: len(latencies),
+			Errors:   s.errors[step],
+			PerSec:   float64(len(latencies)) / elapsed.Seconds(),
+			P50:      percentile(latencies, 50),
+			P95:      percentile(latencies, 95),
+			P99:      percentile(latencies, 99),
+			Max:      latencies[len(latencies)-1],
+		})
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of sorted
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func (r report) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "step\trequests\terrors\treq/s\tp50\tp95\tp99\tmax\t")
+	for _, s := range r.Steps {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", s.Step, s.Requests, s.Errors, s.PerSec,
+			round(s.P50), round(s.P95), round(s.P99), round(s.Max))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRan for %s\n", round(r.Duration))
+	for _, sample := range r.Samples {
+		fmt.Fprintf(w, "⚠️  %s\n", sample)
+	}
+}
+
+// check returns what fails the run: failed requests, and steps whose p99
+// exceeds maxP99 when it is set
+func (r report) check(maxP99 time.Duration) []string {
+	var failures []string
+	if len(r.Steps) == 0 {
+		failures = append(failures, "no request completed")
+	}
+	for _, s := range r.Steps {
+		if s.Errors > 0 {
+			failures = append(failures, fmt.Sprintf("%d of %d %s requests failed", s.Errors, s.Requests, s.Step))
+		}
+		if maxP99 > 0 && s.P99 > maxP99 {
+			failures = append(failures, fmt.Sprintf("p99 of %s is %s, over the budget of %s", s.Step, round(s.P99), maxP99))
+		}
+	}
+	return failures
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
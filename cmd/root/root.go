@@ -1,6 +1,7 @@
 package root
 
 import (
+	"github.com/secretlyhq/secretly/internal/di"
 	"github.com/spf13/cobra"
 )
 
@@ -11,3 +12,8 @@ var RootCmd = &cobra.Command{
 	Short:   "Secretly - Secure secrets management CLI",
 	Version: version, // 💡 automatically adds --version flag
 }
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&di.DryRun, "dry-run", false,
+		"Check changes to the local database, e.g. creating, updating or sharing secrets, without saving them, and list what would change")
+}
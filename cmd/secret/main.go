@@ -5,7 +5,7 @@ import (
 	"log"
 
 	"github.com/secretlyhq/secretly/internal/di"
-	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -23,36 +23,7 @@ func main() {
 		log.Fatalf("❌ Database connection error: %v", err)
 	}
 
-	err = db.AutoMigrate(
-		&models.Namespace{},
-		&models.Zone{},
-		&models.Environment{},
-		&models.User{},
-		&models.Role{},
-		&models.UserRole{},
-		&models.Group{},
-		&models.UserGroup{},
-		&models.GroupRole{},
-		&models.SecretNode{},
-		&models.SecretVersion{},
-		&models.SecretAccessLog{},
-		&models.SecretMetadataHistory{},
-		&models.Session{},
-		&models.PasswordReset{},
-		&models.Tag{},
-		&models.SecretTag{},
-		&models.Notification{},
-		&models.AuditEvent{},
-		&models.Setting{},
-		&models.SystemMetadata{},
-		&models.APIClient{},
-		&models.APIToken{},
-		&models.RateLimit{},
-		&models.APICallLog{},
-		&models.GRPCService{},
-		&models.IdentityProvider{},
-		&models.ExternalIdentity{},
-	)
+	err = storage.Migrate(db)
 	if err != nil {
 		log.Fatalf("❌ Migration error: %v", err)
 	}
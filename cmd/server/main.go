@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/encryption"
+	"github.com/secretlyhq/secretly/internal/redact"
+	"github.com/secretlyhq/secretly/internal/server"
+	"github.com/secretlyhq/secretly/internal/startup"
+)
+
+const defaultDrainTimeout = 15 * time.Second
+
+func main() {
+	configPath := flag.String("config", "secretly.yaml", "Path to configuration file")
+	skipValidation := flag.Bool("skip-validation", false, "Start even if start-up validation fails")
+	flag.BoolVar(&di.Replica, "replica", false, "Serve reads only, from a replicated database (server.replica)")
+	flag.Parse()
+
+	// Nothing that looks like secret material may reach the logs
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	validation := validate(*configPath, *skipValidation)
+
+	app, err := di.NewApp(*configPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer app.Close()
+	cfg, c := app.Config, app.Core
+	// Requests bring their own transport and actor; background jobs act as
+	// the system explicitly, and anything else is denied
+	c.SetLocalTransport("")
+	c.SetLocalActor("")
+
+	if !cfg.Server.HTTP.Enabled {
+		log.Fatalf("❌ HTTP server is disabled in %s (server.http.enabled)", *configPath)
+	}
+
+	if replica, _ := c.Replica(); !replica {
+		bootstrapAdmin(c)
+	}
+
+	srv := server.New(c, cfg.Server.HTTP)
+	srv.SetValidationReport(validation)
+	srv.SetReusePort(cfg.Server.Restart.ReusePort)
+	srv.SetGRPCRateLimit(cfg.Server.GRPC.RateLimit)
+	srv.SetLocale(cfg.Locale)
+	srv.SetGRPCHandler(app.GRPC)
+	srv.SetHealthChecks(
+		server.HealthCheck{Name: "database", Check: app.CheckDatabase},
+		server.HealthCheck{Name: "encryption", Check: app.CheckEncryption},
+		server.HealthCheck{Name: "migrations", Check: app.CheckMigrations},
+	)
+	if cfg.Security.FIPSMode {
+		srv.SetTLSConfig(encryption.FIPSTLSConfig())
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if interval := cfg.Security.FileAudit.IntervalSeconds; interval > 0 && cfg.Security.EnableFilePermissionCheck {
+		watcher := startup.NewPermissionWatcher(*configPath, cfg, startup.DriftNotifier(cfg.Security.FileAudit))
+		go watcher.Run(watchCtx, time.Duration(interval)*time.Second)
+	}
+	if replica, primary := c.Replica(); replica {
+		log.Printf("🪞 Serving a read-only replica; clients are sent to the primary %s for everything else", primary)
+	} else {
+		startSweeps(watchCtx, c)
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Fatalf("❌ HTTP server error: %v", err)
+		}
+	}()
+
+	// SIGHUP hands the socket to a new process, which then stops this one
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		pid, err := srv.Restart()
+		if err != nil {
+			log.Printf("⚠️  Restart failed, still serving: %v", err)
+			continue
+		}
+		log.Printf("🔁 Started new server process %d, waiting for it to take over", pid)
+	}
+	stopWatch()
+
+	drain := time.Duration(cfg.Server.Restart.DrainTimeoutSeconds) * time.Second
+	if drain <= 0 {
+		drain = defaultDrainTimeout
+	}
+	log.Printf("⏳ Draining in-flight requests (timeout %s)", drain)
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Shutdown error after %s drain: %v", drain, err)
+	}
+	if stats, ok := c.AuditQueueStats(); ok {
+		log.Printf("📝 Writing %d queued audit events", stats.Depth)
+		c.CloseAudit()
+	}
+	log.Println("✅ Server stopped")
+}
+
+// validate checks keys, file permissions, the database and TLS files before
+// anything is opened. With skip set, failures are logged and reported by
+// /api/v1/system/validation instead of stopping the server.
+func validate(configPath string, skip bool) *startup.ValidationResult {
+	result, err := startup.ValidateStartup(configPath)
+	if err == nil {
+		for _, w := range result.Warnings {
+			log.Printf("⚠️  %s", w)
+		}
+		log.Println("✅ Start-up validation passed")
+		return result
+	}
+	if !skip {
+		startup.PrintValidationResult(result)
+		log.Fatalf("❌ Start-up validation failed: %v (use --skip-validation to start anyway)", err)
+	}
+	log.Printf("⚠️  Start-up validation failed, starting anyway because of --skip-validation: %v", err)
+	result.Skipped = true
+	return result
+}
+
+// startSweeps starts the background jobs that change secrets, which only
+// the primary runs
+func startSweeps(ctx context.Context, c *core.SecretlyCore) {
+	if interval := c.LifecycleInterval(); interval > 0 {
+		go c.RunLifecycle(ctx, interval)
+	}
+	if interval := c.StaleInterval(); interval > 0 {
+		go c.RunStaleSweep(ctx, interval)
+	}
+	if interval := c.ReleaseInterval(); interval > 0 {
+		go c.RunReleases(ctx, interval)
+	}
+	if interval := c.GitOpsInterval(); interval > 0 {
+		go c.RunGitOps(ctx, interval)
+	}
+}
+
+// bootstrapAdmin creates the first user from SECRETLY_ADMIN_USERNAME and
+// SECRETLY_ADMIN_PASSWORD when that user does not exist yet, with the
+// admin role
+func bootstrapAdmin(c *core.SecretlyCore) {
+	username := os.Getenv("SECRETLY_ADMIN_USERNAME")
+	password := os.Getenv("SECRETLY_ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		return
+	}
+	if _, err := c.Storage().Users().FindByUsername(username); err == nil {
+		return
+	}
+	ctx := core.WithSystemActor(context.Background(), "admin bootstrap")
+	req := &core.CreateUserRequest{Username: username, Password: password, Roles: []string{"admin"}}
+	if _, err := c.CreateUser(ctx, req); err != nil {
+		log.Fatalf("❌ Failed to create admin user: %v", err)
+	}
+	log.Printf("✅ Created admin user %q", username)
+}
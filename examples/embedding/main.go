@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/secretlyhq/secretly/pkg/secretly"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Generate an encryption key. In a real service, load it from a KMS or
+	// a file with 0600 permissions instead of generating it on every start.
+	key, err := secretly.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// Use InMemory for tests; set DatabasePath to persist secrets in SQLite
+	client, err := secretly.New(secretly.Options{InMemory: true, EncryptionKey: key})
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	fmt.Println("✅ Embedded Secretly client created")
+
+	// Example 1: Create and read a secret
+	fmt.Println("\n📝 Example 1: Create and read")
+	secret, err := client.CreateSecret(ctx, secretly.CreateSecretRequest{
+		Name:      "database_password",
+		Type:      "password",
+		Value:     []byte("super-secret-db-password-123"),
+		CreatedBy: "embedding-example",
+	})
+	if err != nil {
+		log.Fatalf("Failed to create secret: %v", err)
+	}
+	fmt.Printf("✅ Created secret %q (ID %d)\n", secret.Name, secret.ID)
+
+	value, err := client.GetSecretValue(ctx, secret.ID)
+	if err != nil {
+		log.Fatalf("Failed to read secret: %v", err)
+	}
+	fmt.Printf("🔓 Value: %s\n", value)
+
+	// Example 2: Burn-after-reading secret
+	fmt.Println("\n🔥 Example 2: Single-read secret")
+	maxReads := 1
+	oneTime, err := client.CreateSecret(ctx, secretly.CreateSecretRequest{
+		Name:     "one_time_token",
+		Value:    []byte("tok_abc123"),
+		MaxReads: &maxReads,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := client.GetSecretValue(ctx, oneTime.ID); err != nil {
+		log.Fatalf("First read failed: %v", err)
+	}
+	if _, err := client.GetSecretValue(ctx, oneTime.ID); err != nil {
+		fmt.Printf("✅ Second read rejected: %v\n", err)
+	}
+
+	// Example 3: Update and list
+	fmt.Println("\n🔄 Example 3: Update and list")
+	if _, err := client.UpdateSecret(ctx, secret.ID, secretly.UpdateSecretRequest{Value: []byte("rotated-password-456")}); err != nil {
+		log.Fatalf("Failed to update secret: %v", err)
+	}
+	secrets, total, err := client.ListSecrets(ctx, secretly.ListSecretsOptions{})
+	if err != nil {
+		log.Fatalf("Failed to list secrets: %v", err)
+	}
+	fmt.Printf("📋 %d secrets:\n", total)
+	for _, s := range secrets {
+		fmt.Printf("   • %d %s\n", s.ID, s.Name)
+	}
+
+	fmt.Println("\n🎉 Embedding example completed successfully!")
+}
@@ -0,0 +1,61 @@
+# Manages Secretly secrets through the HTTP API with the generic REST provider.
+# See README.md for the API contract a dedicated provider would implement.
+
+terraform {
+  required_providers {
+    restapi = {
+      source  = "Mastercard/restapi"
+      version = "~> 1.19"
+    }
+  }
+}
+
+variable "secretly_url" {
+  type    = string
+  default = "http://localhost:8080"
+}
+
+variable "secretly_token" {
+  description = "Session token from POST /api/v1/auth/login"
+  type        = string
+  sensitive   = true
+}
+
+variable "db_password" {
+  type      = string
+  sensitive = true
+}
+
+provider "restapi" {
+  uri                  = var.secretly_url
+  write_returns_object = true
+  headers = {
+    Authorization = "Bearer ${var.secretly_token}"
+    Content-Type  = "application/json"
+  }
+}
+
+resource "restapi_object" "db_password" {
+  path          = "/api/v1/secrets"
+  id_attribute  = "id"
+  update_method = "PUT"
+
+  data = jsonencode({
+    name           = "db-password"
+    environment_id = 1
+    type           = "password"
+    value          = var.db_password
+  })
+
+  # The API never returns values, so only metadata is compared on refresh
+  ignore_changes_to = ["value"]
+}
+
+output "db_password_id" {
+  value = restapi_object.db_password.id
+}
+
+# Store this and compare it on later runs to detect out-of-band changes
+output "db_password_content_hash" {
+  value = jsondecode(restapi_object.db_password.api_response).content_hash
+}
@@ -3,8 +3,10 @@ module github.com/secretlyhq/secretly
 go 1.24.4
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.9.1
 	golang.org/x/crypto v0.40.0
+	golang.org/x/text v0.27.0
 	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/datatypes v1.2.6
 	gorm.io/driver/sqlite v1.6.0
@@ -20,6 +22,5 @@ require (
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/mattn/go-sqlite3 v1.14.22 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/text v0.27.0 // indirect
 	gorm.io/driver/mysql v1.5.6 // indirect
 )
@@ -0,0 +1,200 @@
+// Package agent serves credentials to a companion browser extension. The
+// agent listens on loopback only; the browser talks to it through a native
+// messaging host (see native.go) that authenticates with a per-run token.
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// SitePrefix is the folder holding website credentials: the fields of
+// https://github.com are the secrets named "web/github.com/<field>", e.g.
+// "web/github.com/username" and "web/github.com/password".
+const SitePrefix = "web/"
+
+// ErrDenied is returned when the user rejects a request or does not answer
+// in time
+var ErrDenied = errors.New("request denied by user")
+
+// Confirmer asks the user to approve a single credential request
+type Confirmer interface {
+	Confirm(ctx context.Context, prompt string) bool
+}
+
+// CredentialRequest is sent by the native messaging host
+type CredentialRequest struct {
+	// Extension is the origin of the calling extension, as passed to the
+	// native host by the browser, e.g. "chrome-extension://abcdef/"
+	Extension string `json:"extension"`
+	// Origin is the page the extension wants to fill
+	Origin string `json:"origin"`
+}
+
+// CredentialResponse holds the fields stored for a site
+type CredentialResponse struct {
+	Origin string            `json:"origin"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Agent answers credential requests from allowed extensions after the user
+// confirms each one
+type Agent struct {
+	core              *core.SecretlyCore
+	confirmer         Confirmer
+	allowedExtensions []string
+	confirmTimeout    time.Duration
+	token             string
+
+	// mu serializes confirmations so prompts never interleave
+	mu sync.Mutex
+}
+
+// New creates an agent with a fresh access token
+func New(c *core.SecretlyCore, confirmer Confirmer, allowedExtensions []string, confirmTimeout time.Duration) (*Agent, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate agent token: %w", err)
+	}
+	if confirmTimeout <= 0 {
+		confirmTimeout = 30 * time.Second
+	}
+	normalized := make([]string, len(allowedExtensions))
+	for i, ext := range allowedExtensions {
+		normalized[i] = normalizeExtension(ext)
+	}
+	return &Agent{
+		core:              c,
+		confirmer:         confirmer,
+		allowedExtensions: normalized,
+		confirmTimeout:    confirmTimeout,
+		token:             hex.EncodeToString(token),
+	}, nil
+}
+
+// Token authenticates the native host; it is written to the endpoint file
+func (a *Agent) Token() string {
+	return a.token
+}
+
+// Credentials returns the stored fields for req.Origin once the extension is
+// allowed and the user confirms
+func (a *Agent) Credentials(ctx context.Context, req CredentialRequest) (*CredentialResponse, error) {
+	extension := normalizeExtension(req.Extension)
+	if !slices.Contains(a.allowedExtensions, extension) {
+		return nil, fmt.Errorf("extension %q is not allowed: add it to agent.allowed_extensions", req.Extension)
+	}
+	origin, host, err := parseOrigin(req.Origin)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, _, err := a.core.ListSecrets(ctx, &core.ListSecretsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	prefix := SitePrefix + host + "/"
+	ids := make(map[string]uint)
+	for _, s := range secrets {
+		if field, ok := strings.CutPrefix(s.Name, prefix); ok && field != "" && !strings.Contains(field, "/") {
+			ids[field] = s.ID
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no credentials stored for %s (expected secrets named %susername)", host, prefix)
+	}
+
+	if !a.confirm(ctx, fmt.Sprintf("Allow %s to fill credentials for %s?", req.Extension, origin)) {
+		return nil, ErrDenied
+	}
+
+	resp := &CredentialResponse{Origin: origin, Fields: make(map[string]string, len(ids))}
+	for field, id := range ids {
+		value, err := a.core.GetSecretValue(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s%s: %w", prefix, field, err)
+		}
+		resp.Fields[field] = string(value)
+	}
+	return resp, nil
+}
+
+func (a *Agent) confirm(ctx context.Context, prompt string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, a.confirmTimeout)
+	defer cancel()
+	return a.confirmer.Confirm(ctx, prompt)
+}
+
+// Handler serves POST /v1/credentials for the native host
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/credentials", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Browsers attach Origin to cross-site requests; the native host never
+		// does, so reject anything a web page could have sent
+		if r.Header.Get("Origin") != "" {
+			writeError(w, http.StatusForbidden, "browser requests are not accepted")
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid agent token")
+			return
+		}
+
+		var req CredentialRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		resp, err := a.Credentials(r.Context(), req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrDenied) {
+				status = http.StatusForbidden
+			}
+			writeError(w, status, err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	return mux
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// parseOrigin accepts https origins, and http only for localhost
+func parseOrigin(raw string) (origin, host string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid origin %q", raw)
+	}
+	host = u.Hostname()
+	if u.Scheme != "https" && !(u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1")) {
+		return "", "", fmt.Errorf("refusing to fill credentials on insecure origin %q", raw)
+	}
+	return u.Scheme + "://" + u.Host, strings.ToLower(host), nil
+}
+
+func normalizeExtension(ext string) string {
+	return strings.TrimSuffix(strings.TrimSpace(ext), "/")
+}
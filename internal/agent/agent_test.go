@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+)
+
+type fakeConfirmer struct {
+	allow   bool
+	prompts []string
+}
+
+func (f *fakeConfirmer) Confirm(ctx context.Context, prompt string) bool {
+	f.prompts = append(f.prompts, prompt)
+	return f.allow
+}
+
+func TestNativeHostCredentials(t *testing.T) {
+	c := core.NewSecretlyCore(memory.New(), nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+	for name, value := range map[string]string{
+		"web/github.com/username": "octocat",
+		"web/github.com/password": "hunter2",
+		"web/gitlab.com/password": "other",
+	} {
+		if _, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: name, Value: []byte(value)}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+
+	confirmer := &fakeConfirmer{allow: true}
+	a, err := New(c, confirmer, []string{"chrome-extension://allowed/"}, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	ts := httptest.NewServer(a.Handler())
+	defer ts.Close()
+	endpoint := Endpoint{Addr: strings.TrimPrefix(ts.URL, "http://"), Token: a.Token()}
+
+	relay := func(extension string, messages ...interface{}) []map[string]interface{} {
+		var in, out bytes.Buffer
+		for _, m := range messages {
+			if err := WriteMessage(&in, m); err != nil {
+				t.Fatalf("Failed to frame message: %v", err)
+			}
+		}
+		if err := RunNativeHost(ctx, &in, &out, extension, endpoint); err != nil {
+			t.Fatalf("Native host failed: %v", err)
+		}
+		var replies []map[string]interface{}
+		for out.Len() > 0 {
+			raw, err := ReadMessage(&out)
+			if err != nil {
+				t.Fatalf("Failed to read reply: %v", err)
+			}
+			var reply map[string]interface{}
+			_ = json.Unmarshal(raw, &reply)
+			replies = append(replies, reply)
+		}
+		return replies
+	}
+
+	replies := relay("chrome-extension://allowed", map[string]string{"type": "get_credentials", "origin": "https://github.com/login"})
+	fields, _ := replies[0]["fields"].(map[string]interface{})
+	if fields["username"] != "octocat" || fields["password"] != "hunter2" || len(fields) != 2 {
+		t.Errorf("Unexpected reply: %v", replies[0])
+	}
+	if len(confirmer.prompts) != 1 {
+		t.Errorf("Expected one confirmation prompt, got %d", len(confirmer.prompts))
+	}
+
+	replies = relay("chrome-extension://evil/",
+		map[string]string{"type": "get_credentials", "origin": "https://github.com"})
+	if replies[0]["error"] == nil || len(confirmer.prompts) != 1 {
+		t.Errorf("Expected unlisted extension to be rejected before prompting, got %v", replies[0])
+	}
+
+	replies = relay("chrome-extension://allowed/", map[string]string{"type": "get_credentials", "origin": "http://github.com"})
+	if replies[0]["error"] == nil {
+		t.Error("Expected insecure origin to be rejected")
+	}
+
+	confirmer.allow = false
+	replies = relay("chrome-extension://allowed/", map[string]string{"type": "get_credentials", "origin": "https://github.com"})
+	if msg, _ := replies[0]["error"].(string); !strings.Contains(msg, "denied") {
+		t.Errorf("Expected denial, got %v", replies[0])
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/credentials", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+a.Token())
+	req.Header.Set("Origin", "https://evil.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected browser-originated request to be forbidden, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// HostName is the native messaging host name the extension connects to
+const HostName = "io.secretly.agent"
+
+// maxMessageSize is the limit browsers apply to messages sent to a host
+const maxMessageSize = 1 << 20
+
+// ReadMessage reads one native messaging frame: a 32-bit length in native
+// byte order (little-endian on every supported platform) followed by JSON
+func ReadMessage(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", size, maxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// WriteMessage writes v as one native messaging frame
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("response of %d bytes exceeds the %d byte limit", len(data), maxMessageSize)
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Endpoint tells the native host where the running agent listens
+type Endpoint struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+// EndpointPath is ~/.secretly/agent.json
+func EndpointPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secretly", "agent.json"), nil
+}
+
+// SaveEndpoint writes the endpoint file readable only by the current user
+func SaveEndpoint(path string, e Endpoint) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// LoadEndpoint reads the endpoint file of a running agent
+func LoadEndpoint(path string) (Endpoint, error) {
+	var e Endpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, fmt.Errorf("secretly agent is not running: start it with 'secretly agent'")
+	}
+	if err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal(data, &e)
+}
+
+// hostMessage is a request from the extension
+type hostMessage struct {
+	Type   string `json:"type"`
+	Origin string `json:"origin"`
+}
+
+// RunNativeHost relays extension messages to the agent until the browser
+// closes stdin. extension is the caller identity passed by the browser; the
+// extension cannot choose it, so it is what the allow-list is checked
+// against.
+func RunNativeHost(ctx context.Context, in io.Reader, out io.Writer, extension string, endpoint Endpoint) error {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	for {
+		raw, err := ReadMessage(in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg hostMessage
+		if err := json.Unmarshal(raw, &msg); err != nil || msg.Type != "get_credentials" {
+			if err := WriteMessage(out, map[string]string{"error": "unsupported message"}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		reply, err := forward(ctx, client, endpoint, CredentialRequest{Extension: extension, Origin: msg.Origin})
+		if err != nil {
+			reply = map[string]interface{}{"error": err.Error()}
+		}
+		if err := WriteMessage(out, reply); err != nil {
+			return err
+		}
+	}
+}
+
+func forward(ctx context.Context, client *http.Client, endpoint Endpoint, req CredentialRequest) (map[string]interface{}, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+endpoint.Addr+"/v1/credentials", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+endpoint.Token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("secretly agent is not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var reply map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMessageSize)).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("invalid agent response: %w", err)
+	}
+	return reply, nil
+}
+
+// Browsers supported by InstallManifest
+const (
+	BrowserChrome  = "chrome"
+	BrowserFirefox = "firefox"
+)
+
+// InstallManifest registers the native host for the current user and returns
+// the manifest path. Chrome allow-lists extensions by origin, Firefox by
+// add-on ID.
+func InstallManifest(browser, executable string, extensions []string) (string, error) {
+	dir, err := manifestDir(browser)
+	if err != nil {
+		return "", err
+	}
+	manifest := map[string]interface{}{
+		"name":        HostName,
+		"description": "Secretly credential bridge",
+		"path":        executable,
+		"type":        "stdio",
+	}
+	if browser == BrowserFirefox {
+		manifest["allowed_extensions"] = extensions
+	} else {
+		manifest["allowed_origins"] = extensions
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, HostName+".json")
+	return path, os.WriteFile(path, data, 0644)
+}
+
+func manifestDir(browser string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case browser == BrowserChrome && runtime.GOOS == "darwin":
+		return filepath.Join(home, "Library/Application Support/Google/Chrome/NativeMessagingHosts"), nil
+	case browser == BrowserChrome && runtime.GOOS == "linux":
+		return filepath.Join(home, ".config/google-chrome/NativeMessagingHosts"), nil
+	case browser == BrowserFirefox && runtime.GOOS == "darwin":
+		return filepath.Join(home, "Library/Application Support/Mozilla/NativeMessagingHosts"), nil
+	case browser == BrowserFirefox && runtime.GOOS == "linux":
+		return filepath.Join(home, ".mozilla/native-messaging-hosts"), nil
+	case browser != BrowserChrome && browser != BrowserFirefox:
+		return "", fmt.Errorf("unsupported browser %q: use %s or %s", browser, BrowserChrome, BrowserFirefox)
+	default:
+		return "", fmt.Errorf("automatic registration is not supported on %s; register the manifest manually", runtime.GOOS)
+	}
+}
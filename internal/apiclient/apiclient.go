@@ -0,0 +1,218 @@
+// Package apiclient calls a Secretly server's HTTP API on behalf of CLI
+// commands, authenticated with the session token stored by 'secretly login'.
+package apiclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/credstore"
+)
+
+// UserAgent identifies CLI requests, e.g. in a user's session list
+const UserAgent = "secretly-cli"
+
+// ModeHeader is set by the server while it is in read-only or maintenance
+// mode
+const ModeHeader = "X-Secretly-Mode"
+
+// maxResponseSize bounds the JSON responses read from the server
+const maxResponseSize = 1 << 20
+
+// Client sends authenticated requests to one server
+type Client struct {
+	server string
+	token  string
+	http   *http.Client
+
+	modeBanner sync.Once
+}
+
+// New creates a client for serverURL using the token stored for it in the
+// configured token store
+func New(serverURL string) (*Client, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	store, err := credstore.Open(cfg.CLI.TokenStore)
+	if err != nil {
+		return nil, err
+	}
+	token, err := store.Load(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		server: strings.TrimSuffix(serverURL, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// ProblemError turns an application/problem+json body into an error that
+// includes the correlation ID to quote when reporting it
+func ProblemError(status int, body []byte) error {
+	var p struct {
+		Detail        string `json:"detail"`
+		Code          string `json:"code"`
+		CorrelationID string `json:"correlation_id"`
+	}
+	_ = json.Unmarshal(body, &p)
+	msg := fmt.Sprintf("server returned %d: %s", status, p.Detail)
+	if p.Code != "" {
+		msg += fmt.Sprintf(" [%s]", p.Code)
+	}
+	if p.CorrelationID != "" {
+		msg += fmt.Sprintf(" (correlation ID %s)", p.CorrelationID)
+	}
+	return errors.New(msg)
+}
+
+// ProblemCode returns the code of an application/problem+json body, or ""
+func ProblemCode(body []byte) string {
+	var p struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(body, &p)
+	return p.Code
+}
+
+// Do sends body as JSON and decodes the JSON response into out; body and
+// out may be nil. Responses of 300 and above are returned as errors with
+// the server's message.
+func (c *Client) Do(method, path string, body, out interface{}) error {
+	resp, err := c.send(c.http, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return responseError(resp, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Download copies the body of a GET of path to w, e.g. a profile, allowing
+// the request up to timeout
+func (c *Client) Download(path string, w io.Writer, timeout time.Duration) error {
+	resp, err := c.send(&http.Client{Timeout: timeout}, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return responseError(resp, data)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Stream reads the server-sent events at path and calls fn with the type
+// and data of each one until the server closes the stream or fn returns
+// an error
+func (c *Client) Stream(path string, fn func(event, data string) error) error {
+	// No client timeout: the stream stays open for as long as it is read
+	resp, err := c.send(&http.Client{}, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return responseError(resp, data)
+	}
+
+	var event string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// comment, e.g. a heartbeat
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream interrupted: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) send(client *http.Client, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("User-Agent", UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if mode := resp.Header.Get(ModeHeader); mode != "" {
+		c.modeBanner.Do(func() {
+			fmt.Fprintf(os.Stderr, "⚠️  Server is in %s mode\n", strings.ReplaceAll(mode, "_", "-"))
+		})
+	}
+	return resp, nil
+}
+
+// responseError turns a response of 300 and above into an error with the
+// server's message
+func responseError(resp *http.Response, data []byte) error {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+		return ProblemError(resp.StatusCode, data)
+	}
+	// Failed operations are answered with the operation itself
+	var op struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(data, &op) == nil && op.Status != "" {
+		return fmt.Errorf("server returned %d: operation %s: %s", resp.StatusCode, op.Status, op.Reason)
+	}
+	return fmt.Errorf("server returned %d", resp.StatusCode)
+}
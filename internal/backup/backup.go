@@ -0,0 +1,439 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/encryption"
+	"github.com/secretlyhq/secretly/internal/securefiles"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// FormatVersion is the version of the bundle layout produced by Create
+const FormatVersion = 1
+
+const (
+	bundleFormat   = "secretly-backup"
+	bundleKeyID    = "backup"
+	bundleChunkKB  = 64
+	saltSize       = 16
+	kdfIterations  = 100000
+	manifestName   = "manifest.json"
+	databaseName   = "database/secretly.db"
+	wrappedKEKName = "keys/kek.key.wrapped"
+	wrappedDEKName = "keys/dek.key.wrapped"
+)
+
+// Manifest describes the contents of a backup bundle
+type Manifest struct {
+	FormatVersion     int         `json:"format_version"`
+	CreatedAt         time.Time   `json:"created_at"`
+	AppVersion        string      `json:"app_version,omitempty"`
+	SchemaVersion     int         `json:"schema_version,omitempty"` // 0 for databases that predate it
+	ConfigFingerprint string      `json:"config_fingerprint"`
+	EncryptionEnabled bool        `json:"encryption_enabled"`
+	SchemaTables      []string    `json:"schema_tables"`
+	Files             []FileEntry `json:"files"`
+}
+
+// FileEntry records the size and checksum of a file stored in the bundle
+type FileEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options controls backup creation
+type Options struct {
+	Config     *config.Config
+	ConfigPath string
+	Passphrase string
+	OutputPath string
+}
+
+// bundle is the on-disk encrypted envelope
+type bundle struct {
+	Format     string                      `json:"format"`
+	Version    int                         `json:"version"`
+	Salt       string                      `json:"salt"`
+	Iterations int                         `json:"iterations"`
+	Chunks     []*encryption.EncryptedData `json:"chunks"`
+}
+
+// Create writes an encrypted backup bundle containing the database snapshot,
+// a fingerprint of the configuration and the encryption keys wrapped with a
+// passphrase-derived key
+func Create(opts Options) (*Manifest, error) {
+	if opts.Passphrase == "" {
+		return nil, fmt.Errorf("backup passphrase is required")
+	}
+
+	salt, err := encryption.GenerateRandomKey(saltSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	es, err := encryption.NewEncryptionService(encryption.GenerateKEK(opts.Passphrase, salt, kdfIterations))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle cipher: %w", err)
+	}
+
+	configData, err := readFile(opts.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	dbSnapshot, tables, schema, err := snapshotDatabase(opts.Config.Storage.Database.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	files := map[string][]byte{databaseName: dbSnapshot}
+
+	if opts.Config.Storage.Encryption.Enabled {
+		for name, path := range map[string]string{
+			wrappedKEKName: opts.Config.Storage.Encryption.KEKPath,
+			wrappedDEKName: opts.Config.Storage.Encryption.DEKPath,
+		} {
+			wrapped, err := wrapKeyFile(es, path)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = wrapped
+		}
+	}
+
+	manifest := &Manifest{
+		FormatVersion:     FormatVersion,
+		CreatedAt:         time.Now().UTC(),
+		AppVersion:        appVersion(),
+		SchemaVersion:     schema,
+		ConfigFingerprint: checksum(configData),
+		EncryptionEnabled: opts.Config.Storage.Encryption.Enabled,
+		SchemaTables:      tables,
+	}
+
+	archive, err := buildArchive(manifest, files)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := es.EncryptChunked(archive, bundleChunkKB*1024, bundleKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt bundle: %w", err)
+	}
+
+	out, err := json.Marshal(&bundle{
+		Format:     bundleFormat,
+		Version:    FormatVersion,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Iterations: kdfIterations,
+		Chunks:     chunks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize bundle: %w", err)
+	}
+
+	outPath, err := filepath.Abs(opts.OutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := securefiles.SecureWriteFile(filepath.Dir(outPath), outPath, out, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// Verify decrypts a bundle and checks every file against the manifest checksums
+func Verify(path, passphrase string) (*Manifest, error) {
+	manifest, _, _, err := open(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// open decrypts a bundle and returns its verified manifest, file contents and cipher
+func open(path, passphrase string) (*Manifest, map[string][]byte, *encryption.EncryptionService, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	var b bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if b.Format != bundleFormat {
+		return nil, nil, nil, fmt.Errorf("not a secretly backup bundle")
+	}
+	if b.Version > FormatVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported bundle version %d (max supported %d)", b.Version, FormatVersion)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(b.Salt)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode bundle salt: %w", err)
+	}
+	es, err := encryption.NewEncryptionService(encryption.GenerateKEK(passphrase, salt, b.Iterations))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create bundle cipher: %w", err)
+	}
+
+	archive, err := es.DecryptChunked(b.Chunks)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decrypt bundle (wrong passphrase or corrupted file): %w", err)
+	}
+
+	files, err := readArchive(archive)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	raw, ok := files[manifestName]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("bundle is missing %s", manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	for _, entry := range manifest.Files {
+		content, ok := files[entry.Name]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("bundle is missing %s", entry.Name)
+		}
+		if int64(len(content)) != entry.Size || !hmac.Equal([]byte(checksum(content)), []byte(entry.SHA256)) {
+			return nil, nil, nil, fmt.Errorf("checksum mismatch for %s", entry.Name)
+		}
+	}
+
+	return &manifest, files, es, nil
+}
+
+func buildArchive(manifest *Manifest, files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		manifest.Files = append(manifest.Files, FileEntry{
+			Name:   name,
+			Size:   int64(len(files[name])),
+			SHA256: checksum(files[name]),
+		})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, content []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s header: %w", name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := write(manifestName, manifestData); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize compression: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func readArchive(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = content
+	}
+	return files, nil
+}
+
+// snapshotDatabase produces a consistent copy of the SQLite database using
+// VACUUM INTO and returns it together with the list of tables it contains
+func snapshotDatabase(dbPath string) ([]byte, []string, int, error) {
+	db, err := gorm.Open(sqlite.Open(filepath.Clean(dbPath)), &gorm.Config{})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to access database handle: %w", err)
+	}
+	defer func() { _ = sqlDB.Close() }()
+
+	tables, err := listTables(db)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	schema, err := schemaVersion(db)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "secretly-backup-")
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	snapshotPath := filepath.Join(tmpDir, "snapshot.db")
+	if err := db.Exec("VACUUM INTO ?", snapshotPath).Error; err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	data, err := securefiles.SafeReadFile(tmpDir, snapshotPath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read database snapshot: %w", err)
+	}
+	return data, tables, schema, nil
+}
+
+func listTables(db *gorm.DB) ([]string, error) {
+	var tables []string
+	err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").
+		Scan(&tables).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// schemaVersion returns the schema version recorded by storage.Migrate,
+// or 0 for databases migrated before it was recorded
+func schemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&models.SystemMetadata{}) {
+		return 0, nil
+	}
+	var values []string
+	err := db.Model(&models.SystemMetadata{}).Where("key = ?", storage.SchemaVersionKey).Pluck("value", &values).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(values[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", values[0])
+	}
+	return version, nil
+}
+
+// appVersion returns the version of the running binary
+func appVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+func wrapKeyFile(es *encryption.EncryptionService, path string) ([]byte, error) {
+	key, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+	encrypted, err := es.Encrypt(key, bundleKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key %s: %w", path, err)
+	}
+	return encryption.SerializeEncryptedData(encrypted)
+}
+
+func unwrapKey(es *encryption.EncryptionService, wrapped []byte) ([]byte, error) {
+	encrypted, err := encryption.DeserializeEncryptedData(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return es.Decrypt(encrypted)
+}
+
+// readFile reads a file given an absolute or working-directory relative path
+func readFile(path string) ([]byte, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return securefiles.SafeReadFile(filepath.Dir(absPath), absPath)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// randomSuffix is used to name temporary files created during restore
+func randomSuffix() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/encryption"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func setupInstallation(t *testing.T) (*config.Config, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Storage.Database.Path = filepath.Join(dir, "secretly.db")
+	cfg.Storage.Encryption.Enabled = true
+	cfg.Storage.Encryption.KEKPath = filepath.Join(dir, "keys", "kek.key")
+	cfg.Storage.Encryption.DEKPath = filepath.Join(dir, "keys", "dek.key")
+
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0750); err != nil {
+		t.Fatalf("Failed to create keys dir: %v", err)
+	}
+	for _, path := range []string{cfg.Storage.Encryption.KEKPath, cfg.Storage.Encryption.DEKPath} {
+		key, err := encryption.GenerateRandomKey(32)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			t.Fatalf("Failed to write key: %v", err)
+		}
+	}
+
+	configPath := filepath.Join(dir, "secretly.yaml")
+	if err := os.WriteFile(configPath, []byte("storage: {}\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(cfg.Storage.Database.Path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SecretNode{}, &models.SecretVersion{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err := db.Create(&models.SecretNode{Name: "db-password"}).Error; err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	_ = sqlDB.Close()
+
+	return cfg, configPath
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	cfg, configPath := setupInstallation(t)
+	bundlePath := filepath.Join(t.TempDir(), "secretly.bak")
+
+	manifest, err := Create(Options{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, OutputPath: bundlePath})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if len(manifest.Files) != 3 {
+		t.Errorf("Expected 3 files in manifest, got %d", len(manifest.Files))
+	}
+
+	raw, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	kek, _ := os.ReadFile(cfg.Storage.Encryption.KEKPath)
+	if bytes.Contains(raw, kek) {
+		t.Error("Bundle must not contain the raw KEK")
+	}
+
+	if _, err := Verify(bundlePath, testPassphrase); err != nil {
+		t.Fatalf("Failed to verify bundle: %v", err)
+	}
+	if _, err := Verify(bundlePath, "wrong passphrase"); err == nil {
+		t.Error("Expected error when verifying with wrong passphrase")
+	}
+
+	report, err := Restore(RestoreOptions{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, BundlePath: bundlePath, DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry-run restore failed: %v", err)
+	}
+	if !report.ConfigMatches || !report.Compatible() || report.Restored {
+		t.Errorf("Unexpected dry-run report: %+v", report)
+	}
+
+	if err := os.WriteFile(cfg.Storage.Encryption.KEKPath, make([]byte, 32), 0600); err != nil {
+		t.Fatalf("Failed to overwrite KEK: %v", err)
+	}
+
+	report, err = Restore(RestoreOptions{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, BundlePath: bundlePath})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !report.Restored {
+		t.Error("Expected restore to be performed")
+	}
+
+	restored, _ := os.ReadFile(cfg.Storage.Encryption.KEKPath)
+	if !bytes.Equal(restored, kek) {
+		t.Error("Restored KEK doesn't match original")
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	cfg, configPath := setupInstallation(t)
+	bundlePath := filepath.Join(t.TempDir(), "secretly.bak")
+
+	if _, err := Create(Options{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, OutputPath: bundlePath}); err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	raw, _ := os.ReadFile(bundlePath)
+	for name, tampered := range map[string][]byte{
+		"data":           bytes.Replace(raw, []byte(`"data":"`), []byte(`"data":"AAAA`), 1),
+		"negative index": bytes.Replace(raw, []byte(`"total_chunks":`), []byte(`"chunk_index":-1,"total_chunks":`), 1),
+	} {
+		if err := os.WriteFile(bundlePath, tampered, 0600); err != nil {
+			t.Fatalf("Failed to write tampered bundle: %v", err)
+		}
+		if _, err := Verify(bundlePath, testPassphrase); err == nil {
+			t.Errorf("%s: expected verification of tampered bundle to fail", name)
+		}
+	}
+}
+
+func TestRestoreRefusesMismatches(t *testing.T) {
+	cfg, configPath := setupInstallation(t)
+	bundlePath := filepath.Join(t.TempDir(), "secretly.bak")
+	manifest, err := Create(Options{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, OutputPath: bundlePath})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if manifest.AppVersion == "" {
+		t.Error("Expected the manifest to record the app version")
+	}
+
+	if err := os.WriteFile(configPath, []byte("storage: {changed: true}\n"), 0600); err != nil {
+		t.Fatalf("Failed to change config: %v", err)
+	}
+	opts := RestoreOptions{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, BundlePath: bundlePath}
+	report, err := Restore(opts)
+	if !errors.Is(err, ErrMismatch) || report == nil || len(report.Mismatches) != 1 || report.Restored {
+		t.Fatalf("Expected the changed config to refuse the restore, got %+v, %v", report, err)
+	}
+	opts.Force = true
+	if report, err := Restore(opts); err != nil || !report.Restored {
+		t.Fatalf("Expected a forced restore, got %+v, %v", report, err)
+	}
+
+	opts.Config.Storage.Encryption.KEKPath = ""
+	if _, err := Restore(opts); err == nil {
+		t.Error("Expected an empty key path to be rejected")
+	}
+}
+
+func TestRestoreReplacesAllOrNothing(t *testing.T) {
+	cfg, configPath := setupInstallation(t)
+	bundlePath := filepath.Join(t.TempDir(), "secretly.bak")
+	if _, err := Create(Options{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, OutputPath: bundlePath}); err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if err := os.WriteFile(cfg.Storage.Encryption.KEKPath, make([]byte, 32), 0600); err != nil {
+		t.Fatalf("Failed to overwrite KEK: %v", err)
+	}
+
+	// The database cannot be written, so the keys must stay as they are
+	blocker := filepath.Join(t.TempDir(), "not-a-directory")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	cfg.Storage.Database.Path = filepath.Join(blocker, "secretly.db")
+	opts := RestoreOptions{Config: cfg, ConfigPath: configPath, Passphrase: testPassphrase, BundlePath: bundlePath, Force: true}
+	if _, err := Restore(opts); err == nil {
+		t.Fatal("Expected the restore to fail")
+	}
+	if kek, _ := os.ReadFile(cfg.Storage.Encryption.KEKPath); !bytes.Equal(kek, make([]byte, 32)) {
+		t.Error("Expected the KEK to be left alone")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(cfg.Storage.Encryption.KEKPath))
+	if len(entries) != 2 {
+		t.Errorf("Expected no leftover files next to the keys, got %d entries", len(entries))
+	}
+}
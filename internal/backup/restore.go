@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/securefiles"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ErrMismatch is returned when a bundle does not match the installation
+// it is restored into and the restore is not forced
+var ErrMismatch = errors.New("backup does not match this installation")
+
+// RestoreOptions controls bundle restoration
+type RestoreOptions struct {
+	Config     *config.Config
+	ConfigPath string
+	Passphrase string
+	BundlePath string
+	DryRun     bool
+	// Force restores even when the report lists mismatches
+	Force bool
+}
+
+// RestoreReport describes the compatibility of a bundle with the current installation
+type RestoreReport struct {
+	Manifest      *Manifest
+	ConfigMatches bool
+	SchemaVersion int      // of the current database, 0 when unknown
+	MissingTables []string // present in the bundle, absent in the current database
+	ExtraTables   []string // present in the current database, absent in the bundle
+	Mismatches    []string // refuse the restore unless it is forced
+	Warnings      []string
+	Restored      bool
+}
+
+// Compatible reports whether the bundle can be restored without schema changes
+func (r *RestoreReport) Compatible() bool {
+	return len(r.MissingTables) == 0 && len(r.ExtraTables) == 0
+}
+
+// Restore verifies a bundle and, unless DryRun is set, replaces the database
+// and encryption keys with the bundle contents. A bundle that does not
+// match the installation, see RestoreReport.Mismatches, is restored only
+// with Force. The new files are written next to the old ones first and
+// then moved into place together; existing files are preserved with a
+// .pre-restore suffix and put back if any of the moves fails.
+func Restore(opts RestoreOptions) (*RestoreReport, error) {
+	dbPath := opts.Config.Storage.Database.Path
+	if dbPath == "" {
+		return nil, fmt.Errorf("storage.database.path is not set")
+	}
+	keys := opts.Config.Storage.Encryption
+	manifest, files, es, err := open(opts.BundlePath, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.EncryptionEnabled && (keys.KEKPath == "" || keys.DEKPath == "") {
+		return nil, fmt.Errorf("the backup has encryption keys: set storage.encryption.kek_path and dek_path")
+	}
+
+	report := &RestoreReport{Manifest: manifest}
+
+	if configData, err := readFile(opts.ConfigPath); err == nil {
+		report.ConfigMatches = checksum(configData) == manifest.ConfigFingerprint
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Cannot fingerprint current config: %v", err))
+	}
+	if !report.ConfigMatches {
+		report.Mismatches = append(report.Mismatches, "Current configuration differs from the one used for the backup")
+	}
+
+	dbPath = filepath.Clean(dbPath)
+	if _, err := os.Stat(dbPath); err == nil {
+		current, schema, err := currentTables(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		report.SchemaVersion = schema
+		report.MissingTables, report.ExtraTables = diffTables(manifest.SchemaTables, current)
+		if !report.Compatible() {
+			report.Mismatches = append(report.Mismatches, "The tables of the backup differ from those of the current database")
+		}
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Database file does not exist: %s (will be created)", dbPath))
+	}
+	if manifest.SchemaVersion > storage.SchemaVersion {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("Backup has schema version %d, newer than %d of this release (%s)",
+			manifest.SchemaVersion, storage.SchemaVersion, manifest.AppVersion))
+	}
+
+	if manifest.EncryptionEnabled != keys.Enabled {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("Backup encryption_enabled=%v but current config has %v",
+			manifest.EncryptionEnabled, keys.Enabled))
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if len(report.Mismatches) > 0 && !opts.Force {
+		return report, fmt.Errorf("%w: %d mismatches, restore with force to proceed anyway", ErrMismatch, len(report.Mismatches))
+	}
+
+	var staged []*stagedFile
+	defer func() {
+		for _, f := range staged {
+			f.discard()
+		}
+	}()
+	if manifest.EncryptionEnabled {
+		for _, key := range []struct{ name, path string }{
+			{wrappedKEKName, keys.KEKPath},
+			{wrappedDEKName, keys.DEKPath},
+		} {
+			data, err := unwrapKey(es, files[key.name])
+			if err != nil {
+				return report, fmt.Errorf("failed to unwrap %s: %w", key.name, err)
+			}
+			f, err := stageFile(key.path, data)
+			if err != nil {
+				return report, fmt.Errorf("failed to restore key %s: %w", key.path, err)
+			}
+			staged = append(staged, f)
+		}
+	}
+	f, err := stageFile(dbPath, files[databaseName])
+	if err != nil {
+		return report, fmt.Errorf("failed to restore database: %w", err)
+	}
+	staged = append(staged, f)
+
+	suffix := fmt.Sprintf(".pre-restore.%d", time.Now().Unix())
+	for i, f := range staged {
+		if err := f.commit(suffix); err != nil {
+			for _, done := range staged[:i] {
+				done.rollback(suffix)
+			}
+			return report, fmt.Errorf("failed to restore %s: %w", f.path, err)
+		}
+	}
+	staged = nil
+
+	report.Restored = true
+	return report, nil
+}
+
+// stagedFile is new content written next to the file it replaces
+type stagedFile struct {
+	path, tmpPath string
+	existed       bool
+}
+
+// stageFile writes data to a temporary file next to path
+func stageFile(path string, data []byte) (*stagedFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(absPath)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	tmpPath := absPath + ".restore-" + randomSuffix()
+	if err := securefiles.SecureWriteFile(dir, tmpPath, data, 0600); err != nil {
+		return nil, err
+	}
+	return &stagedFile{path: absPath, tmpPath: tmpPath}, nil
+}
+
+// commit moves the existing file aside with suffix and the new one into
+// its place
+func (f *stagedFile) commit(suffix string) error {
+	if _, err := os.Stat(f.path); err == nil {
+		if err := os.Rename(f.path, f.path+suffix); err != nil {
+			return fmt.Errorf("failed to preserve existing file: %w", err)
+		}
+		f.existed = true
+	}
+	if err := os.Rename(f.tmpPath, f.path); err != nil {
+		f.rollback(suffix)
+		return err
+	}
+	return nil
+}
+
+// rollback puts back the file commit moved aside
+func (f *stagedFile) rollback(suffix string) {
+	if f.existed {
+		_ = os.Rename(f.path+suffix, f.path)
+	} else {
+		_ = os.Remove(f.path)
+	}
+}
+
+// discard removes the temporary file of a restore that did not complete
+func (f *stagedFile) discard() {
+	_ = os.Remove(f.tmpPath)
+}
+
+func currentTables(dbPath string) ([]string, int, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open current database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to access database handle: %w", err)
+	}
+	defer func() { _ = sqlDB.Close() }()
+
+	tables, err := listTables(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	schema, err := schemaVersion(db)
+	return tables, schema, err
+}
+
+func diffTables(bundled, current []string) (missing, extra []string) {
+	inCurrent := make(map[string]bool, len(current))
+	for _, t := range current {
+		inCurrent[t] = true
+	}
+	inBundle := make(map[string]bool, len(bundled))
+	for _, t := range bundled {
+		inBundle[t] = true
+		if !inCurrent[t] {
+			missing = append(missing, t)
+		}
+	}
+	for _, t := range current {
+		if !inBundle[t] {
+			extra = append(extra, t)
+		}
+	}
+	return missing, extra
+}
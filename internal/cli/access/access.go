@@ -0,0 +1,126 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFormat string
+	reportOutput string
+)
+
+// AccessCmd reports who has access to secrets
+var AccessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Report who has access to a secret, or what a user can access",
+	Long: `Resolve effective access from every source: password logins, which are
+not scoped, secret ownership, auth.oidc policies acting as a user (limited
+to their namespace, environment and read-only setting) and
+security.approvals admins who can approve deleting protected secrets.
+
+Examples:
+  secretly access secret 42
+  secretly access user ci --format csv --output ci-access.csv`,
+}
+
+var secretCmd = &cobra.Command{
+	Use:   "secret <secret-id>",
+	Short: "List the users who can access a secret and why",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid secret id %q", args[0])
+		}
+		return report(func(ctx context.Context, c *core.SecretlyCore) ([]core.AccessGrant, error) {
+			return c.SecretAccess(ctx, uint(id))
+		})
+	},
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user <username>",
+	Short: "List the secrets a user can access and why",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return report(func(ctx context.Context, c *core.SecretlyCore) ([]core.AccessGrant, error) {
+			return c.UserAccess(ctx, args[0])
+		})
+	},
+}
+
+func init() {
+	AccessCmd.PersistentFlags().StringVar(&reportFormat, "format", "table", "Report format: table, json or csv")
+	AccessCmd.PersistentFlags().StringVar(&reportOutput, "output", "", "Write the report to a file instead of stdout")
+	AccessCmd.AddCommand(secretCmd, userCmd)
+}
+
+func report(resolve func(context.Context, *core.SecretlyCore) ([]core.AccessGrant, error)) error {
+	if reportFormat != "table" && reportFormat != "json" && reportFormat != "csv" {
+		return fmt.Errorf("unsupported format %q: use table, json or csv", reportFormat)
+	}
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	grants, err := resolve(context.Background(), app.Core)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if reportOutput != "" {
+		f, err := os.OpenFile(reportOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create report file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch reportFormat {
+	case "json":
+		if grants == nil {
+			grants = []core.AccessGrant{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(grants)
+	case "csv":
+		err = core.WriteAccessCSV(w, grants)
+	default:
+		err = writeTable(w, grants)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if reportOutput != "" {
+		fmt.Printf("📋 Report written to %s\n", reportOutput)
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, grants []core.AccessGrant) error {
+	if len(grants) == 0 {
+		_, err := fmt.Fprintln(w, "No access found")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SECRET\tUSER\tLEVEL\tSOURCE\tDETAIL")
+	for _, g := range grants {
+		fmt.Fprintf(tw, "%d %s\t%s\t%s\t%s\t%s\n", g.SecretID, g.SecretName, g.Username, g.Level, g.Source, g.Detail)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/agent"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	installBrowser    string
+	installExtensions []string
+)
+
+// AgentCmd runs the local agent used by the browser extension
+var AgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Serve website credentials to the Secretly browser extension",
+	Long: `Run a local agent that lets the companion browser extension fill login
+forms. The extension talks to a native messaging host started by the
+browser, which forwards requests to this agent over loopback.
+
+Only extensions listed in agent.allowed_extensions are served, only https
+origins are filled, and every request must be confirmed here. Credentials
+for https://github.com are read from the secrets "web/github.com/username",
+"web/github.com/password" and any other "web/github.com/<field>".
+
+Examples:
+  secretly agent install --browser chrome --extension chrome-extension://<id>/
+  secretly agent`,
+	Args: cobra.NoArgs,
+	RunE: runAgent,
+}
+
+var nativeHostCmd = &cobra.Command{
+	Use:    "native-host [caller...]",
+	Short:  "Native messaging host started by the browser",
+	Hidden: true,
+	RunE:   runNativeHost,
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install --browser <chrome|firefox> --extension <id>",
+	Short: "Register the native messaging host with a browser",
+	Args:  cobra.NoArgs,
+	RunE:  runInstall,
+}
+
+func init() {
+	installCmd.Flags().StringVar(&installBrowser, "browser", agent.BrowserChrome, "Browser: chrome or firefox")
+	installCmd.Flags().StringSliceVar(&installExtensions, "extension", nil, "Extension origin (Chrome) or add-on ID (Firefox) allowed to connect")
+	_ = installCmd.MarkFlagRequired("extension")
+	AgentCmd.AddCommand(nativeHostCmd, installCmd)
+}
+
+func runAgent(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	cfg := app.Config.Agent
+	if len(cfg.AllowedExtensions) == 0 {
+		return fmt.Errorf("no extensions allowed: set agent.allowed_extensions in the configuration")
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = "127.0.0.1:0"
+	}
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid agent.listen: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("agent.listen must be a loopback address, got %s", listen)
+	}
+
+	a, err := agent.New(app.Core, newTerminalConfirmer(), cfg.AllowedExtensions, time.Duration(cfg.ConfirmTimeoutSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+	endpointPath, err := agent.EndpointPath()
+	if err != nil {
+		return err
+	}
+	if err := agent.SaveEndpoint(endpointPath, agent.Endpoint{Addr: ln.Addr().String(), Token: a.Token()}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", endpointPath, err)
+	}
+	defer os.Remove(endpointPath)
+
+	srv := &http.Server{Handler: a.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("🔐 Secretly agent listening on %s\n", ln.Addr())
+	fmt.Println("💡 Requests from the browser extension will be shown here for confirmation; press Ctrl+C to stop")
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fmt.Println("👋 Agent stopped")
+	return nil
+}
+
+func runNativeHost(cmd *cobra.Command, args []string) error {
+	// Chrome passes the caller origin; Firefox passes the manifest path
+	// followed by the add-on ID
+	var extension string
+	switch len(args) {
+	case 0:
+		return fmt.Errorf("native-host must be started by the browser")
+	case 1:
+		extension = args[0]
+	default:
+		extension = args[1]
+	}
+
+	endpointPath, err := agent.EndpointPath()
+	if err != nil {
+		return err
+	}
+	endpoint, err := agent.LoadEndpoint(endpointPath)
+	if err != nil {
+		// Report to the extension; stdout belongs to the protocol
+		_ = agent.WriteMessage(os.Stdout, map[string]string{"error": err.Error()})
+		return err
+	}
+	return agent.RunNativeHost(context.Background(), os.Stdin, os.Stdout, extension, endpoint)
+}
+
+func runInstall(cmd *cobra.Command, args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	// Browsers start the host with the caller as the only arguments, so a
+	// wrapper selects the native-host subcommand
+	wrapper := filepath.Join(home, ".secretly", "native-host")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q agent native-host \"$@\"\n", executable)
+	if err := os.MkdirAll(filepath.Dir(wrapper), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(wrapper, []byte(script), 0700); err != nil {
+		return err
+	}
+
+	path, err := agent.InstallManifest(installBrowser, wrapper, installExtensions)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Registered %s for %s in %s\n", agent.HostName, installBrowser, path)
+	fmt.Println("💡 Also add the extension to agent.allowed_extensions, then start 'secretly agent'")
+	return nil
+}
+
+// terminalConfirmer asks on the agent's terminal. A single goroutine reads
+// stdin and drops lines typed while no prompt is open, so a stray "y" can
+// never approve a later request.
+type terminalConfirmer struct {
+	answers chan string
+}
+
+func newTerminalConfirmer() *terminalConfirmer {
+	t := &terminalConfirmer{answers: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			select {
+			case t.answers <- scanner.Text():
+			default:
+			}
+		}
+		close(t.answers)
+	}()
+	return t
+}
+
+func (t *terminalConfirmer) Confirm(ctx context.Context, prompt string) bool {
+	fmt.Printf("🔔 %s [y/N]: ", prompt)
+	select {
+	case answer, ok := <-t.answers:
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		allowed := ok && (answer == "y" || answer == "yes")
+		if allowed {
+			fmt.Println("✅ Allowed")
+		} else {
+			fmt.Println("❌ Denied")
+		}
+		return allowed
+	case <-ctx.Done():
+		fmt.Println("\n⌛ No answer, denied")
+		return false
+	}
+}
@@ -0,0 +1,142 @@
+package approval
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL    string
+	listStatus   string
+	rejectReason string
+)
+
+// ApprovalCmd lists and decides operations waiting for a second admin
+var ApprovalCmd = &cobra.Command{
+	Use:   "approval",
+	Short: "Review operations that need a second administrator",
+	Long: `Review destructive operations on protected secrets. With
+security.approvals enabled, deleting a secret tagged "critical",
+transferring it or granting access to it does not take effect but creates a
+pending operation, as does burning it after its last read; another
+administrator listed in security.approvals.admins must approve it before
+the window closes.
+
+Decisions are made on the server as the user of your stored session, so
+log in first with 'secretly login'.
+
+Examples:
+  secretly approval list --server https://secretly.example.com
+  secretly approval approve 12 --server https://secretly.example.com
+  secretly approval reject 12 --reason "still used by billing" --server https://secretly.example.com`,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pending operations",
+	Args:  cobra.NoArgs,
+	RunE:  runList,
+}
+
+var approveCmd = &cobra.Command{
+	Use:   "approve <operation-id>",
+	Short: "Approve and execute a pending operation",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return decide(args[0], "approve", nil)
+	},
+}
+
+var rejectCmd = &cobra.Command{
+	Use:   "reject <operation-id>",
+	Short: "Reject a pending operation, or withdraw your own request",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return decide(args[0], "reject", map[string]string{"reason": rejectReason})
+	},
+}
+
+func init() {
+	ApprovalCmd.PersistentFlags().StringVar(&serverURL, "server", "", "Secretly server URL")
+	_ = ApprovalCmd.MarkPersistentFlagRequired("server")
+	listCmd.Flags().StringVar(&listStatus, "status", "pending", "Status to list: pending, executed, rejected, expired, failed, or all")
+	rejectCmd.Flags().StringVar(&rejectReason, "reason", "", "Why the operation is rejected")
+	ApprovalCmd.AddCommand(listCmd, approveCmd, rejectCmd)
+}
+
+type operation struct {
+	ID          uint       `json:"id"`
+	Kind        string     `json:"kind"`
+	SecretID    uint       `json:"secret_id"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	DecidedBy   string     `json:"decided_by"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DecidedAt   *time.Time `json:"decided_at"`
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	path := "/api/v1/operations"
+	if listStatus != "all" {
+		path += "?" + url.Values{"status": {listStatus}}.Encode()
+	}
+	var ops []operation
+	if err := call(http.MethodGet, path, nil, &ops); err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		fmt.Printf("✅ No %s operations\n", listStatus)
+		return nil
+	}
+	fmt.Printf("📋 %d operation(s):\n", len(ops))
+	for _, op := range ops {
+		fmt.Printf("  #%d  %s of secret %d  requested by %s  %s", op.ID, op.Kind, op.SecretID, op.RequestedBy, op.Status)
+		if op.Status == "pending" {
+			fmt.Printf(" (expires in %s)", time.Until(op.ExpiresAt).Round(time.Minute))
+		} else if op.DecidedBy != "" {
+			fmt.Printf(" by %s", op.DecidedBy)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func decide(rawID, action string, body interface{}) error {
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid operation id %q", rawID)
+	}
+	var op operation
+	if err := call(http.MethodPost, fmt.Sprintf("/api/v1/operations/%d/%s", id, action), body, &op); err != nil {
+		return err
+	}
+	switch op.Status {
+	case "executed":
+		fmt.Printf("✅ Operation #%d approved and executed: %s of secret %d\n", op.ID, op.Kind, op.SecretID)
+	case "rejected":
+		fmt.Printf("✅ Operation #%d rejected\n", op.ID)
+	default:
+		fmt.Printf("⚠️  Operation #%d is %s", op.ID, op.Status)
+		if op.Reason != "" {
+			fmt.Printf(": %s", op.Reason)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// call sends an authenticated request to the server given by --server
+func call(method, path string, body, out interface{}) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	return client.Do(method, path, body, out)
+}
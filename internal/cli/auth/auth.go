@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/credstore"
+	"github.com/secretlyhq/secretly/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL      string
+	username       string
+	passwordStdin  bool
+	otp            string
+	passkey        bool
+	deviceLogin    bool
+	impersonate    string
+	reason         string
+	impersonateFor time.Duration
+)
+
+// LoginCmd creates a session on a Secretly server and stores its token
+var LoginCmd = &cobra.Command{
+	Use:   "login --server <url> --username <name>",
+	Short: "Log in to a Secretly server and store the session token",
+	Long: `Log in to a Secretly server and store the session token for later
+commands.
+
+Tokens are stored according to cli.token_store: "file" keeps them in
+~/.secretly/credentials.json readable only by you, "keychain" uses the
+macOS Keychain, the Secret Service via libsecret's secret-tool on Linux,
+or DPAPI encryption on Windows.
+
+Accounts with two-factor authentication are asked for a code from the
+authenticator app, or a recovery code, unless --otp is given. With
+--passkey the CLI shows a link to open in a browser, where you confirm the
+login with your passkey. With --device an enrolled machine logs in with
+its device key instead (see 'secretly auth devices').
+
+With --as an admin who is logged in acts as another user to troubleshoot,
+when the server enables impersonation. The impersonation session replaces
+the stored token; log in again as yourself when done.
+
+Examples:
+  secretly login --server https://secretly.example.com --username alice
+  echo "$PASSWORD" | secretly login --server https://secretly.example.com --username ci --password-stdin
+  secretly login --server https://secretly.example.com --username alice --passkey
+  secretly login --server https://secretly.example.com --device
+  secretly login --server https://secretly.example.com --as alice@example.com --reason "ticket 4711"`,
+	Args: cobra.NoArgs,
+	RunE: runLogin,
+}
+
+// LogoutCmd removes the stored session token for a server
+var LogoutCmd = &cobra.Command{
+	Use:   "logout --server <url>",
+	Short: "Remove the stored session token for a server",
+	Args:  cobra.NoArgs,
+	RunE:  runLogout,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{LoginCmd, LogoutCmd} {
+		cmd.Flags().StringVar(&serverURL, "server", "", "Secretly server URL")
+		_ = cmd.MarkFlagRequired("server")
+	}
+	LoginCmd.Flags().StringVar(&username, "username", "", "Username")
+	LoginCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from stdin")
+	LoginCmd.Flags().StringVar(&otp, "otp", "", "Two-factor authentication or recovery code (asked for when needed)")
+	LoginCmd.Flags().BoolVar(&passkey, "passkey", false, "Log in with a passkey in the browser instead of a password")
+	LoginCmd.Flags().BoolVar(&deviceLogin, "device", false, "Log in as this enrolled machine instead of a user")
+	LoginCmd.Flags().StringVar(&impersonate, "as", "", "Impersonate this user (username or email), as a logged-in admin")
+	LoginCmd.Flags().StringVar(&reason, "reason", "", "Why you impersonate the user, recorded in the audit log")
+	LoginCmd.Flags().DurationVar(&impersonateFor, "for", 0, "How long the impersonation lasts (default 15m)")
+}
+
+// tokenStore opens the store selected in the configuration
+func tokenStore() (credstore.Store, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return credstore.Open(cfg.CLI.TokenStore)
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	store, err := tokenStore()
+	if err != nil {
+		return err
+	}
+	if deviceLogin {
+		return runDeviceLogin(store)
+	}
+	if impersonate != "" {
+		return runImpersonate(store)
+	}
+	if username == "" {
+		return fmt.Errorf("--username is required")
+	}
+	if passkey {
+		return runPasskeyLogin(store)
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	status, data, err := postLogin(password, otp)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusUnauthorized && otp == "" && apiclient.ProblemCode(data) == "second_factor_required" {
+		if otp, err = prompt.Terminal().Hidden("Authentication code"); err != nil {
+			return err
+		}
+		if status, data, err = postLogin(password, otp); err != nil {
+			return err
+		}
+	}
+	if status != http.StatusOK {
+		if apiclient.ProblemCode(data) == "passkey_required" {
+			return fmt.Errorf("login failed: this account must log in with 'secretly login --passkey'")
+		}
+		return fmt.Errorf("login failed: %w", apiclient.ProblemError(status, data))
+	}
+	return saveSession(store, data)
+}
+
+// saveSession stores the token from a login response and reports the
+// session
+func saveSession(store credstore.Store, data []byte) error {
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Scope     string    `json:"scope"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || out.Token == "" {
+		return fmt.Errorf("login failed: unexpected response from server")
+	}
+
+	if err := store.Save(serverURL, out.Token); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	fmt.Printf("✅ Logged in to %s as %s\n", serverURL, username)
+	if !out.ExpiresAt.IsZero() {
+		fmt.Printf("⏰ Session expires %s\n", out.ExpiresAt.Local().Format(time.RFC1123))
+	}
+	switch out.Scope {
+	case enrollmentScope:
+		fmt.Printf("⚠️  This account must use two-factor authentication. Run 'secretly auth 2fa enroll --server %s' to continue.\n", serverURL)
+	case passkeyEnrollmentScope:
+		fmt.Printf("⚠️  This account must use a passkey. Run 'secretly auth passkeys add --server %s' to continue.\n", serverURL)
+	}
+	return nil
+}
+
+// postLogin sends the login request and returns the status and body
+func postLogin(password, otp string) (int, []byte, error) {
+	return postJSON("/api/v1/auth/login", map[string]string{"username": username, "password": password, "otp": otp})
+}
+
+// postJSON sends an unauthenticated request and returns the status and body
+func postJSON(path string, body interface{}) (int, []byte, error) {
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(serverURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", apiclient.UserAgent)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	store, err := tokenStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(serverURL); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Logged out of %s\n", serverURL)
+	return nil
+}
+
+// readPassword reads the password from stdin or asks for it with echo off
+func readPassword() (string, error) {
+	if passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	return prompt.Terminal().Hidden("Password")
+}
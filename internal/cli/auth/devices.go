@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/credstore"
+	"github.com/secretlyhq/secretly/internal/device"
+	"github.com/spf13/cobra"
+)
+
+var (
+	enrollToken     string
+	deviceName      string
+	deviceUser      string
+	deviceNamespace uint
+	deviceReadOnly  bool
+	tokenTTL        time.Duration
+)
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Enroll this machine or manage enrolled devices",
+	Long: `Machines such as build agents and servers can enroll with a one-time
+token from an admin holding devices.manage. Enrolling creates a key that
+never leaves the machine and gets a certificate for it from the server's
+device CA; 'secretly login --device' then logs in by signing a
+challenge with that key. A device acts as the user chosen by the admin,
+limited to one namespace and, optionally, to reading.
+
+Examples:
+  secretly auth devices token build-01 --user ci --namespace 2 --read-only --server https://secretly.example.com
+  secretly auth devices enroll --token 3f9c... --server https://secretly.example.com
+  secretly login --device --server https://secretly.example.com
+  secretly auth devices list --server https://secretly.example.com
+  secretly auth devices revoke 7 --server https://secretly.example.com`,
+	Args: cobra.NoArgs,
+	RunE: runDevices,
+}
+
+var deviceTokenCmd = &cobra.Command{
+	Use:   "token <device-name>",
+	Short: "Create a one-time enrollment token for a machine (admins)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDeviceToken,
+}
+
+var deviceEnrollCmd = &cobra.Command{
+	Use:   "enroll --token <token>",
+	Short: "Enroll this machine with an enrollment token",
+	Args:  cobra.NoArgs,
+	RunE:  runDeviceEnroll,
+}
+
+var deviceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List enrolled devices (admins)",
+	Args:  cobra.NoArgs,
+	RunE:  runDevices,
+}
+
+var deviceRevokeCmd = &cobra.Command{
+	Use:   "revoke <device-id>",
+	Short: "Revoke a device and end its sessions (admins)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDeviceRevoke,
+}
+
+func init() {
+	deviceTokenCmd.Flags().StringVar(&deviceUser, "user", "", "User the device acts as")
+	deviceTokenCmd.Flags().UintVar(&deviceNamespace, "namespace", 0, "Limit the device to this namespace ID (default all)")
+	deviceTokenCmd.Flags().BoolVar(&deviceReadOnly, "read-only", false, "Only let the device read secrets")
+	deviceTokenCmd.Flags().DurationVar(&tokenTTL, "ttl", 24*time.Hour, "How long the token can be used")
+	_ = deviceTokenCmd.MarkFlagRequired("user")
+	deviceEnrollCmd.Flags().StringVar(&enrollToken, "token", "", "Enrollment token from an admin")
+	deviceEnrollCmd.Flags().StringVar(&deviceName, "name", "", "Name in the certificate request (default the host name)")
+	_ = deviceEnrollCmd.MarkFlagRequired("token")
+	devicesCmd.AddCommand(deviceTokenCmd, deviceEnrollCmd, deviceListCmd, deviceRevokeCmd)
+	AuthCmd.AddCommand(devicesCmd)
+}
+
+type enrolledDevice struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	UserID        uint       `json:"user_id"`
+	NamespaceID   uint       `json:"namespace_id"`
+	ReadOnly      bool       `json:"read_only"`
+	CertExpiresAt time.Time  `json:"certificate_expires_at"`
+	LastSeenAt    *time.Time `json:"last_seen_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+func runDeviceToken(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"name":         args[0],
+		"username":     deviceUser,
+		"namespace_id": deviceNamespace,
+		"read_only":    deviceReadOnly,
+		"ttl_seconds":  int(tokenTTL / time.Second),
+	}
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := client.Do(http.MethodPost, "/api/v1/devices/enrollment-tokens", req, &out); err != nil {
+		return err
+	}
+	fmt.Printf("🎫 Enrollment token for %s, acting as %s:\n\n  %s\n\n", args[0], deviceUser, out.Token)
+	fmt.Printf("⏰ Use it before %s on the machine:\n", out.ExpiresAt.Local().Format(time.RFC1123))
+	fmt.Printf("  secretly auth devices enroll --token %s --server %s\n", out.Token, serverURL)
+	return nil
+}
+
+func runDeviceEnroll(cmd *cobra.Command, args []string) error {
+	name := deviceName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	keyPEM, csrPEM, err := device.NewKey(name)
+	if err != nil {
+		return err
+	}
+	status, data, err := postJSON("/api/v1/devices/enroll", map[string]string{"token": enrollToken, "csr": string(csrPEM)})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("enrollment failed: %w", apiclient.ProblemError(status, data))
+	}
+	var out struct {
+		Device        enrolledDevice `json:"device"`
+		Certificate   string         `json:"certificate"`
+		CACertificate string         `json:"ca_certificate"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || out.Certificate == "" {
+		return fmt.Errorf("enrollment failed: unexpected response from server")
+	}
+
+	path, err := device.DefaultPath()
+	if err != nil {
+		return err
+	}
+	if err := device.SaveIdentity(path, serverURL, &device.Identity{
+		DeviceID:   out.Device.ID,
+		KeyPEM:     string(keyPEM),
+		CertPEM:    out.Certificate,
+		CACertPEM:  out.CACertificate,
+		EnrolledAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to store device identity: %w", err)
+	}
+	fmt.Printf("✅ Enrolled as device %d %q\n", out.Device.ID, out.Device.Name)
+	fmt.Printf("🔑 Key and certificate stored in %s; the certificate expires %s\n", path, out.Device.CertExpiresAt.Local().Format(time.RFC1123))
+	fmt.Printf("👉 Log in with 'secretly login --device --server %s'\n", serverURL)
+	return nil
+}
+
+func runDevices(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var devices []enrolledDevice
+	if err := client.Do(http.MethodGet, "/api/v1/devices", nil, &devices); err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("📭 No enrolled devices.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tUSER ID\tNAMESPACE\tACCESS\tLAST SEEN\tSTATUS")
+	for _, d := range devices {
+		namespace, access, lastSeen, status := "all", "read-write", "never", "active"
+		if d.NamespaceID != 0 {
+			namespace = strconv.FormatUint(uint64(d.NamespaceID), 10)
+		}
+		if d.ReadOnly {
+			access = "read-only"
+		}
+		if d.LastSeenAt != nil {
+			lastSeen = time.Since(*d.LastSeenAt).Round(time.Second).String() + " ago"
+		}
+		switch {
+		case d.RevokedAt != nil:
+			status = "revoked"
+		case d.CertExpiresAt.Before(time.Now()):
+			status = "expired"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n", d.ID, d.Name, d.UserID, namespace, access, lastSeen, status)
+	}
+	return tw.Flush()
+}
+
+func runDeviceRevoke(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid device ID %q", args[0])
+	}
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := client.Do(http.MethodDelete, "/api/v1/devices/"+strconv.FormatUint(id, 10), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("⛔ Device %d revoked\n", id)
+	return nil
+}
+
+// runDeviceLogin signs a server challenge with this machine's device key
+func runDeviceLogin(store credstore.Store) error {
+	path, err := device.DefaultPath()
+	if err != nil {
+		return err
+	}
+	id, err := device.LoadIdentity(path, serverURL)
+	if err != nil {
+		return err
+	}
+	status, data, err := postJSON("/api/v1/auth/device/challenge", struct{}{})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("login failed: %w", apiclient.ProblemError(status, data))
+	}
+	var ch struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(data, &ch); err != nil || ch.Challenge == "" {
+		return fmt.Errorf("login failed: unexpected response from server")
+	}
+	signature, err := device.Sign([]byte(id.KeyPEM), ch.Challenge)
+	if err != nil {
+		return fmt.Errorf("failed to sign challenge: %w", err)
+	}
+
+	status, data, err = postJSON("/api/v1/auth/device", map[string]string{
+		"certificate": id.CertPEM,
+		"challenge":   ch.Challenge,
+		"signature":   base64.StdEncoding.EncodeToString(signature),
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("login failed: %w", apiclient.ProblemError(status, data))
+	}
+	username = fmt.Sprintf("device %d", id.DeviceID)
+	return saveSession(store, data)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/credstore"
+)
+
+// runImpersonate trades the admin's stored session for one acting as
+// another user and stores it in its place
+func runImpersonate(store credstore.Store) error {
+	if reason == "" {
+		return fmt.Errorf("--reason is required with --as")
+	}
+	api, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var out json.RawMessage
+	err = api.Do(http.MethodPost, "/api/v1/auth/impersonate", map[string]interface{}{
+		"user":    impersonate,
+		"reason":  reason,
+		"minutes": int(impersonateFor.Minutes()),
+	}, &out)
+	if err != nil {
+		return fmt.Errorf("impersonation failed: %w", err)
+	}
+	username = impersonate
+	if err := saveSession(store, out); err != nil {
+		return err
+	}
+	fmt.Println("🎭 Every action is recorded under both your name and the user's. Log in again as yourself when done.")
+	return nil
+}
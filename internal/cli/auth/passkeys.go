@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/credstore"
+	"github.com/spf13/cobra"
+)
+
+// passkeyEnrollmentScope is the scope of sessions that can only register a
+// passkey
+const passkeyEnrollmentScope = "passkey-enrollment"
+
+// handoffPollInterval is how often the CLI asks whether the browser is done
+const handoffPollInterval = 2 * time.Second
+
+var passkeyName string
+
+var passkeysCmd = &cobra.Command{
+	Use:   "passkeys",
+	Short: "List your passkeys",
+	Long: `List the passkeys and security keys you can log in with using
+'secretly login --passkey'. Passkeys are registered and used in a browser:
+the CLI shows a link and a code, and waits until you finish there.
+
+Examples:
+  secretly auth passkeys --server https://secretly.example.com
+  secretly auth passkeys add --name laptop --server https://secretly.example.com
+  secretly auth passkeys remove 3 --server https://secretly.example.com`,
+	Args: cobra.NoArgs,
+	RunE: runPasskeys,
+}
+
+var passkeyAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Register a passkey in the browser",
+	Args:  cobra.NoArgs,
+	RunE:  runPasskeyAdd,
+}
+
+var passkeyRemoveCmd = &cobra.Command{
+	Use:   "remove <passkey-id>",
+	Short: "Remove one of your passkeys",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runPasskeyRemove,
+}
+
+func init() {
+	passkeyAddCmd.Flags().StringVar(&passkeyName, "name", "", "Name to recognise the passkey by, e.g. the device")
+	passkeysCmd.AddCommand(passkeyAddCmd, passkeyRemoveCmd)
+	AuthCmd.AddCommand(passkeysCmd)
+}
+
+type passkeyInfo struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type handoff struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	PollToken string    `json:"poll_token"`
+	UserCode  string    `json:"user_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func runPasskeys(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var passkeys []passkeyInfo
+	if err := client.Do(http.MethodGet, "/api/v1/me/passkeys", nil, &passkeys); err != nil {
+		return err
+	}
+	if len(passkeys) == 0 {
+		fmt.Println("🔓 No passkeys registered. Add one with 'secretly auth passkeys add'.")
+		return nil
+	}
+	fmt.Printf("🔑 %d passkey(s):\n", len(passkeys))
+	for _, p := range passkeys {
+		lastUsed := "never used"
+		if p.LastUsedAt != nil {
+			lastUsed = "last used " + p.LastUsedAt.Local().Format(time.RFC1123)
+		}
+		fmt.Printf("  %4d  %-20s  added %s, %s\n", p.ID, p.Name, p.CreatedAt.Local().Format("2006-01-02"), lastUsed)
+	}
+	return nil
+}
+
+func runPasskeyAdd(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var h handoff
+	if err := client.Do(http.MethodPost, "/api/v1/me/passkeys/handoff", map[string]string{"name": passkeyName}, &h); err != nil {
+		return err
+	}
+	if _, err := followHandoff(&h); err != nil {
+		return err
+	}
+	fmt.Println("✅ Passkey registered. Log in with 'secretly login --passkey'.")
+	return nil
+}
+
+func runPasskeyRemove(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || id == 0 {
+		return fmt.Errorf("invalid passkey ID %q", args[0])
+	}
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := client.Do(http.MethodDelete, fmt.Sprintf("/api/v1/me/passkeys/%d", id), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Passkey %d removed\n", id)
+	return nil
+}
+
+// runPasskeyLogin logs in through the browser and stores the session
+func runPasskeyLogin(store credstore.Store) error {
+	status, data, err := postJSON("/api/v1/auth/webauthn/handoff", map[string]string{"username": username})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("login failed: %w", apiclient.ProblemError(status, data))
+	}
+	var h handoff
+	if err := json.Unmarshal(data, &h); err != nil || h.ID == "" {
+		return fmt.Errorf("login failed: unexpected response from server")
+	}
+	if data, err = followHandoff(&h); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	return saveSession(store, data)
+}
+
+// followHandoff shows the link for a handoff, opens it in a browser and
+// waits until the browser is done. It returns the final poll response.
+func followHandoff(h *handoff) ([]byte, error) {
+	fmt.Printf("🌐 Continue in your browser: %s\n", h.URL)
+	fmt.Printf("🔢 Check that the page shows the code %s\n", h.UserCode)
+	openBrowser(h.URL)
+
+	for time.Now().Before(h.ExpiresAt) {
+		time.Sleep(handoffPollInterval)
+		status, data, err := postJSON("/api/v1/auth/webauthn/handoff/"+h.ID+"/poll", map[string]string{"poll_token": h.PollToken})
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case http.StatusAccepted:
+			continue
+		case http.StatusOK:
+			return data, nil
+		}
+		return nil, apiclient.ProblemError(status, data)
+	}
+	return nil, fmt.Errorf("the browser did not finish before %s", h.ExpiresAt.Local().Format(time.Kitchen))
+}
+
+// openBrowser opens url in the default browser if possible; the link is
+// printed either way
+func openBrowser(url string) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	_ = cmd.Start()
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var revokeOthers bool
+
+// AuthCmd groups commands that manage your own sessions and two-factor
+// authentication on a server
+var AuthCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage your sessions, two-factor authentication, passkeys and devices on a Secretly server",
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List your active sessions",
+	Long: `List the sessions you are logged in with on a Secretly server: the
+device, address and time each was last used. Revoke a session you do not
+recognise, or all sessions except the current one after losing a device.
+
+Examples:
+  secretly auth sessions --server https://secretly.example.com
+  secretly auth sessions revoke 42 --server https://secretly.example.com
+  secretly auth sessions revoke --others --server https://secretly.example.com`,
+	Args: cobra.NoArgs,
+	RunE: runSessions,
+}
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke [session-id]",
+	Short: "Revoke one of your sessions, or all others with --others",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runRevoke,
+}
+
+func init() {
+	AuthCmd.PersistentFlags().StringVar(&serverURL, "server", "", "Secretly server URL")
+	_ = AuthCmd.MarkPersistentFlagRequired("server")
+	revokeCmd.Flags().BoolVar(&revokeOthers, "others", false, "Revoke every session except the current one")
+	sessionsCmd.AddCommand(revokeCmd)
+	AuthCmd.AddCommand(sessionsCmd)
+}
+
+type session struct {
+	ID         uint       `json:"id"`
+	Device     string     `json:"device"`
+	IPAddress  string     `json:"ip_address"`
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+func runSessions(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var sessions []session
+	if err := client.Do(http.MethodGet, "/api/v1/me/sessions", nil, &sessions); err != nil {
+		return err
+	}
+
+	fmt.Printf("🔐 %d active session(s) on %s:\n", len(sessions), serverURL)
+	for _, s := range sessions {
+		marker := " "
+		if s.Current {
+			marker = "*"
+		}
+		lastSeen := "never"
+		if s.LastSeenAt != nil {
+			lastSeen = time.Since(*s.LastSeenAt).Round(time.Second).String() + " ago"
+		}
+		address := s.IPAddress
+		if address == "" {
+			address = "unknown address"
+		}
+		fmt.Printf(" %s #%d  %s from %s, last seen %s\n", marker, s.ID, s.Device, address, lastSeen)
+	}
+	fmt.Println("   (* = this session)")
+	return nil
+}
+
+func runRevoke(cmd *cobra.Command, args []string) error {
+	if revokeOthers == (len(args) == 1) {
+		return fmt.Errorf("give either a session id or --others")
+	}
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+
+	if revokeOthers {
+		var out struct {
+			Revoked int `json:"revoked"`
+		}
+		if err := client.Do(http.MethodDelete, "/api/v1/me/sessions", nil, &out); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Revoked %d other session(s)\n", out.Revoked)
+		return nil
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid session id %q", args[0])
+	}
+	if err := client.Do(http.MethodDelete, fmt.Sprintf("/api/v1/me/sessions/%d", id), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Session #%d revoked\n", id)
+	return nil
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/prompt"
+	"github.com/secretlyhq/secretly/internal/qr"
+	"github.com/spf13/cobra"
+)
+
+// enrollmentScope is the scope of sessions that can only enroll in
+// two-factor authentication
+const enrollmentScope = "2fa-enrollment"
+
+var twoFactorCmd = &cobra.Command{
+	Use:   "2fa",
+	Short: "Manage two-factor authentication for your account",
+	Long: `Manage TOTP two-factor authentication for your account on a Secretly
+server. Once enabled, logging in asks for a code from your authenticator
+app, and sensitive operations such as approving operations or changing the
+server mode ask you to confirm a code with 'secretly auth 2fa elevate'.
+
+Examples:
+  secretly auth 2fa enroll --server https://secretly.example.com
+  secretly auth 2fa confirm --server https://secretly.example.com
+  secretly auth 2fa elevate --server https://secretly.example.com`,
+	Args: cobra.NoArgs,
+	RunE: runTwoFactorStatus,
+}
+
+var twoFactorEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Show a QR code to add to your authenticator app",
+	Args:  cobra.NoArgs,
+	RunE:  runTwoFactorEnroll,
+}
+
+var twoFactorConfirmCmd = &cobra.Command{
+	Use:   "confirm [code]",
+	Short: "Enable two-factor authentication with a code from your app",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runTwoFactorConfirm,
+}
+
+var twoFactorDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Turn two-factor authentication off",
+	Args:  cobra.NoArgs,
+	RunE:  runTwoFactorDisable,
+}
+
+var twoFactorRecoveryCmd = &cobra.Command{
+	Use:   "recovery-codes",
+	Short: "Replace your recovery codes",
+	Args:  cobra.NoArgs,
+	RunE:  runTwoFactorRecoveryCodes,
+}
+
+var twoFactorElevateCmd = &cobra.Command{
+	Use:   "elevate [code]",
+	Short: "Confirm a code to unlock sensitive operations for a few minutes",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runTwoFactorElevate,
+}
+
+func init() {
+	twoFactorCmd.AddCommand(twoFactorEnrollCmd, twoFactorConfirmCmd, twoFactorDisableCmd, twoFactorRecoveryCmd, twoFactorElevateCmd)
+	AuthCmd.AddCommand(twoFactorCmd)
+}
+
+type twoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	ElevatedUntil     *time.Time `json:"elevated_until"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func runTwoFactorStatus(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var status twoFactorStatus
+	if err := client.Do(http.MethodGet, "/api/v1/me/2fa", nil, &status); err != nil {
+		return err
+	}
+	switch {
+	case status.Enabled:
+		fmt.Printf("🔐 Two-factor authentication is enabled since %s\n", status.EnabledAt.Local().Format(time.RFC1123))
+		fmt.Printf("🔑 %d recovery code(s) left\n", status.RecoveryCodesLeft)
+	case status.Required:
+		fmt.Println("⚠️  Two-factor authentication is required for your account but not enabled. Run 'secretly auth 2fa enroll'.")
+	default:
+		fmt.Println("🔓 Two-factor authentication is not enabled")
+	}
+	if status.ElevatedUntil != nil {
+		fmt.Printf("⏰ This session may perform sensitive operations until %s\n", status.ElevatedUntil.Local().Format(time.Kitchen))
+	}
+	return nil
+}
+
+func runTwoFactorEnroll(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	if err := client.Do(http.MethodPost, "/api/v1/me/2fa", nil, &enrollment); err != nil {
+		return err
+	}
+
+	fmt.Println("📱 Scan this QR code with your authenticator app:")
+	if code, err := qr.Encode(enrollment.URI); err == nil {
+		fmt.Print(code.String())
+	} else {
+		fmt.Printf("⚠️  Cannot show a QR code: %v\n", err)
+	}
+	fmt.Printf("\nOr enter this key manually: %s\n\n", enrollment.Secret)
+	fmt.Printf("Then run 'secretly auth 2fa confirm --server %s' with the code it shows.\n", serverURL)
+	return nil
+}
+
+func runTwoFactorConfirm(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	code, err := codeArg(args)
+	if err != nil {
+		return err
+	}
+	var out recoveryCodes
+	if err := client.Do(http.MethodPost, "/api/v1/me/2fa/confirm", map[string]string{"code": code}, &out); err != nil {
+		return err
+	}
+	fmt.Println("✅ Two-factor authentication enabled")
+	printRecoveryCodes(out.RecoveryCodes)
+	fmt.Printf("Log in again with 'secretly login --server %s' if this session was limited to enrollment.\n", serverURL)
+	return nil
+}
+
+func runTwoFactorDisable(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := client.Do(http.MethodDelete, "/api/v1/me/2fa", nil, nil); err != nil {
+		return err
+	}
+	fmt.Println("✅ Two-factor authentication disabled")
+	return nil
+}
+
+func runTwoFactorRecoveryCodes(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var out recoveryCodes
+	if err := client.Do(http.MethodPost, "/api/v1/me/2fa/recovery-codes", nil, &out); err != nil {
+		return err
+	}
+	fmt.Println("✅ New recovery codes generated; the old ones no longer work")
+	printRecoveryCodes(out.RecoveryCodes)
+	return nil
+}
+
+func runTwoFactorElevate(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	code, err := codeArg(args)
+	if err != nil {
+		return err
+	}
+	var out struct {
+		ElevatedUntil time.Time `json:"elevated_until"`
+	}
+	if err := client.Do(http.MethodPost, "/api/v1/me/2fa/elevate", map[string]string{"code": code}, &out); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Sensitive operations unlocked until %s\n", out.ElevatedUntil.Local().Format(time.Kitchen))
+	return nil
+}
+
+// codeArg returns the code given on the command line or asks for it
+func codeArg(args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return prompt.Terminal().Hidden("Authentication code")
+}
+
+func printRecoveryCodes(codes []string) {
+	fmt.Println("🔑 Recovery codes, each usable once instead of an authenticator code.")
+	fmt.Println("   Store them somewhere safe; they are not shown again:")
+	fmt.Println()
+	for _, code := range codes {
+		fmt.Printf("   %s\n", strings.TrimSpace(code))
+	}
+	fmt.Println()
+}
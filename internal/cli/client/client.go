@@ -0,0 +1,191 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL    string
+	description  string
+	scopes       []string
+	namespaceIDs []uint
+	grace        time.Duration
+)
+
+// ClientCmd manages the API clients that act as you on a server
+var ClientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Manage API clients that act as you on a Secretly server",
+	Long: `API clients let services and scripts log in with a client ID and secret
+instead of your password. A client acts as you, limited to its scopes
+(secrets:read, secrets:write, secrets:exists) and, optionally, to some
+namespaces. It exchanges its credentials for a short-lived session at
+POST /api/v1/auth/client.
+
+Examples:
+  secretly client create billing-worker --scope secrets:read --namespace 2 --server https://secretly.example.com
+  secretly client list --server https://secretly.example.com
+  secretly client rotate-secret sc_k3j9... --grace 24h --server https://secretly.example.com
+  secretly client delete sc_k3j9... --server https://secretly.example.com`,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your API clients",
+	Args:  cobra.NoArgs,
+	RunE:  runList,
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an API client and print its secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCreate,
+}
+
+var rotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret <client-id>",
+	Short: "Issue a new client secret; the old one works until --grace ends",
+	Long: `Issue a new secret for an API client. The previous secret keeps working
+for the --grace window so you can roll the new one out; --grace 0 revokes it
+immediately, e.g. after a leak.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRotateSecret,
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <client-id>",
+	Short: "Delete an API client and end its sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDelete,
+}
+
+func init() {
+	ClientCmd.PersistentFlags().StringVar(&serverURL, "server", "", "Secretly server URL")
+	_ = ClientCmd.MarkPersistentFlagRequired("server")
+	createCmd.Flags().StringVar(&description, "description", "", "What the client is used for")
+	createCmd.Flags().StringSliceVar(&scopes, "scope", []string{"secrets:read"}, "Scopes to grant: secrets:read, secrets:write, secrets:exists")
+	createCmd.Flags().UintSliceVar(&namespaceIDs, "namespace", nil, "Limit the client to these namespace IDs (default all)")
+	rotateSecretCmd.Flags().DurationVar(&grace, "grace", time.Hour, "How long the previous secret keeps working")
+	ClientCmd.AddCommand(listCmd, createCmd, rotateSecretCmd, deleteCmd)
+}
+
+type apiClient struct {
+	ClientID                string     `json:"client_id"`
+	ClientSecret            string     `json:"client_secret"`
+	Name                    string     `json:"name"`
+	Scopes                  []string   `json:"scopes"`
+	NamespaceIDs            []uint     `json:"namespace_ids"`
+	CreatedAt               time.Time  `json:"created_at"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at"`
+	LastUsedAt              *time.Time `json:"last_used_at"`
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	api, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	var clients []apiClient
+	if err := api.Do(http.MethodGet, "/api/v1/me/clients", nil, &clients); err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		fmt.Println("📭 No API clients. Create one with 'secretly client create <name>'.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT ID\tNAME\tSCOPES\tNAMESPACES\tLAST USED\tPREVIOUS SECRET")
+	for _, c := range clients {
+		lastUsed, previous := "never", "-"
+		if c.LastUsedAt != nil {
+			lastUsed = time.Since(*c.LastUsedAt).Round(time.Second).String() + " ago"
+		}
+		if c.PreviousSecretExpiresAt != nil {
+			previous = "valid until " + c.PreviousSecretExpiresAt.Local().Format(time.RFC1123)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ClientID, c.Name, strings.Join(c.Scopes, ","), describeNamespaces(c.NamespaceIDs), lastUsed, previous)
+	}
+	return tw.Flush()
+}
+
+func runCreate(cmd *cobra.Command, args []string) error {
+	api, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"name":          args[0],
+		"description":   description,
+		"scopes":        scopes,
+		"namespace_ids": namespaceIDs,
+	}
+	var created apiClient
+	if err := api.Do(http.MethodPost, "/api/v1/me/clients", req, &created); err != nil {
+		return err
+	}
+	fmt.Printf("✅ API client %s created with %s in %s\n", created.Name, strings.Join(created.Scopes, ","), describeNamespaces(created.NamespaceIDs))
+	printCredentials(&created)
+	return nil
+}
+
+func runRotateSecret(cmd *cobra.Command, args []string) error {
+	if grace < 0 {
+		return fmt.Errorf("--grace cannot be negative")
+	}
+	api, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	req := map[string]int{"grace_seconds": int(grace / time.Second)}
+	var rotated apiClient
+	if err := api.Do(http.MethodPost, "/api/v1/me/clients/"+url.PathEscape(args[0])+"/rotate-secret", req, &rotated); err != nil {
+		return err
+	}
+	fmt.Printf("🔄 Secret of %s rotated\n", rotated.Name)
+	printCredentials(&rotated)
+	if rotated.PreviousSecretExpiresAt != nil {
+		fmt.Printf("⏳ The previous secret works until %s\n", rotated.PreviousSecretExpiresAt.Local().Format(time.RFC1123))
+	} else {
+		fmt.Println("⛔ The previous secret no longer works")
+	}
+	return nil
+}
+
+func runDelete(cmd *cobra.Command, args []string) error {
+	api, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := api.Do(http.MethodDelete, "/api/v1/me/clients/"+url.PathEscape(args[0]), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("✅ API client %s deleted\n", args[0])
+	return nil
+}
+
+func printCredentials(c *apiClient) {
+	fmt.Printf("\n  client_id:     %s\n  client_secret: %s\n\n", c.ClientID, c.ClientSecret)
+	fmt.Println("⚠️  Store the secret now; it cannot be shown again.")
+}
+
+func describeNamespaces(ids []uint) string {
+	if len(ids) == 0 {
+		return "all namespaces"
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return "namespaces " + strings.Join(parts, ",")
+}
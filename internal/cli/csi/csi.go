@@ -0,0 +1,84 @@
+package csi
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/secretlyhq/secretly/internal/csi"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var socketPath string
+
+// CSIProviderCmd serves secrets to the Kubernetes Secrets Store CSI driver
+var CSIProviderCmd = &cobra.Command{
+	Use:   "csi-provider",
+	Short: "Run the Secrets Store CSI driver provider",
+	Long: `Serve secrets to the Kubernetes Secrets Store CSI driver. Run it as a
+DaemonSet next to the driver; the driver connects to the socket in its
+providers directory and asks for the files of every volume whose
+SecretProviderClass uses provider "secretly".
+
+Example SecretProviderClass:
+  apiVersion: secrets-store.csi.x-k8s.io/v1
+  kind: SecretProviderClass
+  metadata:
+    name: app-secrets
+  spec:
+    provider: secretly
+    parameters:
+      namespaceId: "1"
+      objects: |
+        - name: app/db-url
+          path: db-url
+        - name: app/config
+          key: db.password
+          path: db-password
+
+With an exportProfile parameter every variable of that stored export profile
+('secretly env profile') is mounted as a file named after it, e.g. to sync
+them into a Kubernetes Secret with secretObjects and use it with envFrom.
+The objects parameter is then optional.
+
+Only pods in csi.allowed_namespaces may mount secrets. Each mount and
+rotation poll reads the secrets again, so secrets with max reads are refused.`,
+	Args: cobra.NoArgs,
+	RunE: runProvider,
+}
+
+func init() {
+	CSIProviderCmd.Flags().StringVar(&socketPath, "socket", "", "Unix socket to listen on (default csi.socket)")
+}
+
+func runProvider(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	cfg := app.Config.CSI
+	if len(cfg.AllowedNamespaces) == 0 {
+		return fmt.Errorf("no namespaces allowed: set csi.allowed_namespaces in the configuration")
+	}
+	path := socketPath
+	if path == "" {
+		path = cfg.Socket
+	}
+	if path == "" {
+		return fmt.Errorf("no socket configured: set csi.socket or pass --socket")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("☸️  Secretly CSI provider listening on %s\n", path)
+	if err := csi.New(app.Core, cfg.AllowedNamespaces).Serve(ctx, path); err != nil {
+		return err
+	}
+	fmt.Println("✅ CSI provider stopped")
+	return nil
+}
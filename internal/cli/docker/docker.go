@@ -0,0 +1,227 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/dockerenv"
+	"github.com/spf13/cobra"
+)
+
+// defaultDir holds rendered files; it should be listed in .gitignore
+const defaultDir = ".secretly/docker"
+
+var (
+	service       string
+	environmentID uint
+	envOutput     string
+	secretsDir    string
+)
+
+// DockerCmd renders secrets for Docker and Compose
+var DockerCmd = &cobra.Command{
+	Use:   "docker",
+	Short: "Render secrets for Docker and Docker Compose",
+	Long: `Render the secrets of a service into Docker env_files or Compose secret
+files for local development.
+
+A service's secrets are those named "<service>/<name>", e.g. "api/db-password"
+belongs to service "api" and is rendered as DB_PASSWORD. Files are written with
+0600 permissions. When a command is given after "--", the files are removed
+as soon as it exits or is interrupted.
+
+Examples:
+  secretly docker env --service api
+  secretly docker env --service api -- docker compose up api
+  secretly docker secrets --service api -- docker compose up
+  secretly docker clean --service api`,
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env --service <name> [-- command...]",
+	Short: "Write a service's secrets to an env_file",
+	RunE:  runEnv,
+}
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets --service <name> [-- command...]",
+	Short: "Write a service's secrets as Compose secret files",
+	RunE:  runSecrets,
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean --service <name>",
+	Short: "Remove files rendered for a service",
+	RunE:  runClean,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{envCmd, secretsCmd, cleanCmd} {
+		cmd.Flags().StringVar(&service, "service", "", "Service whose secrets are rendered")
+		_ = cmd.MarkFlagRequired("service")
+		DockerCmd.AddCommand(cmd)
+	}
+	envCmd.Flags().UintVar(&environmentID, "environment-id", 0, "Only render secrets from this environment")
+	secretsCmd.Flags().UintVar(&environmentID, "environment-id", 0, "Only render secrets from this environment")
+	envCmd.Flags().StringVar(&envOutput, "output", "", "env_file path (default .secretly/docker/<service>.env)")
+	cleanCmd.Flags().StringVar(&envOutput, "output", "", "env_file path to remove")
+	secretsCmd.Flags().StringVar(&secretsDir, "dir", "", "Directory for secret files (default .secretly/docker/<service>)")
+	cleanCmd.Flags().StringVar(&secretsDir, "dir", "", "Secret file directory to remove")
+}
+
+func runEnv(cmd *cobra.Command, args []string) error {
+	entries, err := serviceEntries()
+	if err != nil {
+		return err
+	}
+
+	path := envPath()
+	if err := dockerenv.WriteEnvFile(path, entries); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Wrote %d secrets for %s to %s\n", len(entries), service, path)
+
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "💡 Use it with 'env_file: %s' in compose.yaml or 'docker run --env-file %s'\n", path, path)
+		fmt.Fprintf(os.Stderr, "💡 Remove it with 'secretly docker clean --service %s'\n", service)
+		return nil
+	}
+	return runAndCleanup(args, path)
+}
+
+func runSecrets(cmd *cobra.Command, args []string) error {
+	entries, err := serviceEntries()
+	if err != nil {
+		return err
+	}
+
+	paths, err := dockerenv.WriteSecretFiles(secretsPath(), entries)
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, p)
+	}
+	if err != nil {
+		_ = dockerenv.Remove(files...)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Wrote %d secret files for %s to %s\n", len(paths), service, secretsPath())
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "📋 Compose configuration:")
+		fmt.Print(dockerenv.ComposeSnippet(service, paths))
+		fmt.Fprintf(os.Stderr, "💡 Remove them with 'secretly docker clean --service %s'\n", service)
+		return nil
+	}
+
+	return runAndCleanup(args, files...)
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	files := []string{envPath()}
+	matches, _ := filepath.Glob(filepath.Join(secretsPath(), "*"))
+	files = append(files, matches...)
+
+	if err := dockerenv.Remove(files...); err != nil {
+		return err
+	}
+	_ = os.Remove(secretsPath())
+	fmt.Printf("✅ Removed rendered secrets for %s\n", service)
+	return nil
+}
+
+// serviceEntries reads every secret of the service. Reading counts against
+// max-reads limits like any other read.
+func serviceEntries() ([]dockerenv.Entry, error) {
+	app, err := di.NewApp("")
+	if err != nil {
+		return nil, err
+	}
+	defer app.Close()
+
+	ctx := context.Background()
+	secrets, _, err := app.Core.ListSecrets(ctx, &core.ListSecretsFilter{EnvironmentID: environmentID})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []dockerenv.Entry
+	seen := make(map[string]string)
+	for _, s := range secrets {
+		name, ok := dockerenv.ServiceSecretName(service, s.Name)
+		if !ok {
+			continue
+		}
+		key := dockerenv.EnvKey(name)
+		if other, dup := seen[key]; dup {
+			return nil, fmt.Errorf("secrets %q and %q both map to %s", other, s.Name, key)
+		}
+		seen[key] = s.Name
+
+		value, err := app.Core.GetSecretValue(ctx, s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.Name, err)
+		}
+		entries = append(entries, dockerenv.Entry{Key: key, Value: value})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no secrets found for service %q (expected names like %q)", service, service+"/db-password")
+	}
+	return entries, nil
+}
+
+// runAndCleanup runs the command with the rendered files in place and removes
+// them when it exits. SIGINT and SIGTERM are forwarded to the command so that
+// cleanup still happens when the session is interrupted.
+func runAndCleanup(args []string, files ...string) error {
+	defer func() {
+		if err := dockerenv.Remove(files...); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cleanup failed: %v\n", err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "🧹 Removed rendered secrets")
+	}()
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = child.Process.Signal(sig)
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s exited with status %d", args[0], exitErr.ExitCode())
+	}
+	return err
+}
+
+func envPath() string {
+	if envOutput != "" {
+		return envOutput
+	}
+	return filepath.Join(defaultDir, service+".env")
+}
+
+func secretsPath() string {
+	if secretsDir != "" {
+		return secretsDir
+	}
+	return filepath.Join(defaultDir, service)
+}
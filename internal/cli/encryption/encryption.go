@@ -104,6 +104,21 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Printf("KEK Path: %s\n", cfg.Storage.Encryption.KEKPath)
 	fmt.Printf("DEK Path: %s\n", cfg.Storage.Encryption.DEKPath)
 
+	policy := encryption.ActivePolicy(cfg)
+	fmt.Println()
+	fmt.Println("📋 Crypto Policy")
+	fmt.Printf("Policy: %s\n", policy.Name)
+	fmt.Printf("FIPS 140-3 Module: %v\n", policy.ModuleEnabled)
+	fmt.Printf("Encryption: %s\n", policy.Encryption)
+	fmt.Printf("Key Derivation: %s\n", policy.KeyDerivation)
+	fmt.Printf("Hashing: %s\n", policy.Hashing)
+	fmt.Printf("Password Hashing: %s\n", policy.PasswordHash)
+	fmt.Printf("TLS Keys: %s\n", policy.TLSKeys)
+	if err := encryption.EnforcePolicy(cfg); err != nil {
+		fmt.Printf("❌ Policy violation: %v\n", err)
+	}
+	fmt.Println()
+
 	if !cfg.Storage.Encryption.Enabled {
 		return nil
 	}
@@ -0,0 +1,71 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var verifyBackfill bool
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify stored secrets decrypt to their recorded content hash",
+	Long: `Decrypt every stored secret version and compare it with the content hash
+recorded when it was written. Reads performed by this check do not count
+against max-reads limits.
+
+Versions written before content hashing was introduced are reported as
+unhashed; use --backfill to record their hash.`,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyBackfill, "backfill", false, "Record hashes for versions that have none")
+	EncryptionCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	fmt.Println("🔍 Verifying secret integrity...")
+	results, err := app.Core.VerifyIntegrity(context.Background(), verifyBackfill)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+		switch r.Status {
+		case core.IntegrityMismatch:
+			fmt.Printf("❌ %s (secret %d) version %d: content does not match recorded hash\n", r.SecretName, r.SecretID, r.VersionNumber)
+		case core.IntegrityUnreadable:
+			fmt.Printf("❌ %s (secret %d) version %d: %s\n", r.SecretName, r.SecretID, r.VersionNumber, r.Error)
+		case core.IntegrityUnhashed:
+			fmt.Printf("⚠️  %s (secret %d) version %d: no content hash recorded\n", r.SecretName, r.SecretID, r.VersionNumber)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("📋 Versions checked: %d\n", len(results))
+	fmt.Printf("   ✅ OK: %d\n", counts[core.IntegrityOK])
+	fmt.Printf("   ⚠️  Unhashed: %d\n", counts[core.IntegrityUnhashed])
+	fmt.Printf("   ❌ Mismatched: %d\n", counts[core.IntegrityMismatch])
+	fmt.Printf("   ❌ Unreadable: %d\n", counts[core.IntegrityUnreadable])
+
+	if counts[core.IntegrityUnhashed] > 0 {
+		fmt.Println("💡 Run 'secretly encryption verify --backfill' to record missing hashes")
+	}
+	if failed := counts[core.IntegrityMismatch] + counts[core.IntegrityUnreadable]; failed > 0 {
+		return fmt.Errorf("%d secret versions failed verification", failed)
+	}
+	return nil
+}
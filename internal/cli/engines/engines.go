@@ -0,0 +1,121 @@
+package engines
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+var (
+	role   string
+	params []string
+)
+
+// EnginesCmd lists and uses the secret engine plugins
+var EnginesCmd = &cobra.Command{
+	Use:     "engines",
+	Aliases: []string{"engine"},
+	Short:   "Mint credentials with secret engine plugins",
+	Long: `Secret engines mint credentials on demand instead of storing them, e.g.
+short-lived cloud IAM keys or database users. They are plugins: programs
+named secretly-engine-<name> in engines.dir, each run with only its own
+settings from engines.plugins.<name>.config and without the server's
+environment. Issued credentials are printed once and never stored; the
+audit log records who asked for which role.
+
+Examples:
+  secretly engines list
+  secretly engines issue postgres --role readonly --param database=orders
+  secretly engines revoke postgres 7f3c2a`,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List secret engines and their capabilities",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			infos, err := c.ListEngines(ctx)
+			if err != nil {
+				return err
+			}
+			if len(infos) == 0 {
+				fmt.Printf("📭 No secret engines. Put plugins named %s<name> in engines.dir.\n", engine.PluginPrefix)
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tVERSION\tCAPABILITIES\tROLES\tDESCRIPTION")
+			for _, info := range infos {
+				roles := strings.Join(info.Roles, ",")
+				if roles == "" {
+					roles = "any"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", info.Name, info.Version, strings.Join(info.Capabilities, ","), roles, info.Description)
+			}
+			return tw.Flush()
+		})
+	},
+}
+
+var issueCmd = &cobra.Command{
+	Use:   "issue <engine>",
+	Short: "Mint a credential and print it as JSON",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := engine.IssueRequest{Role: role, Params: make(map[string]string)}
+		for _, p := range params {
+			key, value, ok := strings.Cut(p, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid --param %q: use key=value", p)
+			}
+			req.Params[key] = value
+		}
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			cred, err := c.IssueEngineCredential(ctx, args[0], req)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(cred)
+		})
+	},
+}
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke <engine> <lease-id>",
+	Short: "Invalidate a credential an engine issued",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			if err := c.RevokeEngineLease(ctx, args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Lease %s of %s revoked\n", args[1], args[0])
+			return nil
+		})
+	},
+}
+
+func init() {
+	issueCmd.Flags().StringVar(&role, "role", "", "Role to issue the credential for")
+	issueCmd.Flags().StringArrayVar(&params, "param", nil, "Engine-specific option as key=value (repeatable)")
+	EnginesCmd.AddCommand(listCmd, issueCmd, revokeCmd)
+}
+
+func withCore(fn func(context.Context, *core.SecretlyCore) error) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	return fn(context.Background(), app.Core)
+}
@@ -0,0 +1,350 @@
+package env
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/envfile"
+	"github.com/secretlyhq/secretly/internal/securefiles"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileName string
+	pullFile    string
+	pushYes     bool
+	pushDryRun  bool
+	allowJunk   bool
+)
+
+// EnvCmd syncs .env files with named profiles of secrets
+var EnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Pull and push .env files for a profile",
+	Long: `Manage .env files for named profiles.
+
+A profile, defined under env.profiles in the configuration or stored with
+'secretly env profile set', maps a set of secrets to .env keys: either every
+secret directly under a name prefix ("app1/db-password" becomes DB_PASSWORD)
+or an explicit key-to-secret list. Stored profiles can also prefix and
+upper-case keys and flatten json secrets into one key per field; they are
+shared with 'secretly run' and CSI mounts. A profile in the configuration
+wins over a stored one of the same name.
+
+pull prints the profile as a .env file, or merges it into an existing file
+with --file so that comments, blank lines and key order are kept. push
+stores local values after showing what would change; values that look like
+local placeholders (empty, "changeme", localhost URLs, ...) are refused
+unless --allow-placeholders is given. Keys missing locally are never
+deleted from Secretly.
+
+Examples:
+  secretly env pull --profile app1 > .env
+  secretly env pull --profile app1 --file .env
+  secretly env diff .env --profile app1
+  secretly env push .env --profile app1`,
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull --profile <name>",
+	Short: "Write a profile's secrets in .env format",
+	Args:  cobra.NoArgs,
+	RunE:  runPull,
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push <file> --profile <name>",
+	Short: "Store the values of a .env file in a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runPush,
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <file> --profile <name>",
+	Short: "Show which keys differ between a .env file and a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDiff,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{pullCmd, pushCmd, diffCmd} {
+		cmd.Flags().StringVar(&profileName, "profile", "", "Profile from env.profiles in the configuration")
+		_ = cmd.MarkFlagRequired("profile")
+		EnvCmd.AddCommand(cmd)
+	}
+	pullCmd.Flags().StringVar(&pullFile, "file", "", "Merge into this .env file instead of printing")
+	pushCmd.Flags().BoolVarP(&pushYes, "yes", "y", false, "Push without asking for confirmation")
+	pushCmd.Flags().BoolVar(&pushDryRun, "dry-run", false, "Only show what would change")
+	pushCmd.Flags().BoolVar(&allowJunk, "allow-placeholders", false, "Push values that look like local placeholders")
+}
+
+// session is an initialized app together with the profile's secrets keyed
+// by .env key
+type session struct {
+	app     *di.App
+	profile envfile.Profile
+	scope   core.ListSecretsFilter
+	secrets map[string]models.SecretNode
+	// export is the stored profile, if the profile is not in the configuration
+	export *core.ExportProfile
+}
+
+func openProfile() (*session, error) {
+	app, err := di.NewApp("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+	ctx := context.Background()
+	s := &session{app: app, secrets: make(map[string]models.SecretNode)}
+	if cfg, ok := app.Config.Env.Profiles[profileName]; ok {
+		s.profile = envfile.Profile{Prefix: cfg.Prefix, Secrets: cfg.Secrets}
+		s.scope = core.ListSecretsFilter{NamespaceID: cfg.NamespaceID, ZoneID: cfg.ZoneID, EnvironmentID: cfg.EnvironmentID}
+	} else {
+		export, err := app.Core.GetExportProfile(ctx, profileName)
+		if err != nil {
+			app.Close()
+			if errors.Is(err, core.ErrNotFound) {
+				return nil, fmt.Errorf("unknown profile %q: define it under env.profiles in the configuration or with 'secretly env profile set'", profileName)
+			}
+			return nil, err
+		}
+		s.profile, s.scope, s.export = export.Mapping(), *export.Scope(), export
+	}
+	list, _, err := app.Core.ListSecrets(ctx, &s.scope)
+	if err != nil {
+		app.Close()
+		return nil, err
+	}
+	for _, secret := range list {
+		key, ok := s.profile.KeyFor(secret.Name)
+		if !ok {
+			continue
+		}
+		if other, dup := s.secrets[key]; dup {
+			app.Close()
+			return nil, fmt.Errorf("secrets %q and %q both map to %s", other.Name, secret.Name, key)
+		}
+		s.secrets[key] = secret
+	}
+	return s, nil
+}
+
+func (s *session) keys() []string {
+	keys := make([]string, 0, len(s.secrets))
+	for key := range s.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diff compares local values with the profile by content hash, so that no
+// secret is read
+func (s *session) diff(local map[string]string) ([]envfile.Change, error) {
+	if s.export != nil && s.export.FlattenJSON {
+		return nil, fmt.Errorf("profile %s flattens json secrets into several keys and can only be pulled", profileName)
+	}
+	ctx := context.Background()
+	return envfile.Diff(local, s.keys(), func(key, value string) (bool, error) {
+		return s.app.Core.ValueMatches(ctx, s.secrets[key].ID, []byte(value))
+	})
+}
+
+func runPull(cmd *cobra.Command, args []string) error {
+	s, err := openProfile()
+	if err != nil {
+		return err
+	}
+	defer s.app.Close()
+
+	file := &envfile.File{}
+	if pullFile != "" {
+		if data, err := os.ReadFile(pullFile); err == nil {
+			if file, err = envfile.Parse(data); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", pullFile, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	count := len(s.secrets)
+	if s.export != nil {
+		vars, err := s.app.Core.ExportProfileVars(ctx, s.export)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			file.Set(v.Key, string(v.Value))
+		}
+		count = len(vars)
+	} else {
+		for _, key := range s.keys() {
+			value, err := s.app.Core.GetSecretValue(ctx, s.secrets[key].ID)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", s.secrets[key].Name, err)
+			}
+			file.Set(key, string(value))
+		}
+	}
+
+	if pullFile == "" {
+		_, err := os.Stdout.Write(file.Bytes())
+		return err
+	}
+	if err := securefiles.SecureWriteFile(filepath.Dir(pullFile), pullFile, file.Bytes(), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(pullFile, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Pulled %d keys from profile %s into %s\n", count, profileName, pullFile)
+	return nil
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	local, err := readLocal(args[0])
+	if err != nil {
+		return err
+	}
+	s, err := openProfile()
+	if err != nil {
+		return err
+	}
+	defer s.app.Close()
+
+	changes, err := s.diff(local)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Printf("✅ %s matches profile %s\n", args[0], profileName)
+		return nil
+	}
+	printChanges(changes)
+	return nil
+}
+
+func runPush(cmd *cobra.Command, args []string) error {
+	local, err := readLocal(args[0])
+	if err != nil {
+		return err
+	}
+	s, err := openProfile()
+	if err != nil {
+		return err
+	}
+	defer s.app.Close()
+
+	changes, err := s.diff(local)
+	if err != nil {
+		return err
+	}
+
+	var pending []envfile.Change
+	var problems []string
+	for _, c := range changes {
+		if c.Kind == envfile.Removed {
+			continue
+		}
+		if _, ok := s.secrets[c.Key]; !ok {
+			if _, ok := s.profile.NameFor(c.Key); !ok {
+				problems = append(problems, fmt.Sprintf("%s is not part of profile %s", c.Key, profileName))
+				continue
+			}
+		}
+		if reason := envfile.Junk(local[c.Key]); reason != "" && !allowJunk {
+			problems = append(problems, fmt.Sprintf("%s: %s", c.Key, reason))
+			continue
+		}
+		pending = append(pending, c)
+	}
+
+	printChanges(changes)
+	if len(problems) > 0 {
+		fmt.Println("⚠️  Not pushed:")
+		for _, p := range problems {
+			fmt.Printf("   %s\n", p)
+		}
+		if !allowJunk {
+			fmt.Println("💡 Fix the values or use --allow-placeholders to push them anyway")
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Println("✅ Nothing to push")
+		return nil
+	}
+	if pushDryRun {
+		fmt.Printf("🔍 Dry run: %d keys would be pushed\n", len(pending))
+		return nil
+	}
+	if !pushYes && !confirm(fmt.Sprintf("Push %d keys to profile %s?", len(pending), profileName)) {
+		fmt.Println("❌ Push cancelled")
+		return nil
+	}
+
+	ctx := context.Background()
+	for _, c := range pending {
+		value := []byte(local[c.Key])
+		if secret, ok := s.secrets[c.Key]; ok {
+			if _, err := s.app.Core.UpdateSecret(ctx, secret.ID, &core.UpdateSecretRequest{Value: value}); err != nil {
+				return fmt.Errorf("failed to update %s: %w", secret.Name, err)
+			}
+			continue
+		}
+		name, _ := s.profile.NameFor(c.Key)
+		if _, err := s.app.Core.CreateSecret(ctx, &core.CreateSecretRequest{
+			Name:          name,
+			NamespaceID:   s.scope.NamespaceID,
+			ZoneID:        s.scope.ZoneID,
+			EnvironmentID: s.scope.EnvironmentID,
+			Value:         value,
+			CreatedBy:     "secretly-env",
+		}); err != nil {
+			return fmt.Errorf("failed to create %s: %w", name, err)
+		}
+	}
+	fmt.Printf("✅ Pushed %d keys to profile %s\n", len(pending), profileName)
+	return nil
+}
+
+func readLocal(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := envfile.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return file.Values(), nil
+}
+
+func printChanges(changes []envfile.Change) {
+	symbols := map[string]string{envfile.Added: "+", envfile.Removed: "-", envfile.Changed: "~"}
+	for _, c := range changes {
+		note := ""
+		if c.Kind == envfile.Removed {
+			note = " (only in Secretly, kept)"
+		}
+		fmt.Printf("  %s %s%s\n", symbols[c.Kind], c.Key, note)
+	}
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
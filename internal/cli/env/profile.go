@@ -0,0 +1,156 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	setPrefix      string
+	setSecrets     []string
+	setVarPrefix   string
+	setUppercase   bool
+	setFlattenJSON bool
+	setNamespaceID uint
+	setZoneID      uint
+	setEnvID       uint
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage stored export profiles",
+	Long: `Manage export profiles stored in Secretly. Unlike profiles in the
+configuration they are shared by everyone using the server and are used by
+'secretly run', 'secretly env pull' and CSI mounts with the exportProfile
+parameter.
+
+Examples:
+  secretly env profile set api --prefix api/ --var-prefix API_ --environment-id 2
+  secretly env profile set worker --secret DB=worker/db --flatten-json --uppercase
+  secretly env profile list
+  secretly env profile delete api`,
+}
+
+var profileSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Create or replace an export profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runProfileSet,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List export profiles",
+	Args:  cobra.NoArgs,
+	RunE:  runProfileList,
+}
+
+var profileDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete an export profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runProfileDelete,
+}
+
+func init() {
+	profileSetCmd.Flags().StringVar(&setPrefix, "prefix", "", "Export every secret directly under this name prefix")
+	profileSetCmd.Flags().StringArrayVar(&setSecrets, "secret", nil, "Export a secret as KEY=secret-name (repeatable)")
+	profileSetCmd.Flags().StringVar(&setVarPrefix, "var-prefix", "", "Prefix for every variable name")
+	profileSetCmd.Flags().BoolVar(&setUppercase, "uppercase", false, "Upper-case variable names")
+	profileSetCmd.Flags().BoolVar(&setFlattenJSON, "flatten-json", false, "Export each field of json secrets as its own variable")
+	profileSetCmd.Flags().UintVar(&setNamespaceID, "namespace-id", 0, "Namespace")
+	profileSetCmd.Flags().UintVar(&setZoneID, "zone-id", 0, "Zone")
+	profileSetCmd.Flags().UintVar(&setEnvID, "environment-id", 0, "Environment")
+	profileCmd.AddCommand(profileSetCmd, profileListCmd, profileDeleteCmd)
+	EnvCmd.AddCommand(profileCmd)
+}
+
+func runProfileSet(cmd *cobra.Command, args []string) error {
+	profile := &core.ExportProfile{
+		Name:          args[0],
+		NamespaceID:   setNamespaceID,
+		ZoneID:        setZoneID,
+		EnvironmentID: setEnvID,
+		Prefix:        setPrefix,
+		VarPrefix:     setVarPrefix,
+		Uppercase:     setUppercase,
+		FlattenJSON:   setFlattenJSON,
+		CreatedBy:     "secretly-cli",
+	}
+	for _, pair := range setSecrets {
+		key, name, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --secret %q: expected KEY=secret-name", pair)
+		}
+		if profile.Secrets == nil {
+			profile.Secrets = make(map[string]string)
+		}
+		profile.Secrets[key] = name
+	}
+
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	if _, err := app.Core.SaveExportProfile(context.Background(), profile); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Saved export profile %s\n", profile.Name)
+	return nil
+}
+
+func runProfileList(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	profiles, err := app.Core.ListExportProfiles(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		fmt.Println("No export profiles")
+		return nil
+	}
+	for _, p := range profiles {
+		source := fmt.Sprintf("prefix %q", p.Prefix)
+		if len(p.Secrets) > 0 {
+			source = fmt.Sprintf("%d secrets", len(p.Secrets))
+		}
+		var transforms []string
+		if p.VarPrefix != "" {
+			transforms = append(transforms, "var prefix "+p.VarPrefix)
+		}
+		if p.Uppercase {
+			transforms = append(transforms, "uppercase")
+		}
+		if p.FlattenJSON {
+			transforms = append(transforms, "flatten json")
+		}
+		fmt.Printf("  %-20s %-24s %s\n", p.Name, source, strings.Join(transforms, ", "))
+	}
+	return nil
+}
+
+func runProfileDelete(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	if err := app.Core.DeleteExportProfile(context.Background(), args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Deleted export profile %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,349 @@
+package escrow
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/escrow"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL     string
+	keyFile       string
+	custodians    []string
+	threshold     int
+	recoverReason string
+	logEscrowID   uint
+)
+
+// EscrowCmd escrows secrets with custodians and recovers them
+var EscrowCmd = &cobra.Command{
+	Use:   "escrow",
+	Short: "Escrow secrets with custodians for M-of-N recovery",
+	Long: `Escrow keeps a copy of a secret that only a quorum of custodians can
+recover. The value is encrypted under a new key, which is split into one
+share per custodian; any threshold of the shares rebuild it. Each share is
+sealed to its custodian's public key, and the private key never leaves the
+custodian's machine: approving a recovery opens the share locally and sends
+it back, and the server combines the shares once enough have arrived. Only
+the user who requested the recovery can collect the value, once.
+
+Every step is recorded in a hash-chained escrow log, which users whose
+roles grant audit.read can verify with 'secretly escrow log'.
+
+Examples:
+  secretly escrow keygen --server https://secretly.example.com
+  secretly escrow create 42 --custodian alice --custodian bob --custodian carol --threshold 2
+  secretly escrow recover 3 --reason "Root password of the old NAS, owner left"
+  secretly escrow approve 5 --key ~/.secretly/escrow.key
+  secretly escrow collect 5`,
+}
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create your custodian key pair and register the public key",
+	Args:  cobra.NoArgs,
+	RunE:  runKeygen,
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create <secret-id>",
+	Short: "Escrow the current value of a secret with custodians",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCreate,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list <secret-id>",
+	Short: "List the escrows of a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runList,
+}
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover <escrow-id>",
+	Short: "Ask the custodians to recover an escrowed secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRecover,
+}
+
+var recoveriesCmd = &cobra.Command{
+	Use:   "recoveries <escrow-id>",
+	Short: "List the recovery requests of an escrow",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRecoveries,
+}
+
+var approveCmd = &cobra.Command{
+	Use:   "approve <recovery-id>",
+	Short: "Approve a recovery with your share",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApprove,
+}
+
+var collectCmd = &cobra.Command{
+	Use:   "collect <recovery-id>",
+	Short: "Print the value of a recovery you requested",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCollect,
+}
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show and verify the escrow log",
+	Args:  cobra.NoArgs,
+	RunE:  runLog,
+}
+
+func init() {
+	EscrowCmd.PersistentFlags().StringVar(&serverURL, "server", "http://localhost:8080", "Secretly server URL")
+	for _, cmd := range []*cobra.Command{keygenCmd, approveCmd} {
+		cmd.Flags().StringVar(&keyFile, "key", defaultKeyFile(), "File of your custodian private key")
+	}
+	createCmd.Flags().StringSliceVar(&custodians, "custodian", nil, "User holding a share (repeatable)")
+	createCmd.Flags().IntVar(&threshold, "threshold", 0, "Number of custodians needed to recover the secret")
+	_ = createCmd.MarkFlagRequired("custodian")
+	_ = createCmd.MarkFlagRequired("threshold")
+	recoverCmd.Flags().StringVar(&recoverReason, "reason", "", "Why the secret needs to be recovered")
+	_ = recoverCmd.MarkFlagRequired("reason")
+	logCmd.Flags().UintVar(&logEscrowID, "escrow", 0, "Only show entries of this escrow")
+	EscrowCmd.AddCommand(keygenCmd, createCmd, listCmd, recoverCmd, recoveriesCmd, approveCmd, collectCmd, logCmd)
+}
+
+type escrowInfo struct {
+	ID            uint      `json:"id"`
+	SecretID      uint      `json:"secret_id"`
+	VersionNumber int       `json:"version_number"`
+	Threshold     int       `json:"threshold"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type recovery struct {
+	ID          uint      `json:"id"`
+	EscrowID    uint      `json:"escrow_id"`
+	RequestedBy string    `json:"requested_by"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"`
+	Approvers   []string  `json:"approvers"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func defaultKeyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "escrow.key"
+	}
+	return filepath.Join(home, ".secretly", "escrow.key")
+}
+
+func runKeygen(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(keyFile); err == nil {
+		return fmt.Errorf("%s already exists; replacing it would lose the shares sealed to it", keyFile)
+	}
+	pub, priv, err := escrow.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, priv, 0600); err != nil {
+		return err
+	}
+	if err := call(http.MethodPut, "/api/v1/escrow/key", map[string][]byte{"public_key": pub}, nil); err != nil {
+		os.Remove(keyFile)
+		return err
+	}
+	fmt.Printf("🔑 Custodian key saved to %s and its public key registered\n", keyFile)
+	fmt.Println("👉 Keep the file safe: without it you cannot approve recoveries of secrets escrowed with you")
+	return nil
+}
+
+func runCreate(cmd *cobra.Command, args []string) error {
+	id, err := parseID("secret", args[0])
+	if err != nil {
+		return err
+	}
+	var e escrowInfo
+	req := map[string]interface{}{"custodians": custodians, "threshold": threshold}
+	if err := call(http.MethodPost, fmt.Sprintf("/api/v1/secrets/%d/escrows", id), req, &e); err != nil {
+		return err
+	}
+	fmt.Printf("🔐 Version %d of secret %d escrowed (escrow %d): %d of %d custodians can recover it\n",
+		e.VersionNumber, id, e.ID, e.Threshold, len(custodians))
+	return nil
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	id, err := parseID("secret", args[0])
+	if err != nil {
+		return err
+	}
+	var escrows []escrowInfo
+	if err := call(http.MethodGet, fmt.Sprintf("/api/v1/secrets/%d/escrows", id), nil, &escrows); err != nil {
+		return err
+	}
+	if len(escrows) == 0 {
+		fmt.Printf("📭 Secret %d has no escrows.\n", id)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tVERSION\tTHRESHOLD\tCREATED\tBY")
+	for _, e := range escrows {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\n", e.ID, e.VersionNumber, e.Threshold, e.CreatedAt.Local().Format(time.RFC1123), e.CreatedBy)
+	}
+	return tw.Flush()
+}
+
+func runRecover(cmd *cobra.Command, args []string) error {
+	id, err := parseID("escrow", args[0])
+	if err != nil {
+		return err
+	}
+	var r recovery
+	if err := call(http.MethodPost, fmt.Sprintf("/api/v1/escrows/%d/recoveries", id), map[string]string{"reason": recoverReason}, &r); err != nil {
+		return err
+	}
+	fmt.Printf("📨 Recovery %d requested; custodians can approve it until %s\n", r.ID, r.ExpiresAt.Local().Format(time.RFC1123))
+	fmt.Printf("👉 Collect the value with 'secretly escrow collect %d' once enough have approved\n", r.ID)
+	return nil
+}
+
+func runRecoveries(cmd *cobra.Command, args []string) error {
+	id, err := parseID("escrow", args[0])
+	if err != nil {
+		return err
+	}
+	var recoveries []recovery
+	if err := call(http.MethodGet, fmt.Sprintf("/api/v1/escrows/%d/recoveries", id), nil, &recoveries); err != nil {
+		return err
+	}
+	if len(recoveries) == 0 {
+		fmt.Printf("📭 Escrow %d has no recovery requests.\n", id)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tREQUESTED BY\tSTATUS\tAPPROVALS\tEXPIRES\tREASON")
+	for _, r := range recoveries {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", r.ID, r.RequestedBy, r.Status, len(r.Approvers),
+			r.ExpiresAt.Local().Format(time.RFC1123), r.Reason)
+	}
+	return tw.Flush()
+}
+
+// runApprove opens the caller's share with their private key, locally, and
+// sends only the opened share to the server
+func runApprove(cmd *cobra.Command, args []string) error {
+	id, err := parseID("recovery", args[0])
+	if err != nil {
+		return err
+	}
+	priv, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read custodian key: %w", err)
+	}
+	var sealed struct {
+		SealedShare []byte `json:"sealed_share"`
+	}
+	if err := call(http.MethodGet, fmt.Sprintf("/api/v1/escrow-recoveries/%d/share", id), nil, &sealed); err != nil {
+		return err
+	}
+	share, err := escrow.Open(sealed.SealedShare, priv)
+	if err != nil {
+		return fmt.Errorf("failed to open your share with %s: %w", keyFile, err)
+	}
+	var r recovery
+	if err := call(http.MethodPost, fmt.Sprintf("/api/v1/escrow-recoveries/%d/approve", id), map[string][]byte{"share": share}, &r); err != nil {
+		return err
+	}
+	if r.Status == "recovered" {
+		fmt.Printf("✅ Recovery %d approved; the secret is recovered and %s can collect it\n", r.ID, r.RequestedBy)
+		return nil
+	}
+	fmt.Printf("✅ Recovery %d approved (%d approval(s) so far)\n", r.ID, len(r.Approvers))
+	return nil
+}
+
+func runCollect(cmd *cobra.Command, args []string) error {
+	id, err := parseID("recovery", args[0])
+	if err != nil {
+		return err
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := call(http.MethodPost, fmt.Sprintf("/api/v1/escrow-recoveries/%d/collect", id), nil, &out); err != nil {
+		return err
+	}
+	fmt.Println(out.Value)
+	return nil
+}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	path := "/api/v1/escrow/log"
+	if logEscrowID != 0 {
+		path += fmt.Sprintf("?escrow_id=%d", logEscrowID)
+	}
+	var out struct {
+		Verification struct {
+			Entries  int  `json:"entries"`
+			Valid    bool `json:"valid"`
+			BrokenAt uint `json:"broken_at"`
+		} `json:"verification"`
+		Entries []struct {
+			ID         uint      `json:"id"`
+			EscrowID   uint      `json:"escrow_id"`
+			RecoveryID *uint     `json:"recovery_id"`
+			Action     string    `json:"action"`
+			Actor      string    `json:"actor"`
+			Detail     string    `json:"detail"`
+			CreatedAt  time.Time `json:"created_at"`
+		} `json:"entries"`
+	}
+	if err := call(http.MethodGet, path, nil, &out); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tESCROW\tRECOVERY\tACTION\tACTOR\tDETAIL")
+	for _, e := range out.Entries {
+		recoveryID := "-"
+		if e.RecoveryID != nil {
+			recoveryID = strconv.FormatUint(uint64(*e.RecoveryID), 10)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n", e.ID, e.CreatedAt.Local().Format(time.RFC3339), e.EscrowID,
+			recoveryID, e.Action, e.Actor, e.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !out.Verification.Valid {
+		return fmt.Errorf("escrow log has been tampered with at entry %d", out.Verification.BrokenAt)
+	}
+	fmt.Printf("🔗 Hash chain of %d entries verified\n", out.Verification.Entries)
+	return nil
+}
+
+func parseID(kind, raw string) (uint64, error) {
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", kind, raw)
+	}
+	return id, nil
+}
+
+// call sends an authenticated request to the server given by --server
+func call(method, path string, body, out interface{}) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	return client.Do(method, path, body, out)
+}
@@ -0,0 +1,179 @@
+package gitops
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/gitops"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL    string
+	manifestFile string
+)
+
+// GitOpsCmd checks secret manifests and shows how the server's secrets
+// compare with them
+var GitOpsCmd = &cobra.Command{
+	Use:   "gitops",
+	Short: "Declare secret metadata in Git and report drift",
+	Long: `In GitOps mode the server reads a manifest from a Git repository that
+declares secrets by path, with their type, owner, tags and read limit, but
+never their values, and compares it with its secrets on every sync. It
+reports secrets that drifted from the manifest, declared secrets that are
+missing and undeclared secrets in the same scopes. With
+secrets.gitops.create_placeholders, missing secrets are created as
+placeholders that cannot be read until someone sets their value.
+
+'plan' checks a manifest against the server without changing anything,
+e.g. in CI before a change to the manifest is merged; 'validate' only
+checks the file.
+
+Examples:
+  secretly gitops validate -f secrets.yaml
+  secretly gitops plan -f secrets.yaml --server https://secretly.example.com
+  secretly gitops status --server https://secretly.example.com
+  secretly gitops sync --server https://secretly.example.com`,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a manifest file without contacting the server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, err := readManifest()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ %s declares %d secret(s)\n", manifestFile, len(manifest.Secrets))
+		return nil
+	},
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Compare a manifest file with the server's secrets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, err := readManifest()
+		if err != nil {
+			return err
+		}
+		var report core.GitOpsReport
+		if err := call(http.MethodPost, "/api/v1/gitops/plan", manifest, &report); err != nil {
+			return err
+		}
+		return printReport(&report)
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the report of the latest sync",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var report core.GitOpsReport
+		if err := call(http.MethodGet, "/api/v1/gitops/status", nil, &report); err != nil {
+			return err
+		}
+		return printReport(&report)
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Read the manifest from the repository now",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var report core.GitOpsReport
+		if err := call(http.MethodPost, "/api/v1/gitops/sync", nil, &report); err != nil {
+			return err
+		}
+		return printReport(&report)
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{planCmd, statusCmd, syncCmd} {
+		cmd.Flags().StringVar(&serverURL, "server", "http://localhost:8080", "Secretly server URL")
+	}
+	for _, cmd := range []*cobra.Command{validateCmd, planCmd} {
+		cmd.Flags().StringVarP(&manifestFile, "file", "f", gitops.DefaultFile, "Manifest file")
+	}
+	GitOpsCmd.AddCommand(validateCmd, planCmd, statusCmd, syncCmd)
+}
+
+func readManifest() (*gitops.Manifest, error) {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := gitops.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+	return manifest, nil
+}
+
+func printReport(report *core.GitOpsReport) error {
+	if report.Commit != "" {
+		fmt.Printf("📄 Manifest at %s, compared %s\n", report.Commit, report.SyncedAt.Local().Format(time.RFC1123))
+	}
+	if report.Error != "" {
+		fmt.Printf("⚠️  The latest sync failed at %s: %s\n", report.FailedAt.Local().Format(time.RFC1123), report.Error)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tSCOPE\tSECRET\tSTATE\tDETAIL")
+	for _, s := range report.Secrets {
+		detail := s.Detail
+		if len(s.Drift) > 0 {
+			fields := make([]string, 0, len(s.Drift))
+			for _, d := range s.Drift {
+				fields = append(fields, fmt.Sprintf("%s: %q, declared %q", d.Field, d.Actual, d.Declared))
+			}
+			detail = strings.Join(fields, "; ")
+		}
+		if s.AwaitingValue {
+			detail = strings.TrimPrefix(detail+"; awaiting its value", "; ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Path, scope(&s), secretID(&s), s.State, detail)
+	}
+	for _, s := range report.Unmanaged {
+		fmt.Fprintf(tw, "%s\t%s\t%s\tunmanaged\tnot in the manifest\n", s.Path, scope(&s), secretID(&s))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if report.Error != "" {
+		return fmt.Errorf("gitops sync is failing")
+	}
+	return nil
+}
+
+func scope(s *core.GitOpsSecret) string {
+	return fmt.Sprintf("%d/%d/%d", s.NamespaceID, s.ZoneID, s.EnvironmentID)
+}
+
+func secretID(s *core.GitOpsSecret) string {
+	if s.SecretID == 0 {
+		return "-"
+	}
+	return fmt.Sprint(s.SecretID)
+}
+
+// call sends an authenticated request to the server given by --server
+func call(method, path string, body, out interface{}) error {
+	client, err := apiclient.New(serverURL)
+	if err != nil {
+		return err
+	}
+	return client.Do(method, path, body, out)
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/importer"
+	"github.com/secretlyhq/secretly/internal/importer/aws"
+	"github.com/spf13/cobra"
+)
+
+var (
+	awsService  string
+	awsPrefix   string
+	awsRegion   string
+	awsEndpoint string
+)
+
+var awsCmd = &cobra.Command{
+	Use:   "aws",
+	Short: "Import from AWS Secrets Manager or SSM Parameter Store",
+	Long: `Import secrets from AWS Secrets Manager or SSM Parameter Store.
+
+Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+AWS_SESSION_TOKEN. The region defaults to AWS_REGION. SecureString
+parameters are decrypted; the leading "/" of parameter names is dropped.
+
+Examples:
+  secretly migrate aws --service secretsmanager --prefix prod/ --dry-run
+  secretly migrate aws --service ssm --prefix /app/prod --strategy overwrite
+  secretly migrate aws --service ssm --prefix /app --watch --interval 10m`,
+	RunE: runAWS,
+}
+
+func init() {
+	awsCmd.Flags().StringVar(&awsService, "service", aws.ServiceSecretsManager, "Source service: secretsmanager or ssm")
+	awsCmd.Flags().StringVar(&awsPrefix, "prefix", "", "Only import names under this prefix (an SSM path for ssm)")
+	awsCmd.Flags().StringVar(&awsRegion, "region", "", "AWS region (default $AWS_REGION)")
+	awsCmd.Flags().StringVar(&awsEndpoint, "endpoint", "", "Override the AWS endpoint, e.g. for LocalStack")
+	addImportFlags(awsCmd)
+	MigrateCmd.AddCommand(awsCmd)
+}
+
+func runAWS(cmd *cobra.Command, args []string) error {
+	if awsService != aws.ServiceSecretsManager && awsService != aws.ServiceSSM {
+		return fmt.Errorf("unknown service %q: use %s or %s", awsService, aws.ServiceSecretsManager, aws.ServiceSSM)
+	}
+	region := awsRegion
+	if region == "" {
+		region = aws.RegionFromEnv()
+	}
+	if region == "" {
+		return fmt.Errorf("AWS region is required: use --region or set AWS_REGION")
+	}
+	creds, err := aws.CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	client := aws.NewClient(region, creds)
+	client.Endpoint = awsEndpoint
+
+	source := fmt.Sprintf("aws-%s:%s/%s", awsService, region, awsPrefix)
+	return run(cmd, source, "secretly-migrate", func(ctx context.Context) ([]importer.Item, []importer.RoleSuggestion, error) {
+		items, err := client.Fetch(ctx, awsService, awsPrefix)
+		return items, nil, err
+	})
+}
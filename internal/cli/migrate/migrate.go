@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/importer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	strategy      string
+	dryRun        bool
+	watch         bool
+	interval      time.Duration
+	reportPath    string
+	namespaceID   uint
+	zoneID        uint
+	environmentID uint
+)
+
+// MigrateCmd imports secrets from other secret stores
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Import secrets from other secret managers",
+	Long: `Import secrets from an external secret manager into Secretly.
+
+Source names are kept as path-style secret names and source tags are stored
+as secret metadata. When a secret with the same name already exists in the
+target scope, --strategy decides what happens: skip it, overwrite it with a
+new version, or fail. Secrets whose value is unchanged are left alone.
+
+Use --dry-run to see what would change without writing anything, and --watch
+to keep syncing on an interval until interrupted.`,
+}
+
+// addImportFlags registers the flags shared by every source
+func addImportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&strategy, "strategy", string(importer.StrategySkip), "Conflict strategy: skip, overwrite or fail")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would change without importing")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Keep syncing until interrupted")
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Minute, "Time between syncs with --watch")
+	cmd.Flags().StringVar(&reportPath, "report", "", "Also write a JSON report to this file")
+	cmd.Flags().UintVar(&namespaceID, "namespace-id", 0, "Target namespace")
+	cmd.Flags().UintVar(&zoneID, "zone-id", 0, "Target zone")
+	cmd.Flags().UintVar(&environmentID, "environment-id", 0, "Target environment")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "watch")
+}
+
+// fetchFunc reads the current items from a source, together with any role
+// suggestions derived from its access policies
+type fetchFunc func(ctx context.Context) ([]importer.Item, []importer.RoleSuggestion, error)
+
+// run imports once, or repeatedly with --watch, and prints a report per pass
+func run(cmd *cobra.Command, source, createdBy string, fetch fetchFunc) error {
+	s, err := importer.ParseStrategy(strategy)
+	if err != nil {
+		return err
+	}
+	if watch && interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	opts := importer.Options{
+		Strategy:      s,
+		DryRun:        dryRun,
+		NamespaceID:   namespaceID,
+		ZoneID:        zoneID,
+		EnvironmentID: environmentID,
+		CreatedBy:     createdBy,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for {
+		report, err := syncOnce(ctx, app, source, fetch, opts)
+		if err != nil {
+			if !watch || ctx.Err() != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "⚠️  Sync failed: %v\n", err)
+		} else if !watch && report.Failed() {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("import finished with conflicts or errors")
+		}
+
+		if !watch {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("👋 Sync stopped")
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func syncOnce(ctx context.Context, app *di.App, source string, fetch fetchFunc, opts importer.Options) (*importer.Report, error) {
+	items, roles, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report, err := importer.Import(ctx, app.Core, source, items, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Roles = roles
+	if err := report.WriteText(os.Stdout); err != nil {
+		return nil, err
+	}
+	if reportPath != "" {
+		f, err := os.OpenFile(reportPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write report: %w", err)
+		}
+		defer f.Close()
+		if err := report.WriteJSON(f); err != nil {
+			return nil, fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/secretlyhq/secretly/internal/importer"
+	"github.com/secretlyhq/secretly/internal/importer/vault"
+	"github.com/spf13/cobra"
+)
+
+var (
+	vaultAddr       string
+	vaultPath       string
+	vaultNamespace  string
+	vaultNoPolicies bool
+)
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault --addr <url> --path <mount>/[prefix]",
+	Short: "Import from a HashiCorp Vault KV v2 mount",
+	Long: `Import secrets from a HashiCorp Vault KV v2 mount.
+
+The first segment of --path is the mount; the rest limits the import to a
+folder or a single secret. Every live version is replayed in order, so the
+Secretly history matches Vault's (deleted and destroyed versions are
+skipped). Secrets holding a single "value" key are imported as that string;
+others are stored as JSON. Custom metadata is kept as tags.
+
+ACL policies that grant access to the mount are mapped to suggested roles in
+the report; reading them needs a token allowed to read sys/policies/acl.
+The token is read from VAULT_TOKEN.
+
+Examples:
+  secretly migrate vault --addr https://vault.example.com:8200 --path kv/ --dry-run
+  secretly migrate vault --addr $VAULT_ADDR --path kv/app/prod --strategy overwrite --report migration.json`,
+	RunE: runVault,
+}
+
+func init() {
+	vaultCmd.Flags().StringVar(&vaultAddr, "addr", os.Getenv("VAULT_ADDR"), "Vault address (default $VAULT_ADDR)")
+	vaultCmd.Flags().StringVar(&vaultPath, "path", "", "KV v2 mount and optional prefix, e.g. kv/ or kv/app")
+	vaultCmd.Flags().StringVar(&vaultNamespace, "namespace", "", "Vault Enterprise namespace (default $VAULT_NAMESPACE)")
+	vaultCmd.Flags().BoolVar(&vaultNoPolicies, "no-policies", false, "Do not read policies or suggest roles")
+	_ = vaultCmd.MarkFlagRequired("path")
+	addImportFlags(vaultCmd)
+	MigrateCmd.AddCommand(vaultCmd)
+}
+
+func runVault(cmd *cobra.Command, args []string) error {
+	if vaultAddr == "" {
+		return fmt.Errorf("vault address is required: use --addr or set VAULT_ADDR")
+	}
+	mount, prefix := vault.SplitPath(vaultPath)
+	if mount == "" {
+		return fmt.Errorf("--path must start with a KV v2 mount, e.g. kv/")
+	}
+
+	client := vault.NewClient(vaultAddr, mount)
+	if client.Token == "" {
+		return fmt.Errorf("vault token is required: set VAULT_TOKEN")
+	}
+	if vaultNamespace != "" {
+		client.Namespace = vaultNamespace
+	}
+
+	source := fmt.Sprintf("vault:%s/%s", vaultAddr, vaultPath)
+	return run(cmd, source, "secretly-migrate", func(ctx context.Context) ([]importer.Item, []importer.RoleSuggestion, error) {
+		items, err := client.Fetch(ctx, prefix)
+		if err != nil || vaultNoPolicies {
+			return items, nil, err
+		}
+		roles, err := client.SuggestRoles(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Skipping role suggestions: %v\n", err)
+		}
+		return items, roles, nil
+	})
+}
@@ -0,0 +1,295 @@
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/prompt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	policyFile    string
+	applyYes      bool
+	explainUser   string
+	explainAction string
+	explainSecret uint
+	explainJSON   bool
+)
+
+// RBACCmd manages users, groups, roles and role assignments from files
+var RBACCmd = &cobra.Command{
+	Use:   "rbac",
+	Short: "Manage users, groups, roles and role assignments from a file",
+	Long: `Declare access in a YAML file and keep the database matching it:
+
+  users:
+    - username: alice
+      email: alice@example.com
+    - username: bob
+      deactivated: true
+  roles:
+    - name: deployer
+      description: Deploys to production
+      permissions: [secrets.list, secrets.read, secrets.write]
+  groups:
+    - name: platform
+      members: [alice]
+  assignments:
+    - role: deployer
+      group: platform
+      namespace_id: 2
+  deny:
+    - name: no-prod-deletes
+      permission: secrets.delete
+      namespace_id: 2
+      except: [deployer]
+
+Each section that is present is made to match exactly: roles, groups,
+members, assignments and deny rules that are not listed are removed. Leave a section
+out to manage it by hand. Built-in roles (see 'secretly rbac roles') can
+be assigned without listing them and are never changed or removed. Users are never deleted; deactivating one
+revokes their sessions.
+
+A .csv file declares assignments only, with the header
+role,user,group,namespace_id.
+
+Examples:
+  secretly rbac permissions
+  secretly rbac plan -f access.yaml
+  secretly rbac apply -f access.yaml
+  secretly rbac apply -f assignments.csv --yes
+  secretly rbac explain --user alice --action secrets.read --secret 42`,
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes applying an access file would make",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := readPolicy(policyFile)
+		if err != nil {
+			return err
+		}
+		app, err := di.NewApp("")
+		if err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		defer app.Close()
+
+		changes, err := app.Core.PlanRBAC(context.Background(), policy)
+		if err != nil {
+			return err
+		}
+		printPlan(changes)
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Make users, groups, roles and assignments match an access file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := readPolicy(policyFile)
+		if err != nil {
+			return err
+		}
+		app, err := di.NewApp("")
+		if err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		defer app.Close()
+
+		ctx := context.Background()
+		changes, err := app.Core.PlanRBAC(ctx, policy)
+		if err != nil {
+			return err
+		}
+		if !printPlan(changes) {
+			return nil
+		}
+		if !applyYes {
+			ok, err := prompt.Terminal().Confirm(fmt.Sprintf("Apply %d change(s)?", len(changes)), false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("❌ Apply cancelled")
+				return nil
+			}
+		}
+
+		// the plan is made again in the transaction, so this reports what
+		// was actually changed if the database moved on meanwhile
+		applied, err := app.Core.ApplyRBAC(ctx, policy)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Applied %d change(s)\n", len(applied))
+		return nil
+	},
+}
+
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "List the permissions roles can grant",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PERMISSION\tDESCRIPTION")
+		for _, p := range core.Permissions() {
+			fmt.Fprintf(tw, "%s\t%s\n", p.Name, p.Description)
+		}
+		return tw.Flush()
+	},
+}
+
+var rolesCmd = &cobra.Command{
+	Use:   "roles",
+	Short: "List roles and their permissions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := di.NewApp("")
+		if err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		defer app.Close()
+
+		roles, err := app.Core.ListRoles(context.Background())
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROLE\tBUILT-IN\tPERMISSIONS")
+		for _, role := range roles {
+			fmt.Fprintf(tw, "%s\t%t\t%s\n", role.Name, role.Builtin, strings.Join(role.Permissions, ", "))
+		}
+		return tw.Flush()
+	},
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Trace whether a user may perform an action on a secret",
+	Long: `Walk every check that decides a user's access to a secret: the account,
+ownership, grants on the secret and its folders, group membership, roles
+and deny rules, and print the decision with its full trace.
+
+Examples:
+  secretly rbac explain --user alice --action secrets.read --secret 42
+  secretly rbac explain --user alice@example.com --action secrets.delete --secret 42 --json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := di.NewApp("")
+		if err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		defer app.Close()
+
+		d, err := app.Core.ExplainAccess(context.Background(), explainUser, explainAction, explainSecret)
+		if err != nil {
+			return err
+		}
+		if explainJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(d)
+		}
+		verdict := "❌ Denied"
+		if d.Allowed {
+			verdict = "✅ Allowed"
+		}
+		fmt.Printf("%s: %s %s on %q (id %d): %s\n", verdict, d.Username, d.Action, d.SecretName, d.SecretID, d.Reason)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, step := range d.Trace {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", step.Check, step.Effect, step.Detail)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	explainCmd.Flags().StringVar(&explainUser, "user", "", "Username or email address")
+	explainCmd.Flags().StringVar(&explainAction, "action", core.PermissionSecretsRead, "secrets.list, secrets.read, secrets.write, secrets.share or secrets.delete")
+	explainCmd.Flags().UintVar(&explainSecret, "secret", 0, "Secret ID")
+	explainCmd.Flags().BoolVar(&explainJSON, "json", false, "Print the decision as JSON")
+	explainCmd.MarkFlagRequired("user")
+	explainCmd.MarkFlagRequired("secret")
+	for _, cmd := range []*cobra.Command{planCmd, applyCmd} {
+		cmd.Flags().StringVarP(&policyFile, "file", "f", "", "Access file, YAML or CSV ('-' reads YAML from stdin)")
+		cmd.MarkFlagRequired("file")
+	}
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Apply without asking for confirmation")
+	RBACCmd.AddCommand(planCmd, applyCmd, permissionsCmd, rolesCmd, explainCmd)
+}
+
+// printPlan prints changes and reports whether there are any
+func printPlan(changes []core.RBACChange) bool {
+	if len(changes) == 0 {
+		fmt.Println("✅ Access already matches the file, nothing to change")
+		return false
+	}
+	fmt.Printf("🔍 %d change(s):\n", len(changes))
+	for _, ch := range changes {
+		fmt.Println("  " + ch.String())
+	}
+	return true
+}
+
+func readPolicy(path string) (*core.RBACPolicy, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readCSV(data)
+	}
+
+	var policy core.RBACPolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid access file %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// readCSV reads assignments with the header role,user,group,namespace_id
+func readCSV(data []byte) (*core.RBACPolicy, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid access file: %w", err)
+	}
+	want := []string{"role", "user", "group", "namespace_id"}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(want, ",") {
+		return nil, fmt.Errorf("invalid access file: the header must be %s", strings.Join(want, ","))
+	}
+	policy := &core.RBACPolicy{Assignments: []core.RBACAssignment{}}
+	for i, record := range records[1:] {
+		a := core.RBACAssignment{Role: record[0], User: record[1], Group: record[2]}
+		if record[3] != "" {
+			id, err := strconv.ParseUint(record[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid access file: line %d: invalid namespace_id %q", i+2, record[3])
+			}
+			a.NamespaceID = uint(id)
+		}
+		policy.Assignments = append(policy.Assignments, a)
+	}
+	return policy, nil
+}
@@ -0,0 +1,119 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/secretlyhq/secretly/internal/compliance"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	period    string
+	format    string
+	output    string
+	outputDir string
+)
+
+// ReportCmd groups report generators
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate reports",
+}
+
+var complianceCmd = &cobra.Command{
+	Use:   "compliance --period <period>",
+	Short: "Generate SOC 2 / ISO 27001 evidence for a period",
+	Long: `Generate compliance evidence for a quarter, half year, month or year:
+rotation coverage, secrets without expiry, users with access who did not log
+in, administrative actions and failed access attempts from the audit log.
+
+With --output-dir, both the JSON and the HTML rendering are written to the
+directory as an evidence bundle.
+
+Examples:
+  secretly report compliance --period 2024-Q4 --format html --output q4.html
+  secretly report compliance --period 2024-Q4 --output-dir evidence/2024-Q4
+  secretly report compliance --period 2024 --format json | jq .summary`,
+	Args: cobra.NoArgs,
+	RunE: runCompliance,
+}
+
+func init() {
+	complianceCmd.Flags().StringVar(&period, "period", "", "Period, e.g. 2024-Q4, 2024-H2, 2024-11 or 2024")
+	complianceCmd.Flags().StringVar(&format, "format", "json", "Report format: json or html")
+	complianceCmd.Flags().StringVar(&output, "output", "", "Write the report to a file instead of stdout")
+	complianceCmd.Flags().StringVar(&outputDir, "output-dir", "", "Write both JSON and HTML reports to this directory")
+	_ = complianceCmd.MarkFlagRequired("period")
+	complianceCmd.MarkFlagsMutuallyExclusive("output", "output-dir")
+	ReportCmd.AddCommand(complianceCmd)
+}
+
+func runCompliance(cmd *cobra.Command, args []string) error {
+	if format != "json" && format != "html" {
+		return fmt.Errorf("unsupported format %q: use json or html", format)
+	}
+	p, err := compliance.ParsePeriod(period)
+	if err != nil {
+		return err
+	}
+
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	report, err := compliance.Generate(context.Background(), app.Core, p)
+	if err != nil {
+		return err
+	}
+
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %w", outputDir, err)
+		}
+		for _, f := range []string{"json", "html"} {
+			path := filepath.Join(outputDir, fmt.Sprintf("compliance-%s.%s", p.Name, f))
+			if err := writeFile(path, report, f); err != nil {
+				return err
+			}
+			fmt.Printf("📋 Report written to %s\n", path)
+		}
+		return nil
+	}
+	if output != "" {
+		if err := writeFile(output, report, format); err != nil {
+			return err
+		}
+		fmt.Printf("📋 Report written to %s\n", output)
+		return nil
+	}
+	return write(os.Stdout, report, format)
+}
+
+func writeFile(path string, report *compliance.Report, format string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer f.Close()
+	return write(f, report, format)
+}
+
+func write(w io.Writer, report *compliance.Report, format string) error {
+	var err error
+	if format == "html" {
+		err = report.WriteHTML(w)
+	} else {
+		err = report.WriteJSON(w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var profileName string
+
+// RunCmd runs a command with the secrets of an export profile in its
+// environment
+var RunCmd = &cobra.Command{
+	Use:   "run --profile <name> -- <command> [args...]",
+	Short: "Run a command with a profile's secrets as environment variables",
+	Long: `Run a command with the secrets of a stored export profile added to its
+environment. Variables of the profile replace inherited ones of the same
+name. Nothing is written to disk. Manage profiles with 'secretly env profile'.
+
+Examples:
+  secretly run --profile api -- ./server
+  secretly run --profile worker -- npm run jobs`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runCommand,
+}
+
+func init() {
+	RunCmd.Flags().StringVar(&profileName, "profile", "", "Stored export profile")
+	_ = RunCmd.MarkFlagRequired("profile")
+}
+
+func runCommand(cmd *cobra.Command, args []string) error {
+	environ, err := profileEnv()
+	if err != nil {
+		return err
+	}
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = environ
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = child.Process.Signal(sig)
+		}
+	}()
+
+	err = child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s exited with status %d", args[0], exitErr.ExitCode())
+	}
+	return err
+}
+
+// profileEnv returns the current environment with the profile's variables
+// added. The app is closed before the command starts so that it does not
+// hold the database while the command runs.
+func profileEnv() ([]string, error) {
+	app, err := di.NewApp("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	ctx := context.Background()
+	profile, err := app.Core.GetExportProfile(ctx, profileName)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := app.Core.ExportProfileVars(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(vars))
+	environ := make([]string, 0, len(os.Environ())+len(vars))
+	for _, v := range vars {
+		set[v.Key] = true
+		environ = append(environ, v.Key+"="+string(v.Value))
+	}
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); !set[key] {
+			environ = append(environ, kv)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "🔑 Loaded %d variables from profile %s\n", len(vars), profileName)
+	return environ, nil
+}
@@ -0,0 +1,265 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/scan"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanHistory bool
+	scanStaged  bool
+	scanFormat  string
+	scanOutput  string
+	scanImport  bool
+	scanYes     bool
+	hookForce   bool
+)
+
+// ScanCmd scans files or git history for plaintext credentials
+var ScanCmd = &cobra.Command{
+	Use:   "scan [path|git-repo]",
+	Short: "Detect plaintext secrets in code and optionally import them",
+	Long: `Scan a directory, file or git repository for credential patterns such as
+cloud access keys, API tokens, private keys and hard-coded passwords.
+
+By default the working tree is scanned. Use --history to scan every commit
+of a repository (remote URLs are cloned to a temporary directory), or
+--staged to scan only changes in the index. Lines containing
+"secretly:ignore" are skipped.
+
+With --import, each finding is offered for import as a managed secret.
+The command exits non-zero while findings remain, so it can gate CI jobs.
+
+Examples:
+  secretly scan .
+  secretly scan --history https://github.com/example/app.git --format json --output report.json
+  secretly scan --import ./config
+  secretly scan install-hook`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runScan,
+}
+
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook [repo]",
+	Short: "Install a git pre-commit hook that blocks plaintext secrets",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runInstallHook,
+}
+
+func init() {
+	ScanCmd.Flags().BoolVar(&scanHistory, "history", false, "Scan all commits instead of the working tree")
+	ScanCmd.Flags().BoolVar(&scanStaged, "staged", false, "Scan only staged changes (used by the pre-commit hook)")
+	ScanCmd.Flags().StringVar(&scanFormat, "format", "text", "Report format: text or json")
+	ScanCmd.Flags().StringVar(&scanOutput, "output", "", "Write the report to a file instead of stdout")
+	ScanCmd.Flags().BoolVar(&scanImport, "import", false, "Offer to import findings as managed secrets")
+	ScanCmd.Flags().BoolVarP(&scanYes, "yes", "y", false, "Import all findings without prompting")
+	ScanCmd.MarkFlagsMutuallyExclusive("history", "staged")
+
+	installHookCmd.Flags().BoolVar(&hookForce, "force", false, "Replace an existing pre-commit hook")
+	ScanCmd.AddCommand(installHookCmd)
+}
+
+func runScan(cmd *cobra.Command, args []string) error {
+	if scanFormat != "text" && scanFormat != "json" {
+		return fmt.Errorf("unsupported format %q: use text or json", scanFormat)
+	}
+
+	target := "."
+	if len(args) == 1 {
+		target = args[0]
+	}
+
+	report, err := scanTarget(target)
+	if err != nil {
+		return err
+	}
+
+	remaining := report.Findings
+	if scanImport && len(report.Findings) > 0 {
+		remaining, err = importFindings(report.Findings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeReport(report); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d potential secrets found", len(remaining))
+	}
+	if scanFormat == "text" && scanOutput == "" {
+		fmt.Println("✅ No plaintext secrets found")
+	}
+	return nil
+}
+
+func scanTarget(target string) (*scan.Report, error) {
+	scanner := scan.NewScanner()
+
+	if scan.IsGitURL(target) {
+		if !scanHistory {
+			return nil, fmt.Errorf("remote repositories can only be scanned with --history")
+		}
+		dir, err := os.MkdirTemp("", "secretly-scan-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		fmt.Fprintf(os.Stderr, "📥 Cloning %s...\n", target)
+		if err := scan.Clone(target, dir); err != nil {
+			return nil, err
+		}
+		findings, err := scanner.ScanGitHistory(dir)
+		if err != nil {
+			return nil, err
+		}
+		return scan.NewReport(target, scan.ModeHistory, 0, findings), nil
+	}
+
+	switch {
+	case scanHistory:
+		findings, err := scanner.ScanGitHistory(target)
+		if err != nil {
+			return nil, err
+		}
+		return scan.NewReport(target, scan.ModeHistory, 0, findings), nil
+	case scanStaged:
+		findings, err := scanner.ScanStaged(target)
+		if err != nil {
+			return nil, err
+		}
+		return scan.NewReport(target, scan.ModeStaged, 0, findings), nil
+	default:
+		findings, files, err := scanner.ScanPath(target)
+		if err != nil {
+			return nil, err
+		}
+		return scan.NewReport(target, scan.ModeFiles, files, findings), nil
+	}
+}
+
+func writeReport(report *scan.Report) error {
+	var w io.Writer = os.Stdout
+	if scanOutput != "" {
+		f, err := os.OpenFile(scanOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create report file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	if scanFormat == "json" {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if scanOutput != "" {
+		fmt.Printf("📋 Report written to %s\n", scanOutput)
+	}
+	return nil
+}
+
+// importFindings offers each distinct value for import and returns the
+// findings that were not imported
+func importFindings(findings []scan.Finding) ([]scan.Finding, error) {
+	app, err := di.NewApp("")
+	if err != nil {
+		return nil, err
+	}
+	defer app.Close()
+
+	ctx := context.Background()
+	in := bufio.NewReader(os.Stdin)
+	imported := make(map[string]string)
+	var remaining []scan.Finding
+
+	for _, f := range findings {
+		if name, ok := imported[f.Secret]; ok {
+			fmt.Printf("✅ %s:%d already imported as %s\n", f.File, f.Line, name)
+			continue
+		}
+		if !f.Importable {
+			fmt.Printf("⚠️  %s:%d: %s spans multiple lines; import it manually\n", f.File, f.Line, f.Description)
+			remaining = append(remaining, f)
+			continue
+		}
+
+		name := suggestName(f)
+		if !scanYes {
+			fmt.Printf("🔍 %s:%d: %s %s\n", f.File, f.Line, f.Description, f.Masked)
+			fmt.Printf("   Import as %q? [y/N/other name]: ", name)
+			answer, _ := in.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			switch strings.ToLower(answer) {
+			case "y", "yes":
+			case "", "n", "no":
+				remaining = append(remaining, f)
+				continue
+			default:
+				name = answer
+			}
+		}
+
+		if _, err := app.Core.CreateSecret(ctx, &core.CreateSecretRequest{
+			Name:      name,
+			Type:      f.RuleID,
+			Value:     []byte(f.Secret),
+			CreatedBy: "secretly-scan",
+		}); err != nil {
+			fmt.Printf("❌ Failed to import %s: %v\n", name, err)
+			remaining = append(remaining, f)
+			continue
+		}
+		imported[f.Secret] = name
+		fmt.Printf("✅ Imported as %s\n", name)
+	}
+
+	if len(imported) > 0 {
+		fmt.Println("💡 Imported values are still present in the scanned files; replace them with references and rotate any credential that was committed")
+	}
+	return remaining, nil
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// suggestName derives a secret name from the file and rule, e.g.
+// "config-prod-aws-access-key-id"
+func suggestName(f scan.Finding) string {
+	base := strings.TrimSuffix(filepath.Base(f.File), filepath.Ext(f.File))
+	name := nonNameChars.ReplaceAllString(strings.ToLower(base+"-"+f.RuleID), "-")
+	return strings.Trim(name, "-")
+}
+
+func runInstallHook(cmd *cobra.Command, args []string) error {
+	repo := "."
+	if len(args) == 1 {
+		repo = args[0]
+	}
+
+	path, err := scan.InstallHook(repo, hookForce)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Pre-commit hook installed at %s\n", path)
+	fmt.Println("💡 Commits adding plaintext secrets will now be blocked; mark false positives with 'secretly:ignore'")
+	return nil
+}
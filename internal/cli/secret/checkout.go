@@ -0,0 +1,140 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	custodyServerURL string
+	checkoutLease    time.Duration
+	checkoutReason   string
+)
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout <id>",
+	Short: "Check out a break-glass secret for your exclusive use",
+	Long: `Secrets tagged as break-glass (security.checkout.tags) must be checked
+out before they are read or changed. While you hold one, everyone else is
+locked out. Check it in when you are done; the server may then rotate the
+value, so your copy stops working. Every check-out and check-in is audited.
+
+Examples:
+  secretly secret checkout 42 --reason "INC-1234 database outage" --server https://secretly.example.com
+  secretly secret checkin 42 --server https://secretly.example.com
+  secretly secret custody 42 --server https://secretly.example.com`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCheckout,
+}
+
+var checkinCmd = &cobra.Command{
+	Use:   "checkin <id>",
+	Short: "Check in a break-glass secret you checked out",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCheckin,
+}
+
+var custodyCmd = &cobra.Command{
+	Use:   "custody <id>",
+	Short: "Show who checked out a break-glass secret and when",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCustody,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{checkoutCmd, checkinCmd, custodyCmd} {
+		cmd.Flags().StringVar(&custodyServerURL, "server", "http://localhost:8080", "Secretly server URL")
+		SecretCmd.AddCommand(cmd)
+	}
+	checkoutCmd.Flags().DurationVar(&checkoutLease, "lease", 0, "How long to hold the secret (default security.checkout.lease_minutes)")
+	checkoutCmd.Flags().StringVar(&checkoutReason, "reason", "", "Why you need the secret, recorded in the audit log")
+}
+
+type checkout struct {
+	Username       string     `json:"username"`
+	Reason         string     `json:"reason"`
+	CheckedOutAt   time.Time  `json:"checked_out_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CheckedInAt    *time.Time `json:"checked_in_at"`
+	CheckedInBy    string     `json:"checked_in_by"`
+	RotatedVersion int        `json:"rotated_version"`
+}
+
+func runCheckout(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret ID %q", args[0])
+	}
+	client, err := apiclient.New(custodyServerURL)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{"lease_seconds": int(checkoutLease / time.Second), "reason": checkoutReason}
+	var co checkout
+	if err := client.Do(http.MethodPost, fmt.Sprintf("/api/v1/secrets/%d/checkout", id), req, &co); err != nil {
+		return err
+	}
+	fmt.Printf("🔓 Secret %d checked out until %s\n", id, co.ExpiresAt.Local().Format(time.RFC1123))
+	fmt.Printf("👉 Check it in with 'secretly secret checkin %d' when you are done\n", id)
+	return nil
+}
+
+func runCheckin(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret ID %q", args[0])
+	}
+	client, err := apiclient.New(custodyServerURL)
+	if err != nil {
+		return err
+	}
+	var co checkout
+	if err := client.Do(http.MethodPost, fmt.Sprintf("/api/v1/secrets/%d/checkin", id), nil, &co); err != nil {
+		return err
+	}
+	fmt.Printf("🔒 Secret %d checked in\n", id)
+	if co.RotatedVersion > 0 {
+		fmt.Printf("🔄 Its value was rotated to version %d\n", co.RotatedVersion)
+	}
+	return nil
+}
+
+func runCustody(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret ID %q", args[0])
+	}
+	client, err := apiclient.New(custodyServerURL)
+	if err != nil {
+		return err
+	}
+	var checkouts []checkout
+	if err := client.Do(http.MethodGet, fmt.Sprintf("/api/v1/secrets/%d/custody", id), nil, &checkouts); err != nil {
+		return err
+	}
+	if len(checkouts) == 0 {
+		fmt.Printf("📭 Secret %d has never been checked out.\n", id)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOLDER\tCHECKED OUT\tCHECKED IN\tBY\tROTATED\tREASON")
+	for _, co := range checkouts {
+		checkedIn, rotated := "held until "+co.ExpiresAt.Local().Format(time.RFC1123), "-"
+		if co.CheckedInAt != nil {
+			checkedIn = co.CheckedInAt.Local().Format(time.RFC1123)
+		}
+		if co.RotatedVersion > 0 {
+			rotated = fmt.Sprintf("v%d", co.RotatedVersion)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", co.Username, co.CheckedOutAt.Local().Format(time.RFC1123), checkedIn, co.CheckedInBy, rotated, co.Reason)
+	}
+	return tw.Flush()
+}
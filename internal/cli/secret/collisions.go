@@ -0,0 +1,56 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var collisionsCmd = &cobra.Command{
+	Use:   "collisions",
+	Short: "List secrets whose names collide within their scope",
+	Long: `Secret names are unique within a namespace, zone and environment after
+they are trimmed and put in Unicode NFC, and, with
+secrets.names.case_insensitive, regardless of case. Secrets created before
+these rules may break them. In each colliding group the oldest secret keeps
+the name; the others cannot be looked up by name until they are renamed.
+
+Examples:
+  secretly secret collisions`,
+	Args: cobra.NoArgs,
+	RunE: runCollisions,
+}
+
+func init() {
+	SecretCmd.AddCommand(collisionsCmd)
+}
+
+func runCollisions(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	collisions, err := app.Core.SecretNameCollisions(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(collisions) == 0 {
+		fmt.Println("✅ No colliding secret names")
+		return nil
+	}
+
+	fmt.Printf("⚠️  %d colliding name(s):\n", len(collisions))
+	for _, collision := range collisions {
+		keeper := collision.Secrets[0]
+		fmt.Printf("\n  %q in namespace %d, zone %d, environment %d\n", collision.Key, keeper.NamespaceID, keeper.ZoneID, keeper.EnvironmentID)
+		fmt.Printf("    %-6d %-30s keeps the name\n", keeper.ID, keeper.Name)
+		for _, secret := range collision.Secrets[1:] {
+			fmt.Printf("    %-6d %-30s rename, e.g. to %q\n", secret.ID, secret.Name, fmt.Sprintf("%s-%d", secret.Name, secret.ID))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package secret
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+// secretTypes are offered by the wizard; other type names are accepted
+// with --type and validated as generic values
+var secretTypes = []struct {
+	name        string
+	description string
+}{
+	{"generic", "Any text value"},
+	{"password", "Password"},
+	{"api-token", "API token or key, usually with an expiry"},
+	{"certificate", "PEM certificate, chain or key from a file"},
+	{"ssh-key", "SSH private key from a file"},
+	{"json", "JSON object"},
+}
+
+var (
+	createName        string
+	createType        string
+	createFromFile    string
+	createMaxReads    int
+	createExpiresIn   string
+	createNamespaceID uint
+	createZoneID      uint
+	createEnvID       uint
+	createParentID    uint
+	createTags        []string
+	createCanary      bool
+	createDecoy       string
+	createInteractive bool
+)
+
+var createCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a secret",
+	Long: `Create a secret from a file or stdin, or step by step with --interactive.
+
+The wizard reads values with hidden input and asks for them twice, offers
+files for certificates and SSH keys, suggests an expiry for API tokens and
+certificates, lists existing namespaces, zones and environments, and checks
+everything before anything is stored.
+
+Examples:
+  secretly secret create --interactive
+  secretly secret create --name db-password --type password --from-file - < pw.txt
+  secretly secret create --name tls --type certificate --from-file tls.pem --environment-id 2
+  secretly secret create --name ci-token --type api-token --from-file token.txt --expires-in 90d
+  secretly secret create --name prod-aws-root --decoy aws`,
+	Args: cobra.NoArgs,
+	RunE: runCreate,
+}
+
+func init() {
+	createCmd.Flags().StringVar(&createName, "name", "", "Secret name")
+	createCmd.Flags().StringVar(&createType, "type", "generic", "Secret type: generic, password, api-token, certificate, ssh-key or json")
+	createCmd.Flags().StringVar(&createFromFile, "from-file", "", `Read the value from a file, or "-" for stdin`)
+	createCmd.Flags().IntVar(&createMaxReads, "max-reads", 0, "Refuse reads after this many (0 = unlimited)")
+	createCmd.Flags().StringVar(&createExpiresIn, "expires-in", "", "Expire after a duration such as 90d or 12h, or on a date (2006-01-02)")
+	createCmd.Flags().UintVar(&createNamespaceID, "namespace-id", 0, "Namespace")
+	createCmd.Flags().UintVar(&createZoneID, "zone-id", 0, "Zone")
+	createCmd.Flags().UintVar(&createEnvID, "environment-id", 0, "Environment")
+	createCmd.Flags().UintVar(&createParentID, "parent-id", 0, "Folder to create the secret in (0 = top level)")
+	createCmd.Flags().StringSliceVar(&createTags, "tag", nil, `Tag the secret, e.g. "critical" to require a second admin for deletion`)
+	createCmd.Flags().BoolVar(&createCanary, "canary", false, "Make the secret a canary: every read raises a critical alert")
+	createCmd.Flags().StringVar(&createDecoy, "decoy", "", "Generate a decoy value instead of --from-file and make the secret a canary: "+strings.Join(core.DecoyKinds(), ", "))
+	createCmd.MarkFlagsMutuallyExclusive("decoy", "from-file")
+	createCmd.Flags().BoolVarP(&createInteractive, "interactive", "i", false, "Create the secret with a guided wizard")
+	SecretCmd.AddCommand(createCmd)
+}
+
+func runCreate(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	ctx := context.Background()
+
+	var req *core.CreateSecretRequest
+	if createInteractive {
+		req, err = runWizard(ctx, app.Core, prompt.Terminal())
+		if err != nil {
+			return err
+		}
+		if req == nil {
+			fmt.Println("❌ Cancelled, nothing was stored")
+			return nil
+		}
+	} else {
+		if req, err = requestFromFlags(); err != nil {
+			return err
+		}
+		if err := validateRequest(ctx, app.Core, req); err != nil {
+			return err
+		}
+	}
+
+	secret, err := app.Core.CreateSecret(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Created secret %q with ID %d\n", secret.Name, secret.ID)
+	if secret.Canary {
+		fmt.Println("🚨 This secret is a canary: every read is reported as a critical alert")
+	}
+	return nil
+}
+
+func requestFromFlags() (*core.CreateSecretRequest, error) {
+	if createName == "" || (createFromFile == "" && createDecoy == "") {
+		return nil, fmt.Errorf("--name and --from-file (or --decoy) are required unless --interactive is used")
+	}
+	var value []byte
+	var err error
+	if createDecoy != "" {
+		value, err = core.GenerateDecoy(createDecoy)
+	} else {
+		value, err = readValueFile(createFromFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &core.CreateSecretRequest{
+		Name:          createName,
+		Type:          createType,
+		Value:         value,
+		NamespaceID:   createNamespaceID,
+		ZoneID:        createZoneID,
+		EnvironmentID: createEnvID,
+		CreatedBy:     "secretly-cli",
+		Canary:        createCanary || createDecoy != "",
+	}
+	if createParentID != 0 {
+		req.ParentID = &createParentID
+	}
+	if len(createTags) > 0 {
+		req.Metadata = map[string]interface{}{"tags": createTags}
+	}
+	if createMaxReads > 0 {
+		req.MaxReads = &createMaxReads
+	}
+	if createExpiresIn != "" {
+		expiry, err := parseExpiry(createExpiresIn, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		req.Expiration = &expiry
+	}
+	return req, nil
+}
+
+// validateRequest runs every check the wizard runs, so both paths fail
+// before anything is stored
+func validateRequest(ctx context.Context, c *core.SecretlyCore, req *core.CreateSecretRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	if err := validateValue(req.Type, req.Value); err != nil {
+		return err
+	}
+	if err := c.ValidateScope(ctx, req.NamespaceID, req.ZoneID, req.EnvironmentID); err != nil {
+		return err
+	}
+	return checkNameFree(ctx, c, req)
+}
+
+func checkNameFree(ctx context.Context, c *core.SecretlyCore, req *core.CreateSecretRequest) error {
+	scope := &core.ListSecretsFilter{NamespaceID: req.NamespaceID, ZoneID: req.ZoneID, EnvironmentID: req.EnvironmentID}
+	_, err := c.FindSecret(ctx, scope, strings.TrimSpace(req.Name))
+	if errors.Is(err, core.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("a secret named %q already exists in this scope", req.Name)
+}
+
+// validateValue applies the checks for the secret type
+func validateValue(secretType string, value []byte) error {
+	if len(strings.TrimSpace(string(value))) == 0 {
+		return fmt.Errorf("value must not be empty")
+	}
+	switch secretType {
+	case "certificate":
+		if block, _ := pem.Decode(value); block == nil {
+			return fmt.Errorf("value is not PEM encoded")
+		}
+	case "ssh-key":
+		block, _ := pem.Decode(value)
+		if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			return fmt.Errorf("value is not a PEM or OpenSSH private key")
+		}
+	case "json":
+		var obj map[string]interface{}
+		if err := json.Unmarshal(value, &obj); err != nil {
+			return fmt.Errorf("value is not a JSON object: %v", err)
+		}
+	}
+	return nil
+}
+
+// certificateExpiry returns the earliest NotAfter of the certificates in a
+// PEM bundle
+func certificateExpiry(data []byte) (time.Time, bool) {
+	var earliest time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err == nil && (earliest.IsZero() || cert.NotAfter.Before(earliest)) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// parseExpiry accepts "90d", Go durations such as "12h", or a date
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil && t.After(now) {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q: use a future date (2006-01-02) or a duration such as 90d or 12h", s)
+}
+
+// candidateFiles lists files in the working directory (and ~/.ssh for SSH
+// keys) that look like they hold a value of the type
+func candidateFiles(secretType string) []string {
+	dirs := []string{"."}
+	if secretType == "ssh-key" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dirs = append(dirs, filepath.Join(home, ".ssh"))
+		}
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || strings.HasSuffix(name, ".pub") {
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(name))
+			match := ext == ".pem" || ext == ".crt" || ext == ".cer" || ext == ".key"
+			if secretType == "ssh-key" {
+				match = match || strings.HasPrefix(name, "id_")
+			}
+			if match {
+				files = append(files, filepath.Join(dir, name))
+			}
+		}
+	}
+	return files
+}
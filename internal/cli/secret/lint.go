@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Report secret names that break the naming policy",
+	Long: `Check the names of existing secrets against the rules in
+secrets.naming.rules and suggest a conforming name for each one that breaks
+them. New secrets are already checked when they are created. The command
+fails when it finds a violation, so it can gate CI.
+
+Examples:
+  secretly secret lint`,
+	Args: cobra.NoArgs,
+	RunE: runLint,
+}
+
+func init() {
+	SecretCmd.AddCommand(lintCmd)
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	lints, err := app.Core.LintSecretNames(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(lints) == 0 {
+		fmt.Println("✅ All secret names follow the naming policy")
+		return nil
+	}
+
+	for _, lint := range lints {
+		fmt.Printf("❌ %-6d %q in namespace %d: %s\n", lint.Secret.ID, lint.Secret.Name, lint.Secret.NamespaceID, strings.Join(lint.Violations, "; "))
+		if lint.Suggestion != "" {
+			fmt.Printf("   💡 rename to %q\n", lint.Suggestion)
+		}
+	}
+	cmd.SilenceUsage = true
+	return fmt.Errorf("%d secret name(s) break the naming policy", len(lints))
+}
@@ -0,0 +1,83 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	moveName        string
+	moveNamespaceID uint
+	moveZoneID      uint
+	moveEnvID       uint
+	moveParentID    uint
+)
+
+var moveCmd = &cobra.Command{
+	Use:   "move --id <id> [--name <name>] [--namespace-id <id>] [--zone-id <id>] [--environment-id <id>] [--parent-id <id>]",
+	Short: "Rename a secret or move it to another scope or folder",
+	Long: `Rename a secret or folder and/or move it to another namespace, zone,
+environment or folder. A folder moves with everything inside it; only empty
+folders can change scope. Moving to another scope without --parent-id puts
+the node at the top level there.
+
+The old name and scope of a secret are kept as an alias: lookups by the old
+name keep finding the secret for secrets.names.alias_days days (30 by
+default), and the API marks such responses with Deprecation and Warning
+headers so that clients can be updated. The move is recorded in the audit
+log.
+
+Examples:
+  secretly secret move --id 42 --name payments/stripe-key
+  secretly secret move --id 42 --environment-id 3
+  secretly secret move --id 42 --parent-id 7
+  secretly secret move --id 42 --parent-id 0   # to the top level`,
+	Aliases: []string{"rename"},
+	Args:    cobra.NoArgs,
+	RunE:    runMove,
+}
+
+func init() {
+	moveCmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+	moveCmd.Flags().StringVar(&moveName, "name", "", "New secret name")
+	moveCmd.Flags().UintVar(&moveNamespaceID, "namespace-id", 0, "New namespace")
+	moveCmd.Flags().UintVar(&moveZoneID, "zone-id", 0, "New zone")
+	moveCmd.Flags().UintVar(&moveEnvID, "environment-id", 0, "New environment")
+	moveCmd.Flags().UintVar(&moveParentID, "parent-id", 0, "Folder to move into (0 = top level)")
+	_ = moveCmd.MarkFlagRequired("id")
+	moveCmd.MarkFlagsOneRequired("name", "namespace-id", "zone-id", "environment-id", "parent-id")
+	SecretCmd.AddCommand(moveCmd)
+}
+
+func runMove(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	req := &core.MoveSecretRequest{Name: moveName}
+	if cmd.Flags().Changed("namespace-id") {
+		req.NamespaceID = &moveNamespaceID
+	}
+	if cmd.Flags().Changed("zone-id") {
+		req.ZoneID = &moveZoneID
+	}
+	if cmd.Flags().Changed("environment-id") {
+		req.EnvironmentID = &moveEnvID
+	}
+	if cmd.Flags().Changed("parent-id") {
+		req.ParentID = &moveParentID
+	}
+	secret, err := app.Core.MoveSecret(context.Background(), secretID, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Secret %d is now %q in namespace %d, zone %d, environment %d\n",
+		secret.ID, secret.Name, secret.NamespaceID, secret.ZoneID, secret.EnvironmentID)
+	return nil
+}
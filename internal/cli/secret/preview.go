@@ -0,0 +1,53 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	previewFirst int
+	previewLast  int
+)
+
+var previewCmd = &cobra.Command{
+	Use:   "preview --id <id>",
+	Short: "Show only the first and last characters of a secret value",
+	Long: `Reveal the first and/or last few characters of a secret value, e.g. to
+confirm with a user which key they have without exposing it. At most 8
+characters are shown at each end and never more than half of the value.
+A preview is recorded as a secret_previewed audit event and does not count
+as a read for max-reads limits.
+
+Examples:
+  secretly secret preview --id 42 --last 4
+  secretly secret preview --id 42 --first 3 --last 3`,
+	Args: cobra.NoArgs,
+	RunE: runPreview,
+}
+
+func init() {
+	previewCmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+	previewCmd.Flags().IntVar(&previewFirst, "first", 0, "Number of leading characters to show")
+	previewCmd.Flags().IntVar(&previewLast, "last", 4, "Number of trailing characters to show")
+	_ = previewCmd.MarkFlagRequired("id")
+	SecretCmd.AddCommand(previewCmd)
+}
+
+func runPreview(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	preview, err := app.Core.PreviewSecretValue(context.Background(), secretID, previewFirst, previewLast)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("👀 %s (%d characters)\n", preview.Masked(), preview.Length)
+	return nil
+}
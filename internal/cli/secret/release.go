@@ -0,0 +1,177 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	releaseServerURL  string
+	releaseTo         string
+	releaseAt         string
+	releaseInactivity int
+	releaseNote       string
+)
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Schedule secrets to become readable by someone else later",
+	Long: `A scheduled release gives a recipient read access to a secret at a set
+time, or once the owner has not logged in for a number of days (a dead
+man's switch). The owner is warned before a release happens, can cancel
+it until then, and postpones an inactivity release just by logging in.
+Scheduling, warnings, releases and cancellations are audited.
+
+The release is a read grant: like any grant, it takes away the access
+other users without a grant inherited from the folders above.
+
+Examples:
+  secretly secret release schedule 42 --to bob --at 2027-01-01T09:00:00Z --server https://secretly.example.com
+  secretly secret release schedule 42 --to bob --inactive-days 30 --note "Recovery codes for the family NAS"
+  secretly secret release list 42
+  secretly secret release cancel 7`,
+}
+
+var releaseScheduleCmd = &cobra.Command{
+	Use:   "schedule <id>",
+	Short: "Schedule a secret to be released to a recipient",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runReleaseSchedule,
+}
+
+var releaseListCmd = &cobra.Command{
+	Use:   "list <id>",
+	Short: "List the scheduled releases of a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runReleaseList,
+}
+
+var releaseCancelCmd = &cobra.Command{
+	Use:   "cancel <release-id>",
+	Short: "Cancel a pending release",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runReleaseCancel,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{releaseScheduleCmd, releaseListCmd, releaseCancelCmd} {
+		cmd.Flags().StringVar(&releaseServerURL, "server", "http://localhost:8080", "Secretly server URL")
+		releaseCmd.AddCommand(cmd)
+	}
+	releaseScheduleCmd.Flags().StringVar(&releaseTo, "to", "", "User the secret is released to")
+	releaseScheduleCmd.Flags().StringVar(&releaseAt, "at", "", "Release at this time (RFC 3339)")
+	releaseScheduleCmd.Flags().IntVar(&releaseInactivity, "inactive-days", 0, "Release once the owner has been inactive this many days")
+	releaseScheduleCmd.Flags().StringVar(&releaseNote, "note", "", "Message for the recipient, sent with the release")
+	_ = releaseScheduleCmd.MarkFlagRequired("to")
+	releaseScheduleCmd.MarkFlagsOneRequired("at", "inactive-days")
+	releaseScheduleCmd.MarkFlagsMutuallyExclusive("at", "inactive-days")
+	SecretCmd.AddCommand(releaseCmd)
+}
+
+type release struct {
+	ID             uint       `json:"id"`
+	Recipient      string     `json:"recipient"`
+	Status         string     `json:"status"`
+	ReleaseAt      *time.Time `json:"release_at"`
+	InactivityDays int        `json:"inactivity_days"`
+	Note           string     `json:"note"`
+	CreatedBy      string     `json:"created_by"`
+	DueAt          *time.Time `json:"due_at"`
+	ReleasedAt     *time.Time `json:"released_at"`
+	CancelledAt    *time.Time `json:"cancelled_at"`
+	CancelledBy    string     `json:"cancelled_by"`
+}
+
+func runReleaseSchedule(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret ID %q", args[0])
+	}
+	req := map[string]interface{}{"recipient": releaseTo, "note": releaseNote}
+	if releaseAt != "" {
+		at, err := time.Parse(time.RFC3339, releaseAt)
+		if err != nil {
+			return fmt.Errorf("invalid --at %q: use RFC 3339, e.g. 2027-01-01T09:00:00Z", releaseAt)
+		}
+		req["release_at"] = at
+	} else {
+		req["inactivity_days"] = releaseInactivity
+	}
+	client, err := apiclient.New(releaseServerURL)
+	if err != nil {
+		return err
+	}
+	var rel release
+	if err := client.Do(http.MethodPost, fmt.Sprintf("/api/v1/secrets/%d/releases", id), req, &rel); err != nil {
+		return err
+	}
+	if rel.ReleaseAt != nil {
+		fmt.Printf("⏳ Secret %d will be released to %s on %s (release %d)\n", id, rel.Recipient, rel.ReleaseAt.Local().Format(time.RFC1123), rel.ID)
+	} else {
+		fmt.Printf("⏳ Secret %d will be released to %s after %d days of owner inactivity (release %d)\n", id, rel.Recipient, rel.InactivityDays, rel.ID)
+	}
+	fmt.Printf("👉 Cancel it with 'secretly secret release cancel %d'\n", rel.ID)
+	return nil
+}
+
+func runReleaseList(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret ID %q", args[0])
+	}
+	client, err := apiclient.New(releaseServerURL)
+	if err != nil {
+		return err
+	}
+	var releases []release
+	if err := client.Do(http.MethodGet, fmt.Sprintf("/api/v1/secrets/%d/releases", id), nil, &releases); err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		fmt.Printf("📭 Secret %d has no scheduled releases.\n", id)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tRECIPIENT\tCONDITION\tSTATUS\tWHEN\tBY")
+	for _, rel := range releases {
+		condition := fmt.Sprintf("%d days inactive", rel.InactivityDays)
+		if rel.ReleaseAt != nil {
+			condition = "at a set time"
+		}
+		when, by := "-", rel.CreatedBy
+		switch {
+		case rel.DueAt != nil:
+			when = "due " + rel.DueAt.Local().Format(time.RFC1123)
+		case rel.ReleasedAt != nil:
+			when = rel.ReleasedAt.Local().Format(time.RFC1123)
+		case rel.CancelledAt != nil:
+			when, by = rel.CancelledAt.Local().Format(time.RFC1123), rel.CancelledBy
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", rel.ID, rel.Recipient, condition, rel.Status, when, by)
+	}
+	return tw.Flush()
+}
+
+func runReleaseCancel(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid release ID %q", args[0])
+	}
+	client, err := apiclient.New(releaseServerURL)
+	if err != nil {
+		return err
+	}
+	if err := client.Do(http.MethodDelete, fmt.Sprintf("/api/v1/releases/%d", id), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("🛑 Release %d cancelled\n", id)
+	return nil
+}
@@ -0,0 +1,93 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/clipboard"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	secretID     uint
+	clearTimeout time.Duration
+)
+
+// SecretCmd groups commands that work with a single secret
+var SecretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Work with individual secrets",
+}
+
+var copyCmd = &cobra.Command{
+	Use:   "copy --id <id>",
+	Short: "Copy a secret value to the clipboard and clear it after a timeout",
+	Long: `Copy a secret value to the system clipboard without printing it.
+
+The command waits and clears the clipboard after the timeout (default
+cli.clipboard_clear_seconds), or immediately on Ctrl+C. The clipboard is
+only cleared if it still holds the secret, so anything copied in the
+meantime is kept. Copying counts as a read for max-reads limits.
+
+Examples:
+  secretly secret copy --id 42
+  secretly secret copy --id 42 --timeout 10s`,
+	Args: cobra.NoArgs,
+	RunE: runCopy,
+}
+
+func init() {
+	copyCmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+	copyCmd.Flags().DurationVar(&clearTimeout, "timeout", 0, "Clear the clipboard after this long (default from configuration)")
+	_ = copyCmd.MarkFlagRequired("id")
+	SecretCmd.AddCommand(copyCmd)
+}
+
+func runCopy(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	timeout := clearTimeout
+	if timeout == 0 {
+		timeout = time.Duration(app.Config.CLI.ClipboardClearSeconds) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	value, err := app.Core.GetSecretValue(context.Background(), secretID)
+	if err != nil {
+		return err
+	}
+	if err := clipboard.Write(value); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+	fmt.Printf("📋 Copied secret %d to the clipboard; it will be cleared in %s (Ctrl+C to clear now)\n", secretID, timeout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+
+	cleared, err := clipboard.ClearIf(value)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to clear the clipboard: %v\n", err)
+		return err
+	case cleared:
+		fmt.Println("🧹 Clipboard cleared")
+	default:
+		fmt.Println("💡 Clipboard content changed since copying; left as is")
+	}
+	return nil
+}
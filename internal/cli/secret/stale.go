@@ -0,0 +1,135 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	staleDays  int
+	staleSweep bool
+)
+
+var staleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "List secrets nobody has used for a while",
+	Long: `List active secrets that have not been created, updated, read, previewed
+or checked out for --days days, or for secrets.stale.days when --days is
+not given, longest unused first. Canaries are left out.
+
+With --sweep the secrets.stale policy runs once: owners of newly stale
+secrets are notified, and secrets whose notice is older than
+archive_after_days are archived. The server runs the same sweep every
+interval_seconds.
+
+Examples:
+  secretly secret stale
+  secretly secret stale --days 180
+  secretly secret stale --sweep`,
+	Args: cobra.NoArgs,
+	RunE: runStale,
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive --id <id>",
+	Short: "Archive a secret so that it can no longer be read",
+	Long: `Archive a secret that should no longer be used. Reads fail until it is
+unarchived; nothing is deleted.
+
+Examples:
+  secretly secret archive --id 42`,
+	Args: cobra.NoArgs,
+	RunE: runArchive,
+}
+
+var unarchiveCmd = &cobra.Command{
+	Use:   "unarchive --id <id>",
+	Short: "Make an archived secret readable again",
+	Args:  cobra.NoArgs,
+	RunE:  runUnarchive,
+}
+
+func init() {
+	staleCmd.Flags().IntVar(&staleDays, "days", 0, "Unused for at least this many days (default secrets.stale.days or 90)")
+	staleCmd.Flags().BoolVar(&staleSweep, "sweep", false, "Notify owners and archive as configured in secrets.stale")
+	SecretCmd.AddCommand(staleCmd)
+
+	for _, cmd := range []*cobra.Command{archiveCmd, unarchiveCmd} {
+		cmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+		_ = cmd.MarkFlagRequired("id")
+		SecretCmd.AddCommand(cmd)
+	}
+}
+
+func runStale(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	ctx := context.Background()
+
+	if staleSweep {
+		report, err := app.Core.SweepStaleSecrets(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ %d owners notified, %d secrets archived\n", report.Notified, report.Archived)
+		return nil
+	}
+
+	stale, err := app.Core.StaleSecrets(ctx, time.Duration(staleDays)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		fmt.Println("✅ No stale secrets")
+		return nil
+	}
+	fmt.Printf("🕸️  %d stale secret(s):\n", len(stale))
+	for _, s := range stale {
+		note := ""
+		switch {
+		case s.ArchiveAt != nil:
+			note = "archived after " + s.ArchiveAt.Format(time.DateOnly)
+		case s.NotifiedAt != nil:
+			note = "owner notified " + s.NotifiedAt.Format(time.DateOnly)
+		}
+		fmt.Printf("  %-6d %-30s %-16s %4d days  %s\n", s.ID, s.Name, s.Owner, s.IdleDays, note)
+	}
+	return nil
+}
+
+func runArchive(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	secret, err := app.Core.ArchiveSecret(context.Background(), secretID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Archived secret %q (id %d)\n", secret.Name, secret.ID)
+	return nil
+}
+
+func runUnarchive(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	secret, err := app.Core.UnarchiveSecret(context.Background(), secretID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Secret %q (id %d) is %s again\n", secret.Name, secret.ID, secret.Status)
+	return nil
+}
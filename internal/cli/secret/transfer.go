@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	transferTo        string
+	orphansReassignTo string
+)
+
+var transferCmd = &cobra.Command{
+	Use:   "transfer --id <id> --to <username>",
+	Short: "Transfer ownership of a secret to another user",
+	Long: `Make another user the owner of a secret. The owner is listed in access
+reports and in 'secretly secret orphans' once the account is removed or
+deactivated.
+The transfer is recorded in the audit log.
+
+Examples:
+  secretly secret transfer --id 42 --to alice`,
+	Args: cobra.NoArgs,
+	RunE: runTransfer,
+}
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "List secrets whose owner no longer exists or is deactivated",
+	Long: `List secrets whose owner no longer exists or is deactivated. Each newly
+found orphan is recorded once as a secret_orphaned audit event, which also
+reaches 'secretly secret watch', so running this from cron queues orphans
+for review. With --reassign-to every orphan is transferred to that user.
+
+Examples:
+  secretly secret orphans
+  secretly secret orphans --reassign-to security-team`,
+	Args: cobra.NoArgs,
+	RunE: runOrphans,
+}
+
+func init() {
+	transferCmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+	transferCmd.Flags().StringVar(&transferTo, "to", "", "Username of the new owner")
+	_ = transferCmd.MarkFlagRequired("id")
+	_ = transferCmd.MarkFlagRequired("to")
+	SecretCmd.AddCommand(transferCmd)
+
+	orphansCmd.Flags().StringVar(&orphansReassignTo, "reassign-to", "", "Transfer every orphan to this user")
+	SecretCmd.AddCommand(orphansCmd)
+}
+
+func runTransfer(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	secret, err := app.Core.TransferOwnership(context.Background(), secretID, transferTo, "secretly-cli")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Secret %q (id %d) is now owned by %s\n", secret.Name, secret.ID, secret.Owner)
+	return nil
+}
+
+func runOrphans(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	ctx := context.Background()
+	orphans, err := app.Core.QueueOrphanedSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Println("✅ No orphaned secrets")
+		return nil
+	}
+
+	fmt.Printf("⚠️  %d orphaned secret(s):\n", len(orphans))
+	for _, secret := range orphans {
+		fmt.Printf("  %-6d %-30s owner %s\n", secret.ID, secret.Name, secret.Owner)
+	}
+	if orphansReassignTo == "" {
+		return nil
+	}
+	for _, secret := range orphans {
+		if _, err := app.Core.TransferOwnership(ctx, secret.ID, orphansReassignTo, "secretly-cli"); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("✅ Transferred %d secret(s) to %s\n", len(orphans), orphansReassignTo)
+	return nil
+}
@@ -0,0 +1,138 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	folderName        string
+	folderNamespaceID uint
+	folderZoneID      uint
+	folderEnvID       uint
+	folderParentID    uint
+
+	treeNamespaceID uint
+	treeZoneID      uint
+	treeEnvID       uint
+	treeRootID      uint
+)
+
+var folderCmd = &cobra.Command{
+	Use:   "folder --name <name>",
+	Short: "Create a folder for secrets",
+	Long: `Create a folder to group secrets. Folders live in a namespace, zone and
+environment and hold secrets and folders of the same scope. Their names
+share the scope with secret names, so a folder and a secret cannot have the
+same name. Put secrets in a folder with 'secretly secret create --parent-id'
+or 'secretly secret move --parent-id'.
+
+Examples:
+  secretly secret folder --name payments --namespace-id 2
+  secretly secret folder --name stripe --namespace-id 2 --parent-id 7`,
+	Args: cobra.NoArgs,
+	RunE: runFolder,
+}
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Show secrets and folders as a tree",
+	Long: `Show the folders and secrets of a namespace, zone and environment as a
+tree, from the top level or from the folder given with --root.
+
+Examples:
+  secretly secret tree
+  secretly secret tree --namespace-id 2
+  secretly secret tree --root 7`,
+	Args: cobra.NoArgs,
+	RunE: runTree,
+}
+
+func init() {
+	folderCmd.Flags().StringVar(&folderName, "name", "", "Folder name")
+	folderCmd.Flags().UintVar(&folderNamespaceID, "namespace-id", 0, "Namespace")
+	folderCmd.Flags().UintVar(&folderZoneID, "zone-id", 0, "Zone")
+	folderCmd.Flags().UintVar(&folderEnvID, "environment-id", 0, "Environment")
+	folderCmd.Flags().UintVar(&folderParentID, "parent-id", 0, "Folder to create the folder in (0 = top level)")
+	_ = folderCmd.MarkFlagRequired("name")
+	SecretCmd.AddCommand(folderCmd)
+
+	treeCmd.Flags().UintVar(&treeNamespaceID, "namespace-id", 0, "Only this namespace")
+	treeCmd.Flags().UintVar(&treeZoneID, "zone-id", 0, "Only this zone")
+	treeCmd.Flags().UintVar(&treeEnvID, "environment-id", 0, "Only this environment")
+	treeCmd.Flags().UintVar(&treeRootID, "root", 0, "Show only the contents of this folder")
+	SecretCmd.AddCommand(treeCmd)
+}
+
+func runFolder(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	ctx := context.Background()
+
+	if err := app.Core.ValidateScope(ctx, folderNamespaceID, folderZoneID, folderEnvID); err != nil {
+		return err
+	}
+	req := &core.CreateFolderRequest{
+		Name:          folderName,
+		NamespaceID:   folderNamespaceID,
+		ZoneID:        folderZoneID,
+		EnvironmentID: folderEnvID,
+		CreatedBy:     "secretly-cli",
+	}
+	if folderParentID != 0 {
+		req.ParentID = &folderParentID
+	}
+	folder, err := app.Core.CreateFolder(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Created folder %q with ID %d\n", folder.Name, folder.ID)
+	return nil
+}
+
+func runTree(cmd *cobra.Command, args []string) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+
+	filter := &core.ListSecretsFilter{NamespaceID: treeNamespaceID, ZoneID: treeZoneID, EnvironmentID: treeEnvID}
+	nodes, err := app.Core.SecretTree(context.Background(), filter, treeRootID)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		fmt.Println("📭 No secrets found")
+		return nil
+	}
+	printTree(nodes, "")
+	return nil
+}
+
+// printTree draws nodes with box-drawing branches, folders marked with 📁
+func printTree(nodes []*core.TreeNode, indent string) {
+	for i, node := range nodes {
+		branch, next := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, next = "└── ", "    "
+		}
+		if core.IsFolder(&node.SecretNode) {
+			fmt.Printf("%s%s📁 %s/ (id %d)\n", indent, branch, node.Name, node.ID)
+			printTree(node.Children, indent+next)
+			continue
+		}
+		label := fmt.Sprintf("%s (id %d", node.Name, node.ID)
+		if node.Type != "" {
+			label += ", " + node.Type
+		}
+		fmt.Printf("%s%s🔑 %s)\n", indent, branch, label)
+	}
+}
@@ -0,0 +1,150 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/prompt"
+	"github.com/secretlyhq/secretly/internal/valuediff"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateFromFile  string
+	updateDiff      bool
+	updateYes       bool
+	updateMaxReads  int
+	updateExpiresIn string
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update --id <id> --from-file <file>",
+	Short: "Store a new version of a secret",
+	Long: `Store a new version of a secret from a file or stdin.
+
+With --diff the change is reviewed first: JSON secrets list added, removed
+and changed keys with their lengths, other values show their old and new
+size. Values are never printed. The update then needs confirmation unless
+--yes is given. Showing the diff reads the current value, which counts
+against max-reads limits.
+
+With the global --dry-run flag the update goes through validation, naming
+and permission checks, and the changes it would make are listed, but
+nothing is saved.
+
+Examples:
+  secretly secret update --id 42 --from-file new.json --diff
+  secretly secret update --id 42 --from-file - --expires-in 30d < token.txt
+  secretly --dry-run secret update --id 42 --from-file new.json`,
+	Args: cobra.NoArgs,
+	RunE: runUpdate,
+}
+
+func init() {
+	updateCmd.Flags().UintVar(&secretID, "id", 0, "Secret ID")
+	updateCmd.Flags().StringVar(&updateFromFile, "from-file", "", `Read the new value from a file, or "-" for stdin`)
+	updateCmd.Flags().BoolVar(&updateDiff, "diff", false, "Review a redacted diff and confirm before updating")
+	updateCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "Update without asking after the diff")
+	updateCmd.Flags().IntVar(&updateMaxReads, "max-reads", 0, "Reset the max-reads limit")
+	updateCmd.Flags().StringVar(&updateExpiresIn, "expires-in", "", "New expiry as a duration such as 90d or a date (2006-01-02)")
+	_ = updateCmd.MarkFlagRequired("id")
+	SecretCmd.AddCommand(updateCmd)
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	if updateDiff && !updateYes && updateFromFile == "-" {
+		return fmt.Errorf("confirming a --diff needs the terminal: pass the value as a file or add --yes")
+	}
+	req := &core.UpdateSecretRequest{}
+	if updateFromFile != "" {
+		value, err := readValueFile(updateFromFile)
+		if err != nil {
+			return err
+		}
+		req.Value = value
+	}
+	if updateMaxReads > 0 {
+		req.MaxReads = &updateMaxReads
+	}
+	if updateExpiresIn != "" {
+		expiry, err := parseExpiry(updateExpiresIn, time.Now())
+		if err != nil {
+			return err
+		}
+		req.Expiration = &expiry
+	}
+	if req.Value == nil && req.MaxReads == nil && req.Expiration == nil {
+		return fmt.Errorf("nothing to update: use --from-file, --max-reads or --expires-in")
+	}
+
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	ctx := context.Background()
+
+	secret, err := app.Core.GetSecret(ctx, secretID)
+	if err != nil {
+		return err
+	}
+	if req.Value != nil {
+		if err := validateValue(secret.Type, req.Value); err != nil {
+			return err
+		}
+	}
+
+	if updateDiff && req.Value != nil {
+		current, err := app.Core.GetSecretValue(ctx, secretID)
+		if err != nil {
+			return fmt.Errorf("failed to read current value for the diff: %w", err)
+		}
+		diff := valuediff.Compare(current, req.Value)
+		fmt.Printf("🔍 Changes to %q (%s):\n", secret.Name, diff.Kind)
+		if err := diff.Write(os.Stdout); err != nil {
+			return err
+		}
+		if !diff.Changed() && req.MaxReads == nil && req.Expiration == nil {
+			fmt.Println("✅ Value is unchanged, nothing to update")
+			return nil
+		}
+		if !updateYes {
+			ok, err := prompt.Terminal().Confirm("Apply this update?", false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("❌ Update cancelled")
+				return nil
+			}
+		}
+	}
+
+	if _, err := app.Core.UpdateSecret(ctx, secretID, req); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Updated secret %q\n", secret.Name)
+	return nil
+}
+
+// readValueFile reads a value from path or stdin for "-", dropping the
+// trailing newline editors and pipes add
+func readValueFile(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value: %w", err)
+	}
+	return []byte(strings.TrimRight(string(data), "\r\n")), nil
+}
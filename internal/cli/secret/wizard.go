@@ -0,0 +1,239 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/prompt"
+)
+
+// runWizard builds a create request step by step. It returns nil when the
+// user declines the final confirmation.
+func runWizard(ctx context.Context, c *core.SecretlyCore, p *prompt.Prompter) (*core.CreateSecretRequest, error) {
+	fmt.Fprintln(os.Stderr, "🧙 Create a secret")
+	req := &core.CreateSecretRequest{CreatedBy: "secretly-cli"}
+
+	var err error
+	if req.NamespaceID, req.ZoneID, req.EnvironmentID, err = pickScope(ctx, c, p); err != nil {
+		return nil, err
+	}
+
+	req.Name, err = p.AskValid("Name", "", func(name string) error {
+		if name == "" {
+			return fmt.Errorf("name is required")
+		}
+		return checkNameFree(ctx, c, &core.CreateSecretRequest{Name: name, NamespaceID: req.NamespaceID, ZoneID: req.ZoneID, EnvironmentID: req.EnvironmentID})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]string, len(secretTypes))
+	for i, t := range secretTypes {
+		options[i] = fmt.Sprintf("%-12s %s", t.name, t.description)
+	}
+	choice, err := p.Choose("Type", options, 0)
+	if err != nil {
+		return nil, err
+	}
+	req.Type = secretTypes[choice].name
+
+	if req.Value, err = askValue(p, req.Type); err != nil {
+		return nil, err
+	}
+	if err := askLimits(p, req); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequest(ctx, c, req); err != nil {
+		return nil, err
+	}
+	printSummary(req)
+	ok, err := p.Confirm("Create this secret?", true)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return req, nil
+}
+
+// pickScope offers the existing namespaces, zones and environments. A kind
+// with no entries is skipped.
+func pickScope(ctx context.Context, c *core.SecretlyCore, p *prompt.Prompter) (namespaceID, zoneID, environmentID uint, err error) {
+	namespaces, err := c.ListNamespaces(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	zones, err := c.ListZones(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	environments, err := c.ListEnvironments(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	pick := func(label string, ids []uint, names []string) (uint, error) {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		options := append([]string{"(none)"}, names...)
+		choice, err := p.Choose(label, options, 0)
+		if err != nil || choice == 0 {
+			return 0, err
+		}
+		return ids[choice-1], nil
+	}
+
+	var ids []uint
+	var names []string
+	for _, n := range namespaces {
+		ids, names = append(ids, n.ID), append(names, n.Name)
+	}
+	if namespaceID, err = pick("Namespace", ids, names); err != nil {
+		return
+	}
+	ids, names = nil, nil
+	for _, z := range zones {
+		ids, names = append(ids, z.ID), append(names, z.Name)
+	}
+	if zoneID, err = pick("Zone", ids, names); err != nil {
+		return
+	}
+	ids, names = nil, nil
+	for _, e := range environments {
+		ids, names = append(ids, e.ID), append(names, e.Name)
+	}
+	environmentID, err = pick("Environment", ids, names)
+	return
+}
+
+// askValue reads the value the way the type needs: files for certificates
+// and keys, hidden and confirmed input otherwise
+func askValue(p *prompt.Prompter, secretType string) ([]byte, error) {
+	validate := func(s string) error { return validateValue(secretType, []byte(s)) }
+	switch secretType {
+	case "certificate", "ssh-key":
+		return pickFile(p, secretType)
+	case "json":
+		value, err := p.AskValid(`JSON object (single line, or "@file" to read a file)`, "", func(s string) error {
+			data, err := readAt(s)
+			if err != nil {
+				return err
+			}
+			return validate(string(data))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAt(value)
+	default:
+		value, err := p.HiddenConfirmed("Value", validate)
+		return []byte(value), err
+	}
+}
+
+// readAt returns the contents of the file for "@path" and s otherwise
+func readAt(s string) ([]byte, error) {
+	if path, ok := strings.CutPrefix(s, "@"); ok {
+		return os.ReadFile(path)
+	}
+	return []byte(s), nil
+}
+
+func pickFile(p *prompt.Prompter, secretType string) ([]byte, error) {
+	files := candidateFiles(secretType)
+	options := append(append([]string{}, files...), "Enter a path")
+	choice, err := p.Choose("File", options, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	read := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := validateValue(secretType, data); err != nil {
+			return err
+		}
+		value = data
+		return nil
+	}
+	if choice < len(files) {
+		err = read(files[choice])
+		return value, err
+	}
+	_, err = p.AskValid("Path", "", read)
+	return value, err
+}
+
+// askLimits asks for expiry and max reads, proposing an expiry for tokens
+// and the certificate's own expiry for certificates
+func askLimits(p *prompt.Prompter, req *core.CreateSecretRequest) error {
+	def := ""
+	label := "Expires in (e.g. 90d, 12h or 2006-01-02; empty for never)"
+	switch req.Type {
+	case "api-token":
+		def = "90d"
+	case "certificate":
+		if notAfter, ok := certificateExpiry(req.Value); ok {
+			def = notAfter.Local().Format("2006-01-02")
+			label = "Expires on (defaults to the certificate's expiry)"
+		}
+	}
+
+	now := time.Now()
+	expiry, err := p.AskValid(label, def, func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := parseExpiry(s, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if expiry != "" {
+		t, _ := parseExpiry(expiry, now)
+		req.Expiration = &t
+	}
+
+	maxReads, err := p.AskValid("Max reads (empty for unlimited)", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+			return fmt.Errorf("enter a positive number")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if maxReads != "" {
+		n, _ := strconv.Atoi(maxReads)
+		req.MaxReads = &n
+	}
+	return nil
+}
+
+// printSummary shows everything but the value
+func printSummary(req *core.CreateSecretRequest) {
+	fmt.Fprintln(os.Stderr, "📋 Summary")
+	fmt.Fprintf(os.Stderr, "   Name:   %s\n", req.Name)
+	fmt.Fprintf(os.Stderr, "   Type:   %s\n", req.Type)
+	fmt.Fprintf(os.Stderr, "   Value:  %d bytes (hidden)\n", len(req.Value))
+	fmt.Fprintf(os.Stderr, "   Scope:  namespace %d, zone %d, environment %d\n", req.NamespaceID, req.ZoneID, req.EnvironmentID)
+	if req.Expiration != nil {
+		fmt.Fprintf(os.Stderr, "   Expiry: %s\n", req.Expiration.Local().Format(time.RFC1123))
+	}
+	if req.MaxReads != nil {
+		fmt.Fprintf(os.Stderr, "   Reads:  %d\n", *req.MaxReads)
+	}
+}
@@ -0,0 +1,206 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	owner       string
+	description string
+	tokenName   string
+	tokenTTL    time.Duration
+)
+
+// ServiceAccountCmd manages the non-interactive identities automation uses
+var ServiceAccountCmd = &cobra.Command{
+	Use:     "service-account",
+	Aliases: []string{"sa"},
+	Short:   "Manage service accounts for automation",
+	Long: `Service accounts are identities for CI jobs, deployments and other
+automation. They have no password and cannot log in; they authenticate
+with tokens only. Grant them access, assign them roles and transfer secrets
+to them like to any user. Each service account has an owner, the person
+accountable for it. Audit events caused by their tokens are labeled
+service_account, and their tokens cannot do what needs a personal session,
+such as reading the audit log.
+
+Examples:
+  secretly service-account create ci-deploy --owner alice --description "Deploys from CI"
+  secretly service-account token ci-deploy --name github-actions --ttl 720h
+  secretly service-account tokens ci-deploy
+  secretly service-account revoke-token ci-deploy 17
+  secretly service-account disable ci-deploy`,
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a service account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			account, err := c.CreateServiceAccount(ctx, &core.CreateServiceAccountRequest{Name: args[0], Description: description, Owner: owner})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✅ Service account %s created, owned by %s\n", account.Name, account.Owner)
+			fmt.Printf("   Issue a token with 'secretly service-account token %s --name <token-name>'\n", account.Name)
+			return nil
+		})
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List service accounts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			accounts, err := c.ListServiceAccounts(ctx)
+			if err != nil {
+				return err
+			}
+			if len(accounts) == 0 {
+				fmt.Println("📭 No service accounts. Create one with 'secretly service-account create <name> --owner <username>'.")
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tOWNER\tSTATUS\tTOKENS\tLAST USED\tDESCRIPTION")
+			for _, a := range accounts {
+				status := "active"
+				if a.DisabledAt != nil {
+					status = "disabled"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", a.Name, a.Owner, status, a.Tokens, lastUsed(a.LastUsedAt), a.Description)
+			}
+			return tw.Flush()
+		})
+	},
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token <name>",
+	Short: "Issue a token for a service account and print it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			token, info, err := c.IssueServiceToken(ctx, args[0], tokenName, tokenTTL)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✅ Token %s (%d) issued for %s, valid until %s\n", info.Name, info.ID, args[0], info.ExpiresAt.Local().Format(time.RFC1123))
+			fmt.Printf("\n  %s\n\n", token)
+			fmt.Println("⚠️  Store the token now; it cannot be shown again. Send it as 'Authorization: Bearer <token>'.")
+			return nil
+		})
+	},
+}
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens <name>",
+	Short: "List the unexpired tokens of a service account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			tokens, err := c.ListServiceTokens(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				fmt.Printf("📭 %s has no tokens\n", args[0])
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tCREATED\tEXPIRES\tLAST USED")
+			for _, t := range tokens {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.CreatedAt.Local().Format(time.RFC1123),
+					t.ExpiresAt.Local().Format(time.RFC1123), lastUsed(t.LastUsedAt))
+			}
+			return tw.Flush()
+		})
+	},
+}
+
+var revokeTokenCmd = &cobra.Command{
+	Use:   "revoke-token <name> <token-id>",
+	Short: "Revoke one token of a service account",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid token ID %q", args[1])
+		}
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			if err := c.RevokeServiceToken(ctx, args[0], uint(id)); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Token %d of %s revoked\n", id, args[0])
+			return nil
+		})
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable <name>",
+	Short: "Block a service account and revoke its tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			n, err := c.DisableServiceAccount(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("🔒 Service account %s disabled, %d token(s) revoked\n", args[0], n)
+			return nil
+		})
+	},
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable <name>",
+	Short: "Let a disabled service account be issued tokens again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			if err := c.EnableServiceAccount(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Service account %s enabled\n", args[0])
+			return nil
+		})
+	},
+}
+
+func init() {
+	createCmd.Flags().StringVar(&owner, "owner", "", "Username of the person accountable for the account")
+	createCmd.Flags().StringVar(&description, "description", "", "What the account is used for")
+	_ = createCmd.MarkFlagRequired("owner")
+	tokenCmd.Flags().StringVar(&tokenName, "name", "", "Name of the token, e.g. where it is deployed")
+	tokenCmd.Flags().DurationVar(&tokenTTL, "ttl", core.DefaultServiceTokenTTL, "How long the token is valid")
+	_ = tokenCmd.MarkFlagRequired("name")
+	ServiceAccountCmd.AddCommand(createCmd, listCmd, tokenCmd, tokensCmd, revokeTokenCmd, disableCmd, enableCmd)
+}
+
+func withCore(fn func(context.Context, *core.SecretlyCore) error) error {
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	return fn(context.Background(), app.Core)
+}
+
+func lastUsed(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return time.Since(*t).Round(time.Second).String() + " ago"
+}
@@ -1,38 +1,59 @@
 package system
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/secretlyhq/secretly/internal/config"
 	"github.com/secretlyhq/secretly/internal/securefiles"
+	"github.com/secretlyhq/secretly/internal/startup"
 	"github.com/spf13/cobra"
 )
 
 var auditCmd = &cobra.Command{
 	Use:   "audit",
 	Short: "Audit critical files for permissions and ownership",
+	Long: `Check the mode and owner of the config file, the KEK/DEK, the database
+and the TLS certificates and keys.
+
+With --watch the check repeats every --interval until interrupted. Drift
+is reported once when it appears, logged and posted to
+security.file_audit.webhook_url; with security.auto_fix_file_permissions
+set the files are also repaired.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runAudit()
 	},
 }
 
-// auditCmd is now added to SystemCmd in system.go
+var (
+	auditConfigFile string
+	auditWatch      bool
+	auditInterval   time.Duration
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditConfigFile, "config", "secretly.yaml", "Path to config file")
+	auditCmd.Flags().BoolVar(&auditWatch, "watch", false, "Keep checking and report drift until interrupted")
+	auditCmd.Flags().DurationVar(&auditInterval, "interval", 0, "Time between checks with --watch (default security.file_audit.interval_seconds, or 5m)")
+}
 
 func runAudit() {
-	cfg, err := config.Load("secretly.yaml") // Use default config file name
+	cfg, err := config.Load(auditConfigFile)
 	if err != nil {
 		fmt.Println("Failed to load config:", err)
 		os.Exit(1)
 	}
 
-	files := []securefiles.FilePermSpec{
-		{Path: "secretly.yaml", Mode: 0600},
-		{Path: cfg.Storage.Encryption.KEKPath, Mode: 0600},
-		{Path: cfg.Storage.Encryption.DEKPath, Mode: 0600},
+	if auditWatch {
+		watchAudit(cfg)
+		return
 	}
 
-	err = securefiles.FixFilePerms(files, false) // false = audit only
+	err = securefiles.FixFilePerms(startup.CriticalFiles(auditConfigFile, cfg), false) // false = audit only
 	if err != nil {
 		fmt.Println("\nAudit finished with warnings/errors. Please fix the issues.")
 		os.Exit(1)
@@ -40,3 +61,23 @@ func runAudit() {
 
 	fmt.Println("✅ Audit passed: all critical files have correct permissions and ownership.")
 }
+
+func watchAudit(cfg *config.Config) {
+	interval := auditInterval
+	if interval <= 0 {
+		interval = time.Duration(cfg.Security.FileAudit.IntervalSeconds) * time.Second
+	}
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	mode := "report only"
+	if cfg.Security.AutoFixFilePermissions {
+		mode = "auto-fix enabled"
+	}
+	fmt.Printf("👀 Watching critical files every %s (%s), Ctrl+C to stop\n", interval, mode)
+	startup.NewPermissionWatcher(auditConfigFile, cfg, startup.DriftNotifier(cfg.Security.FileAudit)).Run(ctx, interval)
+}
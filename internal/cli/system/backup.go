@@ -0,0 +1,230 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/backup"
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/securefiles"
+	"github.com/spf13/cobra"
+)
+
+const backupPassphraseEnv = "SECRETLY_BACKUP_PASSPHRASE"
+
+var (
+	backupConfigFile     string
+	backupOutput         string
+	backupPassphraseFile string
+	restoreDryRun        bool
+	restoreForce         bool
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Create an encrypted backup bundle",
+	Long: `Create an encrypted backup bundle containing:
+- A consistent snapshot of the database
+- A fingerprint of the configuration file
+- Encryption keys (KEK/DEK) wrapped with the backup passphrase
+
+The passphrase is read from --passphrase-file or the SECRETLY_BACKUP_PASSPHRASE
+environment variable.
+
+Examples:
+  secretly system backup --output backups/secretly.bak
+  secretly system backup verify backups/secretly.bak`,
+	RunE: runBackup,
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify <bundle>",
+	Short: "Verify the integrity of a backup bundle",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBackupVerify,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <bundle>",
+	Short: "Restore database and keys from a backup bundle",
+	Long: `Restore the database and encryption keys from an encrypted backup bundle.
+
+Existing files are kept next to the originals with a .pre-restore.<timestamp> suffix,
+and put back if the restore fails halfway. Use --dry-run to check bundle integrity
+and version/schema compatibility without changing anything. A bundle whose
+configuration, tables, schema version or encryption setting do not match this
+installation is only restored with --force.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func init() {
+	backupCmd.PersistentFlags().StringVar(&backupConfigFile, "config", "secretly.yaml", "Path to config file")
+	backupCmd.PersistentFlags().StringVar(&backupPassphraseFile, "passphrase-file", "", "File containing the backup passphrase")
+	backupCmd.Flags().StringVar(&backupOutput, "output", "", "Output bundle path (default: secretly-backup-<timestamp>.bak)")
+	backupCmd.AddCommand(backupVerifyCmd)
+
+	restoreCmd.Flags().StringVar(&backupConfigFile, "config", "secretly.yaml", "Path to config file")
+	restoreCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "File containing the backup passphrase")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Verify and report compatibility without restoring")
+	restoreCmd.Flags().BoolVar(&restoreForce, "force", false, "Restore even if the bundle does not match this installation")
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(backupConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	passphrase, err := readBackupPassphrase()
+	if err != nil {
+		return err
+	}
+
+	output := backupOutput
+	if output == "" {
+		output = fmt.Sprintf("secretly-backup-%s.bak", time.Now().UTC().Format("20060102-150405"))
+	}
+
+	fmt.Println("💾 Creating backup bundle...")
+	manifest, err := backup.Create(backup.Options{
+		Config:     cfg,
+		ConfigPath: backupConfigFile,
+		Passphrase: passphrase,
+		OutputPath: output,
+	})
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	fmt.Printf("✅ Backup written to %s\n", output)
+	printManifest(manifest)
+	return nil
+}
+
+func runBackupVerify(cmd *cobra.Command, args []string) error {
+	passphrase, err := readBackupPassphrase()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🔍 Verifying %s...\n", args[0])
+	manifest, err := backup.Verify(args[0], passphrase)
+	if err != nil {
+		fmt.Printf("❌ Verification failed: %v\n", err)
+		return err
+	}
+
+	fmt.Println("✅ Bundle integrity verified")
+	printManifest(manifest)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(backupConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	passphrase, err := readBackupPassphrase()
+	if err != nil {
+		return err
+	}
+
+	if restoreDryRun {
+		fmt.Printf("🔍 Restore dry-run for %s\n", args[0])
+	} else {
+		fmt.Printf("♻️  Restoring from %s\n", args[0])
+	}
+
+	report, err := backup.Restore(backup.RestoreOptions{
+		Config:     cfg,
+		ConfigPath: backupConfigFile,
+		Passphrase: passphrase,
+		BundlePath: args[0],
+		DryRun:     restoreDryRun,
+		Force:      restoreForce,
+	})
+	if report != nil {
+		printRestoreReport(report)
+	}
+	if err != nil {
+		fmt.Printf("❌ Restore failed: %v\n", err)
+		return err
+	}
+
+	if report.Restored {
+		fmt.Println("\n✅ Restore completed. Previous files were kept with a .pre-restore suffix")
+	} else {
+		fmt.Println("\nℹ️  Dry-run only, nothing was changed")
+	}
+	return nil
+}
+
+func printRestoreReport(report *backup.RestoreReport) {
+	printManifest(report.Manifest)
+	fmt.Printf("Config match:  %s\n", statusIcon(report.ConfigMatches))
+	fmt.Printf("Schema match:  %s\n", statusIcon(report.Compatible()))
+	if len(report.MissingTables) > 0 {
+		fmt.Printf("   • Tables missing from current database: %s\n", strings.Join(report.MissingTables, ", "))
+	}
+	if len(report.ExtraTables) > 0 {
+		fmt.Printf("   • Tables not present in backup: %s\n", strings.Join(report.ExtraTables, ", "))
+	}
+	if len(report.Mismatches) > 0 {
+		fmt.Println("\n⚠️  Mismatches (restore with --force to proceed anyway):")
+		for _, m := range report.Mismatches {
+			fmt.Printf("   • %s\n", m)
+		}
+	}
+	if len(report.Warnings) > 0 {
+		fmt.Println("\n⚠️  Warnings:")
+		for _, w := range report.Warnings {
+			fmt.Printf("   • %s\n", w)
+		}
+	}
+}
+
+func readBackupPassphrase() (string, error) {
+	if backupPassphraseFile != "" {
+		absPath, err := filepath.Abs(backupPassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("invalid passphrase file path: %w", err)
+		}
+		data, err := securefiles.SafeReadFile(filepath.Dir(absPath), absPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if passphrase := os.Getenv(backupPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return "", fmt.Errorf("backup passphrase required: use --passphrase-file or set %s", backupPassphraseEnv)
+}
+
+func printManifest(m *backup.Manifest) {
+	fmt.Printf("📋 Format version: %d\n", m.FormatVersion)
+	fmt.Printf("📅 Created at:     %s\n", m.CreatedAt.Format(time.RFC3339))
+	if m.AppVersion != "" {
+		fmt.Printf("🏷️  App version:    %s\n", m.AppVersion)
+	}
+	if m.SchemaVersion > 0 {
+		fmt.Printf("🧬 Schema version: %d\n", m.SchemaVersion)
+	}
+	fmt.Printf("🔐 Encryption:     %v\n", m.EncryptionEnabled)
+	fmt.Printf("🗄️  Tables:         %d\n", len(m.SchemaTables))
+	for _, f := range m.Files {
+		fmt.Printf("   • %-24s %10d bytes  sha256:%s\n", f.Name, f.Size, f.SHA256[:12])
+	}
+}
+
+func statusIcon(ok bool) string {
+	if ok {
+		return "✅"
+	}
+	return "⚠️"
+}
@@ -0,0 +1,70 @@
+package system
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	modeServerURL string
+	modeMessage   string
+)
+
+var modeCmd = &cobra.Command{
+	Use:   "mode [normal|read_only|maintenance]",
+	Short: "Show or switch the server mode",
+	Long: `Show the server mode, or switch it. In read_only mode the server
+rejects every change; in maintenance mode it rejects everything except
+health checks and logins. Use them during migrations and restores.
+
+Switching requires a user whose roles grant system.manage. The change
+lasts until the server restarts; set server.maintenance.mode to keep it.
+
+Examples:
+  secretly system mode --server https://secretly.example.com
+  secretly system mode read_only --message "restoring backup" --server https://secretly.example.com
+  secretly system mode normal --server https://secretly.example.com`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"normal", "read_only", "maintenance"},
+	RunE:      runMode,
+}
+
+func init() {
+	modeCmd.Flags().StringVar(&modeServerURL, "server", "http://localhost:8080", "Secretly server URL")
+	modeCmd.Flags().StringVar(&modeMessage, "message", "", "Explanation returned to rejected requests")
+}
+
+type serverMode struct {
+	Mode      string    `json:"mode"`
+	Message   string    `json:"message"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy string    `json:"changed_by"`
+}
+
+func runMode(cmd *cobra.Command, args []string) error {
+	client, err := apiclient.New(modeServerURL)
+	if err != nil {
+		return err
+	}
+	var mode serverMode
+	if len(args) == 0 {
+		if err := client.Do(http.MethodGet, "/api/v1/system/mode", nil, &mode); err != nil {
+			return err
+		}
+		fmt.Printf("📋 Server mode: %s (since %s, set by %s)\n", mode.Mode, mode.ChangedAt.Local().Format(time.RFC1123), mode.ChangedBy)
+	} else {
+		body := map[string]string{"mode": args[0], "message": modeMessage}
+		if err := client.Do(http.MethodPut, "/api/v1/system/mode", body, &mode); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Server mode set to %s\n", mode.Mode)
+	}
+	if mode.Message != "" {
+		fmt.Printf("   %s\n", mode.Message)
+	}
+	return nil
+}
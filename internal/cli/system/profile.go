@@ -0,0 +1,103 @@
+package system
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileServerURL string
+	profileType      string
+	profileDuration  time.Duration
+	profileOutput    string
+)
+
+// profileTypes are the profiles served by the server; cpu is served as
+// "profile"
+var profileTypes = []string{"cpu", "heap", "allocs", "goroutine", "block", "mutex", "threadcreate", "trace"}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Collect a profile from a running server",
+	Long: `Collect a pprof profile or an execution trace from a running server and
+save it for 'go tool pprof' or 'go tool trace'.
+
+cpu and trace record for --duration (30s when not set). The other profiles
+are a snapshot, or with --duration the difference over that time, e.g. the
+allocations made during a load test.
+
+The server needs server.debug.enabled, and the user's roles must grant
+system.manage. Profiles can hold secret values; treat them like a backup.
+
+Examples:
+  secretly system profile --type heap --server https://secretly.example.com
+  secretly system profile --type cpu --duration 30s --output cpu.pprof --server https://secretly.example.com
+  go tool pprof -http :8081 cpu.pprof`,
+	Args: cobra.NoArgs,
+	RunE: runProfile,
+}
+
+func init() {
+	profileCmd.Flags().StringVar(&profileServerURL, "server", "http://localhost:8080", "Secretly server URL")
+	profileCmd.Flags().StringVar(&profileType, "type", "cpu", "Profile to collect: cpu, heap, allocs, goroutine, block, mutex, threadcreate or trace")
+	profileCmd.Flags().DurationVar(&profileDuration, "duration", 0, "How long to record (default 30s for cpu and trace)")
+	profileCmd.Flags().StringVarP(&profileOutput, "output", "o", "", "File to write (default <type>-<time>.pprof)")
+}
+
+func runProfile(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(profileTypes, profileType) {
+		return fmt.Errorf("unknown profile type %q", profileType)
+	}
+	name, duration := profileType, profileDuration
+	if name == "cpu" {
+		name = "profile"
+	}
+	if duration == 0 && (profileType == "cpu" || profileType == "trace") {
+		duration = 30 * time.Second
+	}
+	if duration < 0 || duration%time.Second != 0 {
+		return fmt.Errorf("--duration must be a whole number of seconds")
+	}
+
+	path := "/api/v1/system/debug/pprof/" + name
+	if duration > 0 {
+		path += "?" + url.Values{"seconds": {strconv.Itoa(int(duration.Seconds()))}}.Encode()
+	}
+	output := profileOutput
+	if output == "" {
+		ext := ".pprof"
+		if profileType == "trace" {
+			ext = ".out"
+		}
+		output = fmt.Sprintf("%s-%s%s", profileType, time.Now().Format("20060102-150405"), ext)
+	}
+
+	client, err := apiclient.New(profileServerURL)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", output, err)
+	}
+	if duration > 0 {
+		fmt.Printf("⏳ Recording %s profile for %s...\n", profileType, duration)
+	}
+	err = client.Download(path, f, duration+30*time.Second)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+	fmt.Printf("✅ Saved %s profile to %s\n", profileType, output)
+	return nil
+}
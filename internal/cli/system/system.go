@@ -13,4 +13,8 @@ func init() {
 	SystemCmd.AddCommand(InitCmd)
 	SystemCmd.AddCommand(auditCmd)
 	SystemCmd.AddCommand(validateCmd)
+	SystemCmd.AddCommand(backupCmd)
+	SystemCmd.AddCommand(restoreCmd)
+	SystemCmd.AddCommand(modeCmd)
+	SystemCmd.AddCommand(profileCmd)
 }
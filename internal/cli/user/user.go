@@ -0,0 +1,137 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/spf13/cobra"
+)
+
+var (
+	windowDays   int
+	reportFormat string
+)
+
+// UserCmd manages user accounts
+var UserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Deactivate, reactivate and offboard users",
+}
+
+var deactivateCmd = &cobra.Command{
+	Use:   "deactivate <username>",
+	Short: "Block a user and print their offboarding report",
+	Long: `Deactivate a user without deleting them: password logins and federated
+token exchanges are refused and every session is revoked. The secrets they
+own show up in 'secretly secret orphans'. The offboarding report lists
+those secrets and the ones the user read or changed in the --days before
+deactivation, which should be rotated. The change is recorded in the audit
+log.
+
+Examples:
+  secretly user deactivate alice
+  secretly user deactivate alice --days 30 --format json > alice-offboarding.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			report, err := c.DeactivateUser(ctx, args[0], "secretly-cli", window())
+			if err != nil {
+				return err
+			}
+			if reportFormat == "table" {
+				fmt.Printf("🔒 User %s deactivated, %d session(s) revoked\n\n", report.Username, report.SessionsRevoked)
+			}
+			return printReport(report)
+		})
+	},
+}
+
+var reactivateCmd = &cobra.Command{
+	Use:   "reactivate <username>",
+	Short: "Let a deactivated user log in again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			if err := c.ReactivateUser(ctx, args[0], "secretly-cli"); err != nil {
+				return err
+			}
+			fmt.Printf("✅ User %s reactivated\n", args[0])
+			return nil
+		})
+	},
+}
+
+var offboardingReportCmd = &cobra.Command{
+	Use:   "offboarding-report <username>",
+	Short: "List the secrets a user owns and recently accessed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withCore(func(ctx context.Context, c *core.SecretlyCore) error {
+			report, err := c.OffboardingReport(ctx, args[0], window())
+			if err != nil {
+				return err
+			}
+			return printReport(report)
+		})
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{deactivateCmd, offboardingReportCmd} {
+		cmd.Flags().IntVar(&windowDays, "days", 90, "Report secrets accessed within this many days")
+		cmd.Flags().StringVar(&reportFormat, "format", "table", "Report format: table or json")
+	}
+	UserCmd.AddCommand(deactivateCmd, reactivateCmd, offboardingReportCmd)
+}
+
+func window() time.Duration {
+	return time.Duration(windowDays) * 24 * time.Hour
+}
+
+func withCore(fn func(context.Context, *core.SecretlyCore) error) error {
+	if reportFormat != "table" && reportFormat != "json" {
+		return fmt.Errorf("unsupported format %q: use table or json", reportFormat)
+	}
+	app, err := di.NewApp("")
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	defer app.Close()
+	return fn(context.Background(), app.Core)
+}
+
+func printReport(report *core.OffboardingReport) error {
+	if reportFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Printf("👤 Offboarding report for %s\n", report.Username)
+	if len(report.Owned) == 0 {
+		fmt.Println("\nOwned secrets: none")
+	} else {
+		fmt.Printf("\nOwned secrets (transfer with 'secretly secret transfer'):\n")
+		for _, s := range report.Owned {
+			fmt.Printf("  %-6d %s\n", s.ID, s.Name)
+		}
+	}
+
+	if len(report.Accessed) == 0 {
+		fmt.Printf("\nAccessed since %s: none\n", report.Since.Format("2006-01-02"))
+		return nil
+	}
+	fmt.Printf("\nAccessed since %s (consider rotating):\n", report.Since.Format("2006-01-02"))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ID\tNAME\tLAST ACCESS\tACTIONS")
+	for _, s := range report.Accessed {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%v\n", s.ID, s.Name, s.LastAccess.Format(time.RFC3339), s.Actions)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,89 @@
+// Package clipboard reads and writes the system clipboard through the
+// platform's command-line tools: pbcopy/pbpaste on macOS, wl-clipboard,
+// xclip or xsel on Linux and PowerShell on Windows.
+package clipboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ErrUnavailable is returned when no clipboard tool is installed
+var ErrUnavailable = errors.New("no clipboard tool found: install wl-clipboard, xclip or xsel")
+
+type tool struct {
+	copy  []string
+	paste []string
+}
+
+func tools() []tool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []tool{{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}}
+	case "windows":
+		return []tool{{
+			copy:  []string{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"},
+			paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		}}
+	}
+	var candidates []tool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, tool{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}})
+	}
+	return append(candidates,
+		tool{copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-o"}},
+		tool{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}},
+	)
+}
+
+func find() (tool, error) {
+	for _, t := range tools() {
+		if _, err := exec.LookPath(t.copy[0]); err == nil {
+			return t, nil
+		}
+	}
+	return tool{}, ErrUnavailable
+}
+
+// Write replaces the clipboard contents. The value is passed on stdin so it
+// never appears in a process listing.
+func Write(data []byte) error {
+	t, err := find()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(t.copy[0], t.copy[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	return cmd.Run()
+}
+
+// Read returns the clipboard contents
+func Read() ([]byte, error) {
+	t, err := find()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(t.paste[0], t.paste[1:]...).Output()
+}
+
+// ClearIf empties the clipboard only if it still holds data, so that
+// anything the user copied in the meantime is left alone. Trailing newlines
+// are ignored since some paste tools add one. It reports whether the
+// clipboard was cleared.
+func ClearIf(data []byte) (bool, error) {
+	current, err := Read()
+	if err != nil {
+		return false, err
+	}
+	want := sha256.Sum256(bytes.TrimRight(data, "\r\n"))
+	got := sha256.Sum256(bytes.TrimRight(current, "\r\n"))
+	if subtle.ConstantTimeCompare(want[:], got[:]) != 1 {
+		return false, nil
+	}
+	return true, Write(nil)
+}
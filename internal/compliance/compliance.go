@@ -0,0 +1,270 @@
+// Package compliance builds evidence reports for audits such as SOC 2 and
+// ISO 27001: rotation coverage, secrets without expiry, dormant access,
+// administrative actions and failed access attempts over a period.
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// adminEventTypes are the audit events listed as administrative actions
+var adminEventTypes = []string{
+	core.EventUserCreated,
+	core.EventServiceAccountCreated,
+	core.EventServiceAccountDisabled,
+	core.EventServiceAccountEnabled,
+	core.EventServiceTokenIssued,
+	core.EventServiceTokenRevoked,
+	core.EventImpersonationStarted,
+	core.EventSecretDeleted,
+	core.EventAccessBypassed,
+	core.EventSessionRevoked,
+	core.EventOperationRequested,
+	core.EventOperationApproved,
+	core.EventOperationRejected,
+	core.EventOperationExpired,
+	core.EventModeChanged,
+	core.EventOwnerTransferred,
+	core.EventUserDeactivated,
+	core.EventUserReactivated,
+	core.EventTwoFactorDisabled,
+	core.EventPasskeyRemoved,
+	core.EventSecretCheckedOut,
+	core.EventSecretCheckedIn,
+	core.EventSecretPurged,
+	core.EventSecretRenamed,
+	core.EventPermissionGranted,
+	core.EventPermissionRevoked,
+	core.EventExportProfileSaved,
+	core.EventExportProfileDeleted,
+	core.EventSecretArchived,
+	core.EventSecretUnarchived,
+	core.EventRBACChanged,
+}
+
+// failedAccessEventTypes are the audit events listed as failed access
+var failedAccessEventTypes = []string{
+	core.EventLoginFailed,
+	core.EventAccessDenied,
+	core.EventNetworkDenied,
+}
+
+// Report is the evidence for one period
+type Report struct {
+	Period        Period         `json:"period"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Rotation      Rotation       `json:"rotation"`
+	NoExpiry      []SecretRef    `json:"secrets_without_expiry"`
+	DormantAccess []DormantUser  `json:"dormant_access"`
+	AdminActions  []Event        `json:"admin_actions"`
+	FailedAccess  []Event        `json:"failed_access"`
+	Summary       map[string]int `json:"summary"`
+}
+
+// Rotation reports how many secrets that existed at the end of the period
+// got a new value during it. Secrets created during the period count as
+// rotated.
+type Rotation struct {
+	Total           int         `json:"total"`
+	Rotated         int         `json:"rotated"`
+	CoveragePercent float64     `json:"coverage_percent"`
+	NotRotated      []SecretRef `json:"not_rotated"`
+}
+
+// SecretRef identifies a secret in a report. LastRotated is when its
+// newest value before the end of the period was written.
+type SecretRef struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	NamespaceID   uint       `json:"namespace_id"`
+	ZoneID        uint       `json:"zone_id"`
+	EnvironmentID uint       `json:"environment_id"`
+	LastRotated   *time.Time `json:"last_rotated,omitempty"`
+}
+
+// DormantUser has access to secrets but did not log in during the period,
+// or for service accounts, did not use a token
+type DormantUser struct {
+	Username       string   `json:"username"`
+	ServiceAccount bool     `json:"service_account,omitempty"`
+	Secrets        int      `json:"secrets"`
+	Sources        []string `json:"sources"`
+}
+
+// Event is an audit event included as evidence
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	UserID      *uint     `json:"user_id,omitempty"`
+	SecretID    *uint     `json:"secret_id,omitempty"`
+	Description string    `json:"description"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	Transport   string    `json:"transport,omitempty"`
+	ActorKind   string    `json:"actor_kind,omitempty"`
+	// ImpersonatorID is the admin who acted as UserID
+	ImpersonatorID *uint `json:"impersonator_id,omitempty"`
+}
+
+// Generate builds the report for period. Deleted secrets are not covered by
+// the rotation and expiry sections; their deletion appears as an
+// administrative action.
+func Generate(ctx context.Context, c *core.SecretlyCore, period Period) (*Report, error) {
+	r := &Report{
+		Period:        period,
+		GeneratedAt:   time.Now().UTC(),
+		NoExpiry:      []SecretRef{},
+		DormantAccess: []DormantUser{},
+		AdminActions:  []Event{},
+		FailedAccess:  []Event{},
+		Rotation:      Rotation{NotRotated: []SecretRef{}},
+	}
+	if err := r.addSecrets(ctx, c); err != nil {
+		return nil, err
+	}
+
+	events, err := c.ListAuditEvents(ctx, period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+	loggedIn := make(map[uint]bool)
+	for _, e := range events {
+		// Service accounts do not log in; using a token counts instead
+		if e.ActorKind == core.ActorServiceAccount && e.UserID != nil {
+			loggedIn[*e.UserID] = true
+		}
+		switch {
+		case e.EventType == core.EventUserLogin && e.UserID != nil:
+			loggedIn[*e.UserID] = true
+		case slices.Contains(adminEventTypes, e.EventType):
+			r.AdminActions = append(r.AdminActions, newEvent(e))
+		case slices.Contains(failedAccessEventTypes, e.EventType):
+			r.FailedAccess = append(r.FailedAccess, newEvent(e))
+		}
+	}
+	if err := r.addDormantAccess(ctx, c, loggedIn); err != nil {
+		return nil, err
+	}
+
+	r.Summary = map[string]int{
+		"secrets":                r.Rotation.Total,
+		"secrets_not_rotated":    len(r.Rotation.NotRotated),
+		"secrets_without_expiry": len(r.NoExpiry),
+		"dormant_users":          len(r.DormantAccess),
+		"admin_actions":          len(r.AdminActions),
+		"failed_access":          len(r.FailedAccess),
+	}
+	return r, nil
+}
+
+// addSecrets fills the rotation and expiry sections
+func (r *Report) addSecrets(ctx context.Context, c *core.SecretlyCore) error {
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &core.ListSecretsFilter{}, cursor, core.MaxCursorLimit)
+		if err != nil {
+			return err
+		}
+		for i := range secrets {
+			secret := &secrets[i]
+			if !secret.CreatedAt.Before(r.Period.End) {
+				continue
+			}
+			ref, err := r.secretRef(ctx, c, secret)
+			if err != nil {
+				return err
+			}
+
+			r.Rotation.Total++
+			if ref.LastRotated != nil && !ref.LastRotated.Before(r.Period.Start) {
+				r.Rotation.Rotated++
+			} else {
+				r.Rotation.NotRotated = append(r.Rotation.NotRotated, ref)
+			}
+			if secret.Expiration == nil {
+				r.NoExpiry = append(r.NoExpiry, ref)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if r.Rotation.Total > 0 {
+		r.Rotation.CoveragePercent = float64(r.Rotation.Rotated) * 100 / float64(r.Rotation.Total)
+	}
+	return nil
+}
+
+func (r *Report) secretRef(ctx context.Context, c *core.SecretlyCore, secret *models.SecretNode) (SecretRef, error) {
+	ref := SecretRef{
+		ID:            secret.ID,
+		Name:          secret.Name,
+		NamespaceID:   secret.NamespaceID,
+		ZoneID:        secret.ZoneID,
+		EnvironmentID: secret.EnvironmentID,
+	}
+	versions, err := c.GetSecretVersions(ctx, secret.ID)
+	if err != nil {
+		return ref, err
+	}
+	for _, v := range versions {
+		if v.CreatedAt.Before(r.Period.End) && (ref.LastRotated == nil || v.CreatedAt.After(*ref.LastRotated)) {
+			created := v.CreatedAt.UTC()
+			ref.LastRotated = &created
+		}
+	}
+	return ref, nil
+}
+
+// addDormantAccess lists users with access who did not log in
+func (r *Report) addDormantAccess(ctx context.Context, c *core.SecretlyCore, loggedIn map[uint]bool) error {
+	users, _, err := c.ListUsers(ctx, &core.ListUsersFilter{})
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if loggedIn[user.ID] {
+			continue
+		}
+		grants, err := c.UserAccess(ctx, user.Username)
+		if err != nil {
+			return fmt.Errorf("failed to resolve access of %q: %w", user.Username, err)
+		}
+		if len(grants) == 0 {
+			continue
+		}
+		dormant := DormantUser{Username: user.Username, ServiceAccount: c.IsServiceAccount(user.ID)}
+		seen := make(map[uint]bool)
+		for _, g := range grants {
+			if !seen[g.SecretID] {
+				seen[g.SecretID] = true
+				dormant.Secrets++
+			}
+			if !slices.Contains(dormant.Sources, g.Source) {
+				dormant.Sources = append(dormant.Sources, g.Source)
+			}
+		}
+		r.DormantAccess = append(r.DormantAccess, dormant)
+	}
+	return nil
+}
+
+func newEvent(e models.AuditEvent) Event {
+	return Event{
+		Time:           e.EventTime.UTC(),
+		Type:           e.EventType,
+		UserID:         e.UserID,
+		SecretID:       e.SecretNodeID,
+		Description:    e.Description,
+		IPAddress:      e.IPAddress,
+		Transport:      e.Transport,
+		ActorKind:      e.ActorKind,
+		ImpersonatorID: e.ImpersonatorID,
+	}
+}
@@ -0,0 +1,118 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end string
+	}{
+		{"2024-Q4", "2024-10-01", "2025-01-01"},
+		{"2024-q1", "2024-01-01", "2024-04-01"},
+		{"2024-H2", "2024-07-01", "2025-01-01"},
+		{"2024-11", "2024-11-01", "2024-12-01"},
+		{"2024", "2024-01-01", "2025-01-01"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePeriod(tt.in)
+		if err != nil {
+			t.Errorf("ParsePeriod(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := p.Start.Format("2006-01-02") + " " + p.End.Format("2006-01-02"); got != tt.start+" "+tt.end {
+			t.Errorf("ParsePeriod(%q) = %s, want %s %s", tt.in, got, tt.start, tt.end)
+		}
+	}
+	for _, bad := range []string{"2024-Q5", "2024-13", "Q4", ""} {
+		if _, err := ParsePeriod(bad); err == nil {
+			t.Errorf("Expected ParsePeriod(%q) to fail", bad)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	store := memory.New()
+	c := core.NewSecretlyCore(store, nil)
+	c.SetLocalActor("test")
+	c.SetApprovals(config.ApprovalsConfig{Enabled: true, Admins: []string{"bob"}})
+	ctx := context.Background()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &core.CreateUserRequest{Username: name, Password: "correct horse"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	expiry := time.Now().Add(24 * time.Hour)
+	fresh, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: "fresh", Value: []byte("v"), NamespaceID: 1, ZoneID: 1, EnvironmentID: 1, Expiration: &expiry})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	stale, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: "stale", Value: []byte("v"), NamespaceID: 1, ZoneID: 1, EnvironmentID: 1})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	// Backdate the stale secret and its only version to the previous year
+	old := time.Now().AddDate(-1, 0, 0)
+	node, _ := store.Secrets().GetByID(stale.ID)
+	node.CreatedAt = old
+	_ = store.Secrets().Update(node)
+	versions, _ := store.Secrets().GetVersions(stale.ID)
+	versions[0].CreatedAt = old
+	_ = store.Secrets().UpdateVersion(&versions[0])
+
+	if _, _, err := c.Login(ctx, "alice", "correct horse"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if _, _, err := c.Login(ctx, "alice", "wrong"); err == nil {
+		t.Fatal("Expected wrong password to fail")
+	}
+	if err := c.AuthorizeSecret(core.WithAuth(ctx, nil, &models.Session{UserID: 1, Scope: "removed"}), fresh, false); err == nil {
+		t.Fatal("Expected unknown scope to be denied")
+	}
+
+	now := time.Now().UTC()
+	p, err := ParsePeriod(fmt.Sprintf("%d", now.Year()))
+	if err != nil {
+		t.Fatalf("ParsePeriod failed: %v", err)
+	}
+	r, err := Generate(ctx, c, p)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if r.Rotation.Total != 2 || r.Rotation.Rotated != 1 || len(r.Rotation.NotRotated) != 1 || r.Rotation.NotRotated[0].ID != stale.ID {
+		t.Errorf("Unexpected rotation section: %+v", r.Rotation)
+	}
+	if len(r.NoExpiry) != 1 || r.NoExpiry[0].ID != stale.ID {
+		t.Errorf("Expected only the stale secret without expiry, got %+v", r.NoExpiry)
+	}
+	if len(r.DormantAccess) != 1 || r.DormantAccess[0].Username != "bob" || r.DormantAccess[0].Secrets != 2 {
+		t.Errorf("Expected bob as the only dormant user, got %+v", r.DormantAccess)
+	}
+	if len(r.FailedAccess) != 2 || r.FailedAccess[0].Type != core.EventLoginFailed || r.FailedAccess[1].Type != core.EventAccessDenied {
+		t.Errorf("Expected a failed login and a denied access, got %+v", r.FailedAccess)
+	}
+	if len(r.AdminActions) != 2 {
+		t.Errorf("Expected the two user creations as admin actions, got %+v", r.AdminActions)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteHTML(&buf); err != nil {
+		t.Fatalf("WriteHTML failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "stale") || !strings.Contains(buf.String(), "1 of 2 (50.0%)") {
+		t.Errorf("HTML report is missing content:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,52 @@
+package compliance
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Period is the reporting window [Start, End) in UTC
+type Period struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+var (
+	quarterPattern = regexp.MustCompile(`^(\d{4})-[Qq]([1-4])$`)
+	halfPattern    = regexp.MustCompile(`^(\d{4})-[Hh]([12])$`)
+	monthPattern   = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	yearPattern    = regexp.MustCompile(`^(\d{4})$`)
+)
+
+// ParsePeriod accepts a quarter ("2024-Q4"), half year ("2024-H2"), month
+// ("2024-11") or year ("2024")
+func ParsePeriod(s string) (Period, error) {
+	var start time.Time
+	var months int
+	if m := quarterPattern.FindStringSubmatch(s); m != nil {
+		q, _ := strconv.Atoi(m[2])
+		start, months = monthStart(m[1], (q-1)*3+1), 3
+	} else if m := halfPattern.FindStringSubmatch(s); m != nil {
+		h, _ := strconv.Atoi(m[2])
+		start, months = monthStart(m[1], (h-1)*6+1), 6
+	} else if m := monthPattern.FindStringSubmatch(s); m != nil {
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 {
+			return Period{}, fmt.Errorf("invalid month in period %q", s)
+		}
+		start, months = monthStart(m[1], month), 1
+	} else if m := yearPattern.FindStringSubmatch(s); m != nil {
+		start, months = monthStart(m[1], 1), 12
+	} else {
+		return Period{}, fmt.Errorf("invalid period %q: use e.g. 2024-Q4, 2024-H2, 2024-11 or 2024", s)
+	}
+	return Period{Name: s, Start: start, End: start.AddDate(0, months, 0)}, nil
+}
+
+func monthStart(year string, month int) time.Time {
+	y, _ := strconv.Atoi(year)
+	return time.Date(y, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,102 @@
+package compliance
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+)
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteHTML writes a self-contained HTML page for auditors
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2006-01-02") },
+	"datetime": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"lastRotated": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Format("2006-01-02")
+	},
+	"optional": func(id *uint) interface{} {
+		if id == nil {
+			return "–"
+		}
+		return *id
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Secretly compliance report {{.Period.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #666; margin-bottom: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+.summary td:first-child { width: 40%; }
+.empty { color: #666; font-style: italic; margin-bottom: 2em; }
+</style>
+</head>
+<body>
+<h1>Compliance report {{.Period.Name}}</h1>
+<div class="meta">Period {{date .Period.Start}} to {{date .Period.End}} (end exclusive, UTC) · generated {{datetime .GeneratedAt}}</div>
+
+<h2>Summary</h2>
+<table class="summary">
+<tr><td>Secrets at end of period</td><td>{{.Rotation.Total}}</td></tr>
+<tr><td>Rotation coverage</td><td>{{.Rotation.Rotated}} of {{.Rotation.Total}} ({{printf "%.1f" .Rotation.CoveragePercent}}%)</td></tr>
+<tr><td>Secrets without expiry</td><td>{{len .NoExpiry}}</td></tr>
+<tr><td>Users with dormant access</td><td>{{len .DormantAccess}}</td></tr>
+<tr><td>Administrative actions</td><td>{{len .AdminActions}}</td></tr>
+<tr><td>Failed access attempts</td><td>{{len .FailedAccess}}</td></tr>
+</table>
+
+<h2>Secrets not rotated during the period</h2>
+{{template "secrets" .Rotation.NotRotated}}
+
+<h2>Secrets without expiry</h2>
+{{template "secrets" .NoExpiry}}
+
+<h2>Dormant access</h2>
+{{if .DormantAccess}}
+<table>
+<tr><th>User</th><th>Secrets</th><th>Access sources</th></tr>
+{{range .DormantAccess}}<tr><td>{{.Username}}{{if .ServiceAccount}} (service account){{end}}</td><td>{{.Secrets}}</td><td>{{range $i, $s := .Sources}}{{if $i}}, {{end}}{{$s}}{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p class="empty">Every user with access logged in during the period.</p>{{end}}
+
+<h2>Administrative actions</h2>
+{{template "events" .AdminActions}}
+
+<h2>Failed access attempts</h2>
+{{template "events" .FailedAccess}}
+</body>
+</html>
+{{define "secrets"}}{{if .}}
+<table>
+<tr><th>ID</th><th>Name</th><th>Namespace</th><th>Zone</th><th>Environment</th><th>Last rotated</th></tr>
+{{range .}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.NamespaceID}}</td><td>{{.ZoneID}}</td><td>{{.EnvironmentID}}</td><td>{{lastRotated .LastRotated}}</td></tr>
+{{end}}</table>
+{{else}}<p class="empty">None.</p>{{end}}{{end}}
+{{define "events"}}{{if .}}
+<table>
+<tr><th>Time</th><th>Event</th><th>User ID</th><th>Secret ID</th><th>Description</th></tr>
+{{range .}}<tr><td>{{datetime .Time}}</td><td>{{.Type}}</td><td>{{optional .UserID}}{{if .ActorKind}} ({{.ActorKind}}){{end}}{{if .ImpersonatorID}} (impersonated by {{optional .ImpersonatorID}}){{end}}</td><td>{{optional .SecretID}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{else}}<p class="empty">None recorded.</p>{{end}}{{end}}
+`))
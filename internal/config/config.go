@@ -15,8 +15,33 @@ type Config struct {
 	Secrets    SecretsConfig    `yaml:"secrets"`
 	Telemetry  TelemetryConfig  `yaml:"telemetry"`
 	Security   SecurityConfig   `yaml:"security"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Env        EnvConfig        `yaml:"env"`
+	Agent      AgentConfig      `yaml:"agent"`
+	CLI        CLIConfig        `yaml:"cli"`
+	CSI        CSIConfig        `yaml:"csi"`
 	SoftDelete SoftDeleteConfig `yaml:"soft_delete"`
 	Purge      PurgeConfig      `yaml:"purge"`
+	Engines    EnginesConfig    `yaml:"engines"`
+	Faults     FaultsConfig     `yaml:"faults"`
+
+	Notifications NotificationsConfig `yaml:"notifications"`
+}
+
+// FaultsConfig injects latency and errors into storage and encryption; it
+// needs a build with -tags chaos
+type FaultsConfig struct {
+	Enabled bool        `yaml:"enabled"`
+	Rules   []FaultRule `yaml:"rules"`
+}
+
+type FaultRule struct {
+	Target    string  `yaml:"target"`
+	Operation string  `yaml:"operation"`
+	Table     string  `yaml:"table"`
+	LatencyMS int     `yaml:"latency_ms"`
+	ErrorRate float64 `yaml:"error_rate"`
+	Limit     int     `yaml:"limit"`
 }
 
 type LocaleConfig struct {
@@ -25,16 +50,51 @@ type LocaleConfig struct {
 }
 
 type ServerConfig struct {
-	HTTP ServerInstanceConfig `yaml:"http"`
-	GRPC ServerInstanceConfig `yaml:"grpc"`
+	HTTP        ServerInstanceConfig `yaml:"http"`
+	GRPC        ServerInstanceConfig `yaml:"grpc"`
+	Maintenance MaintenanceConfig    `yaml:"maintenance"`
+	Restart     RestartConfig        `yaml:"restart"`
+	Replica     ReplicaConfig        `yaml:"replica"`
+	Debug       DebugConfig          `yaml:"debug"`
+}
+
+type ReplicaConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	PrimaryURL string `yaml:"primary_url"` // where clients are sent for writes and logins
+}
+
+// DebugConfig exposes runtime diagnostics and pprof profiles to holders of
+// the system.manage permission
+type DebugConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type RestartConfig struct {
+	ReusePort           bool `yaml:"reuse_port"`
+	DrainTimeoutSeconds int  `yaml:"drain_timeout_seconds"`
+}
+
+type MaintenanceConfig struct {
+	Mode    string `yaml:"mode"`
+	Message string `yaml:"message"`
 }
 
 type ServerInstanceConfig struct {
-	Enabled          bool            `yaml:"enabled"`
-	Port             string          `yaml:"port"`
-	ProtocolVersions []string        `yaml:"protocol_versions"`
-	TLS              TLSConfig       `yaml:"tls"`
-	RateLimit        RateLimitConfig `yaml:"ratelimit"`
+	Enabled          bool             `yaml:"enabled"`
+	Port             string           `yaml:"port"`
+	ProtocolVersions []string         `yaml:"protocol_versions"`
+	TLS              TLSConfig        `yaml:"tls"`
+	RateLimit        RateLimitConfig  `yaml:"ratelimit"`
+	BodyLimits       BodyLimitsConfig `yaml:"body_limits"`
+}
+
+// BodyLimitsConfig bounds request bodies per group of endpoints; zero
+// keeps the built-in limit
+type BodyLimitsConfig struct {
+	DefaultKB int `yaml:"default_kb"`
+	SecretsKB int `yaml:"secrets_kb"`
+	SharesKB  int `yaml:"shares_kb"`
+	UsersKB   int `yaml:"users_kb"`
 }
 
 type TLSConfig struct {
@@ -53,6 +113,17 @@ type RateLimitConfig struct {
 type StorageConfig struct {
 	Database   DatabaseConfig   `yaml:"database"`
 	Encryption EncryptionConfig `yaml:"encryption"`
+	Audit      AuditConfig      `yaml:"audit"`
+}
+
+// AuditConfig moves audit writes off the request path: events wait in a
+// bounded queue and are inserted in batches by a background writer
+type AuditConfig struct {
+	Async           bool   `yaml:"async"`
+	QueueSize       int    `yaml:"queue_size"`        // events waiting to be written, default 10000
+	BatchSize       int    `yaml:"batch_size"`        // events per insert, default 100
+	FlushIntervalMS int    `yaml:"flush_interval_ms"` // longest wait before a partial batch is written, default 200
+	WhenFull        string `yaml:"when_full"`         // block (default) or drop
 }
 
 type DatabaseConfig struct {
@@ -66,11 +137,73 @@ type EncryptionConfig struct {
 	UseKEK  bool   `yaml:"use_kek"`
 	KEKPath string `yaml:"kek_path"`
 	DEKPath string `yaml:"dek_path"`
+	// EncryptPII also encrypts user emails and the IP addresses and user
+	// agents of sessions
+	EncryptPII bool `yaml:"encrypt_pii"`
 }
 
 type SecretsConfig struct {
-	Chunking ChunkingConfig `yaml:"chunking"`
-	Limits   LimitsConfig   `yaml:"limits"`
+	Chunking    ChunkingConfig    `yaml:"chunking"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Compression CompressionConfig `yaml:"compression"`
+	// BurnAfterRead deletes a max-reads secret once its last read is used
+	BurnAfterRead bool              `yaml:"burn_after_read"`
+	Lifecycle     LifecycleConfig   `yaml:"lifecycle"`
+	Stale         StaleConfig       `yaml:"stale"`
+	Releases      ReleasesConfig    `yaml:"releases"`
+	GitOps        GitOpsConfig      `yaml:"gitops"`
+	Names         SecretNamesConfig `yaml:"names"`
+	Naming        NamingConfig      `yaml:"naming"`
+}
+
+type NamingConfig struct {
+	Rules []NamingRuleConfig `yaml:"rules"`
+}
+
+type NamingRuleConfig struct {
+	NamespaceID uint   `yaml:"namespace_id"` // 0 applies to every namespace
+	Type        string `yaml:"type"`         // empty applies to every type
+	Prefix      string `yaml:"prefix"`
+	Pattern     string `yaml:"pattern"`
+	Description string `yaml:"description"`
+}
+
+type SecretNamesConfig struct {
+	CaseInsensitive bool `yaml:"case_insensitive"`
+	AliasDays       int  `yaml:"alias_days"`
+}
+
+type LifecycleConfig struct {
+	Enabled          bool       `yaml:"enabled"`
+	IntervalSeconds  int        `yaml:"interval_seconds"`
+	NotifyDaysBefore int        `yaml:"notify_days_before"`
+	GraceDays        int        `yaml:"grace_days"` // 0 keeps expired secrets
+	SMTP             SMTPConfig `yaml:"smtp"`
+}
+
+type StaleConfig struct {
+	Enabled          bool       `yaml:"enabled"`
+	IntervalSeconds  int        `yaml:"interval_seconds"`
+	Days             int        `yaml:"days"`               // unused this long counts as stale
+	ArchiveAfterDays int        `yaml:"archive_after_days"` // 0 never archives
+	SMTP             SMTPConfig `yaml:"smtp"`
+}
+
+type ReleasesConfig struct {
+	Enabled          bool       `yaml:"enabled"`
+	IntervalSeconds  int        `yaml:"interval_seconds"`
+	NotifyDaysBefore int        `yaml:"notify_days_before"` // warn the owner this long before a release
+	SMTP             SMTPConfig `yaml:"smtp"`
+}
+
+type GitOpsConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	Repository         string `yaml:"repository"` // URL or local path of the Git repository
+	Branch             string `yaml:"branch"`
+	Path               string `yaml:"path"` // manifest file in the repository
+	IntervalSeconds    int    `yaml:"interval_seconds"`
+	CreatePlaceholders bool   `yaml:"create_placeholders"` // create missing secrets, awaiting their values
 }
 
 type ChunkingConfig struct {
@@ -83,6 +216,18 @@ type LimitsConfig struct {
 	MaxSecretsPerUser int `yaml:"max_secrets_per_user"`
 }
 
+type CacheConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	TTLSeconds  int  `yaml:"ttl_seconds"`
+	MaxEntries  int  `yaml:"max_entries"`
+	SkipLimited bool `yaml:"skip_limited"`
+}
+
+type CompressionConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	ThresholdBytes int  `yaml:"threshold_bytes"`
+}
+
 type TelemetryConfig struct {
 	Enabled  bool   `yaml:"enabled"`
 	Endpoint string `yaml:"endpoint"`
@@ -91,9 +236,166 @@ type TelemetryConfig struct {
 }
 
 type SecurityConfig struct {
-	EnableFilePermissionCheck  bool `yaml:"enable_file_permission_check"`
-	AutoFixFilePermissions     bool `yaml:"auto_fix_file_permissions"`
-	AllowUnsafeFilePermissions bool `yaml:"allow_unsafe_file_permissions"`
+	EnableFilePermissionCheck  bool                `yaml:"enable_file_permission_check"`
+	AutoFixFilePermissions     bool                `yaml:"auto_fix_file_permissions"`
+	AllowUnsafeFilePermissions bool                `yaml:"allow_unsafe_file_permissions"`
+	FIPSMode                   bool                `yaml:"fips_mode"`
+	Approvals                  ApprovalsConfig     `yaml:"approvals"`
+	Checkout                   CheckoutConfig      `yaml:"checkout"`
+	Escrow                     EscrowConfig        `yaml:"escrow"`
+	Canary                     CanaryConfig        `yaml:"canary"`
+	NetworkPolicy              NetworkPolicyConfig `yaml:"network_policy"`
+	FileAudit                  FileAuditConfig     `yaml:"file_audit"`
+}
+
+type FileAuditConfig struct {
+	IntervalSeconds int    `yaml:"interval_seconds"`
+	WebhookURL      string `yaml:"webhook_url"`
+	TimeoutSeconds  int    `yaml:"timeout_seconds"`
+}
+
+type NetworkPolicyConfig struct {
+	Clients    []ClientNetworkConfig    `yaml:"clients"`
+	Namespaces []NamespaceNetworkConfig `yaml:"namespaces"`
+}
+
+type ClientNetworkConfig struct {
+	Username string   `yaml:"username"`
+	Allow    []string `yaml:"allow"`
+	Deny     []string `yaml:"deny"`
+}
+
+type NamespaceNetworkConfig struct {
+	NamespaceID uint     `yaml:"namespace_id"`
+	Allow       []string `yaml:"allow"`
+	Deny        []string `yaml:"deny"`
+}
+
+type CanaryConfig struct {
+	WebhookURL     string `yaml:"webhook_url"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+}
+
+type ApprovalsConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Tags          []string `yaml:"tags"`
+	Admins        []string `yaml:"admins"`
+	WindowMinutes int      `yaml:"window_minutes"`
+}
+
+type CheckoutConfig struct {
+	Enabled         bool     `yaml:"enabled"`
+	Tags            []string `yaml:"tags"`
+	LeaseMinutes    int      `yaml:"lease_minutes"`
+	MaxLeaseMinutes int      `yaml:"max_lease_minutes"`
+	RotateOnCheckin bool     `yaml:"rotate_on_checkin"`
+}
+
+type EscrowConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	RecoveryHours int  `yaml:"recovery_hours"` // custodians must approve a recovery within this window
+}
+
+type AuthConfig struct {
+	OIDC          OIDCConfig          `yaml:"oidc"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	TwoFactor     TwoFactorConfig     `yaml:"two_factor"`
+	WebAuthn      WebAuthnConfig      `yaml:"webauthn"`
+	Devices       DevicesConfig       `yaml:"devices"`
+	Impersonation ImpersonationConfig `yaml:"impersonation"`
+}
+
+type ImpersonationConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxMinutes int  `yaml:"max_minutes"`
+}
+
+type DevicesConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	CertificateDays int  `yaml:"certificate_days"`
+}
+
+type WebAuthnConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	RPID     string   `yaml:"rp_id"`
+	RPName   string   `yaml:"rp_name"`
+	Origins  []string `yaml:"origins"`
+	Required string   `yaml:"required"` // none, admins or all
+}
+
+type TwoFactorConfig struct {
+	Required         string `yaml:"required"` // none, admins or all
+	Issuer           string `yaml:"issuer"`
+	ElevationMinutes int    `yaml:"elevation_minutes"`
+}
+
+type PasswordResetConfig struct {
+	Enabled            bool       `yaml:"enabled"`
+	URL                string     `yaml:"url"`
+	TokenTTLMinutes    int        `yaml:"token_ttl_minutes"`
+	MaxRequestsPerHour int        `yaml:"max_requests_per_hour"`
+	SMTP               SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type OIDCConfig struct {
+	Enabled           bool                 `yaml:"enabled"`
+	Audience          string               `yaml:"audience"`
+	DefaultTTLSeconds int                  `yaml:"default_ttl_seconds"`
+	Providers         []OIDCProviderConfig `yaml:"providers"`
+	Policies          []OIDCPolicyConfig   `yaml:"policies"`
+}
+
+type OIDCProviderConfig struct {
+	Name    string `yaml:"name"`
+	Issuer  string `yaml:"issuer"`
+	JWKSURL string `yaml:"jwks_url"`
+}
+
+type OIDCPolicyConfig struct {
+	Name          string            `yaml:"name"`
+	Provider      string            `yaml:"provider"`
+	Claims        map[string]string `yaml:"claims"`
+	Username      string            `yaml:"username"`
+	NamespaceID   uint              `yaml:"namespace_id"`
+	EnvironmentID uint              `yaml:"environment_id"`
+	ReadOnly      bool              `yaml:"read_only"`
+	TTLSeconds    int               `yaml:"ttl_seconds"`
+}
+
+type EnvConfig struct {
+	Profiles map[string]EnvProfileConfig `yaml:"profiles"`
+}
+
+type EnvProfileConfig struct {
+	Prefix        string            `yaml:"prefix"`
+	NamespaceID   uint              `yaml:"namespace_id"`
+	ZoneID        uint              `yaml:"zone_id"`
+	EnvironmentID uint              `yaml:"environment_id"`
+	Secrets       map[string]string `yaml:"secrets"`
+}
+
+type AgentConfig struct {
+	Listen                string   `yaml:"listen"`
+	AllowedExtensions     []string `yaml:"allowed_extensions"`
+	ConfirmTimeoutSeconds int      `yaml:"confirm_timeout_seconds"`
+}
+
+type CLIConfig struct {
+	TokenStore            string `yaml:"token_store"`
+	ClipboardClearSeconds int    `yaml:"clipboard_clear_seconds"`
+}
+
+type CSIConfig struct {
+	Socket            string   `yaml:"socket"`
+	AllowedNamespaces []string `yaml:"allowed_namespaces"`
 }
 
 type SoftDeleteConfig struct {
@@ -106,6 +408,40 @@ type PurgeConfig struct {
 	Schedule string `yaml:"schedule"`
 }
 
+type NotificationsConfig struct {
+	Enabled        bool                                 `yaml:"enabled"`
+	TimeoutSeconds int                                  `yaml:"timeout_seconds"`
+	Channels       map[string]NotificationChannelConfig `yaml:"channels"`
+	Routes         []NotificationRouteConfig            `yaml:"routes"`
+}
+
+type NotificationChannelConfig struct {
+	Type       string     `yaml:"type"`        // email, slack, teams or pagerduty
+	WebhookURL string     `yaml:"webhook_url"` // slack and teams
+	RoutingKey string     `yaml:"routing_key"` // pagerduty
+	URL        string     `yaml:"url"`         // pagerduty Events API, for proxies
+	To         []string   `yaml:"to"`          // email
+	SMTP       SMTPConfig `yaml:"smtp"`        // email
+}
+
+type NotificationRouteConfig struct {
+	Events     []string `yaml:"events"`     // event types or groups; empty matches every event
+	Namespaces []uint   `yaml:"namespaces"` // empty matches every namespace
+	Channels   []string `yaml:"channels"`
+}
+
+type EnginesConfig struct {
+	Enabled        bool                          `yaml:"enabled"`
+	Dir            string                        `yaml:"dir"`
+	TimeoutSeconds int                           `yaml:"timeout_seconds"`
+	Plugins        map[string]EnginePluginConfig `yaml:"plugins"`
+}
+
+type EnginePluginConfig struct {
+	Users  []string          `yaml:"users"`  // besides holders of system.manage
+	Config map[string]string `yaml:"config"` // sent to this plugin only
+}
+
 const appRootDir = "."
 
 // Load загружает YAML-конфигурацию из файла.
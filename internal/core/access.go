@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Access levels in an access report
+const (
+	AccessRead    = "read"
+	AccessWrite   = "write"
+	AccessApprove = "approve"
+)
+
+// Sources of access in an access report
+const (
+	// AccessSourceLogin is the full access of every user who can log in with
+	// a password; such sessions are not scoped
+	AccessSourceLogin = "login"
+	// AccessSourceOwner marks the owner of the secret, by default the user
+	// who created it
+	AccessSourceOwner = "owner"
+	// AccessSourceOIDCPolicy is access through an auth.oidc policy acting as
+	// the user, limited to the policy's scope
+	AccessSourceOIDCPolicy = "oidc_policy"
+	// AccessSourceAPIClient is access through an API client of the user
+	AccessSourceAPIClient = "api_client"
+	// AccessSourceDevice is access through an enrolled device acting as the
+	// user
+	AccessSourceDevice = "device"
+	// AccessSourceApprover is an approvals admin who can approve deleting a
+	// protected secret
+	AccessSourceApprover = "approver"
+	// AccessSourceGrant is a grant on the secret or one of its folders. Once
+	// grants decide access, the other sources are limited to their level.
+	AccessSourceGrant = "grant"
+)
+
+// AccessGrant is one row of an access report: a user's level on a secret
+// and where it comes from. A user with several sources has several rows.
+type AccessGrant struct {
+	SecretID   uint   `json:"secret_id"`
+	SecretName string `json:"secret_name"`
+	Username   string `json:"username"`
+	Level      string `json:"level"`
+	Source     string `json:"source"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// SecretAccess reports every user with access to a secret, ordered by
+// username
+func (c *SecretlyCore) SecretAccess(ctx context.Context, secretID uint) ([]AccessGrant, error) {
+	if err := c.requirePermission(ctx, PermissionAccessReport, "access reports"); err != nil {
+		return nil, err
+	}
+	secret, err := c.GetSecret(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+	users, err := c.storage.Users().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	b := c.preloadPermissions([]models.SecretNode{*secret})
+	b.addUsers(users)
+	var grants []AccessGrant
+	for i := range users {
+		grants = append(grants, c.accessGrants(b, secret, &users[i])...)
+	}
+	return grants, nil
+}
+
+// UserAccess reports every secret a user can access and why, ordered by
+// secret ID
+func (c *SecretlyCore) UserAccess(ctx context.Context, username string) ([]AccessGrant, error) {
+	if err := c.requirePermission(ctx, PermissionAccessReport, "access reports"); err != nil {
+		return nil, err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %q: %w", username, err)
+	}
+
+	var grants []AccessGrant
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return nil, err
+		}
+		b := c.preloadPermissions(secrets)
+		b.addUsers([]models.User{*user})
+		for i := range secrets {
+			grants = append(grants, c.accessGrants(b, &secrets[i], user)...)
+		}
+		if next == "" {
+			return grants, nil
+		}
+		cursor = next
+	}
+}
+
+// accessGrants resolves how user can access secret. Keep in line with
+// AuthorizeSecret and the approval rules.
+func (c *SecretlyCore) accessGrants(b *permissionBatch, secret *models.SecretNode, user *models.User) []AccessGrant {
+	// Grants on the secret or its folders cap every source but ownership
+	ceiling := AccessWrite
+	explanation, err := b.explain(secret, user.ID)
+	if err == nil && explanation.Source == AccessSourceGrant {
+		ceiling = explanation.Level
+	}
+
+	var grants []AccessGrant
+	grant := func(level, source, detail string) {
+		if source != AccessSourceOwner && source != AccessSourceApprover {
+			if ceiling == AccessNone {
+				return
+			}
+			if ceiling == AccessRead && level == AccessWrite {
+				level = AccessRead
+			}
+		}
+		grants = append(grants, AccessGrant{
+			SecretID:   secret.ID,
+			SecretName: secret.Name,
+			Username:   user.Username,
+			Level:      level,
+			Source:     source,
+			Detail:     detail,
+		})
+	}
+
+	if owner := SecretOwner(secret); owner != "" && owner == user.Username {
+		detail := "created the secret"
+		if secret.Owner != "" && secret.Owner != secret.CreatedBy {
+			detail = "ownership transferred"
+		}
+		grant(AccessWrite, AccessSourceOwner, detail)
+	}
+	if err == nil && explanation.Source == AccessSourceGrant && ceiling != AccessNone {
+		detail := "granted on the secret"
+		if explanation.Inherited {
+			detail = fmt.Sprintf("granted on folder %q", explanation.NodeName)
+		}
+		grant(ceiling, AccessSourceGrant, detail)
+	}
+	if user.PasswordHash != "" {
+		grant(AccessWrite, AccessSourceLogin, "password sessions are not scoped")
+	}
+	if c.federation != nil {
+		for i := range c.federation.policies {
+			policy := &c.federation.policies[i]
+			if policy.Username != user.Username {
+				continue
+			}
+			session := &models.Session{Scope: policy.Name}
+			if c.checkSessionScope(session, secret, false) != nil {
+				continue
+			}
+			level := AccessWrite
+			if policy.ReadOnly {
+				level = AccessRead
+			}
+			grant(level, AccessSourceOIDCPolicy, fmt.Sprintf("policy %q via provider %q", policy.Name, policy.Provider))
+		}
+	}
+	for _, client := range b.clientsOf(user.ID) {
+		session := &models.Session{Scope: clientScopePrefix + client.ClientID}
+		if !client.IsActive || (c.checkSessionScope(session, secret, false) != nil && c.checkSessionScope(session, secret, true) != nil) {
+			continue
+		}
+		level := AccessRead
+		if slices.Contains(ClientScopes(&client), ClientScopeWrite) {
+			level = AccessWrite
+		}
+		grant(level, AccessSourceAPIClient, fmt.Sprintf("client %q (%s)", client.Name, client.ClientID))
+	}
+	for _, dev := range b.allDevices() {
+		session := &models.Session{Scope: deviceScopePrefix + strconv.FormatUint(uint64(dev.ID), 10)}
+		if dev.UserID != user.ID || dev.RevokedAt != nil || c.checkSessionScope(session, secret, false) != nil {
+			continue
+		}
+		level := AccessWrite
+		if dev.ReadOnly {
+			level = AccessRead
+		}
+		grant(level, AccessSourceDevice, fmt.Sprintf("device %d %q", dev.ID, dev.Name))
+	}
+	if c.RequiresApproval(secret) && slices.Contains(c.approvals.admins, user.Username) {
+		grant(AccessApprove, AccessSourceApprover, "security.approvals admin")
+	}
+	return grants
+}
+
+// WriteAccessCSV writes an access report as CSV with a header row
+func WriteAccessCSV(w io.Writer, grants []AccessGrant) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"secret_id", "secret_name", "username", "level", "source", "detail"}); err != nil {
+		return err
+	}
+	for _, g := range grants {
+		row := []string{strconv.FormatUint(uint64(g.SecretID), 10), g.SecretName, g.Username, g.Level, g.Source, g.Detail}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Operations that need a second administrator's approval on protected
+// secrets
+const (
+	OperationDeleteSecret    = "delete_secret"
+	OperationTransferOwner   = "transfer_owner"
+	OperationGrantPermission = "grant_permission"
+	// OperationBurnSecret is requested on behalf of the reader when the
+	// last allowed read of a protected secret would burn it
+	OperationBurnSecret = "burn_secret"
+)
+
+// Pending operation statuses
+const (
+	OperationPending  = "pending"
+	OperationExecuted = "executed"
+	OperationRejected = "rejected"
+	OperationExpired  = "expired"
+	OperationFailed   = "failed"
+)
+
+// Audit event types for the approval workflow
+const (
+	EventOperationRequested = "operation_requested"
+	EventOperationApproved  = "operation_approved"
+	EventOperationRejected  = "operation_rejected"
+	EventOperationExpired   = "operation_expired"
+)
+
+var (
+	// ErrApprovalRequired is returned for destructive changes on a protected
+	// secret; request the operation with RequestOperation instead
+	ErrApprovalRequired = errors.New("operation requires approval by a second administrator")
+	// ErrOperationClosed is returned when deciding an operation that is no
+	// longer pending
+	ErrOperationClosed = errors.New("operation is no longer pending")
+)
+
+// approvalPolicy is the two-person rule configured with SetApprovals
+type approvalPolicy struct {
+	tags   []string
+	admins []string
+	window time.Duration
+}
+
+// SetApprovals enables the two-person rule: deleting, transferring or
+// granting access to a secret tagged with one of cfg.Tags creates a pending
+// operation that another administrator must approve within the window
+func (c *SecretlyCore) SetApprovals(cfg config.ApprovalsConfig) {
+	if !cfg.Enabled {
+		c.approvals = nil
+		return
+	}
+	tags := cfg.Tags
+	if len(tags) == 0 {
+		tags = []string{"critical"}
+	}
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	c.approvals = &approvalPolicy{tags: tags, admins: cfg.Admins, window: window}
+}
+
+// RequiresApproval reports whether destructive changes to secret need a
+// second administrator
+func (c *SecretlyCore) RequiresApproval(secret *models.SecretNode) bool {
+	if c.approvals == nil {
+		return false
+	}
+	for _, tag := range SecretTags(secret) {
+		if slices.Contains(c.approvals.tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretTags reads metadata "tags", stored either as a list of names or,
+// by importers, as a map whose keys are the names
+func SecretTags(secret *models.SecretNode) []string {
+	if len(secret.Metadata) == 0 {
+		return nil
+	}
+	var meta struct {
+		Tags json.RawMessage `json:"tags"`
+	}
+	if err := json.Unmarshal(secret.Metadata, &meta); err != nil || len(meta.Tags) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(meta.Tags, &list); err == nil {
+		return list
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(meta.Tags, &m); err == nil {
+		tags := make([]string, 0, len(m))
+		for tag := range m {
+			tags = append(tags, tag)
+		}
+		return tags
+	}
+	return nil
+}
+
+// RequestOperation records a pending deletion of a protected secret. A
+// still-pending request for the same operation is returned instead of
+// creating a second one. Transfers and grants are requested with
+// RequestTransfer and RequestGrant.
+func (c *SecretlyCore) RequestOperation(ctx context.Context, kind string, secretID uint, requestedBy string) (*models.PendingOperation, error) {
+	if kind != OperationDeleteSecret {
+		return nil, fmt.Errorf("unknown operation %q", kind)
+	}
+	return c.requestOperation(ctx, &models.PendingOperation{Kind: kind, SecretNodeID: secretID, RequestedBy: requestedBy})
+}
+
+// RequestTransfer records a pending transfer of a protected secret to the
+// user named to
+func (c *SecretlyCore) RequestTransfer(ctx context.Context, secretID uint, to, requestedBy string) (*models.PendingOperation, error) {
+	if _, err := c.storage.Users().FindByUsername(to); err != nil {
+		return nil, fmt.Errorf("new owner %q: %w", to, err)
+	}
+	return c.requestOperation(ctx, &models.PendingOperation{Kind: OperationTransferOwner, SecretNodeID: secretID, Target: to, RequestedBy: requestedBy})
+}
+
+// RequestGrant records a pending grant of level access to a protected
+// secret
+func (c *SecretlyCore) RequestGrant(ctx context.Context, secretID uint, username, level, requestedBy string) (*models.PendingOperation, error) {
+	if level != AccessRead && level != AccessWrite {
+		return nil, fmt.Errorf("grant level must be %q or %q", AccessRead, AccessWrite)
+	}
+	if _, err := c.storage.Users().FindByUsername(username); err != nil {
+		return nil, fmt.Errorf("user %q: %w", username, err)
+	}
+	return c.requestOperation(ctx, &models.PendingOperation{Kind: OperationGrantPermission, SecretNodeID: secretID, Target: username,
+		Level: level, RequestedBy: requestedBy})
+}
+
+func (c *SecretlyCore) requestOperation(ctx context.Context, req *models.PendingOperation) (*models.PendingOperation, error) {
+	if c.approvals == nil {
+		return nil, fmt.Errorf("approvals are not enabled")
+	}
+	secret, err := c.GetSecret(ctx, req.SecretNodeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.checkState(ctx, c.storage, req.SecretNodeID); err != nil {
+		return nil, err
+	}
+	return c.createOperation(ctx, secret, req)
+}
+
+// createOperation stores req unless the same operation is already pending
+func (c *SecretlyCore) createOperation(ctx context.Context, secret *models.SecretNode, req *models.PendingOperation) (*models.PendingOperation, error) {
+	pending, err := c.ListOperations(ctx, OperationPending)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		op := &pending[i]
+		if op.Kind == req.Kind && op.SecretNodeID == req.SecretNodeID && op.Target == req.Target && op.Level == req.Level {
+			return op, nil
+		}
+	}
+
+	req.Status = OperationPending
+	req.ExpiresAt = time.Now().Add(c.approvals.window).UTC()
+	if err := c.storage.Operations().Create(req); err != nil {
+		return nil, fmt.Errorf("failed to create pending operation: %w", err)
+	}
+	c.recordEvent(ctx, EventOperationRequested, &secret.ID, fmt.Sprintf("Operation %d (%s of secret %q) requested by %s, expires %s",
+		req.ID, req.Kind, secret.Name, req.RequestedBy, req.ExpiresAt.Format(time.RFC3339)))
+	return req, nil
+}
+
+// GetOperation returns a pending or decided operation
+func (c *SecretlyCore) GetOperation(ctx context.Context, id uint) (*models.PendingOperation, error) {
+	op, err := c.storage.Operations().GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation %d: %w", id, err)
+	}
+	c.expireIfDue(ctx, op)
+	return op, nil
+}
+
+// ListOperations returns operations with status, or all when status is
+// empty. Pending operations past their window are marked expired first.
+func (c *SecretlyCore) ListOperations(ctx context.Context, status string) ([]models.PendingOperation, error) {
+	pending, err := c.storage.Operations().List(OperationPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	for i := range pending {
+		c.expireIfDue(ctx, &pending[i])
+	}
+	ops, err := c.storage.Operations().List(status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	return ops, nil
+}
+
+// ApproveOperation executes a pending operation on behalf of approver, who
+// must be a configured administrator other than the requester
+func (c *SecretlyCore) ApproveOperation(ctx context.Context, id uint, approver string) (*models.PendingOperation, error) {
+	op, err := c.openOperation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(c.approvals.admins, approver) {
+		return nil, fmt.Errorf("%s is not an approver: %w", approver, ErrPermissionDenied)
+	}
+	if approver == op.RequestedBy {
+		return nil, fmt.Errorf("operations must be approved by someone other than the requester: %w", ErrPermissionDenied)
+	}
+
+	// Claim the operation before executing it, so that concurrent
+	// approvals execute it once
+	now := time.Now().UTC()
+	op.Status, op.DecidedBy, op.DecidedAt = OperationExecuted, approver, &now
+	if err := c.decideOperation(op); err != nil {
+		return nil, err
+	}
+
+	// The approval authorizes the operation
+	var execErr error
+	switch op.Kind {
+	case OperationDeleteSecret, OperationBurnSecret:
+		execErr = c.deleteSecret(ctx, op.SecretNodeID)
+	case OperationTransferOwner:
+		_, execErr = c.transferOwnership(ctx, op.SecretNodeID, op.Target, op.RequestedBy)
+	case OperationGrantPermission:
+		_, execErr = c.grantPermission(ctx, op.SecretNodeID, op.Target, op.Level, op.RequestedBy)
+	default:
+		execErr = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	if execErr != nil {
+		op.Status, op.Reason = OperationFailed, execErr.Error()
+		if err := c.storage.Operations().Update(op); err != nil {
+			return nil, fmt.Errorf("failed to update operation %d: %w", id, err)
+		}
+	}
+
+	description := fmt.Sprintf("Operation %d (%s) requested by %s approved by %s", op.ID, op.Kind, op.RequestedBy, approver)
+	if execErr != nil {
+		description += ", execution failed: " + execErr.Error()
+	}
+	c.recordEvent(ctx, EventOperationApproved, &op.SecretNodeID, description)
+	return op, execErr
+}
+
+// RejectOperation closes a pending operation without executing it. Any
+// administrator may reject; the requester may withdraw their own request.
+func (c *SecretlyCore) RejectOperation(ctx context.Context, id uint, by, reason string) (*models.PendingOperation, error) {
+	op, err := c.openOperation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if by != op.RequestedBy && !slices.Contains(c.approvals.admins, by) {
+		return nil, fmt.Errorf("%s may not reject operation %d: %w", by, id, ErrPermissionDenied)
+	}
+
+	now := time.Now().UTC()
+	op.Status, op.DecidedBy, op.DecidedAt, op.Reason = OperationRejected, by, &now, reason
+	if err := c.decideOperation(op); err != nil {
+		return nil, err
+	}
+	c.recordEvent(ctx, EventOperationRejected, &op.SecretNodeID, fmt.Sprintf("Operation %d (%s) requested by %s rejected by %s: %s",
+		op.ID, op.Kind, op.RequestedBy, by, reason))
+	return op, nil
+}
+
+// openOperation returns an operation that can still be decided
+func (c *SecretlyCore) openOperation(ctx context.Context, id uint) (*models.PendingOperation, error) {
+	if c.approvals == nil {
+		return nil, fmt.Errorf("approvals are not enabled")
+	}
+	op, err := c.GetOperation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if op.Status != OperationPending {
+		return nil, fmt.Errorf("operation %d is %s: %w", id, op.Status, ErrOperationClosed)
+	}
+	return op, nil
+}
+
+// decideOperation stores the decision on op if it is still pending, and
+// returns ErrOperationClosed when another decision was stored first
+func (c *SecretlyCore) decideOperation(op *models.PendingOperation) error {
+	decided, err := c.storage.Operations().UpdateIfPending(op)
+	if err != nil {
+		return fmt.Errorf("failed to update operation %d: %w", op.ID, err)
+	}
+	if !decided {
+		return fmt.Errorf("operation %d was decided concurrently: %w", op.ID, ErrOperationClosed)
+	}
+	return nil
+}
+
+// expireIfDue marks a pending operation past its window as expired
+func (c *SecretlyCore) expireIfDue(ctx context.Context, op *models.PendingOperation) {
+	if op.Status != OperationPending || time.Now().Before(op.ExpiresAt) {
+		return
+	}
+	op.Status = OperationExpired
+	if decided, err := c.storage.Operations().UpdateIfPending(op); err != nil || !decided {
+		// Still treated as closed; the next call retries the update or
+		// reads the decision stored concurrently
+		return
+	}
+	c.recordEvent(ctx, EventOperationExpired, &op.SecretNodeID, fmt.Sprintf("Operation %d (%s) requested by %s expired without approval",
+		op.ID, op.Kind, op.RequestedBy))
+}
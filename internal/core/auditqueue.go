@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Defaults of storage.audit
+const (
+	DefaultAuditQueueSize     = 10000
+	DefaultAuditBatchSize     = 100
+	DefaultAuditFlushInterval = 200 * time.Millisecond
+)
+
+// What the audit queue does with events that do not fit, storage.audit.when_full
+const (
+	AuditWhenFullBlock = "block"
+	AuditWhenFullDrop  = "drop"
+)
+
+// auditQueue writes audit events in batches from a background goroutine,
+// so that recording an event costs a channel send instead of an insert.
+// Events are published to subscribers once written, with their IDs.
+type auditQueue struct {
+	events   chan *models.AuditEvent
+	flushes  chan chan struct{}
+	done     chan struct{}
+	batch    int
+	interval time.Duration
+	drop     bool
+
+	// mu keeps events from being queued once close has started; they are
+	// then written directly
+	mu     sync.RWMutex
+	closed bool
+
+	written atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// AuditQueueStats describes the background audit writer. Depth is the
+// number of events waiting to be written; Dropped counts the events lost
+// to a full queue with when_full "drop" and Failed those the database
+// refused.
+type AuditQueueStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Written  int64 `json:"written"`
+	Dropped  int64 `json:"dropped"`
+	Failed   int64 `json:"failed"`
+}
+
+// SetAuditQueue starts writing audit events in the background when
+// cfg.Async is set. Events stored in a transaction with the change they
+// record, such as secret_created, are still written with it. Call
+// CloseAudit before closing the storage to write the queued events.
+func (c *SecretlyCore) SetAuditQueue(cfg config.AuditConfig) error {
+	if !cfg.Async || c.replica {
+		return nil
+	}
+	whenFull := cfg.WhenFull
+	if whenFull == "" {
+		whenFull = AuditWhenFullBlock
+	}
+	if whenFull != AuditWhenFullBlock && whenFull != AuditWhenFullDrop {
+		return fmt.Errorf("storage.audit.when_full %q: use %s or %s", cfg.WhenFull, AuditWhenFullBlock, AuditWhenFullDrop)
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = DefaultAuditQueueSize
+	}
+	batch := cfg.BatchSize
+	if batch <= 0 {
+		batch = DefaultAuditBatchSize
+	}
+	interval := time.Duration(cfg.FlushIntervalMS) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultAuditFlushInterval
+	}
+	q := &auditQueue{
+		events:   make(chan *models.AuditEvent, size),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+		batch:    batch,
+		interval: interval,
+		drop:     whenFull == AuditWhenFullDrop,
+	}
+	c.audit = q
+	go c.runAuditQueue(q)
+	return nil
+}
+
+// AuditQueueStats reports on the background audit writer, and false when
+// audit events are written synchronously
+func (c *SecretlyCore) AuditQueueStats() (AuditQueueStats, bool) {
+	q := c.audit
+	if q == nil {
+		return AuditQueueStats{}, false
+	}
+	return AuditQueueStats{
+		Depth:    len(q.events),
+		Capacity: cap(q.events),
+		Written:  q.written.Load(),
+		Dropped:  q.dropped.Load(),
+		Failed:   q.failed.Load(),
+	}, true
+}
+
+// FlushAudit waits until the audit events recorded so far are written
+func (c *SecretlyCore) FlushAudit() {
+	q := c.audit
+	if q == nil {
+		return
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return
+	}
+	ack := make(chan struct{})
+	q.flushes <- ack
+	<-ack
+}
+
+// CloseAudit writes the queued audit events and stops the background
+// writer; events recorded afterwards are written synchronously
+func (c *SecretlyCore) CloseAudit() {
+	q := c.audit
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.events)
+	q.mu.Unlock()
+	<-q.done
+}
+
+// enqueue hands event to the writer and reports whether it took it. A
+// full queue blocks the caller, or drops the event with when_full "drop".
+func (q *auditQueue) enqueue(event *models.AuditEvent) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	if !q.drop {
+		q.events <- event
+		return true
+	}
+	select {
+	case q.events <- event:
+	default:
+		q.dropped.Add(1)
+		log.Printf("⚠️  Audit queue is full, dropped %s event: %s", event.EventType, event.Description)
+	}
+	return true
+}
+
+func (c *SecretlyCore) runAuditQueue(q *auditQueue) {
+	defer close(q.done)
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AuditEvent, 0, q.batch)
+	write := func() {
+		if len(batch) > 0 {
+			c.writeAuditBatch(q, batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case event, ok := <-q.events:
+			if !ok {
+				write()
+				return
+			}
+			if batch = append(batch, event); len(batch) >= q.batch {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case ack := <-q.flushes:
+			for n := len(q.events); n > 0; n-- {
+				if batch = append(batch, <-q.events); len(batch) >= q.batch {
+					write()
+				}
+			}
+			write()
+			close(ack)
+		}
+	}
+}
+
+// writeAuditBatch inserts batch in one transaction. When that fails, the
+// events are inserted one by one so that one bad event does not lose the
+// others.
+func (c *SecretlyCore) writeAuditBatch(q *auditQueue, batch []*models.AuditEvent) {
+	if err := c.storage.Audit().LogEvents(batch); err != nil {
+		for _, event := range batch {
+			event.ID = 0
+			if err := c.storage.Audit().LogEvent(event); err != nil {
+				q.failed.Add(1)
+				log.Printf("⚠️  Failed to record audit event %s: %v", event.EventType, err)
+				continue
+			}
+			q.written.Add(1)
+			c.publishEvent(event)
+		}
+		return
+	}
+	q.written.Add(int64(len(batch)))
+	for _, event := range batch {
+		c.publishEvent(event)
+	}
+}
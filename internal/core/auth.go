@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// EventAccessBypassed records a system actor using a secret without
+// permission checks
+const EventAccessBypassed = "access_bypassed"
+
+// ErrNoActor is returned by operations on secrets called without an actor
+// when no local actor is set
+var ErrNoActor = fmt.Errorf("%w: no authenticated actor", ErrPermissionDenied)
+
+// AuthContext is who a core operation acts for. The server attaches the
+// authenticated user and session with WithAuth; internal jobs act as the
+// system with WithSystemActor.
+type AuthContext struct {
+	User    *models.User
+	Session *models.Session
+	// System marks internal jobs, which are not subject to permissions;
+	// Reason names the job
+	System bool
+	Reason string
+
+	mu       sync.Mutex
+	bypassed map[uint]bool // secrets recorded by recordBypass
+}
+
+type authKey struct{}
+
+// WithAuth returns a context acting for user through session. The client
+// info in ctx is updated to name them, so audit events are attributed,
+// those of service account tokens labeled and those of impersonation
+// sessions stamped with the admin.
+func WithAuth(ctx context.Context, user *models.User, session *models.Session) context.Context {
+	client := ClientInfoFrom(ctx)
+	if user != nil {
+		client.Username = user.Username
+	}
+	client.SessionID, client.Subject = session.ID, session.Subject
+	client.ImpersonatorID = session.ImpersonatorID
+	if strings.HasPrefix(session.Scope, serviceScopePrefix) {
+		client.ActorKind = ActorServiceAccount
+	}
+	ctx = WithClientInfo(ctx, client)
+	return context.WithValue(ctx, authKey{}, &AuthContext{User: user, Session: session})
+}
+
+// WithSystemActor returns a context for an internal job, e.g. a sweep or
+// a migration, that may touch every secret
+func WithSystemActor(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, authKey{}, &AuthContext{System: true, Reason: reason})
+}
+
+// AuthFrom returns the actor attached with WithAuth or WithSystemActor, or
+// nil
+func AuthFrom(ctx context.Context) *AuthContext {
+	auth, _ := ctx.Value(authKey{}).(*AuthContext)
+	return auth
+}
+
+// SetLocalActor makes calls without an actor in the context act as the
+// system, for reason, instead of being denied. The command line, which has
+// the database anyway, sets it; the server leaves it empty.
+func (c *SecretlyCore) SetLocalActor(reason string) {
+	c.localActor = reason
+}
+
+// actor returns the actor in ctx, or the local actor for calls without one
+func (c *SecretlyCore) actor(ctx context.Context) (*AuthContext, error) {
+	if auth := AuthFrom(ctx); auth != nil {
+		return auth, nil
+	}
+	if c.localActor == "" {
+		return nil, ErrNoActor
+	}
+	return &AuthContext{System: true, Reason: c.localActor}, nil
+}
+
+// actorName names the actor in ctx for records that keep who created them:
+// the user, else the client or job
+func (c *SecretlyCore) actorName(ctx context.Context) string {
+	if auth, err := c.actor(ctx); err == nil && auth.User != nil {
+		return auth.User.Username
+	}
+	return c.rbacActor(ctx)
+}
+
+// actorSession returns the session operations in ctx are checked against,
+// nil for system actors
+func (c *SecretlyCore) actorSession(ctx context.Context) (*models.Session, error) {
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return auth.Session, nil
+}
+
+// recordBypass records a system actor reading the value of secret or
+// changing it, once per actor. Metadata reads are not recorded, nor are new
+// secrets, whose creation is.
+func (c *SecretlyCore) recordBypass(ctx context.Context, secret *models.SecretNode) {
+	auth, err := c.actor(ctx)
+	if err != nil || !auth.System || secret.ID == 0 {
+		return
+	}
+	auth.mu.Lock()
+	seen := auth.bypassed[secret.ID]
+	if !seen {
+		if auth.bypassed == nil {
+			auth.bypassed = make(map[uint]bool)
+		}
+		auth.bypassed[secret.ID] = true
+	}
+	auth.mu.Unlock()
+	if seen {
+		return
+	}
+	secretID := secret.ID
+	c.recordClientEvent(ctx, EventAccessBypassed, &secretID, fmt.Sprintf("System actor (%s) accessed secret %q without permission checks", auth.Reason, secret.Name))
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Purposes of the keys of the blind indexes
+const (
+	nameIndexPurpose  = "name-index"
+	emailIndexPurpose = "email-index"
+)
+
+// blindIndex returns the value under which normalized is stored and looked
+// up. With an encryptor that derives keys it is an HMAC keyed for purpose,
+// so that secrets and users can be found with an indexed query while the
+// index reveals neither names nor emails, which may then be encrypted
+// too. Without one they are stored in plaintext anyway and normalized is
+// used as it is. The keys follow the KEK: after a rotation the indexes are
+// rebuilt at the next start by IndexSecretNames and IndexUserEmails.
+func (c *SecretlyCore) blindIndex(purpose, normalized string) (string, error) {
+	deriver, ok := c.encryptor.(KeyDeriver)
+	if !ok {
+		return normalized, nil
+	}
+	key, err := deriver.DeriveKey(purpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive %s key: %w", purpose, err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// secretNameIndex returns the blind index of a secret name, under which it
+// must be unique in its scope
+func (c *SecretlyCore) secretNameIndex(name string) (string, error) {
+	return c.blindIndex(nameIndexPurpose, c.secretNameKey(name))
+}
+
+// secretByName returns the secret or folder holding name in a scope
+func (c *SecretlyCore) secretByName(namespaceID, zoneID, environmentID uint, name string) (*models.SecretNode, error) {
+	index, err := c.secretNameIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.storage.Secrets().FindByNameKey(namespaceID, zoneID, environmentID, index)
+}
+
+// NormalizeEmail trims email and converts it to lower case, so that
+// addresses differing only in case find the same user
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailIndex returns the blind index of email, "" for no email
+func (c *SecretlyCore) emailIndex(email string) (string, error) {
+	if email = NormalizeEmail(email); email == "" {
+		return "", nil
+	}
+	return c.blindIndex(emailIndexPurpose, email)
+}
+
+// GetUserByEmail returns the oldest user with email, ignoring case
+func (c *SecretlyCore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	index, err := c.emailIndex(email)
+	if err != nil {
+		return nil, err
+	}
+	if index == "" {
+		return nil, fmt.Errorf("user with email %q: %w", email, ErrNotFound)
+	}
+	user, err := c.storage.Users().FindByEmailIndex(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user with email %q: %w", email, err)
+	}
+	return user, nil
+}
+
+// IndexUserEmails brings the email indexes of existing users in line with
+// the current key, e.g. after an upgrade or a key rotation, and returns how
+// many it changed
+func (c *SecretlyCore) IndexUserEmails(ctx context.Context) (int, error) {
+	changed := 0
+	var afterID uint
+	for {
+		users, err := c.storage.Users().ListAfter(afterID, MaxCursorLimit)
+		if err != nil {
+			return changed, fmt.Errorf("failed to list users: %w", err)
+		}
+		if len(users) == 0 {
+			return changed, nil
+		}
+		for _, user := range users {
+			index, err := c.emailIndex(user.Email)
+			if err != nil {
+				return changed, err
+			}
+			if index == user.EmailIndex {
+				continue
+			}
+			if err := c.storage.Users().SetEmail(user.ID, user.Email, index); err != nil {
+				return changed, fmt.Errorf("failed to index user %q: %w", user.Username, err)
+			}
+			changed++
+		}
+		afterID = users[len(users)-1].ID
+	}
+}
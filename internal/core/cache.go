@@ -0,0 +1,180 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+const defaultCacheTTL = time.Minute
+
+// CacheStats reports value cache effectiveness
+type CacheStats struct {
+	Enabled   bool
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// HitRate returns the fraction of lookups served from the cache
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type cacheEntry struct {
+	name      string
+	value     []byte
+	versionID uint
+	limited   bool
+	expiresAt time.Time
+}
+
+// valueCache holds decrypted secret values for a short time to avoid
+// repeated storage reads and decryption for hot secrets
+type valueCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxEntries  int
+	skipLimited bool
+	entries     map[uint]*cacheEntry
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+}
+
+func newValueCache(cfg config.CacheConfig) *valueCache {
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &valueCache{
+		ttl:         ttl,
+		maxEntries:  cfg.MaxEntries,
+		skipLimited: cfg.SkipLimited,
+		entries:     make(map[uint]*cacheEntry),
+	}
+}
+
+// EnableValueCache turns on the in-process cache in front of GetSecretValue
+func (c *SecretlyCore) EnableValueCache(cfg config.CacheConfig) {
+	c.cache = newValueCache(cfg)
+}
+
+// InvalidateSecretCache drops the cached value of a secret
+func (c *SecretlyCore) InvalidateSecretCache(id uint) {
+	if c.cache != nil {
+		c.cache.invalidate(id)
+	}
+}
+
+// CacheStats returns value cache statistics
+func (c *SecretlyCore) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.stats()
+}
+
+func (vc *valueCache) get(id uint) (*cacheEntry, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	entry, ok := vc.entries[id]
+	if !ok {
+		vc.misses++
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		vc.remove(id)
+		vc.misses++
+		return nil, false
+	}
+	vc.hits++
+	return entry, true
+}
+
+// put caches a copy of value. The entry never outlives the secret's own expiration.
+func (vc *valueCache) put(secret *models.SecretNode, versionID uint, value []byte) {
+	limited := secret.MaxReads != nil
+	if limited && vc.skipLimited {
+		return
+	}
+
+	expiresAt := time.Now().Add(vc.ttl)
+	if secret.Expiration != nil && secret.Expiration.Before(expiresAt) {
+		expiresAt = *secret.Expiration
+	}
+	id := secret.ID
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if _, exists := vc.entries[id]; !exists && vc.maxEntries > 0 && len(vc.entries) >= vc.maxEntries {
+		vc.evictOldest()
+	}
+
+	stored := make([]byte, len(value))
+	copy(stored, value)
+	vc.entries[id] = &cacheEntry{
+		name:      secret.Name,
+		value:     stored,
+		versionID: versionID,
+		limited:   limited,
+		expiresAt: expiresAt,
+	}
+}
+
+func (vc *valueCache) invalidate(id uint) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.remove(id)
+}
+
+func (vc *valueCache) stats() CacheStats {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return CacheStats{
+		Enabled:   true,
+		Entries:   len(vc.entries),
+		Hits:      vc.hits,
+		Misses:    vc.misses,
+		Evictions: vc.evictions,
+	}
+}
+
+// evictOldest removes the entry closest to expiry; callers must hold mu
+func (vc *valueCache) evictOldest() {
+	var oldestID uint
+	var oldest time.Time
+	for id, entry := range vc.entries {
+		if oldest.IsZero() || entry.expiresAt.Before(oldest) {
+			oldestID, oldest = id, entry.expiresAt
+		}
+	}
+	if !oldest.IsZero() {
+		vc.remove(oldestID)
+		vc.evictions++
+	}
+}
+
+// remove deletes an entry and wipes its plaintext; callers must hold mu
+func (vc *valueCache) remove(id uint) {
+	if entry, ok := vc.entries[id]; ok {
+		wipe(entry.value)
+		delete(vc.entries, id)
+	}
+}
+
+// copyValue returns a copy so callers cannot modify cached plaintext
+func (e *cacheEntry) copyValue() []byte {
+	value := make([]byte, len(e.value))
+	copy(value, e.value)
+	return value
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// EventCanaryTriggered is recorded for every read of a canary secret
+const EventCanaryTriggered = "canary_triggered"
+
+const defaultCanaryTimeout = 10 * time.Second
+
+// canaryAlerts sends canary alerts configured with SetCanaryAlerts
+type canaryAlerts struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// SetCanaryAlerts configures where canary reads are reported besides the
+// log and the audit trail
+func (c *SecretlyCore) SetCanaryAlerts(cfg config.CanaryConfig) {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCanaryTimeout
+	}
+	c.canary = &canaryAlerts{webhookURL: cfg.WebhookURL, client: &http.Client{Timeout: timeout}}
+}
+
+// CanaryAlert describes one read of a canary secret
+type CanaryAlert struct {
+	Text       string    `json:"text"`
+	Event      string    `json:"event"`
+	Severity   string    `json:"severity"`
+	Time       time.Time `json:"time"`
+	SecretID   uint      `json:"secret_id"`
+	SecretName string    `json:"secret_name"`
+	Version    int       `json:"version"`
+	Access     string    `json:"access"`
+	Host       string    `json:"host"`
+	Username   string    `json:"username,omitempty"`
+	SessionID  uint      `json:"session_id,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// tripCanary raises the alert for a read of a canary secret. It never
+// fails the read: the reader must not learn that the secret is a canary.
+func (c *SecretlyCore) tripCanary(ctx context.Context, secret *models.SecretNode, version *models.SecretVersion, access string) {
+	client := ClientInfoFrom(ctx)
+	host, _ := os.Hostname()
+	alert := CanaryAlert{
+		Event:      EventCanaryTriggered,
+		Severity:   "critical",
+		Time:       time.Now().UTC(),
+		SecretID:   secret.ID,
+		SecretName: secret.Name,
+		Version:    version.VersionNumber,
+		Access:     access,
+		Host:       host,
+		Username:   client.Username,
+		SessionID:  client.SessionID,
+		Subject:    client.Subject,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+	}
+	requester := "local access on " + host
+	if client.Username != "" {
+		requester = fmt.Sprintf("user %q (session %d", client.Username, client.SessionID)
+		if client.Subject != "" {
+			requester += fmt.Sprintf(", subject %q", client.Subject)
+		}
+		requester += ") from " + describeClient(client.IPAddress, client.UserAgent)
+	}
+	alert.Text = fmt.Sprintf("🚨 Canary secret %q (id %d) was read: %s by %s", secret.Name, secret.ID, access, requester)
+
+	log.Print(alert.Text)
+	var userID *uint
+	if user, err := c.storage.Users().FindByUsername(client.Username); err == nil {
+		userID = &user.ID
+	}
+	c.recordUserEvent(ctx, EventCanaryTriggered, userID, &secret.ID, alert.Text)
+
+	if c.canary != nil && c.canary.webhookURL != "" {
+		go c.canary.send(alert)
+	}
+}
+
+func (a *canaryAlerts) send(alert CanaryAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode canary alert: %v", err)
+		return
+	}
+	resp, err := a.client.Post(a.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️  Failed to send canary alert for secret %d: %v", alert.SecretID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️  Canary webhook returned %d for secret %d", resp.StatusCode, alert.SecretID)
+	}
+}
+
+// decoyAlphabets are the character sets used when generating decoys
+const (
+	decoyUpperDigits = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	decoyAlnum       = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	decoyBase64      = decoyAlnum + "+/"
+	decoyPassword    = decoyAlnum + "!#%+-=?@_~"
+)
+
+// decoyTemplates generate realistic-looking credentials for canaries. Each
+// template returns the value to store.
+var decoyTemplates = map[string]func() (string, error){
+	"aws": func() (string, error) {
+		id, err := randomString(decoyUpperDigits, 16)
+		if err != nil {
+			return "", err
+		}
+		key, err := randomString(decoyBase64, 40)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("AWS_ACCESS_KEY_ID=AKIA%s\nAWS_SECRET_ACCESS_KEY=%s\n", id, key), nil
+	},
+	"github": func() (string, error) {
+		token, err := randomString(decoyAlnum, 36)
+		return "ghp_" + token, err
+	},
+	"stripe": func() (string, error) {
+		key, err := randomString(decoyAlnum, 24)
+		return "sk_live_" + key, err
+	},
+	"password": func() (string, error) {
+		return randomString(decoyPassword, 24)
+	},
+	"postgres": func() (string, error) {
+		password, err := randomString(decoyAlnum, 20)
+		return fmt.Sprintf("postgres://app:%s@db.internal:5432/app?sslmode=require", password), err
+	},
+}
+
+// DecoyKinds lists the templates accepted by GenerateDecoy
+func DecoyKinds() []string {
+	kinds := make([]string, 0, len(decoyTemplates))
+	for kind := range decoyTemplates {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// GenerateDecoy returns a fresh credential of the given kind that looks
+// real but grants nothing, to be stored as a canary's value
+func GenerateDecoy(kind string) ([]byte, error) {
+	generate, ok := decoyTemplates[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown decoy kind %q: use one of %s", kind, strings.Join(DecoyKinds(), ", "))
+	}
+	value, err := generate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate decoy: %w", err)
+	}
+	return []byte(value), nil
+}
+
+func randomString(alphabet string, n int) (string, error) {
+	out := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[idx.Int64()]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for the custody of break-glass secrets
+const (
+	EventSecretCheckedOut = "secret_checked_out"
+	EventSecretCheckedIn  = "secret_checked_in"
+)
+
+const (
+	// DefaultCheckoutLease applies when neither the user nor
+	// security.checkout.lease_minutes chooses how long a check-out lasts
+	DefaultCheckoutLease = time.Hour
+	// DefaultMaxCheckoutLease applies when security.checkout does not set
+	// max_lease_minutes
+	DefaultMaxCheckoutLease = 8 * time.Hour
+
+	// checkinBySystem closes leases that lapsed without a check-in
+	checkinBySystem      = "system"
+	rotatedValueAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!#%+-=_"
+	rotatedValueLength   = 32
+)
+
+var (
+	// ErrCheckoutRequired is returned when reading or changing a break-glass
+	// secret without holding its check-out
+	ErrCheckoutRequired = errors.New("secret must be checked out first")
+	// ErrCheckedOut is returned when another user holds the check-out
+	ErrCheckedOut = errors.New("secret is checked out by another user")
+)
+
+// checkoutPolicy is the check-out model configured with SetCheckout. mu
+// serializes check-outs and check-ins so a secret has one holder.
+type checkoutPolicy struct {
+	tags     []string
+	lease    time.Duration
+	maxLease time.Duration
+	rotate   bool
+
+	mu sync.Mutex
+}
+
+// SetCheckout makes secrets tagged with one of cfg.Tags exclusive: a user
+// checks one out before reading or changing it, and others are locked out
+// until it is checked in or the lease lapses. Holders of system.manage may
+// force a check-in.
+func (c *SecretlyCore) SetCheckout(cfg config.CheckoutConfig) {
+	if !cfg.Enabled {
+		c.checkout = nil
+		return
+	}
+	tags := cfg.Tags
+	if len(tags) == 0 {
+		tags = []string{"break-glass"}
+	}
+	maxLease := time.Duration(cfg.MaxLeaseMinutes) * time.Minute
+	if maxLease <= 0 {
+		maxLease = DefaultMaxCheckoutLease
+	}
+	lease := time.Duration(cfg.LeaseMinutes) * time.Minute
+	if lease <= 0 {
+		lease = min(DefaultCheckoutLease, maxLease)
+	}
+	c.checkout = &checkoutPolicy{tags: tags, lease: lease, maxLease: maxLease, rotate: cfg.RotateOnCheckin}
+}
+
+// RequiresCheckout reports whether secret must be checked out before it is
+// read or changed
+func (c *SecretlyCore) RequiresCheckout(secret *models.SecretNode) bool {
+	if c.checkout == nil {
+		return false
+	}
+	for _, tag := range SecretTags(secret) {
+		if slices.Contains(c.checkout.tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOutSecret gives username the exclusive use of a break-glass secret
+// for lease, or the configured default when lease is 0. A lease that lapsed
+// without a check-in is closed first, rotating the value if configured.
+func (c *SecretlyCore) CheckOutSecret(ctx context.Context, id uint, username string, lease time.Duration, reason string) (*models.SecretCheckout, error) {
+	secret, err := c.GetSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.RequiresCheckout(secret) {
+		return nil, fmt.Errorf("secret %q does not require check-out", secret.Name)
+	}
+	if err := c.checkRolePermission(ctx, secret, PermissionSecretsCheckout); err != nil {
+		return nil, err
+	}
+	p := c.checkout
+	if lease == 0 {
+		lease = p.lease
+	}
+	if lease < 0 || lease > p.maxLease {
+		return nil, fmt.Errorf("lease must be between 0 and %s", p.maxLease)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	active, err := c.activeCheckout(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil && active.Username == username {
+		return nil, fmt.Errorf("%w: you already hold secret %q until %s", ErrConflict, secret.Name, active.ExpiresAt.Format(time.RFC3339))
+	}
+	if active != nil {
+		return nil, fmt.Errorf("%w: %q holds secret %q until %s", ErrCheckedOut, active.Username, secret.Name, active.ExpiresAt.Format(time.RFC3339))
+	}
+
+	now := time.Now()
+	checkout := &models.SecretCheckout{
+		SecretNodeID: secret.ID,
+		Username:     username,
+		Reason:       reason,
+		CheckedOutAt: now,
+		ExpiresAt:    now.Add(lease),
+	}
+	if err := c.storage.Checkouts().Create(checkout); err != nil {
+		return nil, fmt.Errorf("failed to check out secret %d: %w", id, err)
+	}
+	c.InvalidateSecretCache(id)
+
+	desc := fmt.Sprintf("Secret %q checked out by %q until %s", secret.Name, username, checkout.ExpiresAt.Format(time.RFC3339))
+	if reason != "" {
+		desc += fmt.Sprintf(": %s", reason)
+	}
+	c.recordClientEvent(ctx, EventSecretCheckedOut, &secret.ID, desc)
+	return checkout, nil
+}
+
+// CheckInSecret ends the check-out of a break-glass secret. Only the holder
+// and holders of system.manage may check it in; the value is rotated if configured, so
+// the holder's copy stops working once the target system picks up the new
+// one.
+func (c *SecretlyCore) CheckInSecret(ctx context.Context, id uint, username string) (*models.SecretCheckout, error) {
+	secret, err := c.GetSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.RequiresCheckout(secret) {
+		return nil, fmt.Errorf("secret %q does not require check-out", secret.Name)
+	}
+	p := c.checkout
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	active, err := c.activeCheckout(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, fmt.Errorf("%w: secret %q is not checked out", ErrConflict, secret.Name)
+	}
+	if active.Username != username && !c.HasPermission(ctx, PermissionSystemManage) {
+		return nil, fmt.Errorf("%w: %q holds secret %q", ErrCheckedOut, active.Username, secret.Name)
+	}
+	if err := c.closeCheckout(ctx, secret, active, username, time.Now()); err != nil {
+		return nil, err
+	}
+	return active, nil
+}
+
+// SecretCustody returns the check-outs of a secret, oldest first
+func (c *SecretlyCore) SecretCustody(ctx context.Context, id uint) ([]models.SecretCheckout, error) {
+	if _, err := c.GetSecret(ctx, id); err != nil {
+		return nil, err
+	}
+	checkouts, err := c.storage.Checkouts().ListBySecret(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list check-outs of secret %d: %w", id, err)
+	}
+	return checkouts, nil
+}
+
+// checkCustody refuses reads and changes of a break-glass secret by anyone
+// but the user holding its check-out
+func (c *SecretlyCore) checkCustody(ctx context.Context, secret *models.SecretNode) error {
+	if !c.RequiresCheckout(secret) {
+		return nil
+	}
+	active, err := c.storage.Checkouts().Active(secret.ID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: secret %q is a break-glass secret", ErrCheckoutRequired, secret.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get check-out of secret %d: %w", secret.ID, err)
+	}
+	username := ClientInfoFrom(ctx).Username
+	switch {
+	case active.ExpiresAt.Before(time.Now()):
+		return fmt.Errorf("%w: the check-out of secret %q by %q lapsed", ErrCheckoutRequired, secret.Name, active.Username)
+	case active.Username != username:
+		return fmt.Errorf("%w: %q holds secret %q", ErrCheckedOut, active.Username, secret.Name)
+	}
+	return nil
+}
+
+// activeCheckout returns the current check-out of secret, or nil. A lease
+// that lapsed is closed as checked in by the system. Callers hold
+// checkout.mu.
+func (c *SecretlyCore) activeCheckout(ctx context.Context, secret *models.SecretNode) (*models.SecretCheckout, error) {
+	active, err := c.storage.Checkouts().Active(secret.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get check-out of secret %d: %w", secret.ID, err)
+	}
+	if active.ExpiresAt.After(time.Now()) {
+		return active, nil
+	}
+	if err := c.closeCheckout(ctx, secret, active, checkinBySystem, active.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// closeCheckout records the check-in of checkout by by, rotating the value
+// first if configured. Structured secrets are not rotated: there is no
+// value to generate for them.
+func (c *SecretlyCore) closeCheckout(ctx context.Context, secret *models.SecretNode, checkout *models.SecretCheckout, by string, at time.Time) error {
+	rotation := "value not rotated"
+	if c.checkout.rotate && secret.Type != TypeJSON {
+		value, err := randomString(rotatedValueAlphabet, rotatedValueLength)
+		if err != nil {
+			return fmt.Errorf("failed to generate value: %w", err)
+		}
+		if _, err := c.updateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte(value)}); err != nil {
+			return fmt.Errorf("failed to rotate secret %d: %w", secret.ID, err)
+		}
+		latest, err := c.latestVersion(secret.ID)
+		if err != nil {
+			return err
+		}
+		checkout.RotatedVersion = latest.VersionNumber
+		rotation = fmt.Sprintf("value rotated to version %d", latest.VersionNumber)
+	}
+
+	checkout.CheckedInAt, checkout.CheckedInBy = &at, by
+	if err := c.storage.Checkouts().Update(checkout); err != nil {
+		return fmt.Errorf("failed to check in secret %d: %w", secret.ID, err)
+	}
+	c.InvalidateSecretCache(secret.ID)
+
+	var desc string
+	switch by {
+	case checkout.Username:
+		desc = fmt.Sprintf("Secret %q checked in by %q", secret.Name, by)
+	case checkinBySystem:
+		desc = fmt.Sprintf("Check-out of secret %q by %q lapsed", secret.Name, checkout.Username)
+	default:
+		desc = fmt.Sprintf("Secret %q held by %q checked in by admin %q", secret.Name, checkout.Username, by)
+	}
+	c.recordClientEvent(ctx, EventSecretCheckedIn, &secret.ID, desc+"; "+rotation)
+	return nil
+}
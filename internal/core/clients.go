@@ -0,0 +1,307 @@
+package core
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for API clients
+const (
+	EventClientCreated       = "client_created"
+	EventClientSecretRotated = "client_secret_rotated"
+	EventClientDeleted       = "client_deleted"
+)
+
+const (
+	// ClientScopeRead lets an API client list and read secrets
+	ClientScopeRead = "secrets:read"
+	// ClientScopeWrite lets an API client create, update and delete secrets
+	ClientScopeWrite = "secrets:write"
+	// ClientScopeExists lets an API client check which secrets exist and
+	// count them, without reading them
+	ClientScopeExists = "secrets:exists"
+
+	// DefaultClientSecretGrace is how long the previous secret keeps working
+	// after a rotation when the caller does not choose
+	DefaultClientSecretGrace = time.Hour
+	// MaxClientSecretGrace bounds the grace window of a rotation
+	MaxClientSecretGrace = 7 * 24 * time.Hour
+
+	// clientScopePrefix starts the scope of API client sessions; the client
+	// ID follows
+	clientScopePrefix = "client:"
+	clientIDAlphabet  = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// CreateClientRequest describes a new API client. Without scopes the
+// client can only read.
+type CreateClientRequest struct {
+	Name         string
+	Description  string
+	Scopes       []string
+	NamespaceIDs []uint
+}
+
+// ClientCredentials is a newly issued client secret. It is shown once;
+// storage keeps it encrypted.
+type ClientCredentials struct {
+	Client *models.APIClient
+	Secret string
+}
+
+// CreateClient issues credentials for an API client that acts as the user,
+// limited to the requested scopes and namespaces
+func (c *SecretlyCore) CreateClient(ctx context.Context, userID uint, req *CreateClientRequest) (*ClientCredentials, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("client name is required")
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ClientScopeRead}
+	}
+	for _, scope := range scopes {
+		if scope != ClientScopeRead && scope != ClientScopeWrite && scope != ClientScopeExists {
+			return nil, fmt.Errorf("unknown client scope %q, expected %s, %s or %s", scope, ClientScopeRead, ClientScopeWrite, ClientScopeExists)
+		}
+	}
+	for _, id := range req.NamespaceIDs {
+		if err := c.ValidateScope(ctx, id, 0, 0); err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid namespace %d", id)
+		}
+	}
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+
+	clientID, err := randomString(clientIDAlphabet, 20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	secret, encrypted, err := c.newClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(scopes)
+	client := &models.APIClient{
+		UserID:       user.ID,
+		Name:         req.Name,
+		Description:  req.Description,
+		ClientID:     "sc_" + clientID,
+		ClientSecret: encrypted,
+		Scopes:       strings.Join(slices.Compact(scopes), ","),
+		NamespaceIDs: joinIDs(req.NamespaceIDs),
+		IsActive:     true,
+	}
+	if err := c.storage.APIClients().Create(client); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	c.recordUserEvent(ctx, EventClientCreated, &user.ID, nil, fmt.Sprintf("User %q created API client %q (%s) with scopes %s",
+		user.Username, client.Name, client.ClientID, client.Scopes))
+	return &ClientCredentials{Client: client, Secret: secret}, nil
+}
+
+// ListClients returns the user's API clients
+func (c *SecretlyCore) ListClients(ctx context.Context, userID uint) ([]models.APIClient, error) {
+	clients, err := c.storage.APIClients().ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	return clients, nil
+}
+
+// RotateClientSecret issues a new secret for one of the user's clients. The
+// old secret keeps working for grace so deployments can switch over; a zero
+// grace revokes it at once.
+func (c *SecretlyCore) RotateClientSecret(ctx context.Context, userID uint, clientID string, grace time.Duration) (*ClientCredentials, error) {
+	if grace < 0 || grace > MaxClientSecretGrace {
+		return nil, fmt.Errorf("grace must be between 0 and %s", MaxClientSecretGrace)
+	}
+	client, err := c.ownedClient(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	secret, encrypted, err := c.newClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	client.PreviousSecret, client.PreviousSecretExpiresAt = nil, nil
+	if grace > 0 {
+		until := now.Add(grace)
+		client.PreviousSecret, client.PreviousSecretExpiresAt = client.ClientSecret, &until
+	}
+	client.ClientSecret, client.SecretRotatedAt = encrypted, &now
+	if err := c.storage.APIClients().Update(client); err != nil {
+		return nil, fmt.Errorf("failed to rotate client secret: %w", err)
+	}
+	c.recordUserEvent(ctx, EventClientSecretRotated, &userID, nil, fmt.Sprintf("Secret of API client %q (%s) rotated; the previous secret works for %s",
+		client.Name, client.ClientID, grace))
+	return &ClientCredentials{Client: client, Secret: secret}, nil
+}
+
+// DeleteClient removes one of the user's clients. Its sessions stop working
+// with their next request.
+func (c *SecretlyCore) DeleteClient(ctx context.Context, userID uint, clientID string) error {
+	client, err := c.ownedClient(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if err := c.storage.APIClients().Delete(client.ID); err != nil {
+		return fmt.Errorf("failed to delete client %s: %w", clientID, err)
+	}
+	c.recordUserEvent(ctx, EventClientDeleted, &userID, nil, fmt.Sprintf("API client %q (%s) deleted", client.Name, client.ClientID))
+	return nil
+}
+
+// ExchangeClientCredentials checks a client ID and secret and opens a
+// short-lived session that acts as the client's user within its scopes
+func (c *SecretlyCore) ExchangeClientCredentials(ctx context.Context, clientID, secret string) (string, *models.Session, error) {
+	client, err := c.storage.APIClients().GetByClientID(clientID)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil, fmt.Errorf("%w: unknown client", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if !client.IsActive {
+		return "", nil, fmt.Errorf("%w: client %s is disabled", ErrInvalidCredentials, clientID)
+	}
+	previous, err := c.checkClientSecret(client, secret)
+	if err != nil {
+		return "", nil, err
+	}
+	user, err := c.storage.Users().FindByID(client.UserID)
+	if err != nil {
+		return "", nil, fmt.Errorf("client %s user %d not found: %w", clientID, client.UserID, err)
+	}
+	if user.DeactivatedAt != nil {
+		return "", nil, fmt.Errorf("%w: client %s user %q is deactivated", ErrInvalidCredentials, clientID, user.Username)
+	}
+	if err := c.checkClientNetwork(ctx, user.Username, &user.ID); err != nil {
+		return "", nil, err
+	}
+
+	token, session, err := c.openSession(ctx, &models.Session{
+		UserID:  user.ID,
+		Scope:   clientScopePrefix + client.ClientID,
+		Subject: client.Name,
+	}, DefaultFederatedSessionTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	_ = c.storage.APIClients().RecordUse(client.ID, time.Now())
+
+	desc := fmt.Sprintf("User %q logged in via API client %q (%s)", user.Username, client.Name, client.ClientID)
+	if previous {
+		desc += " with its previous secret"
+	}
+	c.recordUserEvent(ctx, EventUserLogin, &user.ID, nil, desc)
+	return token, session, nil
+}
+
+// ClientScopes returns the scopes granted to client
+func ClientScopes(client *models.APIClient) []string {
+	if client.Scopes == "" {
+		return nil
+	}
+	return strings.Split(client.Scopes, ",")
+}
+
+// ClientNamespaceIDs returns the namespaces client is limited to, or nil
+// for all namespaces
+func ClientNamespaceIDs(client *models.APIClient) []uint {
+	var ids []uint
+	for _, part := range strings.Split(client.NamespaceIDs, ",") {
+		if id, err := strconv.ParseUint(part, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// clientRestriction returns the limits of the sessions of an API client
+func (c *SecretlyCore) clientRestriction(clientID string) (*restriction, error) {
+	client, err := c.storage.APIClients().GetByClientID(clientID)
+	if errors.Is(err, ErrNotFound) || (err == nil && !client.IsActive) {
+		return nil, fmt.Errorf("%w: API client %q no longer exists", ErrPermissionDenied, clientID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	scopes := ClientScopes(client)
+	return &restriction{
+		name:         fmt.Sprintf("API client %q", client.Name),
+		read:         slices.Contains(scopes, ClientScopeRead),
+		write:        slices.Contains(scopes, ClientScopeWrite),
+		exists:       slices.Contains(scopes, ClientScopeExists),
+		namespaceIDs: ClientNamespaceIDs(client),
+	}, nil
+}
+
+// checkClientSecret compares secret with the client's current secret and,
+// during a rotation's grace window, its previous one. It reports whether
+// the previous secret matched.
+func (c *SecretlyCore) checkClientSecret(client *models.APIClient, secret string) (bool, error) {
+	current, err := c.decrypt(client.ClientSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt client secret: %w", err)
+	}
+	if subtle.ConstantTimeCompare(current, []byte(secret)) == 1 {
+		return false, nil
+	}
+	if client.PreviousSecretExpiresAt != nil && client.PreviousSecretExpiresAt.After(time.Now()) {
+		previous, err := c.decrypt(client.PreviousSecret)
+		if err != nil {
+			return false, fmt.Errorf("failed to decrypt client secret: %w", err)
+		}
+		if subtle.ConstantTimeCompare(previous, []byte(secret)) == 1 {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("%w: wrong client secret", ErrInvalidCredentials)
+}
+
+// ownedClient returns one of the user's clients. Clients of other users are
+// reported as not found.
+func (c *SecretlyCore) ownedClient(userID uint, clientID string) (*models.APIClient, error) {
+	client, err := c.storage.APIClients().GetByClientID(clientID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if err != nil || client.UserID != userID {
+		return nil, fmt.Errorf("client %s: %w", clientID, ErrNotFound)
+	}
+	return client, nil
+}
+
+// newClientSecret generates a client secret and encrypts it for storage
+func (c *SecretlyCore) newClientSecret() (string, []byte, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate client secret: %w", err)
+	}
+	encrypted, _, err := c.encrypt([]byte(secret))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt client secret: %w", err)
+	}
+	return secret, encrypted, nil
+}
+
+// joinIDs formats IDs as a comma-separated list
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/secretlyhq/secretly/internal/config"
+)
+
+// CompressionZstd marks SecretVersion payloads compressed with zstd before
+// encryption
+const CompressionZstd = "zstd"
+
+const (
+	defaultCompressionThreshold = 4096
+	// maxDecompressedSize guards against decompression bombs in stored payloads
+	maxDecompressedSize = 64 << 20
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+)
+
+// SetCompression enables transparent compression of values at or above the
+// configured size before they are encrypted
+func (c *SecretlyCore) SetCompression(cfg config.CompressionConfig) {
+	if cfg.ThresholdBytes <= 0 {
+		cfg.ThresholdBytes = defaultCompressionThreshold
+	}
+	c.compression = cfg
+}
+
+// shouldCompress reports whether a value of size bytes qualifies for compression
+func (c *SecretlyCore) shouldCompress(size int) bool {
+	return c.compression.Enabled && size >= c.compression.ThresholdBytes
+}
+
+// compress returns the payload to encrypt and the compression marker to store
+// with the version. Values that do not shrink are kept as is.
+func (c *SecretlyCore) compress(value []byte) ([]byte, string) {
+	if !c.shouldCompress(len(value)) {
+		return value, ""
+	}
+	compressed := zstdEncoder.EncodeAll(value, nil)
+	if len(compressed) >= len(value) {
+		return value, ""
+	}
+	return compressed, CompressionZstd
+}
+
+func decompress(payload []byte, algorithm string) ([]byte, error) {
+	switch algorithm {
+	case "":
+		return payload, nil
+	case CompressionZstd:
+		value, err := zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress secret: %w", err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
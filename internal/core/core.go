@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Encryptor encrypts and decrypts secret values; *encryption.Service satisfies it
+type Encryptor interface {
+	EncryptSecret(plaintext []byte) ([]byte, []byte, error)
+	DecryptSecret(encryptedData []byte) ([]byte, error)
+}
+
+// SecretlyCore implements the business logic shared by the CLI, servers and
+// embedding applications on top of a Storage backend
+type SecretlyCore struct {
+	storage   storage.Storage
+	encryptor Encryptor
+	cache     *valueCache
+	hashKey   hashKeyCache
+	chunkSize int
+	maxChunks int
+
+	compression config.CompressionConfig
+	fipsMode    bool
+	burn        bool
+	foldNames   bool
+	aliasTTL    time.Duration
+	naming      []namingRule
+	federation  *federation
+	reset       *passwordReset
+	twoFactor   *twoFactorPolicy
+	passkeys    *passkeys
+	devices     *devicePolicy
+	approvals   *approvalPolicy
+	checkout    *checkoutPolicy
+	lifecycle   *lifecycle
+	stale       *stalePolicy
+	canary      *canaryAlerts
+	network     *networkPolicy
+	mode        modeSwitch
+	events      eventBus
+	audit       *auditQueue
+
+	impersonation *impersonationPolicy
+	engines       *enginePolicy
+	releases      *releasePolicy
+	escrow        *escrowPolicy
+	gitops        *gitopsPolicy
+	diagnostics   *diagnosticsPolicy
+	faults        *faultPolicy
+
+	localTransport string
+	localActor     string
+
+	replica    bool
+	primaryURL string
+}
+
+// NewSecretlyCore creates a new core. If encryptor is nil, secret values are
+// stored unencrypted.
+func NewSecretlyCore(store storage.Storage, encryptor Encryptor) *SecretlyCore {
+	return &SecretlyCore{
+		storage:   store,
+		encryptor: encryptor,
+		chunkSize: defaultChunkSize,
+		aliasTTL:  DefaultAliasTTL,
+	}
+}
+
+// Storage returns the underlying storage backend
+func (c *SecretlyCore) Storage() storage.Storage {
+	return c.storage
+}
+
+// Audit event types recorded by the core
+const (
+	EventSecretCreated  = "secret_created"
+	EventSecretRead     = "secret_read"
+	EventSecretUpdated  = "secret_updated"
+	EventSecretDeleted  = "secret_deleted"
+	EventUserCreated    = "user_created"
+	EventUserLogin      = "user_login"
+	EventSessionRevoked = "session_revoked"
+	EventLoginFailed    = "login_failed"
+	EventAccessDenied   = "access_denied"
+)
+
+// recordEvent writes an audit event; failures are logged but never fail the operation
+func (c *SecretlyCore) recordEvent(ctx context.Context, eventType string, secretID *uint, description string) {
+	c.recordUserEvent(ctx, eventType, nil, secretID, description)
+}
+
+// recordUserEvent writes an audit event attributed to a user
+func (c *SecretlyCore) recordUserEvent(ctx context.Context, eventType string, userID, secretID *uint, description string) {
+	event := c.auditEvent(ctx, eventType, userID, secretID, description)
+	if c.audit != nil && c.audit.enqueue(event) {
+		// Published by the writer once stored
+		return
+	}
+	if c.replica {
+		logReplicaEvent(eventType, userID, secretID, description)
+	} else if err := c.storage.Audit().LogEvent(event); err != nil {
+		log.Printf("⚠️  Failed to record audit event %s: %v", eventType, err)
+	}
+	c.publishEvent(event)
+}
+
+// recordClientEvent writes an audit event attributed to the user of the
+// session in ctx, if there is one
+func (c *SecretlyCore) recordClientEvent(ctx context.Context, eventType string, secretID *uint, description string) {
+	c.recordUserEvent(ctx, eventType, c.clientUserID(ctx), secretID, description)
+}
+
+// clientUserID returns the ID of the user of the session in ctx, or nil
+func (c *SecretlyCore) clientUserID(ctx context.Context) *uint {
+	if username := ClientInfoFrom(ctx).Username; username != "" {
+		if user, err := c.storage.Users().FindByUsername(username); err == nil {
+			return &user.ID
+		}
+	}
+	return nil
+}
+
+// auditEvent builds an audit event happening now, stamped with the address,
+// user agent and transport of the client in ctx and the admin impersonating
+// its user. Callers that must store it in a transaction log it themselves
+// and publish it after the commit.
+func (c *SecretlyCore) auditEvent(ctx context.Context, eventType string, userID, secretID *uint, description string) *models.AuditEvent {
+	client := ClientInfoFrom(ctx)
+	if client.Transport == "" && client.IPAddress == "" {
+		client.Transport = c.localTransport
+	}
+	return &models.AuditEvent{
+		EventType:      eventType,
+		UserID:         userID,
+		SecretNodeID:   secretID,
+		Description:    description,
+		IPAddress:      client.IPAddress,
+		UserAgent:      client.UserAgent,
+		Transport:      client.Transport,
+		ActorKind:      client.ActorKind,
+		ImpersonatorID: client.ImpersonatorID,
+		EventTime:      time.Now().UTC(),
+	}
+}
+
+// SetLocalTransport sets the transport recorded on audit events of calls
+// made without a client in the context, TransportCLI for the command line.
+// The server leaves it empty: its background jobs act on no one's request.
+func (c *SecretlyCore) SetLocalTransport(transport string) {
+	c.localTransport = transport
+}
+
+// ListAuditEvents returns the audit events recorded in [from, to), oldest
+// first
+func (c *SecretlyCore) ListAuditEvents(ctx context.Context, from, to time.Time) ([]models.AuditEvent, error) {
+	if err := c.requirePermission(ctx, PermissionAuditRead, "reading the audit log"); err != nil {
+		return nil, err
+	}
+	events, err := c.storage.Audit().ListBetween(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
+
+func (c *SecretlyCore) encrypt(value []byte) ([]byte, []byte, error) {
+	if c.encryptor == nil {
+		return value, nil, nil
+	}
+	return c.encryptor.EncryptSecret(value)
+}
+
+func (c *SecretlyCore) decrypt(value []byte) ([]byte, error) {
+	if c.encryptor == nil {
+		return value, nil
+	}
+	return c.encryptor.DecryptSecret(value)
+}
+
+// paginate applies 1-based page/pageSize offset pagination to n items and
+// returns the slice bounds
+func paginate(n, page, pageSize int) (int, int) {
+	if pageSize <= 0 {
+		return 0, n
+	}
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start > n {
+		start = n
+	}
+	end := start + pageSize
+	if end > n {
+		end = n
+	}
+	return start, end
+}
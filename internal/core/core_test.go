@@ -0,0 +1,3176 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/device"
+	"github.com/secretlyhq/secretly/internal/engine"
+	"github.com/secretlyhq/secretly/internal/escrow"
+	"github.com/secretlyhq/secretly/internal/gitops"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"github.com/secretlyhq/secretly/internal/totp"
+)
+
+func newTestCore() *SecretlyCore {
+	c := NewSecretlyCore(memory.New(), nil)
+	c.SetLocalActor("test")
+	return c
+}
+
+func TestCreateAndReadSecret(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "api-key", Value: []byte("v1")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	value, err := c.GetSecretValue(ctx, secret.ID)
+	if err != nil {
+		t.Fatalf("Failed to read secret: %v", err)
+	}
+	if !bytes.Equal(value, []byte("v1")) {
+		t.Errorf("Expected v1, got %s", value)
+	}
+
+	if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte("v2")}); err != nil {
+		t.Fatalf("Failed to update secret: %v", err)
+	}
+	value, _ = c.GetSecretValue(ctx, secret.ID)
+	if !bytes.Equal(value, []byte("v2")) {
+		t.Errorf("Expected v2 after update, got %s", value)
+	}
+
+	versions, _ := c.GetSecretVersions(ctx, secret.ID)
+	if len(versions) != 2 || versions[1].VersionNumber != 2 {
+		t.Errorf("Expected 2 versions, got %+v", versions)
+	}
+}
+
+func TestMaxReads(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	maxReads := 2
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "token", Value: []byte("x"), MaxReads: &maxReads})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	for i := 0; i < maxReads; i++ {
+		if _, err := c.GetSecretValue(ctx, secret.ID); err != nil {
+			t.Fatalf("Read %d failed: %v", i+1, err)
+		}
+	}
+	if _, err := c.GetSecretValue(ctx, secret.ID); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired after exceeding max reads, got %v", err)
+	}
+}
+
+func TestConcurrentMaxReadsBurn(t *testing.T) {
+	c := newTestCore()
+	c.SetBurnAfterRead(true)
+	ctx := context.Background()
+	maxReads := 3
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "token", Value: []byte("x"), MaxReads: &maxReads})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var reads atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetSecretValue(ctx, secret.ID); err == nil {
+				reads.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if reads.Load() != int32(maxReads) {
+		t.Errorf("Expected exactly %d successful reads, got %d", maxReads, reads.Load())
+	}
+	if _, err := c.GetSecret(ctx, secret.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the secret to be burned after its last read, got %v", err)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "token", Value: []byte("v0")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 1; i <= writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte(fmt.Sprintf("v%d", i))}); err != nil {
+				t.Errorf("UpdateSecret failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	versions, err := c.storage.Secrets().GetVersions(secret.ID)
+	if err != nil || len(versions) != writers+1 {
+		t.Fatalf("Expected %d versions, got %d, %v", writers+1, len(versions), err)
+	}
+	for i, version := range versions {
+		if version.VersionNumber != i+1 {
+			t.Fatalf("Expected versions numbered 1 to %d without gaps or duplicates, got %d at %d", writers+1, version.VersionNumber, i)
+		}
+	}
+	err = c.storage.Secrets().CreateVersion(&models.SecretVersion{SecretNodeID: secret.ID, VersionNumber: 3})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a taken version number to conflict, got %v", err)
+	}
+}
+
+func TestConcurrentConditionalUpdates(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for name, c := range map[string]*SecretlyCore{"memory": newTestCore(), "sqlite": NewSecretlyCore(storage.NewLocalStorage(db), nil)} {
+		t.Run(name, func(t *testing.T) {
+			c.SetLocalActor("test")
+			ctx := context.Background()
+			secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "token", Value: []byte("v0")})
+			if err != nil {
+				t.Fatalf("Failed to create secret: %v", err)
+			}
+			state, _ := c.GetSecretState(ctx, secret.ID)
+			based := WithPrecondition(ctx, &SecretPrecondition{SecretID: secret.ID, Version: state.Version, UpdatedAt: state.Secret.UpdatedAt})
+
+			const writers = 10
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			stored := 0
+			for i := 1; i <= writers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := c.UpdateSecret(based, secret.ID, &UpdateSecretRequest{Value: []byte(fmt.Sprintf("v%d", i))})
+					switch {
+					case err == nil:
+						mu.Lock()
+						stored++
+						mu.Unlock()
+					case !errors.Is(err, ErrPreconditionFailed):
+						t.Errorf("Expected a failed precondition, got %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if stored != 1 {
+				t.Fatalf("Expected one update based on the same state to succeed, got %d", stored)
+			}
+			if err := c.DeleteSecret(based, secret.ID); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("Expected a delete based on a stale state to fail, got %v", err)
+			}
+			if err := c.DeleteSecret(ctx, secret.ID); err != nil {
+				t.Errorf("Expected an unconditional delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestListSecretsPagination(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte(name), NamespaceID: 1}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+
+	page, total, err := c.ListSecrets(ctx, &ListSecretsFilter{Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatalf("Failed to list secrets: %v", err)
+	}
+	if total != 5 || len(page) != 2 || page[0].Name != "c" {
+		t.Errorf("Unexpected page: total=%d page=%+v", total, page)
+	}
+
+	page, total, _ = c.ListSecrets(ctx, &ListSecretsFilter{NamespaceID: 2})
+	if total != 0 || len(page) != 0 {
+		t.Errorf("Expected no secrets in namespace 2, got %d", total)
+	}
+}
+
+func TestListSecretsSorting(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	for _, name := range []string{"c", "a", "e", "b", "d"} {
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte(name), CreatedBy: "alice"}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	names := func(secrets []models.SecretNode) string {
+		var out []string
+		for _, s := range secrets {
+			out = append(out, s.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	page, total, err := c.ListSecrets(ctx, &ListSecretsFilter{Sort: "-name", Page: 2, PageSize: 2})
+	if err != nil || total != 5 || names(page) != "c,b" {
+		t.Errorf("Expected the second page by descending name, got %d %s, %v", total, names(page), err)
+	}
+	if _, _, err := c.ListSecrets(ctx, &ListSecretsFilter{Sort: "value"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("Expected an unknown sort to be rejected, got %v", err)
+	}
+
+	// Grants on the secrets themselves are resolved by the query; a grant
+	// on a folder makes the listing check every secret instead
+	hidden, _ := c.FindSecret(ctx, &ListSecretsFilter{}, "b")
+	if _, err := c.GrantPermission(ctx, hidden.ID, "alice", AccessRead, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	bob, _ := c.storage.Users().FindByUsername("bob")
+	asBob := WithAuth(ctx, bob, &models.Session{UserID: bob.ID})
+	page, total, err = c.ListSecrets(asBob, &ListSecretsFilter{Sort: "name", PageSize: 3})
+	if err != nil || total != 4 || names(page) != "a,c,d" {
+		t.Errorf("Expected bob's first page without b, got %d %s, %v", total, names(page), err)
+	}
+
+	folder, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "ops"})
+	if _, err := c.GrantPermission(ctx, folder.ID, "alice", AccessWrite, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	page, total, err = c.ListSecrets(asBob, &ListSecretsFilter{Sort: "name", PageSize: 3})
+	if err != nil || total != 4 || names(page) != "a,c,d" {
+		t.Errorf("Expected the same page when checking every secret, got %d %s, %v", total, names(page), err)
+	}
+}
+
+func TestListSecretsAfter(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte(name)}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+
+	var names []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Too many pages")
+		}
+		page, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("Failed to list secrets: %v", err)
+		}
+		for _, s := range page {
+			names = append(names, s.Name)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if strings.Join(names, "") != "abcde" {
+		t.Errorf("Expected abcde, got %v", names)
+	}
+
+	if _, _, err := c.ListUsersAfter(ctx, cursor, 2); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for a secrets cursor, got %v", err)
+	}
+}
+
+func TestValueCache(t *testing.T) {
+	c := newTestCore()
+	c.EnableValueCache(config.CacheConfig{Enabled: true, TTLSeconds: 60, SkipLimited: true})
+	ctx := context.Background()
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "hot", Value: []byte("v1")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetSecretValue(ctx, secret.ID); err != nil {
+			t.Fatalf("Read %d failed: %v", i+1, err)
+		}
+	}
+	if stats := c.CacheStats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+
+	if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte("v2")}); err != nil {
+		t.Fatalf("Failed to update secret: %v", err)
+	}
+	value, _ := c.GetSecretValue(ctx, secret.ID)
+	if !bytes.Equal(value, []byte("v2")) {
+		t.Errorf("Expected v2 after update, got %s", value)
+	}
+
+	maxReads := 1
+	limited, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "once", Value: []byte("x"), MaxReads: &maxReads})
+	if _, err := c.GetSecretValue(ctx, limited.ID); err != nil {
+		t.Fatalf("First read failed: %v", err)
+	}
+	if _, err := c.GetSecretValue(ctx, limited.ID); err == nil {
+		t.Error("Expected cached read of a single-read secret to fail")
+	}
+
+	// Cached values are served only after the checks of any other read,
+	// e.g. when another process archived the secret
+	stored, _ := c.storage.Secrets().GetByID(secret.ID)
+	stored.Status = SecretStatusArchived
+	_ = c.storage.Secrets().Update(stored)
+	if _, err := c.GetSecretValue(ctx, secret.ID); !errors.Is(err, ErrArchived) {
+		t.Errorf("Expected a cached archived secret to be refused, got %v", err)
+	}
+
+	c.SetDiagnostics(true)
+	report, err := c.Diagnostics(ctx, false)
+	if err != nil || report.ValueCache == nil || report.ValueCache.Hits != 3 || report.ValueCache.HitRate == 0 {
+		t.Errorf("Expected diagnostics to report the cache, got %+v, %v", report, err)
+	}
+}
+
+func TestCanarySecret(t *testing.T) {
+	c := newTestCore()
+	c.EnableValueCache(config.CacheConfig{Enabled: true, TTLSeconds: 60})
+	ctx := context.Background()
+
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "bad", Decoy: "aws"}); err == nil {
+		t.Error("Expected a decoy without the canary flag to be rejected")
+	}
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-aws-root", Canary: true, Decoy: "aws"})
+	if err != nil {
+		t.Fatalf("Failed to create canary: %v", err)
+	}
+
+	reader := WithClientInfo(ctx, ClientInfo{Username: "mallory", SessionID: 42, IPAddress: "203.0.113.7", UserAgent: "curl/8.0"})
+	for i := 0; i < 2; i++ {
+		value, err := c.GetSecretValue(reader, secret.ID)
+		if err != nil {
+			t.Fatalf("Read %d failed: %v", i+1, err)
+		}
+		if !strings.HasPrefix(string(value), "AWS_ACCESS_KEY_ID=AKIA") {
+			t.Errorf("Expected an AWS decoy, got %q", value)
+		}
+	}
+	if stats := c.CacheStats(); stats.Hits != 0 {
+		t.Errorf("Expected canary reads to bypass the cache, got %+v", stats)
+	}
+
+	events, err := c.ListAuditEvents(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ListAuditEvents failed: %v", err)
+	}
+	var alerts int
+	for _, e := range events {
+		if e.EventType == EventCanaryTriggered {
+			alerts++
+			if !strings.Contains(e.Description, `"mallory"`) || !strings.Contains(e.Description, "203.0.113.7") {
+				t.Errorf("Expected the reader in the alert, got %q", e.Description)
+			}
+		}
+	}
+	if alerts != 2 {
+		t.Errorf("Expected 2 canary alerts, got %d", alerts)
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SetNetworkPolicy(config.NetworkPolicyConfig{
+		Clients:    []config.ClientNetworkConfig{{Username: "ci", Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.9.0.0/16"}}},
+		Namespaces: []config.NamespaceNetworkConfig{{NamespaceID: 2, Allow: []string{"192.0.2.10"}}},
+	}); err != nil {
+		t.Fatalf("SetNetworkPolicy failed: %v", err)
+	}
+	if err := c.SetNetworkPolicy(config.NetworkPolicyConfig{
+		Clients: []config.ClientNetworkConfig{{Username: "ci", Allow: []string{"10.0.0.0/33"}}},
+	}); err == nil {
+		t.Error("Expected an invalid CIDR to be rejected")
+	}
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "ci", Password: "correct horse"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	from := func(ip string) context.Context {
+		return WithClientInfo(ctx, ClientInfo{Username: "ci", IPAddress: ip})
+	}
+	if _, _, err := c.Login(from("10.1.2.3"), "ci", "correct horse"); err != nil {
+		t.Errorf("Expected login from an allowed network, got %v", err)
+	}
+	for _, ip := range []string{"10.9.0.1", "203.0.113.7"} {
+		if _, _, err := c.Login(from(ip), "ci", "correct horse"); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected login from %s to be forbidden, got %v", ip, err)
+		}
+	}
+	if err := c.CheckClientNetwork(from("::ffff:10.1.2.3")); err != nil {
+		t.Errorf("Expected IPv4-mapped address to match, got %v", err)
+	}
+	if err := c.CheckClientNetwork(ctx); err != nil {
+		t.Errorf("Expected requests without an address to pass, got %v", err)
+	}
+
+	secret := &models.SecretNode{ID: 5, Name: "db", NamespaceID: 2}
+	if err := c.CheckNamespaceNetwork(from("192.0.2.10"), secret); err != nil {
+		t.Errorf("Expected namespace access from the allowed address, got %v", err)
+	}
+	if err := c.CheckNamespaceNetwork(from("192.0.2.11"), secret); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected namespace access to be forbidden, got %v", err)
+	}
+	if !c.NamespaceReachable(from("192.0.2.11"), 1) {
+		t.Error("Expected namespaces without rules to be reachable")
+	}
+
+	events, _ := c.ListAuditEvents(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	var denied int
+	for _, e := range events {
+		if e.EventType == EventNetworkDenied {
+			denied++
+		}
+	}
+	if denied != 3 {
+		t.Errorf("Expected 3 network_denied events, got %d", denied)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	c := newTestCore()
+	c.SetCompression(config.CompressionConfig{Enabled: true, ThresholdBytes: 1024})
+	ctx := context.Background()
+
+	value := bytes.Repeat([]byte(`{"key":"value"},`), 1000)
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "config.json", Value: value})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	versions, _ := c.GetSecretVersions(ctx, secret.ID)
+	if versions[0].Compression != CompressionZstd || len(versions[0].EncryptedValue) >= len(value) {
+		t.Errorf("Expected a zstd-compressed payload, got %q with %d bytes", versions[0].Compression, len(versions[0].EncryptedValue))
+	}
+
+	got, err := c.GetSecretValue(ctx, secret.ID)
+	if err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+
+	streamed, err := c.CreateSecretFromReader(ctx, &CreateSecretRequest{Name: "streamed"}, bytes.NewReader(value))
+	if err != nil {
+		t.Fatalf("Failed to stream secret: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.StreamSecretValue(ctx, streamed.ID, &buf); err != nil || !bytes.Equal(buf.Bytes(), value) {
+		t.Fatalf("Streamed round trip failed: %v", err)
+	}
+
+	small, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "small", Value: []byte("short")})
+	versions, _ = c.GetSecretVersions(ctx, small.ID)
+	if versions[0].Compression != "" {
+		t.Errorf("Values below the threshold must not be compressed")
+	}
+}
+
+func TestUpdateDeduplicationAndIntegrity(t *testing.T) {
+	store := memory.New()
+	c := NewSecretlyCore(store, nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db-password", Value: []byte("hunter2")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte("hunter2")}); err != nil {
+		t.Fatalf("Failed to update secret: %v", err)
+	}
+	versions, _ := c.GetSecretVersions(ctx, secret.ID)
+	if len(versions) != 1 {
+		t.Fatalf("Expected identical value to be deduplicated, got %d versions", len(versions))
+	}
+
+	results, err := c.VerifyIntegrity(ctx, false)
+	if err != nil || len(results) != 1 || results[0].Status != IntegrityOK {
+		t.Fatalf("Expected one OK result, got %+v (%v)", results, err)
+	}
+
+	versions[0].EncryptedValue = []byte("tampered")
+	if err := store.Secrets().UpdateVersion(&versions[0]); err != nil {
+		t.Fatalf("Failed to tamper with version: %v", err)
+	}
+	results, _ = c.VerifyIntegrity(ctx, false)
+	if results[0].Status != IntegrityMismatch {
+		t.Errorf("Expected mismatch after tampering, got %s", results[0].Status)
+	}
+}
+
+func TestContentHashesAreKeyedWithoutKeyDeriver(t *testing.T) {
+	store := memory.New()
+	c := NewSecretlyCore(store, nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "pin", Value: []byte("1234")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	plain := sha256.Sum256([]byte("1234"))
+	state, _ := c.GetSecretState(ctx, secret.ID)
+	if !strings.HasPrefix(state.ContentHash, "hmac-sha256:") || strings.Contains(state.ContentHash, hex.EncodeToString(plain[:])) {
+		t.Fatalf("Expected a keyed content hash, got %q", state.ContentHash)
+	}
+	if stored, _ := store.Config().Get(contentHashKeyKey); stored == "" {
+		t.Error("Expected the content hash key to be stored")
+	}
+
+	// A second core on the same storage uses the same key
+	other := NewSecretlyCore(store, nil)
+	if matches, err := other.ValueMatches(ctx, secret.ID, []byte("1234")); err != nil || !matches {
+		t.Errorf("Expected the stored key to be reused, got %v, %v", matches, err)
+	}
+
+	// Unkeyed hashes of earlier releases are hidden and replaced by backfill
+	versions, _ := store.Secrets().GetVersions(secret.ID)
+	versions[0].ContentHash = "sha256:" + hex.EncodeToString(plain[:])
+	_ = store.Secrets().UpdateVersion(&versions[0])
+	if state, _ := c.GetSecretState(ctx, secret.ID); state.ContentHash != "" {
+		t.Errorf("Expected a legacy hash to be hidden, got %q", state.ContentHash)
+	}
+	results, _ := c.VerifyIntegrity(ctx, true)
+	if len(results) != 1 || results[0].Status != IntegrityOK {
+		t.Fatalf("Expected the legacy hash to be replaced, got %+v", results)
+	}
+	if again, _ := c.GetSecretState(ctx, secret.ID); again.ContentHash != state.ContentHash {
+		t.Errorf("Expected the keyed hash after backfill, got %q", again.ContentHash)
+	}
+}
+
+func TestVersionContentUpdateKeepsReads(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for name, c := range map[string]*SecretlyCore{"memory": newTestCore(), "sqlite": NewSecretlyCore(storage.NewLocalStorage(db), nil)} {
+		t.Run(name, func(t *testing.T) {
+			c.SetLocalActor("test")
+			ctx := context.Background()
+			maxReads := 5
+			secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "token", Value: []byte("v0"), MaxReads: &maxReads})
+			if err != nil {
+				t.Fatalf("Failed to create secret: %v", err)
+			}
+			versions, _ := c.storage.Secrets().GetVersions(secret.ID)
+			stale := versions[0]
+			if _, err := c.GetSecretValue(ctx, secret.ID); err != nil {
+				t.Fatalf("Failed to read secret: %v", err)
+			}
+
+			stale.ContentHash = ""
+			if err := c.storage.Secrets().UpdateVersionContent(&stale); err != nil {
+				t.Fatalf("Failed to update version: %v", err)
+			}
+			versions, _ = c.storage.Secrets().GetVersions(secret.ID)
+			if versions[0].ReadCount != 1 || versions[0].ContentHash != "" {
+				t.Errorf("Expected the read to survive a content update, got %d reads and hash %q", versions[0].ReadCount, versions[0].ContentHash)
+			}
+		})
+	}
+}
+
+func TestFIPSPasswordHashing(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "legacy", Password: "old-password"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	c.SetFIPSMode(true)
+	user, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if !strings.HasPrefix(user.PasswordHash, pbkdf2Prefix+"$") {
+		t.Errorf("Expected PBKDF2 hash in FIPS mode, got %q", user.PasswordHash)
+	}
+
+	if _, _, err := c.Login(ctx, "alice", "correct horse"); err != nil {
+		t.Errorf("Expected PBKDF2 login to succeed: %v", err)
+	}
+	if _, _, err := c.Login(ctx, "alice", "wrong"); err == nil {
+		t.Error("Expected wrong password to fail")
+	}
+	if _, _, err := c.Login(ctx, "legacy", "old-password"); err != nil {
+		t.Errorf("Expected bcrypt hash to keep working in FIPS mode: %v", err)
+	}
+}
+
+func TestSessionManagement(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "correct horse"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	laptop := WithClientInfo(ctx, ClientInfo{IPAddress: "203.0.113.7", UserAgent: "secretly-cli"})
+	_, current, err := c.Login(laptop, "alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if current.IPAddress != "203.0.113.7" || current.UserAgent != "secretly-cli" || current.LastSeenAt == nil {
+		t.Errorf("Expected client recorded on session, got %+v", current)
+	}
+	phoneToken, phone, err := c.Login(WithClientInfo(ctx, ClientInfo{IPAddress: "198.51.100.2"}), "alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	tabletToken, _, _ := c.Login(ctx, "alice", "correct horse")
+	_, bobs, _ := c.Login(ctx, "bob", "correct horse")
+
+	// Use from a new address is recorded right away
+	if _, session, err := c.AuthenticateSession(WithClientInfo(ctx, ClientInfo{IPAddress: "192.0.2.9"}), phoneToken); err != nil || session.IPAddress != "192.0.2.9" {
+		t.Errorf("Expected new address recorded, got %+v (%v)", session, err)
+	}
+
+	user, _ := c.storage.Users().FindByUsername("alice")
+	sessions, err := c.ListSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d (%v)", len(sessions), err)
+	}
+
+	if err := c.RevokeSession(ctx, user.ID, bobs.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected another user's session to be not found, got %v", err)
+	}
+	if err := c.RevokeSession(ctx, user.ID, phone.ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if _, _, err := c.AuthenticateSession(ctx, phoneToken); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected revoked session to be rejected, got %v", err)
+	}
+
+	if n, err := c.RevokeOtherSessions(ctx, user.ID, current.ID); err != nil || n != 1 {
+		t.Errorf("Expected 1 other session revoked, got %d (%v)", n, err)
+	}
+	if _, _, err := c.AuthenticateSession(ctx, tabletToken); err == nil {
+		t.Error("Expected other session to be revoked")
+	}
+	if sessions, _ := c.ListSessions(ctx, user.ID); len(sessions) != 1 || sessions[0].ID != current.ID {
+		t.Errorf("Expected only the current session left, got %+v", sessions)
+	}
+	if _, err := c.storage.Sessions().GetByToken(bobs.SessionToken); err != nil {
+		t.Errorf("Expected other users' sessions to be kept: %v", err)
+	}
+}
+
+func TestAccessReport(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SetOIDC(config.OIDCConfig{
+		Enabled:   true,
+		Audience:  "secretly",
+		Providers: []config.OIDCProviderConfig{{Name: "github", Issuer: "https://token.actions.githubusercontent.com"}},
+		Policies: []config.OIDCPolicyConfig{{
+			Name: "deploy", Provider: "github", Username: "ci", Claims: map[string]string{"repository": "acme/app"},
+			EnvironmentID: 2, ReadOnly: true,
+		}},
+	}); err != nil {
+		t.Fatalf("Failed to configure OIDC: %v", err)
+	}
+	c.SetApprovals(config.ApprovalsConfig{Enabled: true, Admins: []string{"bob"}})
+
+	for _, req := range []*CreateUserRequest{
+		{Username: "alice", Password: "correct horse"},
+		{Username: "bob", Password: "correct horse"},
+		{Username: "ci"},
+	} {
+		if _, err := c.CreateUser(ctx, req); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	prod, err := c.CreateSecret(ctx, &CreateSecretRequest{
+		Name: "db", Value: []byte("v"), NamespaceID: 1, ZoneID: 1, EnvironmentID: 2,
+		CreatedBy: "alice", Metadata: map[string]interface{}{"tags": []string{"critical"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{
+		Name: "db", Value: []byte("v"), NamespaceID: 1, ZoneID: 1, EnvironmentID: 3,
+	}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	grants, err := c.SecretAccess(ctx, prod.ID)
+	if err != nil {
+		t.Fatalf("SecretAccess failed: %v", err)
+	}
+	var got []string
+	for _, g := range grants {
+		got = append(got, g.Username+":"+g.Level+":"+g.Source)
+	}
+	want := "alice:write:owner alice:write:login bob:write:login bob:approve:approver ci:read:oidc_policy"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Expected grants %q, got %q", want, strings.Join(got, " "))
+	}
+
+	grants, err = c.UserAccess(ctx, "ci")
+	if err != nil {
+		t.Fatalf("UserAccess failed: %v", err)
+	}
+	if len(grants) != 1 || grants[0].SecretID != prod.ID {
+		t.Errorf("Expected ci to reach only the environment 2 secret, got %+v", grants)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAccessCSV(&buf, grants); err != nil {
+		t.Fatalf("WriteAccessCSV failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "1,db,ci,read,oidc_policy,") {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestScopedSessionAuthorization(t *testing.T) {
+	c := newTestCore()
+	if err := c.SetOIDC(config.OIDCConfig{
+		Enabled:   true,
+		Audience:  "secretly",
+		Providers: []config.OIDCProviderConfig{{Name: "github", Issuer: "https://token.actions.githubusercontent.com"}},
+		Policies: []config.OIDCPolicyConfig{{
+			Name: "deploy", Provider: "github", Username: "ci",
+			Claims:        map[string]string{"repository": "acme/app"},
+			EnvironmentID: 2, ReadOnly: true,
+		}},
+	}); err != nil {
+		t.Fatalf("Failed to configure OIDC: %v", err)
+	}
+
+	ctx := context.Background()
+	scoped := &models.Session{Scope: "deploy"}
+	inScope := &models.SecretNode{EnvironmentID: 2}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, scoped), inScope, false); err != nil {
+		t.Errorf("Expected read in scope to be allowed: %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, scoped), inScope, true); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected write to be forbidden for read-only policy, got %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, scoped), &models.SecretNode{EnvironmentID: 3}, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected other environment to be forbidden, got %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, &models.Session{Scope: "removed"}), inScope, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected unknown scope to be denied, got %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, &models.Session{}), &models.SecretNode{EnvironmentID: 3}, true); err != nil {
+		t.Errorf("Expected unscoped session to be allowed: %v", err)
+	}
+
+	filter := &ListSecretsFilter{}
+	if err := c.ScopeFilter(WithAuth(ctx, nil, scoped), filter); err != nil || filter.EnvironmentID != 2 {
+		t.Errorf("Expected filter narrowed to environment 2, got %+v (%v)", filter, err)
+	}
+}
+
+func TestStructuredSecretKeys(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "bad", Type: TypeJSON, Value: []byte(`["not", "an", "object"]`)}); err == nil {
+		t.Error("Expected error for a json secret that is not an object")
+	}
+
+	value := []byte(`{"db": {"password": "s3cr3t", "port": 5432}, "a.b": true}`)
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "app", Type: TypeJSON, Value: value})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	for path, want := range map[string]string{"db.password": "s3cr3t", "db.port": "5432", "a.b": "true"} {
+		got, err := c.GetSecretKey(ctx, secret.ID, path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s = %s, got %s", path, want, got)
+		}
+	}
+	if _, err := c.GetSecretKey(ctx, secret.ID, "db.password"); err != nil {
+		t.Fatalf("Failed to read key again: %v", err)
+	}
+	if _, err := c.GetSecretKey(ctx, secret.ID, "db.user"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for a missing key, got %v", err)
+	}
+
+	keys, err := c.ListSecretKeys(ctx, secret.ID)
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, k := range keys {
+		counts[k.Path] = k.ReadCount
+	}
+	if len(keys) != 3 || counts["db.password"] != 2 || counts["db.port"] != 1 {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+
+	if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte("plain")}); err == nil {
+		t.Error("Expected error when updating a json secret with a non-object value")
+	}
+
+	plain, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "plain", Value: []byte("x")})
+	if _, err := c.GetSecretKey(ctx, plain.ID, "x"); !errors.Is(err, ErrNotStructured) {
+		t.Errorf("Expected ErrNotStructured, got %v", err)
+	}
+}
+
+func TestApprovalWorkflow(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	c.SetApprovals(config.ApprovalsConfig{Enabled: true, Admins: []string{"bob", "carol"}})
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-db", Value: []byte("x"),
+		Metadata: map[string]interface{}{"tags": []string{"critical"}}})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if !errors.Is(c.DeleteSecret(ctx, secret.ID), ErrApprovalRequired) {
+		t.Fatal("Expected ErrApprovalRequired when deleting a critical secret")
+	}
+	if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Metadata: map[string]interface{}{}}); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected removing the critical tag to be refused, got %v", err)
+	}
+
+	op, err := c.RequestOperation(ctx, OperationDeleteSecret, secret.ID, "bob")
+	if err != nil {
+		t.Fatalf("Failed to request deletion: %v", err)
+	}
+	again, _ := c.RequestOperation(ctx, OperationDeleteSecret, secret.ID, "bob")
+	if again.ID != op.ID {
+		t.Errorf("Expected the pending request to be reused, got %d and %d", op.ID, again.ID)
+	}
+
+	if _, err := c.ApproveOperation(ctx, op.ID, "bob"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the requester to be refused, got %v", err)
+	}
+	if _, err := c.ApproveOperation(ctx, op.ID, "mallory"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected a non-admin to be refused, got %v", err)
+	}
+	approved, err := c.ApproveOperation(ctx, op.ID, "carol")
+	if err != nil || approved.Status != OperationExecuted {
+		t.Fatalf("Expected approval to execute, got %+v, %v", approved, err)
+	}
+	if _, err := c.GetSecret(ctx, secret.ID); err == nil {
+		t.Error("Expected the secret to be deleted after approval")
+	}
+	if _, err := c.RejectOperation(ctx, op.ID, "bob", "too late"); !errors.Is(err, ErrOperationClosed) {
+		t.Errorf("Expected ErrOperationClosed, got %v", err)
+	}
+
+	// Requests that are not approved in time expire
+	other, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-api", Value: []byte("y"),
+		Metadata: map[string]interface{}{"tags": map[string]string{"critical": "yes"}}})
+	op, err = c.RequestOperation(ctx, OperationDeleteSecret, other.ID, "alice")
+	if err != nil {
+		t.Fatalf("Failed to request deletion: %v", err)
+	}
+	op.ExpiresAt = time.Now().Add(-time.Minute)
+	_ = c.Storage().Operations().Update(op)
+	if _, err := c.ApproveOperation(ctx, op.ID, "bob"); !errors.Is(err, ErrOperationClosed) {
+		t.Errorf("Expected an expired operation to be closed, got %v", err)
+	}
+	if _, err := c.GetSecret(ctx, other.ID); err != nil {
+		t.Errorf("Expected the secret to survive an expired request: %v", err)
+	}
+}
+
+func TestApprovalProtectsTransfersGrantsAndBurns(t *testing.T) {
+	c := newTestCore()
+	c.SetBurnAfterRead(true)
+	ctx := context.Background()
+	c.SetApprovals(config.ApprovalsConfig{Enabled: true, Admins: []string{"bob", "carol"}})
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	critical := map[string]interface{}{"tags": []string{"critical"}}
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-db", Value: []byte("x"), Metadata: critical})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	if _, err := c.TransferOwnership(ctx, secret.ID, "alice", "bob"); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected ErrApprovalRequired when transferring a critical secret, got %v", err)
+	}
+	op, err := c.RequestTransfer(ctx, secret.ID, "alice", "bob")
+	if err != nil {
+		t.Fatalf("Failed to request transfer: %v", err)
+	}
+	if _, err := c.ApproveOperation(ctx, op.ID, "carol"); err != nil {
+		t.Fatalf("Failed to approve transfer: %v", err)
+	}
+	if got, _ := c.GetSecret(ctx, secret.ID); got.Owner != "alice" {
+		t.Errorf("Expected alice to own the secret after approval, got %q", got.Owner)
+	}
+
+	if _, err := c.GrantPermission(ctx, secret.ID, "alice", AccessRead, "bob"); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected ErrApprovalRequired when granting access to a critical secret, got %v", err)
+	}
+	op, err = c.RequestGrant(ctx, secret.ID, "alice", AccessRead, "bob")
+	if err != nil {
+		t.Fatalf("Failed to request grant: %v", err)
+	}
+	if _, err := c.ApproveOperation(ctx, op.ID, "carol"); err != nil {
+		t.Fatalf("Failed to approve grant: %v", err)
+	}
+	if grants, _ := c.ListGrants(ctx, secret.ID); len(grants) != 1 || grants[0].Username != "alice" || grants[0].Level != AccessRead {
+		t.Errorf("Expected alice's read grant after approval, got %+v", grants)
+	}
+
+	maxReads := 1
+	token, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-token", Value: []byte("y"), MaxReads: &maxReads, Metadata: critical})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.GetSecretValue(ctx, token.ID); err != nil {
+		t.Fatalf("Failed to read secret: %v", err)
+	}
+	if _, err := c.GetSecret(ctx, token.ID); err != nil {
+		t.Fatalf("Expected a critical secret to survive its last read until approved: %v", err)
+	}
+	pending, _ := c.ListOperations(ctx, OperationPending)
+	if len(pending) != 1 || pending[0].Kind != OperationBurnSecret || pending[0].SecretNodeID != token.ID {
+		t.Fatalf("Expected a pending burn of the secret, got %+v", pending)
+	}
+	if _, err := c.ApproveOperation(ctx, pending[0].ID, "carol"); err != nil {
+		t.Fatalf("Failed to approve burn: %v", err)
+	}
+	if _, err := c.GetSecret(ctx, token.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the secret to be burned after approval, got %v", err)
+	}
+}
+
+func TestConcurrentApprovals(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	approvers := []string{"a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8"}
+	c.SetApprovals(config.ApprovalsConfig{Enabled: true, Admins: approvers})
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "prod-db", Value: []byte("x"),
+		Metadata: map[string]interface{}{"tags": []string{"critical"}}})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	op, err := c.RequestOperation(ctx, OperationDeleteSecret, secret.ID, "alice")
+	if err != nil {
+		t.Fatalf("Failed to request deletion: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var executed, closed atomic.Int32
+	for _, approver := range approvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ApproveOperation(ctx, op.ID, approver)
+			switch {
+			case err == nil:
+				executed.Add(1)
+			case errors.Is(err, ErrOperationClosed):
+				closed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if executed.Load() != 1 || closed.Load() != int32(len(approvers)-1) {
+		t.Errorf("Expected one approval to execute and the rest to find it closed, got %d and %d", executed.Load(), closed.Load())
+	}
+}
+
+func TestOwnershipTransferAndOrphans(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	byUser, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "alice"})
+	byTool, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "ci", Value: []byte("x"), CreatedBy: "secretly-cli"})
+	if byUser.Owner != "alice" || byTool.Owner != "" {
+		t.Fatalf("Expected only user-created secrets to get an owner, got %q and %q", byUser.Owner, byTool.Owner)
+	}
+	bySession, _ := c.CreateSecret(WithClientInfo(ctx, ClientInfo{Username: "alice"}), &CreateSecretRequest{Name: "api", Value: []byte("x"), CreatedBy: "secretly-cli"})
+	if bySession.Owner != "alice" || bySession.CreatedBy != "secretly-cli" {
+		t.Fatalf("Expected the session user to own the secret, got owner %q created by %q", bySession.Owner, bySession.CreatedBy)
+	}
+
+	if _, err := c.TransferOwnership(ctx, byUser.ID, "nobody", "alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown owner, got %v", err)
+	}
+	secret, err := c.TransferOwnership(ctx, byUser.ID, "bob", "alice")
+	if err != nil || secret.Owner != "bob" {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+
+	bob, _ := c.Storage().Users().FindByUsername("bob")
+	_ = c.Storage().Users().Delete(bob.ID)
+	for i := 0; i < 2; i++ {
+		orphans, err := c.QueueOrphanedSecrets(ctx)
+		if err != nil || len(orphans) != 1 || orphans[0].ID != byUser.ID {
+			t.Fatalf("Expected secret %d to be orphaned, got %v, %v", byUser.ID, orphans, err)
+		}
+	}
+	events, _ := c.ListAuditEvents(ctx, time.Time{}, time.Now().Add(time.Minute))
+	queued := 0
+	for _, e := range events {
+		if e.EventType == EventSecretOrphaned {
+			queued++
+		}
+	}
+	if queued != 1 {
+		t.Errorf("Expected the orphan to be queued once, got %d events", queued)
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "pw"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	token, _, err := c.Login(ctx, "alice", "pw")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	owned, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "alice"})
+	read, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "api", Value: []byte("x"), CreatedBy: "secretly-cli"})
+	if _, err := c.GetSecretValue(WithClientInfo(ctx, ClientInfo{Username: "alice"}), read.ID); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	report, err := c.DeactivateUser(ctx, "alice", "admin", 0)
+	if err != nil {
+		t.Fatalf("Deactivate failed: %v", err)
+	}
+	if report.SessionsRevoked != 1 || len(report.Owned) != 1 || report.Owned[0].ID != owned.ID ||
+		len(report.Accessed) != 1 || report.Accessed[0].ID != read.ID {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if _, _, err := c.AuthenticateSession(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected revoked session, got %v", err)
+	}
+	if _, _, err := c.Login(ctx, "alice", "pw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected login to be refused, got %v", err)
+	}
+	if orphans, _ := c.OrphanedSecrets(ctx); len(orphans) != 1 || orphans[0].ID != owned.ID {
+		t.Errorf("Expected secret %d to be orphaned, got %v", owned.ID, orphans)
+	}
+
+	if err := c.ReactivateUser(ctx, "alice", "admin"); err != nil {
+		t.Fatalf("Reactivate failed: %v", err)
+	}
+	if _, _, err := c.Login(ctx, "alice", "pw"); err != nil {
+		t.Errorf("Expected login after reactivation, got %v", err)
+	}
+}
+
+// mailerFunc adapts a function to the Mailer interface
+type mailerFunc func(to, subject, body string) error
+
+func (f mailerFunc) Send(to, subject, body string) error { return f(to, subject, body) }
+
+func TestPasswordReset(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "old"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := c.RequestPasswordReset(ctx, "alice"); !errors.Is(err, ErrPasswordResetDisabled) {
+		t.Fatalf("Expected ErrPasswordResetDisabled, got %v", err)
+	}
+
+	sent := make(chan string, 10)
+	mailer := mailerFunc(func(to, subject, body string) error {
+		sent <- body
+		return nil
+	})
+	cfg := config.PasswordResetConfig{Enabled: true, URL: "https://secretly.example.com/reset?token={token}", MaxRequestsPerHour: 2}
+	if err := c.SetPasswordReset(cfg, mailer); err != nil {
+		t.Fatalf("SetPasswordReset failed: %v", err)
+	}
+	_, _, _ = c.Login(ctx, "alice", "old")
+
+	// Unknown accounts look the same to the caller but get no email
+	if err := c.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("Expected no error for an unknown account, got %v", err)
+	}
+	if err := c.RequestPasswordReset(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	var token string
+	select {
+	case body := <-sent:
+		_, rest, _ := strings.Cut(body, "token=")
+		token, _, _ = strings.Cut(rest, "\n")
+	case <-time.After(time.Second):
+		t.Fatal("Expected a reset email")
+	}
+
+	// The third request within the hour is dropped
+	_ = c.RequestPasswordReset(ctx, "alice")
+	_ = c.RequestPasswordReset(ctx, "alice")
+	<-sent
+	select {
+	case <-sent:
+		t.Error("Expected the third request to be rate limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := c.ConfirmPasswordReset(ctx, "wrong", "new"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a wrong token, got %v", err)
+	}
+	if err := c.ConfirmPasswordReset(ctx, token, "new"); err != nil {
+		t.Fatalf("ConfirmPasswordReset failed: %v", err)
+	}
+	if err := c.ConfirmPasswordReset(ctx, token, "newer"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the token to be single-use, got %v", err)
+	}
+	if _, _, err := c.Login(ctx, "alice", "new"); err != nil {
+		t.Errorf("Expected login with the new password, got %v", err)
+	}
+	user, _ := c.storage.Users().FindByUsername("alice")
+	if sessions, _ := c.ListSessions(ctx, user.ID); len(sessions) != 1 {
+		t.Errorf("Expected earlier sessions to be revoked, got %d sessions", len(sessions))
+	}
+}
+
+func TestConcurrentPasswordResetConfirmations(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for name, c := range map[string]*SecretlyCore{"memory": newTestCore(), "sqlite": NewSecretlyCore(storage.NewLocalStorage(db), nil)} {
+		t.Run(name, func(t *testing.T) {
+			c.SetLocalActor("test")
+			ctx := context.Background()
+			cfg := config.PasswordResetConfig{Enabled: true, URL: "https://secretly.example.com/reset?token={token}"}
+			if err := c.SetPasswordReset(cfg, mailerFunc(func(to, subject, body string) error { return nil })); err != nil {
+				t.Fatalf("SetPasswordReset failed: %v", err)
+			}
+			user, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "old"})
+			if err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+			expiresAt := time.Now().Add(time.Hour)
+			if err := c.storage.PasswordResets().Create(&models.PasswordReset{UserID: user.ID, Token: hashToken("token"), ExpiresAt: &expiresAt}); err != nil {
+				t.Fatalf("Failed to store reset token: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			var confirmed atomic.Int32
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := c.ConfirmPasswordReset(ctx, "token", fmt.Sprintf("new-%d", i)); err == nil {
+						confirmed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if confirmed.Load() != 1 {
+				t.Errorf("Expected exactly one confirmation to use the token, got %d", confirmed.Load())
+			}
+
+			expired := time.Now().Add(-time.Minute)
+			_ = c.storage.PasswordResets().Create(&models.PasswordReset{UserID: user.ID, Token: hashToken("expired"), ExpiresAt: &expired})
+			if consumed, err := c.storage.PasswordResets().Consume(hashToken("expired"), time.Now()); err != nil || consumed {
+				t.Errorf("Expected an expired token not to be consumed, got %v, %v", consumed, err)
+			}
+		})
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("SeedRoleTemplates failed: %v", err)
+	}
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "pw", Roles: []string{"admin"}}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "bob", Password: "pw", Roles: []string{"developer"}}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := c.SetTwoFactor(config.TwoFactorConfig{Required: TwoFactorRequiredAdmins}); err != nil {
+		t.Fatalf("SetTwoFactor failed: %v", err)
+	}
+
+	// Until alice enrolls, her sessions can do nothing else
+	_, session, err := c.Login(ctx, "alice", "pw")
+	if err != nil || session.Scope != EnrollmentScope {
+		t.Fatalf("Expected an enrollment session, got %+v, %v", session, err)
+	}
+	if _, session, err := c.Login(ctx, "bob", "pw"); err != nil || session.Scope != "" {
+		t.Errorf("Expected users without an admin permission to skip enrollment, got %+v, %v", session, err)
+	}
+	user, _ := c.storage.Users().FindByUsername("alice")
+	enrollment, err := c.EnrollTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP failed: %v", err)
+	}
+	now := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, now)
+	recovery, err := c.ConfirmTOTP(ctx, user.ID, code)
+	if err != nil || len(recovery) != recoveryCodeCount {
+		t.Fatalf("ConfirmTOTP = %d codes, %v", len(recovery), err)
+	}
+
+	if _, _, err := c.Login(ctx, "alice", "pw"); !errors.Is(err, ErrSecondFactorRequired) {
+		t.Errorf("Expected ErrSecondFactorRequired, got %v", err)
+	}
+	if _, _, err := c.LoginWithCode(ctx, "alice", "pw", code); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a used code to be rejected, got %v", err)
+	}
+	next, _ := totp.Code(enrollment.Secret, now+1)
+	_, session, err = c.LoginWithCode(ctx, "alice", "pw", next)
+	if err != nil || session.Scope != "" {
+		t.Fatalf("Expected a full session, got %+v, %v", session, err)
+	}
+	user, _ = c.storage.Users().FindByUsername("alice")
+	if err := c.RequireElevation(user, session); err != nil {
+		t.Errorf("Expected a fresh login to be elevated, got %v", err)
+	}
+	if err := c.RequireElevation(user, &models.Session{}); !errors.Is(err, ErrElevationRequired) {
+		t.Errorf("Expected ErrElevationRequired, got %v", err)
+	}
+
+	// Recovery codes work once, in any case and without the dash
+	stale := &models.Session{UserID: user.ID}
+	_ = c.storage.Sessions().Create(stale)
+	plain := strings.ToUpper(strings.ReplaceAll(recovery[0], "-", ""))
+	if _, err := c.ElevateSession(ctx, user, stale, plain); err != nil {
+		t.Fatalf("ElevateSession with a recovery code failed: %v", err)
+	}
+	if _, err := c.ElevateSession(ctx, user, stale, recovery[0]); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", err)
+	}
+	if RecoveryCodesLeft(user) != recoveryCodeCount-1 {
+		t.Errorf("Expected %d recovery codes left, got %d", recoveryCodeCount-1, RecoveryCodesLeft(user))
+	}
+	if err := c.DisableTOTP(ctx, user.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected admins to be unable to disable 2FA, got %v", err)
+	}
+}
+
+func TestPasskeyPolicy(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "pw"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := c.SetWebAuthn(config.WebAuthnConfig{Enabled: true, Required: TwoFactorRequiredAll}); err == nil {
+		t.Error("Expected SetWebAuthn to require an rp_id and origins")
+	}
+	cfg := config.WebAuthnConfig{Enabled: true, RPID: "localhost", Origins: []string{"http://localhost:8080"}, Required: TwoFactorRequiredAll}
+	if err := c.SetWebAuthn(cfg); err != nil {
+		t.Fatalf("SetWebAuthn failed: %v", err)
+	}
+
+	// Without a passkey the password only opens a session to register one
+	_, session, err := c.Login(ctx, "alice", "pw")
+	if err != nil || session.Scope != PasskeyEnrollmentScope {
+		t.Fatalf("Expected a passkey enrollment session, got %+v, %v", session, err)
+	}
+
+	handoff, err := c.StartLoginHandoff(ctx, "alice")
+	if err != nil {
+		t.Fatalf("StartLoginHandoff failed: %v", err)
+	}
+	if !strings.HasPrefix(handoff.URL, "http://localhost:8080/passkey?handoff=") {
+		t.Errorf("Unexpected handoff URL %q", handoff.URL)
+	}
+	if _, _, err := c.PollPasskeyHandoff(ctx, handoff.ID, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a wrong poll token to be rejected, got %v", err)
+	}
+	if _, _, err := c.PollPasskeyHandoff(ctx, handoff.ID, handoff.PollToken); !errors.Is(err, ErrHandoffPending) {
+		t.Errorf("Expected ErrHandoffPending, got %v", err)
+	}
+}
+
+func TestClientSecretRotation(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	user, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "pw"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	creds, err := c.CreateClient(ctx, user.ID, &CreateClientRequest{Name: "worker"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	id, first := creds.Client.ClientID, creds.Secret
+
+	_, session, err := c.ExchangeClientCredentials(ctx, id, first)
+	if err != nil || !IsFederated(session) {
+		t.Fatalf("Expected a scoped client session, got %+v, %v", session, err)
+	}
+	secret := &models.SecretNode{ID: 1, Name: "db"}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, false); err != nil {
+		t.Errorf("Expected the client to read, got %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, true); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected a read-only client to be unable to write, got %v", err)
+	}
+
+	// Both secrets work during the grace window, only the new one after
+	rotated, err := c.RotateClientSecret(ctx, user.ID, id, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateClientSecret failed: %v", err)
+	}
+	for _, s := range []string{first, rotated.Secret} {
+		if _, _, err := c.ExchangeClientCredentials(ctx, id, s); err != nil {
+			t.Errorf("Expected the secret to work during the grace window, got %v", err)
+		}
+	}
+	if _, err := c.RotateClientSecret(ctx, user.ID, id, 0); err != nil {
+		t.Fatalf("RotateClientSecret failed: %v", err)
+	}
+	if _, _, err := c.ExchangeClientCredentials(ctx, id, rotated.Secret); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a revoked secret to be rejected, got %v", err)
+	}
+
+	if err := c.DeleteClient(ctx, user.ID+1, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected other users not to see the client, got %v", err)
+	}
+	if err := c.DeleteClient(ctx, user.ID, id); err != nil {
+		t.Fatalf("DeleteClient failed: %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected sessions of a deleted client to be denied, got %v", err)
+	}
+}
+
+func TestDeviceEnrollment(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	c.SetDevices(config.DevicesConfig{Enabled: true})
+	ci, err := c.CreateUser(ctx, &CreateUserRequest{Username: "ci", Email: "ci@example.com", Password: "pw"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	asCI := WithAuth(ctx, ci, &models.Session{UserID: ci.ID})
+	if _, _, err := c.CreateEnrollmentToken(asCI, "ci", &EnrollmentTokenRequest{Name: "build-01", Username: "ci"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected only holders of devices.manage to create enrollment tokens, got %v", err)
+	}
+	token, _, err := c.CreateEnrollmentToken(ctx, "admin", &EnrollmentTokenRequest{Name: "build-01", Username: "ci", ReadOnly: true})
+	if err != nil {
+		t.Fatalf("CreateEnrollmentToken failed: %v", err)
+	}
+
+	keyPEM, csrPEM, err := device.NewKey("build-01")
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	enrollment, err := c.EnrollDevice(ctx, token, csrPEM)
+	if err != nil {
+		t.Fatalf("EnrollDevice failed: %v", err)
+	}
+	if _, err := c.EnrollDevice(ctx, token, csrPEM); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a used token to be rejected, got %v", err)
+	}
+
+	challenge, err := c.DeviceChallenge(ctx)
+	if err != nil {
+		t.Fatalf("DeviceChallenge failed: %v", err)
+	}
+	sig, err := device.Sign(keyPEM, challenge)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	_, session, err := c.DeviceLogin(ctx, enrollment.CertificatePEM, challenge, sig)
+	if err != nil {
+		t.Fatalf("DeviceLogin failed: %v", err)
+	}
+	if _, _, err := c.DeviceLogin(ctx, enrollment.CertificatePEM, challenge, sig); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a replayed challenge to be rejected, got %v", err)
+	}
+	secret := &models.SecretNode{ID: 1, Name: "db"}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, false); err != nil {
+		t.Errorf("Expected the device to read, got %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, true); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected a read-only device to be unable to write, got %v", err)
+	}
+
+	if err := c.RevokeDevice(ctx, "admin", enrollment.Device.ID); err != nil {
+		t.Fatalf("RevokeDevice failed: %v", err)
+	}
+	if err := c.AuthorizeSecret(WithAuth(ctx, nil, session), secret, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected sessions of a revoked device to be denied, got %v", err)
+	}
+}
+
+func TestSecretCheckout(t *testing.T) {
+	c := newTestCore()
+	c.SetCheckout(config.CheckoutConfig{Enabled: true, RotateOnCheckin: true})
+	ctx := context.Background()
+	alice := WithClientInfo(ctx, ClientInfo{Username: "alice"})
+	bob := WithClientInfo(ctx, ClientInfo{Username: "bob"})
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "root-pw", Value: []byte("hunter2"),
+		Metadata: map[string]interface{}{"tags": []string{"break-glass"}}})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	if _, err := c.GetSecretValue(alice, secret.ID); !errors.Is(err, ErrCheckoutRequired) {
+		t.Errorf("Expected reads without a check-out to be refused, got %v", err)
+	}
+	if _, err := c.CheckOutSecret(alice, secret.ID, "alice", 0, "incident"); err != nil {
+		t.Fatalf("CheckOutSecret failed: %v", err)
+	}
+	if value, err := c.GetSecretValue(alice, secret.ID); err != nil || string(value) != "hunter2" {
+		t.Errorf("Expected the holder to read the value, got %q, %v", value, err)
+	}
+	if _, err := c.CheckOutSecret(bob, secret.ID, "bob", 0, ""); !errors.Is(err, ErrCheckedOut) {
+		t.Errorf("Expected others to be locked out, got %v", err)
+	}
+	if _, err := c.GetSecretValue(bob, secret.ID); !errors.Is(err, ErrCheckedOut) {
+		t.Errorf("Expected others to be unable to read, got %v", err)
+	}
+	bobUser, err := c.CreateUser(ctx, &CreateUserRequest{Username: "bob"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := c.CheckInSecret(WithAuth(bob, bobUser, &models.Session{UserID: bobUser.ID}), secret.ID, "bob"); !errors.Is(err, ErrCheckedOut) {
+		t.Errorf("Expected others to be unable to check in, got %v", err)
+	}
+
+	checkout, err := c.CheckInSecret(alice, secret.ID, "alice")
+	if err != nil {
+		t.Fatalf("CheckInSecret failed: %v", err)
+	}
+	if checkout.RotatedVersion != 2 {
+		t.Errorf("Expected the value to be rotated to version 2, got %d", checkout.RotatedVersion)
+	}
+	if _, err := c.CheckOutSecret(bob, secret.ID, "bob", time.Minute, ""); err != nil {
+		t.Fatalf("CheckOutSecret failed: %v", err)
+	}
+	if value, err := c.GetSecretValue(bob, secret.ID); err != nil || string(value) == "hunter2" {
+		t.Errorf("Expected a rotated value, got %q, %v", value, err)
+	}
+	if _, err := c.CheckInSecret(ctx, secret.ID, "admin"); err != nil {
+		t.Errorf("Expected holders of system.manage to force a check-in, got %v", err)
+	}
+
+	custody, err := c.SecretCustody(ctx, secret.ID)
+	if err != nil || len(custody) != 2 || custody[1].CheckedInBy != "admin" {
+		t.Errorf("Expected the custody chain to list both check-outs, got %+v, %v", custody, err)
+	}
+}
+
+func TestPreviewSecretValue(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	maxReads := 1
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "api-key", Value: []byte("sk_live_12345678"), MaxReads: &maxReads})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	preview, err := c.PreviewSecretValue(ctx, secret.ID, 3, 4)
+	if err != nil {
+		t.Fatalf("PreviewSecretValue failed: %v", err)
+	}
+	if preview.Masked() != "sk_*********5678" {
+		t.Errorf("Unexpected preview %q", preview.Masked())
+	}
+	if _, err := c.PreviewSecretValue(ctx, secret.ID, 8, 8); err == nil {
+		t.Error("Expected a preview of more than half of the value to be refused")
+	}
+	if value, err := c.GetSecretValue(ctx, secret.ID); err != nil || string(value) != "sk_live_12345678" {
+		t.Errorf("Expected the preview not to use up the only read, got %q, %v", value, err)
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventSecretPreviewed}, SecretID: secret.ID})
+	if len(events) != 1 {
+		t.Errorf("Expected one secret_previewed audit event, got %d", len(events))
+	}
+}
+
+func TestSecretLifecycle(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	var mailed []string
+	c.SetLifecycle(config.LifecycleConfig{Enabled: true, NotifyDaysBefore: 7, GraceDays: 1}, mailerFunc(func(to, subject, body string) error {
+		mailed = append(mailed, to)
+		return nil
+	}))
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "correct horse battery"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	create := func(name string, expiration time.Time) *models.SecretNode {
+		soon := time.Now().Add(time.Hour)
+		secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte("x"), CreatedBy: "alice", Expiration: &soon})
+		if err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+		secret.Expiration = &expiration
+		if err := c.Storage().Secrets().Update(secret); err != nil {
+			t.Fatalf("Failed to set expiration: %v", err)
+		}
+		return secret
+	}
+	expiring := create("expiring", time.Now().Add(48*time.Hour))
+	expired := create("expired", time.Now().Add(-time.Hour))
+	stale := create("stale", time.Now().Add(-48*time.Hour))
+	create("later", time.Now().Add(20*24*time.Hour))
+
+	summary, err := c.ExpirationSummary(ctx)
+	if err != nil {
+		t.Fatalf("ExpirationSummary failed: %v", err)
+	}
+	if summary.Within7d != 1 || summary.Within30d != 2 || summary.Expired != 2 || summary.PendingPurge != 2 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	report, err := c.SweepSecretLifecycle(ctx)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if *report != (LifecycleReport{Notified: 1, Expired: 1, Purged: 1}) {
+		t.Errorf("Unexpected first sweep %+v", report)
+	}
+	if len(mailed) != 1 || mailed[0] != "alice@example.com" {
+		t.Errorf("Expected one warning mailed to alice, got %v", mailed)
+	}
+	if secret, err := c.GetSecret(ctx, expired.ID); err != nil || secret.Status != SecretStatusExpired {
+		t.Errorf("Expected %q to be marked expired, got %v", expired.Name, err)
+	}
+	if _, err := c.GetSecret(ctx, stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %q to be purged, got %v", stale.Name, err)
+	}
+
+	report, err = c.SweepSecretLifecycle(ctx)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if *report != (LifecycleReport{}) || len(mailed) != 1 {
+		t.Errorf("Expected the second sweep to do nothing, got %+v and %d mails", report, len(mailed))
+	}
+	if _, err := c.GetSecret(ctx, expiring.ID); err != nil {
+		t.Errorf("Expected %q to remain, got %v", expiring.Name, err)
+	}
+}
+
+func TestSecretNameUniqueness(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	create := func(name string) (*models.SecretNode, error) {
+		return c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte("x"), NamespaceID: 1})
+	}
+	first, err := create("café")
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	var conflict *NameConflictError
+	if _, err := create("  cafe\u0301 "); !errors.As(err, &conflict) || conflict.Existing.ID != first.ID || !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected a name conflict with secret %d, got %v", first.ID, err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "café", Value: []byte("x"), NamespaceID: 2}); err != nil {
+		t.Errorf("Expected the name to be free in another namespace, got %v", err)
+	}
+	upper, err := create("CAFÉ")
+	if err != nil {
+		t.Fatalf("Expected names to be case-sensitive by default, got %v", err)
+	}
+
+	c.SetSecretNames(config.SecretNamesConfig{CaseInsensitive: true})
+	collisions, err := c.IndexSecretNames(ctx)
+	if err != nil {
+		t.Fatalf("IndexSecretNames failed: %v", err)
+	}
+	if len(collisions) != 1 || len(collisions[0].Secrets) != 2 || collisions[0].Secrets[1].ID != upper.ID {
+		t.Fatalf("Expected %q to collide with %q, got %+v", upper.Name, first.Name, collisions)
+	}
+	if _, err := create("Café"); !errors.As(err, &conflict) || conflict.Existing.ID != first.ID {
+		t.Errorf("Expected the oldest secret to keep the name, got %v", err)
+	}
+}
+
+// derivingEncryptor stores values as they are and derives keys from key
+type derivingEncryptor struct{ key string }
+
+func (e *derivingEncryptor) EncryptSecret(plaintext []byte) ([]byte, []byte, error) {
+	return plaintext, nil, nil
+}
+func (e *derivingEncryptor) DecryptSecret(data []byte) ([]byte, error) { return data, nil }
+func (e *derivingEncryptor) DeriveKey(purpose string) ([]byte, error) {
+	return []byte(e.key + "/" + purpose), nil
+}
+
+func TestBlindIndexes(t *testing.T) {
+	enc := &derivingEncryptor{key: "kek-1"}
+	c := NewSecretlyCore(memory.New(), enc)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db-password", Value: []byte("x"), NamespaceID: 1})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if secret.NameKey == nil || *secret.NameKey == "db-password" {
+		t.Fatalf("Expected the name key to be a blind index, got %v", secret.NameKey)
+	}
+	user, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Email: "Alice@Example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.EmailIndex == "" || strings.Contains(user.EmailIndex, "example") {
+		t.Fatalf("Expected the email index to be a blind index, got %q", user.EmailIndex)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		found, err := c.FindSecret(ctx, &ListSecretsFilter{NamespaceID: 1}, "db-password")
+		if err != nil || found.ID != secret.ID {
+			t.Errorf("%s: expected to find the secret by name, got %v", when, err)
+		}
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db-password", Value: []byte("x"), NamespaceID: 1}); !errors.Is(err, ErrConflict) {
+			t.Errorf("%s: expected a name conflict, got %v", when, err)
+		}
+		found2, err := c.GetUserByEmail(ctx, " alice@example.COM")
+		if err != nil || found2.ID != user.ID {
+			t.Errorf("%s: expected to find the user by email, got %v", when, err)
+		}
+	}
+	check("before rotation")
+
+	enc.key = "kek-2"
+	if _, err := c.FindSecret(ctx, &ListSecretsFilter{NamespaceID: 1}, "db-password"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected stale indexes not to match, got %v", err)
+	}
+	if _, err := c.IndexSecretNames(ctx); err != nil {
+		t.Fatalf("IndexSecretNames failed: %v", err)
+	}
+	if n, err := c.IndexUserEmails(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 user to be re-indexed, got %d, %v", n, err)
+	}
+	check("after rotation")
+}
+
+func TestNamingPolicy(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	legacy, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "Stripe Key", Value: []byte("x"), NamespaceID: 2})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	err = c.SetNamingPolicy(config.NamingConfig{Rules: []config.NamingRuleConfig{
+		{NamespaceID: 2, Prefix: "payments/", Pattern: "[a-z0-9/_-]+"},
+	}})
+	if err != nil {
+		t.Fatalf("SetNamingPolicy failed: %v", err)
+	}
+
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "Stripe", Value: []byte("x"), NamespaceID: 2}); !errors.Is(err, ErrNamingPolicy) {
+		t.Errorf("Expected a naming policy violation, got %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "payments/stripe", Value: []byte("x"), NamespaceID: 2}); err != nil {
+		t.Errorf("Expected a conforming name to be accepted, got %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "Anything Goes", Value: []byte("x"), NamespaceID: 3}); err != nil {
+		t.Errorf("Expected other namespaces to be unaffected, got %v", err)
+	}
+
+	lints, err := c.LintSecretNames(ctx)
+	if err != nil {
+		t.Fatalf("LintSecretNames failed: %v", err)
+	}
+	if len(lints) != 1 || lints[0].Secret.ID != legacy.ID || lints[0].Suggestion != "payments/stripe-key" {
+		t.Errorf("Expected %q to be reported with a suggestion, got %+v", legacy.Name, lints)
+	}
+}
+
+func TestMoveSecret(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db-password", Value: []byte("x"), NamespaceID: 1})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "taken", Value: []byte("x"), NamespaceID: 2}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	target := uint(2)
+	if _, err := c.MoveSecret(ctx, secret.ID, &MoveSecretRequest{Name: "taken", NamespaceID: &target}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a name conflict in the target namespace, got %v", err)
+	}
+	moved, err := c.MoveSecret(ctx, secret.ID, &MoveSecretRequest{Name: "postgres-password", NamespaceID: &target})
+	if err != nil {
+		t.Fatalf("MoveSecret failed: %v", err)
+	}
+	if moved.Name != "postgres-password" || moved.NamespaceID != 2 {
+		t.Errorf("Expected the secret to be renamed and moved, got %+v", moved)
+	}
+
+	found, alias, err := c.ResolveSecretName(ctx, &ListSecretsFilter{NamespaceID: 1}, "db-password")
+	if err != nil || found.ID != secret.ID || alias == nil {
+		t.Fatalf("Expected the old name to resolve through an alias, got %+v, %+v, %v", found, alias, err)
+	}
+	if _, _, err := c.ResolveSecretName(ctx, &ListSecretsFilter{NamespaceID: 3}, "db-password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the alias to stay in its old scope, got %v", err)
+	}
+
+	// A new secret with the old name takes precedence over the alias
+	fresh, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db-password", Value: []byte("y"), NamespaceID: 1})
+	if err != nil {
+		t.Fatalf("Failed to reuse the old name: %v", err)
+	}
+	found, alias, err = c.ResolveSecretName(ctx, &ListSecretsFilter{NamespaceID: 1}, "db-password")
+	if err != nil || found.ID != fresh.ID || alias != nil {
+		t.Errorf("Expected the new secret to win over the alias, got %+v, %+v, %v", found, alias, err)
+	}
+}
+
+func TestSecretFolders(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SetOIDC(config.OIDCConfig{
+		Enabled:   true,
+		Audience:  "secretly",
+		Providers: []config.OIDCProviderConfig{{Name: "github", Issuer: "https://token.actions.githubusercontent.com"}},
+		Policies: []config.OIDCPolicyConfig{{
+			Name: "deploy", Provider: "github", Username: "ci",
+			Claims:        map[string]string{"repository": "acme/app"},
+			EnvironmentID: 2,
+		}},
+	}); err != nil {
+		t.Fatalf("Failed to configure OIDC: %v", err)
+	}
+
+	apps, err := c.CreateFolder(ctx, &CreateFolderRequest{Name: "apps", EnvironmentID: 2})
+	if err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+	web, err := c.CreateFolder(ctx, &CreateFolderRequest{Name: "web", EnvironmentID: 2, ParentID: &apps.ID})
+	if err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "session-key", Value: []byte("x"), EnvironmentID: 2, ParentID: &web.ID}); err != nil {
+		t.Fatalf("Failed to create secret in folder: %v", err)
+	}
+	ops, err := c.CreateFolder(ctx, &CreateFolderRequest{Name: "ops", EnvironmentID: 3})
+	if err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "root-key", Value: []byte("x"), EnvironmentID: 2, ParentID: &ops.ID}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected a folder in another scope to be refused, got %v", err)
+	}
+
+	tree, err := c.SecretTree(WithAuth(ctx, nil, &models.Session{Scope: "deploy"}), &ListSecretsFilter{}, 0)
+	if err != nil {
+		t.Fatalf("SecretTree failed: %v", err)
+	}
+	if len(tree) != 1 || tree[0].ID != apps.ID || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Errorf("Expected apps/web/session-key with ops pruned, got %+v", tree)
+	}
+	if secrets, _, _ := c.ListSecrets(ctx, &ListSecretsFilter{}); len(secrets) != 1 {
+		t.Errorf("Expected folders to be left out of secret lists, got %+v", secrets)
+	}
+
+	if _, err := c.MoveSecret(ctx, apps.ID, &MoveSecretRequest{ParentID: &web.ID}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected moving a folder into its subfolder to be refused, got %v", err)
+	}
+	top := uint(0)
+	if _, err := c.MoveSecret(ctx, web.ID, &MoveSecretRequest{ParentID: &top}); err != nil {
+		t.Fatalf("Failed to move folder to the top level: %v", err)
+	}
+	if err := c.DeleteSecret(ctx, web.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected deleting a non-empty folder to be refused, got %v", err)
+	}
+	if err := c.DeleteSecret(ctx, apps.ID); err != nil {
+		t.Errorf("Expected the emptied folder to be deleted, got %v", err)
+	}
+}
+
+func TestFolderPermissions(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	users := map[string]*models.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users[name] = user
+	}
+	session := func(name string) *models.Session { return &models.Session{UserID: users[name].ID} }
+
+	apps, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "apps"})
+	web, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "web", ParentID: &apps.ID})
+	key, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "session-key", Value: []byte("x"), ParentID: &web.ID, CreatedBy: "carol"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if err := c.CheckSecretPermission(session("bob"), key, true); err != nil {
+		t.Fatalf("Expected full access without grants, got %v", err)
+	}
+
+	if _, err := c.GrantPermission(ctx, apps.ID, "alice", AccessWrite, "carol"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	if _, err := c.GrantPermission(ctx, apps.ID, "bob", AccessRead, "carol"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	if err := c.CheckSecretPermission(session("alice"), key, true); err != nil {
+		t.Errorf("Expected alice to inherit write access, got %v", err)
+	}
+	if err := c.CheckSecretPermission(session("bob"), key, true); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected bob's read grant to refuse writes, got %v", err)
+	}
+	if err := c.CheckSecretPermission(session("carol"), key, true); err != nil {
+		t.Errorf("Expected the owner to keep write access, got %v", err)
+	}
+
+	// A grant on the subfolder overrides the folder above it.
+	if _, err := c.GrantPermission(ctx, web.ID, "bob", AccessWrite, "carol"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	if err := c.CheckSecretPermission(session("alice"), key, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected alice to lose access below web, got %v", err)
+	}
+	explanation, err := c.ExplainPermission(ctx, key.ID, "bob")
+	if err != nil {
+		t.Fatalf("ExplainPermission failed: %v", err)
+	}
+	if explanation.Level != AccessWrite || explanation.Source != "grant" || explanation.NodeID != web.ID || !explanation.Inherited || len(explanation.Path) != 2 {
+		t.Errorf("Expected bob's write access to come from web, got %+v", explanation)
+	}
+
+	if err := c.RevokePermission(ctx, web.ID, "bob", "carol"); err != nil {
+		t.Fatalf("RevokePermission failed: %v", err)
+	}
+	if explanation, _ := c.ExplainPermission(ctx, key.ID, "alice"); explanation.Level != AccessWrite || explanation.NodeID != apps.ID {
+		t.Errorf("Expected apps to decide again once web has no grants, got %+v", explanation)
+	}
+}
+
+// countingStorage counts the lookups of one user, one node's grants or one
+// folder, which listings should batch
+type countingStorage struct {
+	storage.Storage
+	lookups *atomic.Int64
+}
+
+type countingUsers struct {
+	repository.UserRepository
+	lookups *atomic.Int64
+}
+
+type countingGrants struct {
+	repository.GrantRepository
+	lookups *atomic.Int64
+}
+
+type countingSecrets struct {
+	repository.SecretRepository
+	lookups *atomic.Int64
+}
+
+func (s countingStorage) Users() repository.UserRepository {
+	return countingUsers{s.Storage.Users(), s.lookups}
+}
+
+func (s countingStorage) Grants() repository.GrantRepository {
+	return countingGrants{s.Storage.Grants(), s.lookups}
+}
+
+func (s countingStorage) Secrets() repository.SecretRepository {
+	return countingSecrets{s.Storage.Secrets(), s.lookups}
+}
+
+func (u countingUsers) FindByID(id uint) (*models.User, error) {
+	u.lookups.Add(1)
+	return u.UserRepository.FindByID(id)
+}
+
+func (g countingGrants) ListByNode(nodeID uint) ([]models.SecretGrant, error) {
+	g.lookups.Add(1)
+	return g.GrantRepository.ListByNode(nodeID)
+}
+
+func (s countingSecrets) GetByID(id uint) (*models.SecretNode, error) {
+	s.lookups.Add(1)
+	return s.SecretRepository.GetByID(id)
+}
+
+func TestPermissionsPreloadedForListings(t *testing.T) {
+	var lookups atomic.Int64
+	c := NewSecretlyCore(countingStorage{memory.New(), &lookups}, nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+	users := map[string]*models.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users[name] = user
+	}
+	apps, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "apps"})
+	web, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "web", ParentID: &apps.ID})
+	for i := range 20 {
+		parent := &web.ID
+		if i%2 == 0 {
+			parent = nil
+		}
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: fmt.Sprintf("key-%02d", i), Value: []byte("x"), ParentID: parent}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	for _, name := range []string{"alice", "carol"} {
+		if _, err := c.GrantPermission(ctx, apps.ID, name, AccessRead, "test"); err != nil {
+			t.Fatalf("GrantPermission failed: %v", err)
+		}
+	}
+	if _, err := c.GrantPermission(ctx, web.ID, "bob", AccessWrite, "test"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+
+	asAlice := WithAuth(ctx, users["alice"], &models.Session{UserID: users["alice"].ID})
+	lookups.Store(0)
+	secrets, total, err := c.ListSecrets(asAlice, &ListSecretsFilter{})
+	if err != nil || total != 10 || len(secrets) != 10 {
+		t.Fatalf("Expected alice to see the 10 secrets outside web, got %d, %v", total, err)
+	}
+	// The actor and the user being checked, not one lookup per secret
+	if n := lookups.Load(); n > 2 {
+		t.Errorf("Expected the grants and folders of the listing to be preloaded, got %d lookups", n)
+	}
+
+	lookups.Store(0)
+	grants, err := c.ListGrants(ctx, apps.ID)
+	if err != nil || len(grants) != 2 || grants[0].Username != "alice" || grants[1].Username != "carol" {
+		t.Fatalf("Expected the grants of alice and carol, got %+v, %v", grants, err)
+	}
+	// The node and its grants, not one lookup per user
+	if n := lookups.Load(); n > 2 {
+		t.Errorf("Expected the users of the grants to be loaded at once, got %d lookups", n)
+	}
+
+	report, err := c.UserAccess(ctx, "bob")
+	if err != nil {
+		t.Fatalf("UserAccess failed: %v", err)
+	}
+	var granted int
+	for _, g := range report {
+		if g.Source == AccessSourceGrant {
+			granted++
+		}
+	}
+	if granted != 10 {
+		t.Errorf("Expected bob's grant on web to cover 10 secrets, got %d", granted)
+	}
+}
+
+func TestExportProfiles(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for name, value := range map[string]string{"api/db-password": "s3cr3t", "api/token": "t0ken", "other/key": "x"} {
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte(value)}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "api/db", Type: TypeJSON, Value: []byte(`{"host": "db", "port": 5432}`)}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	if _, err := c.SaveExportProfile(ctx, &ExportProfile{Name: "api", Secrets: map[string]string{"not valid": "api/token"}}); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Expected an invalid variable name to be refused, got %v", err)
+	}
+	if _, err := c.SaveExportProfile(ctx, &ExportProfile{Name: "api", Prefix: "api/", VarPrefix: "app_", Uppercase: true, FlattenJSON: true}); err != nil {
+		t.Fatalf("SaveExportProfile failed: %v", err)
+	}
+	profile, err := c.GetExportProfile(ctx, "api")
+	if err != nil {
+		t.Fatalf("GetExportProfile failed: %v", err)
+	}
+	vars, err := c.ExportProfileVars(ctx, profile)
+	if err != nil {
+		t.Fatalf("ExportProfileVars failed: %v", err)
+	}
+	got := make(map[string]string)
+	for _, v := range vars {
+		got[v.Key] = string(v.Value)
+	}
+	want := map[string]string{"APP_DB_PASSWORD": "s3cr3t", "APP_TOKEN": "t0ken", "APP_DB_HOST": "db", "APP_DB_PORT": "5432"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, got[key])
+		}
+	}
+
+	// A flattened json field may collide with another secret
+	if _, err := c.SaveExportProfile(ctx, &ExportProfile{Name: "clash", Secrets: map[string]string{"DB": "api/db", "DB_HOST": "api/token"}, Uppercase: true, FlattenJSON: true}); err != nil {
+		t.Fatalf("SaveExportProfile failed: %v", err)
+	}
+	clash, _ := c.GetExportProfile(ctx, "clash")
+	if _, err := c.ExportProfileVars(ctx, clash); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Expected two secrets mapping to DB_HOST to be refused, got %v", err)
+	}
+}
+
+func TestStaleSecrets(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "old-token", Value: []byte("x")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "trap", Value: []byte("x"), Canary: true}); err != nil {
+		t.Fatalf("Failed to create canary: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	stale, err := c.StaleSecrets(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("StaleSecrets failed: %v", err)
+	}
+	if len(stale) != 1 || stale[0].ID != secret.ID {
+		t.Fatalf("Expected only the unused secret to be stale, got %+v", stale)
+	}
+
+	c.stale = &stalePolicy{after: time.Millisecond, archive: time.Millisecond}
+	if report, err := c.SweepStaleSecrets(ctx); err != nil || report.Notified != 1 || report.Archived != 0 {
+		t.Fatalf("Expected the owner to be notified first, got %+v, %v", report, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if report, err := c.SweepStaleSecrets(ctx); err != nil || report.Notified != 0 || report.Archived != 1 {
+		t.Fatalf("Expected the secret to be archived after the notice, got %+v, %v", report, err)
+	}
+	if _, err := c.GetSecretValue(ctx, secret.ID); !errors.Is(err, ErrArchived) {
+		t.Errorf("Expected reads of an archived secret to fail, got %v", err)
+	}
+
+	if _, err := c.UnarchiveSecret(ctx, secret.ID); err != nil {
+		t.Fatalf("UnarchiveSecret failed: %v", err)
+	}
+	if _, err := c.GetSecretValue(ctx, secret.ID); err != nil {
+		t.Errorf("Expected the unarchived secret to be readable, got %v", err)
+	}
+	if stale, _ := c.StaleSecrets(ctx, time.Hour); len(stale) != 0 {
+		t.Errorf("Expected unarchiving to count as a use, got %+v", stale)
+	}
+}
+
+// gatedStorage holds batches of audit events until released
+type gatedStorage struct {
+	storage.Storage
+	started chan struct{}
+	release chan struct{}
+}
+
+type gatedAudit struct {
+	repository.AuditRepository
+	s gatedStorage
+}
+
+func (s gatedStorage) Audit() repository.AuditRepository {
+	return gatedAudit{s.Storage.Audit(), s}
+}
+
+func (a gatedAudit) LogEvents(events []*models.AuditEvent) error {
+	select {
+	case a.s.started <- struct{}{}:
+	default:
+	}
+	<-a.s.release
+	return a.AuditRepository.LogEvents(events)
+}
+
+func TestAsyncAudit(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SetAuditQueue(config.AuditConfig{Async: true, WhenFull: "later"}); err == nil {
+		t.Error("Expected an unknown when_full to be rejected")
+	}
+	if err := c.SetAuditQueue(config.AuditConfig{Async: true, BatchSize: 3, FlushIntervalMS: 60000}); err != nil {
+		t.Fatalf("SetAuditQueue failed: %v", err)
+	}
+	events, cancel := c.SubscribeEvents()
+	defer cancel()
+	for i := range 7 {
+		c.recordEvent(ctx, EventSecretRead, nil, fmt.Sprintf("read %d", i))
+	}
+	c.FlushAudit()
+	stored, err := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventSecretRead}})
+	if err != nil || len(stored) != 7 {
+		t.Fatalf("Expected the 7 queued events to be written by the flush, got %d, %v", len(stored), err)
+	}
+	for range 7 {
+		if ev := <-events; ev.ID == 0 {
+			t.Errorf("Expected events to be published once stored, got %+v", ev)
+		}
+	}
+	if stats, ok := c.AuditQueueStats(); !ok || stats.Written != 7 || stats.Depth != 0 || stats.Capacity != DefaultAuditQueueSize {
+		t.Errorf("Unexpected queue stats %+v", stats)
+	}
+
+	// A stalled database fills the queue; with "drop", requests go on
+	gate := gatedStorage{memory.New(), make(chan struct{}, 1), make(chan struct{})}
+	c = NewSecretlyCore(gate, nil)
+	if err := c.SetAuditQueue(config.AuditConfig{Async: true, QueueSize: 2, BatchSize: 1, WhenFull: AuditWhenFullDrop}); err != nil {
+		t.Fatalf("SetAuditQueue failed: %v", err)
+	}
+	c.recordEvent(ctx, EventSecretRead, nil, "taken by the writer")
+	<-gate.started
+	for i := range 5 {
+		c.recordEvent(ctx, EventSecretRead, nil, fmt.Sprintf("read %d", i))
+	}
+	if stats, _ := c.AuditQueueStats(); stats.Depth != 2 || stats.Dropped != 3 {
+		t.Errorf("Expected 2 queued and 3 dropped events, got %+v", stats)
+	}
+	close(gate.release)
+	c.CloseAudit()
+	if stats, _ := c.AuditQueueStats(); stats.Written != 3 || stats.Depth != 0 {
+		t.Errorf("Expected the queued events to be written on close, got %+v", stats)
+	}
+	c.recordEvent(ctx, EventSecretRead, nil, "after close")
+	stored, _ = gate.Audit().ListAfter(repository.AuditQuery{})
+	if len(stored) != 4 || stored[3].Description != "after close" {
+		t.Errorf("Expected events after close to be written directly, got %d", len(stored))
+	}
+}
+
+func TestAuditRequestContext(t *testing.T) {
+	c := newTestCore()
+	c.SetLocalTransport(TransportCLI)
+	client := ClientInfo{IPAddress: "10.0.0.7", UserAgent: "curl/8.5", Transport: TransportHTTP}
+	secret, err := c.CreateSecret(WithClientInfo(context.Background(), client), &CreateSecretRequest{Name: "db", Value: []byte("x")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.GetSecretValue(context.Background(), secret.ID); err != nil {
+		t.Fatalf("Failed to read secret: %v", err)
+	}
+
+	events, err := c.ListAuditEvents(context.Background(), time.Time{}, time.Now().Add(time.Minute))
+	if err != nil || len(events) != 3 {
+		t.Fatalf("Expected three audit events, got %d, %v", len(events), err)
+	}
+	created, read := events[0], events[2]
+	if created.IPAddress != "10.0.0.7" || created.UserAgent != "curl/8.5" || created.Transport != TransportHTTP {
+		t.Errorf("Expected the request context on the create event, got %+v", created)
+	}
+	if read.IPAddress != "" || read.Transport != TransportCLI {
+		t.Errorf("Expected a local read to be recorded as cli, got %+v", read)
+	}
+}
+
+func TestAuthContext(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.GrantPermission(ctx, secret.ID, "bob", AccessRead, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	bob, _ := c.storage.Users().FindByUsername("bob")
+	asBob := WithAuth(ctx, bob, &models.Session{UserID: bob.ID})
+
+	if _, err := c.GetSecretValue(asBob, secret.ID); err != nil {
+		t.Errorf("Expected bob to read with his grant, got %v", err)
+	}
+	if _, err := c.UpdateSecret(asBob, secret.ID, &UpdateSecretRequest{Value: []byte("y")}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the core to refuse bob's update, got %v", err)
+	}
+
+	c.SetLocalActor("")
+	if _, err := c.GetSecret(ctx, secret.ID); !errors.Is(err, ErrNoActor) {
+		t.Errorf("Expected ErrNoActor without an actor, got %v", err)
+	}
+	if _, err := c.UpdateSecret(WithSystemActor(ctx, "test"), secret.ID, &UpdateSecretRequest{Value: []byte("y")}); err != nil {
+		t.Errorf("Expected the system actor to update, got %v", err)
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	shared, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "shared", Value: []byte("x"), CreatedBy: "alice"})
+	private, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "private", Value: []byte("y"), CreatedBy: "alice"})
+	if _, err := c.GrantPermission(ctx, shared.ID, "bob", AccessRead, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	if _, err := c.GrantPermission(ctx, private.ID, "alice", AccessWrite, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	bob, _ := c.storage.Users().FindByUsername("bob")
+	asBob := WithAuth(ctx, bob, &models.Session{UserID: bob.ID})
+
+	listed, total, err := c.ListSecrets(asBob, &ListSecretsFilter{})
+	if err != nil || total != 1 || len(listed) != 1 || listed[0].ID != shared.ID {
+		t.Errorf("Expected bob to list only the shared secret, got %d %+v, %v", total, listed, err)
+	}
+	page, _, err := c.ListSecretsAfter(asBob, &ListSecretsFilter{}, "", 10)
+	if err != nil || len(page) != 1 || page[0].ID != shared.ID {
+		t.Errorf("Expected the cursor listing to be scoped too, got %+v, %v", page, err)
+	}
+
+	c.SetLocalActor("")
+	if _, _, err := c.ListSecrets(ctx, &ListSecretsFilter{}); !errors.Is(err, ErrNoActor) {
+		t.Errorf("Expected listing without an actor to be denied, got %v", err)
+	}
+
+	job := WithSystemActor(ctx, "backup")
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetSecretValue(job, private.ID); err != nil {
+			t.Fatalf("Expected the system actor to read, got %v", err)
+		}
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventAccessBypassed}, SecretID: private.ID})
+	var byJob int
+	for _, e := range events {
+		if strings.Contains(e.Description, "(backup)") {
+			byJob++
+		}
+	}
+	if byJob != 1 {
+		t.Errorf("Expected one bypass event naming the job, got %+v", events)
+	}
+}
+
+func TestRBACApply(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "carol", Password: "pw"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	policy := &RBACPolicy{
+		Users:       []RBACUser{{Username: "alice", Email: "alice@example.com"}, {Username: "carol", Deactivated: true}},
+		Roles:       []RBACRole{{Name: "deployer"}, {Name: "auditor"}},
+		Groups:      []RBACGroup{{Name: "platform", Members: []string{"alice"}}},
+		Assignments: []RBACAssignment{{Role: "deployer", Group: "platform"}, {Role: "auditor", User: "carol"}},
+	}
+	changes, err := c.ApplyRBAC(ctx, policy)
+	if err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+	if len(changes) != 8 {
+		t.Errorf("Expected 8 changes, got %v", changes)
+	}
+	if carol, _ := c.storage.Users().FindByUsername("carol"); carol.DeactivatedAt == nil {
+		t.Error("Expected carol to be deactivated")
+	}
+	if again, err := c.PlanRBAC(ctx, policy); err != nil || len(again) != 0 {
+		t.Errorf("Expected an applied policy to plan no changes, got %v, %v", again, err)
+	}
+
+	policy.Roles = policy.Roles[:1]
+	policy.Assignments = policy.Assignments[:1]
+	policy.Groups[0].Members = []string{}
+	changes, err = c.PlanRBAC(ctx, policy)
+	if err != nil {
+		t.Fatalf("PlanRBAC failed: %v", err)
+	}
+	var lines []string
+	for _, ch := range changes {
+		lines = append(lines, ch.String())
+	}
+	want := []string{"- member platform/alice", "- assignment auditor to user carol", "- role auditor (with its assignments)"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected plan %q, got %q", want, lines)
+	}
+
+	policy.Assignments = append(policy.Assignments, RBACAssignment{Role: "auditor", User: "carol"})
+	if _, err := c.ApplyRBAC(ctx, policy); !errors.Is(err, ErrInvalidRBAC) {
+		t.Errorf("Expected a removed role to be rejected, got %v", err)
+	}
+	bob := &models.User{ID: 99, Username: "bob"}
+	if _, err := c.ApplyRBAC(WithAuth(ctx, bob, &models.Session{UserID: bob.ID}), policy); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected users to be denied, got %v", err)
+	}
+}
+
+func TestRoleTemplates(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := c.SeedRoleTemplates(); err != nil {
+			t.Fatalf("SeedRoleTemplates failed: %v", err)
+		}
+	}
+	roles, err := c.ListRoles(ctx)
+	if err != nil || len(roles) != 5 {
+		t.Fatalf("Expected 5 built-in roles, got %+v, %v", roles, err)
+	}
+	for _, role := range roles {
+		if !role.Builtin || ValidatePermissions(role.Permissions) != nil {
+			t.Errorf("Expected role %q to be built-in with catalog permissions, got %+v", role.Name, role)
+		}
+	}
+
+	bad := &RBACPolicy{Roles: []RBACRole{{Name: "deployer", Permissions: []string{"secrets.launch"}}}}
+	if _, err := c.PlanRBAC(ctx, bad); !errors.Is(err, ErrInvalidRBAC) {
+		t.Errorf("Expected an unknown permission to be rejected, got %v", err)
+	}
+	redefined := &RBACPolicy{Roles: []RBACRole{{Name: "auditor", Permissions: []string{"secrets.read"}}}}
+	if _, err := c.PlanRBAC(ctx, redefined); !errors.Is(err, ErrInvalidRBAC) {
+		t.Errorf("Expected a built-in role to be unchangeable, got %v", err)
+	}
+	policy := &RBACPolicy{
+		Users:       []RBACUser{{Username: "alice"}},
+		Roles:       []RBACRole{},
+		Assignments: []RBACAssignment{{Role: "auditor", User: "alice"}},
+	}
+	changes, err := c.ApplyRBAC(ctx, policy)
+	if err != nil || len(changes) != 2 {
+		t.Errorf("Expected built-in roles to be kept and assignable, got %v, %v", changes, err)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("SeedRoleTemplates failed: %v", err)
+	}
+	as := func(username, role string) context.Context {
+		user, err := c.CreateUser(ctx, &CreateUserRequest{Username: username, Roles: []string{role}})
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", username, err)
+		}
+		return WithAuth(ctx, user, &models.Session{UserID: user.ID})
+	}
+	reader, auditor := as("rita", "read-only"), as("audrey", "auditor")
+	secret, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "rita"})
+
+	if _, err := c.GetSecretValue(reader, secret.ID); err != nil {
+		t.Errorf("Expected the read-only role to read values, got %v", err)
+	}
+	if _, err := c.UpdateSecret(reader, secret.ID, &UpdateSecretRequest{Value: []byte("y")}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the read-only role to be refused writes, even to its own secret, got %v", err)
+	}
+	if err := c.DeleteSecret(reader, secret.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the read-only role to be refused deletes, got %v", err)
+	}
+	if _, err := c.ListAuditEvents(reader, time.Time{}, time.Now()); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the read-only role to be refused the audit log, got %v", err)
+	}
+	if _, err := c.UserAccess(reader, "audrey"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the read-only role to be refused access reports, got %v", err)
+	}
+	if _, err := c.CreateUser(reader, &CreateUserRequest{Username: "mallory"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the read-only role to be refused creating users, got %v", err)
+	}
+
+	if _, _, err := c.ListAuditEventsAfter(auditor, &AuditFilter{}, "", 10); err != nil {
+		t.Errorf("Expected the auditor to read the audit log, got %v", err)
+	}
+	if _, err := c.SecretAccess(auditor, secret.ID); err != nil {
+		t.Errorf("Expected the auditor to read access reports, got %v", err)
+	}
+	if _, err := c.GetSecret(auditor, secret.ID); err != nil {
+		t.Errorf("Expected the auditor to read metadata, got %v", err)
+	}
+	if _, err := c.GetSecretValue(auditor, secret.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the auditor to be refused values, got %v", err)
+	}
+	if !c.HasPermission(ctx, PermissionUsersManage) || c.HasPermission(auditor, PermissionUsersManage) {
+		t.Error("Expected only the system to manage users")
+	}
+}
+
+func TestDenyRules(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	ns := &models.Namespace{Name: "prod"}
+	if err := c.storage.Scopes().CreateNamespace(ns); err != nil {
+		t.Fatalf("Failed to create namespace: %v", err)
+	}
+	policy := &RBACPolicy{
+		Users:       []RBACUser{{Username: "alice"}, {Username: "bob"}},
+		Roles:       []RBACRole{{Name: "break-glass", Permissions: []string{"secrets.list", "secrets.read", "secrets.write", "secrets.delete"}}},
+		Assignments: []RBACAssignment{{Role: "break-glass", User: "bob", NamespaceID: ns.ID}},
+		Deny: []RBACDeny{
+			{Name: "a-no-deletes", Permission: "secrets.delete", NamespaceID: ns.ID, Except: []string{"break-glass"}},
+			{Name: "b-no-writes", Permission: "secrets.write", NamespaceID: ns.ID},
+		},
+	}
+	if _, err := c.ApplyRBAC(ctx, policy); err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), NamespaceID: ns.ID, CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	other, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "dev-db", Value: []byte("y"), CreatedBy: "alice"})
+
+	explanation, err := c.ExplainPermission(ctx, secret.ID, "alice")
+	if err != nil || explanation.Level != AccessRead || explanation.DeniedBy != "b-no-writes" {
+		t.Errorf("Expected the owner's write access to be denied, got %+v, %v", explanation, err)
+	}
+	alice, _ := c.storage.Users().FindByUsername("alice")
+	asAlice := WithAuth(ctx, alice, &models.Session{UserID: alice.ID})
+	if _, err := c.GetSecretValue(asAlice, secret.ID); err != nil {
+		t.Errorf("Expected reads to stay allowed, got %v", err)
+	}
+	if _, err := c.UpdateSecret(asAlice, secret.ID, &UpdateSecretRequest{Value: []byte("z")}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the write to be denied, got %v", err)
+	}
+	if _, err := c.UpdateSecret(asAlice, other.ID, &UpdateSecretRequest{Value: []byte("z")}); err != nil {
+		t.Errorf("Expected writes outside the namespace to be allowed, got %v", err)
+	}
+
+	policy.Deny = policy.Deny[:1]
+	if _, err := c.ApplyRBAC(ctx, policy); err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+	if err := c.DeleteSecret(asAlice, secret.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the delete to be denied, got %v", err)
+	}
+	bob, _ := c.storage.Users().FindByUsername("bob")
+	explanation, err = c.ExplainPermission(ctx, secret.ID, "bob")
+	if err != nil || explanation.DeniedBy != "" {
+		t.Errorf("Expected bob not to be denied, got %+v, %v", explanation, err)
+	}
+	if err := c.DeleteSecret(WithAuth(ctx, bob, &models.Session{UserID: bob.ID}), secret.ID); err != nil {
+		t.Errorf("Expected the break-glass role to be exempt, got %v", err)
+	}
+}
+
+func TestExplainAccess(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	policy := &RBACPolicy{
+		Users:       []RBACUser{{Username: "alice", Email: "alice@example.com"}, {Username: "bob"}},
+		Roles:       []RBACRole{{Name: "break-glass", Permissions: []string{"secrets.list", "secrets.read", "secrets.write", "secrets.delete"}}},
+		Groups:      []RBACGroup{{Name: "oncall", Members: []string{"bob"}}},
+		Assignments: []RBACAssignment{{Role: "break-glass", Group: "oncall"}},
+		Deny:        []RBACDeny{{Name: "no-deletes", Permission: "secrets.delete", Except: []string{"break-glass"}}},
+	}
+	if _, err := c.ApplyRBAC(ctx, policy); err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+	secret, _ := c.CreateSecret(ctx, &CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "alice"})
+
+	d, err := c.ExplainAccess(ctx, "alice@example.com", "secrets.delete", secret.ID)
+	if err != nil {
+		t.Fatalf("ExplainAccess failed: %v", err)
+	}
+	var checks []string
+	for _, step := range d.Trace {
+		checks = append(checks, step.Check+":"+step.Effect)
+	}
+	want := "user:none ownership:allow grants:allow groups:none roles:none deny:deny"
+	if d.Allowed || d.Username != "alice" || strings.Join(checks, " ") != want {
+		t.Errorf("Expected alice's delete to be denied with trace %q, got %v %q", want, d.Allowed, checks)
+	}
+
+	d, err = c.ExplainAccess(ctx, "bob", "secrets.delete", secret.ID)
+	if err != nil || !d.Allowed || len(d.Roles) != 1 || d.Roles[0].Group != "oncall" {
+		t.Errorf("Expected bob to be exempt through the oncall group, got %+v, %v", d, err)
+	}
+	if _, err := c.ExplainAccess(ctx, "bob", "audit.read", secret.ID); !errors.Is(err, ErrInvalidRBAC) {
+		t.Errorf("Expected other actions to be rejected, got %v", err)
+	}
+}
+
+func TestRBACChangeLog(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	policy := &RBACPolicy{Roles: []RBACRole{{Name: "deployer", Permissions: []string{"secrets.read"}}}}
+	if _, err := c.ApplyRBAC(ctx, policy); err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+	policy.Roles[0].Permissions = []string{"secrets.read", "secrets.write"}
+	if _, err := c.ApplyRBAC(ctx, policy); err != nil {
+		t.Fatalf("ApplyRBAC failed: %v", err)
+	}
+
+	changes, next, err := c.ListRBACChanges(ctx, &RBACChangeFilter{Kind: "role", Name: "deployer"}, "", 1)
+	if err != nil || len(changes) != 1 || next == "" {
+		t.Fatalf("Expected one change and a next page, got %+v, %q, %v", changes, next, err)
+	}
+	update := changes[0]
+	if update.Action != "update" || update.Actor == "" || update.AuditEventID == 0 ||
+		!strings.Contains(string(update.Before), `["secrets.read"]`) || !strings.Contains(string(update.After), `"secrets.write"`) {
+		t.Errorf("Expected the update with before and after permissions, got %+v", update)
+	}
+	changes, _, err = c.ListRBACChanges(ctx, &RBACChangeFilter{Kind: "role"}, next, 10)
+	if err != nil || len(changes) != 1 || changes[0].Action != "create" || changes[0].Before != nil {
+		t.Errorf("Expected the creation without a before snapshot on the next page, got %+v, %v", changes, err)
+	}
+}
+
+func TestServiceAccounts(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "pw"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if _, err := c.CreateServiceAccount(ctx, &CreateServiceAccountRequest{Name: "ci", Owner: "alice"}); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	if _, err := c.CreateServiceAccount(ctx, &CreateServiceAccountRequest{Name: "bot", Owner: "ci"}); err == nil {
+		t.Error("Expected a service account owning another to be rejected")
+	}
+	token, _, err := c.IssueServiceToken(ctx, "ci", "github", 0)
+	if err != nil {
+		t.Fatalf("IssueServiceToken failed: %v", err)
+	}
+
+	user, session, err := c.AuthenticateSession(ctx, token)
+	if err != nil || user.Username != "ci" || !IsFederated(session) {
+		t.Fatalf("Expected the token to authenticate ci with a non-personal session, got %v, %v", user, err)
+	}
+	saCtx := WithAuth(ctx, user, session)
+	secret, err := c.CreateSecret(saCtx, &CreateSecretRequest{Name: "deploy-key", Value: []byte("x"), CreatedBy: "ci"})
+	if err != nil {
+		t.Fatalf("Service account could not create a secret: %v", err)
+	}
+	if _, err := c.GetSecretValue(saCtx, secret.ID); err != nil {
+		t.Errorf("Service account could not read its secret: %v", err)
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventSecretCreated}, SecretID: secret.ID})
+	if len(events) != 1 || events[0].ActorKind != ActorServiceAccount {
+		t.Errorf("Expected the creation to be labeled as a service account's, got %+v", events)
+	}
+	if _, _, err := c.Login(ctx, "ci", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected service accounts not to log in, got %v", err)
+	}
+
+	if n, err := c.DisableServiceAccount(ctx, "ci"); err != nil || n != 1 {
+		t.Fatalf("Expected one token revoked, got %d, %v", n, err)
+	}
+	if _, _, err := c.AuthenticateSession(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the token of a disabled account to be rejected, got %v", err)
+	}
+	if _, err := c.CreateServiceAccount(saCtx, &CreateServiceAccountRequest{Name: "x", Owner: "alice"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected sessions not to manage service accounts, got %v", err)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("SeedRoleTemplates failed: %v", err)
+	}
+	for name, roles := range map[string][]string{"root": {"admin"}, "alice": nil} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw", Roles: roles}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	_, login, err := c.Login(ctx, "root", "pw")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	root, _ := c.storage.Users().FindByUsername("root")
+	adminCtx := WithAuth(ctx, root, login)
+	if _, _, err := c.Impersonate(adminCtx, "alice", "ticket 1", 0); !errors.Is(err, ErrImpersonationDisabled) {
+		t.Fatalf("Expected impersonation to be disabled by default, got %v", err)
+	}
+
+	c.SetImpersonation(config.ImpersonationConfig{Enabled: true, MaxMinutes: 30})
+	_, aliceLogin, _ := c.Login(ctx, "alice", "pw")
+	aliceUser, _ := c.storage.Users().FindByUsername("alice")
+	if _, _, err := c.Impersonate(WithAuth(ctx, aliceUser, aliceLogin), "root", "ticket 1", 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected users without users.manage to be refused, got %v", err)
+	}
+	if _, _, err := c.Impersonate(adminCtx, "alice", "", 0); err == nil {
+		t.Error("Expected impersonation without a reason to be rejected")
+	}
+	if _, _, err := c.Impersonate(adminCtx, "alice", "ticket 1", time.Hour); err == nil {
+		t.Error("Expected impersonation beyond max_minutes to be rejected")
+	}
+	token, _, err := c.Impersonate(adminCtx, "alice", "ticket 1", 0)
+	if err != nil {
+		t.Fatalf("Impersonate failed: %v", err)
+	}
+	user, session, err := c.AuthenticateSession(ctx, token)
+	if err != nil || user.Username != "alice" || !IsFederated(session) {
+		t.Fatalf("Expected the token to authenticate alice with a non-personal session, got %v, %v", user, err)
+	}
+	if session.ExpiresAt.After(time.Now().Add(DefaultImpersonationTTL)) {
+		t.Errorf("Expected the session to last %s, expires %s", DefaultImpersonationTTL, session.ExpiresAt)
+	}
+	asAlice := WithAuth(ctx, user, session)
+	secret, err := c.CreateSecret(asAlice, &CreateSecretRequest{Name: "k", Value: []byte("x"), CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Impersonation session could not create a secret: %v", err)
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventSecretCreated}, SecretID: secret.ID})
+	if len(events) != 1 || events[0].ImpersonatorID == nil || *events[0].ImpersonatorID != root.ID {
+		t.Errorf("Expected the creation to name the admin, got %+v", events)
+	}
+	if _, _, err := c.Impersonate(asAlice, "root", "again", 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected an impersonation session not to impersonate, got %v", err)
+	}
+
+	c.SetImpersonation(config.ImpersonationConfig{})
+	if _, _, err := c.AuthenticateSession(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected disabling impersonation to end the session, got %v", err)
+	}
+}
+
+type fakeEngine struct{ issued int }
+
+func (e *fakeEngine) Info() engine.Info {
+	return engine.Info{Name: "fake", Version: "1", Protocol: engine.ProtocolVersion, Capabilities: []string{engine.CapabilityIssue}}
+}
+
+func (e *fakeEngine) Issue(ctx context.Context, req engine.IssueRequest) (*engine.Credential, error) {
+	e.issued++
+	return &engine.Credential{Value: map[string]string{"password": "minted"}, LeaseID: "lease-1"}, nil
+}
+
+func (e *fakeEngine) Revoke(ctx context.Context, leaseID string) error {
+	return nil
+}
+
+func TestSecretEngines(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.ListEngines(ctx); !errors.Is(err, ErrEnginesDisabled) {
+		t.Fatalf("Expected engines to be disabled by default, got %v", err)
+	}
+	fake := &fakeEngine{}
+	registry := engine.NewRegistry()
+	if err := registry.Register(fake); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	c.SetEngines(registry, map[string][]string{"fake": {"alice"}})
+
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("SeedRoleTemplates failed: %v", err)
+	}
+	for name, roles := range map[string][]string{"alice": nil, "bob": nil, "olga": {"operator"}} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw", Roles: roles}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	asUser := func(name string) context.Context {
+		_, session, err := c.Login(ctx, name, "pw")
+		if err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+		user, _ := c.storage.Users().FindByUsername(name)
+		return WithAuth(ctx, user, session)
+	}
+
+	alice := asUser("alice")
+	cred, err := c.IssueEngineCredential(alice, "fake", engine.IssueRequest{Role: "reader", Params: map[string]string{"db": "orders"}})
+	if err != nil || cred.Value["password"] != "minted" {
+		t.Fatalf("Expected alice to be issued a credential, got %v, %v", cred, err)
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventEngineCredentialIssued}})
+	if len(events) != 1 || events[0].UserID == nil || strings.Contains(events[0].Description, "minted") || !strings.Contains(events[0].Description, "lease-1") {
+		t.Errorf("Expected the issue to be audited without the credential, got %+v", events)
+	}
+	if err := c.RevokeEngineLease(alice, "fake", "lease-1"); !errors.Is(err, engine.ErrUnsupported) {
+		t.Errorf("Expected revoke to be unsupported, got %v", err)
+	}
+
+	bob := asUser("bob")
+	if _, err := c.IssueEngineCredential(bob, "fake", engine.IssueRequest{Role: "reader"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected bob to be denied, got %v", err)
+	}
+	if infos, err := c.ListEngines(bob); err != nil || len(infos) != 0 {
+		t.Errorf("Expected bob to see no engines, got %v, %v", infos, err)
+	}
+	if infos, err := c.ListEngines(asUser("olga")); err != nil || len(infos) != 1 {
+		t.Errorf("Expected holders of system.manage to see every engine, got %v, %v", infos, err)
+	}
+	if _, err := c.IssueEngineCredential(alice, "other", engine.IssueRequest{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an unknown engine to be not found, got %v", err)
+	}
+	if fake.issued != 1 {
+		t.Errorf("Expected the engine to be called once, got %d", fake.issued)
+	}
+}
+
+func TestScheduledReleases(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	c.SetReleases(config.ReleasesConfig{Enabled: true, NotifyDaysBefore: 1}, nil)
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	var secrets []*models.SecretNode
+	for _, name := range []string{"will", "nas", "vpn"} {
+		secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Value: []byte("x")})
+		if err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+		if secret, err = c.TransferOwnership(ctx, secret.ID, "alice", "test"); err != nil {
+			t.Fatalf("TransferOwnership failed: %v", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	bob, _ := c.storage.Users().FindByUsername("bob")
+	grantOf := func(secretID uint) string {
+		grants, _ := c.storage.Grants().ListByNode(secretID)
+		for _, g := range grants {
+			if g.UserID == bob.ID {
+				return g.Level
+			}
+		}
+		return ""
+	}
+
+	past, soon := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for name, req := range map[string]*ScheduleReleaseRequest{
+		"neither condition": {Recipient: "bob"},
+		"both conditions":   {Recipient: "bob", ReleaseAt: &soon, InactivityDays: 30},
+		"past time":         {Recipient: "bob", ReleaseAt: &past},
+		"owner recipient":   {Recipient: "alice", ReleaseAt: &soon},
+	} {
+		if _, err := c.ScheduleRelease(ctx, secrets[0].ID, req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	timed, err := c.ScheduleRelease(ctx, secrets[0].ID, &ScheduleReleaseRequest{Recipient: "bob", ReleaseAt: &soon, Note: "See the letter"})
+	if err != nil {
+		t.Fatalf("ScheduleRelease failed: %v", err)
+	}
+	inactive, err := c.ScheduleRelease(ctx, secrets[1].ID, &ScheduleReleaseRequest{Recipient: "bob", InactivityDays: 30})
+	if err != nil {
+		t.Fatalf("ScheduleRelease failed: %v", err)
+	}
+	cancelled, err := c.ScheduleRelease(ctx, secrets[2].ID, &ScheduleReleaseRequest{Recipient: "bob", InactivityDays: 30})
+	if err != nil {
+		t.Fatalf("ScheduleRelease failed: %v", err)
+	}
+	if _, err := c.CancelRelease(ctx, cancelled.ID); err != nil {
+		t.Fatalf("CancelRelease failed: %v", err)
+	}
+	if _, err := c.CancelRelease(ctx, cancelled.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected cancelling twice to conflict, got %v", err)
+	}
+
+	if report, err := c.SweepReleases(ctx); err != nil || report.Warned != 1 || report.Released != 0 {
+		t.Fatalf("Expected the owner to be warned of the timed release only, got %+v, %v", report, err)
+	}
+
+	// the timed release falls due, and alice has been away for 31 days
+	timed.ReleaseAt = &past
+	inactive.CreatedAt = time.Now().Add(-31 * 24 * time.Hour)
+	_ = c.storage.Releases().Update(timed)
+	_ = c.storage.Releases().Update(inactive)
+	if report, err := c.SweepReleases(ctx); err != nil || report.Released != 2 {
+		t.Fatalf("Expected both releases to happen, got %+v, %v", report, err)
+	}
+	if grantOf(secrets[0].ID) != AccessRead || grantOf(secrets[1].ID) != AccessRead || grantOf(secrets[2].ID) != "" {
+		t.Errorf("Expected bob to read the released secrets only")
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventSecretReleased}, UserID: bob.ID})
+	if len(events) != 2 {
+		t.Errorf("Expected two audited releases to bob, got %d", len(events))
+	}
+	if report, err := c.SweepReleases(ctx); err != nil || report.Released != 0 {
+		t.Errorf("Expected releases to happen once, got %+v, %v", report, err)
+	}
+
+	// logging in postpones a dead man's switch
+	again, err := c.ScheduleRelease(ctx, secrets[2].ID, &ScheduleReleaseRequest{Recipient: "bob", InactivityDays: 30})
+	if err != nil {
+		t.Fatalf("ScheduleRelease failed: %v", err)
+	}
+	again.CreatedAt = time.Now().Add(-31 * 24 * time.Hour)
+	_ = c.storage.Releases().Update(again)
+	if _, _, err := c.Login(ctx, "alice", "pw"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if report, err := c.SweepReleases(ctx); err != nil || report.Released != 0 {
+		t.Errorf("Expected the owner's login to postpone the release, got %+v, %v", report, err)
+	}
+	releases, err := c.ListReleases(ctx, secrets[2].ID)
+	if err != nil || len(releases) != 2 {
+		t.Fatalf("Expected two releases of the secret, got %v, %v", releases, err)
+	}
+	for _, r := range releases {
+		if r.ID == again.ID && (r.DueAt == nil || r.DueAt.Before(time.Now().Add(29*24*time.Hour))) {
+			t.Errorf("Expected the release to be due 30 days after the login, got %v", r.DueAt)
+		}
+	}
+}
+
+func TestEscrowRecovery(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	c.SetEscrow(config.EscrowConfig{Enabled: true})
+	users := map[string]context.Context{}
+	privateKeys := map[string][]byte{}
+	for _, name := range []string{"bob", "carol", "dave", "erin"} {
+		if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: name, Password: "pw"}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+		_, session, err := c.Login(ctx, name, "pw")
+		if err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+		user, _ := c.storage.Users().FindByUsername(name)
+		users[name] = WithAuth(ctx, user, session)
+	}
+	secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: "root-password", Value: []byte("hunter2")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	custodians := []string{"carol", "dave", "erin"}
+	if _, err := c.CreateEscrow(ctx, secret.ID, custodians, 2); err == nil {
+		t.Fatal("Expected custodians without escrow keys to be rejected")
+	}
+	for _, name := range custodians {
+		pub, priv, err := escrow.GenerateKey()
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		if err := c.SetEscrowKey(users[name], pub); err != nil {
+			t.Fatalf("SetEscrowKey failed: %v", err)
+		}
+		privateKeys[name] = priv
+	}
+	e, err := c.CreateEscrow(ctx, secret.ID, custodians, 2)
+	if err != nil {
+		t.Fatalf("CreateEscrow failed: %v", err)
+	}
+
+	recovery, err := c.RequestRecovery(users["bob"], e.ID, "lost the vault")
+	if err != nil {
+		t.Fatalf("RequestRecovery failed: %v", err)
+	}
+	openShare := func(name string) []byte {
+		sealed, err := c.RecoveryShare(users[name], recovery.ID)
+		if err != nil {
+			t.Fatalf("RecoveryShare failed: %v", err)
+		}
+		share, err := escrow.Open(sealed.Sealed, privateKeys[name])
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		return share
+	}
+	if _, err := c.RecoveryShare(users["bob"], recovery.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected the requester to hold no share, got %v", err)
+	}
+	carol := openShare("carol")
+	if _, err := c.ApproveRecovery(users["dave"], recovery.ID, carol); !errors.Is(err, escrow.ErrInvalidShares) {
+		t.Errorf("Expected another custodian's share to be rejected, got %v", err)
+	}
+	if r, err := c.ApproveRecovery(users["carol"], recovery.ID, carol); err != nil || r.Status != RecoveryPending {
+		t.Fatalf("Expected one approval to leave the recovery pending, got %+v, %v", r, err)
+	}
+	if _, err := c.ApproveRecovery(users["carol"], recovery.ID, carol); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a second approval by carol to conflict, got %v", err)
+	}
+	if _, err := c.CollectRecovery(users["bob"], recovery.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected nothing to collect before the threshold, got %v", err)
+	}
+	if r, err := c.ApproveRecovery(users["erin"], recovery.ID, openShare("erin")); err != nil || r.Status != RecoveryRecovered {
+		t.Fatalf("Expected two approvals to recover the value, got %+v, %v", r, err)
+	}
+	if _, err := c.CollectRecovery(users["carol"], recovery.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected only the requester to collect, got %v", err)
+	}
+	value, err := c.CollectRecovery(users["bob"], recovery.ID)
+	if err != nil || string(value) != "hunter2" {
+		t.Fatalf("Expected bob to collect the value, got %q, %v", value, err)
+	}
+	if _, err := c.CollectRecovery(users["bob"], recovery.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected the value to be collected once, got %v", err)
+	}
+
+	entries, report, err := c.EscrowLog(ctx, e.ID)
+	if err != nil || !report.Valid || len(entries) != 6 {
+		t.Fatalf("Expected a valid log with six entries for the escrow, got %d, %+v, %v", len(entries), report, err)
+	}
+	if _, _, err := c.EscrowLog(users["bob"], 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected users other than admins to be denied the log, got %v", err)
+	}
+	forged := &models.EscrowLogEntry{EscrowID: e.ID, Action: "collected", Actor: "mallory", PrevHash: entries[len(entries)-1].Hash, Hash: "forged"}
+	_ = c.storage.Escrows().AppendLog(forged)
+	if _, report, _ := c.EscrowLog(ctx, 0); report.Valid || report.BrokenAt != forged.ID {
+		t.Errorf("Expected the forged entry to break the chain, got %+v", report)
+	}
+}
+
+func TestGitOpsReconcile(t *testing.T) {
+	c := newTestCore()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "pw"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	for _, name := range []string{"db-password", "legacy"} {
+		if _, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: name, Type: "password", Value: []byte("x")}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	manifest, err := gitops.Parse([]byte(`
+secrets:
+  - path: payments/stripe-key
+    owner: alice
+    tags: [critical]
+  - path: db-password
+    type: api_key
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := gitops.Parse([]byte("secrets:\n  - path: leak\n    value: hunter2\n")); !errors.Is(err, gitops.ErrValueInManifest) {
+		t.Errorf("Expected a manifest with a value to be rejected, got %v", err)
+	}
+
+	c.SetGitOps(config.GitOpsConfig{Enabled: true, CreatePlaceholders: true})
+	c.gitops.fetch = func(context.Context) (*gitops.Manifest, string, error) { return manifest, "abc123", nil }
+
+	plan, err := c.PlanGitOps(ctx, manifest)
+	if err != nil || plan.Secrets[0].State != GitOpsMissing {
+		t.Fatalf("Expected the plan to report a missing secret, got %+v, %v", plan, err)
+	}
+	report, err := c.SyncGitOps(ctx)
+	if err != nil {
+		t.Fatalf("SyncGitOps failed: %v", err)
+	}
+	stripe, db := report.Secrets[0], report.Secrets[1]
+	if stripe.State != GitOpsCreated || !stripe.AwaitingValue {
+		t.Errorf("Expected a placeholder to be created, got %+v", stripe)
+	}
+	if db.State != GitOpsDrifted || len(db.Drift) != 1 || db.Drift[0].Field != "type" {
+		t.Errorf("Expected the type of db-password to drift, got %+v", db)
+	}
+	if len(report.Unmanaged) != 1 || report.Unmanaged[0].Path != "legacy" {
+		t.Errorf("Expected legacy to be unmanaged, got %+v", report.Unmanaged)
+	}
+
+	placeholder, _ := c.storage.Secrets().GetByID(stripe.SecretID)
+	if placeholder.Owner != "alice" || placeholder.ParentID == nil || !slices.Equal(SecretTags(placeholder), []string{"critical"}) {
+		t.Errorf("Expected the placeholder to follow the manifest, got %+v", placeholder)
+	}
+	if _, err := c.GetSecretValue(ctx, stripe.SecretID); !errors.Is(err, ErrPlaceholder) {
+		t.Errorf("Expected reading a placeholder to fail, got %v", err)
+	}
+	if _, err := c.UpdateSecret(ctx, stripe.SecretID, &UpdateSecretRequest{Value: []byte("sk_live")}); err != nil {
+		t.Fatalf("Failed to set the value of the placeholder: %v", err)
+	}
+	if value, err := c.GetSecretValue(ctx, stripe.SecretID); err != nil || string(value) != "sk_live" {
+		t.Errorf("Expected the placeholder's value, got %q, %v", value, err)
+	}
+
+	report, err = c.SyncGitOps(ctx)
+	if err != nil {
+		t.Fatalf("SyncGitOps failed: %v", err)
+	}
+	if s := report.Secrets[0]; s.State != GitOpsInSync || s.AwaitingValue {
+		t.Errorf("Expected the secret to be in sync with its value set, got %+v", s)
+	}
+	events, _ := c.storage.Audit().ListAfter(repository.AuditQuery{Types: []string{EventGitOpsDrift}})
+	if len(events) != 1 {
+		t.Errorf("Expected the drift to be audited once, got %d events", len(events))
+	}
+
+	c.gitops.fetch = func(context.Context) (*gitops.Manifest, string, error) { return nil, "", errors.New("unreachable") }
+	if _, err := c.SyncGitOps(ctx); err == nil {
+		t.Fatal("Expected the sync to fail")
+	}
+	if status, err := c.GitOpsStatus(ctx); err != nil || status.Error == "" || status.Commit != "abc123" {
+		t.Errorf("Expected the last report with the failure, got %+v, %v", status, err)
+	}
+}
+
+// benchmarkCore returns a core with secrets secrets, half of them in a
+// folder with grants, so that listings check inherited access
+func benchmarkCore(b *testing.B, secrets int) (*SecretlyCore, context.Context) {
+	b.Helper()
+	c := newTestCore()
+	ctx := context.Background()
+	user, err := c.CreateUser(ctx, &CreateUserRequest{Username: "alice", Password: "pw"})
+	if err != nil {
+		b.Fatalf("Failed to create user: %v", err)
+	}
+	folder, _ := c.CreateFolder(ctx, &CreateFolderRequest{Name: "apps"})
+	if _, err := c.GrantPermission(ctx, folder.ID, "alice", AccessRead, "test"); err != nil {
+		b.Fatalf("GrantPermission failed: %v", err)
+	}
+	for i := range secrets {
+		req := &CreateSecretRequest{Name: fmt.Sprintf("key-%04d", i), Value: []byte("value")}
+		if i%2 == 0 {
+			req.ParentID = &folder.ID
+		}
+		if _, err := c.CreateSecret(ctx, req); err != nil {
+			b.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	return c, WithAuth(ctx, user, &models.Session{UserID: user.ID})
+}
+
+// The write benchmarks delete what they create outside the timer, since
+// memory storage scans its maps and copies them for each transaction. The
+// audit log still grows, so expect ns/op to rise with -benchtime.
+func BenchmarkCreateSecret(b *testing.B) {
+	c, _ := benchmarkCore(b, 0)
+	ctx := context.Background()
+	value := bytes.Repeat([]byte("x"), 256)
+	b.ResetTimer()
+	for i := range b.N {
+		secret, err := c.CreateSecret(ctx, &CreateSecretRequest{Name: fmt.Sprintf("bench-%d", i), Value: value})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		if err := c.DeleteSecret(ctx, secret.ID); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkGetSecretValue(b *testing.B) {
+	c, asAlice := benchmarkCore(b, 10)
+	secret, _ := c.FindSecret(context.Background(), &ListSecretsFilter{}, "key-0003")
+	b.ResetTimer()
+	for range b.N {
+		if _, err := c.GetSecretValue(asAlice, secret.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateSecret(b *testing.B) {
+	c, _ := benchmarkCore(b, 0)
+	ctx := context.Background()
+	var secret *models.SecretNode
+	b.ResetTimer()
+	for i := range b.N {
+		if i%100 == 0 {
+			b.StopTimer()
+			if secret != nil {
+				if err := c.DeleteSecret(ctx, secret.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+			var err error
+			if secret, err = c.CreateSecret(ctx, &CreateSecretRequest{Name: fmt.Sprintf("bench-%d", i), Value: []byte("v")}); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+		}
+		if _, err := c.UpdateSecret(ctx, secret.ID, &UpdateSecretRequest{Value: []byte(strconv.Itoa(i))}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListSecrets(b *testing.B) {
+	c, asAlice := benchmarkCore(b, 1000)
+	b.ResetTimer()
+	for range b.N {
+		if _, total, err := c.ListSecrets(asAlice, &ListSecretsFilter{Sort: "name", Page: 2, PageSize: 50}); err != nil || total != 1000 {
+			b.Fatalf("ListSecrets returned %d, %v", total, err)
+		}
+	}
+}
+
+func BenchmarkRecordEvent(b *testing.B) {
+	for _, async := range []bool{false, true} {
+		b.Run(fmt.Sprintf("async=%t", async), func(b *testing.B) {
+			c := newTestCore()
+			if err := c.SetAuditQueue(config.AuditConfig{Async: async}); err != nil {
+				b.Fatal(err)
+			}
+			defer c.CloseAudit()
+			ctx := context.Background()
+			for range b.N {
+				c.recordEvent(ctx, EventSecretRead, nil, "read")
+			}
+		})
+	}
+}
+
+// perfBudgets are generous upper bounds on the time per operation of the
+// benchmarks, against memory storage, that catch regressions such as a
+// listing going back to queries per secret. They run with
+// SECRETLY_PERF_BUDGETS=1, e.g. in a dedicated CI job on stable hardware.
+var perfBudgets = []struct {
+	name   string
+	bench  func(*testing.B)
+	budget time.Duration
+}{
+	{"CreateSecret", BenchmarkCreateSecret, 25 * time.Millisecond},
+	{"GetSecretValue", BenchmarkGetSecretValue, 200 * time.Microsecond},
+	{"UpdateSecret", BenchmarkUpdateSecret, 2 * time.Millisecond},
+	{"ListSecrets", BenchmarkListSecrets, 20 * time.Millisecond},
+}
+
+func TestPerformanceBudgets(t *testing.T) {
+	if os.Getenv("SECRETLY_PERF_BUDGETS") == "" {
+		t.Skip("set SECRETLY_PERF_BUDGETS=1 to check performance budgets")
+	}
+	for _, p := range perfBudgets {
+		result := testing.Benchmark(p.bench)
+		perOp := time.Duration(result.NsPerOp())
+		t.Logf("%s: %s per op over %d runs", p.name, perOp, result.N)
+		if perOp > p.budget {
+			t.Errorf("%s takes %s per op, over its budget of %s", p.name, perOp, p.budget)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Cursor page size bounds
+const (
+	DefaultCursorLimit = 50
+	MaxCursorLimit     = 1000
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or was issued for
+// a different listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of the opaque cursors handed out to clients.
+// Kind prevents a secrets cursor from being replayed against users.
+type cursor struct {
+	Kind   string `json:"k"`
+	LastID uint   `json:"id"`
+}
+
+func encodeCursor(kind string, lastID uint) string {
+	data, _ := json.Marshal(cursor{Kind: kind, LastID: lastID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the last seen ID; an empty cursor starts from the beginning
+func decodeCursor(kind, value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Kind != kind {
+		return 0, ErrInvalidCursor
+	}
+	return c.LastID, nil
+}
+
+func cursorLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultCursorLimit
+	}
+	if limit > MaxCursorLimit {
+		return MaxCursorLimit
+	}
+	return limit
+}
+
+// ListSecretsAfter returns up to limit secrets matching the filter that follow
+// cursor, and the cursor of the next page ("" on the last page). Unlike
+// ListSecrets it does not count matches and its cost does not grow with the
+// page depth. Page and PageSize in the filter are ignored. Secrets the actor
+// in ctx may not read are left out, so a page may be short.
+func (c *SecretlyCore) ListSecretsAfter(ctx context.Context, filter *ListSecretsFilter, after string, limit int) ([]models.SecretNode, string, error) {
+	lastID, err := decodeCursor("secrets", after)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = cursorLimit(limit)
+	scoped := *filter
+	if err := c.ScopeFilter(ctx, &scoped); err != nil {
+		return nil, "", err
+	}
+	isSecret := !scoped.Folders
+
+	// Fetch one extra row to learn whether another page exists
+	secrets, err := c.storage.Secrets().ListAfter(repository.SecretQuery{
+		NamespaceID:   scoped.NamespaceID,
+		ZoneID:        scoped.ZoneID,
+		EnvironmentID: scoped.EnvironmentID,
+		Type:          scoped.Type,
+		IsSecret:      &isSecret,
+		AfterID:       lastID,
+		Limit:         limit + 1,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	next := ""
+	if len(secrets) > limit {
+		secrets = secrets[:limit]
+		next = encodeCursor("secrets", secrets[limit-1].ID)
+	}
+	return c.readableSecrets(ctx, secrets), next, nil
+}
+
+// ListUsersAfter returns up to limit users following cursor and the cursor of
+// the next page ("" on the last page)
+func (c *SecretlyCore) ListUsersAfter(ctx context.Context, after string, limit int) ([]models.User, string, error) {
+	lastID, err := decodeCursor("users", after)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = cursorLimit(limit)
+
+	users, err := c.storage.Users().ListAfter(lastID, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list users: %w", err)
+	}
+
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	return users, encodeCursor("users", users[limit-1].ID), nil
+}
+
+// AuditFilter narrows ListAuditEventsAfter; zero values mean "no filter".
+// Events are returned newest first when Descending is set.
+type AuditFilter struct {
+	From       time.Time
+	To         time.Time
+	Types      []string
+	Username   string
+	SecretID   uint
+	Descending bool
+}
+
+// ListAuditEventsAfter returns up to limit audit events matching the filter
+// that follow cursor, and the cursor of the next page ("" on the last page)
+func (c *SecretlyCore) ListAuditEventsAfter(ctx context.Context, filter *AuditFilter, after string, limit int) ([]Event, string, error) {
+	if err := c.requirePermission(ctx, PermissionAuditRead, "reading the audit log"); err != nil {
+		return nil, "", err
+	}
+	// The order is part of the kind so a cursor cannot flip direction
+	kind := "audit"
+	if filter.Descending {
+		kind = "audit-desc"
+	}
+	lastID, err := decodeCursor(kind, after)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = cursorLimit(limit)
+
+	q := repository.AuditQuery{
+		From:       filter.From,
+		To:         filter.To,
+		Types:      filter.Types,
+		SecretID:   filter.SecretID,
+		AfterID:    lastID,
+		Descending: filter.Descending,
+		Limit:      limit + 1,
+	}
+	if filter.Username != "" {
+		user, err := c.storage.Users().FindByUsername(filter.Username)
+		if errors.Is(err, ErrNotFound) {
+			return []Event{}, "", nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to look up user %q: %w", filter.Username, err)
+		}
+		q.UserID = user.ID
+	}
+
+	records, err := c.storage.Audit().ListAfter(q)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list audit events: %w", err)
+	}
+	next := ""
+	if len(records) > limit {
+		records = records[:limit]
+		next = encodeCursor(kind, records[limit-1].ID)
+	}
+
+	namespaces := make(map[uint]uint)
+	events := make([]Event, 0, len(records))
+	for i := range records {
+		events = append(events, c.newEvent(&records[i], namespaces))
+	}
+	return events, next, nil
+}
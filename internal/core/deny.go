@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Permissions checked against roles and deny rules when accessing secrets
+const (
+	PermissionSecretsList     = "secrets.list"
+	PermissionSecretsRead     = "secrets.read"
+	PermissionSecretsWrite    = "secrets.write"
+	PermissionSecretsDelete   = "secrets.delete"
+	PermissionSecretsShare    = "secrets.share"
+	PermissionSecretsCheckout = "secrets.checkout"
+)
+
+// HeldRole is a role a user holds, directly or through a group
+type HeldRole struct {
+	Role string `json:"role"`
+	// Group is the group the role is assigned to, empty for a direct
+	// assignment
+	Group       string `json:"group,omitempty"`
+	NamespaceID *uint  `json:"namespace_id,omitempty"`
+}
+
+// DenyMatch is a deny rule that applies to a user, or that the user is
+// exempt from through one of its except roles
+type DenyMatch struct {
+	Rule       string `json:"rule"`
+	Permission string `json:"permission"`
+	// ExemptBy is the role that exempts the user, empty when the rule
+	// denies
+	ExemptBy string `json:"exempt_by,omitempty"`
+}
+
+// heldRoles returns the roles of the user with userID that apply in
+// namespaceID: assigned everywhere or in that namespace, directly or to one
+// of the user's groups. Namespace 0 only matches assignments everywhere.
+func (c *SecretlyCore) heldRoles(userID, namespaceID uint) ([]HeldRole, error) {
+	return c.heldRolesWhere(userID, func(ns *uint) bool { return ns == nil || *ns == namespaceID })
+}
+
+// heldRolesWhere returns the roles of the user with userID whose
+// assignment's namespace passes applies
+func (c *SecretlyCore) heldRolesWhere(userID uint, applies func(namespaceID *uint) bool) ([]HeldRole, error) {
+	rbac := c.storage.RBAC()
+	roles, err := rbac.ListRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	roleNames := make(map[uint]string, len(roles))
+	for _, role := range roles {
+		roleNames[role.ID] = role.Name
+	}
+
+	var held []HeldRole
+	userRoles, err := rbac.ListUserRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	for _, a := range userRoles {
+		if a.UserID == userID && applies(a.NamespaceID) {
+			held = append(held, HeldRole{Role: roleNames[a.RoleID], NamespaceID: a.NamespaceID})
+		}
+	}
+
+	members, err := rbac.ListMembers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	var groupIDs []uint
+	for _, m := range members {
+		if m.UserID == userID {
+			groupIDs = append(groupIDs, m.GroupID)
+		}
+	}
+	if len(groupIDs) == 0 {
+		return held, nil
+	}
+	groups, err := rbac.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	groupNames := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+	groupRoles, err := rbac.ListGroupRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	for _, a := range groupRoles {
+		if slices.Contains(groupIDs, a.GroupID) && applies(a.NamespaceID) {
+			held = append(held, HeldRole{Role: roleNames[a.RoleID], Group: groupNames[a.GroupID], NamespaceID: a.NamespaceID})
+		}
+	}
+	return held, nil
+}
+
+// userGroups returns the names of the groups the user with userID is in
+func (c *SecretlyCore) userGroups(userID uint) ([]string, error) {
+	members, err := c.storage.RBAC().ListMembers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	groups, err := c.storage.RBAC().ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var names []string
+	for _, m := range members {
+		if m.UserID != userID {
+			continue
+		}
+		for _, group := range groups {
+			if group.ID == m.GroupID {
+				names = append(names, group.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// matchDeny checks the deny rules on permission in namespaceID for the
+// user with userID, in name order. It returns the rules the user is exempt
+// from up to the first that denies, which is last and has no ExemptBy.
+func (c *SecretlyCore) matchDeny(userID, namespaceID uint, permission string) ([]DenyMatch, error) {
+	rules, err := c.storage.RBAC().ListDenyRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deny rules: %w", err)
+	}
+	rules = slices.DeleteFunc(rules, func(rule models.DenyRule) bool {
+		return rule.Permission != permission || (rule.NamespaceID != nil && *rule.NamespaceID != namespaceID)
+	})
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	groups, err := c.userGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+	held, err := c.heldRoles(userID, namespaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DenyMatch
+	for _, rule := range rules {
+		if rule.Group != "" && !slices.Contains(groups, rule.Group) {
+			continue
+		}
+		match := DenyMatch{Rule: rule.Name, Permission: permission}
+		for _, role := range held {
+			if slices.Contains(splitPermissions(rule.ExceptRoles), role.Role) {
+				match.ExemptBy = role.Role
+				break
+			}
+		}
+		matches = append(matches, match)
+		if match.ExemptBy == "" {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// denied returns the rule that denies in matches, if any
+func denied(matches []DenyMatch) *DenyMatch {
+	if len(matches) > 0 && matches[len(matches)-1].ExemptBy == "" {
+		return &matches[len(matches)-1]
+	}
+	return nil
+}
+
+// checkDenied checks the deny rules on permission for the user of the
+// actor in ctx. System actors and sessions without a user are not subject
+// to deny rules.
+func (c *SecretlyCore) checkDenied(ctx context.Context, secret *models.SecretNode, permission string) error {
+	session, err := c.actorSession(ctx)
+	if err != nil || session == nil || session.UserID == 0 {
+		return err
+	}
+	matches, err := c.matchDeny(session.UserID, secret.NamespaceID, permission)
+	if err != nil {
+		return err
+	}
+	if rule := denied(matches); rule != nil {
+		secretID := secret.ID
+		c.recordUserEvent(ctx, EventAccessDenied, &session.UserID, &secretID, fmt.Sprintf("Deny rule %q denied %s on secret %q to user %d",
+			rule.Rule, permission, secret.Name, session.UserID))
+		return fmt.Errorf("%w: deny rule %q denies %s", ErrPermissionDenied, rule.Rule, permission)
+	}
+	return nil
+}
+
+// describeExcept formats except roles for plan lines
+func describeExcept(roles []string) string {
+	if len(roles) == 0 {
+		return ""
+	}
+	return "except " + strings.Join(roles, ", ")
+}
@@ -0,0 +1,370 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/device"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for devices
+const (
+	EventDeviceEnrolled = "device_enrolled"
+	EventDeviceRevoked  = "device_revoked"
+)
+
+const (
+	// DefaultDeviceCertificateDays applies when auth.devices does not set
+	// certificate_days
+	DefaultDeviceCertificateDays = 90
+	// DefaultEnrollmentTokenTTL applies when an admin does not choose how
+	// long an enrollment token lasts
+	DefaultEnrollmentTokenTTL = 24 * time.Hour
+	// MaxEnrollmentTokenTTL bounds how long an enrollment token lasts
+	MaxEnrollmentTokenTTL = 7 * 24 * time.Hour
+
+	// deviceScopePrefix starts the scope of device sessions; the device ID
+	// follows
+	deviceScopePrefix   = "device:"
+	deviceChallengeTTL  = 5 * time.Minute
+	maxDeviceChallenges = 1000
+	deviceCACertKey     = "device_ca_certificate"
+	deviceCAKeyKey      = "device_ca_key"
+)
+
+// ErrDevicesDisabled is returned when machine enrollment is not configured
+var ErrDevicesDisabled = errors.New("device enrollment is not enabled")
+
+type devicePolicy struct {
+	certTTL time.Duration
+
+	mu         sync.Mutex
+	ca         *device.CA
+	challenges map[string]time.Time
+}
+
+// EnrollmentTokenRequest describes the device that may enroll with a token
+type EnrollmentTokenRequest struct {
+	Name        string
+	Username    string
+	NamespaceID uint
+	ReadOnly    bool
+	TTL         time.Duration
+}
+
+// DeviceEnrollment is the result of enrolling a machine
+type DeviceEnrollment struct {
+	Device           *models.Device
+	CertificatePEM   []byte
+	CACertificatePEM []byte
+}
+
+// SetDevices enables machine enrollment. Enrollment tokens are created and
+// devices listed and revoked by holders of devices.manage.
+func (c *SecretlyCore) SetDevices(cfg config.DevicesConfig) {
+	if !cfg.Enabled {
+		c.devices = nil
+		return
+	}
+	days := cfg.CertificateDays
+	if days <= 0 {
+		days = DefaultDeviceCertificateDays
+	}
+	c.devices = &devicePolicy{
+		certTTL:    time.Duration(days) * 24 * time.Hour,
+		challenges: make(map[string]time.Time),
+	}
+}
+
+// CreateEnrollmentToken returns a one-time token a machine enrolls with. The
+// device acts as req.Username within the namespace and read-only setting.
+func (c *SecretlyCore) CreateEnrollmentToken(ctx context.Context, by string, req *EnrollmentTokenRequest) (string, *models.DeviceEnrollmentToken, error) {
+	if err := c.requireDeviceAdmin(ctx); err != nil {
+		return "", nil, err
+	}
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = DefaultEnrollmentTokenTTL
+	}
+	if ttl < 0 || ttl > MaxEnrollmentTokenTTL {
+		return "", nil, fmt.Errorf("token lifetime must be between 0 and %s", MaxEnrollmentTokenTTL)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return "", nil, fmt.Errorf("device name is required")
+	}
+	user, err := c.storage.Users().FindByUsername(req.Username)
+	if err != nil {
+		return "", nil, fmt.Errorf("user %q: %w", req.Username, ErrNotFound)
+	}
+	if user.DeactivatedAt != nil {
+		return "", nil, fmt.Errorf("user %q is deactivated", req.Username)
+	}
+	if err := c.ValidateScope(ctx, req.NamespaceID, 0, 0); err != nil {
+		return "", nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate enrollment token: %w", err)
+	}
+	record := &models.DeviceEnrollmentToken{
+		TokenHash:   hashToken(token),
+		Name:        req.Name,
+		Username:    user.Username,
+		NamespaceID: req.NamespaceID,
+		ReadOnly:    req.ReadOnly,
+		CreatedBy:   by,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := c.storage.Devices().CreateToken(record); err != nil {
+		return "", nil, fmt.Errorf("failed to store enrollment token: %w", err)
+	}
+	return token, record, nil
+}
+
+// EnrollDevice trades an enrollment token and a certificate request for a
+// device certificate. The request's signature shows the machine holds the
+// key; the token is used up even if storing the device fails.
+func (c *SecretlyCore) EnrollDevice(ctx context.Context, token string, csrPEM []byte) (*DeviceEnrollment, error) {
+	ca, err := c.deviceCA()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ca.Issue(csrPEM, c.devices.certTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	enrollment, err := c.storage.Devices().ConsumeToken(hashToken(token), time.Now())
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: enrollment token unknown, used or expired", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use enrollment token: %w", err)
+	}
+	user, err := c.storage.Users().FindByUsername(enrollment.Username)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment user %q not found: %w", enrollment.Username, err)
+	}
+
+	dev := &models.Device{
+		Name:          enrollment.Name,
+		UserID:        user.ID,
+		NamespaceID:   enrollment.NamespaceID,
+		ReadOnly:      enrollment.ReadOnly,
+		Fingerprint:   cert.Fingerprint,
+		CertSerial:    cert.Serial,
+		CertExpiresAt: cert.NotAfter,
+		EnrolledBy:    enrollment.CreatedBy,
+	}
+	if err := c.storage.Devices().Create(dev); err != nil {
+		return nil, fmt.Errorf("failed to store device: %w", err)
+	}
+	client := ClientInfoFrom(ctx)
+	c.recordUserEvent(ctx, EventDeviceEnrolled, &user.ID, nil, fmt.Sprintf("Device %d %q enrolled as user %q with a token from %q (from %s)",
+		dev.ID, dev.Name, user.Username, enrollment.CreatedBy, describeClient(client.IPAddress, client.UserAgent)))
+	return &DeviceEnrollment{Device: dev, CertificatePEM: cert.PEM, CACertificatePEM: ca.CertificatePEM()}, nil
+}
+
+// ListDevices returns every enrolled device, for holders of devices.manage
+func (c *SecretlyCore) ListDevices(ctx context.Context) ([]models.Device, error) {
+	if err := c.requireDeviceAdmin(ctx); err != nil {
+		return nil, err
+	}
+	devices, err := c.storage.Devices().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// RevokeDevice blocks a device. Its certificate stops working and its
+// sessions are refused from their next request.
+func (c *SecretlyCore) RevokeDevice(ctx context.Context, by string, id uint) error {
+	if err := c.requireDeviceAdmin(ctx); err != nil {
+		return err
+	}
+	dev, err := c.storage.Devices().GetByID(id)
+	if err != nil {
+		return fmt.Errorf("device %d: %w", id, ErrNotFound)
+	}
+	if dev.RevokedAt != nil {
+		return nil
+	}
+	if err := c.storage.Devices().Revoke(id, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke device %d: %w", id, err)
+	}
+	c.recordUserEvent(ctx, EventDeviceRevoked, &dev.UserID, nil, fmt.Sprintf("Device %d %q revoked by %q", dev.ID, dev.Name, by))
+	return nil
+}
+
+// DeviceChallenge returns a one-time challenge for DeviceLogin
+func (c *SecretlyCore) DeviceChallenge(ctx context.Context) (string, error) {
+	p := c.devices
+	if p == nil {
+		return "", ErrDevicesDisabled
+	}
+	challenge, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for ch, expires := range p.challenges {
+		if expires.Before(now) {
+			delete(p.challenges, ch)
+		}
+	}
+	if len(p.challenges) >= maxDeviceChallenges {
+		return "", fmt.Errorf("too many device logins in progress")
+	}
+	p.challenges[challenge] = now.Add(deviceChallengeTTL)
+	return challenge, nil
+}
+
+// DeviceLogin checks a device certificate and its signature over a
+// challenge, and opens a short-lived session scoped to the device
+func (c *SecretlyCore) DeviceLogin(ctx context.Context, certPEM []byte, challenge string, signature []byte) (string, *models.Session, error) {
+	ca, err := c.deviceCA()
+	if err != nil {
+		return "", nil, err
+	}
+	p := c.devices
+	p.mu.Lock()
+	expires, ok := p.challenges[challenge]
+	delete(p.challenges, challenge)
+	p.mu.Unlock()
+	if !ok || expires.Before(time.Now()) {
+		return "", nil, fmt.Errorf("%w: challenge unknown or expired", ErrInvalidCredentials)
+	}
+
+	cert, fingerprint, err := ca.Verify(certPEM)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if err := device.VerifySignature(cert, challenge, signature); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	dev, err := c.storage.Devices().GetByFingerprint(fingerprint)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: device not enrolled", ErrInvalidCredentials)
+	}
+	if dev.RevokedAt != nil {
+		return "", nil, fmt.Errorf("%w: device %d is revoked", ErrInvalidCredentials, dev.ID)
+	}
+	user, err := c.storage.Users().FindByID(dev.UserID)
+	if err != nil {
+		return "", nil, fmt.Errorf("device %d user %d not found: %w", dev.ID, dev.UserID, err)
+	}
+	if user.DeactivatedAt != nil {
+		return "", nil, fmt.Errorf("%w: device %d user %q is deactivated", ErrInvalidCredentials, dev.ID, user.Username)
+	}
+	if err := c.checkClientNetwork(ctx, user.Username, &user.ID); err != nil {
+		return "", nil, err
+	}
+
+	token, session, err := c.openSession(ctx, &models.Session{
+		UserID:  user.ID,
+		Scope:   deviceScopePrefix + strconv.FormatUint(uint64(dev.ID), 10),
+		Subject: dev.Name,
+	}, DefaultFederatedSessionTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	_ = c.storage.Devices().RecordUse(dev.ID, time.Now())
+	c.recordUserEvent(ctx, EventUserLogin, &user.ID, nil, fmt.Sprintf("User %q logged in via device %d %q", user.Username, dev.ID, dev.Name))
+	return token, session, nil
+}
+
+// deviceRestriction returns the limits of the sessions of a device
+func (c *SecretlyCore) deviceRestriction(id string) (*restriction, error) {
+	deviceID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid device scope", ErrPermissionDenied)
+	}
+	dev, err := c.storage.Devices().GetByID(uint(deviceID))
+	if errors.Is(err, ErrNotFound) || (err == nil && dev.RevokedAt != nil) {
+		return nil, fmt.Errorf("%w: device %d is revoked", ErrPermissionDenied, deviceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	r := &restriction{name: fmt.Sprintf("device %q", dev.Name), read: true, write: !dev.ReadOnly}
+	if dev.NamespaceID != 0 {
+		r.namespaceIDs = []uint{dev.NamespaceID}
+	}
+	return r, nil
+}
+
+// deviceCA returns the device CA, creating it in storage on first use. The
+// CA key is encrypted like secret values.
+func (c *SecretlyCore) deviceCA() (*device.CA, error) {
+	p := c.devices
+	if p == nil {
+		return nil, ErrDevicesDisabled
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ca != nil {
+		return p.ca, nil
+	}
+
+	certPEM, err := c.storage.Config().Get(deviceCACertKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device CA: %w", err)
+	}
+	var keyPEM []byte
+	if certPEM == "" {
+		cert, key, err := device.NewCA("Secretly device CA")
+		if err != nil {
+			return nil, err
+		}
+		encrypted, _, err := c.encrypt(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt device CA key: %w", err)
+		}
+		if err := c.storage.Config().Set(deviceCAKeyKey, base64.StdEncoding.EncodeToString(encrypted)); err != nil {
+			return nil, fmt.Errorf("failed to store device CA: %w", err)
+		}
+		if err := c.storage.Config().Set(deviceCACertKey, string(cert)); err != nil {
+			return nil, fmt.Errorf("failed to store device CA: %w", err)
+		}
+		certPEM, keyPEM = string(cert), key
+	} else {
+		stored, err := c.storage.Config().Get(deviceCAKeyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load device CA: %w", err)
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode device CA key: %w", err)
+		}
+		if keyPEM, err = c.decrypt(encrypted); err != nil {
+			return nil, fmt.Errorf("failed to decrypt device CA key: %w", err)
+		}
+	}
+	ca, err := device.LoadCA([]byte(certPEM), keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device CA: %w", err)
+	}
+	p.ca = ca
+	return ca, nil
+}
+
+// requireDeviceAdmin checks that devices are enabled and the actor in ctx
+// may manage them
+func (c *SecretlyCore) requireDeviceAdmin(ctx context.Context) error {
+	if c.devices == nil {
+		return ErrDevicesDisabled
+	}
+	return c.requirePermission(ctx, PermissionDevicesManage, "managing devices")
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+)
+
+// EventDiagnosticsRead is recorded when an admin reads the runtime
+// diagnostics or collects a profile
+const EventDiagnosticsRead = "diagnostics_read"
+
+// ErrDiagnosticsDisabled is returned by the diagnostics when server.debug
+// is not enabled
+var ErrDiagnosticsDisabled = errors.New("diagnostics are not enabled")
+
+// processStarted is when the process started, for the uptime
+var processStarted = time.Now()
+
+type diagnosticsPolicy struct{}
+
+// DiagnosticsReport describes the running process
+type DiagnosticsReport struct {
+	Uptime     string           `json:"uptime"`
+	Goroutines int              `json:"goroutines"`
+	GOMAXPROCS int              `json:"gomaxprocs"`
+	NumCPU     int              `json:"num_cpu"`
+	Memory     MemoryStats      `json:"memory"`
+	Build      BuildStats       `json:"build"`
+	AuditQueue *AuditQueueStats `json:"audit_queue,omitempty"`
+	ValueCache *ValueCacheStats `json:"value_cache,omitempty"`
+	// GoroutineDump holds the stacks of every goroutine when asked for
+	GoroutineDump string `json:"goroutine_dump,omitempty"`
+}
+
+// MemoryStats is the part of runtime.MemStats worth watching for leaks and
+// GC pressure; sizes are in bytes
+type MemoryStats struct {
+	HeapAlloc    uint64     `json:"heap_alloc"`
+	HeapInuse    uint64     `json:"heap_inuse"`
+	HeapObjects  uint64     `json:"heap_objects"`
+	Sys          uint64     `json:"sys"`
+	TotalAlloc   uint64     `json:"total_alloc"`
+	NumGC        uint32     `json:"num_gc"`
+	GCPauseTotal string     `json:"gc_pause_total"`
+	LastGC       *time.Time `json:"last_gc,omitempty"`
+}
+
+// ValueCacheStats reports the value cache of secrets.cache
+type ValueCacheStats struct {
+	Entries   int     `json:"entries"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// BuildStats identifies the binary
+type BuildStats struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+// SetDiagnostics lets holders of system.manage read runtime diagnostics
+// and collect profiles when enabled
+func (c *SecretlyCore) SetDiagnostics(enabled bool) {
+	if !enabled {
+		c.diagnostics = nil
+		return
+	}
+	c.diagnostics = &diagnosticsPolicy{}
+}
+
+// AuthorizeDiagnostics checks that the caller may read diagnostics and
+// records that they did; what describes it for the audit log, e.g. "heap
+// profile"
+func (c *SecretlyCore) AuthorizeDiagnostics(ctx context.Context, what string) error {
+	if c.diagnostics == nil {
+		return ErrDiagnosticsDisabled
+	}
+	if err := c.requirePermission(ctx, PermissionSystemManage, "reading diagnostics"); err != nil {
+		return err
+	}
+	var userID *uint
+	if auth, err := c.actor(ctx); err == nil && auth.User != nil {
+		userID = &auth.User.ID
+	}
+	c.recordUserEvent(ctx, EventDiagnosticsRead, userID, nil, fmt.Sprintf("Read %s by %q", what, c.actorName(ctx)))
+	return nil
+}
+
+// Diagnostics reports on the running process, with the stacks of every
+// goroutine when goroutines is set
+func (c *SecretlyCore) Diagnostics(ctx context.Context, goroutines bool) (*DiagnosticsReport, error) {
+	what := "runtime diagnostics"
+	if goroutines {
+		what += " with a goroutine dump"
+	}
+	if err := c.AuthorizeDiagnostics(ctx, what); err != nil {
+		return nil, err
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	report := &DiagnosticsReport{
+		Uptime:     time.Since(processStarted).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+		Memory: MemoryStats{
+			HeapAlloc:    mem.HeapAlloc,
+			HeapInuse:    mem.HeapInuse,
+			HeapObjects:  mem.HeapObjects,
+			Sys:          mem.Sys,
+			TotalAlloc:   mem.TotalAlloc,
+			NumGC:        mem.NumGC,
+			GCPauseTotal: time.Duration(mem.PauseTotalNs).String(),
+		},
+		Build: BuildStats{GoVersion: runtime.Version()},
+	}
+	if mem.LastGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC)).UTC()
+		report.Memory.LastGC = &last
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		report.Build.Path = info.Main.Path
+		report.Build.Version = info.Main.Version
+		report.Build.Settings = make(map[string]string)
+		for _, s := range info.Settings {
+			report.Build.Settings[s.Key] = s.Value
+		}
+	}
+	if stats, ok := c.AuditQueueStats(); ok {
+		report.AuditQueue = &stats
+	}
+	if stats := c.CacheStats(); stats.Enabled {
+		report.ValueCache = &ValueCacheStats{
+			Entries:   stats.Entries,
+			Hits:      stats.Hits,
+			Misses:    stats.Misses,
+			Evictions: stats.Evictions,
+			HitRate:   stats.HitRate(),
+		}
+	}
+	if goroutines {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+		}
+		report.GoroutineDump = buf.String()
+	}
+	return report, nil
+}
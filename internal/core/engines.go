@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/engine"
+)
+
+// Audit event types for secret engines. Credentials are never recorded,
+// only the engine, role and lease.
+const (
+	EventEngineCredentialIssued = "engine_credential_issued"
+	EventEngineLeaseRevoked     = "engine_lease_revoked"
+)
+
+// ErrEnginesDisabled is returned when no secret engines are configured
+var ErrEnginesDisabled = errors.New("secret engines are not enabled")
+
+type enginePolicy struct {
+	registry *engine.Registry
+	users    map[string][]string
+}
+
+// SetEngines offers the engines of registry. Holders of system.manage may
+// use every engine, and users[name] lists who else may use the engine
+// called name. A nil registry disables engines.
+func (c *SecretlyCore) SetEngines(registry *engine.Registry, users map[string][]string) {
+	if registry == nil {
+		c.engines = nil
+		return
+	}
+	c.engines = &enginePolicy{registry: registry, users: users}
+}
+
+// ListEngines returns the engines the actor in ctx may use, with their
+// capabilities
+func (c *SecretlyCore) ListEngines(ctx context.Context) ([]engine.Info, error) {
+	if c.engines == nil {
+		return nil, ErrEnginesDisabled
+	}
+	infos := []engine.Info{}
+	for _, info := range c.engines.registry.List() {
+		if c.checkEngineAccess(ctx, info.Name) == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// IssueEngineCredential mints a credential with the engine called name.
+// The credential is returned to the caller only; the audit log records
+// who asked for which role and the lease.
+func (c *SecretlyCore) IssueEngineCredential(ctx context.Context, name string, req engine.IssueRequest) (*engine.Credential, error) {
+	if err := c.checkEngineAccess(ctx, name); err != nil {
+		return nil, err
+	}
+	cred, err := c.engines.registry.Issue(ctx, name, req)
+	if err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf("Credential for role %q issued by engine %q to %s", req.Role, name, c.rbacActor(ctx))
+	if cred.LeaseID != "" {
+		description += fmt.Sprintf(", lease %q", cred.LeaseID)
+	}
+	if len(req.Params) > 0 {
+		keys := make([]string, 0, len(req.Params))
+		for k := range req.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		description += fmt.Sprintf(" (params %s)", strings.Join(keys, ", "))
+	}
+	c.recordClientEvent(ctx, EventEngineCredentialIssued, nil, description)
+	return cred, nil
+}
+
+// RevokeEngineLease invalidates a credential the engine called name
+// issued
+func (c *SecretlyCore) RevokeEngineLease(ctx context.Context, name, leaseID string) error {
+	if err := c.checkEngineAccess(ctx, name); err != nil {
+		return err
+	}
+	if err := c.engines.registry.Revoke(ctx, name, leaseID); err != nil {
+		return err
+	}
+	c.recordClientEvent(ctx, EventEngineLeaseRevoked, nil,
+		fmt.Sprintf("Lease %q of engine %q revoked by %s", leaseID, name, c.rbacActor(ctx)))
+	return nil
+}
+
+// checkEngineAccess allows system actors, holders of system.manage and the
+// engine's users, with sessions that have their full access; API clients
+// and devices restricted to part of the secrets cannot mint credentials
+func (c *SecretlyCore) checkEngineAccess(ctx context.Context, name string) error {
+	if c.engines == nil {
+		return ErrEnginesDisabled
+	}
+	if _, err := c.engines.registry.Lookup(name); err != nil {
+		return fmt.Errorf("secret engine %q: %w", name, ErrNotFound)
+	}
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return err
+	}
+	if auth.System {
+		return nil
+	}
+	if auth.User == nil {
+		return fmt.Errorf("%w: secret engines need a user", ErrPermissionDenied)
+	}
+	if r, err := c.sessionRestriction(auth.Session); err != nil || r != nil {
+		return fmt.Errorf("%w: scoped sessions cannot use secret engines", ErrPermissionDenied)
+	}
+	username := auth.User.Username
+	if !slices.Contains(c.engines.users[name], username) && !c.HasPermission(ctx, PermissionSystemManage) {
+		return fmt.Errorf("%w: %q may not use secret engine %q", ErrPermissionDenied, username, name)
+	}
+	return nil
+}
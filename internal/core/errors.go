@@ -0,0 +1,26 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+)
+
+// Errors shared by the core operations. Callers match them with errors.Is;
+// the HTTP server and the CSI provider map them to status codes.
+var (
+	// ErrNotFound is returned when a secret, user, session or other record
+	// does not exist
+	ErrNotFound = storage.ErrNotFound
+	// ErrConflict is returned when a record with the same unique key
+	// already exists
+	ErrConflict = storage.ErrConflict
+	// ErrPermissionDenied is returned when the session may not perform an
+	// operation
+	ErrPermissionDenied = errors.New("operation not permitted for this session")
+	// ErrExpired is returned when reading a secret past its expiration or
+	// its maximum number of reads
+	ErrExpired = errors.New("expired")
+	// ErrInvalidSort is returned for a listing ordered by an unknown column
+	ErrInvalidSort = errors.New("invalid sort")
+)
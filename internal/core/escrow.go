@@ -0,0 +1,579 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/escrow"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for escrowed secrets
+const (
+	EventEscrowKeySet            = "escrow_key_set"
+	EventEscrowCreated           = "escrow_created"
+	EventEscrowRecoveryRequested = "escrow_recovery_requested"
+	EventEscrowRecoveryApproved  = "escrow_recovery_approved"
+	EventEscrowRecovered         = "escrow_recovered"
+	EventEscrowRecoveryCollected = "escrow_recovery_collected"
+	EventEscrowRecoveryExpired   = "escrow_recovery_expired"
+)
+
+// Statuses of escrow recoveries
+const (
+	RecoveryPending   = "pending"
+	RecoveryRecovered = "recovered"
+	RecoveryCollected = "collected"
+	RecoveryExpired   = "expired"
+)
+
+// DefaultRecoveryWindow applies when security.escrow does not set
+// recovery_hours
+const DefaultRecoveryWindow = 72 * time.Hour
+
+const escrowLogPurpose = "escrow-log"
+
+// ErrEscrowDisabled is returned by escrow operations when security.escrow
+// is not enabled
+var ErrEscrowDisabled = errors.New("escrow is not enabled")
+
+// escrowPolicy is the escrow configured with SetEscrow. mu serializes the
+// approvals and collections of recoveries, logMu the appends to the hash
+// chain of the escrow log.
+type escrowPolicy struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	logMu sync.Mutex
+}
+
+// EscrowLogReport is the outcome of verifying the escrow log
+type EscrowLogReport struct {
+	Entries int  `json:"entries"`
+	Valid   bool `json:"valid"`
+	// BrokenAt is the first entry whose hash does not match its content or
+	// its predecessor
+	BrokenAt uint `json:"broken_at,omitempty"`
+}
+
+// SetEscrow enables escrowing secrets with M-of-N recovery. Holders of
+// audit.read may read and verify the escrow log.
+func (c *SecretlyCore) SetEscrow(cfg config.EscrowConfig) {
+	if !cfg.Enabled {
+		c.escrow = nil
+		return
+	}
+	window := time.Duration(cfg.RecoveryHours) * time.Hour
+	if window <= 0 {
+		window = DefaultRecoveryWindow
+	}
+	c.escrow = &escrowPolicy{window: window}
+}
+
+// SetEscrowKey registers the public key escrow shares are sealed to for
+// the user in ctx, who can then be a custodian. Escrows created before
+// keep the shares sealed to the previous key.
+func (c *SecretlyCore) SetEscrowKey(ctx context.Context, publicKey []byte) error {
+	user, err := c.escrowUser(ctx)
+	if err != nil {
+		return err
+	}
+	if err := escrow.CheckPublicKey(publicKey); err != nil {
+		return err
+	}
+	if err := c.storage.Escrows().SetCustodian(&models.EscrowCustodian{UserID: user.ID, PublicKey: publicKey}); err != nil {
+		return fmt.Errorf("failed to store escrow key: %w", err)
+	}
+	if err := c.logEscrow(0, nil, "key_set", user.Username, fmt.Sprintf("Escrow key of %q set", user.Username)); err != nil {
+		return err
+	}
+	c.recordUserEvent(ctx, EventEscrowKeySet, &user.ID, nil, fmt.Sprintf("Escrow key of %q set", user.Username))
+	return nil
+}
+
+// CreateEscrow escrows the current value of a secret: it is encrypted with
+// a new key whose shares are sealed to the custodians, threshold of whom
+// must approve a recovery. Escrowing takes write access to the secret;
+// every custodian needs an escrow key.
+func (c *SecretlyCore) CreateEscrow(ctx context.Context, id uint, custodians []string, threshold int) (*models.Escrow, error) {
+	if c.escrow == nil {
+		return nil, ErrEscrowDisabled
+	}
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if IsFolder(secret) {
+		return nil, fmt.Errorf("%q is a folder", secret.Name)
+	}
+	if len(custodians) == 0 || len(custodians) > escrow.MaxShares {
+		return nil, fmt.Errorf("name between 1 and %d custodians", escrow.MaxShares)
+	}
+	if threshold < 1 || threshold > len(custodians) {
+		return nil, fmt.Errorf("threshold must be between 1 and the number of custodians")
+	}
+	users := make([]*models.User, 0, len(custodians))
+	keys := make([][]byte, 0, len(custodians))
+	for i, name := range custodians {
+		if slices.Contains(custodians[:i], name) {
+			return nil, fmt.Errorf("custodian %q is named twice", name)
+		}
+		user, err := c.storage.Users().FindByUsername(name)
+		if err != nil {
+			return nil, fmt.Errorf("custodian %q: %w", name, err)
+		}
+		if user.DeactivatedAt != nil {
+			return nil, fmt.Errorf("custodian %q is deactivated", name)
+		}
+		custodian, err := c.storage.Escrows().GetCustodian(user.ID)
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("custodian %q has no escrow key", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get escrow key of %q: %w", name, err)
+		}
+		users, keys = append(users, user), append(keys, custodian.PublicKey)
+	}
+
+	value, err := c.GetSecretValue(ctx, secret.ID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := c.latestVersion(secret.ID)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, shares, err := escrow.Lock(value, len(users), threshold)
+	clear(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to escrow secret %d: %w", id, err)
+	}
+	sealed := make([]models.EscrowShare, len(shares))
+	for i, share := range shares {
+		box, err := escrow.Seal(share, keys[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal the share of %q: %w", users[i].Username, err)
+		}
+		sealed[i] = models.EscrowShare{UserID: users[i].ID, Sealed: box, Digest: escrow.Digest(share)}
+		clear(share)
+	}
+
+	e := &models.Escrow{
+		SecretNodeID:  secret.ID,
+		VersionNumber: version.VersionNumber,
+		Threshold:     threshold,
+		Ciphertext:    ciphertext,
+		CreatedBy:     c.actorName(ctx),
+		CreatedAt:     time.Now(),
+	}
+	if err := c.storage.Escrows().Create(e, sealed); err != nil {
+		return nil, fmt.Errorf("failed to escrow secret %d: %w", id, err)
+	}
+	desc := fmt.Sprintf("Version %d of secret %q escrowed as %d with %d of %d custodians (%v) needed to recover it",
+		e.VersionNumber, secret.Name, e.ID, threshold, len(custodians), custodians)
+	if err := c.logEscrow(e.ID, nil, "created", e.CreatedBy, desc); err != nil {
+		return nil, err
+	}
+	c.recordClientEvent(ctx, EventEscrowCreated, &secret.ID, desc)
+	return e, nil
+}
+
+// ListEscrows lists the escrows of a secret, oldest first. Listing takes
+// write access to the secret.
+func (c *SecretlyCore) ListEscrows(ctx context.Context, id uint) ([]models.Escrow, error) {
+	if c.escrow == nil {
+		return nil, ErrEscrowDisabled
+	}
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	escrows, err := c.storage.Escrows().ListBySecret(secret.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list escrows of secret %d: %w", id, err)
+	}
+	return escrows, nil
+}
+
+// RequestRecovery asks the custodians of an escrow to recover its value
+// for the user in ctx. Anyone may ask, since the custodians decide; the
+// request lapses if too few approve within the recovery window.
+func (c *SecretlyCore) RequestRecovery(ctx context.Context, escrowID uint, reason string) (*models.EscrowRecovery, error) {
+	user, err := c.escrowUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to request a recovery")
+	}
+	e, err := c.storage.Escrows().Get(escrowID)
+	if err != nil {
+		return nil, fmt.Errorf("escrow %d: %w", escrowID, err)
+	}
+	now := time.Now()
+	recovery := &models.EscrowRecovery{
+		EscrowID:    e.ID,
+		RequestedBy: user.Username,
+		Reason:      reason,
+		Status:      RecoveryPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(c.escrow.window),
+		Approvers:   []byte("[]"),
+	}
+	if err := c.storage.Escrows().CreateRecovery(recovery); err != nil {
+		return nil, fmt.Errorf("failed to request recovery of escrow %d: %w", escrowID, err)
+	}
+	desc := fmt.Sprintf("Recovery %d of escrow %d requested by %q until %s: %s",
+		recovery.ID, e.ID, user.Username, recovery.ExpiresAt.Format(time.RFC3339), reason)
+	if err := c.logEscrow(e.ID, &recovery.ID, "recovery_requested", user.Username, desc); err != nil {
+		return nil, err
+	}
+	c.recordUserEvent(ctx, EventEscrowRecoveryRequested, &user.ID, &e.SecretNodeID, desc)
+	return recovery, nil
+}
+
+// ListRecoveries lists the recoveries of an escrow, oldest first, for its
+// custodians and the users with write access to the secret
+func (c *SecretlyCore) ListRecoveries(ctx context.Context, escrowID uint) ([]models.EscrowRecovery, error) {
+	user, err := c.escrowUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.storage.Escrows().Get(escrowID)
+	if err != nil {
+		return nil, fmt.Errorf("escrow %d: %w", escrowID, err)
+	}
+	if share, err := c.custodianShare(e.ID, user.ID); err != nil {
+		return nil, err
+	} else if share == nil {
+		if _, err := c.writableSecret(ctx, e.SecretNodeID); err != nil {
+			return nil, err
+		}
+	}
+	recoveries, err := c.storage.Escrows().ListRecoveries(e.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recoveries of escrow %d: %w", escrowID, err)
+	}
+	for i := range recoveries {
+		if err := c.expireRecovery(ctx, e, &recoveries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return recoveries, nil
+}
+
+// RecoveryShare returns the sealed share of the custodian in ctx for a
+// pending recovery. Only the custodian's private key opens it.
+func (c *SecretlyCore) RecoveryShare(ctx context.Context, recoveryID uint) (*models.EscrowShare, error) {
+	user, e, recovery, err := c.pendingRecovery(ctx, recoveryID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := c.custodianShare(e.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if share == nil {
+		return nil, fmt.Errorf("%q is not a custodian of escrow %d: %w", user.Username, recovery.EscrowID, ErrPermissionDenied)
+	}
+	return share, nil
+}
+
+// ApproveRecovery hands back the opened share of the custodian in ctx. The
+// requester cannot approve their own recovery. With the threshold of
+// shares, the value is recovered for the requester to collect and the
+// shares are discarded.
+func (c *SecretlyCore) ApproveRecovery(ctx context.Context, recoveryID uint, share []byte) (*models.EscrowRecovery, error) {
+	if c.escrow == nil {
+		return nil, ErrEscrowDisabled
+	}
+	c.escrow.mu.Lock()
+	defer c.escrow.mu.Unlock()
+	user, e, recovery, err := c.pendingRecovery(ctx, recoveryID)
+	if err != nil {
+		return nil, err
+	}
+	mine, err := c.custodianShare(e.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mine == nil {
+		return nil, fmt.Errorf("%q is not a custodian of escrow %d: %w", user.Username, e.ID, ErrPermissionDenied)
+	}
+	if user.Username == recovery.RequestedBy {
+		return nil, fmt.Errorf("recoveries must be approved by custodians other than the requester: %w", ErrPermissionDenied)
+	}
+	var approvers []string
+	if err := json.Unmarshal(recovery.Approvers, &approvers); err != nil {
+		return nil, fmt.Errorf("failed to read approvers of recovery %d: %w", recoveryID, err)
+	}
+	if slices.Contains(approvers, user.Username) {
+		return nil, fmt.Errorf("%q already approved recovery %d: %w", user.Username, recoveryID, ErrConflict)
+	}
+	if escrow.Digest(share) != mine.Digest {
+		return nil, fmt.Errorf("the share does not belong to %q in escrow %d: %w", user.Username, e.ID, escrow.ErrInvalidShares)
+	}
+
+	var shares [][]byte
+	if len(recovery.Shares) > 0 {
+		plain, err := c.decrypt(recovery.Shares)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shares of recovery %d: %w", recoveryID, err)
+		}
+		if err := json.Unmarshal(plain, &shares); err != nil {
+			return nil, fmt.Errorf("failed to read shares of recovery %d: %w", recoveryID, err)
+		}
+	}
+	shares = append(shares, share)
+	approvers = append(approvers, user.Username)
+	recovery.Approvers, _ = json.Marshal(approvers)
+	desc := fmt.Sprintf("Recovery %d of escrow %d requested by %q approved by %q (%d of %d)",
+		recovery.ID, e.ID, recovery.RequestedBy, user.Username, len(approvers), e.Threshold)
+
+	recovered := len(shares) >= e.Threshold
+	if recovered {
+		value, err := escrow.Unlock(e.Ciphertext, shares)
+		if err != nil {
+			return nil, fmt.Errorf("failed to recover escrow %d: %w", e.ID, err)
+		}
+		encrypted, _, err := c.encrypt(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovered value: %w", err)
+		}
+		now := time.Now()
+		recovery.Status, recovery.Value, recovery.Shares, recovery.RecoveredAt = RecoveryRecovered, encrypted, nil, &now
+	} else {
+		plain, _ := json.Marshal(shares)
+		encrypted, _, err := c.encrypt(plain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store share: %w", err)
+		}
+		recovery.Shares = encrypted
+	}
+	for _, s := range shares {
+		clear(s)
+	}
+	if err := c.storage.Escrows().UpdateRecovery(recovery); err != nil {
+		return nil, fmt.Errorf("failed to update recovery %d: %w", recoveryID, err)
+	}
+	if err := c.logEscrow(e.ID, &recovery.ID, "recovery_approved", user.Username, desc); err != nil {
+		return nil, err
+	}
+	c.recordUserEvent(ctx, EventEscrowRecoveryApproved, &user.ID, &e.SecretNodeID, desc)
+	if recovered {
+		desc := fmt.Sprintf("Escrow %d recovered for %q by %v", e.ID, recovery.RequestedBy, approvers)
+		if err := c.logEscrow(e.ID, &recovery.ID, "recovered", user.Username, desc); err != nil {
+			return nil, err
+		}
+		c.recordUserEvent(ctx, EventEscrowRecovered, c.actorID(recovery.RequestedBy), &e.SecretNodeID, desc)
+	}
+	return recovery, nil
+}
+
+// CollectRecovery returns the recovered value to the requester, once
+func (c *SecretlyCore) CollectRecovery(ctx context.Context, recoveryID uint) ([]byte, error) {
+	if c.escrow == nil {
+		return nil, ErrEscrowDisabled
+	}
+	c.escrow.mu.Lock()
+	defer c.escrow.mu.Unlock()
+	user, err := c.escrowUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := c.storage.Escrows().GetRecovery(recoveryID)
+	if err != nil {
+		return nil, fmt.Errorf("recovery %d: %w", recoveryID, err)
+	}
+	if recovery.RequestedBy != user.Username {
+		return nil, fmt.Errorf("only %q may collect recovery %d: %w", recovery.RequestedBy, recoveryID, ErrPermissionDenied)
+	}
+	if recovery.Status != RecoveryRecovered {
+		return nil, fmt.Errorf("recovery %d is %s: %w", recoveryID, recovery.Status, ErrConflict)
+	}
+	e, err := c.storage.Escrows().Get(recovery.EscrowID)
+	if err != nil {
+		return nil, fmt.Errorf("escrow %d: %w", recovery.EscrowID, err)
+	}
+	value, err := c.decrypt(recovery.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recovered value: %w", err)
+	}
+	now := time.Now()
+	recovery.Status, recovery.Value, recovery.CollectedAt = RecoveryCollected, nil, &now
+	if err := c.storage.Escrows().UpdateRecovery(recovery); err != nil {
+		return nil, fmt.Errorf("failed to update recovery %d: %w", recoveryID, err)
+	}
+	desc := fmt.Sprintf("Recovered value of escrow %d collected by %q", e.ID, user.Username)
+	if err := c.logEscrow(e.ID, &recovery.ID, "collected", user.Username, desc); err != nil {
+		return nil, err
+	}
+	c.recordUserEvent(ctx, EventEscrowRecoveryCollected, &user.ID, &e.SecretNodeID, desc)
+	return value, nil
+}
+
+// EscrowLog returns the escrow log entries, of one escrow if escrowID is
+// not 0, and verifies the whole hash chain. It takes audit.read.
+func (c *SecretlyCore) EscrowLog(ctx context.Context, escrowID uint) ([]models.EscrowLogEntry, *EscrowLogReport, error) {
+	if c.escrow == nil {
+		return nil, nil, ErrEscrowDisabled
+	}
+	if err := c.requirePermission(ctx, PermissionAuditRead, "reading the escrow log"); err != nil {
+		return nil, nil, err
+	}
+	entries, err := c.storage.Escrows().ListLog()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read escrow log: %w", err)
+	}
+	report := &EscrowLogReport{Entries: len(entries), Valid: true}
+	prev := ""
+	for i := range entries {
+		hash, err := c.escrowLogHash(prev, &entries[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if entries[i].PrevHash != prev || !hmac.Equal([]byte(entries[i].Hash), []byte(hash)) {
+			report.Valid, report.BrokenAt = false, entries[i].ID
+			break
+		}
+		prev = entries[i].Hash
+	}
+	if escrowID != 0 {
+		entries = slices.DeleteFunc(entries, func(e models.EscrowLogEntry) bool { return e.EscrowID != escrowID })
+	}
+	return entries, report, nil
+}
+
+// pendingRecovery returns the user in ctx and a recovery that is still
+// pending, with its escrow
+func (c *SecretlyCore) pendingRecovery(ctx context.Context, recoveryID uint) (*models.User, *models.Escrow, *models.EscrowRecovery, error) {
+	user, err := c.escrowUser(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recovery, err := c.storage.Escrows().GetRecovery(recoveryID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("recovery %d: %w", recoveryID, err)
+	}
+	e, err := c.storage.Escrows().Get(recovery.EscrowID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("escrow %d: %w", recovery.EscrowID, err)
+	}
+	if err := c.expireRecovery(ctx, e, recovery); err != nil {
+		return nil, nil, nil, err
+	}
+	if recovery.Status != RecoveryPending {
+		return nil, nil, nil, fmt.Errorf("recovery %d is %s: %w", recoveryID, recovery.Status, ErrConflict)
+	}
+	return user, e, recovery, nil
+}
+
+// expireRecovery marks a pending recovery past its window as expired and
+// discards the shares handed back for it
+func (c *SecretlyCore) expireRecovery(ctx context.Context, e *models.Escrow, recovery *models.EscrowRecovery) error {
+	if recovery.Status != RecoveryPending || time.Now().Before(recovery.ExpiresAt) {
+		return nil
+	}
+	recovery.Status, recovery.Shares = RecoveryExpired, nil
+	if err := c.storage.Escrows().UpdateRecovery(recovery); err != nil {
+		return fmt.Errorf("failed to expire recovery %d: %w", recovery.ID, err)
+	}
+	desc := fmt.Sprintf("Recovery %d of escrow %d requested by %q expired", recovery.ID, e.ID, recovery.RequestedBy)
+	if err := c.logEscrow(e.ID, &recovery.ID, "expired", "system", desc); err != nil {
+		return err
+	}
+	c.recordEvent(ctx, EventEscrowRecoveryExpired, &e.SecretNodeID, desc)
+	return nil
+}
+
+// custodianShare returns the share of a user in an escrow, nil if the user
+// is not a custodian
+func (c *SecretlyCore) custodianShare(escrowID, userID uint) (*models.EscrowShare, error) {
+	shares, err := c.storage.Escrows().ListShares(escrowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shares of escrow %d: %w", escrowID, err)
+	}
+	for i := range shares {
+		if shares[i].UserID == userID {
+			return &shares[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// escrowUser returns the user in ctx. Escrow operations are personal:
+// system actors have no escrow key and cannot request recoveries.
+func (c *SecretlyCore) escrowUser(ctx context.Context) (*models.User, error) {
+	if c.escrow == nil {
+		return nil, ErrEscrowDisabled
+	}
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if auth.User == nil {
+		return nil, fmt.Errorf("escrow operations need a user session: %w", ErrPermissionDenied)
+	}
+	return auth.User, nil
+}
+
+// logEscrow appends an entry to the escrow log, chained to the last one
+func (c *SecretlyCore) logEscrow(escrowID uint, recoveryID *uint, action, actor, detail string) error {
+	c.escrow.logMu.Lock()
+	defer c.escrow.logMu.Unlock()
+	last, err := c.storage.Escrows().LastLog()
+	if err != nil {
+		return fmt.Errorf("failed to read escrow log: %w", err)
+	}
+	entry := &models.EscrowLogEntry{
+		EscrowID:   escrowID,
+		RecoveryID: recoveryID,
+		Action:     action,
+		Actor:      actor,
+		Detail:     detail,
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if last != nil {
+		entry.PrevHash = last.Hash
+	}
+	if entry.Hash, err = c.escrowLogHash(entry.PrevHash, entry); err != nil {
+		return err
+	}
+	if err := c.storage.Escrows().AppendLog(entry); err != nil {
+		return fmt.Errorf("failed to write escrow log: %w", err)
+	}
+	return nil
+}
+
+// escrowLogHash returns the hash of entry chained to prev. With an
+// encryptor it is an HMAC keyed from the encryption key, so someone who
+// can write the database cannot forge a consistent chain.
+func (c *SecretlyCore) escrowLogHash(prev string, entry *models.EscrowLogEntry) (string, error) {
+	var h hash.Hash
+	if deriver, ok := c.encryptor.(KeyDeriver); ok {
+		key, err := deriver.DeriveKey(escrowLogPurpose)
+		if err != nil {
+			return "", fmt.Errorf("failed to derive escrow log key: %w", err)
+		}
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	recovery := uint(0)
+	if entry.RecoveryID != nil {
+		recovery = *entry.RecoveryID
+	}
+	fmt.Fprintf(h, "%s\n%d\n%d\n%s\n%s\n%s\n%s", prev, entry.EscrowID, recovery, entry.Action, entry.Actor, entry.Detail,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind before
+// further events are dropped for it
+const eventBufferSize = 256
+
+// Event is an audit event as delivered to live subscribers
+type Event struct {
+	ID          uint      `json:"id"`
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Description string    `json:"description"`
+	UserID      *uint     `json:"user_id,omitempty"`
+	SecretID    *uint     `json:"secret_id,omitempty"`
+	// IPAddress, UserAgent and Transport describe the request that caused
+	// the event; background jobs leave them empty
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	// ActorKind is "service_account" for events caused by a service
+	// account's token
+	ActorKind string `json:"actor_kind,omitempty"`
+	// ImpersonatorID is the admin who caused the event while impersonating
+	// UserID
+	ImpersonatorID *uint `json:"impersonator_id,omitempty"`
+	// NamespaceID is the namespace of SecretID, or 0 when the secret no
+	// longer exists
+	NamespaceID uint `json:"namespace_id,omitempty"`
+}
+
+// eventBus fans recorded audit events out to subscribers
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	notifier    Notifier
+}
+
+// Notifier is handed every recorded audit event, e.g. to alert people by
+// email, chat or paging. Notify must not block the operation that
+// recorded the event.
+type Notifier interface {
+	Notify(ev Event)
+}
+
+// SetNotifier hands every audit event recorded from now on to n; nil
+// stops notifications
+func (c *SecretlyCore) SetNotifier(n Notifier) {
+	c.events.mu.Lock()
+	c.events.notifier = n
+	c.events.mu.Unlock()
+}
+
+// SubscribeEvents delivers every audit event recorded from now on until
+// cancel is called. A subscriber that does not keep up misses events
+// rather than slowing down the operations that record them.
+func (c *SecretlyCore) SubscribeEvents() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, eventBufferSize)
+	c.events.mu.Lock()
+	if c.events.subscribers == nil {
+		c.events.subscribers = make(map[chan Event]struct{})
+	}
+	c.events.subscribers[ch] = struct{}{}
+	c.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.events.mu.Lock()
+			delete(c.events.subscribers, ch)
+			c.events.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publishEvent hands a recorded audit event to the subscribers and the
+// notifier, if any
+func (c *SecretlyCore) publishEvent(event *models.AuditEvent) {
+	c.events.mu.Lock()
+	idle := len(c.events.subscribers) == 0 && c.events.notifier == nil
+	c.events.mu.Unlock()
+	if idle {
+		return
+	}
+
+	ev := c.newEvent(event, nil)
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	if c.events.notifier != nil {
+		c.events.notifier.Notify(ev)
+	}
+	for ch := range c.events.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("⚠️  Event subscriber is falling behind, dropped event %d", ev.ID)
+		}
+	}
+}
+
+// newEvent converts an audit record, looking up the namespace of its
+// secret. namespaces, if not nil, caches lookups across calls.
+func (c *SecretlyCore) newEvent(event *models.AuditEvent, namespaces map[uint]uint) Event {
+	ev := Event{
+		ID:             event.ID,
+		Type:           event.EventType,
+		Time:           event.EventTime,
+		Description:    event.Description,
+		UserID:         event.UserID,
+		SecretID:       event.SecretNodeID,
+		IPAddress:      event.IPAddress,
+		UserAgent:      event.UserAgent,
+		Transport:      event.Transport,
+		ActorKind:      event.ActorKind,
+		ImpersonatorID: event.ImpersonatorID,
+	}
+	if ev.SecretID == nil {
+		return ev
+	}
+	if ns, ok := namespaces[*ev.SecretID]; ok {
+		ev.NamespaceID = ns
+		return ev
+	}
+	if secret, err := c.storage.Secrets().GetByID(*ev.SecretID); err == nil {
+		ev.NamespaceID = secret.NamespaceID
+	}
+	if namespaces != nil {
+		namespaces[*ev.SecretID] = ev.NamespaceID
+	}
+	return ev
+}
+
+// EventVisible reports whether the client in ctx may see ev: events about
+// a secret follow its namespace network policy, and other events take
+// audit.read. Events about secrets that no longer exist are withheld while
+// any namespace policy is configured.
+func (c *SecretlyCore) EventVisible(ctx context.Context, ev Event) bool {
+	if ev.SecretID == nil {
+		return c.HasPermission(ctx, PermissionAuditRead)
+	}
+	if ev.NamespaceID == 0 {
+		return c.network == nil || len(c.network.namespaces) == 0
+	}
+	return c.NamespaceReachable(ctx, ev.NamespaceID)
+}
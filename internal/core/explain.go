@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Effects of the steps of an access decision
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+	EffectNone  = "none"
+)
+
+// explainableActions are the permissions ExplainAccess decides, with the
+// grant level each needs
+var explainableActions = map[string]string{
+	"secrets.list":          AccessRead,
+	PermissionSecretsRead:   AccessRead,
+	PermissionSecretsWrite:  AccessWrite,
+	"secrets.share":         AccessWrite,
+	PermissionSecretsDelete: AccessWrite,
+}
+
+// DecisionStep is one check of an access decision. Check is "user",
+// "ownership", "grants", "groups", "roles" or "deny"; Effect is "allow" or
+// "deny" for the checks that decided and "none" for the others.
+type DecisionStep struct {
+	Check  string `json:"check"`
+	Effect string `json:"effect"`
+	Detail string `json:"detail"`
+}
+
+// AccessDecision is whether a user may perform an action on a secret and
+// every check that led there
+type AccessDecision struct {
+	Username    string         `json:"username"`
+	Action      string         `json:"action"`
+	SecretID    uint           `json:"secret_id"`
+	SecretName  string         `json:"secret_name"`
+	NamespaceID uint           `json:"namespace_id"`
+	Allowed     bool           `json:"allowed"`
+	Reason      string         `json:"reason"`
+	Level       string         `json:"level"`
+	Roles       []HeldRole     `json:"roles"`
+	Trace       []DecisionStep `json:"trace"`
+}
+
+// ExplainAccess decides whether the user named user, a username or an
+// email address, may perform action on a secret, and traces the checks in
+// the order they apply: the account, ownership, grants on the secret and
+// its folders, group membership and roles, and deny rules, which override
+// everything else. Users who hold roles may only do what their roles
+// grant, and roles exempt users from deny rules, but they give no access
+// that grants withhold. Session scopes, API client scopes and the
+// network policy are not part of the decision.
+func (c *SecretlyCore) ExplainAccess(ctx context.Context, user, action string, secretID uint) (*AccessDecision, error) {
+	need, ok := explainableActions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot explain %q; use one of secrets.list, secrets.read, secrets.write, secrets.share or secrets.delete",
+			ErrInvalidRBAC, action)
+	}
+	if err := c.requirePermission(ctx, PermissionAccessReport, "explaining access"); err != nil {
+		return nil, err
+	}
+	secret, err := c.GetSecret(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := c.storage.Users().FindByUsername(user)
+	if err != nil && strings.Contains(user, "@") {
+		account, err = c.GetUserByEmail(ctx, user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", user, ErrNotFound)
+	}
+
+	d := &AccessDecision{
+		Username:    account.Username,
+		Action:      action,
+		SecretID:    secret.ID,
+		SecretName:  secret.Name,
+		NamespaceID: secret.NamespaceID,
+	}
+	step := func(check, effect, detail string, args ...any) {
+		d.Trace = append(d.Trace, DecisionStep{Check: check, Effect: effect, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	if account.DeactivatedAt != nil {
+		step("user", EffectDeny, "user %q was deactivated at %s", account.Username, account.DeactivatedAt.UTC().Format("2006-01-02 15:04:05 MST"))
+		d.Level, d.Reason = AccessNone, "the user is deactivated"
+		return d, nil
+	}
+	step("user", EffectNone, "user %q is active", account.Username)
+
+	explanation, err := c.explainPermission(secret, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case secret.Owner == "":
+		step("ownership", EffectNone, "the secret has no owner")
+	case secret.Owner == account.Username:
+		step("ownership", EffectAllow, "%q owns the secret and keeps write access", account.Username)
+	default:
+		step("ownership", EffectNone, "the secret is owned by %q", secret.Owner)
+	}
+	if last := explanation.Path[len(explanation.Path)-1]; last.Grants > 0 {
+		level, effect := last.Level, EffectAllow
+		if level == "" {
+			level, effect = AccessNone, EffectDeny
+		}
+		from := "the secret itself"
+		if last.NodeID != secret.ID {
+			from = fmt.Sprintf("folder %q (id %d)", last.Name, last.NodeID)
+		}
+		step("grants", effect, "%s has %d grant(s); %q has %s access there", from, last.Grants, account.Username, level)
+	} else {
+		step("grants", EffectAllow, "no folder or secret on the path has grants, so every user has write access")
+	}
+
+	groups, err := c.userGroups(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		step("groups", EffectNone, "%q is in no group", account.Username)
+	} else {
+		step("groups", EffectNone, "%q is in %s", account.Username, strings.Join(groups, ", "))
+	}
+	if d.Roles, err = c.heldRoles(account.ID, secret.NamespaceID); err != nil {
+		return nil, err
+	}
+	if d.Roles == nil {
+		d.Roles = []HeldRole{}
+	}
+	permissions, restricted, err := c.rolePermissions(account.ID, secret.NamespaceID)
+	if err != nil {
+		return nil, err
+	}
+	lacking := ""
+	if restricted && !permissions[action] && (action != PermissionSecretsList || !permissions[PermissionSecretsRead]) {
+		lacking = action
+	}
+	if err := c.traceRoles(ctx, d, action, lacking, step); err != nil {
+		return nil, err
+	}
+
+	// explainPermission checks the deny rules on reads and writes only
+	d.Level = explanation.Level
+	denies, deniedBy := explanation.Denies, explanation.DeniedBy
+	if action == PermissionSecretsDelete && d.Level == AccessWrite {
+		matches, err := c.matchDeny(account.ID, secret.NamespaceID, action)
+		if err != nil {
+			return nil, err
+		}
+		denies = append(denies, matches...)
+		if rule := denied(matches); rule != nil {
+			deniedBy = rule.Rule
+		}
+	}
+	for _, m := range denies {
+		if m.ExemptBy != "" {
+			step("deny", EffectNone, "deny rule %q on %s does not apply: %q holds role %q", m.Rule, m.Permission, account.Username, m.ExemptBy)
+		} else {
+			step("deny", EffectDeny, "deny rule %q denies %s", m.Rule, m.Permission)
+		}
+	}
+	if len(denies) == 0 {
+		step("deny", EffectNone, "no deny rule applies")
+	}
+
+	switch {
+	case lacking != "":
+		d.Reason = fmt.Sprintf("no role of %q grants %s", d.Username, lacking)
+	case action == PermissionSecretsDelete && deniedBy != "" && d.Level == AccessWrite:
+		d.Reason = fmt.Sprintf("deny rule %q denies %s", deniedBy, action)
+	case d.Level == AccessWrite, d.Level == AccessRead && need == AccessRead:
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s access through %s is enough for %s", d.Level, explanation.Source, action)
+	case deniedBy != "":
+		d.Reason = fmt.Sprintf("deny rule %q lowers the access to %s", deniedBy, d.Level)
+	default:
+		d.Reason = fmt.Sprintf("%s needs %s access, but the user has %s", action, need, d.Level)
+	}
+	return d, nil
+}
+
+// traceRoles adds the roles step, naming the held roles that include
+// action; lacking is action when the user holds roles but none grants it
+func (c *SecretlyCore) traceRoles(ctx context.Context, d *AccessDecision, action, lacking string, step func(check, effect, detail string, args ...any)) error {
+	if len(d.Roles) == 0 {
+		step("roles", EffectNone, "%q holds no role in namespace %d", d.Username, d.NamespaceID)
+		return nil
+	}
+	roles, err := c.ListRoles(ctx)
+	if err != nil {
+		return err
+	}
+	var held []string
+	for _, h := range d.Roles {
+		name := h.Role
+		if h.Group != "" {
+			name += " (via group " + h.Group + ")"
+		}
+		for _, role := range roles {
+			if role.Name == h.Role && slices.Contains(role.Permissions, action) {
+				name += ", which includes " + action
+			}
+		}
+		held = append(held, name)
+	}
+	if lacking != "" {
+		step("roles", EffectDeny, "%q holds %s, none of which grants %s; users with roles may only do what their roles grant",
+			d.Username, strings.Join(held, "; "), lacking)
+		return nil
+	}
+	step("roles", EffectNone, "%q holds %s; roles exempt users from deny rules but give no access that grants withhold",
+		d.Username, strings.Join(held, "; "))
+	return nil
+}
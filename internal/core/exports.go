@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/envfile"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/datatypes"
+)
+
+// Audit event types for export profiles
+const (
+	EventExportProfileSaved   = "export_profile_saved"
+	EventExportProfileDeleted = "export_profile_deleted"
+)
+
+// ErrInvalidProfile is returned for export profiles that cannot be saved or
+// rendered, e.g. when two secrets map to the same variable
+var ErrInvalidProfile = errors.New("invalid export profile")
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// ExportProfile maps secrets of one namespace, zone and environment to
+// environment variable names. Without Secrets every secret directly under
+// Prefix belongs to the profile, named like "app/db-password" -> DB_PASSWORD.
+// The names are then prefixed with VarPrefix and, with Uppercase,
+// upper-cased. With FlattenJSON a json secret becomes one variable per key,
+// e.g. DB_HOST and DB_PORT for a secret mapped to DB.
+type ExportProfile struct {
+	Name          string            `json:"name"`
+	NamespaceID   uint              `json:"namespace_id"`
+	ZoneID        uint              `json:"zone_id"`
+	EnvironmentID uint              `json:"environment_id"`
+	Prefix        string            `json:"prefix,omitempty"`
+	Secrets       map[string]string `json:"secrets,omitempty"`
+	VarPrefix     string            `json:"var_prefix,omitempty"`
+	Uppercase     bool              `json:"uppercase"`
+	FlattenJSON   bool              `json:"flatten_json"`
+	CreatedBy     string            `json:"created_by,omitempty"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// ExportVar is one environment variable rendered from a profile
+type ExportVar struct {
+	Key        string
+	Value      []byte
+	SecretID   uint
+	SecretName string
+}
+
+// Mapping returns how the profile names secrets, without JSON flattening
+func (p *ExportProfile) Mapping() envfile.Profile {
+	return envfile.Profile{Prefix: p.Prefix, Secrets: p.Secrets, VarPrefix: p.VarPrefix, Uppercase: p.Uppercase}
+}
+
+// Scope returns the filter selecting the profile's secrets
+func (p *ExportProfile) Scope() *ListSecretsFilter {
+	return &ListSecretsFilter{NamespaceID: p.NamespaceID, ZoneID: p.ZoneID, EnvironmentID: p.EnvironmentID}
+}
+
+// SaveExportProfile creates the profile or replaces the one with its name
+func (c *SecretlyCore) SaveExportProfile(ctx context.Context, profile *ExportProfile) (*ExportProfile, error) {
+	if err := c.requirePermission(ctx, PermissionSecretsWrite, "changing export profiles"); err != nil {
+		return nil, err
+	}
+	if !profileNamePattern.MatchString(profile.Name) {
+		return nil, fmt.Errorf("%w: name %q must be lower-case letters, digits, '.', '_' or '-'", ErrInvalidProfile, profile.Name)
+	}
+	if profile.Prefix == "" && len(profile.Secrets) == 0 {
+		return nil, fmt.Errorf("%w: set a secret name prefix or list the secrets", ErrInvalidProfile)
+	}
+	if profile.VarPrefix != "" && !envfile.ValidKey(profile.VarPrefix) {
+		return nil, fmt.Errorf("%w: variable prefix %q is not a valid environment variable name", ErrInvalidProfile, profile.VarPrefix)
+	}
+	for key := range profile.Secrets {
+		if !envfile.ValidKey(key) {
+			return nil, fmt.Errorf("%w: %q is not a valid environment variable name", ErrInvalidProfile, key)
+		}
+	}
+	if err := c.ValidateScope(ctx, profile.NamespaceID, profile.ZoneID, profile.EnvironmentID); err != nil {
+		return nil, err
+	}
+
+	var secrets datatypes.JSON
+	if len(profile.Secrets) > 0 {
+		encoded, err := json.Marshal(profile.Secrets)
+		if err != nil {
+			return nil, err
+		}
+		secrets = datatypes.JSON(encoded)
+	}
+	record := &models.ExportProfile{
+		Name:          profile.Name,
+		NamespaceID:   profile.NamespaceID,
+		ZoneID:        profile.ZoneID,
+		EnvironmentID: profile.EnvironmentID,
+		Prefix:        profile.Prefix,
+		Secrets:       secrets,
+		VarPrefix:     profile.VarPrefix,
+		Uppercase:     profile.Uppercase,
+		FlattenJSON:   profile.FlattenJSON,
+		CreatedBy:     profile.CreatedBy,
+	}
+	if err := c.storage.ExportProfiles().Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save export profile %q: %w", profile.Name, err)
+	}
+	c.recordClientEvent(ctx, EventExportProfileSaved, nil, fmt.Sprintf("Export profile %q saved", profile.Name))
+	return exportProfileFrom(record)
+}
+
+// GetExportProfile returns the profile with the given name
+func (c *SecretlyCore) GetExportProfile(ctx context.Context, name string) (*ExportProfile, error) {
+	record, err := c.storage.ExportProfiles().FindByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("export profile %q: %w", name, err)
+	}
+	return exportProfileFrom(record)
+}
+
+// ListExportProfiles returns all profiles by name
+func (c *SecretlyCore) ListExportProfiles(ctx context.Context) ([]ExportProfile, error) {
+	records, err := c.storage.ExportProfiles().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export profiles: %w", err)
+	}
+	profiles := make([]ExportProfile, 0, len(records))
+	for i := range records {
+		profile, err := exportProfileFrom(&records[i])
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+	return profiles, nil
+}
+
+// DeleteExportProfile removes a profile; the secrets are left alone
+func (c *SecretlyCore) DeleteExportProfile(ctx context.Context, name string) error {
+	if err := c.requirePermission(ctx, PermissionSecretsWrite, "changing export profiles"); err != nil {
+		return err
+	}
+	if err := c.storage.ExportProfiles().Delete(name); err != nil {
+		return fmt.Errorf("export profile %q: %w", name, err)
+	}
+	c.recordClientEvent(ctx, EventExportProfileDeleted, nil, fmt.Sprintf("Export profile %q deleted", name))
+	return nil
+}
+
+// ExportProfileVars reads the secrets of a profile and returns them as
+// environment variables sorted by key. Every secret is read, counting
+// against max reads. Secrets the actor in ctx may not read are left out.
+func (c *SecretlyCore) ExportProfileVars(ctx context.Context, profile *ExportProfile) ([]ExportVar, error) {
+	secrets, _, err := c.ListSecrets(ctx, profile.Scope())
+	if err != nil {
+		return nil, err
+	}
+	mapping := profile.Mapping()
+	var vars []ExportVar
+	from := make(map[string]string)
+	add := func(key string, value []byte, secret *models.SecretNode) error {
+		if other, dup := from[key]; dup {
+			return fmt.Errorf("%w: secrets %q and %q both map to %s", ErrInvalidProfile, other, secret.Name, key)
+		}
+		from[key] = secret.Name
+		vars = append(vars, ExportVar{Key: key, Value: value, SecretID: secret.ID, SecretName: secret.Name})
+		return nil
+	}
+
+	for i := range secrets {
+		secret := &secrets[i]
+		key, ok := mapping.KeyFor(secret.Name)
+		if !ok {
+			continue
+		}
+		value, err := c.GetSecretValue(ctx, secret.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", secret.Name, err)
+		}
+		if !profile.FlattenJSON || secret.Type != TypeJSON {
+			if err := add(key, value, secret); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		obj, err := decodeObject(value)
+		wipe(value)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", secret.Name, err)
+		}
+		var paths []string
+		collectPaths("", obj, &paths)
+		for _, path := range paths {
+			leaf, _ := lookupPath(obj, path)
+			encoded, err := encodeLeaf(leaf)
+			if err != nil {
+				return nil, err
+			}
+			if err := add(mapping.FlatKey(key, path), encoded, secret); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+	return vars, nil
+}
+
+func exportProfileFrom(record *models.ExportProfile) (*ExportProfile, error) {
+	profile := &ExportProfile{
+		Name:          record.Name,
+		NamespaceID:   record.NamespaceID,
+		ZoneID:        record.ZoneID,
+		EnvironmentID: record.EnvironmentID,
+		Prefix:        record.Prefix,
+		VarPrefix:     record.VarPrefix,
+		Uppercase:     record.Uppercase,
+		FlattenJSON:   record.FlattenJSON,
+		CreatedBy:     record.CreatedBy,
+		UpdatedAt:     record.UpdatedAt,
+	}
+	if len(record.Secrets) > 0 {
+		if err := json.Unmarshal(record.Secrets, &profile.Secrets); err != nil {
+			return nil, fmt.Errorf("export profile %q: invalid secrets: %w", record.Name, err)
+		}
+	}
+	return profile, nil
+}
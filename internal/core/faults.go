@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/faults"
+)
+
+// EventFaultsChanged is recorded when an admin replaces the fault
+// injection rules
+const EventFaultsChanged = "faults_changed"
+
+// ErrFaultsDisabled is returned by the fault injection operations when
+// faults is not enabled
+var ErrFaultsDisabled = errors.New("fault injection is not enabled")
+
+type faultPolicy struct {
+	injector *faults.Injector
+}
+
+// SetFaults lets holders of system.manage read and replace the rules of
+// injector, which the caller installed in storage and encryption
+func (c *SecretlyCore) SetFaults(injector *faults.Injector) {
+	if injector == nil {
+		c.faults = nil
+		return
+	}
+	c.faults = &faultPolicy{injector: injector}
+}
+
+// FaultRules returns the fault injection rules with how many errors each
+// injected
+func (c *SecretlyCore) FaultRules(ctx context.Context) ([]faults.Rule, error) {
+	if err := c.checkFaultsAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return c.faults.injector.Rules(), nil
+}
+
+// SetFaultRules replaces the fault injection rules; none stops injecting
+func (c *SecretlyCore) SetFaultRules(ctx context.Context, rules []faults.Rule) ([]faults.Rule, error) {
+	if err := c.checkFaultsAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.faults.injector.SetRules(rules); err != nil {
+		return nil, err
+	}
+	var userID *uint
+	if auth, err := c.actor(ctx); err == nil && auth.User != nil {
+		userID = &auth.User.ID
+	}
+	c.recordUserEvent(ctx, EventFaultsChanged, userID, nil, fmt.Sprintf("Fault injection set to %d rules by %q", len(rules), c.actorName(ctx)))
+	return c.faults.injector.Rules(), nil
+}
+
+func (c *SecretlyCore) checkFaultsAdmin(ctx context.Context) error {
+	if c.faults == nil {
+		return ErrFaultsDisabled
+	}
+	return c.requirePermission(ctx, PermissionSystemManage, "fault injection")
+}
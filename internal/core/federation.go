@@ -0,0 +1,332 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/oidc"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+const (
+	// DefaultFederatedSessionTTL applies to OIDC sessions when neither the
+	// policy nor auth.oidc.default_ttl_seconds sets one
+	DefaultFederatedSessionTTL = 15 * time.Minute
+	maxFederatedSessionTTL     = time.Hour
+)
+
+var (
+	// ErrOIDCDisabled is returned when token exchange is not configured
+	ErrOIDCDisabled = errors.New("OIDC federation is not enabled")
+)
+
+type federation struct {
+	audience   string
+	defaultTTL time.Duration
+	verifiers  map[string]*oidc.Verifier
+	policies   []config.OIDCPolicyConfig
+}
+
+// SetOIDC enables exchanging CI identity tokens for scoped sessions. Every
+// policy must reference a configured provider and name the user it acts as.
+func (c *SecretlyCore) SetOIDC(cfg config.OIDCConfig) error {
+	if !cfg.Enabled {
+		c.federation = nil
+		return nil
+	}
+	if cfg.Audience == "" {
+		return fmt.Errorf("auth.oidc.audience is required")
+	}
+
+	f := &federation{
+		audience:   cfg.Audience,
+		defaultTTL: DefaultFederatedSessionTTL,
+		verifiers:  make(map[string]*oidc.Verifier, len(cfg.Providers)),
+		policies:   cfg.Policies,
+	}
+	if cfg.DefaultTTLSeconds > 0 {
+		f.defaultTTL = time.Duration(cfg.DefaultTTLSeconds) * time.Second
+	}
+	for _, p := range cfg.Providers {
+		if p.Name == "" || p.Issuer == "" {
+			return fmt.Errorf("auth.oidc providers need a name and issuer")
+		}
+		f.verifiers[p.Name] = oidc.NewVerifier(p.Issuer, p.JWKSURL, nil)
+	}
+	for _, p := range cfg.Policies {
+		if _, ok := f.verifiers[p.Provider]; !ok {
+			return fmt.Errorf("auth.oidc policy %q references unknown provider %q", p.Name, p.Provider)
+		}
+		if p.Name == "" || p.Username == "" || len(p.Claims) == 0 {
+			return fmt.Errorf("auth.oidc policy %q needs a name, username and at least one claim", p.Name)
+		}
+		if isEnrollmentScope(p.Name) || strings.HasPrefix(p.Name, clientScopePrefix) || strings.HasPrefix(p.Name, deviceScopePrefix) ||
+			strings.HasPrefix(p.Name, serviceScopePrefix) || strings.HasPrefix(p.Name, impersonationScopePrefix) {
+			return fmt.Errorf("auth.oidc policy name %q is reserved", p.Name)
+		}
+	}
+	c.federation = f
+	return nil
+}
+
+// ExchangeOIDCToken verifies a CI identity token and opens a short-lived
+// session for the user of the first policy whose claims match
+func (c *SecretlyCore) ExchangeOIDCToken(ctx context.Context, rawToken string) (string, *models.Session, error) {
+	f := c.federation
+	if f == nil {
+		return "", nil, ErrOIDCDisabled
+	}
+
+	issuer := oidc.PeekIssuer(rawToken)
+	var (
+		claims   oidc.Claims
+		provider string
+	)
+	for name, v := range f.verifiers {
+		if v.Issuer() != issuer {
+			continue
+		}
+		verified, err := v.Verify(ctx, rawToken, f.audience)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+		claims, provider = verified, name
+		break
+	}
+	if claims == nil {
+		return "", nil, fmt.Errorf("%w: untrusted issuer %q", ErrInvalidCredentials, issuer)
+	}
+
+	policy := f.match(provider, claims)
+	if policy == nil {
+		return "", nil, fmt.Errorf("%w: no policy matches subject %q", ErrInvalidCredentials, claims.String("sub"))
+	}
+	user, err := c.storage.Users().FindByUsername(policy.Username)
+	if err != nil {
+		return "", nil, fmt.Errorf("policy %q user %q not found: %w", policy.Name, policy.Username, err)
+	}
+	if user.DeactivatedAt != nil {
+		return "", nil, fmt.Errorf("%w: policy %q user %q is deactivated", ErrInvalidCredentials, policy.Name, policy.Username)
+	}
+	if err := c.checkClientNetwork(ctx, user.Username, &user.ID); err != nil {
+		return "", nil, err
+	}
+
+	ttl := f.defaultTTL
+	if policy.TTLSeconds > 0 {
+		ttl = time.Duration(policy.TTLSeconds) * time.Second
+	}
+	if ttl > maxFederatedSessionTTL {
+		ttl = maxFederatedSessionTTL
+	}
+
+	token, session, err := c.openSession(ctx, &models.Session{
+		UserID:  user.ID,
+		Scope:   policy.Name,
+		Subject: claims.String("sub"),
+	}, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.recordUserEvent(ctx, EventUserLogin, &user.ID, nil, fmt.Sprintf("User %q logged in via OIDC policy %q (subject %q)",
+		user.Username, policy.Name, session.Subject))
+	return token, session, nil
+}
+
+func (f *federation) match(provider string, claims oidc.Claims) *config.OIDCPolicyConfig {
+	for i := range f.policies {
+		p := &f.policies[i]
+		if p.Provider == provider && claims.Match(p.Claims) {
+			return p
+		}
+	}
+	return nil
+}
+
+// restriction is what a scoped session may access: the limits of the OIDC
+// policy or API client that opened it
+type restriction struct {
+	// name describes the source in errors, e.g. `policy "deploy"`
+	name        string
+	read, write bool
+	// exists lets the session check which secrets exist without reading them
+	exists        bool
+	namespaceIDs  []uint
+	environmentID uint
+}
+
+// sessionRestriction returns the restriction of a scoped session, or nil
+// for unscoped sessions. A scope whose policy or client was removed denies
+// everything.
+func (c *SecretlyCore) sessionRestriction(session *models.Session) (*restriction, error) {
+	if session == nil || session.Scope == "" {
+		return nil, nil
+	}
+	if isEnrollmentScope(session.Scope) {
+		return nil, fmt.Errorf("%w: enroll the required second factor first", ErrPermissionDenied)
+	}
+	if clientID, ok := strings.CutPrefix(session.Scope, clientScopePrefix); ok {
+		return c.clientRestriction(clientID)
+	}
+	if deviceID, ok := strings.CutPrefix(session.Scope, deviceScopePrefix); ok {
+		return c.deviceRestriction(deviceID)
+	}
+	// Service account tokens and impersonation sessions act with the
+	// user's full access
+	if strings.HasPrefix(session.Scope, serviceScopePrefix) || strings.HasPrefix(session.Scope, impersonationScopePrefix) {
+		return nil, nil
+	}
+	if c.federation != nil {
+		for i := range c.federation.policies {
+			if p := &c.federation.policies[i]; p.Name == session.Scope {
+				r := &restriction{name: fmt.Sprintf("policy %q", p.Name), read: true, write: !p.ReadOnly, environmentID: p.EnvironmentID}
+				if p.NamespaceID != 0 {
+					r.namespaceIDs = []uint{p.NamespaceID}
+				}
+				return r, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: policy %q no longer exists", ErrPermissionDenied, session.Scope)
+}
+
+// AuthorizeSecret checks that the actor in ctx may access secret, and may
+// modify it when write is set: within its session's scope, the grants on
+// the secret and its folders and the namespace network policy. System
+// actors are only subject to the network policy, and their changes are
+// recorded as bypasses. Denials are recorded in the audit log.
+func (c *SecretlyCore) AuthorizeSecret(ctx context.Context, secret *models.SecretNode, write bool) error {
+	secretID := secret.ID
+	auth, err := c.actor(ctx)
+	if err != nil {
+		c.recordUserEvent(ctx, EventAccessDenied, nil, &secretID, fmt.Sprintf("Call without an actor denied access to secret %q", secret.Name))
+		return err
+	}
+	session := auth.Session
+	if err := c.checkAccess(session, secret, write); err != nil {
+		var userID *uint
+		if session != nil && session.UserID != 0 {
+			userID = &session.UserID
+		}
+		desc := fmt.Sprintf("Session of user %d denied access to secret %q: %v", session.UserID, secret.Name, err)
+		if session.Scope != "" {
+			desc = fmt.Sprintf("Session scoped by %s (subject %q) denied access to secret %q: %v",
+				describeScope(session.Scope), session.Subject, secret.Name, err)
+		}
+		c.recordUserEvent(ctx, EventAccessDenied, userID, &secretID, desc)
+		return err
+	}
+	if err := c.CheckNamespaceNetwork(ctx, secret); err != nil {
+		return err
+	}
+	if write {
+		c.recordBypass(ctx, secret)
+	}
+	return nil
+}
+
+// checkAccess is AuthorizeSecret without the audit record
+func (c *SecretlyCore) checkAccess(session *models.Session, secret *models.SecretNode, write bool) error {
+	if err := c.checkSessionScope(session, secret, write); err != nil {
+		return err
+	}
+	return c.CheckSecretPermission(session, secret, write)
+}
+
+// checkSessionScope checks the scope of a restricted session
+func (c *SecretlyCore) checkSessionScope(session *models.Session, secret *models.SecretNode, write bool) error {
+	r, err := c.sessionRestriction(session)
+	if err != nil || r == nil {
+		return err
+	}
+	if write && !r.write {
+		return fmt.Errorf("%w: %s is read-only", ErrPermissionDenied, r.name)
+	}
+	if !write && !r.read {
+		return fmt.Errorf("%w: %s cannot read secrets", ErrPermissionDenied, r.name)
+	}
+	return r.covers(secret)
+}
+
+// covers checks that secret is within the namespaces and environment of r
+func (r *restriction) covers(secret *models.SecretNode) error {
+	if len(r.namespaceIDs) > 0 && !slices.Contains(r.namespaceIDs, secret.NamespaceID) {
+		return fmt.Errorf("%w: secret is outside namespace %s", ErrPermissionDenied, joinIDs(r.namespaceIDs))
+	}
+	if r.environmentID != 0 && secret.EnvironmentID != r.environmentID {
+		return fmt.Errorf("%w: secret is outside environment %d", ErrPermissionDenied, r.environmentID)
+	}
+	return nil
+}
+
+// seesSecrets reports whether r allows any access to secrets, at least
+// checking that they exist
+func (r *restriction) seesSecrets() bool {
+	return r.read || r.write || r.exists
+}
+
+// ScopeFilter narrows a list filter to what the actor in ctx may see. A
+// session limited to several namespaces has to list one of them at a time.
+func (c *SecretlyCore) ScopeFilter(ctx context.Context, filter *ListSecretsFilter) error {
+	return c.scopeFilter(ctx, filter, false)
+}
+
+// scopeFilter is ScopeFilter; with presence set, sessions that may only
+// check which secrets exist pass too
+func (c *SecretlyCore) scopeFilter(ctx context.Context, filter *ListSecretsFilter, presence bool) error {
+	session, err := c.actorSession(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := c.sessionRestriction(session)
+	if err != nil || r == nil {
+		return err
+	}
+	if presence && !r.seesSecrets() {
+		return fmt.Errorf("%w: %s cannot see secrets", ErrPermissionDenied, r.name)
+	}
+	if !presence && !r.read {
+		return fmt.Errorf("%w: %s cannot read secrets", ErrPermissionDenied, r.name)
+	}
+	switch {
+	case len(r.namespaceIDs) == 0:
+	case filter.NamespaceID != 0:
+		if !slices.Contains(r.namespaceIDs, filter.NamespaceID) {
+			return fmt.Errorf("%w: namespace %d is outside the session scope", ErrPermissionDenied, filter.NamespaceID)
+		}
+	case len(r.namespaceIDs) == 1:
+		filter.NamespaceID = r.namespaceIDs[0]
+	default:
+		return fmt.Errorf("%w: choose one of namespaces %s", ErrPermissionDenied, joinIDs(r.namespaceIDs))
+	}
+	if r.environmentID != 0 {
+		if filter.EnvironmentID != 0 && filter.EnvironmentID != r.environmentID {
+			return fmt.Errorf("%w: environment %d is outside the session scope", ErrPermissionDenied, filter.EnvironmentID)
+		}
+		filter.EnvironmentID = r.environmentID
+	}
+	return nil
+}
+
+// describeScope names the policy or client behind a session scope
+func describeScope(scope string) string {
+	if clientID, ok := strings.CutPrefix(scope, clientScopePrefix); ok {
+		return fmt.Sprintf("API client %q", clientID)
+	}
+	if deviceID, ok := strings.CutPrefix(scope, deviceScopePrefix); ok {
+		return "device " + deviceID
+	}
+	if name, ok := strings.CutPrefix(scope, serviceScopePrefix); ok {
+		return fmt.Sprintf("service account %q", name)
+	}
+	if admin, ok := strings.CutPrefix(scope, impersonationScopePrefix); ok {
+		return fmt.Sprintf("impersonation by %q", admin)
+	}
+	return fmt.Sprintf("policy %q", scope)
+}
@@ -0,0 +1,422 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/gitops"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit events of GitOps reconciliation
+const (
+	EventGitOpsDrift              = "gitops_drift"
+	EventGitOpsPlaceholderCreated = "gitops_placeholder_created"
+	EventGitOpsSyncFailed         = "gitops_sync_failed"
+)
+
+// SecretStatusPlaceholder marks a secret created from the GitOps manifest
+// that has no value yet. It cannot be read until a value is set.
+const SecretStatusPlaceholder = "placeholder"
+
+// States of a declared secret in a GitOps report
+const (
+	GitOpsInSync  = "in_sync"
+	GitOpsDrifted = "drift"
+	GitOpsMissing = "missing"
+	GitOpsCreated = "created"
+	GitOpsFailed  = "failed"
+)
+
+// gitopsActor is recorded as the creator of placeholders and folders
+const gitopsActor = "gitops"
+
+var (
+	// ErrGitOpsDisabled is returned by the GitOps operations when
+	// secrets.gitops is not enabled
+	ErrGitOpsDisabled = errors.New("gitops is not enabled")
+	// ErrPlaceholder is returned when reading a placeholder secret
+	ErrPlaceholder = errors.New("secret is a placeholder awaiting its value")
+)
+
+type gitopsPolicy struct {
+	interval time.Duration
+	create   bool
+	fetch    func(ctx context.Context) (*gitops.Manifest, string, error)
+
+	mu   sync.Mutex
+	last *GitOpsReport
+}
+
+// GitOpsReport compares the manifest of a commit with the secrets
+type GitOpsReport struct {
+	Commit string `json:"commit,omitempty"`
+	// SyncedAt is when the manifest was last read and compared
+	SyncedAt time.Time `json:"synced_at"`
+	// Error is why the latest attempt failed, when it did; the report is
+	// then the one of the last successful sync
+	Error     string         `json:"error,omitempty"`
+	FailedAt  *time.Time     `json:"failed_at,omitempty"`
+	Secrets   []GitOpsSecret `json:"secrets"`
+	Unmanaged []GitOpsSecret `json:"unmanaged"`
+}
+
+// GitOpsSecret is a secret of the manifest, or one in the same scope that
+// the manifest does not declare, and how it compares
+type GitOpsSecret struct {
+	Path          string        `json:"path"`
+	NamespaceID   uint          `json:"namespace_id"`
+	ZoneID        uint          `json:"zone_id"`
+	EnvironmentID uint          `json:"environment_id"`
+	SecretID      uint          `json:"secret_id,omitempty"`
+	State         string        `json:"state,omitempty"`
+	AwaitingValue bool          `json:"awaiting_value,omitempty"`
+	Drift         []GitOpsDrift `json:"drift,omitempty"`
+	Detail        string        `json:"detail,omitempty"`
+}
+
+// GitOpsDrift is a field whose value differs from the declared one
+type GitOpsDrift struct {
+	Field    string `json:"field"`
+	Declared string `json:"declared"`
+	Actual   string `json:"actual"`
+}
+
+// SetGitOps reconciles the secrets against the manifest in a Git
+// repository. Holders of system.manage may read the reports and start a
+// sync.
+func (c *SecretlyCore) SetGitOps(cfg config.GitOpsConfig) {
+	if !cfg.Enabled {
+		c.gitops = nil
+		return
+	}
+	p := &gitopsPolicy{interval: DefaultLifecycleInterval, create: cfg.CreatePlaceholders}
+	if cfg.IntervalSeconds > 0 {
+		p.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	p.fetch = func(ctx context.Context) (*gitops.Manifest, string, error) {
+		return gitops.Fetch(ctx, cfg.Repository, cfg.Branch, cfg.Path)
+	}
+	c.gitops = p
+}
+
+// GitOpsInterval returns how often RunGitOps syncs, or 0 when GitOps is
+// not enabled
+func (c *SecretlyCore) GitOpsInterval() time.Duration {
+	if c.gitops == nil {
+		return 0
+	}
+	return c.gitops.interval
+}
+
+// RunGitOps syncs with the manifest every interval until ctx is done
+func (c *SecretlyCore) RunGitOps(ctx context.Context, interval time.Duration) {
+	ctx = WithSystemActor(ctx, "gitops sync")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.SyncGitOps(ctx)
+		if err != nil {
+			log.Printf("⚠️  GitOps sync failed: %v", err)
+		} else if drifted, missing := report.counts(); drifted+missing > 0 {
+			log.Printf("🔀 GitOps: %d secrets drifted from and %d missing for the manifest at %s", drifted, missing, report.Commit)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncGitOps reads the manifest from the repository and compares it with
+// the secrets, creating placeholders for missing ones if configured.
+// Secrets that newly drift or go missing are audited once, as are failing
+// syncs.
+func (c *SecretlyCore) SyncGitOps(ctx context.Context) (*GitOpsReport, error) {
+	if err := c.checkGitOpsAdmin(ctx); err != nil {
+		return nil, err
+	}
+	p := c.gitops
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	manifest, commit, err := p.fetch(ctx)
+	if err != nil {
+		now := time.Now()
+		failed := &GitOpsReport{}
+		if p.last != nil {
+			*failed = *p.last
+		}
+		if failed.Error == "" {
+			c.recordEvent(ctx, EventGitOpsSyncFailed, nil, fmt.Sprintf("GitOps sync failed: %v", err))
+		}
+		failed.Error, failed.FailedAt = err.Error(), &now
+		p.last = failed
+		return nil, err
+	}
+	report, err := c.reconcileGitOps(ctx, manifest, p.create)
+	if err != nil {
+		return nil, err
+	}
+	report.Commit = commit
+
+	seen := map[string]bool{}
+	if p.last != nil {
+		for _, s := range p.last.Secrets {
+			if s.State == GitOpsDrifted || s.State == GitOpsMissing {
+				seen[s.key()] = true
+			}
+		}
+	}
+	for _, s := range report.Secrets {
+		if (s.State == GitOpsDrifted || s.State == GitOpsMissing) && !seen[s.key()] {
+			var secretID *uint
+			if s.SecretID != 0 {
+				secretID = &s.SecretID
+			}
+			c.recordEvent(ctx, EventGitOpsDrift, secretID, s.describe(commit))
+		}
+	}
+	p.last = report
+	return report, nil
+}
+
+// GitOpsStatus returns the report of the latest sync
+func (c *SecretlyCore) GitOpsStatus(ctx context.Context) (*GitOpsReport, error) {
+	if err := c.checkGitOpsAdmin(ctx); err != nil {
+		return nil, err
+	}
+	c.gitops.mu.Lock()
+	defer c.gitops.mu.Unlock()
+	if c.gitops.last == nil {
+		return nil, fmt.Errorf("no GitOps sync has run yet: %w", ErrNotFound)
+	}
+	report := *c.gitops.last
+	return &report, nil
+}
+
+// PlanGitOps compares a manifest with the secrets without changing
+// anything, e.g. to check a change to the manifest before merging it
+func (c *SecretlyCore) PlanGitOps(ctx context.Context, manifest *gitops.Manifest) (*GitOpsReport, error) {
+	if err := c.checkGitOpsAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return c.reconcileGitOps(ctx, manifest, false)
+}
+
+func (c *SecretlyCore) checkGitOpsAdmin(ctx context.Context) error {
+	if c.gitops == nil {
+		return ErrGitOpsDisabled
+	}
+	return c.requirePermission(ctx, PermissionSystemManage, "GitOps")
+}
+
+// reconcileGitOps compares manifest with the secrets in the scopes it
+// declares secrets in, and with create makes placeholders for the missing
+// ones
+func (c *SecretlyCore) reconcileGitOps(ctx context.Context, manifest *gitops.Manifest, create bool) (*GitOpsReport, error) {
+	report := &GitOpsReport{SyncedAt: time.Now(), Secrets: []GitOpsSecret{}, Unmanaged: []GitOpsSecret{}}
+	paths := map[uint]string{}
+	declared := map[uint]bool{}
+	scopes := map[[3]uint]bool{}
+	for i := range manifest.Secrets {
+		s := &manifest.Secrets[i]
+		scopes[[3]uint{s.NamespaceID, s.ZoneID, s.EnvironmentID}] = true
+		entry := GitOpsSecret{Path: s.Path, NamespaceID: s.NamespaceID, ZoneID: s.ZoneID, EnvironmentID: s.EnvironmentID}
+
+		node, err := c.secretByName(s.NamespaceID, s.ZoneID, s.EnvironmentID, s.Name())
+		switch {
+		case errors.Is(err, ErrNotFound) && create:
+			if node, err = c.createPlaceholder(ctx, s); err != nil {
+				entry.State, entry.Detail = GitOpsFailed, err.Error()
+			} else {
+				entry.State, entry.SecretID, entry.AwaitingValue = GitOpsCreated, node.ID, true
+				declared[node.ID] = true
+			}
+		case errors.Is(err, ErrNotFound):
+			entry.State = GitOpsMissing
+		case err != nil:
+			return nil, fmt.Errorf("failed to look up %q: %w", s.Path, err)
+		default:
+			declared[node.ID] = true
+			path, err := c.nodePath(node, paths)
+			if err != nil {
+				return nil, err
+			}
+			entry.SecretID, entry.Drift = node.ID, c.gitopsDrift(s, node, path)
+			entry.AwaitingValue = node.Status == SecretStatusPlaceholder
+			entry.State = GitOpsInSync
+			if len(entry.Drift) > 0 {
+				entry.State = GitOpsDrifted
+			}
+		}
+		report.Secrets = append(report.Secrets, entry)
+	}
+
+	all, err := c.storage.Secrets().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for i := range all {
+		node := &all[i]
+		if IsFolder(node) || declared[node.ID] || !scopes[[3]uint{node.NamespaceID, node.ZoneID, node.EnvironmentID}] {
+			continue
+		}
+		path, err := c.nodePath(node, paths)
+		if err != nil {
+			return nil, err
+		}
+		report.Unmanaged = append(report.Unmanaged, GitOpsSecret{
+			Path: path, NamespaceID: node.NamespaceID, ZoneID: node.ZoneID, EnvironmentID: node.EnvironmentID, SecretID: node.ID,
+		})
+	}
+	return report, nil
+}
+
+// gitopsDrift lists the declared fields of s that node does not match
+func (c *SecretlyCore) gitopsDrift(s *gitops.Secret, node *models.SecretNode, path string) []GitOpsDrift {
+	var drift []GitOpsDrift
+	add := func(field, declared, actual string) {
+		drift = append(drift, GitOpsDrift{Field: field, Declared: declared, Actual: actual})
+	}
+	if IsFolder(node) {
+		add("kind", "secret", "folder")
+	}
+	if c.secretNameKey(path) != c.secretNameKey(s.Path) {
+		add("path", s.Path, path)
+	}
+	if s.Type != "" && s.Type != node.Type {
+		add("type", s.Type, node.Type)
+	}
+	if s.Owner != "" && s.Owner != node.Owner {
+		add("owner", s.Owner, node.Owner)
+	}
+	if s.Tags != nil {
+		declared, actual := slices.Sorted(slices.Values(s.Tags)), slices.Sorted(slices.Values(SecretTags(node)))
+		if !slices.Equal(declared, actual) {
+			add("tags", strings.Join(declared, ","), strings.Join(actual, ","))
+		}
+	}
+	if s.MaxReads != nil && (node.MaxReads == nil || *node.MaxReads != *s.MaxReads) {
+		actual := "unlimited"
+		if node.MaxReads != nil {
+			actual = strconv.Itoa(*node.MaxReads)
+		}
+		add("max_reads", strconv.Itoa(*s.MaxReads), actual)
+	}
+	return drift
+}
+
+// createPlaceholder creates the secret s declares, and its folders, without
+// a value
+func (c *SecretlyCore) createPlaceholder(ctx context.Context, s *gitops.Secret) (*models.SecretNode, error) {
+	if s.Owner != "" {
+		if _, err := c.storage.Users().FindByUsername(s.Owner); err != nil {
+			return nil, fmt.Errorf("owner %q: %w", s.Owner, err)
+		}
+	}
+	var parent *uint
+	for _, name := range s.Folders() {
+		folder, err := c.secretByName(s.NamespaceID, s.ZoneID, s.EnvironmentID, name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			folder, err = c.CreateFolder(ctx, &CreateFolderRequest{
+				Name: name, NamespaceID: s.NamespaceID, ZoneID: s.ZoneID, EnvironmentID: s.EnvironmentID,
+				ParentID: parent, CreatedBy: gitopsActor,
+			})
+			if err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, fmt.Errorf("failed to look up folder %q: %w", name, err)
+		case !IsFolder(folder):
+			return nil, fmt.Errorf("%w: %q is a secret, not a folder", ErrInvalidParent, folder.Name)
+		case !sameParent(folder.ParentID, parent):
+			return nil, fmt.Errorf("%w: folder %q exists in another folder", ErrInvalidParent, folder.Name)
+		}
+		parent = &folder.ID
+	}
+
+	var metadata map[string]interface{}
+	if len(s.Tags) > 0 {
+		metadata = map[string]interface{}{"tags": s.Tags}
+	}
+	node, err := c.newSecretNode(ctx, &CreateSecretRequest{
+		Name:          s.Name(),
+		NamespaceID:   s.NamespaceID,
+		ZoneID:        s.ZoneID,
+		EnvironmentID: s.EnvironmentID,
+		Type:          s.Type,
+		MaxReads:      s.MaxReads,
+		CreatedBy:     gitopsActor,
+		Metadata:      metadata,
+		ParentID:      parent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	node.Owner, node.Status = s.Owner, SecretStatusPlaceholder
+	if err := c.storage.Secrets().Create(node); err != nil {
+		return nil, fmt.Errorf("failed to create placeholder: %w", nameConflict(node, err))
+	}
+	c.recordEvent(ctx, EventGitOpsPlaceholderCreated, &node.ID,
+		fmt.Sprintf("Placeholder %q created from the GitOps manifest, awaiting its value", s.Path))
+	return node, nil
+}
+
+// nodePath returns the folders and name of node, like "payments/api-key",
+// caching the paths of folders by ID
+func (c *SecretlyCore) nodePath(node *models.SecretNode, folders map[uint]string) (string, error) {
+	if node.ParentID == nil {
+		return node.Name, nil
+	}
+	prefix, ok := folders[*node.ParentID]
+	if !ok {
+		parent, err := c.storage.Secrets().GetByID(*node.ParentID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get folder %d: %w", *node.ParentID, err)
+		}
+		if prefix, err = c.nodePath(parent, folders); err != nil {
+			return "", err
+		}
+		folders[parent.ID] = prefix
+	}
+	return prefix + "/" + node.Name, nil
+}
+
+// counts returns how many declared secrets drifted and are missing
+func (r *GitOpsReport) counts() (drifted, missing int) {
+	for _, s := range r.Secrets {
+		switch s.State {
+		case GitOpsDrifted:
+			drifted++
+		case GitOpsMissing:
+			missing++
+		}
+	}
+	return drifted, missing
+}
+
+func (s *GitOpsSecret) key() string {
+	return fmt.Sprintf("%d/%d/%d/%s", s.NamespaceID, s.ZoneID, s.EnvironmentID, s.Path)
+}
+
+func (s *GitOpsSecret) describe(commit string) string {
+	if s.State == GitOpsMissing {
+		return fmt.Sprintf("Secret %q of the GitOps manifest at %s does not exist", s.Path, commit)
+	}
+	fields := make([]string, 0, len(s.Drift))
+	for _, d := range s.Drift {
+		fields = append(fields, fmt.Sprintf("%s is %q, declared %q", d.Field, d.Actual, d.Declared))
+	}
+	return fmt.Sprintf("Secret %q drifted from the GitOps manifest at %s: %s", s.Path, commit, strings.Join(fields, "; "))
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// EventImpersonationStarted is recorded when an admin opens a session as
+// another user
+const EventImpersonationStarted = "impersonation_started"
+
+const (
+	// DefaultImpersonationTTL applies when an admin does not choose how
+	// long an impersonation session lasts
+	DefaultImpersonationTTL = 15 * time.Minute
+	// DefaultImpersonationMaxMinutes applies when auth.impersonation does
+	// not set max_minutes
+	DefaultImpersonationMaxMinutes = 60
+
+	// impersonationScopePrefix starts the scope of impersonation sessions;
+	// the admin's username follows
+	impersonationScopePrefix = "impersonation:"
+)
+
+// ErrImpersonationDisabled is returned when impersonation is not enabled
+var ErrImpersonationDisabled = errors.New("impersonation is not enabled")
+
+type impersonationPolicy struct {
+	maxTTL time.Duration
+}
+
+// SetImpersonation lets holders of users.manage open sessions as other
+// users. Disabling it also stops the impersonation sessions still open.
+func (c *SecretlyCore) SetImpersonation(cfg config.ImpersonationConfig) {
+	if !cfg.Enabled {
+		c.impersonation = nil
+		return
+	}
+	minutes := cfg.MaxMinutes
+	if minutes <= 0 {
+		minutes = DefaultImpersonationMaxMinutes
+	}
+	c.impersonation = &impersonationPolicy{
+		maxTTL: time.Duration(minutes) * time.Minute,
+	}
+}
+
+// Impersonate opens a session acting as the user named user, a username or
+// an email address, for the admin in ctx, who must use a personal session.
+// The session has the user's full access but is not personal, so it cannot
+// impersonate again, read the audit log or do anything else that needs
+// one. Every audit event it causes names both the user and the admin.
+// Admins and approvers cannot be impersonated, so that impersonation never
+// gains their permissions or stands in for a second approver.
+func (c *SecretlyCore) Impersonate(ctx context.Context, user, reason string, ttl time.Duration) (string, *models.Session, error) {
+	p := c.impersonation
+	if p == nil {
+		return "", nil, ErrImpersonationDisabled
+	}
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if auth.User == nil || IsFederated(auth.Session) {
+		return "", nil, fmt.Errorf("%w: impersonation needs an admin's personal session", ErrPermissionDenied)
+	}
+	admin := auth.User
+	if !c.userHasPermission(admin, PermissionUsersManage) {
+		return "", nil, fmt.Errorf("%w: impersonation requires the %s permission", ErrPermissionDenied, PermissionUsersManage)
+	}
+	if ttl == 0 {
+		ttl = min(DefaultImpersonationTTL, p.maxTTL)
+	}
+	if ttl < 0 || ttl > p.maxTTL {
+		return "", nil, fmt.Errorf("impersonation lifetime must be between 0 and %s", p.maxTTL)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", nil, fmt.Errorf("a reason for impersonating %q is required", user)
+	}
+
+	target, err := c.storage.Users().FindByUsername(user)
+	if err != nil && strings.Contains(user, "@") {
+		target, err = c.GetUserByEmail(ctx, user)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("user %q: %w", user, ErrNotFound)
+	}
+	switch {
+	case target.ID == admin.ID:
+		return "", nil, fmt.Errorf("%w: cannot impersonate yourself", ErrPermissionDenied)
+	case c.isAdmin(target) || (c.approvals != nil && slices.Contains(c.approvals.admins, target.Username)):
+		return "", nil, fmt.Errorf("%w: admins cannot be impersonated", ErrPermissionDenied)
+	case target.DeactivatedAt != nil:
+		return "", nil, fmt.Errorf("user %q is deactivated", target.Username)
+	}
+
+	adminID := admin.ID
+	token, session, err := c.openSession(ctx, &models.Session{
+		UserID:         target.ID,
+		Scope:          impersonationScopePrefix + admin.Username,
+		ImpersonatorID: &adminID,
+	}, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	client := ClientInfoFrom(ctx)
+	client.ImpersonatorID = &adminID
+	c.recordUserEvent(WithClientInfo(ctx, client), EventImpersonationStarted, &target.ID, nil,
+		fmt.Sprintf("Admin %q started impersonating user %q until %s: %s",
+			admin.Username, target.Username, session.ExpiresAt.UTC().Format(time.RFC3339), reason))
+	return token, session, nil
+}
+
+// checkImpersonation refuses impersonation sessions once impersonation is
+// disabled or their admin is deactivated
+func (c *SecretlyCore) checkImpersonation(session *models.Session) error {
+	if session.ImpersonatorID == nil {
+		return nil
+	}
+	if c.impersonation == nil {
+		return ErrInvalidCredentials
+	}
+	admin, err := c.storage.Users().FindByID(*session.ImpersonatorID)
+	if err != nil || admin.DeactivatedAt != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// KeyDeriver is implemented by encryptors that can derive purpose-specific
+// keys from their key material; *encryption.Service satisfies it
+type KeyDeriver interface {
+	DeriveKey(purpose string) ([]byte, error)
+}
+
+const contentHashPurpose = "content-hash"
+
+// contentHashKeyKey is the configuration key of the per-install content
+// hash key, used when the encryptor does not derive keys
+const contentHashKeyKey = "content_hash_key"
+
+// Content hash algorithms. Hashes labelled legacyContentHash were stored
+// unkeyed by earlier releases; they are not shown to clients and are
+// replaced by VerifyIntegrity with backfill.
+const (
+	keyedContentHash  = "hmac-sha256"
+	legacyContentHash = "sha256"
+)
+
+// hashKeyCache holds the per-install content hash key once loaded
+type hashKeyCache struct {
+	mu  sync.Mutex
+	key []byte
+}
+
+// Integrity check outcomes for a single version
+const (
+	IntegrityOK         = "ok"
+	IntegrityMismatch   = "mismatch"
+	IntegrityUnreadable = "unreadable"
+	IntegrityUnhashed   = "unhashed"
+)
+
+// IntegrityResult is the outcome of verifying one secret version
+type IntegrityResult struct {
+	SecretID      uint
+	SecretName    string
+	VersionID     uint
+	VersionNumber int
+	Status        string
+	Error         string
+}
+
+// newContentHasher returns the hash for version content hashes and its label.
+// It is an HMAC keyed from the encryption key, so a database dump cannot be
+// used to brute-force low-entropy values, or, with an encryptor that does
+// not derive keys, from a per-install key, so that the hashes clients see
+// cannot be either.
+func (c *SecretlyCore) newContentHasher() (hash.Hash, string, error) {
+	if deriver, ok := c.encryptor.(KeyDeriver); ok {
+		key, err := deriver.DeriveKey(contentHashPurpose)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to derive content hash key: %w", err)
+		}
+		return hmac.New(sha256.New, key), keyedContentHash, nil
+	}
+	key, err := c.contentHashKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return hmac.New(sha256.New, key), keyedContentHash, nil
+}
+
+// contentHashKey returns the per-install content hash key, creating it in
+// storage on first use. The key is encrypted like secret values.
+func (c *SecretlyCore) contentHashKey() ([]byte, error) {
+	c.hashKey.mu.Lock()
+	defer c.hashKey.mu.Unlock()
+	if c.hashKey.key != nil {
+		return c.hashKey.key, nil
+	}
+
+	stored, err := c.storage.Config().Get(contentHashKeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load content hash key: %w", err)
+	}
+	if stored == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate content hash key: %w", err)
+		}
+		encrypted, _, err := c.encrypt(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt content hash key: %w", err)
+		}
+		stored = base64.StdEncoding.EncodeToString(encrypted)
+		if err := c.storage.Config().Set(contentHashKeyKey, stored); err != nil {
+			return nil, fmt.Errorf("failed to store content hash key: %w", err)
+		}
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode content hash key: %w", err)
+	}
+	key, err := c.decrypt(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content hash key: %w", err)
+	}
+	c.hashKey.key = key
+	return key, nil
+}
+
+// clientContentHash returns a content hash that may be shown to clients,
+// or "" for a legacy unkeyed one
+func clientContentHash(contentHash string) string {
+	if strings.HasPrefix(contentHash, legacyContentHash+":") {
+		return ""
+	}
+	return contentHash
+}
+
+// contentHash returns the "<algorithm>:<hex>" content hash of a plaintext value
+func (c *SecretlyCore) contentHash(value []byte) (string, error) {
+	h, algorithm, err := c.newContentHasher()
+	if err != nil {
+		return "", err
+	}
+	h.Write(value)
+	return formatContentHash(algorithm, h), nil
+}
+
+func formatContentHash(algorithm string, h hash.Hash) string {
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// sameContent compares content hashes in constant time
+func sameContent(a, b string) bool {
+	return a != "" && hmac.Equal([]byte(a), []byte(b))
+}
+
+// VerifyIntegrity decrypts every stored version and checks it against its
+// recorded content hash. Reads are not counted against max-reads limits.
+// With backfill, versions stored before hashing was introduced get a hash.
+func (c *SecretlyCore) VerifyIntegrity(ctx context.Context, backfill bool) ([]IntegrityResult, error) {
+	var results []IntegrityResult
+	var afterID uint
+	for {
+		secrets, err := c.storage.Secrets().ListAfter(repository.SecretQuery{AfterID: afterID, Limit: MaxCursorLimit})
+		if err != nil {
+			return results, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		if len(secrets) == 0 {
+			return results, nil
+		}
+
+		for i := range secrets {
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+			versions, err := c.storage.Secrets().GetVersions(secrets[i].ID)
+			if err != nil {
+				return results, fmt.Errorf("failed to get versions for secret %d: %w", secrets[i].ID, err)
+			}
+			for j := range versions {
+				results = append(results, c.verifyVersion(ctx, &secrets[i], &versions[j], backfill))
+			}
+		}
+		afterID = secrets[len(secrets)-1].ID
+	}
+}
+
+func (c *SecretlyCore) verifyVersion(ctx context.Context, secret *models.SecretNode, version *models.SecretVersion, backfill bool) IntegrityResult {
+	result := IntegrityResult{
+		SecretID:      secret.ID,
+		SecretName:    secret.Name,
+		VersionID:     version.ID,
+		VersionNumber: version.VersionNumber,
+	}
+
+	h, algorithm, err := c.newContentHasher()
+	legacy := sha256.New()
+	if err == nil {
+		_, err = c.writeVersionValue(ctx, version, io.MultiWriter(h, legacy))
+	}
+	if err != nil {
+		result.Status = IntegrityUnreadable
+		result.Error = err.Error()
+		return result
+	}
+	actual := formatContentHash(algorithm, h)
+
+	switch {
+	case version.ContentHash == "" || clientContentHash(version.ContentHash) == "":
+		if version.ContentHash != "" && !sameContent(version.ContentHash, formatContentHash(legacyContentHash, legacy)) {
+			result.Status = IntegrityMismatch
+			break
+		}
+		result.Status = IntegrityUnhashed
+		if backfill {
+			version.ContentHash = actual
+			if err := c.storage.Secrets().UpdateVersionContent(version); err != nil {
+				result.Error = fmt.Sprintf("failed to store hash: %v", err)
+			} else {
+				result.Status = IntegrityOK
+			}
+		}
+	case sameContent(version.ContentHash, actual):
+		result.Status = IntegrityOK
+	default:
+		result.Status = IntegrityMismatch
+	}
+	return result
+}
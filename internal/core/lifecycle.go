@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Audit event types for the lifecycle of expiring secrets
+const (
+	EventSecretExpiring = "secret_expiring"
+	EventSecretExpired  = "secret_expired"
+	EventSecretPurged   = "secret_purged"
+)
+
+const (
+	// SecretStatusActive and SecretStatusExpired are the values of
+	// SecretNode.Status
+	SecretStatusActive  = "active"
+	SecretStatusExpired = "expired"
+
+	// DefaultLifecycleInterval applies when secrets.lifecycle does not set
+	// interval_seconds
+	DefaultLifecycleInterval = time.Hour
+	// DefaultExpiryNotice applies when secrets.lifecycle does not set
+	// notify_days_before
+	DefaultExpiryNotice = 7 * 24 * time.Hour
+)
+
+// lifecycle is the expiry handling configured with SetLifecycle
+type lifecycle struct {
+	interval time.Duration
+	notice   time.Duration
+	grace    time.Duration
+	purge    bool
+	mailer   Mailer
+}
+
+// LifecycleReport counts what one lifecycle sweep did
+type LifecycleReport struct {
+	Notified int `json:"notified"`
+	Expired  int `json:"expired"`
+	Purged   int `json:"purged"`
+}
+
+// ExpirationSummary counts secrets by how soon they expire. Expired secrets
+// waiting for their grace period to end are counted in PendingPurge as well.
+type ExpirationSummary struct {
+	Within24h      int        `json:"within_24h"`
+	Within7d       int        `json:"within_7d"`
+	Within30d      int        `json:"within_30d"`
+	Expired        int        `json:"expired"`
+	PendingPurge   int        `json:"pending_purge"`
+	NextExpiration *time.Time `json:"next_expiration,omitempty"`
+}
+
+// SetLifecycle enables the lifecycle sweep: owners are warned
+// cfg.NotifyDaysBefore days before a secret expires, the secret is marked
+// expired at its deadline and, if cfg.GraceDays is set, deleted once the
+// grace period has passed. mailer, which may be nil, also emails the
+// warning to owners with an email address.
+func (c *SecretlyCore) SetLifecycle(cfg config.LifecycleConfig, mailer Mailer) {
+	if !cfg.Enabled {
+		c.lifecycle = nil
+		return
+	}
+	l := &lifecycle{interval: DefaultLifecycleInterval, notice: DefaultExpiryNotice, mailer: mailer}
+	if cfg.IntervalSeconds > 0 {
+		l.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	if cfg.NotifyDaysBefore > 0 {
+		l.notice = time.Duration(cfg.NotifyDaysBefore) * 24 * time.Hour
+	}
+	if cfg.GraceDays > 0 {
+		l.grace, l.purge = time.Duration(cfg.GraceDays)*24*time.Hour, true
+	}
+	c.lifecycle = l
+}
+
+// LifecycleInterval returns how often RunLifecycle sweeps, or 0 when the
+// lifecycle is not enabled
+func (c *SecretlyCore) LifecycleInterval() time.Duration {
+	if c.lifecycle == nil {
+		return 0
+	}
+	return c.lifecycle.interval
+}
+
+// RunLifecycle sweeps the secrets every interval until ctx is cancelled
+func (c *SecretlyCore) RunLifecycle(ctx context.Context, interval time.Duration) {
+	ctx = WithSystemActor(ctx, "lifecycle sweep")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.SweepSecretLifecycle(ctx)
+		if err != nil {
+			log.Printf("⚠️  Secret lifecycle sweep failed: %v", err)
+		} else if report.Notified+report.Expired+report.Purged > 0 {
+			log.Printf("⏳ Secret lifecycle: %d owners notified, %d secrets expired, %d purged", report.Notified, report.Expired, report.Purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepSecretLifecycle runs one pass over the secrets with an expiration.
+// Protected secrets are marked expired but never purged: deleting them
+// needs a second admin.
+func (c *SecretlyCore) SweepSecretLifecycle(ctx context.Context) (*LifecycleReport, error) {
+	l := c.lifecycle
+	if l == nil {
+		return nil, fmt.Errorf("secret lifecycle is not enabled")
+	}
+	report := &LifecycleReport{}
+	now := time.Now()
+	err := c.eachExpiringSecret(ctx, func(secret *models.SecretNode) error {
+		expiration := *secret.Expiration
+		switch {
+		case l.purge && !now.Before(expiration.Add(l.grace)) && !c.RequiresApproval(secret):
+			if err := c.purgeSecret(ctx, secret); err != nil {
+				return err
+			}
+			report.Purged++
+		case !now.Before(expiration):
+			if secret.Status == SecretStatusExpired {
+				return nil
+			}
+			if err := c.expireSecret(ctx, secret); err != nil {
+				return err
+			}
+			report.Expired++
+		case expiration.Sub(now) <= l.notice:
+			notified, err := c.notifyExpiring(ctx, secret)
+			if err != nil {
+				return err
+			}
+			if notified {
+				report.Notified++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ExpirationSummary counts the secrets that expire soon or have expired
+func (c *SecretlyCore) ExpirationSummary(ctx context.Context) (*ExpirationSummary, error) {
+	summary := &ExpirationSummary{}
+	now := time.Now()
+	err := c.eachExpiringSecret(ctx, func(secret *models.SecretNode) error {
+		left := secret.Expiration.Sub(now)
+		switch {
+		case left <= 0:
+			summary.Expired++
+			if c.lifecycle != nil && c.lifecycle.purge {
+				summary.PendingPurge++
+			}
+			return nil
+		case left <= 24*time.Hour:
+			summary.Within24h++
+			fallthrough
+		case left <= 7*24*time.Hour:
+			summary.Within7d++
+			fallthrough
+		case left <= 30*24*time.Hour:
+			summary.Within30d++
+		}
+		if summary.NextExpiration == nil || secret.Expiration.Before(*summary.NextExpiration) {
+			next := *secret.Expiration
+			summary.NextExpiration = &next
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// eachExpiringSecret calls fn for every secret with an expiration
+func (c *SecretlyCore) eachExpiringSecret(ctx context.Context, fn func(*models.SecretNode) error) error {
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return err
+		}
+		for i := range secrets {
+			if secrets[i].Expiration == nil {
+				continue
+			}
+			if err := fn(&secrets[i]); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// notifyExpiring warns the owner of secret once per expiration date. An
+// earlier warning counts only if it was sent inside the current notice
+// window, so moving the expiration out and back in warns again.
+func (c *SecretlyCore) notifyExpiring(ctx context.Context, secret *models.SecretNode) (bool, error) {
+	expiration := *secret.Expiration
+	sent, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+		Types:    []string{EventSecretExpiring},
+		SecretID: secret.ID,
+		From:     expiration.Add(-c.lifecycle.notice),
+		Limit:    1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check secret %d: %w", secret.ID, err)
+	}
+	if len(sent) > 0 {
+		return false, nil
+	}
+
+	owner := SecretOwner(secret)
+	var ownerID *uint
+	var email string
+	if user, err := c.storage.Users().FindByUsername(owner); err == nil {
+		ownerID, email = &user.ID, user.Email
+	}
+	desc := fmt.Sprintf("Secret %q owned by %q expires at %s", secret.Name, owner, expiration.Format(time.RFC3339))
+	c.recordUserEvent(ctx, EventSecretExpiring, ownerID, &secret.ID, desc)
+
+	if c.lifecycle.mailer != nil && email != "" {
+		body := fmt.Sprintf("Your secret %q expires at %s.\n\nAfter that it can no longer be read.", secret.Name, expiration.Format(time.RFC1123))
+		if c.lifecycle.purge {
+			body += fmt.Sprintf(" It will be deleted %s later.", c.lifecycle.grace)
+		}
+		body += " Set a new expiration to keep it.\n"
+		if err := c.lifecycle.mailer.Send(email, fmt.Sprintf("Secret %s expires soon", secret.Name), body); err != nil {
+			log.Printf("⚠️  Failed to email expiry warning for secret %d to %q: %v", secret.ID, owner, err)
+		}
+	}
+	return true, nil
+}
+
+// expireSecret marks secret as expired once its deadline passed
+func (c *SecretlyCore) expireSecret(ctx context.Context, secret *models.SecretNode) error {
+	secret.Status = SecretStatusExpired
+	if err := c.storage.Secrets().Update(secret); err != nil {
+		return fmt.Errorf("failed to expire secret %d: %w", secret.ID, err)
+	}
+	c.InvalidateSecretCache(secret.ID)
+	c.recordEvent(ctx, EventSecretExpired, &secret.ID, fmt.Sprintf("Secret %q expired at %s", secret.Name, secret.Expiration.Format(time.RFC3339)))
+	return nil
+}
+
+// purgeSecret deletes secret once its grace period has passed
+func (c *SecretlyCore) purgeSecret(ctx context.Context, secret *models.SecretNode) error {
+	if err := c.storage.Secrets().Delete(secret.ID); err != nil {
+		return fmt.Errorf("failed to purge secret %d: %w", secret.ID, err)
+	}
+	c.InvalidateSecretCache(secret.ID)
+	c.recordEvent(ctx, EventSecretPurged, &secret.ID, fmt.Sprintf("Secret %q purged %s after it expired", secret.Name, c.lifecycle.grace))
+	return nil
+}
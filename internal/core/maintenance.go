@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+)
+
+// Server modes. In read-only mode the API rejects every change; in
+// maintenance mode it rejects every request except health checks, logins
+// and switching the mode back.
+const (
+	ModeNormal      = "normal"
+	ModeReadOnly    = "read_only"
+	ModeMaintenance = "maintenance"
+)
+
+// EventModeChanged is recorded when an administrator switches the mode
+const EventModeChanged = "mode_changed"
+
+// ServerMode is the current mode and why it was set
+type ServerMode struct {
+	Mode      string
+	Message   string
+	ChangedAt time.Time
+	ChangedBy string
+}
+
+// modeSwitch holds the mode configured with SetMaintenance
+type modeSwitch struct {
+	mu      sync.RWMutex
+	current ServerMode
+}
+
+// SetMaintenance sets the mode the server starts in
+func (c *SecretlyCore) SetMaintenance(cfg config.MaintenanceConfig) error {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeNormal
+	}
+	if !validMode(mode) {
+		return fmt.Errorf("server.maintenance.mode %q: use %s, %s or %s", mode, ModeNormal, ModeReadOnly, ModeMaintenance)
+	}
+	c.mode.mu.Lock()
+	defer c.mode.mu.Unlock()
+	c.mode.current = ServerMode{Mode: mode, Message: cfg.Message, ChangedAt: time.Now().UTC(), ChangedBy: "configuration"}
+	return nil
+}
+
+// Mode returns the current server mode
+func (c *SecretlyCore) Mode() ServerMode {
+	c.mode.mu.RLock()
+	defer c.mode.mu.RUnlock()
+	if c.mode.current.Mode == "" {
+		return ServerMode{Mode: ModeNormal}
+	}
+	return c.mode.current
+}
+
+// ChangeMode switches the server mode at runtime. Only holders of
+// system.manage may do so; the change lasts until the next restart.
+func (c *SecretlyCore) ChangeMode(ctx context.Context, by, mode, message string) (ServerMode, error) {
+	if !validMode(mode) {
+		return ServerMode{}, fmt.Errorf("unknown mode %q: use %s, %s or %s", mode, ModeNormal, ModeReadOnly, ModeMaintenance)
+	}
+	if err := c.requirePermission(ctx, PermissionSystemManage, "changing the server mode"); err != nil {
+		return ServerMode{}, err
+	}
+	c.mode.mu.Lock()
+	previous := c.mode.current.Mode
+	if previous == "" {
+		previous = ModeNormal
+	}
+	c.mode.current = ServerMode{Mode: mode, Message: message, ChangedAt: time.Now().UTC(), ChangedBy: by}
+	current := c.mode.current
+	c.mode.mu.Unlock()
+
+	var userID *uint
+	if user, err := c.storage.Users().FindByUsername(by); err == nil {
+		userID = &user.ID
+	}
+	description := fmt.Sprintf("Server mode changed from %s to %s by %q", previous, mode, by)
+	if message != "" {
+		description += fmt.Sprintf(": %s", message)
+	}
+	c.recordUserEvent(ctx, EventModeChanged, userID, nil, description)
+	return current, nil
+}
+
+func validMode(mode string) bool {
+	return mode == ModeNormal || mode == ModeReadOnly || mode == ModeMaintenance
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameConflictError is returned when a secret with the same normalized name
+// already exists in the namespace, zone and environment. It wraps
+// ErrConflict.
+type NameConflictError struct {
+	Name string
+	// Existing is the secret holding the name; nil when the conflict was
+	// only detected by the database
+	Existing *models.SecretNode
+}
+
+func (e *NameConflictError) Error() string {
+	if e.Existing == nil {
+		return fmt.Sprintf("secret name %q is already taken", e.Name)
+	}
+	return fmt.Sprintf("secret name %q is already taken by %q (id %d)", e.Name, e.Existing.Name, e.Existing.ID)
+}
+
+func (e *NameConflictError) Unwrap() error { return ErrConflict }
+
+// NameCollision is a group of secrets in one namespace, zone and environment
+// whose names normalize to the same key. The oldest secret keeps the name;
+// the others should be renamed.
+type NameCollision struct {
+	Key     string
+	Secrets []models.SecretNode
+	// index is the blind index of Key
+	index string
+}
+
+// NormalizeSecretName trims name and converts it to Unicode NFC, so that
+// names typed on different systems compare equal
+func NormalizeSecretName(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
+
+// SetSecretNames applies the name uniqueness rules. With cfg.CaseInsensitive
+// names differing only in case collide. Run IndexSecretNames afterwards so
+// that existing secrets follow the rules. cfg.AliasDays sets how long the old
+// name of a moved secret keeps resolving.
+func (c *SecretlyCore) SetSecretNames(cfg config.SecretNamesConfig) {
+	c.foldNames = cfg.CaseInsensitive
+	c.aliasTTL = DefaultAliasTTL
+	if cfg.AliasDays > 0 {
+		c.aliasTTL = time.Duration(cfg.AliasDays) * 24 * time.Hour
+	}
+}
+
+// secretNameKey returns the key under which name must be unique
+func (c *SecretlyCore) secretNameKey(name string) string {
+	key := NormalizeSecretName(name)
+	if c.foldNames {
+		key = cases.Fold().String(key)
+	}
+	return key
+}
+
+// claimSecretName sets the name key of a new secret, or returns a
+// NameConflictError if another secret in its scope holds it
+func (c *SecretlyCore) claimSecretName(secret *models.SecretNode) error {
+	key, err := c.secretNameIndex(secret.Name)
+	if err != nil {
+		return err
+	}
+	existing, err := c.storage.Secrets().FindByNameKey(secret.NamespaceID, secret.ZoneID, secret.EnvironmentID, key)
+	if err == nil && existing.ID != secret.ID {
+		return &NameConflictError{Name: secret.Name, Existing: existing}
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to check secret name: %w", err)
+	}
+	secret.NameKey = &key
+	return nil
+}
+
+// nameConflict turns a unique key violation from storing secret into a
+// NameConflictError; a concurrent create took the name after the check
+func nameConflict(secret *models.SecretNode, err error) error {
+	if errors.Is(err, ErrConflict) {
+		return &NameConflictError{Name: secret.Name}
+	}
+	return err
+}
+
+// SecretNameCollisions returns the groups of existing secrets whose names
+// collide under the current rules, oldest secret first
+func (c *SecretlyCore) SecretNameCollisions(ctx context.Context) ([]NameCollision, error) {
+	groups, err := c.groupSecretNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var collisions []NameCollision
+	for _, group := range groups {
+		if len(group.Secrets) > 1 {
+			collisions = append(collisions, group)
+		}
+	}
+	return collisions, nil
+}
+
+// IndexSecretNames brings the name keys of existing secrets in line with
+// the current rules, e.g. after an upgrade or after enabling case folding.
+// In each group of colliding names the oldest secret gets the key and the
+// others are left without one until they are renamed. It returns the
+// collisions.
+func (c *SecretlyCore) IndexSecretNames(ctx context.Context) ([]NameCollision, error) {
+	groups, err := c.groupSecretNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for g := range groups {
+		if groups[g].index, err = c.blindIndex(nameIndexPurpose, groups[g].Key); err != nil {
+			return nil, err
+		}
+	}
+
+	// Clear stale keys first so that no assignment below runs into a key
+	// still held by another secret
+	var assign []*NameCollision
+	var collisions []NameCollision
+	for g := range groups {
+		group := &groups[g]
+		for i := range group.Secrets {
+			secret := &group.Secrets[i]
+			var want *string
+			if i == 0 {
+				want = &group.index
+			}
+			if sameKey(secret.NameKey, want) {
+				continue
+			}
+			if secret.NameKey != nil {
+				secret.NameKey = nil
+				if err := c.storage.Secrets().Update(secret); err != nil {
+					return nil, fmt.Errorf("failed to index secret %d: %w", secret.ID, err)
+				}
+			}
+			if want != nil {
+				assign = append(assign, group)
+			}
+		}
+		if len(group.Secrets) > 1 {
+			collisions = append(collisions, *group)
+		}
+	}
+	for _, group := range assign {
+		secret := &group.Secrets[0]
+		key := group.index
+		secret.NameKey = &key
+		if err := c.storage.Secrets().Update(secret); err != nil {
+			return nil, fmt.Errorf("failed to index secret %d: %w", secret.ID, err)
+		}
+	}
+	if err := c.indexAliases(); err != nil {
+		return nil, err
+	}
+	return collisions, nil
+}
+
+// indexAliases brings the name keys of former names in line with the
+// current rules
+func (c *SecretlyCore) indexAliases() error {
+	aliases, err := c.storage.Aliases().List()
+	if err != nil {
+		return fmt.Errorf("failed to list aliases: %w", err)
+	}
+	for _, alias := range aliases {
+		key, err := c.secretNameIndex(alias.Name)
+		if err != nil {
+			return err
+		}
+		if key == alias.NameKey {
+			continue
+		}
+		if err := c.storage.Aliases().SetNameKey(alias.ID, key); err != nil {
+			return fmt.Errorf("failed to index alias %d: %w", alias.ID, err)
+		}
+	}
+	return nil
+}
+
+// groupSecretNames groups all secrets and folders by scope and name key,
+// since both hold a name. Nodes are listed by ID, so groups and their
+// secrets are ordered oldest first.
+func (c *SecretlyCore) groupSecretNames(ctx context.Context) ([]NameCollision, error) {
+	type scopedKey struct {
+		namespace, zone, environment uint
+		key                          string
+	}
+	index := make(map[scopedKey]int)
+	var groups []NameCollision
+	var afterID uint
+	for {
+		secrets, err := c.storage.Secrets().ListAfter(repository.SecretQuery{AfterID: afterID, Limit: MaxCursorLimit})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		if len(secrets) == 0 {
+			return groups, nil
+		}
+		for _, secret := range secrets {
+			k := scopedKey{secret.NamespaceID, secret.ZoneID, secret.EnvironmentID, c.secretNameKey(secret.Name)}
+			i, ok := index[k]
+			if !ok {
+				i = len(groups)
+				index[k] = i
+				groups = append(groups, NameCollision{Key: k.key})
+			}
+			groups[i].Secrets = append(groups[i].Secrets, secret)
+		}
+		afterID = secrets[len(secrets)-1].ID
+	}
+}
+
+func sameKey(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// ErrNamingPolicy is returned when a secret name breaks a rule of
+// secrets.naming
+var ErrNamingPolicy = errors.New("secret name violates the naming policy")
+
+// namingRule is one compiled rule of secrets.naming
+type namingRule struct {
+	namespaceID uint
+	secretType  string
+	prefix      string
+	pattern     *regexp.Regexp
+	description string
+}
+
+// applies reports whether the rule covers secrets of secretType in
+// namespaceID
+func (r *namingRule) applies(namespaceID uint, secretType string) bool {
+	return (r.namespaceID == 0 || r.namespaceID == namespaceID) &&
+		(r.secretType == "" || r.secretType == secretType)
+}
+
+// violation returns why name breaks the rule, or "" if it does not
+func (r *namingRule) violation(name string) string {
+	var problems []string
+	if r.prefix != "" && !strings.HasPrefix(name, r.prefix) {
+		problems = append(problems, fmt.Sprintf("must start with %q", r.prefix))
+	}
+	if r.pattern != nil && !r.pattern.MatchString(name) {
+		problems = append(problems, fmt.Sprintf("must match %s", r.pattern))
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	msg := strings.Join(problems, " and ")
+	if r.description != "" {
+		msg += " (" + r.description + ")"
+	}
+	return msg
+}
+
+// NamingLint is an existing secret whose name breaks the naming policy.
+// Suggestion is a conforming name derived from the current one, or "" if
+// none was found.
+type NamingLint struct {
+	Secret     models.SecretNode
+	Violations []string
+	Suggestion string
+}
+
+// SetNamingPolicy applies naming conventions to new secrets. A rule covers
+// one namespace or, with namespace_id 0, all of them, and one type or all
+// types. Patterns must match the whole name.
+func (c *SecretlyCore) SetNamingPolicy(cfg config.NamingConfig) error {
+	rules := make([]namingRule, 0, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		if rc.Prefix == "" && rc.Pattern == "" {
+			return fmt.Errorf("secrets.naming.rules[%d]: prefix or pattern is required", i)
+		}
+		rule := namingRule{namespaceID: rc.NamespaceID, secretType: rc.Type, prefix: rc.Prefix, description: rc.Description}
+		if rc.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + rc.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("secrets.naming.rules[%d]: invalid pattern: %w", i, err)
+			}
+			rule.pattern = pattern
+		}
+		rules = append(rules, rule)
+	}
+	c.naming = rules
+	return nil
+}
+
+// CheckSecretName returns every rule that name breaks for a secret of
+// secretType in namespaceID
+func (c *SecretlyCore) CheckSecretName(namespaceID uint, secretType, name string) []string {
+	var violations []string
+	for i := range c.naming {
+		rule := &c.naming[i]
+		if !rule.applies(namespaceID, secretType) {
+			continue
+		}
+		if v := rule.violation(name); v != "" {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// checkNamingPolicy refuses names that break the naming policy
+func (c *SecretlyCore) checkNamingPolicy(secret *models.SecretNode) error {
+	violations := c.CheckSecretName(secret.NamespaceID, secret.Type, secret.Name)
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %q %s", ErrNamingPolicy, secret.Name, strings.Join(violations, "; "))
+}
+
+// LintSecretNames returns the existing secrets whose names break the naming
+// policy, ordered by ID, with a suggested replacement for each
+func (c *SecretlyCore) LintSecretNames(ctx context.Context) ([]NamingLint, error) {
+	var lints []NamingLint
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets {
+			violations := c.CheckSecretName(secret.NamespaceID, secret.Type, secret.Name)
+			if len(violations) == 0 {
+				continue
+			}
+			lints = append(lints, NamingLint{
+				Secret:     secret,
+				Violations: violations,
+				Suggestion: c.suggestSecretName(&secret),
+			})
+		}
+		if next == "" {
+			return lints, nil
+		}
+		cursor = next
+	}
+}
+
+// nonSlug matches the runs of characters replaced when slugging a name
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// suggestSecretName tries common spellings of the secret's name, with the
+// required prefixes added, and returns the first that follows every rule
+func (c *SecretlyCore) suggestSecretName(secret *models.SecretNode) string {
+	lower := strings.ToLower(secret.Name)
+	candidates := []string{
+		secret.Name,
+		lower,
+		strings.Trim(nonSlug.ReplaceAllString(lower, "-"), "-"),
+		strings.Trim(nonSlug.ReplaceAllString(lower, "_"), "_"),
+		strings.ToUpper(strings.Trim(nonSlug.ReplaceAllString(lower, "_"), "_")),
+	}
+	for _, candidate := range candidates {
+		for i := range c.naming {
+			rule := &c.naming[i]
+			if rule.applies(secret.NamespaceID, secret.Type) && rule.prefix != "" && !strings.HasPrefix(candidate, rule.prefix) {
+				candidate = rule.prefix + candidate
+			}
+		}
+		if candidate != "" && len(c.CheckSecretName(secret.NamespaceID, secret.Type, candidate)) == 0 {
+			return candidate
+		}
+	}
+	return ""
+}
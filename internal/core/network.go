@@ -0,0 +1,197 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// EventNetworkDenied is recorded when a network policy rejects a request
+const EventNetworkDenied = "network_denied"
+
+// networkPolicy holds the CIDR lists configured with SetNetworkPolicy
+type networkPolicy struct {
+	clients    map[string]*cidrRule
+	namespaces map[uint]*cidrRule
+}
+
+// cidrRule denies addresses in deny and, when allow is not empty, every
+// address outside allow
+type cidrRule struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// permits reports whether addr passes the rule; deny entries win over allow
+// entries
+func (r *cidrRule) permits(addr netip.Addr) bool {
+	for _, p := range r.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, p := range r.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNetworkPolicy restricts the addresses API clients may connect from,
+// per user and per namespace. Entries are CIDR prefixes or single
+// addresses.
+func (c *SecretlyCore) SetNetworkPolicy(cfg config.NetworkPolicyConfig) error {
+	if len(cfg.Clients) == 0 && len(cfg.Namespaces) == 0 {
+		c.network = nil
+		return nil
+	}
+	p := &networkPolicy{
+		clients:    make(map[string]*cidrRule, len(cfg.Clients)),
+		namespaces: make(map[uint]*cidrRule, len(cfg.Namespaces)),
+	}
+	for _, client := range cfg.Clients {
+		if client.Username == "" {
+			return fmt.Errorf("security.network_policy.clients: username is required")
+		}
+		if _, ok := p.clients[client.Username]; ok {
+			return fmt.Errorf("security.network_policy.clients: duplicate rule for %q", client.Username)
+		}
+		rule, err := parseCIDRRule(client.Allow, client.Deny)
+		if err != nil {
+			return fmt.Errorf("security.network_policy.clients %q: %w", client.Username, err)
+		}
+		p.clients[client.Username] = rule
+	}
+	for _, ns := range cfg.Namespaces {
+		if ns.NamespaceID == 0 {
+			return fmt.Errorf("security.network_policy.namespaces: namespace_id is required")
+		}
+		if _, ok := p.namespaces[ns.NamespaceID]; ok {
+			return fmt.Errorf("security.network_policy.namespaces: duplicate rule for namespace %d", ns.NamespaceID)
+		}
+		rule, err := parseCIDRRule(ns.Allow, ns.Deny)
+		if err != nil {
+			return fmt.Errorf("security.network_policy.namespaces %d: %w", ns.NamespaceID, err)
+		}
+		p.namespaces[ns.NamespaceID] = rule
+	}
+	c.network = p
+	return nil
+}
+
+func parseCIDRRule(allow, deny []string) (*cidrRule, error) {
+	rule := &cidrRule{}
+	var err error
+	if rule.allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if rule.deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// clientAddr returns the address of the client in ctx. Requests without
+// one, such as local CLI use, are not subject to network policies.
+func clientAddr(ctx context.Context) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(ClientInfoFrom(ctx).IPAddress)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// CheckClientNetwork rejects requests from addresses the authenticated
+// client in ctx may not connect from
+func (c *SecretlyCore) CheckClientNetwork(ctx context.Context) error {
+	client := ClientInfoFrom(ctx)
+	var userID *uint
+	if user, err := c.storage.Users().FindByUsername(client.Username); err == nil {
+		userID = &user.ID
+	}
+	return c.checkClientNetwork(ctx, client.Username, userID)
+}
+
+func (c *SecretlyCore) checkClientNetwork(ctx context.Context, username string, userID *uint) error {
+	if c.network == nil {
+		return nil
+	}
+	rule, ok := c.network.clients[username]
+	if !ok {
+		return nil
+	}
+	addr, ok := clientAddr(ctx)
+	if !ok || rule.permits(addr) {
+		return nil
+	}
+	return c.denyNetwork(ctx, userID, nil, fmt.Sprintf("Request by user %q from %s denied by its network policy", username, addr))
+}
+
+// CheckNamespaceNetwork rejects access to secret from addresses its
+// namespace does not admit
+func (c *SecretlyCore) CheckNamespaceNetwork(ctx context.Context, secret *models.SecretNode) error {
+	if c.NamespaceReachable(ctx, secret.NamespaceID) {
+		return nil
+	}
+	client := ClientInfoFrom(ctx)
+	var userID *uint
+	if user, err := c.storage.Users().FindByUsername(client.Username); err == nil {
+		userID = &user.ID
+	}
+	var secretID *uint
+	target := fmt.Sprintf("namespace %d", secret.NamespaceID)
+	if secret.ID != 0 {
+		secretID = &secret.ID
+		target = fmt.Sprintf("secret %q in %s", secret.Name, target)
+	}
+	return c.denyNetwork(ctx, userID, secretID, fmt.Sprintf("Access to %s by user %q from %s denied by the namespace network policy",
+		target, client.Username, client.IPAddress))
+}
+
+// NamespaceReachable reports whether the client in ctx may access secrets
+// in the namespace, without recording a denial. List endpoints use it to
+// leave out secrets the client could not open.
+func (c *SecretlyCore) NamespaceReachable(ctx context.Context, namespaceID uint) bool {
+	if c.network == nil {
+		return true
+	}
+	rule, ok := c.network.namespaces[namespaceID]
+	if !ok {
+		return true
+	}
+	addr, ok := clientAddr(ctx)
+	return !ok || rule.permits(addr)
+}
+
+func (c *SecretlyCore) denyNetwork(ctx context.Context, userID, secretID *uint, description string) error {
+	log.Printf("⚠️  %s", description)
+	c.recordUserEvent(ctx, EventNetworkDenied, userID, secretID, description)
+	return fmt.Errorf("%w: request not permitted from this network", ErrPermissionDenied)
+}
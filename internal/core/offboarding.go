@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Audit event types for the offboarding workflow
+const (
+	EventUserDeactivated = "user_deactivated"
+	EventUserReactivated = "user_reactivated"
+)
+
+// DefaultOffboardingWindow is how far back an offboarding report looks for
+// secrets the user accessed
+const DefaultOffboardingWindow = 90 * 24 * time.Hour
+
+// OffboardingReport lists what a departing user leaves behind: the secrets
+// they own, which need a new owner, and the secrets they recently used,
+// which should be rotated
+type OffboardingReport struct {
+	Username        string           `json:"username"`
+	DeactivatedAt   *time.Time       `json:"deactivated_at,omitempty"`
+	SessionsRevoked int              `json:"sessions_revoked"`
+	Since           time.Time        `json:"since"`
+	Owned           []ReportedSecret `json:"owned"`
+	Accessed        []ReportedSecret `json:"accessed"`
+}
+
+// ReportedSecret is one secret in an offboarding report. For accessed
+// secrets, LastAccess and Actions come from the audit log.
+type ReportedSecret struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	LastAccess time.Time `json:"last_access,omitempty"`
+	Actions    []string  `json:"actions,omitempty"`
+}
+
+// DeactivateUser blocks a user without deleting them: logins and existing
+// sessions stop working, and the secrets they own show up as orphaned. by
+// is recorded as the administrator who made the change. The returned
+// report covers the window before deactivation.
+func (c *SecretlyCore) DeactivateUser(ctx context.Context, username, by string, window time.Duration) (*OffboardingReport, error) {
+	if err := c.requirePermission(ctx, PermissionUsersManage, "deactivating users"); err != nil {
+		return nil, err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %q: %w", username, err)
+	}
+	revoked := 0
+	if user.DeactivatedAt == nil {
+		now := time.Now().UTC()
+		if err := c.storage.Users().SetDeactivated(user.ID, &now); err != nil {
+			return nil, fmt.Errorf("failed to deactivate user %q: %w", username, err)
+		}
+		user.DeactivatedAt = &now
+
+		// keepID 0 matches no session, so every session is revoked
+		n, err := c.storage.Sessions().DeleteOthers(user.ID, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions of %q: %w", username, err)
+		}
+		revoked = int(n)
+		c.recordUserEvent(ctx, EventUserDeactivated, &user.ID, nil, fmt.Sprintf("User %q deactivated by %q; %d session(s) revoked",
+			username, by, revoked))
+	}
+
+	report, err := c.offboardingReport(ctx, user, window)
+	if err != nil {
+		return nil, err
+	}
+	report.SessionsRevoked = revoked
+	return report, nil
+}
+
+// ReactivateUser lets a deactivated user log in again. Revoked sessions
+// stay revoked.
+func (c *SecretlyCore) ReactivateUser(ctx context.Context, username, by string) error {
+	if err := c.requirePermission(ctx, PermissionUsersManage, "reactivating users"); err != nil {
+		return err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to get user %q: %w", username, err)
+	}
+	if user.DeactivatedAt == nil {
+		return nil
+	}
+	if err := c.storage.Users().SetDeactivated(user.ID, nil); err != nil {
+		return fmt.Errorf("failed to reactivate user %q: %w", username, err)
+	}
+	c.recordUserEvent(ctx, EventUserReactivated, &user.ID, nil, fmt.Sprintf("User %q reactivated by %q", username, by))
+	return nil
+}
+
+// OffboardingReport lists the secrets a user owns and those they read or
+// changed within window, without changing anything
+func (c *SecretlyCore) OffboardingReport(ctx context.Context, username string, window time.Duration) (*OffboardingReport, error) {
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %q: %w", username, err)
+	}
+	return c.offboardingReport(ctx, user, window)
+}
+
+func (c *SecretlyCore) offboardingReport(ctx context.Context, user *models.User, window time.Duration) (*OffboardingReport, error) {
+	if window <= 0 {
+		window = DefaultOffboardingWindow
+	}
+	end := time.Now().UTC()
+	if user.DeactivatedAt != nil {
+		end = *user.DeactivatedAt
+	}
+	report := &OffboardingReport{
+		Username:      user.Username,
+		DeactivatedAt: user.DeactivatedAt,
+		Since:         end.Add(-window),
+		Owned:         []ReportedSecret{},
+		Accessed:      []ReportedSecret{},
+	}
+
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets {
+			if SecretOwner(&secret) == user.Username {
+				report.Owned = append(report.Owned, ReportedSecret{ID: secret.ID, Name: secret.Name})
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	events, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+		From:   report.Since,
+		Types:  []string{EventSecretRead, EventSecretPreviewed, EventSecretCreated, EventSecretUpdated, EventSecretDeleted},
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	accessed := make(map[uint]*ReportedSecret)
+	for _, e := range events {
+		if e.SecretNodeID == nil || e.EventTime.After(end) {
+			continue
+		}
+		entry, ok := accessed[*e.SecretNodeID]
+		if !ok {
+			entry = &ReportedSecret{ID: *e.SecretNodeID, Name: fmt.Sprintf("#%d (deleted)", *e.SecretNodeID)}
+			if secret, err := c.storage.Secrets().GetByID(entry.ID); err == nil {
+				entry.Name = secret.Name
+			}
+			accessed[entry.ID] = entry
+		}
+		if e.EventTime.After(entry.LastAccess) {
+			entry.LastAccess = e.EventTime
+		}
+		if !slices.Contains(entry.Actions, e.EventType) {
+			entry.Actions = append(entry.Actions, e.EventType)
+		}
+	}
+	for _, entry := range accessed {
+		report.Accessed = append(report.Accessed, *entry)
+	}
+	sort.Slice(report.Accessed, func(i, j int) bool { return report.Accessed[i].ID < report.Accessed[j].ID })
+	return report, nil
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Audit event types for secret ownership
+const (
+	EventOwnerTransferred = "owner_transferred"
+	EventSecretOrphaned   = "secret_orphaned"
+)
+
+// SecretOwner returns the user responsible for secret, or "" for secrets
+// created by tools. CreatedBy is not consulted: it may name a tool, or a
+// user created later under the same name.
+func SecretOwner(secret *models.SecretNode) string {
+	return secret.Owner
+}
+
+// TransferOwnership makes the user named to the owner of a secret. by is
+// recorded in the audit log as the user who made the change. Protected
+// secrets return ErrApprovalRequired; see RequestTransfer.
+func (c *SecretlyCore) TransferOwnership(ctx context.Context, id uint, to, by string) (*models.SecretNode, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Owner != to && c.RequiresApproval(secret) {
+		return nil, fmt.Errorf("secret %q is protected: %w", secret.Name, ErrApprovalRequired)
+	}
+	return c.transferOwnership(ctx, id, to, by)
+}
+
+func (c *SecretlyCore) transferOwnership(ctx context.Context, id uint, to, by string) (*models.SecretNode, error) {
+	secret, err := c.loadSecret(id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.storage.Users().FindByUsername(to)
+	if err != nil {
+		return nil, fmt.Errorf("new owner %q: %w", to, err)
+	}
+	previous := SecretOwner(secret)
+	if secret.Owner == user.Username {
+		return secret, nil
+	}
+
+	secret.Owner = user.Username
+	err = c.changeSecret(ctx, id, func(s storage.Storage) error {
+		if err := s.Secrets().Update(secret); err != nil {
+			return fmt.Errorf("failed to transfer secret %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var byID *uint
+	if actor, err := c.storage.Users().FindByUsername(by); err == nil {
+		byID = &actor.ID
+	}
+	if previous == "" {
+		previous = "nobody"
+	}
+	c.recordUserEvent(ctx, EventOwnerTransferred, byID, &secret.ID, fmt.Sprintf("Secret %q transferred from %q to %q by %q",
+		secret.Name, previous, user.Username, by))
+	return secret, nil
+}
+
+// OrphanedSecrets returns the secrets whose owner no longer exists or is
+// deactivated, ordered by ID
+func (c *SecretlyCore) OrphanedSecrets(ctx context.Context) ([]models.SecretNode, error) {
+	owners := make(map[string]bool)
+	var orphans []models.SecretNode
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets {
+			if secret.Owner == "" {
+				continue
+			}
+			active, ok := owners[secret.Owner]
+			if !ok {
+				active, err = c.ownerActive(secret.Owner)
+				if err != nil {
+					return nil, err
+				}
+				owners[secret.Owner] = active
+			}
+			if !active {
+				orphans = append(orphans, secret)
+			}
+		}
+		if next == "" {
+			return orphans, nil
+		}
+		cursor = next
+	}
+}
+
+// ownerActive reports whether username can still look after its secrets
+func (c *SecretlyCore) ownerActive(username string) (bool, error) {
+	user, err := c.storage.Users().FindByUsername(username)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up owner %q: %w", username, err)
+	}
+	return user.DeactivatedAt == nil, nil
+}
+
+// QueueOrphanedSecrets finds orphaned secrets and records a secret_orphaned
+// audit event for each one not queued since its last transfer, so that the
+// audit log and event stream show what needs a new owner. It returns every
+// orphan, queued now or before.
+func (c *SecretlyCore) QueueOrphanedSecrets(ctx context.Context) ([]models.SecretNode, error) {
+	orphans, err := c.OrphanedSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orphans {
+		secret := &orphans[i]
+		last, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+			Types:      []string{EventSecretOrphaned, EventOwnerTransferred},
+			SecretID:   secret.ID,
+			Descending: true,
+			Limit:      1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check secret %d: %w", secret.ID, err)
+		}
+		if len(last) == 1 && last[0].EventType == EventSecretOrphaned {
+			continue
+		}
+		c.recordEvent(ctx, EventSecretOrphaned, &secret.ID, fmt.Sprintf("Secret %q is owned by %q, who no longer exists or is deactivated; it needs a new owner",
+			secret.Name, secret.Owner))
+	}
+	return orphans, nil
+}
@@ -0,0 +1,581 @@
+package core
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/webauthn"
+)
+
+// Audit event types for passkeys
+const (
+	EventPasskeyRegistered = "passkey_registered"
+	EventPasskeyRemoved    = "passkey_removed"
+)
+
+const (
+	// PasskeyEnrollmentScope marks the sessions of users who must register
+	// a passkey before they can do anything else
+	PasskeyEnrollmentScope = "passkey-enrollment"
+
+	// passkeyCeremonyTTL bounds both a browser ceremony and a CLI handoff
+	passkeyCeremonyTTL = 5 * time.Minute
+	// maxPasskeyCeremonies bounds the pending ceremonies and handoffs, which
+	// unauthenticated clients can start
+	maxPasskeyCeremonies = 1000
+	defaultRPName        = "Secretly"
+	userCodeAlphabet     = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	handoffLogin    = "login"
+	handoffRegister = "register"
+)
+
+var (
+	// ErrPasskeysDisabled is returned when WebAuthn is not configured
+	ErrPasskeysDisabled = errors.New("passkeys are not enabled")
+	// ErrPasskeyRequired is returned by password logins of users who must
+	// log in with their passkey
+	ErrPasskeyRequired = errors.New("this account must log in with a passkey")
+	// ErrHandoffPending is returned while the browser has not finished a
+	// passkey handoff
+	ErrHandoffPending = errors.New("the passkey handoff has not been completed yet")
+)
+
+// passkeys holds the settings applied with SetWebAuthn and the ceremonies in
+// progress. Ceremonies live in memory, so a browser must finish on the
+// server instance it started on.
+type passkeys struct {
+	rp       *webauthn.RelyingParty
+	required string
+
+	mu         sync.Mutex
+	ceremonies map[string]*passkeyCeremony
+	handoffs   map[string]*passkeyHandoff
+}
+
+// passkeyCeremony is a challenge waiting for the browser's response
+type passkeyCeremony struct {
+	register  bool
+	challenge []byte
+	// userID is the registering user; username restricts a login to one
+	// account
+	userID    uint
+	username  string
+	handoff   string
+	expiresAt time.Time
+}
+
+// passkeyHandoff is a CLI request that a browser completes
+type passkeyHandoff struct {
+	purpose       string
+	userID        uint
+	username      string
+	name          string
+	pollHash      string
+	userCode      string
+	requestedFrom string
+	expiresAt     time.Time
+
+	done    bool
+	token   string
+	session *models.Session
+}
+
+// PasskeyCeremony is a challenge for the browser. PublicKey is passed to
+// navigator.credentials.create for registrations and to
+// navigator.credentials.get for logins.
+type PasskeyCeremony struct {
+	CeremonyID string      `json:"ceremony_id"`
+	PublicKey  interface{} `json:"publicKey"`
+}
+
+// PasskeyHandoff lets the CLI log in or register a passkey through a
+// browser. The user opens URL and compares UserCode; the CLI polls with
+// PollToken until the browser is done.
+type PasskeyHandoff struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	PollToken string    `json:"poll_token"`
+	UserCode  string    `json:"user_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandoffCeremony is the ceremony for the browser side of a handoff, with
+// what the page shows the user before they confirm
+type HandoffCeremony struct {
+	PasskeyCeremony
+	Purpose       string `json:"purpose"`
+	Username      string `json:"username,omitempty"`
+	UserCode      string `json:"user_code"`
+	RequestedFrom string `json:"requested_from"`
+}
+
+// SetWebAuthn enables passkey registration and login, and makes passkeys
+// mandatory for nobody, the admins (as for two-factor authentication) or
+// everyone
+func (c *SecretlyCore) SetWebAuthn(cfg config.WebAuthnConfig) error {
+	if !cfg.Enabled {
+		c.passkeys = nil
+		return nil
+	}
+	if cfg.RPID == "" || len(cfg.Origins) == 0 {
+		return fmt.Errorf("auth.webauthn needs an rp_id and at least one origin")
+	}
+	switch cfg.Required {
+	case "", TwoFactorRequiredNone, TwoFactorRequiredAdmins, TwoFactorRequiredAll:
+	default:
+		return fmt.Errorf("auth.webauthn.required must be %s, %s or %s", TwoFactorRequiredNone, TwoFactorRequiredAdmins, TwoFactorRequiredAll)
+	}
+	name := cfg.RPName
+	if name == "" {
+		name = defaultRPName
+	}
+	c.passkeys = &passkeys{
+		rp:         &webauthn.RelyingParty{ID: cfg.RPID, Name: name, Origins: cfg.Origins},
+		required:   cfg.Required,
+		ceremonies: make(map[string]*passkeyCeremony),
+		handoffs:   make(map[string]*passkeyHandoff),
+	}
+	return nil
+}
+
+// PasskeyRequired reports whether the policy makes user log in with a
+// passkey
+func (c *SecretlyCore) PasskeyRequired(user *models.User) bool {
+	return c.passkeys != nil && c.requiredFor(c.passkeys.required, user)
+}
+
+// BeginPasskeyRegistration starts registering a passkey for the user
+func (c *SecretlyCore) BeginPasskeyRegistration(ctx context.Context, userID uint) (*PasskeyCeremony, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	return c.beginPasskeyRegistration(user, "")
+}
+
+// FinishPasskeyRegistration stores the passkey the browser created for a
+// ceremony from BeginPasskeyRegistration
+func (c *SecretlyCore) FinishPasskeyRegistration(ctx context.Context, userID uint, ceremonyID, name string, resp *webauthn.AttestationResponse) (*models.WebAuthnCredential, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	cer, err := c.passkeys.take(ceremonyID, true)
+	if err != nil {
+		return nil, err
+	}
+	if cer.userID != userID || cer.handoff != "" {
+		return nil, fmt.Errorf("%w: ceremony belongs to another request", ErrInvalidCredentials)
+	}
+	return c.finishPasskeyRegistration(ctx, userID, name, cer, resp)
+}
+
+// ListPasskeys returns the user's passkeys
+func (c *SecretlyCore) ListPasskeys(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	creds, err := c.storage.WebAuthnCredentials().ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	return creds, nil
+}
+
+// RemovePasskey deletes one of the user's passkeys. Users who must log in
+// with a passkey cannot remove their last one.
+func (c *SecretlyCore) RemovePasskey(ctx context.Context, userID, id uint) error {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	creds, err := c.ListPasskeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(creds, func(cred models.WebAuthnCredential) bool { return cred.ID == id })
+	if idx < 0 {
+		return fmt.Errorf("passkey %d: %w", id, ErrNotFound)
+	}
+	if len(creds) == 1 && c.PasskeyRequired(user) {
+		return fmt.Errorf("%w: a passkey is required for %q", ErrPermissionDenied, user.Username)
+	}
+	if err := c.storage.WebAuthnCredentials().Delete(id); err != nil {
+		return fmt.Errorf("failed to remove passkey %d: %w", id, err)
+	}
+	c.recordUserEvent(ctx, EventPasskeyRemoved, &user.ID, nil, fmt.Sprintf("User %q removed passkey %q", user.Username, creds[idx].Name))
+	return nil
+}
+
+// BeginPasskeyLogin starts a passkey login. With a username only that
+// user's passkeys are offered; without one the browser offers any passkey
+// it holds for the server.
+func (c *SecretlyCore) BeginPasskeyLogin(ctx context.Context, username string) (*PasskeyCeremony, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	return c.beginPasskeyLogin(username, "")
+}
+
+// FinishPasskeyLogin checks the browser's assertion for a ceremony from
+// BeginPasskeyLogin and opens a session. A passkey verifies the user, so
+// the session needs no TOTP code and starts elevated.
+func (c *SecretlyCore) FinishPasskeyLogin(ctx context.Context, ceremonyID string, resp *webauthn.AssertionResponse) (string, *models.Session, error) {
+	if c.passkeys == nil {
+		return "", nil, ErrPasskeysDisabled
+	}
+	cer, err := c.passkeys.take(ceremonyID, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if cer.handoff != "" {
+		return "", nil, fmt.Errorf("%w: ceremony belongs to another request", ErrInvalidCredentials)
+	}
+	return c.finishPasskeyLogin(ctx, cer, resp)
+}
+
+// StartLoginHandoff starts a CLI login that the user completes with a
+// passkey in the browser
+func (c *SecretlyCore) StartLoginHandoff(ctx context.Context, username string) (*PasskeyHandoff, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	return c.startHandoff(ctx, &passkeyHandoff{purpose: handoffLogin, username: username})
+}
+
+// StartRegistrationHandoff starts registering a passkey for a CLI user in
+// the browser
+func (c *SecretlyCore) StartRegistrationHandoff(ctx context.Context, userID uint, name string) (*PasskeyHandoff, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	return c.startHandoff(ctx, &passkeyHandoff{purpose: handoffRegister, userID: user.ID, username: user.Username, name: name})
+}
+
+// BeginHandoff starts the browser ceremony of a handoff
+func (c *SecretlyCore) BeginHandoff(ctx context.Context, id string) (*HandoffCeremony, error) {
+	if c.passkeys == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	h, err := c.passkeys.handoff(id)
+	if err != nil {
+		return nil, err
+	}
+	var cer *PasskeyCeremony
+	if h.purpose == handoffRegister {
+		user, err := c.storage.Users().FindByID(h.userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user %d: %w", h.userID, err)
+		}
+		cer, err = c.beginPasskeyRegistration(user, id)
+		if err != nil {
+			return nil, err
+		}
+	} else if cer, err = c.beginPasskeyLogin(h.username, id); err != nil {
+		return nil, err
+	}
+	return &HandoffCeremony{PasskeyCeremony: *cer, Purpose: h.purpose, Username: h.username, UserCode: h.userCode, RequestedFrom: h.requestedFrom}, nil
+}
+
+// FinishHandoff checks the browser's response for a handoff ceremony. The
+// credential is an attestation for registrations and an assertion for
+// logins; the session of a login is kept for PollPasskeyHandoff.
+func (c *SecretlyCore) FinishHandoff(ctx context.Context, id, ceremonyID string, credential json.RawMessage) error {
+	if c.passkeys == nil {
+		return ErrPasskeysDisabled
+	}
+	h, err := c.passkeys.handoff(id)
+	if err != nil {
+		return err
+	}
+	cer, err := c.passkeys.take(ceremonyID, h.purpose == handoffRegister)
+	if err != nil {
+		return err
+	}
+	if cer.handoff != id {
+		return fmt.Errorf("%w: ceremony belongs to another request", ErrInvalidCredentials)
+	}
+
+	var token string
+	var session *models.Session
+	if h.purpose == handoffRegister {
+		var resp webauthn.AttestationResponse
+		if err := json.Unmarshal(credential, &resp); err != nil {
+			return fmt.Errorf("%w: invalid credential: %v", ErrInvalidCredentials, err)
+		}
+		if _, err := c.finishPasskeyRegistration(ctx, h.userID, h.name, cer, &resp); err != nil {
+			return err
+		}
+	} else {
+		var resp webauthn.AssertionResponse
+		if err := json.Unmarshal(credential, &resp); err != nil {
+			return fmt.Errorf("%w: invalid credential: %v", ErrInvalidCredentials, err)
+		}
+		if token, session, err = c.finishPasskeyLogin(ctx, cer, &resp); err != nil {
+			return err
+		}
+	}
+
+	c.passkeys.mu.Lock()
+	defer c.passkeys.mu.Unlock()
+	if h.done {
+		return fmt.Errorf("passkey handoff already completed: %w", ErrConflict)
+	}
+	h.done, h.token, h.session = true, token, session
+	return nil
+}
+
+// PollPasskeyHandoff returns the result of a handoff to the CLI that
+// started it: ErrHandoffPending until the browser is done, then the session
+// of a login, or no session for a registration
+func (c *SecretlyCore) PollPasskeyHandoff(ctx context.Context, id, pollToken string) (string, *models.Session, error) {
+	if c.passkeys == nil {
+		return "", nil, ErrPasskeysDisabled
+	}
+	p := c.passkeys
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.handoffs[id]
+	if !ok || h.expiresAt.Before(time.Now()) {
+		return "", nil, fmt.Errorf("passkey handoff unknown or expired: %w", ErrNotFound)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(pollToken)), []byte(h.pollHash)) != 1 {
+		return "", nil, fmt.Errorf("%w: wrong poll token", ErrInvalidCredentials)
+	}
+	if !h.done {
+		return "", nil, ErrHandoffPending
+	}
+	delete(p.handoffs, id)
+	return h.token, h.session, nil
+}
+
+// beginPasskeyRegistration creates a registration ceremony for user
+func (c *SecretlyCore) beginPasskeyRegistration(user *models.User, handoff string) (*PasskeyCeremony, error) {
+	creds, err := c.ListPasskeys(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([][]byte, 0, len(creds))
+	for _, cred := range creds {
+		exclude = append(exclude, cred.CredentialID)
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	id, err := c.passkeys.begin(&passkeyCeremony{register: true, challenge: challenge, userID: user.ID, handoff: handoff})
+	if err != nil {
+		return nil, err
+	}
+	handle := binary.BigEndian.AppendUint64(nil, uint64(user.ID))
+	options := c.passkeys.rp.NewCreationOptions(challenge, handle, user.Username, exclude, passkeyCeremonyTTL)
+	return &PasskeyCeremony{CeremonyID: id, PublicKey: options}, nil
+}
+
+// finishPasskeyRegistration verifies and stores a new passkey
+func (c *SecretlyCore) finishPasskeyRegistration(ctx context.Context, userID uint, name string, cer *passkeyCeremony, resp *webauthn.AttestationResponse) (*models.WebAuthnCredential, error) {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	verified, err := c.passkeys.rp.VerifyRegistration(resp, cer.challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = "passkey"
+	}
+	cred := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+	}
+	if err := c.storage.WebAuthnCredentials().Create(cred); err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+	c.recordUserEvent(ctx, EventPasskeyRegistered, &user.ID, nil, fmt.Sprintf("User %q registered passkey %q", user.Username, name))
+	return cred, nil
+}
+
+// beginPasskeyLogin creates a login ceremony, limited to username's
+// passkeys if given
+func (c *SecretlyCore) beginPasskeyLogin(username, handoff string) (*PasskeyCeremony, error) {
+	var allow [][]byte
+	if username != "" {
+		user, err := c.storage.Users().FindByUsername(username)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to look up user: %w", err)
+		}
+		if err == nil {
+			creds, err := c.ListPasskeys(context.Background(), user.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, cred := range creds {
+				allow = append(allow, cred.CredentialID)
+			}
+		}
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	id, err := c.passkeys.begin(&passkeyCeremony{challenge: challenge, username: username, handoff: handoff})
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{CeremonyID: id, PublicKey: c.passkeys.rp.NewRequestOptions(challenge, allow, passkeyCeremonyTTL)}, nil
+}
+
+// finishPasskeyLogin verifies an assertion and opens an elevated session
+func (c *SecretlyCore) finishPasskeyLogin(ctx context.Context, cer *passkeyCeremony, resp *webauthn.AssertionResponse) (string, *models.Session, error) {
+	cred, err := c.storage.WebAuthnCredentials().GetByCredentialID(resp.RawID)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil, fmt.Errorf("%w: unknown passkey", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look up passkey: %w", err)
+	}
+	user, err := c.storage.Users().FindByID(cred.UserID)
+	if err != nil || user.DeactivatedAt != nil || (cer.username != "" && user.Username != cer.username) {
+		return "", nil, ErrInvalidCredentials
+	}
+	count, err := c.passkeys.rp.VerifyAssertion(resp, cer.challenge, webauthn.Credential{
+		ID:        cred.CredentialID,
+		PublicKey: cred.PublicKey,
+		SignCount: cred.SignCount,
+	})
+	if err != nil {
+		c.recordUserEvent(ctx, EventLoginFailed, &user.ID, nil, fmt.Sprintf("Failed passkey login for user %q from %s: %v",
+			user.Username, describeClient(ClientInfoFrom(ctx).IPAddress, ""), err))
+		return "", nil, ErrInvalidCredentials
+	}
+	if err := c.checkClientNetwork(ctx, user.Username, &user.ID); err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	if err := c.storage.WebAuthnCredentials().RecordUse(cred.ID, count, now); err != nil {
+		return "", nil, fmt.Errorf("failed to record passkey use: %w", err)
+	}
+
+	elevatedUntil := now.Add(c.twoFactorSettings().elevation)
+	token, session, err := c.openSession(ctx, &models.Session{UserID: user.ID, ElevatedUntil: &elevatedUntil}, DefaultSessionTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	c.recordUserEvent(ctx, EventUserLogin, &user.ID, nil, fmt.Sprintf("User %q logged in with passkey %q", user.Username, cred.Name))
+	return token, session, nil
+}
+
+// startHandoff stores h and returns what the CLI needs to follow it
+func (c *SecretlyCore) startHandoff(ctx context.Context, h *passkeyHandoff) (*PasskeyHandoff, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate handoff ID: %w", err)
+	}
+	poll, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate poll token: %w", err)
+	}
+	code, err := randomString(userCodeAlphabet, 8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate user code: %w", err)
+	}
+	client := ClientInfoFrom(ctx)
+	h.pollHash = hashToken(poll)
+	h.userCode = code[:4] + "-" + code[4:]
+	h.requestedFrom = describeClient(client.IPAddress, client.UserAgent)
+	h.expiresAt = time.Now().Add(passkeyCeremonyTTL)
+
+	p := c.passkeys
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune()
+	if len(p.handoffs) >= maxPasskeyCeremonies {
+		return nil, fmt.Errorf("too many passkey handoffs in progress")
+	}
+	p.handoffs[id] = h
+	return &PasskeyHandoff{
+		ID:        id,
+		URL:       strings.TrimSuffix(p.rp.Origins[0], "/") + "/passkey?handoff=" + id,
+		PollToken: poll,
+		UserCode:  h.userCode,
+		ExpiresAt: h.expiresAt,
+	}, nil
+}
+
+// begin stores a ceremony and returns its ID
+func (p *passkeys) begin(cer *passkeyCeremony) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ceremony ID: %w", err)
+	}
+	cer.expiresAt = time.Now().Add(passkeyCeremonyTTL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune()
+	if len(p.ceremonies) >= maxPasskeyCeremonies {
+		return "", fmt.Errorf("too many passkey ceremonies in progress")
+	}
+	p.ceremonies[id] = cer
+	return id, nil
+}
+
+// take removes and returns a ceremony, so that each challenge is answered
+// at most once
+func (p *passkeys) take(id string, register bool) (*passkeyCeremony, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cer, ok := p.ceremonies[id]
+	delete(p.ceremonies, id)
+	if !ok || cer.expiresAt.Before(time.Now()) || cer.register != register {
+		return nil, fmt.Errorf("%w: passkey ceremony unknown or expired", ErrInvalidCredentials)
+	}
+	return cer, nil
+}
+
+// handoff returns a handoff the browser can still complete
+func (p *passkeys) handoff(id string) (*passkeyHandoff, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.handoffs[id]
+	if !ok || h.done || h.expiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("passkey handoff unknown or expired: %w", ErrNotFound)
+	}
+	return h, nil
+}
+
+// prune drops expired ceremonies and handoffs; callers must hold mu
+func (p *passkeys) prune() {
+	now := time.Now()
+	for id, cer := range p.ceremonies {
+		if cer.expiresAt.Before(now) {
+			delete(p.ceremonies, id)
+		}
+	}
+	for id, h := range p.handoffs {
+		if h.expiresAt.Before(now) {
+			delete(p.handoffs, id)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	pbkdf2Prefix     = "pbkdf2-sha256"
+	pbkdf2Iterations = 600000
+	pbkdf2SaltSize   = 16
+	pbkdf2KeySize    = 32
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// SetFIPSMode makes new password hashes use PBKDF2-HMAC-SHA256 instead of
+// bcrypt, which is not a FIPS-approved algorithm
+func (c *SecretlyCore) SetFIPSMode(enabled bool) {
+	c.fipsMode = enabled
+}
+
+// hashPassword hashes a password with bcrypt, or PBKDF2 in FIPS mode
+func (c *SecretlyCore) hashPassword(password string) (string, error) {
+	if !c.fipsMode {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, pbkdf2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, pbkdf2KeySize)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", pbkdf2Prefix, pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword verifies a password against a bcrypt or PBKDF2 hash. Hashes
+// created before FIPS mode was enabled keep working.
+func checkPassword(hash, password string) bool {
+	if !strings.HasPrefix(hash, pbkdf2Prefix+"$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// dummyPasswordHash is compared against when the user does not exist, so
+// that response times do not reveal which usernames exist
+func (c *SecretlyCore) dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = c.hashPassword("secretly-dummy-password")
+	})
+	return dummyHash
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for self-service password reset
+const (
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordReset          = "password_reset"
+)
+
+const (
+	defaultResetTTL          = 30 * time.Minute
+	defaultResetMaxPerHour   = 3
+	resetTokenPlaceholder    = "{token}"
+	passwordResetMailSubject = "Reset your Secretly password"
+)
+
+var (
+	// ErrPasswordResetDisabled is returned when password reset is not
+	// configured
+	ErrPasswordResetDisabled = errors.New("password reset is not enabled")
+)
+
+// Mailer delivers email to users
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// passwordReset holds the settings applied with SetPasswordReset
+type passwordReset struct {
+	url        string
+	ttl        time.Duration
+	maxPerHour int
+	mailer     Mailer
+}
+
+// SetPasswordReset enables self-service password reset. Reset links are
+// built from cfg.URL and delivered with mailer.
+func (c *SecretlyCore) SetPasswordReset(cfg config.PasswordResetConfig, mailer Mailer) error {
+	if !cfg.Enabled {
+		c.reset = nil
+		return nil
+	}
+	if !strings.Contains(cfg.URL, resetTokenPlaceholder) {
+		return fmt.Errorf("auth.password_reset.url must contain %s", resetTokenPlaceholder)
+	}
+	if mailer == nil {
+		return fmt.Errorf("password reset needs a mailer")
+	}
+	r := &passwordReset{url: cfg.URL, ttl: defaultResetTTL, maxPerHour: defaultResetMaxPerHour, mailer: mailer}
+	if cfg.TokenTTLMinutes > 0 {
+		r.ttl = time.Duration(cfg.TokenTTLMinutes) * time.Minute
+	}
+	if cfg.MaxRequestsPerHour > 0 {
+		r.maxPerHour = cfg.MaxRequestsPerHour
+	}
+	c.reset = r
+	return nil
+}
+
+// RequestPasswordReset emails a one-time reset link to the user with the
+// given username or email address. Unknown, deactivated and rate-limited
+// accounts and accounts without an email address are silently skipped, so
+// that callers cannot tell which accounts exist. The email is sent in the
+// background.
+func (c *SecretlyCore) RequestPasswordReset(ctx context.Context, login string) error {
+	if c.reset == nil {
+		return ErrPasswordResetDisabled
+	}
+	login = strings.TrimSpace(login)
+	user, err := c.storage.Users().FindByUsername(login)
+	if errors.Is(err, ErrNotFound) && strings.Contains(login, "@") {
+		user, err = c.GetUserByEmail(ctx, login)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+	if user.DeactivatedAt != nil || user.Email == "" {
+		return nil
+	}
+
+	recent, err := c.storage.PasswordResets().CountSince(user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to check reset requests: %w", err)
+	}
+	from := describeClient(ClientInfoFrom(ctx).IPAddress, "")
+	if recent >= int64(c.reset.maxPerHour) {
+		log.Printf("⚠️  Password reset for user %q from %s rate limited", user.Username, from)
+		return nil
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	expiresAt := time.Now().Add(c.reset.ttl)
+	if err := c.storage.PasswordResets().Create(&models.PasswordReset{
+		UserID:    user.ID,
+		Token:     hashToken(token),
+		ExpiresAt: &expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to store reset request: %w", err)
+	}
+	c.recordUserEvent(ctx, EventPasswordResetRequested, &user.ID, nil, fmt.Sprintf("Password reset requested for user %q from %s",
+		user.Username, from))
+
+	body := fmt.Sprintf(`A password reset was requested for your Secretly account %q.
+
+Open this link within %s to choose a new password:
+
+%s
+
+If you did not ask for this, ignore this email. Your password stays the same.
+`, user.Username, c.reset.ttl, strings.ReplaceAll(c.reset.url, resetTokenPlaceholder, token))
+	go func(r *passwordReset, to, username string) {
+		if err := r.mailer.Send(to, passwordResetMailSubject, body); err != nil {
+			log.Printf("⚠️  Failed to send password reset email for user %q: %v", username, err)
+		}
+	}(c.reset, user.Email, user.Username)
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password for the user a reset token was
+// issued to. The token and any other outstanding tokens of the user stop
+// working, and all of the user's sessions are revoked.
+func (c *SecretlyCore) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	if c.reset == nil {
+		return ErrPasswordResetDisabled
+	}
+	if newPassword == "" {
+		return fmt.Errorf("new password is required")
+	}
+	reset, err := c.storage.PasswordResets().GetByToken(hashToken(token))
+	if errors.Is(err, ErrNotFound) || (err == nil && reset.ExpiresAt != nil && reset.ExpiresAt.Before(time.Now())) {
+		return fmt.Errorf("reset token is invalid or expired: %w", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up reset token: %w", err)
+	}
+	user, err := c.storage.Users().FindByID(reset.UserID)
+	if err != nil || user.DeactivatedAt != nil {
+		return fmt.Errorf("reset token is invalid or expired: %w", ErrInvalidCredentials)
+	}
+
+	hash, err := c.hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	// Consuming the token decides between concurrent confirmations: only
+	// the one that deletes it sets the password
+	consumed, err := c.storage.PasswordResets().Consume(reset.Token, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	if !consumed {
+		return fmt.Errorf("reset token is invalid or expired: %w", ErrInvalidCredentials)
+	}
+	// The user's other tokens go before the password so that a failure
+	// cannot leave them usable
+	if err := c.storage.PasswordResets().DeleteByUser(user.ID); err != nil {
+		return fmt.Errorf("failed to remove reset tokens: %w", err)
+	}
+	if err := c.storage.Users().SetPasswordHash(user.ID, hash); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	revoked, err := c.storage.Sessions().DeleteOthers(user.ID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	c.recordUserEvent(ctx, EventPasswordReset, &user.ID, nil, fmt.Sprintf("Password of user %q reset from %s; %d session(s) revoked",
+		user.Username, describeClient(ClientInfoFrom(ctx).IPAddress, ""), revoked))
+	return nil
+}
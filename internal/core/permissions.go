@@ -0,0 +1,318 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for grants on folders and secrets
+const (
+	EventPermissionGranted = "permission_granted"
+	EventPermissionRevoked = "permission_revoked"
+)
+
+// AccessNone is the level of a user left out of the grants that decide
+// access to a secret
+const AccessNone = "none"
+
+// maxFolderDepth bounds walks up the folder tree
+const maxFolderDepth = 64
+
+// NodeGrant is a grant on a folder or secret as reported to clients
+type NodeGrant struct {
+	Username  string    `json:"username"`
+	Level     string    `json:"level"`
+	GrantedBy string    `json:"granted_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PermissionStep is one node checked when deciding access, from the secret
+// up to the top level
+type PermissionStep struct {
+	NodeID uint   `json:"node_id"`
+	Name   string `json:"name"`
+	Grants int    `json:"grants"`
+	// Level is the user's grant on the node, if any
+	Level string `json:"level,omitempty"`
+}
+
+// PermissionExplanation tells a user's effective level on a secret and
+// where it comes from. Source is "owner", "grant" or "default", the full
+// access of users when no node on the path has grants. The user's roles
+// then cap the level, and LimitedBy names the permission they lack; deny
+// rules lower it further, and DeniedBy names the rule that did. Session scopes,
+// such as an OIDC policy's environment, narrow it further.
+type PermissionExplanation struct {
+	SecretID   uint             `json:"secret_id"`
+	SecretName string           `json:"secret_name"`
+	Username   string           `json:"username"`
+	Level      string           `json:"level"`
+	Source     string           `json:"source"`
+	NodeID     uint             `json:"node_id,omitempty"`
+	NodeName   string           `json:"node_name,omitempty"`
+	Inherited  bool             `json:"inherited"`
+	Path       []PermissionStep `json:"path"`
+	LimitedBy  string           `json:"limited_by,omitempty"`
+	DeniedBy   string           `json:"denied_by,omitempty"`
+	// Denies are the deny rules that matched the user, including those
+	// the user is exempt from
+	Denies []DenyMatch `json:"denies,omitempty"`
+}
+
+// GrantPermission gives a user read or write access to a folder or secret,
+// replacing the user's earlier grant there. Once a node has a grant, only
+// the users granted on it may access it and everything it holds, down to
+// the nodes with grants of their own. Protected secrets return
+// ErrApprovalRequired; see RequestGrant.
+func (c *SecretlyCore) GrantPermission(ctx context.Context, nodeID uint, username, level, by string) (*models.SecretGrant, error) {
+	if level != AccessRead && level != AccessWrite {
+		return nil, fmt.Errorf("grant level must be %q or %q", AccessRead, AccessWrite)
+	}
+	node, err := c.writableSecret(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkRolePermission(ctx, node, PermissionSecretsShare); err != nil {
+		return nil, err
+	}
+	if c.RequiresApproval(node) {
+		return nil, fmt.Errorf("secret %q is protected: %w", node.Name, ErrApprovalRequired)
+	}
+	return c.grantPermission(ctx, nodeID, username, level, by)
+}
+
+func (c *SecretlyCore) grantPermission(ctx context.Context, nodeID uint, username, level, by string) (*models.SecretGrant, error) {
+	node, err := c.loadSecret(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", username, err)
+	}
+	grant := &models.SecretGrant{SecretNodeID: node.ID, UserID: user.ID, Level: level, GrantedBy: by}
+	if err := c.storage.Grants().Set(grant); err != nil {
+		return nil, fmt.Errorf("failed to grant access to %q: %w", node.Name, err)
+	}
+	c.recordUserEvent(ctx, EventPermissionGranted, c.actorID(by), &node.ID, fmt.Sprintf("%q granted %s access to %q by %q",
+		user.Username, level, node.Name, by))
+	return grant, nil
+}
+
+// RevokePermission removes a user's grant on a folder or secret. Removing
+// the last grant of a node makes it inherit access from its folder again.
+func (c *SecretlyCore) RevokePermission(ctx context.Context, nodeID uint, username, by string) error {
+	node, err := c.writableSecret(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	if err := c.checkRolePermission(ctx, node, PermissionSecretsShare); err != nil {
+		return err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return fmt.Errorf("user %q: %w", username, err)
+	}
+	if err := c.storage.Grants().Delete(node.ID, user.ID); err != nil {
+		return fmt.Errorf("grant of %q on %q: %w", user.Username, node.Name, err)
+	}
+	c.recordUserEvent(ctx, EventPermissionRevoked, c.actorID(by), &node.ID, fmt.Sprintf("Access of %q to %q revoked by %q",
+		user.Username, node.Name, by))
+	return nil
+}
+
+// ListGrants returns the grants set directly on a folder or secret
+func (c *SecretlyCore) ListGrants(ctx context.Context, nodeID uint) ([]NodeGrant, error) {
+	if _, err := c.GetSecret(ctx, nodeID); err != nil {
+		return nil, err
+	}
+	grants, err := c.storage.Grants().ListByNode(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grants of %d: %w", nodeID, err)
+	}
+	userIDs := make([]uint, 0, len(grants))
+	for _, grant := range grants {
+		userIDs = append(userIDs, grant.UserID)
+	}
+	users, err := c.storage.Users().FindByIDs(userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users of grants on %d: %w", nodeID, err)
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	result := make([]NodeGrant, 0, len(grants))
+	for _, grant := range grants {
+		result = append(result, NodeGrant{Username: usernames[grant.UserID], Level: grant.Level, GrantedBy: grant.GrantedBy, UpdatedAt: grant.UpdatedAt})
+	}
+	return result, nil
+}
+
+// CheckSecretPermission checks a session against the grants on secret and
+// its folders. The grants of the nearest node that has any decide; without
+// grants on the path, and for sessions without a user, access is not
+// restricted. The owner of a secret always keeps write access.
+func (c *SecretlyCore) CheckSecretPermission(session *models.Session, secret *models.SecretNode, write bool) error {
+	return c.checkSecretPermission(c.newPermissionBatch(), session, secret, write)
+}
+
+func (c *SecretlyCore) checkSecretPermission(b *permissionBatch, session *models.Session, secret *models.SecretNode, write bool) error {
+	if session == nil || session.UserID == 0 {
+		return nil
+	}
+	explanation, err := b.explain(secret, session.UserID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case explanation.Level == AccessWrite, explanation.Level == AccessRead && !write:
+		return nil
+	case explanation.DeniedBy != "":
+		return fmt.Errorf("%w: deny rule %q", ErrPermissionDenied, explanation.DeniedBy)
+	case explanation.LimitedBy != "":
+		return fmt.Errorf("%w: no role grants %s", ErrPermissionDenied, explanation.LimitedBy)
+	case explanation.Level == AccessRead:
+		return fmt.Errorf("%w: read-only grant on %q", ErrPermissionDenied, explanation.NodeName)
+	default:
+		return fmt.Errorf("%w: no grant on %q", ErrPermissionDenied, explanation.NodeName)
+	}
+}
+
+// CanReadSecret reports whether the actor in ctx may read secret, e.g. to
+// leave it out of listings; unlike AuthorizeSecret it records nothing
+func (c *SecretlyCore) CanReadSecret(ctx context.Context, secret *models.SecretNode) bool {
+	session, err := c.actorSession(ctx)
+	return err == nil && c.checkAccess(session, secret, false) == nil && c.NamespaceReachable(ctx, secret.NamespaceID)
+}
+
+// readableSecrets filters secrets in place down to those the actor in ctx
+// may read, as CanReadSecret, loading the grants and folders of all of
+// them at once
+func (c *SecretlyCore) readableSecrets(ctx context.Context, secrets []models.SecretNode) []models.SecretNode {
+	session, err := c.actorSession(ctx)
+	if err != nil {
+		return secrets[:0]
+	}
+	b := c.preloadPermissions(secrets)
+	readable := secrets[:0]
+	for i := range secrets {
+		secret := &secrets[i]
+		if c.checkSessionScope(session, secret, false) == nil && c.checkSecretPermission(b, session, secret, false) == nil &&
+			c.NamespaceReachable(ctx, secret.NamespaceID) {
+			readable = append(readable, *secret)
+		}
+	}
+	return readable
+}
+
+// ExplainPermission reports a user's effective level on a secret and the
+// node it comes from
+func (c *SecretlyCore) ExplainPermission(ctx context.Context, secretID uint, username string) (*PermissionExplanation, error) {
+	secret, err := c.GetSecret(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", username, err)
+	}
+	return c.explainPermission(secret, user.ID)
+}
+
+// explainPermission walks from node up to the top level and stops at the
+// first node with grants
+func (c *SecretlyCore) explainPermission(node *models.SecretNode, userID uint) (*PermissionExplanation, error) {
+	return c.newPermissionBatch().explain(node, userID)
+}
+
+// explain is explainPermission reading through the batch
+func (b *permissionBatch) explain(node *models.SecretNode, userID uint) (*PermissionExplanation, error) {
+	user, err := b.user(userID)
+	if err != nil {
+		return nil, err
+	}
+	explanation := &PermissionExplanation{
+		SecretID:   node.ID,
+		SecretName: node.Name,
+		Username:   user.Username,
+		Level:      AccessWrite,
+		Source:     "default",
+	}
+
+	current := node
+	for depth := 0; ; depth++ {
+		grants, err := b.grantsOn(current.ID)
+		if err != nil {
+			return nil, err
+		}
+		step := PermissionStep{NodeID: current.ID, Name: current.Name, Grants: len(grants)}
+		for _, grant := range grants {
+			if grant.UserID == userID {
+				step.Level = grant.Level
+			}
+		}
+		explanation.Path = append(explanation.Path, step)
+		if len(grants) > 0 {
+			explanation.Level, explanation.Source = step.Level, AccessSourceGrant
+			if explanation.Level == "" {
+				explanation.Level = AccessNone
+			}
+			explanation.NodeID, explanation.NodeName = current.ID, current.Name
+			explanation.Inherited = current.ID != node.ID
+			break
+		}
+		if current.ParentID == nil || depth == maxFolderDepth {
+			break
+		}
+		if current, err = b.folder(*current.ParentID); err != nil {
+			return nil, fmt.Errorf("failed to get folder of %q: %w", step.Name, err)
+		}
+	}
+
+	if explanation.Level != AccessWrite && node.Owner != "" && node.Owner == user.Username {
+		explanation.Level, explanation.Source = AccessWrite, AccessSourceOwner
+	}
+
+	// roles cap what their holders may do, owners included
+	if explanation.Level != AccessNone {
+		permissions, restricted, err := b.rolePermissions(userID, node.NamespaceID)
+		if err != nil {
+			return nil, err
+		}
+		if restricted && explanation.Level == AccessWrite && !permissions[PermissionSecretsWrite] {
+			explanation.Level, explanation.LimitedBy = AccessRead, PermissionSecretsWrite
+		}
+		if restricted && !permissions[PermissionSecretsRead] && !permissions[PermissionSecretsList] {
+			explanation.Level, explanation.LimitedBy = AccessNone, PermissionSecretsList
+		}
+	}
+
+	// deny rules override every allow, owners included
+	lower := map[string]string{PermissionSecretsWrite: AccessRead, PermissionSecretsRead: AccessNone}
+	for _, permission := range []string{PermissionSecretsWrite, PermissionSecretsRead} {
+		if explanation.Level == AccessNone || (permission == PermissionSecretsWrite && explanation.Level != AccessWrite) {
+			continue
+		}
+		matches, err := b.matchDeny(userID, node.NamespaceID, permission)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Denies = append(explanation.Denies, matches...)
+		if rule := denied(matches); rule != nil {
+			explanation.Level, explanation.DeniedBy = lower[permission], rule.Rule
+		}
+	}
+	return explanation, nil
+}
+
+// actorID returns the ID of the user named by, or nil for tools
+func (c *SecretlyCore) actorID(by string) *uint {
+	if user, err := c.storage.Users().FindByUsername(by); err == nil {
+		return &user.ID
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// permissionBatch holds what deciding access to many secrets reads: the
+// users, the grants on the secrets and their folders, the folders, the
+// deny rule matches and the clients and devices of the users. preload
+// fills it for a listing in a few queries per folder level; everything
+// else is loaded on first use and kept, so an empty batch behaves like
+// reading storage directly.
+type permissionBatch struct {
+	c       *SecretlyCore
+	users   map[uint]*models.User
+	grants  map[uint][]models.SecretGrant
+	folders map[uint]*models.SecretNode
+	denies  map[denyKey][]DenyMatch
+	roles   map[[2]uint]heldPermissions
+	clients map[uint][]models.APIClient
+	devices []models.Device
+}
+
+// heldPermissions is a result of rolePermissions
+type heldPermissions struct {
+	permissions map[string]bool
+	restricted  bool
+}
+
+type denyKey struct {
+	userID      uint
+	namespaceID uint
+	permission  string
+}
+
+func (c *SecretlyCore) newPermissionBatch() *permissionBatch {
+	return &permissionBatch{
+		c:       c,
+		users:   make(map[uint]*models.User),
+		grants:  make(map[uint][]models.SecretGrant),
+		folders: make(map[uint]*models.SecretNode),
+		denies:  make(map[denyKey][]DenyMatch),
+		roles:   make(map[[2]uint]heldPermissions),
+		clients: make(map[uint][]models.APIClient),
+	}
+}
+
+// preloadPermissions returns a batch holding the grants on secrets and on
+// every folder above them, and the folders themselves. A failed query only
+// leaves the rest to be loaded on use.
+func (c *SecretlyCore) preloadPermissions(secrets []models.SecretNode) *permissionBatch {
+	b := c.newPermissionBatch()
+	level := make([]*models.SecretNode, 0, len(secrets))
+	for i := range secrets {
+		level = append(level, &secrets[i])
+	}
+	for depth := 0; len(level) > 0 && depth <= maxFolderDepth; depth++ {
+		ids := make([]uint, 0, len(level))
+		for _, node := range level {
+			if _, ok := b.grants[node.ID]; !ok {
+				ids = append(ids, node.ID)
+				b.grants[node.ID] = nil
+			}
+		}
+		grants, err := c.storage.Grants().ListByNodes(ids)
+		if err != nil {
+			for _, id := range ids {
+				delete(b.grants, id)
+			}
+			return b
+		}
+		for _, grant := range grants {
+			b.grants[grant.SecretNodeID] = append(b.grants[grant.SecretNodeID], grant)
+		}
+
+		// Walks stop at the first node with grants
+		var parentIDs []uint
+		for _, node := range level {
+			if node.ParentID == nil || len(b.grants[node.ID]) > 0 {
+				continue
+			}
+			if _, ok := b.folders[*node.ParentID]; !ok {
+				parentIDs = append(parentIDs, *node.ParentID)
+				b.folders[*node.ParentID] = nil
+			}
+		}
+		folders, err := c.storage.Secrets().GetByIDs(parentIDs)
+		if err != nil {
+			for _, id := range parentIDs {
+				delete(b.folders, id)
+			}
+			return b
+		}
+		level = level[:0]
+		for i := range folders {
+			b.folders[folders[i].ID] = &folders[i]
+			level = append(level, &folders[i])
+		}
+		for _, id := range parentIDs {
+			if b.folders[id] == nil {
+				delete(b.folders, id)
+			}
+		}
+	}
+	return b
+}
+
+// addUsers keeps users, e.g. from a listing of all users
+func (b *permissionBatch) addUsers(users []models.User) {
+	for i := range users {
+		b.users[users[i].ID] = &users[i]
+	}
+}
+
+func (b *permissionBatch) user(id uint) (*models.User, error) {
+	if user, ok := b.users[id]; ok {
+		return user, nil
+	}
+	user, err := b.c.storage.Users().FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", id, err)
+	}
+	b.users[id] = user
+	return user, nil
+}
+
+func (b *permissionBatch) grantsOn(nodeID uint) ([]models.SecretGrant, error) {
+	if grants, ok := b.grants[nodeID]; ok {
+		return grants, nil
+	}
+	grants, err := b.c.storage.Grants().ListByNode(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grants of %d: %w", nodeID, err)
+	}
+	b.grants[nodeID] = grants
+	return grants, nil
+}
+
+func (b *permissionBatch) folder(id uint) (*models.SecretNode, error) {
+	if folder, ok := b.folders[id]; ok {
+		return folder, nil
+	}
+	folder, err := b.c.storage.Secrets().GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	b.folders[id] = folder
+	return folder, nil
+}
+
+func (b *permissionBatch) matchDeny(userID, namespaceID uint, permission string) ([]DenyMatch, error) {
+	key := denyKey{userID, namespaceID, permission}
+	if matches, ok := b.denies[key]; ok {
+		return matches, nil
+	}
+	matches, err := b.c.matchDeny(userID, namespaceID, permission)
+	if err != nil {
+		return nil, err
+	}
+	b.denies[key] = matches
+	return matches, nil
+}
+
+func (b *permissionBatch) rolePermissions(userID, namespaceID uint) (map[string]bool, bool, error) {
+	key := [2]uint{userID, namespaceID}
+	if held, ok := b.roles[key]; ok {
+		return held.permissions, held.restricted, nil
+	}
+	permissions, restricted, err := b.c.rolePermissions(userID, namespaceID)
+	if err != nil {
+		return nil, false, err
+	}
+	b.roles[key] = heldPermissions{permissions, restricted}
+	return permissions, restricted, nil
+}
+
+// clientsOf returns the API clients of the user with userID
+func (b *permissionBatch) clientsOf(userID uint) []models.APIClient {
+	clients, ok := b.clients[userID]
+	if !ok {
+		clients, _ = b.c.storage.APIClients().ListByUser(userID)
+		b.clients[userID] = clients
+	}
+	return clients
+}
+
+// allDevices returns every enrolled device
+func (b *permissionBatch) allDevices() []models.Device {
+	if b.devices == nil {
+		b.devices, _ = b.c.storage.Devices().List()
+		if b.devices == nil {
+			b.devices = []models.Device{}
+		}
+	}
+	return b.devices
+}
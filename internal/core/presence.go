@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// CountSecrets returns how many secrets match the filter. Unlike
+// ListSecrets it needs only the permission to know that secrets exist:
+// sessions with the secrets:exists scope may count, as may any session
+// that may read the secrets. Secrets the actor in ctx has no grant on are
+// not counted. Page and PageSize in the filter are ignored.
+func (c *SecretlyCore) CountSecrets(ctx context.Context, filter *ListSecretsFilter) (int64, error) {
+	scoped := *filter
+	if err := c.scopeFilter(ctx, &scoped, true); err != nil {
+		return 0, err
+	}
+	session, err := c.actorSession(ctx)
+	if err != nil {
+		return 0, err
+	}
+	all, err := c.storage.Secrets().List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	var count int64
+	for i := range all {
+		s := &all[i]
+		if scoped.matches(s) && c.checkPresence(session, s) == nil && c.NamespaceReachable(ctx, s.NamespaceID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// SecretExists reports whether a secret with the given name matches the
+// filter, with the permissions of CountSecrets
+func (c *SecretlyCore) SecretExists(ctx context.Context, filter *ListSecretsFilter, name string) (bool, error) {
+	named := *filter
+	named.Name = name
+	count, err := c.CountSecrets(ctx, &named)
+	return count > 0, err
+}
+
+// checkPresence checks that session may know that secret exists: within
+// its scope, which needs not allow reading, and with a read grant
+func (c *SecretlyCore) checkPresence(session *models.Session, secret *models.SecretNode) error {
+	r, err := c.sessionRestriction(session)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		if !r.seesSecrets() {
+			return fmt.Errorf("%w: %s cannot see secrets", ErrPermissionDenied, r.name)
+		}
+		if err := r.covers(secret); err != nil {
+			return err
+		}
+	}
+	return c.CheckSecretPermission(session, secret, false)
+}
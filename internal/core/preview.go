@@ -0,0 +1,70 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// EventSecretPreviewed is recorded when the ends of a value are revealed.
+// A preview is not a read: it does not count towards max-reads limits.
+const EventSecretPreviewed = "secret_previewed"
+
+// MaxPreviewChars bounds how many characters a preview reveals at each end
+const MaxPreviewChars = 8
+
+// SecretPreview holds the first and last characters of a secret value, for
+// checking that a value is the expected one without revealing it
+type SecretPreview struct {
+	First  string
+	Last   string
+	Length int
+}
+
+// PreviewSecretValue reveals the first and last characters of a value. At
+// most MaxPreviewChars are revealed at each end and never more than half of
+// the value. Expiration, max-reads and check-out are enforced as for reads,
+// but the read count is left unchanged.
+func (c *SecretlyCore) PreviewSecretValue(ctx context.Context, id uint, first, last int) (*SecretPreview, error) {
+	if first < 0 || last < 0 || first > MaxPreviewChars || last > MaxPreviewChars {
+		return nil, fmt.Errorf("a preview reveals between 0 and %d characters at each end", MaxPreviewChars)
+	}
+	if first+last == 0 {
+		return nil, fmt.Errorf("a preview must reveal at least one character")
+	}
+	secret, version, err := c.readableVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.writeVersionValue(ctx, version, &buf); err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("secret %d holds binary data and cannot be previewed", id)
+	}
+	runes := []rune(buf.String())
+	if 2*(first+last) > len(runes) {
+		return nil, fmt.Errorf("revealing %d characters would show more than half of secret %d", first+last, id)
+	}
+	preview := &SecretPreview{
+		First:  string(runes[:first]),
+		Last:   string(runes[len(runes)-last:]),
+		Length: len(runes),
+	}
+
+	c.recordClientEvent(ctx, EventSecretPreviewed, &secret.ID, fmt.Sprintf("Secret %q version %d previewed (first %d and last %d characters)",
+		secret.Name, version.VersionNumber, first, last))
+	if secret.Canary {
+		c.tripCanary(ctx, secret, version, "value previewed")
+	}
+	return preview, nil
+}
+
+// Masked shows the preview with the hidden characters replaced by "*"
+func (p *SecretPreview) Masked() string {
+	hidden := p.Length - utf8.RuneCountInString(p.First) - utf8.RuneCountInString(p.Last)
+	return p.First + string(bytes.Repeat([]byte("*"), hidden)) + p.Last
+}
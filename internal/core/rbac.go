@@ -0,0 +1,885 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// EventRBACChanged records one change made by ApplyRBAC
+const EventRBACChanged = "rbac_changed"
+
+// ErrInvalidRBAC is returned for access policies that cannot be applied,
+// e.g. when an assignment names a role that does not exist
+var ErrInvalidRBAC = errors.New("invalid access policy")
+
+// RBACPolicy is the users, groups, roles, role assignments and deny rules
+// an access file declares. ApplyRBAC makes the database match it section by section:
+// a section left out (nil) is not managed, while an empty one removes
+// everything in it. Users are never deleted; set Deactivated instead.
+type RBACPolicy struct {
+	Users       []RBACUser       `yaml:"users,omitempty" json:"users,omitempty"`
+	Groups      []RBACGroup      `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Roles       []RBACRole       `yaml:"roles,omitempty" json:"roles,omitempty"`
+	Assignments []RBACAssignment `yaml:"assignments,omitempty" json:"assignments,omitempty"`
+	Deny        []RBACDeny       `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// RBACUser is a user of an access policy. An empty Email leaves the
+// user's address alone.
+type RBACUser struct {
+	Username    string `yaml:"username" json:"username"`
+	Email       string `yaml:"email,omitempty" json:"email,omitempty"`
+	Deactivated bool   `yaml:"deactivated,omitempty" json:"deactivated,omitempty"`
+}
+
+// RBACGroup is a group of an access policy with its complete member list
+type RBACGroup struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Members     []string `yaml:"members,omitempty" json:"members,omitempty"`
+}
+
+// RBACRole is a role of an access policy. Permissions come from the
+// permission catalog. Built-in roles may be listed by name only, so the
+// file can assign them; they cannot be changed or removed.
+type RBACRole struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Permissions []string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+}
+
+// RBACAssignment grants Role to either User or Group, in NamespaceID or,
+// when it is 0, everywhere
+type RBACAssignment struct {
+	Role        string `yaml:"role" json:"role"`
+	User        string `yaml:"user,omitempty" json:"user,omitempty"`
+	Group       string `yaml:"group,omitempty" json:"group,omitempty"`
+	NamespaceID uint   `yaml:"namespace_id,omitempty" json:"namespace_id,omitempty"`
+}
+
+// RBACDeny is a deny rule of an access policy: it takes Permission away
+// from the members of Group, or everyone, in NamespaceID or everywhere,
+// unless they hold one of the Except roles there
+type RBACDeny struct {
+	Name        string   `yaml:"name" json:"name"`
+	Permission  string   `yaml:"permission" json:"permission"`
+	NamespaceID uint     `yaml:"namespace_id,omitempty" json:"namespace_id,omitempty"`
+	Group       string   `yaml:"group,omitempty" json:"group,omitempty"`
+	Except      []string `yaml:"except,omitempty" json:"except,omitempty"`
+}
+
+// holder names who an assignment grants its role to, like "user alice"
+func (a *RBACAssignment) holder() string {
+	if a.User != "" {
+		return "user " + a.User
+	}
+	return "group " + a.Group
+}
+
+// RBACChange is one step of an access plan
+type RBACChange struct {
+	Action string `json:"action"` // create, update or remove
+	Kind   string `json:"kind"`   // user, role, group, member or assignment
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	// Before and After are the user, role, group, member, assignment or
+	// deny rule as in an access file, before and after the change; Before
+	// is nil for creations and After for removals
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+
+	apply func(tx storage.Storage, st *rbacState) error
+}
+
+// String formats the change as a plan line, like "+ role deployer"
+func (ch RBACChange) String() string {
+	sign := map[string]string{"create": "+", "update": "~", "remove": "-"}[ch.Action]
+	line := fmt.Sprintf("%s %s %s", sign, ch.Kind, ch.Name)
+	if ch.Detail != "" {
+		line += " (" + ch.Detail + ")"
+	}
+	return line
+}
+
+// rbacState is what a policy is compared against, by name
+type rbacState struct {
+	users      map[string]*models.User
+	roles      map[string]*models.Role
+	groups     map[string]*models.Group
+	members    map[[2]string]bool  // group, user
+	userRoles  map[[2]string]*uint // user, role -> namespace
+	groupRoles map[[2]string]*uint // group, role -> namespace
+	denyRules  map[string]*models.DenyRule
+	// emailIndex computes the email index of the users applied
+	emailIndex func(email string) (string, error)
+}
+
+// PlanRBAC returns the changes ApplyRBAC would make for policy, without
+// making them
+func (c *SecretlyCore) PlanRBAC(ctx context.Context, policy *RBACPolicy) ([]RBACChange, error) {
+	if err := c.checkRBAC(ctx, policy); err != nil {
+		return nil, err
+	}
+	st, err := loadRBACState(c.storage)
+	if err != nil {
+		return nil, err
+	}
+	return planRBAC(st, policy)
+}
+
+// ApplyRBAC makes users, groups, roles and assignments match policy in one
+// transaction and returns the changes made. Each change is audited and
+// logged with its before and after snapshots for ListRBACChanges.
+func (c *SecretlyCore) ApplyRBAC(ctx context.Context, policy *RBACPolicy) ([]RBACChange, error) {
+	if err := c.checkRBAC(ctx, policy); err != nil {
+		return nil, err
+	}
+	userID := c.clientUserID(ctx)
+	actor := c.rbacActor(ctx)
+
+	var changes []RBACChange
+	var events []*models.AuditEvent
+	err := c.storage.WithTransaction(func(tx storage.Storage) error {
+		st, err := loadRBACState(tx)
+		if err != nil {
+			return err
+		}
+		st.emailIndex = c.emailIndex
+		if changes, err = planRBAC(st, policy); err != nil {
+			return err
+		}
+		for _, ch := range changes {
+			if err := ch.apply(tx, st); err != nil {
+				return fmt.Errorf("failed to %s %s %s: %w", ch.Action, ch.Kind, ch.Name, err)
+			}
+			event := c.auditEvent(ctx, EventRBACChanged, userID, nil, "Access policy: "+ch.String())
+			if err := tx.Audit().LogEvent(event); err != nil {
+				return fmt.Errorf("failed to record audit event: %w", err)
+			}
+			if err := tx.RBAC().LogChange(rbacChangeLog(event, actor, &ch)); err != nil {
+				return fmt.Errorf("failed to record access change: %w", err)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		c.publishEvent(event)
+	}
+	return changes, nil
+}
+
+// RBACChangeRecord is a change ApplyRBAC made, with who made it and the
+// snapshots before and after it
+type RBACChangeRecord struct {
+	ID           uint            `json:"id"`
+	AuditEventID uint            `json:"audit_event_id"`
+	Time         time.Time       `json:"time"`
+	Actor        string          `json:"actor"`
+	Action       string          `json:"action"`
+	Kind         string          `json:"kind"`
+	Name         string          `json:"name"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+}
+
+// RBACChangeFilter narrows ListRBACChanges; zero values mean "no filter".
+// Name is matched exactly, e.g. "deployer" or "ops/alice" for a member.
+type RBACChangeFilter struct {
+	From  time.Time
+	To    time.Time
+	Kind  string
+	Name  string
+	Actor string
+}
+
+// ListRBACChanges returns up to limit changes to users, roles, groups,
+// members, assignments and deny rules matching the filter that follow
+// cursor, newest first, and the cursor of the next page ("" on the last
+// page)
+func (c *SecretlyCore) ListRBACChanges(ctx context.Context, filter *RBACChangeFilter, after string, limit int) ([]RBACChangeRecord, string, error) {
+	if err := c.requirePermission(ctx, PermissionAuditRead, "reading access changes"); err != nil {
+		return nil, "", err
+	}
+	lastID, err := decodeCursor("rbac-changes", after)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = cursorLimit(limit)
+	logs, err := c.storage.RBAC().ListChanges(repository.RBACChangeQuery{
+		From:    filter.From,
+		To:      filter.To,
+		Kind:    filter.Kind,
+		Name:    filter.Name,
+		Actor:   filter.Actor,
+		AfterID: lastID,
+		Limit:   limit + 1,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list access changes: %w", err)
+	}
+	next := ""
+	if len(logs) > limit {
+		logs = logs[:limit]
+		next = encodeCursor("rbac-changes", logs[limit-1].ID)
+	}
+	records := make([]RBACChangeRecord, 0, len(logs))
+	for _, l := range logs {
+		records = append(records, RBACChangeRecord{
+			ID:           l.ID,
+			AuditEventID: l.AuditEventID,
+			Time:         l.ChangedAt,
+			Actor:        l.Actor,
+			Action:       l.Action,
+			Kind:         l.Kind,
+			Name:         l.Name,
+			Before:       json.RawMessage(l.Before),
+			After:        json.RawMessage(l.After),
+		})
+	}
+	return records, next, nil
+}
+
+// rbacActor names who applies an access policy: the user of the session,
+// or the system actor's reason, e.g. "command line"
+func (c *SecretlyCore) rbacActor(ctx context.Context) string {
+	if client := ClientInfoFrom(ctx); client.Username != "" {
+		return client.Username
+	}
+	if auth, err := c.actor(ctx); err == nil && auth.Reason != "" {
+		return auth.Reason
+	}
+	return "system"
+}
+
+// rbacChangeLog makes the change log entry of ch, recorded with event
+func rbacChangeLog(event *models.AuditEvent, actor string, ch *RBACChange) *models.RBACChangeLog {
+	entry := &models.RBACChangeLog{
+		AuditEventID: event.ID,
+		Actor:        actor,
+		Action:       ch.Action,
+		Kind:         ch.Kind,
+		Name:         ch.Name,
+		ChangedAt:    event.EventTime,
+	}
+	// The snapshots are plain structs, which always marshal
+	if ch.Before != nil {
+		entry.Before, _ = json.Marshal(ch.Before)
+	}
+	if ch.After != nil {
+		entry.After, _ = json.Marshal(ch.After)
+	}
+	return entry
+}
+
+// checkRBAC allows only system actors, i.e. the command line, to manage
+// access, and validates the namespaces policy assigns roles in
+func (c *SecretlyCore) checkRBAC(ctx context.Context, policy *RBACPolicy) error {
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return err
+	}
+	if !auth.System {
+		return fmt.Errorf("%w: access policies are applied from the command line", ErrPermissionDenied)
+	}
+	for _, a := range policy.Assignments {
+		if a.NamespaceID == 0 {
+			continue
+		}
+		if err := c.ValidateScope(ctx, a.NamespaceID, 0, 0); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidRBAC, a.holder(), err)
+		}
+	}
+	for _, d := range policy.Deny {
+		if d.NamespaceID == 0 {
+			continue
+		}
+		if err := c.ValidateScope(ctx, d.NamespaceID, 0, 0); err != nil {
+			return fmt.Errorf("%w: deny rule %q: %v", ErrInvalidRBAC, d.Name, err)
+		}
+	}
+	return nil
+}
+
+func loadRBACState(s storage.Storage) (*rbacState, error) {
+	st := &rbacState{
+		users:      make(map[string]*models.User),
+		roles:      make(map[string]*models.Role),
+		groups:     make(map[string]*models.Group),
+		members:    make(map[[2]string]bool),
+		userRoles:  make(map[[2]string]*uint),
+		groupRoles: make(map[[2]string]*uint),
+		denyRules:  make(map[string]*models.DenyRule),
+	}
+	users, err := s.Users().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	userNames := make(map[uint]string, len(users))
+	for i := range users {
+		st.users[users[i].Username] = &users[i]
+		userNames[users[i].ID] = users[i].Username
+	}
+	roles, err := s.RBAC().ListRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	roleNames := make(map[uint]string, len(roles))
+	for i := range roles {
+		st.roles[roles[i].Name] = &roles[i]
+		roleNames[roles[i].ID] = roles[i].Name
+	}
+	groups, err := s.RBAC().ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	groupNames := make(map[uint]string, len(groups))
+	for i := range groups {
+		st.groups[groups[i].Name] = &groups[i]
+		groupNames[groups[i].ID] = groups[i].Name
+	}
+
+	members, err := s.RBAC().ListMembers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	for _, m := range members {
+		st.members[[2]string{groupNames[m.GroupID], userNames[m.UserID]}] = true
+	}
+	userRoles, err := s.RBAC().ListUserRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	for _, a := range userRoles {
+		st.userRoles[[2]string{userNames[a.UserID], roleNames[a.RoleID]}] = a.NamespaceID
+	}
+	groupRoles, err := s.RBAC().ListGroupRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	for _, a := range groupRoles {
+		st.groupRoles[[2]string{groupNames[a.GroupID], roleNames[a.RoleID]}] = a.NamespaceID
+	}
+	rules, err := s.RBAC().ListDenyRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deny rules: %w", err)
+	}
+	for i := range rules {
+		st.denyRules[rules[i].Name] = &rules[i]
+	}
+	return st, nil
+}
+
+// planRBAC compares policy with st. Changes are ordered so that whatever
+// a change refers to exists by then: users, roles and groups first,
+// removals of roles and groups last.
+func planRBAC(st *rbacState, policy *RBACPolicy) ([]RBACChange, error) {
+	if err := validateRBAC(st, policy); err != nil {
+		return nil, err
+	}
+	var changes, removals []RBACChange
+
+	for _, u := range policy.Users {
+		u := u
+		existing := st.users[u.Username]
+		if existing == nil {
+			detail := ""
+			if u.Deactivated {
+				detail = "deactivated"
+			}
+			changes = append(changes, RBACChange{Action: "create", Kind: "user", Name: u.Username, Detail: detail, After: u,
+				apply: func(tx storage.Storage, st *rbacState) error {
+					index, err := st.emailIndex(u.Email)
+					if err != nil {
+						return err
+					}
+					user := &models.User{Username: u.Username, Email: u.Email, EmailIndex: index}
+					if u.Deactivated {
+						now := time.Now().UTC()
+						user.DeactivatedAt = &now
+					}
+					if err := tx.Users().Create(user); err != nil {
+						return err
+					}
+					st.users[user.Username] = user
+					return nil
+				}})
+			continue
+		}
+		before := userSnapshot(existing)
+		if u.Email != "" && u.Email != existing.Email {
+			after := before
+			after.Email = u.Email
+			changes = append(changes, RBACChange{Action: "update", Kind: "user", Name: u.Username,
+				Detail: fmt.Sprintf("email %q -> %q", existing.Email, u.Email), Before: before, After: after,
+				apply: func(tx storage.Storage, st *rbacState) error {
+					index, err := st.emailIndex(u.Email)
+					if err != nil {
+						return err
+					}
+					return tx.Users().SetEmail(st.users[u.Username].ID, u.Email, index)
+				}})
+		}
+		switch {
+		case u.Deactivated && existing.DeactivatedAt == nil:
+			after := before
+			after.Deactivated = true
+			changes = append(changes, RBACChange{Action: "update", Kind: "user", Name: u.Username, Detail: "deactivate and revoke sessions",
+				Before: before, After: after,
+				apply: func(tx storage.Storage, st *rbacState) error {
+					now := time.Now().UTC()
+					id := st.users[u.Username].ID
+					if err := tx.Users().SetDeactivated(id, &now); err != nil {
+						return err
+					}
+					// keepID 0 matches no session, so every session is revoked
+					_, err := tx.Sessions().DeleteOthers(id, 0)
+					return err
+				}})
+		case !u.Deactivated && existing.DeactivatedAt != nil:
+			after := before
+			after.Deactivated = false
+			changes = append(changes, RBACChange{Action: "update", Kind: "user", Name: u.Username, Detail: "reactivate",
+				Before: before, After: after,
+				apply: func(tx storage.Storage, st *rbacState) error {
+					return tx.Users().SetDeactivated(st.users[u.Username].ID, nil)
+				}})
+		}
+	}
+
+	if policy.Roles != nil {
+		listed := make(map[string]bool)
+		for _, r := range policy.Roles {
+			r := r
+			listed[r.Name] = true
+			existing := st.roles[r.Name]
+			permissions := strings.Join(r.Permissions, ",")
+			if existing != nil && (existing.Builtin || existing.Description == r.Description && existing.Permissions == permissions) {
+				continue
+			}
+			change := RBACChange{Action: "create", Kind: "role", Name: r.Name, Detail: describe(r.Description), After: r}
+			if existing != nil {
+				change.Action, change.Before = "update", roleSnapshot(existing)
+			}
+			if permissions != "" {
+				change.Detail = strings.TrimPrefix(change.Detail+"; "+permissions, "; ")
+			}
+			change.apply = func(tx storage.Storage, st *rbacState) error {
+				role := &models.Role{Name: r.Name, Description: r.Description, Permissions: permissions}
+				if err := tx.RBAC().SaveRole(role); err != nil {
+					return err
+				}
+				st.roles[role.Name] = role
+				return nil
+			}
+			changes = append(changes, change)
+		}
+		for _, name := range sortedKeys(st.roles) {
+			if listed[name] || st.roles[name].Builtin {
+				continue
+			}
+			removals = append(removals, RBACChange{Action: "remove", Kind: "role", Name: name, Detail: "with its assignments",
+				Before: roleSnapshot(st.roles[name]),
+				apply: func(tx storage.Storage, st *rbacState) error {
+					return tx.RBAC().DeleteRole(st.roles[name].ID)
+				}})
+		}
+	}
+
+	if policy.Groups != nil {
+		listed := make(map[string]bool)
+		for _, g := range policy.Groups {
+			g := g
+			listed[g.Name] = true
+			existing := st.groups[g.Name]
+			if existing == nil || existing.Description != g.Description {
+				change := RBACChange{Action: "create", Kind: "group", Name: g.Name, Detail: describe(g.Description),
+					After: RBACGroup{Name: g.Name, Description: g.Description}}
+				if existing != nil {
+					change.Action, change.Before = "update", groupSnapshot(existing)
+				}
+				change.apply = func(tx storage.Storage, st *rbacState) error {
+					group := &models.Group{Name: g.Name, Description: g.Description}
+					if err := tx.RBAC().SaveGroup(group); err != nil {
+						return err
+					}
+					st.groups[group.Name] = group
+					return nil
+				}
+				changes = append(changes, change)
+			}
+		}
+		for _, name := range sortedKeys(st.groups) {
+			if listed[name] {
+				continue
+			}
+			removals = append(removals, RBACChange{Action: "remove", Kind: "group", Name: name, Detail: "with its members and assignments",
+				Before: groupSnapshot(st.groups[name]),
+				apply: func(tx storage.Storage, st *rbacState) error {
+					return tx.RBAC().DeleteGroup(st.groups[name].ID)
+				}})
+		}
+		changes = append(changes, planMembers(st, policy.Groups)...)
+	}
+
+	if policy.Assignments != nil {
+		changes = append(changes, planAssignments(st, policy.Assignments)...)
+	}
+	if policy.Deny != nil {
+		changes = append(changes, planDenyRules(st, policy.Deny)...)
+	}
+	return append(changes, removals...), nil
+}
+
+// planMembers makes the members of every listed group match its list
+func planMembers(st *rbacState, groups []RBACGroup) []RBACChange {
+	var changes []RBACChange
+	for _, g := range groups {
+		want := make(map[string]bool)
+		for _, username := range g.Members {
+			want[username] = true
+			if st.members[[2]string{g.Name, username}] {
+				continue
+			}
+			key := [2]string{g.Name, username}
+			changes = append(changes, RBACChange{Action: "create", Kind: "member", Name: g.Name + "/" + username,
+				After: rbacMember{Group: g.Name, User: username},
+				apply: func(tx storage.Storage, st *rbacState) error {
+					return tx.RBAC().AddMember(&models.UserGroup{GroupID: st.groups[key[0]].ID, UserID: st.users[key[1]].ID})
+				}})
+		}
+		for _, key := range sortedPairs(st.members) {
+			if key[0] != g.Name || want[key[1]] {
+				continue
+			}
+			changes = append(changes, RBACChange{Action: "remove", Kind: "member", Name: key[0] + "/" + key[1],
+				Before: rbacMember{Group: key[0], User: key[1]},
+				apply: func(tx storage.Storage, st *rbacState) error {
+					return tx.RBAC().RemoveMember(&models.UserGroup{GroupID: st.groups[key[0]].ID, UserID: st.users[key[1]].ID})
+				}})
+		}
+	}
+	return changes
+}
+
+// planAssignments makes the role assignments of users and groups match
+// assignments
+func planAssignments(st *rbacState, assignments []RBACAssignment) []RBACChange {
+	var changes []RBACChange
+	wantUsers := make(map[[2]string]bool)
+	wantGroups := make(map[[2]string]bool)
+	for _, a := range assignments {
+		var namespaceID *uint
+		if a.NamespaceID != 0 {
+			id := a.NamespaceID
+			namespaceID = &id
+		}
+		current, exists := st.userRoles[[2]string{a.User, a.Role}]
+		if a.Group != "" {
+			current, exists = st.groupRoles[[2]string{a.Group, a.Role}]
+			wantGroups[[2]string{a.Group, a.Role}] = true
+		} else {
+			wantUsers[[2]string{a.User, a.Role}] = true
+		}
+		if exists && sameNamespace(current, namespaceID) {
+			continue
+		}
+		a := a
+		change := RBACChange{Action: "create", Kind: "assignment", Name: a.Role + " to " + a.holder(), Detail: namespaceDetail(namespaceID), After: a}
+		if exists {
+			before := a
+			before.NamespaceID = namespaceValue(current)
+			change.Action, change.Detail, change.Before = "update", namespaceDetail(current)+" -> "+change.Detail, before
+		}
+		change.apply = func(tx storage.Storage, st *rbacState) error {
+			roleID := st.roles[a.Role].ID
+			if a.Group != "" {
+				return tx.RBAC().AssignGroupRole(&models.GroupRole{GroupID: st.groups[a.Group].ID, RoleID: roleID, NamespaceID: namespaceID})
+			}
+			return tx.RBAC().AssignUserRole(&models.UserRole{UserID: st.users[a.User].ID, RoleID: roleID, NamespaceID: namespaceID})
+		}
+		changes = append(changes, change)
+	}
+
+	for _, key := range sortedPairs(st.userRoles) {
+		if wantUsers[key] {
+			continue
+		}
+		changes = append(changes, RBACChange{Action: "remove", Kind: "assignment", Name: key[1] + " to user " + key[0],
+			Before: RBACAssignment{Role: key[1], User: key[0], NamespaceID: namespaceValue(st.userRoles[key])},
+			apply: func(tx storage.Storage, st *rbacState) error {
+				return tx.RBAC().UnassignUserRole(&models.UserRole{UserID: st.users[key[0]].ID, RoleID: st.roles[key[1]].ID})
+			}})
+	}
+	for _, key := range sortedPairs(st.groupRoles) {
+		if wantGroups[key] {
+			continue
+		}
+		changes = append(changes, RBACChange{Action: "remove", Kind: "assignment", Name: key[1] + " to group " + key[0],
+			Before: RBACAssignment{Role: key[1], Group: key[0], NamespaceID: namespaceValue(st.groupRoles[key])},
+			apply: func(tx storage.Storage, st *rbacState) error {
+				return tx.RBAC().UnassignGroupRole(&models.GroupRole{GroupID: st.groups[key[0]].ID, RoleID: st.roles[key[1]].ID})
+			}})
+	}
+	return changes
+}
+
+// planDenyRules makes the deny rules match rules
+func planDenyRules(st *rbacState, rules []RBACDeny) []RBACChange {
+	var changes []RBACChange
+	listed := make(map[string]bool)
+	for _, d := range rules {
+		listed[d.Name] = true
+		rule := models.DenyRule{Name: d.Name, Permission: d.Permission, Group: d.Group, ExceptRoles: strings.Join(d.Except, ",")}
+		if d.NamespaceID != 0 {
+			id := d.NamespaceID
+			rule.NamespaceID = &id
+		}
+		existing := st.denyRules[d.Name]
+		if existing != nil && existing.Permission == rule.Permission && sameNamespace(existing.NamespaceID, rule.NamespaceID) &&
+			existing.Group == rule.Group && existing.ExceptRoles == rule.ExceptRoles {
+			continue
+		}
+		var before any
+		action := "create"
+		if existing != nil {
+			action, before = "update", denySnapshot(existing)
+		}
+		who := "everyone"
+		if d.Group != "" {
+			who = "group " + d.Group
+		}
+		detail := fmt.Sprintf("%s for %s in %s", d.Permission, who, namespaceDetail(rule.NamespaceID))
+		if except := describeExcept(d.Except); except != "" {
+			detail += ", " + except
+		}
+		changes = append(changes, RBACChange{Action: action, Kind: "deny", Name: d.Name, Detail: detail, Before: before, After: d,
+			apply: func(tx storage.Storage, st *rbacState) error {
+				rule := rule
+				return tx.RBAC().SaveDenyRule(&rule)
+			}})
+	}
+	for _, name := range sortedKeys(st.denyRules) {
+		if listed[name] {
+			continue
+		}
+		changes = append(changes, RBACChange{Action: "remove", Kind: "deny", Name: name, Before: denySnapshot(st.denyRules[name]),
+			apply: func(tx storage.Storage, st *rbacState) error {
+				return tx.RBAC().DeleteDenyRule(st.denyRules[name].ID)
+			}})
+	}
+	return changes
+}
+
+// validateRBAC rejects duplicates and references to users, roles and
+// groups that neither exist nor are created by policy, or that policy
+// removes
+func validateRBAC(st *rbacState, policy *RBACPolicy) error {
+	users := make(map[string]bool)
+	for name := range st.users {
+		users[name] = true
+	}
+	listed := make(map[string]bool)
+	for _, u := range policy.Users {
+		if strings.TrimSpace(u.Username) == "" {
+			return fmt.Errorf("%w: a user has no username", ErrInvalidRBAC)
+		}
+		if u.Username != strings.TrimSpace(u.Username) {
+			return fmt.Errorf("%w: username %q has surrounding spaces", ErrInvalidRBAC, u.Username)
+		}
+		if listed[u.Username] {
+			return fmt.Errorf("%w: user %q is listed twice", ErrInvalidRBAC, u.Username)
+		}
+		listed[u.Username], users[u.Username] = true, true
+	}
+	roles, err := rbacNames("role", st.roles, policy.Roles, func(r RBACRole) string { return r.Name })
+	if err != nil {
+		return err
+	}
+	for _, r := range policy.Roles {
+		if existing := st.roles[r.Name]; existing != nil && existing.Builtin {
+			if r.Description != "" || r.Permissions != nil {
+				return fmt.Errorf("%w: built-in role %q cannot be changed; list it by name only", ErrInvalidRBAC, r.Name)
+			}
+			continue
+		}
+		if err := ValidatePermissions(r.Permissions); err != nil {
+			return fmt.Errorf("role %q: %w", r.Name, err)
+		}
+	}
+	for name, role := range st.roles {
+		if role.Builtin {
+			roles[name] = true
+		}
+	}
+	groups, err := rbacNames("group", st.groups, policy.Groups, func(g RBACGroup) string { return g.Name })
+	if err != nil {
+		return err
+	}
+
+	for _, g := range policy.Groups {
+		seen := make(map[string]bool)
+		for _, username := range g.Members {
+			if !users[username] {
+				return fmt.Errorf("%w: group %q: user %q does not exist", ErrInvalidRBAC, g.Name, username)
+			}
+			if seen[username] {
+				return fmt.Errorf("%w: group %q lists %q twice", ErrInvalidRBAC, g.Name, username)
+			}
+			seen[username] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for _, a := range policy.Assignments {
+		switch {
+		case a.Role == "":
+			return fmt.Errorf("%w: an assignment has no role", ErrInvalidRBAC)
+		case (a.User == "") == (a.Group == ""):
+			return fmt.Errorf("%w: assignment of role %q must name either a user or a group", ErrInvalidRBAC, a.Role)
+		case !roles[a.Role]:
+			return fmt.Errorf("%w: role %q does not exist", ErrInvalidRBAC, a.Role)
+		case a.User != "" && !users[a.User]:
+			return fmt.Errorf("%w: user %q does not exist", ErrInvalidRBAC, a.User)
+		case a.Group != "" && !groups[a.Group]:
+			return fmt.Errorf("%w: group %q does not exist", ErrInvalidRBAC, a.Group)
+		}
+		key := a.Role + " to " + a.holder()
+		if seen[key] {
+			return fmt.Errorf("%w: role %q is assigned to %s twice", ErrInvalidRBAC, a.Role, a.holder())
+		}
+		seen[key] = true
+	}
+	if _, err := rbacNames("deny rule", st.denyRules, policy.Deny, func(d RBACDeny) string { return d.Name }); err != nil {
+		return err
+	}
+	for _, d := range policy.Deny {
+		if err := ValidatePermissions([]string{d.Permission}); err != nil {
+			return fmt.Errorf("deny rule %q: %w", d.Name, err)
+		}
+		if d.Group != "" && !groups[d.Group] {
+			return fmt.Errorf("%w: deny rule %q: group %q does not exist", ErrInvalidRBAC, d.Name, d.Group)
+		}
+		for _, role := range d.Except {
+			if !roles[role] {
+				return fmt.Errorf("%w: deny rule %q: role %q does not exist", ErrInvalidRBAC, d.Name, role)
+			}
+		}
+	}
+	return nil
+}
+
+// rbacNames returns the names that exist once a section is applied: the
+// listed ones if the section is managed, else the existing ones
+func rbacNames[T, V any](kind string, existing map[string]*V, listed []T, name func(T) string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	if listed == nil {
+		for n := range existing {
+			names[n] = true
+		}
+		return names, nil
+	}
+	for _, item := range listed {
+		n := name(item)
+		if strings.TrimSpace(n) == "" {
+			return nil, fmt.Errorf("%w: a %s has no name", ErrInvalidRBAC, kind)
+		}
+		if names[n] {
+			return nil, fmt.Errorf("%w: %s %q is listed twice", ErrInvalidRBAC, kind, n)
+		}
+		names[n] = true
+	}
+	return names, nil
+}
+
+// rbacMember is the snapshot of a group member in RBACChange
+type rbacMember struct {
+	Group string `json:"group"`
+	User  string `json:"user"`
+}
+
+// userSnapshot, roleSnapshot, groupSnapshot and denySnapshot describe what
+// exists in the shape of an access file, for RBACChange.Before
+func userSnapshot(u *models.User) RBACUser {
+	return RBACUser{Username: u.Username, Email: u.Email, Deactivated: u.DeactivatedAt != nil}
+}
+
+func roleSnapshot(r *models.Role) RBACRole {
+	return RBACRole{Name: r.Name, Description: r.Description, Permissions: splitPermissions(r.Permissions)}
+}
+
+func groupSnapshot(g *models.Group) RBACGroup {
+	return RBACGroup{Name: g.Name, Description: g.Description}
+}
+
+func denySnapshot(d *models.DenyRule) RBACDeny {
+	rule := RBACDeny{Name: d.Name, Permission: d.Permission, NamespaceID: namespaceValue(d.NamespaceID), Group: d.Group}
+	if d.ExceptRoles != "" {
+		rule.Except = splitPermissions(d.ExceptRoles)
+	}
+	return rule
+}
+
+func describe(description string) string {
+	if description == "" {
+		return ""
+	}
+	return fmt.Sprintf("%q", description)
+}
+
+func sameNamespace(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// namespaceValue returns namespaceID as in an access file, 0 for all
+// namespaces
+func namespaceValue(namespaceID *uint) uint {
+	if namespaceID == nil {
+		return 0
+	}
+	return *namespaceID
+}
+
+func namespaceDetail(namespaceID *uint) string {
+	if namespaceID == nil {
+		return "all namespaces"
+	}
+	return fmt.Sprintf("namespace %d", *namespaceID)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPairs[V any](m map[[2]string]V) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
@@ -0,0 +1,437 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Audit event types for scheduled releases of secrets
+const (
+	EventSecretReleaseScheduled = "secret_release_scheduled"
+	EventSecretReleasePending   = "secret_release_pending"
+	EventSecretReleased         = "secret_released"
+	EventSecretReleaseCancelled = "secret_release_cancelled"
+)
+
+// Statuses of scheduled releases
+const (
+	ReleaseStatusPending   = "pending"
+	ReleaseStatusReleased  = "released"
+	ReleaseStatusCancelled = "cancelled"
+)
+
+const (
+	// DefaultReleaseNotice applies when secrets.releases does not set
+	// notify_days_before
+	DefaultReleaseNotice = 7 * 24 * time.Hour
+	// MaxInactivityDays bounds the inactivity period of a dead man's
+	// switch
+	MaxInactivityDays = 3650
+
+	// releaseGrantor is recorded as the grantor of the grants releases
+	// create
+	releaseGrantor = "scheduled release"
+	// cancelledBySystem cancels releases whose secret or recipient is gone
+	cancelledBySystem = "system"
+)
+
+// releasePolicy is the release sweep configured with SetReleases
+type releasePolicy struct {
+	interval time.Duration
+	notice   time.Duration
+	mailer   Mailer
+}
+
+// ScheduleReleaseRequest schedules a release: either at ReleaseAt, or once
+// the owner of the secret has been inactive for InactivityDays
+type ScheduleReleaseRequest struct {
+	Recipient      string     `json:"recipient"`
+	ReleaseAt      *time.Time `json:"release_at,omitempty"`
+	InactivityDays int        `json:"inactivity_days,omitempty"`
+	Note           string     `json:"note,omitempty"`
+}
+
+// ScheduledRelease is a release and, while it is pending, when it is due.
+// The due time of an inactivity release moves whenever the owner is active.
+type ScheduledRelease struct {
+	models.SecretRelease
+	DueAt *time.Time
+}
+
+// ReleaseReport counts what one release sweep did
+type ReleaseReport struct {
+	Warned   int `json:"warned"`
+	Released int `json:"released"`
+}
+
+// SetReleases enables the release sweep, which makes scheduled releases
+// happen and warns owners cfg.NotifyDaysBefore days ahead. mailer, which
+// may be nil, also emails the warnings and releases.
+func (c *SecretlyCore) SetReleases(cfg config.ReleasesConfig, mailer Mailer) {
+	if !cfg.Enabled {
+		c.releases = nil
+		return
+	}
+	p := &releasePolicy{interval: DefaultLifecycleInterval, notice: DefaultReleaseNotice, mailer: mailer}
+	if cfg.IntervalSeconds > 0 {
+		p.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	if cfg.NotifyDaysBefore > 0 {
+		p.notice = time.Duration(cfg.NotifyDaysBefore) * 24 * time.Hour
+	}
+	c.releases = p
+}
+
+// ReleaseInterval returns how often RunReleases sweeps, or 0 when releases
+// are not enabled
+func (c *SecretlyCore) ReleaseInterval() time.Duration {
+	if c.releases == nil {
+		return 0
+	}
+	return c.releases.interval
+}
+
+// ScheduleRelease makes a secret readable by req.Recipient later: at
+// req.ReleaseAt, or after its owner has neither logged in nor used a
+// session for req.InactivityDays days. The release is a read grant, with
+// the effect of any grant: users without one lose the access they
+// inherited. Scheduling takes write access to the secret.
+func (c *SecretlyCore) ScheduleRelease(ctx context.Context, id uint, req *ScheduleReleaseRequest) (*models.SecretRelease, error) {
+	if c.releases == nil {
+		return nil, fmt.Errorf("scheduled releases are not enabled")
+	}
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if IsFolder(secret) {
+		return nil, fmt.Errorf("%q is a folder", secret.Name)
+	}
+	if (req.ReleaseAt == nil) == (req.InactivityDays == 0) {
+		return nil, fmt.Errorf("set either release_at or inactivity_days")
+	}
+	if req.ReleaseAt != nil && !req.ReleaseAt.After(time.Now()) {
+		return nil, fmt.Errorf("release_at must be in the future")
+	}
+	if req.InactivityDays < 0 || req.InactivityDays > MaxInactivityDays {
+		return nil, fmt.Errorf("inactivity_days must be between 1 and %d", MaxInactivityDays)
+	}
+	if req.InactivityDays > 0 && SecretOwner(secret) == "" {
+		return nil, fmt.Errorf("secret %q has no owner whose inactivity could release it", secret.Name)
+	}
+	recipient, err := c.storage.Users().FindByUsername(req.Recipient)
+	if err != nil {
+		return nil, fmt.Errorf("recipient %q: %w", req.Recipient, err)
+	}
+	if recipient.DeactivatedAt != nil {
+		return nil, fmt.Errorf("recipient %q is deactivated", recipient.Username)
+	}
+	if recipient.Username == SecretOwner(secret) {
+		return nil, fmt.Errorf("%q already owns secret %q", recipient.Username, secret.Name)
+	}
+
+	release := &models.SecretRelease{
+		SecretNodeID:   secret.ID,
+		Recipient:      recipient.Username,
+		ReleaseAt:      req.ReleaseAt,
+		InactivityDays: req.InactivityDays,
+		Note:           req.Note,
+		Status:         ReleaseStatusPending,
+		CreatedBy:      c.actorName(ctx),
+		CreatedAt:      time.Now(),
+	}
+	if err := c.storage.Releases().Create(release); err != nil {
+		return nil, fmt.Errorf("failed to schedule release of secret %d: %w", id, err)
+	}
+	c.recordClientEvent(ctx, EventSecretReleaseScheduled, &secret.ID, fmt.Sprintf("Release %d of secret %q to %q scheduled %s",
+		release.ID, secret.Name, recipient.Username, releaseCondition(release)))
+	return release, nil
+}
+
+// ListReleases lists the releases of a secret, oldest first. Listing takes
+// write access, so recipients do not learn what will be released to them.
+func (c *SecretlyCore) ListReleases(ctx context.Context, id uint) ([]ScheduledRelease, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := c.storage.Releases().ListBySecret(secret.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases of secret %d: %w", id, err)
+	}
+	scheduled := make([]ScheduledRelease, 0, len(releases))
+	for i := range releases {
+		entry := ScheduledRelease{SecretRelease: releases[i]}
+		if releases[i].Status == ReleaseStatusPending {
+			due, err := c.releaseDue(&releases[i], secret)
+			if err != nil {
+				return nil, err
+			}
+			entry.DueAt = &due
+		}
+		scheduled = append(scheduled, entry)
+	}
+	return scheduled, nil
+}
+
+// CancelRelease stops a pending release. Cancelling takes write access to
+// the secret.
+func (c *SecretlyCore) CancelRelease(ctx context.Context, releaseID uint) (*models.SecretRelease, error) {
+	release, err := c.storage.Releases().Get(releaseID)
+	if err != nil {
+		return nil, fmt.Errorf("release %d: %w", releaseID, err)
+	}
+	secret, err := c.writableSecret(ctx, release.SecretNodeID)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != ReleaseStatusPending {
+		return nil, fmt.Errorf("release %d is %s: %w", release.ID, release.Status, ErrConflict)
+	}
+	by := c.actorName(ctx)
+	if err := c.cancelRelease(release, by); err != nil {
+		return nil, err
+	}
+	c.recordClientEvent(ctx, EventSecretReleaseCancelled, &secret.ID, fmt.Sprintf("Release %d of secret %q to %q cancelled by %q",
+		release.ID, secret.Name, release.Recipient, by))
+	return release, nil
+}
+
+// RunReleases sweeps the pending releases every interval until ctx is
+// cancelled
+func (c *SecretlyCore) RunReleases(ctx context.Context, interval time.Duration) {
+	ctx = WithSystemActor(ctx, "release sweep")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.SweepReleases(ctx)
+		if err != nil {
+			log.Printf("⚠️  Release sweep failed: %v", err)
+		} else if report.Warned+report.Released > 0 {
+			log.Printf("⏳ Scheduled releases: %d owners warned, %d secrets released", report.Warned, report.Released)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepReleases carries out the pending releases that are due and warns
+// the owners of those due within the notice period, once per approach: an
+// owner whose activity postpones an inactivity release is warned again
+// when it comes near again.
+func (c *SecretlyCore) SweepReleases(ctx context.Context) (*ReleaseReport, error) {
+	p := c.releases
+	if p == nil {
+		return nil, fmt.Errorf("scheduled releases are not enabled")
+	}
+	pending, err := c.storage.Releases().ListByStatus(ReleaseStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending releases: %w", err)
+	}
+	report := &ReleaseReport{}
+	now := time.Now()
+	for i := range pending {
+		release := &pending[i]
+		secret, err := c.storage.Secrets().GetByID(release.SecretNodeID)
+		if errors.Is(err, ErrNotFound) {
+			if err := c.cancelRelease(release, cancelledBySystem); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret %d: %w", release.SecretNodeID, err)
+		}
+		due, err := c.releaseDue(release, secret)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !now.Before(due):
+			released, err := c.release(ctx, release, secret)
+			if err != nil {
+				return nil, err
+			}
+			if released {
+				report.Released++
+			}
+		case release.WarnedAt == nil && due.Sub(now) <= p.notice:
+			release.WarnedAt = &now
+			if err := c.storage.Releases().Update(release); err != nil {
+				return nil, fmt.Errorf("failed to update release %d: %w", release.ID, err)
+			}
+			c.warnRelease(ctx, release, secret, due)
+			report.Warned++
+		case release.WarnedAt != nil && due.Sub(now) > p.notice:
+			release.WarnedAt = nil
+			if err := c.storage.Releases().Update(release); err != nil {
+				return nil, fmt.Errorf("failed to update release %d: %w", release.ID, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// release grants the recipient read access to secret and marks release
+// done. A recipient who already has a grant on the secret keeps it, so a
+// release never downgrades write access. It reports false when the
+// recipient was deactivated meanwhile, which cancels the release instead.
+func (c *SecretlyCore) release(ctx context.Context, release *models.SecretRelease, secret *models.SecretNode) (bool, error) {
+	recipient, err := c.storage.Users().FindByUsername(release.Recipient)
+	if err != nil || recipient.DeactivatedAt != nil {
+		if err := c.cancelRelease(release, cancelledBySystem); err != nil {
+			return false, err
+		}
+		c.recordEvent(ctx, EventSecretReleaseCancelled, &secret.ID, fmt.Sprintf("Release %d of secret %q cancelled: recipient %q is no longer active",
+			release.ID, secret.Name, release.Recipient))
+		return false, nil
+	}
+	grants, err := c.storage.Grants().ListByNode(secret.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check grants of secret %d: %w", secret.ID, err)
+	}
+	granted := false
+	for _, g := range grants {
+		if g.UserID == recipient.ID {
+			granted = true
+			break
+		}
+	}
+	if !granted {
+		grant := &models.SecretGrant{SecretNodeID: secret.ID, UserID: recipient.ID, Level: AccessRead, GrantedBy: releaseGrantor}
+		if err := c.storage.Grants().Set(grant); err != nil {
+			return false, fmt.Errorf("failed to grant access to %q: %w", secret.Name, err)
+		}
+		c.recordUserEvent(ctx, EventPermissionGranted, nil, &secret.ID, fmt.Sprintf("%q granted %s access to %q by %q",
+			recipient.Username, AccessRead, secret.Name, releaseGrantor))
+	}
+
+	now := time.Now()
+	release.Status = ReleaseStatusReleased
+	release.ReleasedAt = &now
+	if err := c.storage.Releases().Update(release); err != nil {
+		return false, fmt.Errorf("failed to update release %d: %w", release.ID, err)
+	}
+	c.recordUserEvent(ctx, EventSecretReleased, &recipient.ID, &secret.ID, fmt.Sprintf("Secret %q released to %q %s",
+		secret.Name, recipient.Username, releaseCondition(release)))
+
+	body := fmt.Sprintf("Secret %q has been released to you and you can now read it.\n", secret.Name)
+	if release.Note != "" {
+		body += fmt.Sprintf("\nNote from %s:\n%s\n", release.CreatedBy, release.Note)
+	}
+	c.mailRelease(recipient.Email, fmt.Sprintf("Secret %s was released to you", secret.Name), body, release)
+	if owner, err := c.storage.Users().FindByUsername(SecretOwner(secret)); err == nil {
+		c.mailRelease(owner.Email, fmt.Sprintf("Secret %s was released", secret.Name),
+			fmt.Sprintf("Your secret %q has been released to %q %s.\n", secret.Name, recipient.Username, releaseCondition(release)), release)
+	}
+	return true, nil
+}
+
+// warnRelease records the warning for the owner of secret that release is
+// near and emails it when a mailer is configured
+func (c *SecretlyCore) warnRelease(ctx context.Context, release *models.SecretRelease, secret *models.SecretNode, due time.Time) {
+	owner := SecretOwner(secret)
+	var ownerID *uint
+	var email string
+	if user, err := c.storage.Users().FindByUsername(owner); err == nil {
+		ownerID, email = &user.ID, user.Email
+	}
+	c.recordUserEvent(ctx, EventSecretReleasePending, ownerID, &secret.ID, fmt.Sprintf("Secret %q will be released to %q at %s",
+		secret.Name, release.Recipient, due.Format(time.RFC3339)))
+
+	body := fmt.Sprintf("Your secret %q will be released to %q on %s.\n\n", secret.Name, release.Recipient, due.Format(time.RFC1123))
+	if release.InactivityDays > 0 {
+		body += "Log in to postpone it. "
+	}
+	body += fmt.Sprintf("Cancel release %d if it should not happen.\n", release.ID)
+	c.mailRelease(email, fmt.Sprintf("Secret %s will be released", secret.Name), body, release)
+}
+
+func (c *SecretlyCore) mailRelease(to, subject, body string, release *models.SecretRelease) {
+	if c.releases == nil || c.releases.mailer == nil || to == "" {
+		return
+	}
+	if err := c.releases.mailer.Send(to, subject, body); err != nil {
+		log.Printf("⚠️  Failed to email about release %d to %q: %v", release.ID, to, err)
+	}
+}
+
+func (c *SecretlyCore) cancelRelease(release *models.SecretRelease, by string) error {
+	now := time.Now()
+	release.Status = ReleaseStatusCancelled
+	release.CancelledAt = &now
+	release.CancelledBy = by
+	if err := c.storage.Releases().Update(release); err != nil {
+		return fmt.Errorf("failed to cancel release %d: %w", release.ID, err)
+	}
+	return nil
+}
+
+// releaseDue returns when release happens as of now: its release time, or
+// its inactivity period after the owner's last activity since scheduling
+func (c *SecretlyCore) releaseDue(release *models.SecretRelease, secret *models.SecretNode) (time.Time, error) {
+	if release.ReleaseAt != nil {
+		return *release.ReleaseAt, nil
+	}
+	last, err := c.lastActive(SecretOwner(secret))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if last.Before(release.CreatedAt) {
+		last = release.CreatedAt
+	}
+	return last.Add(time.Duration(release.InactivityDays) * 24 * time.Hour), nil
+}
+
+// lastActive returns when the user named last logged in or used a
+// session; the zero time for unknown users
+func (c *SecretlyCore) lastActive(username string) (time.Time, error) {
+	var last time.Time
+	user, err := c.storage.Users().FindByUsername(username)
+	if err != nil {
+		return last, nil
+	}
+	logins, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+		Types:      []string{EventUserLogin},
+		UserID:     user.ID,
+		Descending: true,
+		Limit:      1,
+	})
+	if err != nil {
+		return last, fmt.Errorf("failed to check activity of %q: %w", username, err)
+	}
+	if len(logins) == 1 {
+		last = logins[0].EventTime
+	}
+	sessions, err := c.storage.Sessions().ListByUser(user.ID)
+	if err != nil {
+		return last, fmt.Errorf("failed to check activity of %q: %w", username, err)
+	}
+	for _, s := range sessions {
+		if s.ImpersonatorID != nil {
+			continue
+		}
+		if s.LastSeenAt != nil && s.LastSeenAt.After(last) {
+			last = *s.LastSeenAt
+		}
+	}
+	return last, nil
+}
+
+// releaseCondition describes when release happens, for audit descriptions
+func releaseCondition(release *models.SecretRelease) string {
+	if release.ReleaseAt != nil {
+		return "at " + release.ReleaseAt.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("after %d days of owner inactivity", release.InactivityDays)
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// EventSecretRenamed is recorded when a secret gets a new name or scope
+const EventSecretRenamed = "secret_renamed"
+
+// DefaultAliasTTL applies when secrets.names does not set alias_days
+const DefaultAliasTTL = 30 * 24 * time.Hour
+
+// MoveSecretRequest renames a secret, moves it to another namespace, zone
+// or environment, or into another folder. Empty and nil fields keep their
+// current value; a ParentID of 0 moves the node to the top level.
+type MoveSecretRequest struct {
+	Name          string
+	NamespaceID   *uint
+	ZoneID        *uint
+	EnvironmentID *uint
+	ParentID      *uint
+}
+
+// MoveSecret renames or re-parents a secret or folder. A renamed secret's
+// old name and scope are kept as an alias that resolves to it for
+// secrets.names.alias_days, so that clients have time to switch to the new
+// name. Moving to another scope without a ParentID puts the node at the top
+// level there; folders must be empty to change scope.
+func (c *SecretlyCore) MoveSecret(ctx context.Context, id uint, req *MoveSecretRequest) (*models.SecretNode, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCustody(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	moved := *secret
+	if name := NormalizeSecretName(req.Name); name != "" {
+		moved.Name = name
+	}
+	if req.NamespaceID != nil {
+		moved.NamespaceID = *req.NamespaceID
+	}
+	if req.ZoneID != nil {
+		moved.ZoneID = *req.ZoneID
+	}
+	if req.EnvironmentID != nil {
+		moved.EnvironmentID = *req.EnvironmentID
+	}
+	rescoped := moved.NamespaceID != secret.NamespaceID || moved.ZoneID != secret.ZoneID ||
+		moved.EnvironmentID != secret.EnvironmentID
+	renamed := rescoped || moved.Name != secret.Name
+	switch {
+	case req.ParentID != nil && *req.ParentID == 0:
+		moved.ParentID = nil
+	case req.ParentID != nil:
+		parentID := *req.ParentID
+		moved.ParentID = &parentID
+	case rescoped:
+		moved.ParentID = nil
+	}
+	reparented := !sameParent(moved.ParentID, secret.ParentID)
+	if !renamed && !reparented {
+		return secret, nil
+	}
+
+	if rescoped && IsFolder(secret) {
+		children, err := c.storage.Secrets().ListChildren(secret.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list folder %d: %w", secret.ID, err)
+		}
+		if len(children) > 0 {
+			return nil, fmt.Errorf("folder %q must be empty to move to another scope: %w", secret.Name, ErrConflict)
+		}
+	}
+	if err := c.checkParent(&moved); err != nil {
+		return nil, err
+	}
+	var alias *models.SecretAlias
+	if renamed {
+		if !IsFolder(&moved) {
+			if err := c.checkNamingPolicy(&moved); err != nil {
+				return nil, err
+			}
+			nameKey, err := c.secretNameIndex(secret.Name)
+			if err != nil {
+				return nil, err
+			}
+			alias = &models.SecretAlias{
+				SecretNodeID:  secret.ID,
+				NamespaceID:   secret.NamespaceID,
+				ZoneID:        secret.ZoneID,
+				EnvironmentID: secret.EnvironmentID,
+				Name:          secret.Name,
+				NameKey:       nameKey,
+				ExpiresAt:     time.Now().Add(c.aliasTTL),
+			}
+		}
+		if err := c.claimSecretName(&moved); err != nil {
+			return nil, err
+		}
+	}
+
+	description := fmt.Sprintf("Secret %q moved to %q", secretPath(secret), secretPath(&moved))
+	if reparented {
+		if moved.ParentID == nil {
+			description += ", to the top level"
+		} else {
+			description += fmt.Sprintf(", into folder %d", *moved.ParentID)
+		}
+	}
+	if alias != nil {
+		description += fmt.Sprintf("; the old name resolves until %s", alias.ExpiresAt.Format(time.RFC3339))
+	}
+	userID := c.clientUserID(ctx)
+	updatedAt, err := c.checkState(ctx, c.storage, secret.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var event *models.AuditEvent
+	err = c.storage.WithTransaction(func(tx storage.Storage) error {
+		if err := c.claimState(ctx, tx, secret.ID, updatedAt); err != nil {
+			return err
+		}
+		if err := tx.Secrets().Update(&moved); err != nil {
+			return fmt.Errorf("failed to move secret %d: %w", id, nameConflict(&moved, err))
+		}
+		if alias != nil {
+			if err := tx.Aliases().Create(alias); err != nil {
+				return fmt.Errorf("failed to store alias: %w", err)
+			}
+		}
+		event = c.auditEvent(ctx, EventSecretRenamed, userID, &secret.ID, description)
+		if err := tx.Audit().LogEvent(event); err != nil {
+			return fmt.Errorf("failed to record audit event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.publishEvent(event)
+	c.InvalidateSecretCache(secret.ID)
+	return &moved, nil
+}
+
+// ResolveSecretName finds the secret named name in filter's scope like
+// FindSecret. If there is none it falls back to the unexpired aliases of
+// moved secrets and returns the alias used, which callers should report to
+// the client as deprecated.
+func (c *SecretlyCore) ResolveSecretName(ctx context.Context, filter *ListSecretsFilter, name string) (*models.SecretNode, *models.SecretAlias, error) {
+	secret, err := c.FindSecret(ctx, filter, name)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return secret, nil, err
+	}
+
+	nameKey, aliasErr := c.secretNameIndex(name)
+	if aliasErr != nil {
+		return nil, nil, aliasErr
+	}
+	aliases, aliasErr := c.storage.Aliases().FindByNameKey(nameKey)
+	if aliasErr != nil {
+		return nil, nil, fmt.Errorf("failed to look up aliases: %w", aliasErr)
+	}
+	now := time.Now()
+	var found *models.SecretNode
+	var used *models.SecretAlias
+	for i := range aliases {
+		alias := &aliases[i]
+		if !now.Before(alias.ExpiresAt) || !aliasInScope(alias, filter) {
+			continue
+		}
+		if found != nil && found.ID == alias.SecretNodeID {
+			continue
+		}
+		target, err := c.GetSecret(ctx, alias.SecretNodeID)
+		if err != nil {
+			continue
+		}
+		if filter.Type != "" && target.Type != filter.Type {
+			continue
+		}
+		if found != nil {
+			return nil, nil, fmt.Errorf("secret name %q is ambiguous, it is a former name of several secrets: narrow the namespace, zone or environment", name)
+		}
+		found, used = target, alias
+	}
+	if found == nil {
+		return nil, nil, err
+	}
+	return found, used, nil
+}
+
+// aliasInScope reports whether alias lies in the scope set by filter
+func aliasInScope(alias *models.SecretAlias, filter *ListSecretsFilter) bool {
+	return (filter.NamespaceID == 0 || filter.NamespaceID == alias.NamespaceID) &&
+		(filter.ZoneID == 0 || filter.ZoneID == alias.ZoneID) &&
+		(filter.EnvironmentID == 0 || filter.EnvironmentID == alias.EnvironmentID)
+}
+
+// secretPath formats the scope and name of secret for messages
+func secretPath(secret *models.SecretNode) string {
+	return fmt.Sprintf("%d/%d/%d/%s", secret.NamespaceID, secret.ZoneID, secret.EnvironmentID, secret.Name)
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrReplica is returned for operations a read-only replica cannot carry
+// out because they change the database, e.g. reading a secret limited to a
+// number of reads
+var ErrReplica = errors.New("this server is a read-only replica")
+
+// SetReplica makes the core serve reads against a replicated, read-only
+// database: reads no longer write read counts or session times, and audit
+// events go to the server log instead of the database. primaryURL, which
+// may be empty, is where clients are sent for everything else.
+func (c *SecretlyCore) SetReplica(enabled bool, primaryURL string) {
+	c.replica = enabled
+	c.primaryURL = primaryURL
+}
+
+// Replica reports whether the core serves a read-only replica, and the URL
+// of its primary
+func (c *SecretlyCore) Replica() (bool, string) {
+	return c.replica, c.primaryURL
+}
+
+// replicaError explains that what was asked for needs the primary
+func (c *SecretlyCore) replicaError(what string) error {
+	if c.primaryURL == "" {
+		return fmt.Errorf("%w: %s on the primary", ErrReplica, what)
+	}
+	return fmt.Errorf("%w: %s on the primary at %s", ErrReplica, what, c.primaryURL)
+}
+
+// logReplicaEvent writes an audit event of a replica to the server log,
+// since the replica cannot store it
+func logReplicaEvent(eventType string, userID, secretID *uint, description string) {
+	line := fmt.Sprintf("📝 audit %s", eventType)
+	if userID != nil {
+		line += fmt.Sprintf(" user=%d", *userID)
+	}
+	if secretID != nil {
+		line += fmt.Sprintf(" secret=%d", *secretID)
+	}
+	log.Printf("%s: %s", line, description)
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Permission is an entry of the permission catalog roles are made of
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// permissionCatalog lists every permission a role may grant
+var permissionCatalog = []Permission{
+	{"secrets.list", "List secrets and read their metadata"},
+	{"secrets.read", "Read secret values"},
+	{"secrets.write", "Create and update secrets"},
+	{"secrets.delete", "Delete, archive and purge secrets"},
+	{"secrets.share", "Grant and revoke access to folders and secrets"},
+	{"secrets.checkout", "Check out break-glass secrets"},
+	{"audit.read", "Read the audit log and compliance reports"},
+	{"access.report", "Read access reports for secrets and users"},
+	{"approvals.approve", "Approve or reject protected operations"},
+	{"users.manage", "Create, deactivate, reactivate and impersonate users"},
+	{"rbac.manage", "Manage roles, groups and role assignments"},
+	{"clients.manage", "Register, rotate and revoke API clients"},
+	{"devices.manage", "Enroll and revoke machines"},
+	{"system.manage", "Change the server mode, back up and restore data, read diagnostics, and run GitOps, fault injection and every secret engine"},
+}
+
+// Permissions checked by HasPermission, which do not concern single
+// secrets
+const (
+	PermissionAuditRead     = "audit.read"
+	PermissionAccessReport  = "access.report"
+	PermissionUsersManage   = "users.manage"
+	PermissionRBACManage    = "rbac.manage"
+	PermissionDevicesManage = "devices.manage"
+	PermissionSystemManage  = "system.manage"
+)
+
+// adminPermissions make their holders administrators for the two-factor
+// and passkey policies and impersonation: each lets its holder change who
+// may do what
+var adminPermissions = []string{PermissionUsersManage, PermissionRBACManage, PermissionSystemManage}
+
+// RoleTemplate is a built-in role seeded by SeedRoleTemplates
+type RoleTemplate struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// roleTemplates are the built-in roles; admin gets the whole catalog
+var roleTemplates = []RoleTemplate{
+	{"admin", "Full access, including users, roles and system settings", nil},
+	{"operator", "Runs the service: manages secrets, machines, API clients and the server mode", []string{
+		"secrets.list", "secrets.read", "secrets.write", "secrets.delete", "secrets.checkout",
+		"clients.manage", "devices.manage", "system.manage",
+	}},
+	{"auditor", "Reviews access: reads the audit log and access reports, but no secret values", []string{
+		"secrets.list", "audit.read", "access.report",
+	}},
+	{"developer", "Reads and changes secrets and shares them with others", []string{
+		"secrets.list", "secrets.read", "secrets.write", "secrets.share",
+	}},
+	{"read-only", "Reads secrets", []string{"secrets.list", "secrets.read"}},
+}
+
+// RoleInfo is a role as reported to clients
+type RoleInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+// Permissions returns the permission catalog
+func Permissions() []Permission {
+	return slices.Clone(permissionCatalog)
+}
+
+// RoleTemplates returns the built-in roles
+func RoleTemplates() []RoleTemplate {
+	templates := slices.Clone(roleTemplates)
+	for i := range templates {
+		templates[i].Permissions = slices.Clone(templates[i].Permissions)
+		if templates[i].Permissions == nil {
+			for _, p := range permissionCatalog {
+				templates[i].Permissions = append(templates[i].Permissions, p.Name)
+			}
+		}
+	}
+	return templates
+}
+
+// ValidatePermissions rejects permissions that are not in the catalog or
+// are listed twice
+func ValidatePermissions(permissions []string) error {
+	seen := make(map[string]bool)
+	for _, name := range permissions {
+		if !slices.ContainsFunc(permissionCatalog, func(p Permission) bool { return p.Name == name }) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidRBAC, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: permission %q is listed twice", ErrInvalidRBAC, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// SeedRoleTemplates creates the built-in roles and brings their
+// permissions up to date with this release. Custom roles that happen to
+// share a template's name are left alone.
+func (c *SecretlyCore) SeedRoleTemplates() error {
+	roles, err := c.storage.RBAC().ListRoles()
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+	for _, tmpl := range RoleTemplates() {
+		permissions := strings.Join(tmpl.Permissions, ",")
+		i := slices.IndexFunc(roles, func(r models.Role) bool { return r.Name == tmpl.Name })
+		if i >= 0 && (!roles[i].Builtin || (roles[i].Description == tmpl.Description && roles[i].Permissions == permissions)) {
+			continue
+		}
+		role := &models.Role{Name: tmpl.Name, Description: tmpl.Description, Permissions: permissions, Builtin: true}
+		if err := c.storage.RBAC().SaveRole(role); err != nil {
+			return fmt.Errorf("failed to seed role %q: %w", tmpl.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListRoles returns every role with its permissions, by name
+func (c *SecretlyCore) ListRoles(ctx context.Context) ([]RoleInfo, error) {
+	roles, err := c.storage.RBAC().ListRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	infos := make([]RoleInfo, 0, len(roles))
+	for _, role := range roles {
+		infos = append(infos, RoleInfo{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: splitPermissions(role.Permissions),
+			Builtin:     role.Builtin,
+		})
+	}
+	return infos, nil
+}
+
+// splitPermissions parses models.Role.Permissions
+func splitPermissions(permissions string) []string {
+	if permissions == "" {
+		return []string{}
+	}
+	return strings.Split(permissions, ",")
+}
+
+// rolePermissions returns the permissions granted in namespaceID by the
+// roles of the user with userID, and whether the user holds any role at
+// all. Users without roles keep the default access to secrets they had
+// before roles existed; once they hold one, their roles are what they may
+// do.
+func (c *SecretlyCore) rolePermissions(userID, namespaceID uint) (map[string]bool, bool, error) {
+	held, err := c.heldRolesWhere(userID, func(*uint) bool { return true })
+	if err != nil || len(held) == 0 {
+		return nil, false, err
+	}
+	roles, err := c.storage.RBAC().ListRoles()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list roles: %w", err)
+	}
+	permissions := make(map[string]bool)
+	for _, h := range held {
+		if h.NamespaceID != nil && *h.NamespaceID != namespaceID {
+			continue
+		}
+		for _, role := range roles {
+			if role.Name != h.Role {
+				continue
+			}
+			for _, p := range splitPermissions(role.Permissions) {
+				permissions[p] = true
+			}
+		}
+	}
+	return permissions, true, nil
+}
+
+// HasPermission reports whether the actor in ctx holds permission from
+// the catalog, through a role assigned everywhere. System actors hold
+// every permission. Users without roles hold the secrets permissions
+// only, which grants and deny rules then narrow per secret.
+func (c *SecretlyCore) HasPermission(ctx context.Context, permission string) bool {
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return false
+	}
+	if auth.System {
+		return true
+	}
+	return auth.User != nil && c.userHasPermission(auth.User, permission)
+}
+
+// userHasPermission reports whether the roles of user grant permission
+// everywhere
+func (c *SecretlyCore) userHasPermission(user *models.User, permission string) bool {
+	permissions, restricted, err := c.rolePermissions(user.ID, 0)
+	if err != nil {
+		return false
+	}
+	if !restricted {
+		return strings.HasPrefix(permission, "secrets.")
+	}
+	return permissions[permission]
+}
+
+// isAdmin reports whether user holds one of adminPermissions
+func (c *SecretlyCore) isAdmin(user *models.User) bool {
+	permissions, _, err := c.rolePermissions(user.ID, 0)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(adminPermissions, func(p string) bool { return permissions[p] })
+}
+
+// requirePermission fails with ErrPermissionDenied unless the actor in ctx
+// holds permission; what describes the operation for the error
+func (c *SecretlyCore) requirePermission(ctx context.Context, permission, what string) error {
+	if _, err := c.actor(ctx); err != nil {
+		return err
+	}
+	if !c.HasPermission(ctx, permission) {
+		return fmt.Errorf("%w: %s requires the %s permission", ErrPermissionDenied, what, permission)
+	}
+	return nil
+}
+
+// checkRolePermission checks that the roles of the actor in ctx grant
+// permission in the namespace of secret. System actors and sessions
+// without a user are not subject to roles.
+func (c *SecretlyCore) checkRolePermission(ctx context.Context, secret *models.SecretNode, permission string) error {
+	session, err := c.actorSession(ctx)
+	if err != nil || session == nil || session.UserID == 0 {
+		return err
+	}
+	permissions, restricted, err := c.rolePermissions(session.UserID, secret.NamespaceID)
+	if err != nil {
+		return err
+	}
+	if restricted && !permissions[permission] {
+		secretID := secret.ID
+		c.recordUserEvent(ctx, EventAccessDenied, &session.UserID, &secretID, fmt.Sprintf("Roles of user %d do not grant %s on secret %q",
+			session.UserID, permission, secret.Name))
+		return fmt.Errorf("%w: no role grants %s", ErrPermissionDenied, permission)
+	}
+	return nil
+}
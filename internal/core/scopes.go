@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// ListNamespaces returns all namespaces ordered by ID
+func (c *SecretlyCore) ListNamespaces(ctx context.Context) ([]models.Namespace, error) {
+	namespaces, err := c.storage.Scopes().ListNamespaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	return namespaces, nil
+}
+
+// ListZones returns all zones ordered by ID
+func (c *SecretlyCore) ListZones(ctx context.Context) ([]models.Zone, error) {
+	zones, err := c.storage.Scopes().ListZones()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones: %w", err)
+	}
+	return zones, nil
+}
+
+// ListEnvironments returns all environments ordered by ID
+func (c *SecretlyCore) ListEnvironments(ctx context.Context) ([]models.Environment, error) {
+	environments, err := c.storage.Scopes().ListEnvironments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	return environments, nil
+}
+
+// ValidateScope checks that the non-zero namespace, zone and environment IDs
+// exist
+func (c *SecretlyCore) ValidateScope(ctx context.Context, namespaceID, zoneID, environmentID uint) error {
+	if namespaceID != 0 {
+		namespaces, err := c.ListNamespaces(ctx)
+		if err != nil {
+			return err
+		}
+		if !containsID(namespaces, namespaceID, func(n models.Namespace) uint { return n.ID }) {
+			return fmt.Errorf("namespace %d does not exist", namespaceID)
+		}
+	}
+	if zoneID != 0 {
+		zones, err := c.ListZones(ctx)
+		if err != nil {
+			return err
+		}
+		if !containsID(zones, zoneID, func(z models.Zone) uint { return z.ID }) {
+			return fmt.Errorf("zone %d does not exist", zoneID)
+		}
+	}
+	if environmentID != 0 {
+		environments, err := c.ListEnvironments(ctx)
+		if err != nil {
+			return err
+		}
+		if !containsID(environments, environmentID, func(e models.Environment) uint { return e.ID }) {
+			return fmt.Errorf("environment %d does not exist", environmentID)
+		}
+	}
+	return nil
+}
+
+func containsID[T any](items []T, id uint, idOf func(T) uint) bool {
+	for _, item := range items {
+		if idOf(item) == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,750 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"gorm.io/datatypes"
+)
+
+// maxVersionAttempts bounds the attempts of an update to number its new
+// version
+const maxVersionAttempts = 32
+
+// CreateSecretRequest contains the data needed to create a secret
+type CreateSecretRequest struct {
+	Name          string
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	Value         []byte
+	MaxReads      *int
+	Expiration    *time.Time
+	CreatedBy     string
+	// Canary marks a honeypot: every read raises an alert. With Decoy set
+	// and no Value, the value is generated by GenerateDecoy.
+	Canary bool
+	Decoy  string
+	// Metadata is stored as JSON alongside the secret, e.g. tags kept by
+	// importers
+	Metadata map[string]interface{}
+	// ParentID is the folder to create the secret in, nil for the top level
+	ParentID *uint
+}
+
+// UpdateSecretRequest contains the new value and limits for a secret.
+// Nil fields are left unchanged.
+type UpdateSecretRequest struct {
+	Value      []byte
+	MaxReads   *int
+	Expiration *time.Time
+	Metadata   map[string]interface{}
+	Canary     *bool
+}
+
+// ListSecretsFilter narrows and paginates ListSecrets results.
+// Zero values mean "no filter"; PageSize 0 returns all results.
+type ListSecretsFilter struct {
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	Name          string // matched like names are for uniqueness; not supported by ListSecretsAfter
+	Prefix        string // name prefix, e.g. "app/"; not supported by ListSecretsAfter
+	Folders       bool   // list folders instead of secrets
+	// Sort orders ListSecrets by one of repository.SecretSorts, descending
+	// with a leading "-", e.g. "-updated_at"; not supported by
+	// ListSecretsAfter
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// CreateSecret stores a new secret with its first version
+func (c *SecretlyCore) CreateSecret(ctx context.Context, req *CreateSecretRequest) (*models.SecretNode, error) {
+	if err := validateCreateRequest(req); err != nil {
+		return nil, err
+	}
+	if req.Decoy != "" {
+		if !req.Canary || len(req.Value) > 0 {
+			return nil, fmt.Errorf("a decoy value is only generated for canaries without a value")
+		}
+		decoy, err := GenerateDecoy(req.Decoy)
+		if err != nil {
+			return nil, err
+		}
+		req.Value = decoy
+	}
+	if len(req.Value) == 0 {
+		return nil, fmt.Errorf("secret value is required")
+	}
+	if err := validateStructured(req.Type, req.Value); err != nil {
+		return nil, err
+	}
+
+	contentHash, err := c.contentHash(req.Value)
+	if err != nil {
+		return nil, err
+	}
+	payload, compression := c.compress(req.Value)
+	encrypted, metadata, err := c.encrypt(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	secret, err := c.newSecretNode(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	version := &models.SecretVersion{
+		VersionNumber:      1,
+		EncryptedValue:     encrypted,
+		EncryptionMetadata: datatypes.JSON(metadata),
+		Compression:        compression,
+		ContentHash:        contentHash,
+	}
+	description := fmt.Sprintf("Secret %q created", secret.Name)
+	if secret.Canary {
+		description += " as a canary"
+	}
+	userID := c.clientUserID(ctx)
+
+	// The secret, its first version and the audit event are stored together
+	// so that a failure cannot leave a secret without a value or history
+	var event *models.AuditEvent
+	err = c.storage.WithTransaction(func(tx storage.Storage) error {
+		if err := tx.Secrets().Create(secret); err != nil {
+			return fmt.Errorf("failed to create secret: %w", nameConflict(secret, err))
+		}
+		version.SecretNodeID = secret.ID
+		if err := tx.Secrets().CreateVersion(version); err != nil {
+			return fmt.Errorf("failed to store secret version: %w", err)
+		}
+		event = c.auditEvent(ctx, EventSecretCreated, userID, &secret.ID, description)
+		if err := tx.Audit().LogEvent(event); err != nil {
+			return fmt.Errorf("failed to record audit event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.publishEvent(event)
+	return secret, nil
+}
+
+// validateCreateRequest normalizes and checks everything but the value
+func validateCreateRequest(req *CreateSecretRequest) error {
+	req.Name = NormalizeSecretName(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	if req.MaxReads != nil && *req.MaxReads <= 0 {
+		return fmt.Errorf("max reads must be positive")
+	}
+	if req.Expiration != nil && req.Expiration.Before(time.Now()) {
+		return fmt.Errorf("expiration must be in the future")
+	}
+	return nil
+}
+
+// newSecretNode builds the secret for req. The user of the session in ctx
+// becomes the owner; without a session, a CreatedBy naming a user does, as
+// for embedding applications. Tools such as the CLI are recorded in
+// CreatedBy only, which is for display and never grants access.
+func (c *SecretlyCore) newSecretNode(ctx context.Context, req *CreateSecretRequest) (*models.SecretNode, error) {
+	metadata, err := encodeMetadata(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	owner := ClientInfoFrom(ctx).Username
+	if req.CreatedBy == "" {
+		req.CreatedBy = owner
+	}
+	if owner == "" {
+		owner = req.CreatedBy
+	}
+	if owner != "" {
+		if _, err := c.storage.Users().FindByUsername(owner); err != nil {
+			owner = ""
+		}
+	}
+	secret := &models.SecretNode{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		IsSecret:      true,
+		Type:          req.Type,
+		MaxReads:      req.MaxReads,
+		Expiration:    req.Expiration,
+		Status:        SecretStatusActive,
+		CreatedBy:     req.CreatedBy,
+		Owner:         owner,
+		Metadata:      metadata,
+		Canary:        req.Canary,
+		ParentID:      req.ParentID,
+	}
+	if err := c.AuthorizeSecret(ctx, secret, true); err != nil {
+		return nil, err
+	}
+	if err := c.checkParent(secret); err != nil {
+		return nil, err
+	}
+	if err := c.checkNamingPolicy(secret); err != nil {
+		return nil, err
+	}
+	if err := c.claimSecretName(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func encodeMetadata(metadata map[string]interface{}) (datatypes.JSON, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return datatypes.JSON(data), nil
+}
+
+// GetSecret returns secret metadata without its value, if the actor in ctx
+// may read it
+func (c *SecretlyCore) GetSecret(ctx context.Context, id uint) (*models.SecretNode, error) {
+	secret, err := c.loadSecret(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AuthorizeSecret(ctx, secret, false); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// loadSecret returns a secret without checking the actor, for operations
+// authorized already
+func (c *SecretlyCore) loadSecret(id uint) (*models.SecretNode, error) {
+	secret, err := c.storage.Secrets().GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %d: %w", id, err)
+	}
+	return secret, nil
+}
+
+// writableSecret returns a secret the actor in ctx may modify
+func (c *SecretlyCore) writableSecret(ctx context.Context, id uint) (*models.SecretNode, error) {
+	secret, err := c.GetSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AuthorizeSecret(ctx, secret, true); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// ListSecrets returns the secrets matching the filter that the actor in ctx
+// may read, and the total number of them
+func (c *SecretlyCore) ListSecrets(ctx context.Context, filter *ListSecretsFilter) ([]models.SecretNode, int64, error) {
+	scoped := *filter
+	if err := c.ScopeFilter(ctx, &scoped); err != nil {
+		return nil, 0, err
+	}
+	filter = &scoped
+	query, err := filter.query()
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter.Name != "" {
+		if query.NameKey, err = c.secretNameIndex(filter.Name); err != nil {
+			return nil, 0, err
+		}
+	}
+	exact, err := c.readableInSQL(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if exact {
+		total, err := c.storage.Secrets().Count(*query)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count secrets: %w", err)
+		}
+		if filter.PageSize > 0 {
+			query.Offset = (max(filter.Page, 1) - 1) * filter.PageSize
+			query.Limit = filter.PageSize
+		}
+		secrets, err := c.storage.Secrets().Query(*query)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		return secrets, total, nil
+	}
+
+	// Inherited grants, deny rules and network policies are checked here,
+	// on the rows the database already filtered and sorted
+	all, err := c.storage.Secrets().Query(*query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	matched := c.readableSecrets(ctx, all)
+
+	start, end := paginate(len(matched), filter.Page, filter.PageSize)
+	return matched[start:end], int64(len(matched)), nil
+}
+
+// query translates the filter, without pagination, for the repository
+func (f *ListSecretsFilter) query() (*repository.SecretQuery, error) {
+	isSecret := !f.Folders
+	q := &repository.SecretQuery{
+		NamespaceID:   f.NamespaceID,
+		ZoneID:        f.ZoneID,
+		EnvironmentID: f.EnvironmentID,
+		Type:          f.Type,
+		Name:          f.Name,
+		Prefix:        f.Prefix,
+		IsSecret:      &isSecret,
+	}
+	if f.Sort != "" {
+		q.Sort, q.Descending = strings.CutPrefix(f.Sort, "-")
+		if !slices.Contains(repository.SecretSorts, q.Sort) {
+			return nil, fmt.Errorf("%w %q: use one of %s, with - for descending order", ErrInvalidSort, f.Sort, strings.Join(repository.SecretSorts, ", "))
+		}
+	}
+	return q, nil
+}
+
+// readableInSQL narrows q to the secrets the actor in ctx may read, and
+// reports whether the database can tell exactly: always for system
+// actors, and for users without roles as long as no folder grants can be
+// inherited, no deny rule restricts reading and no network policy applies. Otherwise
+// q only leaves out secrets whose own grants exclude the user.
+func (c *SecretlyCore) readableInSQL(ctx context.Context, q *repository.SecretQuery) (bool, error) {
+	session, err := c.actorSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	exact := c.network == nil || len(c.network.namespaces) == 0
+	if session == nil || session.UserID == 0 {
+		return exact, nil
+	}
+
+	user, err := c.storage.Users().FindByID(session.UserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user %d: %w", session.UserID, err)
+	}
+	q.ReadableBy = &repository.SecretReader{UserID: user.ID, Username: user.Username}
+	if !exact {
+		return false, nil
+	}
+	if _, restricted, err := c.rolePermissions(user.ID, 0); err != nil || restricted {
+		return false, err
+	}
+	inherited, err := c.storage.Grants().HasFolderGrants()
+	if err != nil {
+		return false, fmt.Errorf("failed to check folder grants: %w", err)
+	}
+	if inherited {
+		return false, nil
+	}
+	rules, err := c.storage.RBAC().ListDenyRules()
+	if err != nil {
+		return false, fmt.Errorf("failed to list deny rules: %w", err)
+	}
+	denies := slices.ContainsFunc(rules, func(rule models.DenyRule) bool { return rule.Permission == PermissionSecretsRead })
+	return !denies, nil
+}
+
+// matches reports whether s passes the filter, ignoring pagination
+func (f *ListSecretsFilter) matches(s *models.SecretNode) bool {
+	switch {
+	case f.NamespaceID != 0 && s.NamespaceID != f.NamespaceID,
+		f.ZoneID != 0 && s.ZoneID != f.ZoneID,
+		f.EnvironmentID != 0 && s.EnvironmentID != f.EnvironmentID,
+		f.Type != "" && s.Type != f.Type,
+		f.Name != "" && s.Name != f.Name,
+		!strings.HasPrefix(s.Name, f.Prefix),
+		s.IsSecret == f.Folders:
+		return false
+	}
+	return true
+}
+
+// GetSecretValue returns the decrypted value of the latest version,
+// enforcing expiration and max-reads limits. When the value cache is enabled,
+// a cached value of the latest version skips decryption, after the same
+// checks as any other read; unlimited secrets served from it do not count
+// the read in storage, while read-limited secrets always do.
+func (c *SecretlyCore) GetSecretValue(ctx context.Context, id uint) ([]byte, error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		if entry, ok := c.cache.get(id); ok {
+			cached = entry
+		}
+	}
+
+	secret, version, err := c.readableVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.versionID != version.ID {
+		cached = nil
+	}
+	if cached != nil && !cached.limited {
+		c.recordClientEvent(ctx, EventSecretRead, &id, fmt.Sprintf("Secret %q version %d read (cached)", secret.Name, version.VersionNumber))
+		return cached.copyValue(), nil
+	}
+
+	var value []byte
+	if cached != nil {
+		value = cached.copyValue()
+	} else {
+		var buf bytes.Buffer
+		if _, err := c.writeVersionValue(ctx, version, &buf); err != nil {
+			return nil, err
+		}
+		value = buf.Bytes()
+	}
+
+	last, err := c.consumeRead(secret, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Streamed values are large and not worth keeping in memory. Canaries
+	// are not cached so that every read reaches tripCanary, break-glass
+	// secrets so that every read reaches checkCustody.
+	if c.cache != nil && version.ChunkCount == 0 && !secret.Canary && !c.RequiresCheckout(secret) {
+		c.cache.put(secret, version.ID, value)
+	}
+
+	c.recordClientEvent(ctx, EventSecretRead, &secret.ID, fmt.Sprintf("Secret %q version %d read", secret.Name, version.VersionNumber))
+	if secret.Canary {
+		c.tripCanary(ctx, secret, version, "value read")
+	}
+	if last {
+		c.burnSecret(ctx, secret)
+	}
+	return value, nil
+}
+
+// SetBurnAfterRead makes secrets with max-reads limits be deleted once
+// their last read is used, instead of staying behind as expired
+func (c *SecretlyCore) SetBurnAfterRead(enabled bool) {
+	c.burn = enabled
+}
+
+// UpdateSecret stores a new version of the secret value and updates its
+// limits. Break-glass secrets return ErrCheckoutRequired unless the caller
+// holds their check-out.
+func (c *SecretlyCore) UpdateSecret(ctx context.Context, id uint, req *UpdateSecretRequest) (*models.SecretNode, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCustody(ctx, secret); err != nil {
+		return nil, err
+	}
+	return c.updateSecret(ctx, id, req)
+}
+
+func (c *SecretlyCore) updateSecret(ctx context.Context, id uint, req *UpdateSecretRequest) (*models.SecretNode, error) {
+	secret, err := c.loadSecret(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata datatypes.JSON
+	if req.Metadata != nil {
+		if metadata, err = encodeMetadata(req.Metadata); err != nil {
+			return nil, err
+		}
+		// Dropping the protecting tag would sidestep the two-person rule
+		retagged := *secret
+		retagged.Metadata = metadata
+		if c.RequiresApproval(secret) && !c.RequiresApproval(&retagged) {
+			return nil, fmt.Errorf("secret %q is protected, its tags cannot be removed: %w", secret.Name, ErrApprovalRequired)
+		}
+	}
+
+	unchanged := false
+	var version *models.SecretVersion
+	var latestNumber int
+	if len(req.Value) > 0 {
+		if err := validateStructured(secret.Type, req.Value); err != nil {
+			return nil, err
+		}
+		// A placeholder gets its first version
+		latest := &models.SecretVersion{}
+		if secret.Status != SecretStatusPlaceholder {
+			if latest, err = c.latestVersion(id); err != nil {
+				return nil, err
+			}
+		}
+		contentHash, err := c.contentHash(req.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Re-submitting the current value does not create a new version.
+		// Read-limited secrets always get one so that their reads are reset.
+		unchanged = secret.MaxReads == nil && req.MaxReads == nil && sameContent(latest.ContentHash, contentHash)
+		if !unchanged {
+			payload, compression := c.compress(req.Value)
+			encrypted, metadata, err := c.encrypt(payload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+			}
+
+			version = &models.SecretVersion{
+				SecretNodeID:       secret.ID,
+				EncryptedValue:     encrypted,
+				EncryptionMetadata: datatypes.JSON(metadata),
+				Compression:        compression,
+				ContentHash:        contentHash,
+			}
+			latestNumber = latest.VersionNumber
+			if secret.Status == SecretStatusPlaceholder {
+				secret.Status = SecretStatusActive
+			}
+		}
+	}
+
+	if req.MaxReads != nil {
+		secret.MaxReads = req.MaxReads
+	}
+	if req.Expiration != nil {
+		secret.Expiration = req.Expiration
+		if secret.Expiration.After(time.Now()) {
+			secret.Status = SecretStatusActive
+		}
+	}
+	if req.Metadata != nil {
+		secret.Metadata = metadata
+	}
+	if req.Canary != nil {
+		secret.Canary = *req.Canary
+	}
+	err = c.changeSecret(ctx, id, func(s storage.Storage) error {
+		if version != nil {
+			if err := c.storeNextVersion(ctx, s, version, latestNumber); err != nil {
+				return fmt.Errorf("failed to store secret version: %w", err)
+			}
+		}
+		if err := s.Secrets().Update(secret); err != nil {
+			return fmt.Errorf("failed to update secret: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.InvalidateSecretCache(id)
+
+	description := fmt.Sprintf("Secret %q updated", secret.Name)
+	if unchanged {
+		description += " (value unchanged, no new version)"
+	}
+	if req.Canary != nil {
+		description += fmt.Sprintf(" (canary %t)", *req.Canary)
+	}
+	c.recordClientEvent(ctx, EventSecretUpdated, &secret.ID, description)
+	return secret, nil
+}
+
+// DeleteSecret removes a secret and all its versions. Protected secrets
+// return ErrApprovalRequired; see RequestOperation.
+func (c *SecretlyCore) DeleteSecret(ctx context.Context, id uint) error {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.checkRolePermission(ctx, secret, PermissionSecretsDelete); err != nil {
+		return err
+	}
+	if err := c.checkDenied(ctx, secret, PermissionSecretsDelete); err != nil {
+		return err
+	}
+	if c.RequiresApproval(secret) {
+		return fmt.Errorf("secret %q is protected: %w", secret.Name, ErrApprovalRequired)
+	}
+	if err := c.checkCustody(ctx, secret); err != nil {
+		return err
+	}
+	return c.deleteSecret(ctx, id)
+}
+
+func (c *SecretlyCore) deleteSecret(ctx context.Context, id uint) error {
+	secret, err := c.loadSecret(id)
+	if err != nil {
+		return err
+	}
+	if IsFolder(secret) {
+		children, err := c.storage.Secrets().ListChildren(id)
+		if err != nil {
+			return fmt.Errorf("failed to list folder %d: %w", id, err)
+		}
+		if len(children) > 0 {
+			return fmt.Errorf("folder %q is not empty: %w", secret.Name, ErrConflict)
+		}
+	}
+	err = c.changeSecret(ctx, id, func(s storage.Storage) error {
+		if err := s.Secrets().Delete(id); err != nil {
+			return fmt.Errorf("failed to delete secret %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.InvalidateSecretCache(id)
+
+	c.recordClientEvent(ctx, EventSecretDeleted, &secret.ID, fmt.Sprintf("Secret %q deleted", secret.Name))
+	return nil
+}
+
+// GetSecretVersions returns all versions of a secret ordered by version number
+func (c *SecretlyCore) GetSecretVersions(ctx context.Context, id uint) ([]models.SecretVersion, error) {
+	if _, err := c.GetSecret(ctx, id); err != nil {
+		return nil, err
+	}
+	versions, err := c.storage.Secrets().GetVersions(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions for secret %d: %w", id, err)
+	}
+	return versions, nil
+}
+
+// readableVersion returns the secret and its latest version after enforcing
+// expiration, check-out and max-reads limits
+func (c *SecretlyCore) readableVersion(ctx context.Context, id uint) (*models.SecretNode, *models.SecretVersion, error) {
+	secret, err := c.GetSecret(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Listing roles such as auditor see secrets but not their values
+	if err := c.checkRolePermission(ctx, secret, PermissionSecretsRead); err != nil {
+		return nil, nil, err
+	}
+	if secret.Expiration != nil && secret.Expiration.Before(time.Now()) {
+		return nil, nil, fmt.Errorf("secret %d has %w", id, ErrExpired)
+	}
+	if secret.Status == SecretStatusArchived {
+		return nil, nil, fmt.Errorf("secret %d: %w; unarchive it to use it again", id, ErrArchived)
+	}
+	if secret.Status == SecretStatusPlaceholder {
+		return nil, nil, fmt.Errorf("secret %d: %w", id, ErrPlaceholder)
+	}
+	if err := c.checkCustody(ctx, secret); err != nil {
+		return nil, nil, err
+	}
+
+	version, err := c.latestVersion(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret.MaxReads != nil && version.ReadCount >= *secret.MaxReads {
+		c.InvalidateSecretCache(id)
+		return nil, nil, fmt.Errorf("secret %d has %w: it reached its maximum number of reads", id, ErrExpired)
+	}
+	c.recordBypass(ctx, secret)
+	return secret, version, nil
+}
+
+// consumeRead counts one read of version in storage, atomically with the
+// max-reads check so concurrent readers cannot exceed the limit. It reports
+// whether the read was the last one the secret allows.
+func (c *SecretlyCore) consumeRead(secret *models.SecretNode, version *models.SecretVersion) (bool, error) {
+	// A replica cannot count reads, so read-limited secrets are only read
+	// on the primary
+	if c.replica {
+		if secret.MaxReads != nil {
+			return false, c.replicaError(fmt.Sprintf("secret %d is limited to %d reads and can only be read", secret.ID, *secret.MaxReads))
+		}
+		return false, nil
+	}
+	count, err := c.storage.Secrets().ConsumeRead(version.ID, secret.MaxReads)
+	if err != nil {
+		return false, fmt.Errorf("failed to update read count: %w", err)
+	}
+	if count == 0 {
+		c.InvalidateSecretCache(secret.ID)
+		return false, fmt.Errorf("secret %d has %w: it reached its maximum number of reads", secret.ID, ErrExpired)
+	}
+	version.ReadCount = count
+	return secret.MaxReads != nil && count >= *secret.MaxReads, nil
+}
+
+// burnSecret deletes a secret whose last read was just used, if
+// secrets.burn_after_read is set. Protected secrets are not deleted;
+// their deletion is requested for a second administrator to approve. The
+// read has already succeeded, so failures are only logged.
+func (c *SecretlyCore) burnSecret(ctx context.Context, secret *models.SecretNode) {
+	if !c.burn {
+		return
+	}
+	if c.RequiresApproval(secret) {
+		req := &models.PendingOperation{Kind: OperationBurnSecret, SecretNodeID: secret.ID, RequestedBy: c.actorName(ctx)}
+		if _, err := c.createOperation(ctx, secret, req); err != nil {
+			log.Printf("⚠️  Failed to request burning secret %d after its last read: %v", secret.ID, err)
+		}
+		return
+	}
+	if err := c.storage.Secrets().Delete(secret.ID); err != nil {
+		log.Printf("⚠️  Failed to burn secret %d after its last read: %v", secret.ID, err)
+		return
+	}
+	c.InvalidateSecretCache(secret.ID)
+	c.recordClientEvent(ctx, EventSecretDeleted, &secret.ID, fmt.Sprintf("Secret %q burned after its last read", secret.Name))
+}
+
+// storeNextVersion stores version in s with the number after latest.
+// Version numbers are unique per secret: when a concurrent update took the
+// number first, the version gets the one after the new latest version
+// instead. Every conflict means another update was stored, so the retries
+// only run out under more concurrent updates than maxVersionAttempts.
+// Updates based on a precondition in ctx are not retried; the conflict
+// means the precondition no longer holds.
+func (c *SecretlyCore) storeNextVersion(ctx context.Context, s storage.Storage, version *models.SecretVersion, latest int) error {
+	for attempt := 1; ; attempt++ {
+		version.ID = 0
+		version.VersionNumber = latest + 1
+		err := s.Secrets().CreateVersion(version)
+		if errors.Is(err, ErrConflict) && precondition(ctx, version.SecretNodeID) != nil {
+			return fmt.Errorf("version %d was stored concurrently: %w", version.VersionNumber, ErrPreconditionFailed)
+		}
+		if !errors.Is(err, ErrConflict) || attempt == maxVersionAttempts {
+			return err
+		}
+		versions, err := s.Secrets().GetVersions(version.SecretNodeID)
+		if err != nil {
+			return fmt.Errorf("failed to get versions for secret %d: %w", version.SecretNodeID, err)
+		}
+		latest = versions[len(versions)-1].VersionNumber
+	}
+}
+
+func (c *SecretlyCore) latestVersion(secretID uint) (*models.SecretVersion, error) {
+	versions, err := c.storage.Secrets().GetVersions(secretID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions for secret %d: %w", secretID, err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("secret %d has no versions", secretID)
+	}
+	return &versions[len(versions)-1], nil
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Audit event types for service accounts
+const (
+	EventServiceAccountCreated  = "service_account_created"
+	EventServiceAccountDisabled = "service_account_disabled"
+	EventServiceAccountEnabled  = "service_account_enabled"
+	EventServiceTokenIssued     = "service_token_issued"
+	EventServiceTokenRevoked    = "service_token_revoked"
+)
+
+// ActorServiceAccount is the actor kind of audit events caused by service
+// account tokens
+const ActorServiceAccount = "service_account"
+
+const (
+	// DefaultServiceTokenTTL applies when a token's lifetime is not chosen
+	DefaultServiceTokenTTL = 90 * 24 * time.Hour
+	// MaxServiceTokenTTL bounds how long a service account token lasts
+	MaxServiceTokenTTL = 365 * 24 * time.Hour
+
+	// serviceScopePrefix starts the scope of service account sessions; the
+	// account name follows
+	serviceScopePrefix = "service:"
+)
+
+// CreateServiceAccountRequest describes a new service account. Owner is
+// the username of the person accountable for it.
+type CreateServiceAccountRequest struct {
+	Name        string
+	Description string
+	Owner       string
+}
+
+// ServiceAccount is a service account as reported to clients
+type ServiceAccount struct {
+	UserID      uint       `json:"user_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Owner       string     `json:"owner"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+	// Tokens is the number of unexpired tokens; LastUsedAt is the last use
+	// of any of them
+	Tokens     int        `json:"tokens"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ServiceToken is a token of a service account. The token itself is shown
+// once, when it is issued.
+type ServiceToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateServiceAccount creates a non-interactive identity for automation.
+// It has no password and cannot log in; it authenticates with tokens from
+// IssueServiceToken. Grants, roles and secret ownership apply to it like
+// to a user. Service accounts are managed from the command line.
+func (c *SecretlyCore) CreateServiceAccount(ctx context.Context, req *CreateServiceAccountRequest) (*ServiceAccount, error) {
+	if err := c.checkServiceAdmin(ctx); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("service account name is required")
+	}
+	owner, err := c.storage.Users().FindByUsername(req.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("owner %q: %w", req.Owner, ErrNotFound)
+	}
+	if owner.DeactivatedAt != nil {
+		return nil, fmt.Errorf("owner %q is deactivated", owner.Username)
+	}
+	if _, err := c.storage.ServiceAccounts().GetByUserID(owner.ID); err == nil {
+		return nil, fmt.Errorf("owner %q is a service account; service accounts are owned by people", owner.Username)
+	}
+
+	user := &models.User{Username: name}
+	account := &models.ServiceAccount{
+		Description: req.Description,
+		Owner:       owner.Username,
+		CreatedBy:   c.rbacActor(ctx),
+	}
+	err = c.storage.WithTransaction(func(tx storage.Storage) error {
+		if _, err := tx.Users().FindByUsername(name); err == nil {
+			return fmt.Errorf("user %q: %w", name, ErrConflict)
+		}
+		if err := tx.Users().Create(user); err != nil {
+			return fmt.Errorf("failed to create user %q: %w", name, err)
+		}
+		account.UserID = user.ID
+		if err := tx.ServiceAccounts().Create(account); err != nil {
+			return fmt.Errorf("failed to create service account %q: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.recordUserEvent(ctx, EventServiceAccountCreated, &user.ID, nil, fmt.Sprintf("Service account %q created for owner %q by %s",
+		name, owner.Username, account.CreatedBy))
+	return c.describeServiceAccount(ctx, user, account)
+}
+
+// ListServiceAccounts returns every service account in creation order
+func (c *SecretlyCore) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	accounts, err := c.storage.ServiceAccounts().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	infos := make([]ServiceAccount, 0, len(accounts))
+	for i := range accounts {
+		user, err := c.storage.Users().FindByID(accounts[i].UserID)
+		if err != nil {
+			return nil, fmt.Errorf("service account %d user %d not found: %w", accounts[i].ID, accounts[i].UserID, err)
+		}
+		info, err := c.describeServiceAccount(ctx, user, &accounts[i])
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// IsServiceAccount reports whether the user with userID is a service
+// account
+func (c *SecretlyCore) IsServiceAccount(userID uint) bool {
+	_, err := c.storage.ServiceAccounts().GetByUserID(userID)
+	return err == nil
+}
+
+// IssueServiceToken opens a token of the service account name, valid for
+// ttl, or DefaultServiceTokenTTL when ttl is 0. The token acts with the
+// account's full access; it cannot perform actions that need a personal
+// session.
+func (c *SecretlyCore) IssueServiceToken(ctx context.Context, name, tokenName string, ttl time.Duration) (string, *ServiceToken, error) {
+	if err := c.checkServiceAdmin(ctx); err != nil {
+		return "", nil, err
+	}
+	if ttl == 0 {
+		ttl = DefaultServiceTokenTTL
+	}
+	if ttl < 0 || ttl > MaxServiceTokenTTL {
+		return "", nil, fmt.Errorf("token lifetime must be between 0 and %s", MaxServiceTokenTTL)
+	}
+	if strings.TrimSpace(tokenName) == "" {
+		return "", nil, fmt.Errorf("token name is required")
+	}
+	user, _, err := c.serviceAccount(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return "", nil, fmt.Errorf("service account %q is disabled", name)
+	}
+
+	token, session, err := c.openSession(ctx, &models.Session{
+		UserID:  user.ID,
+		Scope:   serviceScopePrefix + user.Username,
+		Subject: tokenName,
+	}, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	c.recordUserEvent(ctx, EventServiceTokenIssued, &user.ID, nil, fmt.Sprintf("Token %q (%d) of service account %q issued by %s, expires %s",
+		tokenName, session.ID, name, c.rbacActor(ctx), session.ExpiresAt.UTC().Format(time.RFC3339)))
+	return token, newServiceToken(session), nil
+}
+
+// ListServiceTokens returns the unexpired tokens of the service account
+// name, newest first
+func (c *SecretlyCore) ListServiceTokens(ctx context.Context, name string) ([]ServiceToken, error) {
+	user, _, err := c.serviceAccount(name)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.ListSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]ServiceToken, 0, len(sessions))
+	for i := range sessions {
+		tokens = append(tokens, *newServiceToken(&sessions[i]))
+	}
+	return tokens, nil
+}
+
+// RevokeServiceToken ends one token of the service account name
+func (c *SecretlyCore) RevokeServiceToken(ctx context.Context, name string, tokenID uint) error {
+	if err := c.checkServiceAdmin(ctx); err != nil {
+		return err
+	}
+	user, _, err := c.serviceAccount(name)
+	if err != nil {
+		return err
+	}
+	tokens, err := c.ListServiceTokens(ctx, name)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(tokens, func(t ServiceToken) bool { return t.ID == tokenID })
+	if idx < 0 {
+		return fmt.Errorf("token %d of service account %q: %w", tokenID, name, ErrNotFound)
+	}
+	if err := c.storage.Sessions().Delete(tokenID); err != nil {
+		return fmt.Errorf("failed to revoke token %d: %w", tokenID, err)
+	}
+	c.recordUserEvent(ctx, EventServiceTokenRevoked, &user.ID, nil, fmt.Sprintf("Token %q (%d) of service account %q revoked by %s",
+		tokens[idx].Name, tokenID, name, c.rbacActor(ctx)))
+	return nil
+}
+
+// DisableServiceAccount blocks the service account name and revokes its
+// tokens; it keeps its grants, roles and secrets. It returns how many
+// tokens were revoked.
+func (c *SecretlyCore) DisableServiceAccount(ctx context.Context, name string) (int, error) {
+	if err := c.checkServiceAdmin(ctx); err != nil {
+		return 0, err
+	}
+	user, _, err := c.serviceAccount(name)
+	if err != nil {
+		return 0, err
+	}
+	if user.DeactivatedAt != nil {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	if err := c.storage.Users().SetDeactivated(user.ID, &now); err != nil {
+		return 0, fmt.Errorf("failed to disable service account %q: %w", name, err)
+	}
+	// keepID 0 matches no session, so every token is revoked
+	n, err := c.storage.Sessions().DeleteOthers(user.ID, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens of %q: %w", name, err)
+	}
+	c.recordUserEvent(ctx, EventServiceAccountDisabled, &user.ID, nil, fmt.Sprintf("Service account %q disabled by %s; %d token(s) revoked",
+		name, c.rbacActor(ctx), n))
+	return int(n), nil
+}
+
+// EnableServiceAccount lets a disabled service account be issued tokens
+// again. Revoked tokens stay revoked.
+func (c *SecretlyCore) EnableServiceAccount(ctx context.Context, name string) error {
+	if err := c.checkServiceAdmin(ctx); err != nil {
+		return err
+	}
+	user, _, err := c.serviceAccount(name)
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt == nil {
+		return nil
+	}
+	if err := c.storage.Users().SetDeactivated(user.ID, nil); err != nil {
+		return fmt.Errorf("failed to enable service account %q: %w", name, err)
+	}
+	c.recordUserEvent(ctx, EventServiceAccountEnabled, &user.ID, nil, fmt.Sprintf("Service account %q enabled by %s", name, c.rbacActor(ctx)))
+	return nil
+}
+
+// checkServiceAdmin allows only system actors, i.e. the command line, to
+// manage service accounts
+func (c *SecretlyCore) checkServiceAdmin(ctx context.Context) error {
+	auth, err := c.actor(ctx)
+	if err != nil {
+		return err
+	}
+	if !auth.System {
+		return fmt.Errorf("%w: service accounts are managed from the command line", ErrPermissionDenied)
+	}
+	return nil
+}
+
+// serviceAccount returns the service account name and its user
+func (c *SecretlyCore) serviceAccount(name string) (*models.User, *models.ServiceAccount, error) {
+	user, err := c.storage.Users().FindByUsername(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("service account %q: %w", name, ErrNotFound)
+	}
+	account, err := c.storage.ServiceAccounts().GetByUserID(user.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, fmt.Errorf("%q is a user, not a service account: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get service account %q: %w", name, err)
+	}
+	return user, account, nil
+}
+
+// describeServiceAccount reports account with the state of its tokens
+func (c *SecretlyCore) describeServiceAccount(ctx context.Context, user *models.User, account *models.ServiceAccount) (*ServiceAccount, error) {
+	info := &ServiceAccount{
+		UserID:      user.ID,
+		Name:        user.Username,
+		Description: account.Description,
+		Owner:       account.Owner,
+		CreatedBy:   account.CreatedBy,
+		CreatedAt:   account.CreatedAt,
+		DisabledAt:  user.DeactivatedAt,
+	}
+	sessions, err := c.ListSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	info.Tokens = len(sessions)
+	for i := range sessions {
+		used := newServiceToken(&sessions[i]).LastUsedAt
+		if used != nil && (info.LastUsedAt == nil || used.After(*info.LastUsedAt)) {
+			info.LastUsedAt = used
+		}
+	}
+	return info, nil
+}
+
+// newServiceToken describes session. Tokens are issued from the command
+// line, which records no client, so one without a client was never used.
+func newServiceToken(session *models.Session) *ServiceToken {
+	token := &ServiceToken{
+		ID:        session.ID,
+		Name:      session.Subject,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if session.IPAddress != "" || session.UserAgent != "" {
+		token.LastUsedAt = session.LastSeenAt
+	}
+	return token
+}
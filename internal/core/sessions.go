@@ -0,0 +1,292 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// DefaultSessionTTL is how long a session created by Login stays valid
+const DefaultSessionTTL = 24 * time.Hour
+
+// sessionTouchInterval limits how often use of a session is written back;
+// last-seen times are accurate to this interval
+const sessionTouchInterval = time.Minute
+
+// ClientInfo describes the client making a request. The server attaches it
+// with WithClientInfo so sessions record where they are used from, and adds
+// the authenticated session so alerts can name the requester.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	Username  string
+	SessionID uint
+	// Subject is the external identity of a federated session
+	Subject string
+	// Transport is how the request arrived, e.g. TransportHTTP
+	Transport string
+	// Locale is the configured language the client prefers
+	Locale string
+	// ActorKind is ActorServiceAccount for service account tokens
+	ActorKind string
+	// ImpersonatorID is the admin acting as Username in an impersonation
+	// session
+	ImpersonatorID *uint
+}
+
+// Transports recorded on audit events
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+	TransportCLI  = "cli"
+)
+
+type clientInfoKey struct{}
+
+// WithClientInfo returns a context carrying info
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFrom returns the client attached with WithClientInfo
+func ClientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+// ErrInvalidCredentials is returned for unknown users, wrong passwords and
+// invalid or expired session tokens alike
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Login verifies a username and password and opens a session. The returned
+// token is only shown once; storage keeps its SHA-256 hash.
+func (c *SecretlyCore) Login(ctx context.Context, username, password string) (string, *models.Session, error) {
+	return c.LoginWithCode(ctx, username, password, "")
+}
+
+// LoginWithCode is Login for accounts with two-factor authentication: code
+// is a TOTP or recovery code, and a login without one fails with
+// ErrSecondFactorRequired once the password checks out. Users the policy
+// requires to use two-factor authentication or a passkey but who have not
+// enrolled get a session that can only enroll; users with a required
+// passkey get ErrPasskeyRequired.
+func (c *SecretlyCore) LoginWithCode(ctx context.Context, username, password, code string) (string, *models.Session, error) {
+	// Unknown users still pay for a bcrypt comparison so that response
+	// times do not reveal which usernames exist
+	user, err := c.storage.Users().FindByUsername(username)
+	known := err == nil && user.PasswordHash != "" && user.DeactivatedAt == nil
+	passwordHash := c.dummyPasswordHash()
+	if known {
+		passwordHash = user.PasswordHash
+	}
+	passwordOK := checkPassword(passwordHash, password)
+	if !known || !passwordOK {
+		var userID *uint
+		if err == nil {
+			userID = &user.ID
+		}
+		c.recordUserEvent(ctx, EventLoginFailed, userID, nil, fmt.Sprintf("Failed login for user %q from %s",
+			username, describeClient(ClientInfoFrom(ctx).IPAddress, "")))
+		return "", nil, ErrInvalidCredentials
+	}
+	if err := c.checkClientNetwork(ctx, user.Username, &user.ID); err != nil {
+		return "", nil, err
+	}
+
+	passkeyRequired := c.PasskeyRequired(user)
+	if passkeyRequired {
+		creds, err := c.storage.WebAuthnCredentials().ListByUser(user.ID)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list passkeys: %w", err)
+		}
+		if len(creds) > 0 {
+			return "", nil, ErrPasskeyRequired
+		}
+	}
+
+	session := &models.Session{UserID: user.ID}
+	switch {
+	case user.TOTPEnabledAt != nil:
+		if code == "" {
+			return "", nil, ErrSecondFactorRequired
+		}
+		if err := c.verifySecondFactor(ctx, user, code); err != nil {
+			c.recordUserEvent(ctx, EventLoginFailed, &user.ID, nil, fmt.Sprintf("Failed login for user %q from %s: wrong two-factor code",
+				username, describeClient(ClientInfoFrom(ctx).IPAddress, "")))
+			return "", nil, ErrInvalidCredentials
+		}
+		elevatedUntil := time.Now().Add(c.twoFactorSettings().elevation)
+		session.ElevatedUntil = &elevatedUntil
+	case c.TwoFactorRequired(user):
+		session.Scope = EnrollmentScope
+	}
+	// A passkey verifies the user by itself, so it replaces TOTP enrollment
+	if passkeyRequired {
+		session.Scope = PasskeyEnrollmentScope
+	}
+
+	token, session, err := c.openSession(ctx, session, DefaultSessionTTL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.recordUserEvent(ctx, EventUserLogin, &user.ID, nil, fmt.Sprintf("User %q logged in", user.Username))
+	return token, session, nil
+}
+
+// openSession generates a token for session, sets its expiry and client and
+// stores it
+func (c *SecretlyCore) openSession(ctx context.Context, session *models.Session, ttl time.Duration) (string, *models.Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	client := ClientInfoFrom(ctx)
+	session.SessionToken = hashToken(token)
+	session.ExpiresAt = &expiresAt
+	session.LastSeenAt = &now
+	session.IPAddress, session.UserAgent = client.IPAddress, client.UserAgent
+	if err := c.storage.Sessions().Create(session); err != nil {
+		return "", nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return token, session, nil
+}
+
+// Authenticate resolves a session token to its user
+func (c *SecretlyCore) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	user, _, err := c.AuthenticateSession(ctx, token)
+	return user, err
+}
+
+// AuthenticateSession resolves a session token to its user and session, so
+// callers can apply the restrictions of scoped sessions
+func (c *SecretlyCore) AuthenticateSession(ctx context.Context, token string) (*models.User, *models.Session, error) {
+	if token == "" {
+		return nil, nil, ErrInvalidCredentials
+	}
+	tokenHash := hashToken(token)
+	session, err := c.storage.Sessions().GetByToken(tokenHash)
+	if err != nil || subtle.ConstantTimeCompare([]byte(session.SessionToken), []byte(tokenHash)) != 1 {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if session.ExpiresAt != nil && session.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	user, err := c.storage.Users().FindByID(session.UserID)
+	if err != nil || user.DeactivatedAt != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err := c.checkImpersonation(session); err != nil {
+		return nil, nil, err
+	}
+	c.touchSession(ctx, session)
+	return user, session, nil
+}
+
+// touchSession records that session was used by the client in ctx. Writes
+// are skipped while the last-seen time is recent and the client unchanged;
+// failures only make the time stale, so they are ignored.
+func (c *SecretlyCore) touchSession(ctx context.Context, session *models.Session) {
+	if c.replica {
+		return
+	}
+	now := time.Now()
+	client := ClientInfoFrom(ctx)
+	if client.IPAddress == "" && client.UserAgent == "" {
+		client = ClientInfo{IPAddress: session.IPAddress, UserAgent: session.UserAgent}
+	}
+	if session.LastSeenAt != nil && now.Sub(*session.LastSeenAt) < sessionTouchInterval &&
+		client.IPAddress == session.IPAddress && client.UserAgent == session.UserAgent {
+		return
+	}
+	if err := c.storage.Sessions().Touch(session.ID, now, client.IPAddress, client.UserAgent); err != nil {
+		return
+	}
+	session.LastSeenAt = &now
+	session.IPAddress, session.UserAgent = client.IPAddress, client.UserAgent
+}
+
+// ListSessions returns the user's unexpired sessions, newest first
+func (c *SecretlyCore) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessions, err := c.storage.Sessions().ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	now := time.Now()
+	active := sessions[:0]
+	for _, session := range sessions {
+		if session.ExpiresAt == nil || session.ExpiresAt.After(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// RevokeSession ends one of the user's sessions. Sessions of other users
+// are reported as not found.
+func (c *SecretlyCore) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	sessions, err := c.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(sessions, func(s models.Session) bool { return s.ID == sessionID })
+	if idx < 0 {
+		return fmt.Errorf("session %d: %w", sessionID, ErrNotFound)
+	}
+	if err := c.storage.Sessions().Delete(sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session %d: %w", sessionID, err)
+	}
+	revoked := sessions[idx]
+	c.recordUserEvent(ctx, EventSessionRevoked, &userID, nil, fmt.Sprintf("Session %d of user %d revoked (last used from %s)",
+		sessionID, userID, describeClient(revoked.IPAddress, revoked.UserAgent)))
+	return nil
+}
+
+// RevokeOtherSessions ends all of the user's sessions except keepID, e.g.
+// after a device was lost, and returns how many were ended
+func (c *SecretlyCore) RevokeOtherSessions(ctx context.Context, userID, keepID uint) (int, error) {
+	n, err := c.storage.Sessions().DeleteOthers(userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if n > 0 {
+		c.recordUserEvent(ctx, EventSessionRevoked, &userID, nil, fmt.Sprintf("%d other session(s) of user %d revoked", n, userID))
+	}
+	return int(n), nil
+}
+
+func describeClient(ip, userAgent string) string {
+	if ip == "" {
+		ip = "unknown address"
+	}
+	if userAgent == "" {
+		return ip
+	}
+	return fmt.Sprintf("%s, %s", ip, userAgent)
+}
+
+// randomToken returns a 256-bit random token for sessions and password resets
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,330 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Audit event types for unused secrets
+const (
+	EventSecretStale      = "secret_stale"
+	EventSecretArchived   = "secret_archived"
+	EventSecretUnarchived = "secret_unarchived"
+)
+
+// SecretStatusArchived marks a secret taken out of use; it cannot be read
+// until it is unarchived
+const SecretStatusArchived = "archived"
+
+// DefaultStaleAfter applies when secrets.stale does not set days
+const DefaultStaleAfter = 90 * 24 * time.Hour
+
+// ErrArchived is returned when reading an archived secret
+var ErrArchived = errors.New("secret is archived")
+
+// usageEventTypes are the audit events that count as using a secret
+var usageEventTypes = []string{
+	EventSecretCreated, EventSecretRead, EventSecretUpdated, EventSecretPreviewed, EventSecretCheckedOut, EventSecretUnarchived,
+}
+
+// stalePolicy is the stale secret handling configured with SetStalePolicy
+type stalePolicy struct {
+	interval time.Duration
+	after    time.Duration
+	archive  time.Duration // 0 never archives
+	mailer   Mailer
+}
+
+// StaleSecret is a secret nobody has used for a while
+type StaleSecret struct {
+	ID       uint      `json:"id"`
+	Name     string    `json:"name"`
+	Owner    string    `json:"owner,omitempty"`
+	LastUsed time.Time `json:"last_used"`
+	IdleDays int       `json:"idle_days"`
+	// NotifiedAt is when the owner was told, if since the last use
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	// ArchiveAt is when the stale policy archives the secret, if it does
+	ArchiveAt *time.Time `json:"archive_at,omitempty"`
+}
+
+// StaleReport counts what one stale sweep did
+type StaleReport struct {
+	Notified int `json:"notified"`
+	Archived int `json:"archived"`
+}
+
+// SetStalePolicy enables the stale sweep: owners of secrets unused for
+// cfg.Days days are notified and, if cfg.ArchiveAfterDays is set, the
+// secrets are archived that long after the notice unless used meanwhile.
+// mailer, which may be nil, also emails the notice to owners.
+func (c *SecretlyCore) SetStalePolicy(cfg config.StaleConfig, mailer Mailer) {
+	if !cfg.Enabled {
+		c.stale = nil
+		return
+	}
+	p := &stalePolicy{interval: DefaultLifecycleInterval, after: DefaultStaleAfter, mailer: mailer}
+	if cfg.IntervalSeconds > 0 {
+		p.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+	if cfg.Days > 0 {
+		p.after = time.Duration(cfg.Days) * 24 * time.Hour
+	}
+	if cfg.ArchiveAfterDays > 0 {
+		p.archive = time.Duration(cfg.ArchiveAfterDays) * 24 * time.Hour
+	}
+	c.stale = p
+}
+
+// StaleInterval returns how often RunStaleSweep sweeps, or 0 when the
+// stale policy is not enabled
+func (c *SecretlyCore) StaleInterval() time.Duration {
+	if c.stale == nil {
+		return 0
+	}
+	return c.stale.interval
+}
+
+// StaleSecrets lists the active secrets the actor in ctx may read that are
+// unused for at least idle, longest idle first; with idle 0 the policy's threshold applies. Use is a create,
+// update, read, preview or check-out. Canaries are never stale: they exist
+// to stay unused.
+func (c *SecretlyCore) StaleSecrets(ctx context.Context, idle time.Duration) ([]StaleSecret, error) {
+	if idle <= 0 {
+		idle = DefaultStaleAfter
+		if c.stale != nil {
+			idle = c.stale.after
+		}
+	}
+	now := time.Now()
+	var stale []StaleSecret
+	cursor := ""
+	for {
+		secrets, next, err := c.ListSecretsAfter(ctx, &ListSecretsFilter{}, cursor, MaxCursorLimit)
+		if err != nil {
+			return nil, err
+		}
+		for i := range secrets {
+			secret := &secrets[i]
+			if secret.Canary || (secret.Status != "" && secret.Status != SecretStatusActive) {
+				continue
+			}
+			lastUsed, err := c.lastUsed(secret)
+			if err != nil {
+				return nil, err
+			}
+			if now.Sub(lastUsed) < idle {
+				continue
+			}
+			entry := StaleSecret{
+				ID:       secret.ID,
+				Name:     secret.Name,
+				Owner:    SecretOwner(secret),
+				LastUsed: lastUsed,
+				IdleDays: int(now.Sub(lastUsed) / (24 * time.Hour)),
+			}
+			if entry.NotifiedAt, err = c.staleNotice(secret, lastUsed); err != nil {
+				return nil, err
+			}
+			if entry.NotifiedAt != nil && c.stale != nil && c.stale.archive > 0 {
+				archiveAt := entry.NotifiedAt.Add(c.stale.archive)
+				entry.ArchiveAt = &archiveAt
+			}
+			stale = append(stale, entry)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].LastUsed.Before(stale[j].LastUsed) })
+	return stale, nil
+}
+
+// RunStaleSweep sweeps the secrets every interval until ctx is cancelled
+func (c *SecretlyCore) RunStaleSweep(ctx context.Context, interval time.Duration) {
+	ctx = WithSystemActor(ctx, "stale sweep")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.SweepStaleSecrets(ctx)
+		if err != nil {
+			log.Printf("⚠️  Stale secret sweep failed: %v", err)
+		} else if report.Notified+report.Archived > 0 {
+			log.Printf("🕸️  Stale secrets: %d owners notified, %d secrets archived", report.Notified, report.Archived)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepStaleSecrets notifies the owners of newly stale secrets once and
+// archives those whose notice is older than the archive period
+func (c *SecretlyCore) SweepStaleSecrets(ctx context.Context) (*StaleReport, error) {
+	p := c.stale
+	if p == nil {
+		return nil, fmt.Errorf("stale secret policy is not enabled")
+	}
+	stale, err := c.StaleSecrets(ctx, p.after)
+	if err != nil {
+		return nil, err
+	}
+	report := &StaleReport{}
+	now := time.Now()
+	for _, entry := range stale {
+		secret, err := c.storage.Secrets().GetByID(entry.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret %d: %w", entry.ID, err)
+		}
+		switch {
+		case entry.NotifiedAt == nil:
+			c.notifyStale(ctx, secret, entry.LastUsed)
+			report.Notified++
+		case entry.ArchiveAt != nil && !now.Before(*entry.ArchiveAt):
+			if err := c.archiveSecret(ctx, secret, fmt.Sprintf("Secret %q archived after %d days unused", secret.Name, entry.IdleDays)); err != nil {
+				return nil, err
+			}
+			report.Archived++
+		}
+	}
+	return report, nil
+}
+
+// ArchiveSecret takes a secret out of use by hand; reads fail until it is
+// unarchived
+func (c *SecretlyCore) ArchiveSecret(ctx context.Context, id uint) (*models.SecretNode, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if IsFolder(secret) {
+		return nil, fmt.Errorf("%q is a folder", secret.Name)
+	}
+	if secret.Status == SecretStatusArchived {
+		return secret, nil
+	}
+	if err := c.archiveSecret(ctx, secret, fmt.Sprintf("Secret %q archived", secret.Name)); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// UnarchiveSecret makes an archived secret readable again. It counts as a
+// use, so the secret is not stale again before the threshold has passed.
+func (c *SecretlyCore) UnarchiveSecret(ctx context.Context, id uint) (*models.SecretNode, error) {
+	secret, err := c.writableSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Status != SecretStatusArchived {
+		return nil, fmt.Errorf("secret %q is not archived: %w", secret.Name, ErrConflict)
+	}
+	secret.Status = SecretStatusActive
+	if secret.Expiration != nil && !secret.Expiration.After(time.Now()) {
+		secret.Status = SecretStatusExpired
+	}
+	err = c.changeSecret(ctx, id, func(s storage.Storage) error {
+		if err := s.Secrets().Update(secret); err != nil {
+			return fmt.Errorf("failed to unarchive secret %d: %w", secret.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.recordClientEvent(ctx, EventSecretUnarchived, &secret.ID, fmt.Sprintf("Secret %q unarchived", secret.Name))
+	return secret, nil
+}
+
+func (c *SecretlyCore) archiveSecret(ctx context.Context, secret *models.SecretNode, desc string) error {
+	secret.Status = SecretStatusArchived
+	err := c.changeSecret(ctx, secret.ID, func(s storage.Storage) error {
+		if err := s.Secrets().Update(secret); err != nil {
+			return fmt.Errorf("failed to archive secret %d: %w", secret.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.InvalidateSecretCache(secret.ID)
+	c.recordEvent(ctx, EventSecretArchived, &secret.ID, desc)
+	return nil
+}
+
+// lastUsed returns when secret was last used according to the audit log,
+// and at least when it was last changed, for audit logs that were pruned
+func (c *SecretlyCore) lastUsed(secret *models.SecretNode) (time.Time, error) {
+	last := secret.CreatedAt
+	if secret.UpdatedAt.After(last) {
+		last = secret.UpdatedAt
+	}
+	events, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+		Types:      usageEventTypes,
+		SecretID:   secret.ID,
+		Descending: true,
+		Limit:      1,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check secret %d: %w", secret.ID, err)
+	}
+	if len(events) == 1 && events[0].EventTime.After(last) {
+		last = events[0].EventTime
+	}
+	return last, nil
+}
+
+// staleNotice returns when the owner of secret was told it is stale, if
+// that happened after its last use
+func (c *SecretlyCore) staleNotice(secret *models.SecretNode, lastUsed time.Time) (*time.Time, error) {
+	sent, err := c.storage.Audit().ListAfter(repository.AuditQuery{
+		Types:    []string{EventSecretStale},
+		SecretID: secret.ID,
+		From:     lastUsed,
+		Limit:    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check secret %d: %w", secret.ID, err)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+	return &sent[0].EventTime, nil
+}
+
+// notifyStale records the notice for the owner of secret and emails it
+// when a mailer is configured
+func (c *SecretlyCore) notifyStale(ctx context.Context, secret *models.SecretNode, lastUsed time.Time) {
+	owner := SecretOwner(secret)
+	var ownerID *uint
+	var email string
+	if user, err := c.storage.Users().FindByUsername(owner); err == nil {
+		ownerID, email = &user.ID, user.Email
+	}
+	c.recordUserEvent(ctx, EventSecretStale, ownerID, &secret.ID, fmt.Sprintf("Secret %q owned by %q has not been used since %s",
+		secret.Name, owner, lastUsed.Format(time.RFC3339)))
+
+	if c.stale.mailer == nil || email == "" {
+		return
+	}
+	body := fmt.Sprintf("Your secret %q has not been used since %s.\n\n", secret.Name, lastUsed.Format(time.RFC1123))
+	if c.stale.archive > 0 {
+		body += fmt.Sprintf("It will be archived in %s unless it is used. ", c.stale.archive)
+	}
+	body += "Delete it if it is no longer needed.\n"
+	if err := c.stale.mailer.Send(email, fmt.Sprintf("Secret %s is unused", secret.Name), body); err != nil {
+		log.Printf("⚠️  Failed to email stale notice for secret %d to %q: %v", secret.ID, owner, err)
+	}
+}
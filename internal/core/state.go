@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// SecretState is a secret's metadata together with its current version and
+// content hash. Building it never decrypts or reads the value, so it is safe
+// to poll for drift on read-limited secrets.
+type SecretState struct {
+	Secret      *models.SecretNode
+	Version     int
+	ContentHash string
+}
+
+// GetSecretState returns the current state of a secret
+func (c *SecretlyCore) GetSecretState(ctx context.Context, id uint) (*SecretState, error) {
+	secret, err := c.GetSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := c.latestVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretState{Secret: secret, Version: latest.VersionNumber, ContentHash: clientContentHash(latest.ContentHash)}, nil
+}
+
+// ErrPreconditionFailed is returned when a secret changed after the state
+// a change was based on was read
+var ErrPreconditionFailed = errors.New("secret was modified since it was last read")
+
+// SecretPrecondition is the state of a secret a change is based on, as
+// read from GetSecretState
+type SecretPrecondition struct {
+	SecretID  uint
+	Version   int
+	UpdatedAt time.Time
+}
+
+type preconditionKey struct{}
+
+// WithPrecondition makes the changes in ctx to the secret with p.SecretID
+// fail with ErrPreconditionFailed unless it is still in the state p
+// describes. The state is checked in the transaction of the change, so of
+// two changes based on the same state only one succeeds.
+func WithPrecondition(ctx context.Context, p *SecretPrecondition) context.Context {
+	return context.WithValue(ctx, preconditionKey{}, p)
+}
+
+func precondition(ctx context.Context, secretID uint) *SecretPrecondition {
+	p, _ := ctx.Value(preconditionKey{}).(*SecretPrecondition)
+	if p == nil || p.SecretID != secretID {
+		return nil
+	}
+	return p
+}
+
+// checkState checks the precondition in ctx for the secret with secretID
+// against s and returns the secret's update time it was checked against,
+// zero without a precondition
+func (c *SecretlyCore) checkState(ctx context.Context, s storage.Storage, secretID uint) (time.Time, error) {
+	p := precondition(ctx, secretID)
+	if p == nil {
+		return time.Time{}, nil
+	}
+	secret, err := s.Secrets().GetByID(secretID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get secret %d: %w", secretID, err)
+	}
+	if !secret.UpdatedAt.Equal(p.UpdatedAt) {
+		return time.Time{}, fmt.Errorf("secret %q: %w", secret.Name, ErrPreconditionFailed)
+	}
+	if err := checkVersion(s, p); err != nil {
+		return time.Time{}, err
+	}
+	return secret.UpdatedAt, nil
+}
+
+func checkVersion(s storage.Storage, p *SecretPrecondition) error {
+	versions, err := s.Secrets().GetVersions(p.SecretID)
+	if err != nil {
+		return fmt.Errorf("failed to get versions for secret %d: %w", p.SecretID, err)
+	}
+	version := 0
+	if len(versions) > 0 {
+		version = versions[len(versions)-1].VersionNumber
+	}
+	if version != p.Version {
+		return fmt.Errorf("secret %d is at version %d: %w", p.SecretID, version, ErrPreconditionFailed)
+	}
+	return nil
+}
+
+// changeSecret runs fn, which changes the secret with secretID, on the
+// storage. With a precondition for the secret in ctx, fn runs in a
+// transaction that claims the state first.
+func (c *SecretlyCore) changeSecret(ctx context.Context, secretID uint, fn func(s storage.Storage) error) error {
+	if precondition(ctx, secretID) == nil {
+		return fn(c.storage)
+	}
+	updatedAt, err := c.checkState(ctx, c.storage, secretID)
+	if err != nil {
+		return err
+	}
+	return c.storage.WithTransaction(func(tx storage.Storage) error {
+		if err := c.claimState(ctx, tx, secretID, updatedAt); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// claimState moves the update time of the secret with secretID on in tx if
+// it is still updatedAt, as checkState returned it, and checks the version
+// again. Claiming is the first write of the transaction, so that
+// concurrent changes based on the same state wait for it and then fail.
+func (c *SecretlyCore) claimState(ctx context.Context, tx storage.Storage, secretID uint, updatedAt time.Time) error {
+	p := precondition(ctx, secretID)
+	if p == nil {
+		return nil
+	}
+	claimed, err := tx.Secrets().TouchIfUnchanged(secretID, updatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update secret %d: %w", secretID, err)
+	}
+	if !claimed {
+		return fmt.Errorf("secret %d: %w", secretID, ErrPreconditionFailed)
+	}
+	return checkVersion(tx, p)
+}
+
+// FindSecret returns the secret with the given name in the scope selected by
+// the filter's namespace, zone and environment
+func (c *SecretlyCore) FindSecret(ctx context.Context, filter *ListSecretsFilter, name string) (*models.SecretNode, error) {
+	scoped := *filter
+	scoped.Name = name
+	scoped.Page, scoped.PageSize = 0, 0
+
+	matches, _, err := c.ListSecrets(ctx, &scoped)
+	if err != nil {
+		return nil, err
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("secret %q not found: %w", name, ErrNotFound)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("secret name %q is ambiguous, %d secrets match: narrow the namespace, zone or environment", name, len(matches))
+	}
+}
+
+// ValueMatches reports whether value equals the secret's current value by
+// comparing content hashes, without decrypting or consuming a read. It is
+// false when the current version has no recorded hash.
+func (c *SecretlyCore) ValueMatches(ctx context.Context, id uint, value []byte) (bool, error) {
+	latest, err := c.latestVersion(id)
+	if err != nil {
+		return false, err
+	}
+	contentHash, err := c.contentHash(value)
+	if err != nil {
+		return false, err
+	}
+	return sameContent(latest.ContentHash, contentHash), nil
+}
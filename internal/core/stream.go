@@ -0,0 +1,204 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/datatypes"
+)
+
+const defaultChunkSize = 64 * 1024
+
+// SetChunking configures how streamed secret values are split into
+// separately encrypted chunks
+func (c *SecretlyCore) SetChunking(cfg config.ChunkingConfig) {
+	if cfg.MaxChunkSizeKB > 0 {
+		c.chunkSize = cfg.MaxChunkSizeKB * 1024
+	}
+	c.maxChunks = cfg.MaxChunksPerSecret
+}
+
+// CreateSecretFromReader creates a secret whose value is read from r. The
+// value is encrypted and stored chunk by chunk, so it is never held in memory
+// as a whole. req.Value is ignored.
+func (c *SecretlyCore) CreateSecretFromReader(ctx context.Context, req *CreateSecretRequest, r io.Reader) (*models.SecretNode, error) {
+	if err := validateCreateRequest(req); err != nil {
+		return nil, err
+	}
+
+	secret, err := c.newSecretNode(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.storage.Secrets().Create(secret); err != nil {
+		return nil, fmt.Errorf("failed to create secret: %w", nameConflict(secret, err))
+	}
+
+	version := &models.SecretVersion{
+		SecretNodeID:   secret.ID,
+		VersionNumber:  1,
+		EncryptedValue: []byte{},
+	}
+	if err := c.storage.Secrets().CreateVersion(version); err != nil {
+		_ = c.storage.Secrets().Delete(secret.ID)
+		return nil, fmt.Errorf("failed to store secret version: %w", err)
+	}
+
+	if err := c.storeChunks(ctx, version, r); err != nil {
+		// Best-effort cleanup so that no partially uploaded secret remains
+		_ = c.storage.Secrets().Delete(secret.ID)
+		return nil, err
+	}
+
+	c.recordClientEvent(ctx, EventSecretCreated, &secret.ID, fmt.Sprintf("Secret %q created (%d chunks)", secret.Name, version.ChunkCount))
+	return secret, nil
+}
+
+// StreamSecretValue writes the decrypted value of the latest version to w and
+// returns the number of bytes written. Expiration and max-reads limits are
+// enforced as in GetSecretValue; the read is counted before any data is
+// written so an interrupted download still consumes it.
+func (c *SecretlyCore) StreamSecretValue(ctx context.Context, id uint, w io.Writer) (int64, error) {
+	secret, version, err := c.readableVersion(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	last, err := c.consumeRead(secret, version)
+	if err != nil {
+		return 0, err
+	}
+	if last {
+		defer c.burnSecret(ctx, secret)
+	}
+
+	c.recordClientEvent(ctx, EventSecretRead, &secret.ID, fmt.Sprintf("Secret %q version %d streamed", secret.Name, version.VersionNumber))
+	if secret.Canary {
+		c.tripCanary(ctx, secret, version, "value streamed")
+	}
+	return c.writeVersionValue(ctx, version, w)
+}
+
+// storeChunks reads r in chunkSize pieces and stores each one encrypted
+func (c *SecretlyCore) storeChunks(ctx context.Context, version *models.SecretVersion, r io.Reader) error {
+	buf := make([]byte, c.chunkSize)
+	defer wipe(buf)
+
+	hasher, algorithm, err := c.newContentHasher()
+	if err != nil {
+		return err
+	}
+
+	for index := 0; ; index++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if c.maxChunks > 0 && index >= c.maxChunks {
+				return fmt.Errorf("secret exceeds the maximum of %d chunks of %d KB", c.maxChunks, c.chunkSize/1024)
+			}
+
+			// The first chunk decides for the whole version; a full chunk
+			// means the value is at least chunkSize bytes long
+			if index == 0 && c.compression.Enabled && (n == len(buf) || c.shouldCompress(n)) {
+				version.Compression = CompressionZstd
+			}
+			hasher.Write(buf[:n])
+			payload := buf[:n]
+			if version.Compression == CompressionZstd {
+				payload = zstdEncoder.EncodeAll(payload, nil)
+			}
+
+			encrypted, metadata, encErr := c.encrypt(payload)
+			if encErr != nil {
+				return fmt.Errorf("failed to encrypt chunk %d: %w", index, encErr)
+			}
+			chunk := &models.SecretChunk{
+				SecretVersionID: version.ID,
+				ChunkIndex:      index,
+				// Without an encryptor encrypt may return buf itself, which is reused
+				EncryptedValue: append([]byte(nil), encrypted...),
+			}
+			if err := c.storage.Secrets().CreateChunk(chunk); err != nil {
+				return fmt.Errorf("failed to store chunk %d: %w", index, err)
+			}
+			if index == 0 {
+				version.EncryptionMetadata = datatypes.JSON(metadata)
+			}
+			version.ChunkCount = index + 1
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read secret value: %w", err)
+		}
+	}
+
+	if version.ChunkCount == 0 {
+		return fmt.Errorf("secret value is required")
+	}
+	version.ContentHash = formatContentHash(algorithm, hasher)
+	if err := c.storage.Secrets().UpdateVersionContent(version); err != nil {
+		return fmt.Errorf("failed to store secret version: %w", err)
+	}
+	return nil
+}
+
+// writeVersionValue decrypts a version, inline or chunked, into w
+func (c *SecretlyCore) writeVersionValue(ctx context.Context, version *models.SecretVersion, w io.Writer) (int64, error) {
+	if version.ChunkCount == 0 {
+		payload, err := c.decrypt(version.EncryptedValue)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt secret: %w", err)
+		}
+		value, err := decompress(payload, version.Compression)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(value)
+		return int64(n), err
+	}
+
+	var written int64
+	for index := 0; index < version.ChunkCount; index++ {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		chunk, err := c.storage.Secrets().GetChunk(version.ID, index)
+		if err != nil {
+			return written, fmt.Errorf("failed to load chunk %d: %w", index, err)
+		}
+		payload, err := c.decrypt(chunk.EncryptedValue)
+		if err != nil {
+			return written, fmt.Errorf("failed to decrypt chunk %d: %w", index, err)
+		}
+		value, err := decompress(payload, version.Compression)
+		if err != nil {
+			return written, fmt.Errorf("chunk %d: %w", index, err)
+		}
+		n, err := w.Write(value)
+		written += int64(n)
+		if c.encryptor != nil || version.Compression != "" {
+			wipe(value)
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// TypeJSON marks a structured secret whose value is a JSON object. Its keys
+// can be read one at a time with GetSecretKey.
+const TypeJSON = "json"
+
+// ErrNotStructured is returned when key access is requested for a secret
+// that is not of type TypeJSON
+var ErrNotStructured = errors.New("secret is not a structured JSON secret")
+
+// SecretKey is one leaf of a structured secret and how often the current
+// version's key has been read
+type SecretKey struct {
+	Path      string `json:"path"`
+	ReadCount int    `json:"read_count"`
+}
+
+// validateStructured checks that the value of a TypeJSON secret is a JSON
+// object
+func validateStructured(secretType string, value []byte) error {
+	if secretType != TypeJSON {
+		return nil
+	}
+	if _, err := decodeObject(value); err != nil {
+		return err
+	}
+	return nil
+}
+
+func decodeObject(value []byte) (map[string]interface{}, error) {
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("value of a %s secret must be a JSON object", TypeJSON)
+	}
+	return obj, nil
+}
+
+// GetSecretKey returns one key of a structured secret. Nested objects are
+// addressed with dotted paths, e.g. "db.password". String values are
+// returned as-is, anything else as JSON. A key read counts as a read of the
+// secret for max-reads and is also counted per key.
+func (c *SecretlyCore) GetSecretKey(ctx context.Context, id uint, path string) ([]byte, error) {
+	secret, version, obj, err := c.structuredValue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	leaf, ok := lookupPath(obj, path)
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in secret %d: %w", path, id, ErrNotFound)
+	}
+	value, err := encodeLeaf(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := c.consumeRead(secret, version)
+	if err != nil {
+		return nil, err
+	}
+	// Key reads are only counted by the primary
+	if !c.replica {
+		if err := c.storage.Secrets().RecordKeyRead(version.ID, path); err != nil {
+			return nil, fmt.Errorf("failed to update key read count: %w", err)
+		}
+	}
+
+	c.recordClientEvent(ctx, EventSecretRead, &secret.ID, fmt.Sprintf("Secret %q version %d key %q read", secret.Name, version.VersionNumber, path))
+	if secret.Canary {
+		c.tripCanary(ctx, secret, version, fmt.Sprintf("key %q read", path))
+	}
+	if last {
+		c.burnSecret(ctx, secret)
+	}
+	return value, nil
+}
+
+// ListSecretKeys returns the leaf paths of a structured secret with their
+// read counts. Values are not returned and no read is counted.
+func (c *SecretlyCore) ListSecretKeys(ctx context.Context, id uint) ([]SecretKey, error) {
+	_, version, obj, err := c.structuredValue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	reads, err := c.storage.Secrets().GetKeyReads(version.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key read counts: %w", err)
+	}
+	counts := make(map[string]int, len(reads))
+	for _, r := range reads {
+		counts[r.Key] = r.ReadCount
+	}
+
+	var paths []string
+	collectPaths("", obj, &paths)
+	sort.Strings(paths)
+	keys := make([]SecretKey, len(paths))
+	for i, p := range paths {
+		keys[i] = SecretKey{Path: p, ReadCount: counts[p]}
+	}
+	return keys, nil
+}
+
+// structuredValue decrypts the readable version of a TypeJSON secret
+func (c *SecretlyCore) structuredValue(ctx context.Context, id uint) (*models.SecretNode, *models.SecretVersion, map[string]interface{}, error) {
+	secret, version, err := c.readableVersion(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if secret.Type != TypeJSON {
+		return nil, nil, nil, fmt.Errorf("secret %d has type %q: %w", id, secret.Type, ErrNotStructured)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.writeVersionValue(ctx, version, &buf); err != nil {
+		return nil, nil, nil, err
+	}
+	defer wipe(buf.Bytes())
+	obj, err := decodeObject(buf.Bytes())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("secret %d: %w", id, err)
+	}
+	return secret, version, obj, nil
+}
+
+// lookupPath walks nested objects along a dotted path. A key that itself
+// contains dots is matched before descending, so {"a.b": 1} is found as
+// "a.b".
+func lookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return nil, false
+	}
+	if v, ok := obj[path]; ok {
+		return v, true
+	}
+	for i := strings.Index(path, "."); i > 0; i = nextDot(path, i) {
+		nested, ok := obj[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := lookupPath(nested, path[i+1:]); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func nextDot(path string, after int) int {
+	j := strings.Index(path[after+1:], ".")
+	if j < 0 {
+		return -1
+	}
+	return after + 1 + j
+}
+
+// collectPaths lists the dotted paths of all non-object values; empty
+// objects are leaves too
+func collectPaths(prefix string, obj map[string]interface{}, paths *[]string) {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			collectPaths(path, nested, paths)
+			continue
+		}
+		*paths = append(*paths, path)
+	}
+}
+
+func encodeLeaf(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(v)
+}
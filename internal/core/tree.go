@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// ErrInvalidParent is returned when a node cannot be placed in a folder: it
+// does not exist, is a secret, lies in another scope or would contain itself
+var ErrInvalidParent = errors.New("invalid parent folder")
+
+// EventFolderCreated is recorded when a folder is created
+const EventFolderCreated = "folder_created"
+
+// CreateFolderRequest creates a folder in a namespace, zone and environment,
+// inside ParentID or at the top level when it is nil
+type CreateFolderRequest struct {
+	Name          string
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	ParentID      *uint
+	CreatedBy     string
+}
+
+// TreeNode is a secret or folder with the visible nodes inside it
+type TreeNode struct {
+	models.SecretNode
+	Children []*TreeNode
+}
+
+// IsFolder reports whether node is a folder rather than a secret
+func IsFolder(node *models.SecretNode) bool {
+	return !node.IsSecret
+}
+
+// CreateFolder creates an empty folder. Folder names share the namespace of
+// secret names, so that lookups by name stay unambiguous; the naming policy
+// applies to secrets only.
+func (c *SecretlyCore) CreateFolder(ctx context.Context, req *CreateFolderRequest) (*models.SecretNode, error) {
+	name := NormalizeSecretName(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("folder name is required")
+	}
+	folder := &models.SecretNode{
+		Name:          name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		ParentID:      req.ParentID,
+		Status:        SecretStatusActive,
+		CreatedBy:     req.CreatedBy,
+		Owner:         ClientInfoFrom(ctx).Username,
+	}
+	if err := c.AuthorizeSecret(ctx, folder, true); err != nil {
+		return nil, err
+	}
+	if err := c.checkParent(folder); err != nil {
+		return nil, err
+	}
+	if err := c.claimSecretName(folder); err != nil {
+		return nil, err
+	}
+	if err := c.storage.Secrets().Create(folder); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", nameConflict(folder, err))
+	}
+	c.recordClientEvent(ctx, EventFolderCreated, &folder.ID, fmt.Sprintf("Folder %q created", folder.Name))
+	return folder, nil
+}
+
+// SecretTree returns the nodes in filter's scope below the folder rootID, or
+// from the top level when rootID is 0, folders first and then by name.
+// Secrets the actor in ctx may not read, by its scope or the grants on them
+// and their folders, are left out, and so are folders left with nothing
+// visible that it may not read themselves.
+func (c *SecretlyCore) SecretTree(ctx context.Context, filter *ListSecretsFilter, rootID uint) ([]*TreeNode, error) {
+	session, err := c.actorSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rootID != 0 {
+		root, err := c.GetSecret(ctx, rootID)
+		if err != nil {
+			return nil, err
+		}
+		if !IsFolder(root) {
+			return nil, fmt.Errorf("%w: %q is a secret, not a folder", ErrInvalidParent, root.Name)
+		}
+	}
+
+	nodes, err := c.storage.Secrets().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	present := make(map[uint]bool, len(nodes))
+	for _, node := range nodes {
+		present[node.ID] = true
+	}
+	children := make(map[uint][]*models.SecretNode)
+	for i := range nodes {
+		node := &nodes[i]
+		if (filter.NamespaceID != 0 && node.NamespaceID != filter.NamespaceID) ||
+			(filter.ZoneID != 0 && node.ZoneID != filter.ZoneID) ||
+			(filter.EnvironmentID != 0 && node.EnvironmentID != filter.EnvironmentID) {
+			continue
+		}
+		var parent uint
+		if node.ParentID != nil && present[*node.ParentID] {
+			parent = *node.ParentID
+		}
+		children[parent] = append(children[parent], node)
+	}
+
+	seen := make(map[uint]bool)
+	var build func(parent uint) []*TreeNode
+	build = func(parent uint) []*TreeNode {
+		var out []*TreeNode
+		for _, node := range children[parent] {
+			if seen[node.ID] {
+				continue
+			}
+			seen[node.ID] = true
+			entry := &TreeNode{SecretNode: *node}
+			visible := c.checkAccess(session, node, false) == nil
+			if IsFolder(node) {
+				entry.Children = build(node.ID)
+				visible = visible || len(entry.Children) > 0
+			}
+			if visible {
+				out = append(out, entry)
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			if IsFolder(&out[i].SecretNode) != IsFolder(&out[j].SecretNode) {
+				return IsFolder(&out[i].SecretNode)
+			}
+			return out[i].Name < out[j].Name
+		})
+		return out
+	}
+	return build(rootID), nil
+}
+
+// checkParent checks that node may be placed in its parent folder
+func (c *SecretlyCore) checkParent(node *models.SecretNode) error {
+	if node.ParentID == nil {
+		return nil
+	}
+	parent, err := c.storage.Secrets().GetByID(*node.ParentID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: folder %d does not exist", ErrInvalidParent, *node.ParentID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get folder %d: %w", *node.ParentID, err)
+	}
+	if !IsFolder(parent) {
+		return fmt.Errorf("%w: %q is a secret, not a folder", ErrInvalidParent, parent.Name)
+	}
+	if parent.NamespaceID != node.NamespaceID || parent.ZoneID != node.ZoneID || parent.EnvironmentID != node.EnvironmentID {
+		return fmt.Errorf("%w: folder %q is in namespace %d, zone %d, environment %d", ErrInvalidParent,
+			parent.Name, parent.NamespaceID, parent.ZoneID, parent.EnvironmentID)
+	}
+
+	// A folder cannot be moved into itself or one of its subfolders
+	for ancestor := parent; node.ID != 0; {
+		if ancestor.ID == node.ID {
+			return fmt.Errorf("%w: %q cannot be moved into itself", ErrInvalidParent, node.Name)
+		}
+		if ancestor.ParentID == nil {
+			break
+		}
+		id := *ancestor.ParentID
+		if ancestor, err = c.storage.Secrets().GetByID(id); err != nil {
+			return fmt.Errorf("failed to get folder %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// sameParent reports whether two parent IDs name the same folder
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/totp"
+)
+
+// Audit event types for two-factor authentication
+const (
+	EventTwoFactorEnabled  = "two_factor_enabled"
+	EventTwoFactorDisabled = "two_factor_disabled"
+	EventRecoveryCodeUsed  = "recovery_code_used"
+	EventSessionElevated   = "session_elevated"
+)
+
+// Values of auth.two_factor.required
+const (
+	TwoFactorRequiredNone   = "none"
+	TwoFactorRequiredAdmins = "admins"
+	TwoFactorRequiredAll    = "all"
+)
+
+const (
+	// EnrollmentScope marks the sessions of users who must enroll in
+	// two-factor authentication before they can do anything else
+	EnrollmentScope = "2fa-enrollment"
+	// DefaultElevationTTL is how long a confirmed second factor unlocks
+	// sensitive operations when auth.two_factor.elevation_minutes is unset
+	DefaultElevationTTL = 5 * time.Minute
+
+	defaultTOTPIssuer = "Secretly"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	recoveryAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	// ErrSecondFactorRequired is returned by a login with a correct
+	// password but no code for an account with two-factor authentication
+	ErrSecondFactorRequired = errors.New("a two-factor authentication code is required")
+	// ErrElevationRequired is returned for sensitive operations until the
+	// session confirms a second factor
+	ErrElevationRequired = errors.New("confirm a two-factor authentication code to continue")
+)
+
+// twoFactorPolicy holds the settings applied with SetTwoFactor
+type twoFactorPolicy struct {
+	required  string
+	issuer    string
+	elevation time.Duration
+}
+
+// SetTwoFactor configures who must use two-factor authentication: nobody,
+// the admins (holders of users.manage, rbac.manage or system.manage) or
+// everyone
+func (c *SecretlyCore) SetTwoFactor(cfg config.TwoFactorConfig) error {
+	p := &twoFactorPolicy{required: cfg.Required, issuer: cfg.Issuer, elevation: DefaultElevationTTL}
+	switch p.required {
+	case "":
+		p.required = TwoFactorRequiredNone
+	case TwoFactorRequiredNone, TwoFactorRequiredAdmins, TwoFactorRequiredAll:
+	default:
+		return fmt.Errorf("auth.two_factor.required must be %s, %s or %s", TwoFactorRequiredNone, TwoFactorRequiredAdmins, TwoFactorRequiredAll)
+	}
+	if p.issuer == "" {
+		p.issuer = defaultTOTPIssuer
+	}
+	if cfg.ElevationMinutes > 0 {
+		p.elevation = time.Duration(cfg.ElevationMinutes) * time.Minute
+	}
+	c.twoFactor = p
+	return nil
+}
+
+// twoFactorSettings returns the configured policy or the defaults
+func (c *SecretlyCore) twoFactorSettings() *twoFactorPolicy {
+	if c.twoFactor != nil {
+		return c.twoFactor
+	}
+	return &twoFactorPolicy{required: TwoFactorRequiredNone, issuer: defaultTOTPIssuer, elevation: DefaultElevationTTL}
+}
+
+// TwoFactorRequired reports whether the policy makes user enroll
+func (c *SecretlyCore) TwoFactorRequired(user *models.User) bool {
+	p := c.twoFactorSettings()
+	return c.requiredFor(p.required, user)
+}
+
+// requiredFor applies a none, admins or all policy to user
+func (c *SecretlyCore) requiredFor(required string, user *models.User) bool {
+	switch required {
+	case TwoFactorRequiredAll:
+		return true
+	case TwoFactorRequiredAdmins:
+		return c.isAdmin(user)
+	}
+	return false
+}
+
+// TOTPEnrollment is the key to add to an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP generates a new authenticator key for the user. It takes
+// effect once ConfirmTOTP receives a valid code; until then logins do not
+// ask for one.
+func (c *SecretlyCore) EnrollTOTP(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, fmt.Errorf("two-factor authentication is already enabled: %w", ErrConflict)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	encrypted, _, err := c.encrypt([]byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	if err := c.storage.Users().SetTwoFactor(user.ID, models.TwoFactor{TOTPSecret: encrypted}); err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	return &TOTPEnrollment{Secret: secret, URI: totp.URI(c.twoFactorSettings().issuer, user.Username, secret)}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once code shows that the
+// authenticator app holds the key from EnrollTOTP. It returns one-time
+// recovery codes, which are only shown this once.
+func (c *SecretlyCore) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, fmt.Errorf("two-factor authentication is already enabled: %w", ErrConflict)
+	}
+	if len(user.TOTPSecret) == 0 {
+		return nil, fmt.Errorf("no TOTP enrollment in progress: %w", ErrNotFound)
+	}
+	secret, err := c.decrypt(user.TOTPSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	step, ok := totp.Verify(string(secret), code, time.Now(), totpSkew)
+	if !ok {
+		return nil, fmt.Errorf("wrong code: %w", ErrInvalidCredentials)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	tf := models.TwoFactor{TOTPSecret: user.TOTPSecret, TOTPEnabledAt: &now, TOTPLastStep: step, RecoveryCodes: hashes}
+	if err := c.storage.Users().SetTwoFactor(user.ID, tf); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	c.recordUserEvent(ctx, EventTwoFactorEnabled, &user.ID, nil, fmt.Sprintf("User %q enabled two-factor authentication", user.Username))
+	return codes, nil
+}
+
+// DisableTOTP removes the user's authenticator key and recovery codes. It
+// is refused while the policy requires two-factor authentication for them.
+func (c *SecretlyCore) DisableTOTP(ctx context.Context, userID uint) error {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	if c.TwoFactorRequired(user) {
+		return fmt.Errorf("%w: two-factor authentication is required for %q", ErrPermissionDenied, user.Username)
+	}
+	if err := c.storage.Users().SetTwoFactor(user.ID, models.TwoFactor{}); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if user.TOTPEnabledAt != nil {
+		c.recordUserEvent(ctx, EventTwoFactorDisabled, &user.ID, nil, fmt.Sprintf("User %q disabled two-factor authentication", user.Username))
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (c *SecretlyCore) RegenerateRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	user, err := c.storage.Users().FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, fmt.Errorf("two-factor authentication is not enabled: %w", ErrNotFound)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	tf := user.TwoFactor
+	tf.RecoveryCodes = hashes
+	if err := c.storage.Users().SetTwoFactor(user.ID, tf); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes user has
+func RecoveryCodesLeft(user *models.User) int {
+	if user.RecoveryCodes == "" {
+		return 0
+	}
+	return strings.Count(user.RecoveryCodes, "\n") + 1
+}
+
+// ElevateSession unlocks sensitive operations for a session for the
+// configured time, after checking a TOTP or recovery code
+func (c *SecretlyCore) ElevateSession(ctx context.Context, user *models.User, session *models.Session, code string) (time.Time, error) {
+	if user.TOTPEnabledAt == nil {
+		return time.Time{}, fmt.Errorf("two-factor authentication is not enabled: %w", ErrNotFound)
+	}
+	if err := c.verifySecondFactor(ctx, user, code); err != nil {
+		return time.Time{}, err
+	}
+	until := time.Now().Add(c.twoFactorSettings().elevation)
+	if err := c.storage.Sessions().SetElevated(session.ID, &until); err != nil {
+		return time.Time{}, fmt.Errorf("failed to elevate session: %w", err)
+	}
+	session.ElevatedUntil = &until
+	c.recordUserEvent(ctx, EventSessionElevated, &user.ID, nil, fmt.Sprintf("Session %d of user %q elevated until %s",
+		session.ID, user.Username, until.UTC().Format(time.RFC3339)))
+	return until, nil
+}
+
+// RequireElevation returns ErrElevationRequired unless the session
+// confirmed a second factor recently. Users without two-factor
+// authentication have nothing to confirm and are let through.
+func (c *SecretlyCore) RequireElevation(user *models.User, session *models.Session) error {
+	if user.TOTPEnabledAt == nil {
+		return nil
+	}
+	if session != nil && session.ElevatedUntil != nil && session.ElevatedUntil.After(time.Now()) {
+		return nil
+	}
+	return ErrElevationRequired
+}
+
+// IsFederated reports whether session was opened by an OIDC token exchange
+// or an API client rather than by a user logging in
+func IsFederated(session *models.Session) bool {
+	return session != nil && session.Scope != "" && !isEnrollmentScope(session.Scope)
+}
+
+// isEnrollmentScope reports whether scope limits a session to enrolling a
+// required second factor
+func isEnrollmentScope(scope string) bool {
+	return scope == EnrollmentScope || scope == PasskeyEnrollmentScope
+}
+
+// verifySecondFactor accepts a current TOTP code that was not used before,
+// or an unused recovery code, which is then consumed
+func (c *SecretlyCore) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	secret, err := c.decrypt(user.TOTPSecret)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	if step, ok := totp.Verify(string(secret), code, time.Now(), totpSkew); ok {
+		if step <= user.TOTPLastStep {
+			return fmt.Errorf("code already used: %w", ErrInvalidCredentials)
+		}
+		tf := user.TwoFactor
+		tf.TOTPLastStep = step
+		if err := c.storage.Users().SetTwoFactor(user.ID, tf); err != nil {
+			return fmt.Errorf("failed to record TOTP use: %w", err)
+		}
+		user.TwoFactor = tf
+		return nil
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	hashes := strings.Split(user.RecoveryCodes, "\n")
+	idx := slices.Index(hashes, hash)
+	if user.RecoveryCodes == "" || idx < 0 {
+		return fmt.Errorf("wrong code: %w", ErrInvalidCredentials)
+	}
+	tf := user.TwoFactor
+	tf.RecoveryCodes = strings.Join(slices.Delete(hashes, idx, idx+1), "\n")
+	if err := c.storage.Users().SetTwoFactor(user.ID, tf); err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	user.TwoFactor = tf
+	c.recordUserEvent(ctx, EventRecoveryCodeUsed, &user.ID, nil, fmt.Sprintf("User %q used a recovery code from %s; %d left",
+		user.Username, describeClient(ClientInfoFrom(ctx).IPAddress, ""), RecoveryCodesLeft(user)))
+	return nil
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes, one per
+// line
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw, err := randomString(recoveryAlphabet, 10)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, strings.Join(hashes, "\n"), nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// CreateUserRequest contains the data needed to create a user
+type CreateUserRequest struct {
+	Username string
+	Email    string
+	Password string
+	// Roles are assigned to the user in every namespace
+	Roles []string
+}
+
+// ListUsersFilter paginates ListUsers results; PageSize 0 returns all users
+type ListUsersFilter struct {
+	Page     int
+	PageSize int
+}
+
+// CreateUser creates a user with a hashed password (bcrypt, or PBKDF2 in FIPS mode)
+func (c *SecretlyCore) CreateUser(ctx context.Context, req *CreateUserRequest) (*models.User, error) {
+	if err := c.requirePermission(ctx, PermissionUsersManage, "creating users"); err != nil {
+		return nil, err
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+
+	user := &models.User{
+		Username: req.Username,
+		Email:    strings.TrimSpace(req.Email),
+	}
+	index, err := c.emailIndex(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	user.EmailIndex = index
+	roles, err := c.rolesNamed(ctx, req.Roles)
+	if err != nil {
+		return nil, err
+	}
+	if req.Password != "" {
+		hash, err := c.hashPassword(req.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		user.PasswordHash = hash
+	}
+
+	err = c.storage.WithTransaction(func(tx storage.Storage) error {
+		if err := tx.Users().Create(user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		for _, role := range roles {
+			if err := tx.RBAC().AssignUserRole(&models.UserRole{UserID: user.ID, RoleID: role.ID}); err != nil {
+				return fmt.Errorf("failed to assign role %q: %w", role.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordEvent(ctx, EventUserCreated, nil, fmt.Sprintf("User %q created", user.Username))
+	return user, nil
+}
+
+// rolesNamed looks up the roles a new user is created with; assigning
+// them takes rbac.manage
+func (c *SecretlyCore) rolesNamed(ctx context.Context, names []string) ([]models.Role, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if err := c.requirePermission(ctx, PermissionRBACManage, "assigning roles"); err != nil {
+		return nil, err
+	}
+	all, err := c.storage.RBAC().ListRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	roles := make([]models.Role, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(all, func(r models.Role) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidRBAC, name)
+		}
+		roles = append(roles, all[i])
+	}
+	return roles, nil
+}
+
+// GetUser returns a user by ID
+func (c *SecretlyCore) GetUser(ctx context.Context, id uint) (*models.User, error) {
+	user, err := c.storage.Users().FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+// ListUsers returns a page of users and the total number of users
+func (c *SecretlyCore) ListUsers(ctx context.Context, filter *ListUsersFilter) ([]models.User, int64, error) {
+	users, err := c.storage.Users().List()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	start, end := paginate(len(users), filter.Page, filter.PageSize)
+	return users[start:end], int64(len(users)), nil
+}
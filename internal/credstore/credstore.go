@@ -0,0 +1,123 @@
+// Package credstore keeps CLI session tokens per server, either in a
+// plaintext file readable only by the user or in the OS keychain.
+package credstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Backends accepted by New
+const (
+	BackendFile     = "file"
+	BackendKeychain = "keychain"
+)
+
+// ErrNotFound is returned when no token is stored for a server
+var ErrNotFound = errors.New("no stored token: run 'secretly login'")
+
+// Store saves session tokens keyed by server URL
+type Store interface {
+	Save(server, token string) error
+	Load(server string) (string, error)
+	Delete(server string) error
+}
+
+// DefaultPath is ~/.secretly/credentials.json
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secretly", "credentials.json"), nil
+}
+
+// New returns the store for backend. path is the credentials file, which the
+// keychain backend only uses on Windows to hold DPAPI-protected tokens.
+func New(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendFile:
+		return &FileStore{Path: path}, nil
+	case BackendKeychain:
+		return &KeychainStore{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown token store %q: use %s or %s", backend, BackendFile, BackendKeychain)
+	}
+}
+
+// Open returns the store for backend using DefaultPath
+func Open(backend string) (Store, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return New(backend, path)
+}
+
+// FileStore keeps tokens in a JSON file with 0600 permissions
+type FileStore struct {
+	Path string
+}
+
+func (f *FileStore) Save(server, token string) error {
+	entries, err := readEntries(f.Path)
+	if err != nil {
+		return err
+	}
+	entries[server] = token
+	return writeEntries(f.Path, entries)
+}
+
+func (f *FileStore) Load(server string) (string, error) {
+	entries, err := readEntries(f.Path)
+	if err != nil {
+		return "", err
+	}
+	token, ok := entries[server]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (f *FileStore) Delete(server string) error {
+	entries, err := readEntries(f.Path)
+	if err != nil {
+		return err
+	}
+	delete(entries, server)
+	return writeEntries(f.Path, entries)
+}
+
+func readEntries(path string) (map[string]string, error) {
+	entries := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func writeEntries(path string, entries map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,51 @@
+package credstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "credentials.json")
+	store, err := New(BackendFile, path)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if _, err := store.Load("https://a.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.Save("https://a.example", "token-a"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Save("https://b.example", "token-b"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if token, _ := store.Load("https://a.example"); token != "token-a" {
+		t.Errorf("Expected token-a, got %q", token)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600, got %v", info.Mode().Perm())
+	}
+
+	if err := store.Delete("https://a.example"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Load("https://a.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted token to be gone, got %v", err)
+	}
+	if token, _ := store.Load("https://b.example"); token != "token-b" {
+		t.Errorf("Expected other token to survive, got %q", token)
+	}
+
+	if _, err := New("vault", path); err == nil {
+		t.Error("Expected unknown backend to fail")
+	}
+}
@@ -0,0 +1,104 @@
+package credstore
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainService names the entries created in the OS keychain
+const keychainService = "secretly"
+
+// KeychainStore keeps tokens in the macOS Keychain, in the Secret Service
+// (GNOME Keyring, KWallet) through libsecret's secret-tool on Linux, or
+// encrypted with DPAPI on Windows. Tokens are always passed on stdin so
+// they never show up in process listings.
+type KeychainStore struct {
+	// Path holds DPAPI-protected tokens on Windows
+	Path string
+}
+
+func (k *KeychainStore) Save(server, token string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		// security -i reads commands from stdin, keeping -w off the command line
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(keychainService), quote(server), quote(token))
+		return run(command, "security", "-i")
+	case "linux":
+		return run(token, "secret-tool", "store", "--label=Secretly session token", "service", keychainService, "server", server)
+	case "windows":
+		protected, err := output(token, "powershell", "-NoProfile", "-Command",
+			"ConvertTo-SecureString ([Console]::In.ReadToEnd()) -AsPlainText -Force | ConvertFrom-SecureString")
+		if err != nil {
+			return err
+		}
+		return (&FileStore{Path: k.Path}).Save(server, strings.TrimSpace(protected))
+	}
+	return fmt.Errorf("OS keychain is not supported on %s", runtime.GOOS)
+}
+
+func (k *KeychainStore) Load(server string) (string, error) {
+	var token string
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		token, err = output("", "security", "find-generic-password", "-s", keychainService, "-a", server, "-w")
+	case "linux":
+		token, err = output("", "secret-tool", "lookup", "service", keychainService, "server", server)
+	case "windows":
+		protected, loadErr := (&FileStore{Path: k.Path}).Load(server)
+		if loadErr != nil {
+			return "", loadErr
+		}
+		token, err = output(protected, "powershell", "-NoProfile", "-Command",
+			"$s = ConvertTo-SecureString ([Console]::In.ReadToEnd().Trim()); "+
+				"[Runtime.InteropServices.Marshal]::PtrToStringAuto([Runtime.InteropServices.Marshal]::SecureStringToBSTR($s))")
+	default:
+		return "", fmt.Errorf("OS keychain is not supported on %s", runtime.GOOS)
+	}
+	token = strings.TrimRight(token, "\r\n")
+	if err != nil || token == "" {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (k *KeychainStore) Delete(server string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		_ = run("", "security", "delete-generic-password", "-s", keychainService, "-a", server)
+		return nil
+	case "linux":
+		return run("", "secret-tool", "clear", "service", keychainService, "server", server)
+	case "windows":
+		return (&FileStore{Path: k.Path}).Delete(server)
+	}
+	return fmt.Errorf("OS keychain is not supported on %s", runtime.GOOS)
+}
+
+func run(stdin, name string, args ...string) error {
+	_, err := output(stdin, name, args...)
+	return err
+}
+
+func output(stdin, name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s not found: the OS keychain is unavailable", name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// quote escapes a value for the command parser of security -i
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,137 @@
+package csi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+)
+
+// call makes a unary gRPC call over the provider's socket and returns the
+// response message and grpc-status
+func call(t *testing.T, socket, method string, req []byte) ([]byte, string) {
+	t.Helper()
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{
+		Protocols: protocols,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	var body bytes.Buffer
+	if err := writeFrame(&body, req); err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest(http.MethodPost, "http://localhost"+method, &body)
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("Call %s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	status := resp.Header.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Trailer.Get("Grpc-Status")
+	}
+	if len(data) == 0 {
+		return nil, status
+	}
+	msg, err := readFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Invalid response frame: %v", err)
+	}
+	return msg, status
+}
+
+func TestProviderOverSocket(t *testing.T) {
+	c := core.NewSecretlyCore(memory.New(), nil)
+	c.SetLocalActor("test")
+	bg := context.Background()
+	if _, err := c.CreateSecret(bg, &core.CreateSecretRequest{Name: "app/db-url", Value: []byte("postgres://db")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateSecret(bg, &core.CreateSecretRequest{Name: "app/config", Type: core.TypeJSON, Value: []byte(`{"db": {"password": "s3cr3t"}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	maxReads := 1
+	if _, err := c.CreateSecret(bg, &core.CreateSecretRequest{Name: "once", Value: []byte("x"), MaxReads: &maxReads}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("", "csi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "secretly.sock")
+
+	ctx, cancel := context.WithCancel(bg)
+	done := make(chan error, 1)
+	go func() { done <- New(c, []string{"apps"}).Serve(ctx, socket) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	msg, status := call(t, socket, methodVersion, (&VersionRequest{Version: APIVersion}).Marshal())
+	var version VersionResponse
+	if err := version.Unmarshal(msg); err != nil || status != "0" || version.RuntimeName != ProviderName {
+		t.Fatalf("Unexpected version response %+v, status %s, err %v", version, status, err)
+	}
+
+	mount := func(namespace, objects string) (*MountResponse, string) {
+		attrs, _ := json.Marshal(map[string]string{attrPodNamespace: namespace, "objects": objects})
+		msg, status := call(t, socket, methodMount, (&MountRequest{Attributes: string(attrs), Permission: "420"}).Marshal())
+		var resp MountResponse
+		if err := resp.Unmarshal(msg); err != nil {
+			t.Fatalf("Invalid mount response: %v", err)
+		}
+		return &resp, status
+	}
+
+	resp, status := mount("apps", "- name: app/db-url\n  path: db-url\n- name: app/config\n  key: db.password\n  path: db/password\n")
+	if status != "0" || len(resp.Files) != 2 {
+		t.Fatalf("Unexpected mount response %+v, status %s", resp, status)
+	}
+	if f := resp.Files[0]; f.Path != "db-url" || string(f.Contents) != "postgres://db" || f.Mode != 420 {
+		t.Errorf("Unexpected file %+v", f)
+	}
+	if f := resp.Files[1]; f.Path != "db/password" || string(f.Contents) != "s3cr3t" {
+		t.Errorf("Unexpected file %+v", f)
+	}
+	if len(resp.ObjectVersion) != 2 || resp.ObjectVersion[0].Version != "1" {
+		t.Errorf("Unexpected object versions %+v", resp.ObjectVersion)
+	}
+
+	for name, tc := range map[string]struct{ namespace, objects, status string }{
+		"namespace not allowed": {"other", "- name: app/db-url\n", "7"},
+		"missing secret":        {"apps", "- name: missing\n", "5"},
+		"path escapes volume":   {"apps", "- name: app/db-url\n  path: ../etc/passwd\n", "3"},
+		"read-limited secret":   {"apps", "- name: once\n", "3"},
+	} {
+		if _, status := mount(tc.namespace, tc.objects); status != tc.status {
+			t.Errorf("%s: expected status %s, got %s", name, tc.status, status)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package csi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// gRPC method paths of the provider service
+const (
+	methodVersion = "/v1alpha1.CSIDriverProvider/Version"
+	methodMount   = "/v1alpha1.CSIDriverProvider/Mount"
+)
+
+// maxRequestSize bounds a request message; mount requests only carry
+// attributes and object versions
+const maxRequestSize = 4 << 20
+
+// gRPC status codes used by the provider
+const (
+	codeOK                 = 0
+	codeInvalidArgument    = 3
+	codeNotFound           = 5
+	codePermissionDenied   = 7
+	codeFailedPrecondition = 9
+	codeUnimplemented      = 12
+	codeInternal           = 13
+)
+
+// StatusError carries a gRPC status code to the driver
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func statusErrorf(code int, format string, args ...interface{}) error {
+	return &StatusError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Handler serves the provider service as gRPC over HTTP/2. It implements
+// just enough of the protocol for the CSI driver: unary calls without
+// compression.
+func (p *Provider) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+			http.Error(w, "gRPC requires HTTP/2 POST", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+
+		msg, err := readFrame(r.Body)
+		if err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+
+		var resp []byte
+		switch r.URL.Path {
+		case methodVersion:
+			var req VersionRequest
+			if err = req.Unmarshal(msg); err == nil {
+				out := p.Version(&req)
+				resp = out.Marshal()
+			}
+		case methodMount:
+			var req MountRequest
+			if err = req.Unmarshal(msg); err == nil {
+				var out *MountResponse
+				if out, err = p.Mount(r.Context(), &req); err == nil {
+					resp = out.Marshal()
+				}
+			}
+		default:
+			writeStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+		if err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				writeStatus(w, statusErr.Code, statusErr.Message)
+			} else {
+				writeStatus(w, codeInternal, err.Error())
+			}
+			return
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		if err := writeFrame(w, resp); err != nil {
+			return
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(codeOK))
+	})
+}
+
+// writeStatus sends a trailers-only response carrying the status
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// readFrame reads one length-prefixed gRPC message
+func readFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestSize {
+		return nil, fmt.Errorf("request of %d bytes exceeds the %d byte limit", size, maxRequestSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+	return msg, nil
+}
+
+func writeFrame(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// Serve listens on the Unix socket at path until ctx is done. The driver
+// connects with HTTP/2 prior knowledge, so the server accepts unencrypted
+// HTTP/2 only.
+func (p *Provider) Serve(ctx context.Context, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// A socket left behind by a previous run would make Listen fail
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Handler:           p.Handler(),
+		Protocols:         protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package csi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Messages of the v1alpha1.CSIDriverProvider service, see
+// sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1/service.proto.
+// Only the protobuf wire format needed for these messages is implemented.
+
+type VersionRequest struct {
+	Version string // field 1
+}
+
+type VersionResponse struct {
+	Version        string // field 1
+	RuntimeName    string // field 2
+	RuntimeVersion string // field 3
+}
+
+type MountRequest struct {
+	Attributes           string          // field 1, JSON object of volume attributes
+	Secrets              string          // field 2, JSON object of nodePublishSecretRef data
+	TargetPath           string          // field 3
+	Permission           string          // field 4, JSON number, e.g. "420"
+	CurrentObjectVersion []ObjectVersion // field 5
+}
+
+type MountResponse struct {
+	ObjectVersion []ObjectVersion // field 1
+	Error         *Error          // field 2
+	Files         []File          // field 3
+}
+
+type ObjectVersion struct {
+	ID      string // field 1
+	Version string // field 2
+}
+
+type Error struct {
+	Code string // field 1
+}
+
+type File struct {
+	Path     string // field 1
+	Mode     int32  // field 2
+	Contents []byte // field 3
+}
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	return appendBytes(b, field, []byte(v))
+}
+
+// appendMessage always writes the field, even for an empty message, so that
+// its presence survives the round trip
+func appendMessage(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// walk calls fn for every field of a message. For length-delimited fields
+// data is the payload; for varints it is nil and n holds the value. Other
+// wire types are skipped.
+func walk(msg []byte, fn func(field int, data []byte, n uint64) error) error {
+	for len(msg) > 0 {
+		tag, size := binary.Uvarint(msg)
+		if size <= 0 {
+			return errTruncated
+		}
+		msg = msg[size:]
+		field, wire := int(tag>>3), int(tag&7)
+
+		switch wire {
+		case wireVarint:
+			n, size := binary.Uvarint(msg)
+			if size <= 0 {
+				return errTruncated
+			}
+			msg = msg[size:]
+			if err := fn(field, nil, n); err != nil {
+				return err
+			}
+		case wireBytes:
+			length, size := binary.Uvarint(msg)
+			if size <= 0 || uint64(len(msg)-size) < length {
+				return errTruncated
+			}
+			data := msg[size : size+int(length)]
+			msg = msg[size+int(length):]
+			if err := fn(field, data, 0); err != nil {
+				return err
+			}
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errTruncated
+			}
+			msg = msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errTruncated
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", wire)
+		}
+	}
+	return nil
+}
+
+func (m *VersionRequest) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, _ uint64) error {
+		if field == 1 {
+			m.Version = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *VersionRequest) Marshal() []byte {
+	return appendString(nil, 1, m.Version)
+}
+
+func (m *VersionResponse) Marshal() []byte {
+	b := appendString(nil, 1, m.Version)
+	b = appendString(b, 2, m.RuntimeName)
+	return appendString(b, 3, m.RuntimeVersion)
+}
+
+func (m *VersionResponse) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, _ uint64) error {
+		switch field {
+		case 1:
+			m.Version = string(data)
+		case 2:
+			m.RuntimeName = string(data)
+		case 3:
+			m.RuntimeVersion = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *MountRequest) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, _ uint64) error {
+		switch field {
+		case 1:
+			m.Attributes = string(data)
+		case 2:
+			m.Secrets = string(data)
+		case 3:
+			m.TargetPath = string(data)
+		case 4:
+			m.Permission = string(data)
+		case 5:
+			var v ObjectVersion
+			if err := v.Unmarshal(data); err != nil {
+				return err
+			}
+			m.CurrentObjectVersion = append(m.CurrentObjectVersion, v)
+		}
+		return nil
+	})
+}
+
+func (m *MountRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Attributes)
+	b = appendString(b, 2, m.Secrets)
+	b = appendString(b, 3, m.TargetPath)
+	b = appendString(b, 4, m.Permission)
+	for _, v := range m.CurrentObjectVersion {
+		b = appendMessage(b, 5, v.Marshal())
+	}
+	return b
+}
+
+func (m *MountResponse) Marshal() []byte {
+	var b []byte
+	for _, v := range m.ObjectVersion {
+		b = appendMessage(b, 1, v.Marshal())
+	}
+	if m.Error != nil {
+		b = appendMessage(b, 2, appendString(nil, 1, m.Error.Code))
+	}
+	for _, f := range m.Files {
+		b = appendMessage(b, 3, f.Marshal())
+	}
+	return b
+}
+
+func (m *MountResponse) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, _ uint64) error {
+		switch field {
+		case 1:
+			var v ObjectVersion
+			if err := v.Unmarshal(data); err != nil {
+				return err
+			}
+			m.ObjectVersion = append(m.ObjectVersion, v)
+		case 2:
+			m.Error = &Error{}
+			return walk(data, func(field int, data []byte, _ uint64) error {
+				if field == 1 {
+					m.Error.Code = string(data)
+				}
+				return nil
+			})
+		case 3:
+			var f File
+			if err := f.Unmarshal(data); err != nil {
+				return err
+			}
+			m.Files = append(m.Files, f)
+		}
+		return nil
+	})
+}
+
+func (m *ObjectVersion) Marshal() []byte {
+	b := appendString(nil, 1, m.ID)
+	return appendString(b, 2, m.Version)
+}
+
+func (m *ObjectVersion) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, _ uint64) error {
+		switch field {
+		case 1:
+			m.ID = string(data)
+		case 2:
+			m.Version = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *File) Marshal() []byte {
+	b := appendString(nil, 1, m.Path)
+	// int32 is encoded as a sign-extended varint
+	b = appendVarint(b, 2, uint64(int64(m.Mode)))
+	return appendBytes(b, 3, m.Contents)
+}
+
+func (m *File) Unmarshal(b []byte) error {
+	return walk(b, func(field int, data []byte, n uint64) error {
+		switch field {
+		case 1:
+			m.Path = string(data)
+		case 2:
+			m.Mode = int32(n)
+		case 3:
+			m.Contents = append([]byte(nil), data...)
+		}
+		return nil
+	})
+}
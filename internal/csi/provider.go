@@ -0,0 +1,269 @@
+// Package csi is a provider for the Kubernetes Secrets Store CSI driver.
+// The driver calls it over gRPC on a Unix socket when a pod mounts a volume
+// of a SecretProviderClass with provider "secretly", and writes the returned
+// files into the pod's volume.
+package csi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderName is the provider field of a SecretProviderClass
+const ProviderName = "secretly"
+
+// APIVersion is the provider protocol version implemented
+const APIVersion = "v1alpha1"
+
+// attrPodNamespace is set by the driver to the namespace of the mounting pod
+const attrPodNamespace = "csi.storage.k8s.io/pod.namespace"
+
+// attrExportProfile names a stored export profile whose variables are
+// mounted as files in addition to the objects
+const attrExportProfile = "exportProfile"
+
+// Object is one entry of the "objects" parameter of a SecretProviderClass:
+//
+//	objects: |
+//	  - name: app/db-url
+//	    path: db-url
+//	  - name: app/config
+//	    key: db.password
+//	    path: db-password
+//
+// A secret is referenced by Name within the class's scope (namespaceId,
+// zoneId and environmentId parameters) or by ID. Key selects one key of a
+// json secret. Path is the file name in the volume and defaults to the name.
+type Object struct {
+	Name string `yaml:"name"`
+	ID   uint   `yaml:"id"`
+	Key  string `yaml:"key"`
+	Path string `yaml:"path"`
+}
+
+// Provider answers mount requests from the CSI driver
+type Provider struct {
+	core              *core.SecretlyCore
+	allowedNamespaces []string
+}
+
+// New creates a provider serving pods in allowedNamespaces, or in every
+// namespace when the list contains "*"
+func New(c *core.SecretlyCore, allowedNamespaces []string) *Provider {
+	return &Provider{core: c, allowedNamespaces: allowedNamespaces}
+}
+
+// Version reports the protocol version and runtime to the driver
+func (p *Provider) Version(*VersionRequest) *VersionResponse {
+	version := "devel"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	return &VersionResponse{Version: APIVersion, RuntimeName: ProviderName, RuntimeVersion: version}
+}
+
+// Mount reads the objects listed in the request attributes and returns them
+// as files. Every mount and rotation poll reads the secrets again, so
+// secrets with max reads cannot be mounted.
+func (p *Provider) Mount(ctx context.Context, req *MountRequest) (*MountResponse, error) {
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(req.Attributes), &attrs); err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "invalid attributes: %v", err)
+	}
+
+	podNamespace := attrs[attrPodNamespace]
+	if !slices.Contains(p.allowedNamespaces, "*") && !slices.Contains(p.allowedNamespaces, podNamespace) {
+		return nil, statusErrorf(codePermissionDenied, "namespace %q is not allowed to mount secrets: add it to csi.allowed_namespaces", podNamespace)
+	}
+
+	filter, err := scopeFilter(attrs)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	if err := yaml.Unmarshal([]byte(attrs["objects"]), &objects); err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "invalid objects parameter: %v", err)
+	}
+	if len(objects) == 0 && attrs[attrExportProfile] == "" {
+		return nil, statusErrorf(codeInvalidArgument, "the objects parameter lists no secrets")
+	}
+
+	mode := int32(0644)
+	if req.Permission != "" {
+		perm, err := strconv.ParseInt(req.Permission, 10, 32)
+		if err != nil {
+			return nil, statusErrorf(codeInvalidArgument, "invalid permission %q", req.Permission)
+		}
+		mode = int32(perm)
+	}
+
+	resp := &MountResponse{}
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		file, version, err := p.readObject(ctx, filter, obj)
+		if err != nil {
+			return nil, err
+		}
+		if seen[file.Path] {
+			return nil, statusErrorf(codeInvalidArgument, "more than one object is written to %q", file.Path)
+		}
+		seen[file.Path] = true
+		file.Mode = mode
+		resp.Files = append(resp.Files, *file)
+		resp.ObjectVersion = append(resp.ObjectVersion, ObjectVersion{ID: file.Path, Version: version})
+	}
+	if name := attrs[attrExportProfile]; name != "" {
+		files, versions, err := p.readProfile(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			if seen[files[i].Path] {
+				return nil, statusErrorf(codeInvalidArgument, "more than one object is written to %q", files[i].Path)
+			}
+			seen[files[i].Path] = true
+			files[i].Mode = mode
+		}
+		resp.Files = append(resp.Files, files...)
+		resp.ObjectVersion = append(resp.ObjectVersion, versions...)
+	}
+	return resp, nil
+}
+
+// readProfile returns one file per variable of a stored export profile,
+// named after the variable, so that secretObjects can sync them into a
+// Kubernetes Secret used with envFrom. The profile's own scope applies.
+func (p *Provider) readProfile(ctx context.Context, name string) ([]File, []ObjectVersion, error) {
+	ref := "exportProfile " + name
+	profile, err := p.core.GetExportProfile(ctx, name)
+	if err != nil {
+		return nil, nil, objectError(ref, err)
+	}
+	// Check before reading anything, as reads would be consumed
+	secrets, _, err := p.core.ListSecrets(ctx, profile.Scope())
+	if err != nil {
+		return nil, nil, err
+	}
+	mapping := profile.Mapping()
+	for _, secret := range secrets {
+		if _, ok := mapping.KeyFor(secret.Name); ok && secret.MaxReads != nil {
+			return nil, nil, statusErrorf(codeInvalidArgument, "%s: secret %q has max reads and cannot be mounted", ref, secret.Name)
+		}
+	}
+
+	vars, err := p.core.ExportProfileVars(ctx, profile)
+	if err != nil {
+		if errors.Is(err, core.ErrInvalidProfile) {
+			return nil, nil, statusErrorf(codeInvalidArgument, "%s: %v", ref, err)
+		}
+		return nil, nil, objectError(ref, err)
+	}
+
+	files := make([]File, 0, len(vars))
+	versions := make([]ObjectVersion, 0, len(vars))
+	for _, v := range vars {
+		state, err := p.core.GetSecretState(ctx, v.SecretID)
+		if err != nil {
+			return nil, nil, objectError(ref, err)
+		}
+		files = append(files, File{Path: v.Key, Contents: v.Value})
+		versions = append(versions, ObjectVersion{ID: v.Key, Version: strconv.Itoa(state.Version)})
+	}
+	return files, versions, nil
+}
+
+// readObject returns the file for obj and the secret version it was read
+// from
+func (p *Provider) readObject(ctx context.Context, filter *core.ListSecretsFilter, obj Object) (*File, string, error) {
+	id := obj.ID
+	ref := obj.Name
+	if id == 0 {
+		if obj.Name == "" {
+			return nil, "", statusErrorf(codeInvalidArgument, "every object needs a name or an id")
+		}
+		secret, alias, err := p.core.ResolveSecretName(ctx, filter, obj.Name)
+		if err != nil {
+			return nil, "", objectError(ref, err)
+		}
+		if alias != nil {
+			log.Printf("⚠️  CSI object %s uses the former name of secret %q (id %d); it stops resolving at %s",
+				ref, secret.Name, secret.ID, alias.ExpiresAt.Format(time.RFC3339))
+		}
+		id = secret.ID
+	} else if ref == "" {
+		ref = strconv.FormatUint(uint64(id), 10)
+	}
+
+	path := obj.Path
+	if path == "" {
+		path = obj.Name
+	}
+	if path == "" || !filepath.IsLocal(path) {
+		return nil, "", statusErrorf(codeInvalidArgument, "object %s: path %q must be relative and stay within the volume", ref, path)
+	}
+
+	state, err := p.core.GetSecretState(ctx, id)
+	if err != nil {
+		return nil, "", objectError(ref, err)
+	}
+	if state.Secret.MaxReads != nil {
+		return nil, "", statusErrorf(codeInvalidArgument, "object %s: secrets with max reads cannot be mounted", ref)
+	}
+
+	var value []byte
+	if obj.Key != "" {
+		value, err = p.core.GetSecretKey(ctx, id, obj.Key)
+	} else {
+		value, err = p.core.GetSecretValue(ctx, id)
+	}
+	if err != nil {
+		return nil, "", objectError(ref, err)
+	}
+	return &File{Path: filepath.ToSlash(filepath.Clean(path)), Contents: value}, strconv.Itoa(state.Version), nil
+}
+
+func objectError(ref string, err error) error {
+	switch {
+	case errors.Is(err, core.ErrNotFound):
+		return statusErrorf(codeNotFound, "object %s: %v", ref, err)
+	case errors.Is(err, core.ErrNotStructured):
+		return statusErrorf(codeInvalidArgument, "object %s: %v", ref, err)
+	case errors.Is(err, core.ErrPermissionDenied):
+		return statusErrorf(codePermissionDenied, "object %s: %v", ref, err)
+	case errors.Is(err, core.ErrExpired):
+		return statusErrorf(codeFailedPrecondition, "object %s: %v", ref, err)
+	}
+	return fmt.Errorf("object %s: %w", ref, err)
+}
+
+// scopeFilter reads the namespaceId, zoneId and environmentId parameters
+func scopeFilter(attrs map[string]string) (*core.ListSecretsFilter, error) {
+	filter := &core.ListSecretsFilter{}
+	for name, dst := range map[string]*uint{
+		"namespaceId":   &filter.NamespaceID,
+		"zoneId":        &filter.ZoneID,
+		"environmentId": &filter.EnvironmentID,
+	} {
+		raw := attrs[name]
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, statusErrorf(codeInvalidArgument, "invalid %s %q", name, raw)
+		}
+		*dst = uint(n)
+	}
+	return filter, nil
+}
@@ -0,0 +1,319 @@
+// Package device issues and checks machine identities. A machine creates a
+// key and a certificate signing request, which proves it holds the key; the
+// server's device CA signs it. Later the machine logs in by signing a
+// server challenge with the same key.
+package device
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalid wraps every rejected CSR, certificate or signature
+var ErrInvalid = errors.New("invalid device credential")
+
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// Certificate is a device certificate issued by a CA
+type Certificate struct {
+	PEM         []byte
+	Serial      string
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+// CA signs device certificates
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+// NewKey generates a device key and a certificate signing request for it
+func NewKey(name string) (keyPEM, csrPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate device key: %w", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// NewCA generates a self-signed device CA
+func NewCA(name string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// LoadCA parses a CA created by NewCA
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, certPEM: certPEM, key: key}, nil
+}
+
+// CertificatePEM returns the CA certificate
+func (ca *CA) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// Issue checks that the CSR is signed by its own key and returns a client
+// certificate for that key valid for ttl
+func (ca *CA) Issue(csrPEM []byte, ttl time.Duration) (*Certificate, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("%w: expected a PEM certificate request", ErrInvalid)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: certificate request signature: %v", ErrInvalid, err)
+	}
+	if _, ok := csr.PublicKey.(*ecdsa.PublicKey); !ok {
+		return nil, fmt.Errorf("%w: only ECDSA device keys are supported", ErrInvalid)
+	}
+	fingerprint, err := Fingerprint(csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue device certificate: %w", err)
+	}
+	return &Certificate{
+		PEM:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Serial:      serial.Text(16),
+		Fingerprint: fingerprint,
+		NotAfter:    tmpl.NotAfter,
+	}, nil
+}
+
+// Verify checks that certPEM was issued by the CA and is valid now, and
+// returns it with the fingerprint of its key
+func (ca *CA) Verify(certPEM []byte) (*x509.Certificate, string, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, "", err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	fingerprint, err := Fingerprint(cert.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return cert, fingerprint, nil
+}
+
+// Sign signs a login challenge with the device key
+func Sign(keyPEM []byte, challenge string) ([]byte, error) {
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	digest := challengeDigest(challenge)
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+// VerifySignature checks a login challenge signature made with the key of
+// cert
+func VerifySignature(cert *x509.Certificate, challenge string, signature []byte) error {
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: only ECDSA device keys are supported", ErrInvalid)
+	}
+	digest := challengeDigest(challenge)
+	if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+		return fmt.Errorf("%w: bad challenge signature", ErrInvalid)
+	}
+	return nil
+}
+
+// Fingerprint is the hex SHA-256 of a public key in PKIX form
+func Fingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// challengeDigest binds signatures to device logins so the key cannot be
+// tricked into signing anything else
+func challengeDigest(challenge string) [32]byte {
+	return sha256.Sum256([]byte("secretly-device-login\n" + challenge))
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: expected a PEM certificate", ErrInvalid)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return cert, nil
+}
+
+func parseKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("expected a PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an ECDSA private key")
+	}
+	return key, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// Identity is what an enrolled machine keeps for one server
+type Identity struct {
+	DeviceID   uint      `json:"device_id"`
+	KeyPEM     string    `json:"key"`
+	CertPEM    string    `json:"certificate"`
+	CACertPEM  string    `json:"ca_certificate"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// DefaultPath is ~/.secretly/device.json
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secretly", "device.json"), nil
+}
+
+// SaveIdentity stores the identity for server in a file only the user can
+// read, next to the identities for other servers
+func SaveIdentity(path, server string, id *Identity) error {
+	identities, err := readIdentities(path)
+	if err != nil {
+		return err
+	}
+	identities[server] = id
+	data, err := json.MarshalIndent(identities, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// LoadIdentity returns the identity stored for server
+func LoadIdentity(path, server string) (*Identity, error) {
+	identities, err := readIdentities(path)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := identities[server]
+	if !ok {
+		return nil, fmt.Errorf("this machine is not enrolled with %s: run 'secretly device enroll'", server)
+	}
+	return id, nil
+}
+
+func readIdentities(path string) (map[string]*Identity, error) {
+	identities := make(map[string]*Identity)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return identities, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &identities); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return identities, nil
+}
@@ -0,0 +1,60 @@
+package device
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnrollAndLogin(t *testing.T) {
+	caCert, caKey, err := NewCA("Secretly device CA")
+	if err != nil {
+		t.Fatalf("NewCA failed: %v", err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatalf("LoadCA failed: %v", err)
+	}
+	keyPEM, csrPEM, err := NewKey("build-01")
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	cert, err := ca.Issue(csrPEM, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	parsed, fingerprint, err := ca.Verify(cert.PEM)
+	if err != nil || fingerprint != cert.Fingerprint || parsed.Subject.CommonName != "build-01" {
+		t.Fatalf("Verify = %q, %v", fingerprint, err)
+	}
+	sig, err := Sign(keyPEM, "challenge")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := VerifySignature(parsed, "challenge", sig); err != nil {
+		t.Errorf("VerifySignature failed: %v", err)
+	}
+	if err := VerifySignature(parsed, "other", sig); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a signature over another challenge to fail, got %v", err)
+	}
+
+	// Certificates from another CA are rejected
+	otherCert, otherKey, _ := NewCA("other")
+	other, _ := LoadCA(otherCert, otherKey)
+	if _, _, err := other.Verify(cert.PEM); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a foreign certificate to fail, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "device.json")
+	if err := SaveIdentity(path, "https://a.example.com", &Identity{DeviceID: 7, KeyPEM: string(keyPEM)}); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	if id, err := LoadIdentity(path, "https://a.example.com"); err != nil || id.DeviceID != 7 {
+		t.Errorf("LoadIdentity = %+v, %v", id, err)
+	}
+	if _, err := LoadIdentity(path, "https://b.example.com"); err == nil {
+		t.Error("Expected no identity for another server")
+	}
+}
@@ -0,0 +1,360 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/encryption"
+	"github.com/secretlyhq/secretly/internal/engine"
+	"github.com/secretlyhq/secretly/internal/faults"
+	"github.com/secretlyhq/secretly/internal/mail"
+	"github.com/secretlyhq/secretly/internal/notify"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/pii"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"gorm.io/gorm"
+)
+
+// DryRun makes NewApp run the core in a database transaction that Close
+// rolls back, so commands go through validation and policy checks without
+// persisting anything. The --dry-run flag sets it.
+var DryRun bool
+
+// Replica makes NewApp serve a read-only replica of the database, as
+// server.replica.enabled does. The server's --replica flag sets it.
+var Replica bool
+
+// App bundles the components built from a configuration file
+type App struct {
+	Config     *config.Config
+	DB         *gorm.DB
+	Encryption *encryption.Service
+	Core       *core.SecretlyCore
+
+	// GRPC serves the gRPC services on the server's port, passed to
+	// Server.SetGRPCHandler
+	GRPC http.Handler
+
+	// notifier delivers notifications until Close
+	notifier *notify.Router
+
+	// dryRun is the transaction of a dry run and lastEvent the newest audit
+	// event before it began
+	dryRun    *gorm.DB
+	lastEvent uint
+}
+
+// NewApp loads the configuration, opens and migrates the database, initializes
+// encryption and builds the core. Relative paths are resolved against the
+// working directory.
+func NewApp(configPath string) (*App, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if err := encryption.EnforcePolicy(cfg); err != nil {
+		return nil, fmt.Errorf("crypto policy violation: %w", err)
+	}
+
+	// A replica's database is written by replication only, so it is
+	// neither migrated nor indexed here
+	if Replica {
+		cfg.Server.Replica.Enabled = true
+	}
+	replica := cfg.Server.Replica.Enabled
+	open := storage.OpenSQLite
+	if replica {
+		open = storage.OpenSQLiteReadOnly
+	}
+	db, err := open(cfg.Storage.Database.Path)
+	if err != nil {
+		return nil, err
+	}
+	app := &App{Config: cfg, DB: db}
+
+	var injector *faults.Injector
+	if cfg.Faults.Enabled {
+		if injector, err = faults.New(faults.ConfigRules(cfg.Faults.Rules)); err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid fault injection configuration: %w", err)
+		}
+		if err := faults.InstallGORM(db, injector); err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("failed to install fault injection: %w", err)
+		}
+		log.Printf("⚠️  Fault injection is enabled with %d rules; do not use this build in production", len(cfg.Faults.Rules))
+	}
+
+	var encryptor core.Encryptor
+	if cfg.Storage.Encryption.Enabled {
+		baseDir, _ := os.Getwd()
+		app.Encryption = encryption.NewService(&cfg.Storage.Encryption, baseDir)
+		if err := app.Encryption.Initialize(); err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("failed to initialize encryption: %w", err)
+		}
+		encryptor = app.Encryption
+		if injector != nil {
+			encryptor = faults.WrapEncryptor(app.Encryption, injector)
+		}
+	}
+
+	store := storage.NewLocalStorage(db)
+	if DryRun {
+		if store, err = app.beginDryRun(); err != nil {
+			_ = app.Close()
+			return nil, err
+		}
+	}
+	var personal *pii.Storage
+	if cfg.Storage.Encryption.EncryptPII {
+		if encryptor == nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("storage.encryption.encrypt_pii needs storage.encryption.enabled")
+		}
+		personal = pii.Wrap(store, encryptor)
+		store = personal
+	}
+	app.Core = core.NewSecretlyCore(store, encryptor)
+	app.Core.SetLocalTransport(core.TransportCLI)
+	app.Core.SetLocalActor("command line")
+	app.Core.SetChunking(cfg.Secrets.Chunking)
+	app.Core.SetCompression(cfg.Secrets.Compression)
+	app.Core.SetBurnAfterRead(cfg.Secrets.BurnAfterRead)
+	app.Core.SetSecretNames(cfg.Secrets.Names)
+	if err := app.Core.SetNamingPolicy(cfg.Secrets.Naming); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid naming policy: %w", err)
+	}
+	app.Core.SetReplica(replica, cfg.Server.Replica.PrimaryURL)
+	if !replica {
+		collisions, err := app.Core.IndexSecretNames(context.Background())
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("failed to index secret names: %w", err)
+		}
+		if len(collisions) > 0 {
+			log.Printf("⚠️  %d secret names collide with others in their scope; run 'secretly secret collisions'", len(collisions))
+		}
+		if _, err := app.Core.IndexUserEmails(context.Background()); err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("failed to index user emails: %w", err)
+		}
+		if personal != nil {
+			if _, err := personal.EncryptExisting(); err != nil {
+				_ = app.Close()
+				return nil, fmt.Errorf("failed to encrypt user emails: %w", err)
+			}
+		}
+		if err := app.Core.SeedRoleTemplates(); err != nil {
+			_ = app.Close()
+			return nil, err
+		}
+	}
+	app.Core.SetFIPSMode(cfg.Security.FIPSMode)
+	app.Core.SetApprovals(cfg.Security.Approvals)
+	app.Core.SetCheckout(cfg.Security.Checkout)
+	app.Core.SetEscrow(cfg.Security.Escrow)
+	canary := cfg.Security.Canary
+	if DryRun {
+		canary.WebhookURL = ""
+	}
+	app.Core.SetCanaryAlerts(canary)
+	if err := app.Core.SetNetworkPolicy(cfg.Security.NetworkPolicy); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid network policy: %w", err)
+	}
+	if err := app.Core.SetAuditQueue(cfg.Storage.Audit); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid audit configuration: %w", err)
+	}
+	if err := app.Core.SetMaintenance(cfg.Server.Maintenance); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid maintenance configuration: %w", err)
+	}
+	if err := app.Core.SetOIDC(cfg.Auth.OIDC); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid OIDC configuration: %w", err)
+	}
+	if err := app.Core.SetTwoFactor(cfg.Auth.TwoFactor); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid two-factor configuration: %w", err)
+	}
+	if err := app.Core.SetWebAuthn(cfg.Auth.WebAuthn); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid WebAuthn configuration: %w", err)
+	}
+	app.Core.SetDevices(cfg.Auth.Devices)
+	app.Core.SetImpersonation(cfg.Auth.Impersonation)
+	if cfg.Engines.Enabled {
+		if err := app.loadEngines(); err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("failed to load secret engines: %w", err)
+		}
+	}
+	var mailer core.Mailer
+	if cfg.Auth.PasswordReset.Enabled {
+		sender, err := mail.NewSender(cfg.Auth.PasswordReset.SMTP)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid password reset configuration: %w", err)
+		}
+		mailer = dryRunMailer(sender)
+	}
+	if err := app.Core.SetPasswordReset(cfg.Auth.PasswordReset, mailer); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("invalid password reset configuration: %w", err)
+	}
+	var lifecycleMailer core.Mailer
+	if cfg.Secrets.Lifecycle.Enabled && cfg.Secrets.Lifecycle.SMTP.Host != "" {
+		sender, err := mail.NewSender(cfg.Secrets.Lifecycle.SMTP)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid secret lifecycle configuration: %w", err)
+		}
+		lifecycleMailer = dryRunMailer(sender)
+	}
+	app.Core.SetLifecycle(cfg.Secrets.Lifecycle, lifecycleMailer)
+	var staleMailer core.Mailer
+	if cfg.Secrets.Stale.Enabled && cfg.Secrets.Stale.SMTP.Host != "" {
+		sender, err := mail.NewSender(cfg.Secrets.Stale.SMTP)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid stale secret configuration: %w", err)
+		}
+		staleMailer = dryRunMailer(sender)
+	}
+	app.Core.SetStalePolicy(cfg.Secrets.Stale, staleMailer)
+	var releaseMailer core.Mailer
+	if cfg.Secrets.Releases.Enabled && cfg.Secrets.Releases.SMTP.Host != "" {
+		sender, err := mail.NewSender(cfg.Secrets.Releases.SMTP)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid scheduled release configuration: %w", err)
+		}
+		releaseMailer = dryRunMailer(sender)
+	}
+	app.Core.SetReleases(cfg.Secrets.Releases, releaseMailer)
+	app.Core.SetGitOps(cfg.Secrets.GitOps)
+	app.Core.SetDiagnostics(cfg.Server.Debug.Enabled)
+	app.Core.SetFaults(injector)
+	if cfg.Secrets.Cache.Enabled {
+		app.Core.EnableValueCache(cfg.Secrets.Cache)
+	}
+	if cfg.Notifications.Enabled && !DryRun {
+		router, err := notify.New(cfg.Notifications)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("invalid notifications configuration: %w", err)
+		}
+		app.notifier = router
+		app.Core.SetNotifier(router)
+	}
+	app.GRPC = app.grpcServices()
+	return app, nil
+}
+
+// Close writes queued audit events, delivers pending notifications, wipes
+// keys from memory and closes the database. A dry run is rolled back
+// first, listing the changes it would have made.
+func (a *App) Close() error {
+	if a.Core != nil {
+		a.Core.CloseAudit()
+	}
+	if a.dryRun != nil {
+		a.endDryRun()
+	}
+	if a.notifier != nil {
+		a.Core.SetNotifier(nil)
+		a.notifier.Close()
+	}
+	if a.Encryption != nil {
+		a.Encryption.Shutdown()
+	}
+	if a.DB != nil {
+		sqlDB, err := a.DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+	return nil
+}
+
+// loadEngines discovers the secret engine plugins in engines.dir, each
+// sandboxed with its own settings
+func (a *App) loadEngines() error {
+	cfg := a.Config.Engines
+	if cfg.Dir == "" {
+		return fmt.Errorf("engines.dir is required")
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	sandboxes := make(map[string]engine.Sandbox, len(cfg.Plugins))
+	users := make(map[string][]string, len(cfg.Plugins))
+	for name, plugin := range cfg.Plugins {
+		sandboxes[name] = engine.Sandbox{Config: plugin.Config, Timeout: timeout}
+		users[name] = plugin.Users
+	}
+	registry, err := engine.Discover(context.Background(), cfg.Dir, sandboxes)
+	if err != nil {
+		return err
+	}
+	a.Core.SetEngines(registry, users)
+	return nil
+}
+
+// beginDryRun opens the transaction the core of a dry run works in
+func (a *App) beginDryRun() (storage.Storage, error) {
+	tx := a.DB.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to start dry run: %w", tx.Error)
+	}
+	a.dryRun = tx
+	store := storage.NewLocalStorage(tx)
+	last, err := store.Audit().ListAfter(repository.AuditQuery{Descending: true, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dry run: %w", err)
+	}
+	if len(last) == 1 {
+		a.lastEvent = last[0].ID
+	}
+	return store, nil
+}
+
+// endDryRun prints the audit events recorded during the dry run, which
+// describe its changes, and rolls it back
+func (a *App) endDryRun() {
+	events, err := storage.NewLocalStorage(a.dryRun).Audit().ListAfter(repository.AuditQuery{AfterID: a.lastEvent})
+	a.dryRun.Rollback()
+	a.dryRun = nil
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "🧪 Dry run: nothing was saved (failed to list the changes: %v)\n", err)
+	case len(events) == 0:
+		fmt.Fprintln(os.Stderr, "🧪 Dry run: nothing would change")
+	default:
+		fmt.Fprintln(os.Stderr, "🧪 Dry run: nothing was saved. The command would have:")
+		for _, e := range events {
+			fmt.Fprintf(os.Stderr, "   - %s\n", e.Description)
+		}
+	}
+}
+
+// dryRunMailer drops mail during a dry run
+func dryRunMailer(sender core.Mailer) core.Mailer {
+	if DryRun {
+		return discardMailer{}
+	}
+	return sender
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(to, subject, body string) error { return nil }
@@ -0,0 +1,157 @@
+package di
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// healthCheckMethod is the method of the standard gRPC health service,
+// which load balancers and Kubernetes gRPC probes call
+const healthCheckMethod = "/grpc.health.v1.Health/Check"
+
+// grpcHealthTimeout bounds the checks behind one health call
+const grpcHealthTimeout = 2 * time.Second
+
+// maxHealthRequestSize bounds a health request, which only carries a
+// service name
+const maxHealthRequestSize = 4 << 10
+
+// Serving statuses of grpc.health.v1.HealthCheckResponse
+const (
+	healthServing    = 1
+	healthNotServing = 2
+)
+
+// gRPC status codes used by the health service
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+)
+
+// grpcServices serves grpc.health.v1.Health/Check, which reports SERVING
+// when the database, encryption and migrations checks pass. The empty
+// service name and "secretly" are known; Watch is not implemented.
+func (a *App) grpcServices() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		if r.URL.Path != healthCheckMethod {
+			writeGRPCStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+		msg, err := readGRPCFrame(r.Body)
+		if err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+			return
+		}
+		service, err := healthService(msg)
+		if err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+			return
+		}
+		if service != "" && service != "secretly" {
+			writeGRPCStatus(w, grpcNotFound, "unknown service "+service)
+			return
+		}
+
+		status := healthServing
+		if err := a.checkHealth(r.Context()); err != nil {
+			status = healthNotServing
+		}
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		if err := writeGRPCFrame(w, []byte{0x08, byte(status)}); err != nil {
+			return
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(grpcOK))
+	})
+}
+
+// checkHealth runs the checks the server's /readyz runs
+func (a *App) checkHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, grpcHealthTimeout)
+	defer cancel()
+	for _, check := range []func(context.Context) error{a.CheckDatabase, a.CheckEncryption, a.CheckMigrations} {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// healthService decodes the service name, field 1, of a
+// grpc.health.v1.HealthCheckRequest, skipping unknown fields
+func healthService(msg []byte) (string, error) {
+	var service string
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return "", errors.New("malformed health request")
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(msg); n <= 0 {
+				return "", errors.New("malformed health request")
+			}
+			msg = msg[n:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return "", errors.New("malformed health request")
+			}
+			if key>>3 == 1 {
+				service = string(msg[n : n+int(size)])
+			}
+			msg = msg[n+int(size):]
+		default:
+			return "", fmt.Errorf("unsupported wire type %d in health request", key&7)
+		}
+	}
+	return service, nil
+}
+
+// writeGRPCStatus sends a trailers-only response carrying the status
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// readGRPCFrame reads one length-prefixed gRPC message
+func readGRPCFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxHealthRequestSize {
+		return nil, fmt.Errorf("request of %d bytes exceeds the %d byte limit", size, maxHealthRequestSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+	return msg, nil
+}
+
+func writeGRPCFrame(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
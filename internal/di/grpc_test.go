@@ -0,0 +1,63 @@
+package di
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/secretlyhq/secretly/internal/server"
+)
+
+func TestGRPCHealthThroughServer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config := "storage:\n  database:\n    path: secretly.db\nserver:\n  http:\n    enabled: true\n    protocol_versions: [\"HTTP/1.1\", \"h2c\"]\n"
+	if err := os.WriteFile("secretly.yaml", []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	app, err := NewApp("secretly.yaml")
+	if err != nil {
+		t.Fatalf("Failed to build app: %v", err)
+	}
+	defer app.Close()
+
+	srv := server.New(app.Core, app.Config.Server.HTTP)
+	srv.SetGRPCHandler(app.GRPC)
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	call := func(method string, msg []byte) (*http.Response, []byte) {
+		frame := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+method, bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("gRPC request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		return resp, body.Bytes()
+	}
+
+	resp, body := call("/grpc.health.v1.Health/Check", nil)
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" || !bytes.Equal(body, []byte{0, 0, 0, 0, 2, 0x08, healthServing}) {
+		t.Fatalf("Expected SERVING, got status %q and body %v", status, body)
+	}
+	resp, _ = call("/grpc.health.v1.Health/Check", append([]byte{0x0a, 5}, "other"...))
+	if status := resp.Header.Get("Grpc-Status"); status != "5" {
+		t.Errorf("Expected NOT_FOUND for an unknown service, got %q", status)
+	}
+	resp, _ = call("/secretly.v1.Secrets/Get", nil)
+	if status := resp.Header.Get("Grpc-Status"); status != "16" {
+		t.Errorf("Expected other methods to need a session, got %q", status)
+	}
+}
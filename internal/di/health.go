@@ -0,0 +1,40 @@
+package di
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+)
+
+// CheckDatabase pings the database
+func (a *App) CheckDatabase(ctx context.Context) error {
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CheckEncryption fails when encryption is enabled but its keys are not
+// loaded
+func (a *App) CheckEncryption(ctx context.Context) error {
+	if !a.Config.Storage.Encryption.Enabled {
+		return nil
+	}
+	if a.Encryption == nil || !a.Encryption.IsInitialized() {
+		return fmt.Errorf("encryption is enabled but not initialized")
+	}
+	return nil
+}
+
+// CheckMigrations fails when a model's table is missing from the database
+func (a *App) CheckMigrations(ctx context.Context) error {
+	migrator := a.DB.WithContext(ctx).Migrator()
+	for _, model := range storage.Models() {
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table for %T is missing", model)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package dockerenv renders secrets into Docker env_files and Compose secret
+// files for local development.
+package dockerenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/securefiles"
+)
+
+// FileMode is applied to every rendered file
+const FileMode os.FileMode = 0600
+
+var (
+	nonEnvChars  = regexp.MustCompile(`[^A-Z0-9_]+`)
+	nonFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// Entry is one secret to render
+type Entry struct {
+	// Key is the environment variable name, e.g. DB_PASSWORD
+	Key   string
+	Value []byte
+}
+
+// ServiceSecretName reports whether a secret belongs to service and returns
+// its name without the "<service>/" prefix
+func ServiceSecretName(service, name string) (string, bool) {
+	prefix := service + "/"
+	if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, prefix), true
+}
+
+// EnvKey converts a secret name into an environment variable name, e.g.
+// "db-password" becomes DB_PASSWORD
+func EnvKey(name string) string {
+	key := nonEnvChars.ReplaceAllString(strings.ToUpper(name), "_")
+	key = strings.Trim(key, "_")
+	if key != "" && key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+	return key
+}
+
+// FormatEnvFile renders entries in the env_file format understood by both
+// `docker run --env-file` and Compose. Values containing newlines cannot be
+// represented and are rejected; render them as secret files instead.
+func FormatEnvFile(entries []Entry) ([]byte, error) {
+	sorted := append([]Entry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	var b strings.Builder
+	for _, e := range sorted {
+		if strings.ContainsAny(string(e.Value), "\r\n") {
+			return nil, fmt.Errorf("value of %s spans multiple lines; use secret files instead", e.Key)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", e.Key, e.Value)
+	}
+	return []byte(b.String()), nil
+}
+
+// WriteEnvFile writes entries to path with owner-only permissions
+func WriteEnvFile(path string, entries []Entry) error {
+	data, err := FormatEnvFile(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return writeFile(filepath.Dir(path), path, data)
+}
+
+// WriteSecretFiles writes each entry to its own file in dir, named after the
+// lower-cased key, as expected by Compose `secrets: file:` entries. It
+// returns the written paths keyed by entry key.
+func WriteSecretFiles(dir string, entries []Entry) (map[string]string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	paths := make(map[string]string, len(entries))
+	for _, e := range entries {
+		path := filepath.Join(dir, SecretFileName(e.Key))
+		if err := writeFile(dir, path, e.Value); err != nil {
+			return paths, err
+		}
+		paths[e.Key] = path
+	}
+	return paths, nil
+}
+
+// SecretFileName is the file and Compose secret name used for a key
+func SecretFileName(key string) string {
+	return nonFileChars.ReplaceAllString(strings.ToLower(key), "_")
+}
+
+// ComposeSnippet returns the top-level `secrets:` block referencing files
+// written by WriteSecretFiles
+func ComposeSnippet(service string, paths map[string]string) string {
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("services:\n")
+	fmt.Fprintf(&b, "  %s:\n    secrets:\n", service)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "      - %s\n", SecretFileName(k))
+	}
+	b.WriteString("secrets:\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "  %s:\n    file: %s\n", SecretFileName(k), paths[k])
+	}
+	return b.String()
+}
+
+// Remove overwrites rendered files with zeros before deleting them
+func Remove(paths ...string) error {
+	var firstErr error
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			_ = os.WriteFile(path, make([]byte, info.Size()), FileMode)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return firstErr
+}
+
+// writeFile writes inside baseDir and enforces FileMode even when the file
+// already existed with wider permissions
+func writeFile(baseDir, path string, data []byte) error {
+	if err := securefiles.SecureWriteFile(baseDir, path, data, FileMode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(path, FileMode); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package dockerenv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceSecretsRendering(t *testing.T) {
+	if name, ok := ServiceSecretName("api", "api/db-password"); !ok || EnvKey(name) != "DB_PASSWORD" {
+		t.Errorf("Expected DB_PASSWORD, got %q (%v)", EnvKey(name), ok)
+	}
+	if _, ok := ServiceSecretName("api", "worker/db-password"); ok {
+		t.Error("Expected secret of another service to be skipped")
+	}
+
+	dir := t.TempDir()
+	entries := []Entry{{Key: "TOKEN", Value: []byte("abc")}, {Key: "DB_PASSWORD", Value: []byte("p=w")}}
+
+	envFile := filepath.Join(dir, "api.env")
+	if err := WriteEnvFile(envFile, entries); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	data, _ := os.ReadFile(envFile)
+	if string(data) != "DB_PASSWORD=p=w\nTOKEN=abc\n" {
+		t.Errorf("Unexpected env file content %q", data)
+	}
+	if info, _ := os.Stat(envFile); info.Mode().Perm() != FileMode {
+		t.Errorf("Expected mode %o, got %o", FileMode, info.Mode().Perm())
+	}
+
+	if _, err := FormatEnvFile([]Entry{{Key: "CERT", Value: []byte("a\nb")}}); err == nil {
+		t.Error("Expected multi-line value to be rejected for env files")
+	}
+
+	paths, err := WriteSecretFiles(filepath.Join(dir, "api"), entries)
+	if err != nil {
+		t.Fatalf("Failed to write secret files: %v", err)
+	}
+	if !strings.Contains(ComposeSnippet("api", paths), "db_password:\n    file: ") {
+		t.Errorf("Unexpected compose snippet:\n%s", ComposeSnippet("api", paths))
+	}
+
+	if err := Remove(envFile, paths["TOKEN"], paths["DB_PASSWORD"]); err != nil {
+		t.Fatalf("Failed to remove files: %v", err)
+	}
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Error("Expected env file to be removed")
+	}
+}
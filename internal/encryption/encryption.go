@@ -3,9 +3,11 @@ package encryption
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,6 +32,9 @@ type EncryptionMetadata struct {
 	Iterations  int       `json:"iterations,omitempty"`
 	ChunkIndex  int       `json:"chunk_index,omitempty"`
 	TotalChunks int       `json:"total_chunks,omitempty"`
+	// BoundChunk marks chunks whose index and total are authenticated as
+	// additional data; chunks written before that are decrypted without it
+	BoundChunk bool `json:"bound_chunk,omitempty"`
 }
 
 // EncryptedData represents encrypted content with metadata
@@ -79,12 +84,17 @@ func GenerateRandomKey(size int) ([]byte, error) {
 
 // Encrypt encrypts data using AES-GCM with the KEK
 func (es *EncryptionService) Encrypt(plaintext []byte, keyVersion string) (*EncryptedData, error) {
+	return es.seal(plaintext, keyVersion, nil)
+}
+
+// seal encrypts plaintext, authenticating additionalData with it
+func (es *EncryptionService) seal(plaintext []byte, keyVersion string, additionalData []byte) (*EncryptedData, error) {
 	nonce := make([]byte, es.gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := es.gcm.Seal(nil, nonce, plaintext, nil)
+	ciphertext := es.gcm.Seal(nil, nonce, plaintext, additionalData)
 
 	metadata := EncryptionMetadata{
 		Algorithm:   "AES-256-GCM",
@@ -101,6 +111,11 @@ func (es *EncryptionService) Encrypt(plaintext []byte, keyVersion string) (*Encr
 
 // Decrypt decrypts data using AES-GCM with the KEK
 func (es *EncryptionService) Decrypt(encryptedData *EncryptedData) ([]byte, error) {
+	return es.open(encryptedData, nil)
+}
+
+// open decrypts encryptedData, checking the additionalData it was sealed with
+func (es *EncryptionService) open(encryptedData *EncryptedData, additionalData []byte) ([]byte, error) {
 	if encryptedData.Metadata.Algorithm != "AES-256-GCM" {
 		return nil, fmt.Errorf("unsupported algorithm: %s", encryptedData.Metadata.Algorithm)
 	}
@@ -110,7 +125,7 @@ func (es *EncryptionService) Decrypt(encryptedData *EncryptedData) ([]byte, erro
 		return nil, fmt.Errorf("failed to decode nonce: %w", err)
 	}
 
-	plaintext, err := es.gcm.Open(nil, nonce, encryptedData.Data, nil)
+	plaintext, err := es.gcm.Open(nil, nonce, encryptedData.Data, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt data: %w", err)
 	}
@@ -134,7 +149,7 @@ func (es *EncryptionService) EncryptChunked(plaintext []byte, chunkSize int, key
 		}
 
 		chunk := plaintext[i:end]
-		encryptedChunk, err := es.Encrypt(chunk, keyVersion)
+		encryptedChunk, err := es.seal(chunk, keyVersion, chunkAAD(len(chunks), totalChunks))
 		if err != nil {
 			return nil, fmt.Errorf("failed to encrypt chunk %d: %w", len(chunks), err)
 		}
@@ -142,6 +157,7 @@ func (es *EncryptionService) EncryptChunked(plaintext []byte, chunkSize int, key
 		// Add chunk metadata
 		encryptedChunk.Metadata.ChunkIndex = len(chunks)
 		encryptedChunk.Metadata.TotalChunks = totalChunks
+		encryptedChunk.Metadata.BoundChunk = true
 
 		chunks = append(chunks, encryptedChunk)
 	}
@@ -164,10 +180,14 @@ func (es *EncryptionService) DecryptChunked(chunks []*EncryptedData) ([]byte, er
 	// Sort chunks by index (in case they're out of order)
 	sortedChunks := make([]*EncryptedData, totalChunks)
 	for _, chunk := range chunks {
-		if chunk.Metadata.ChunkIndex >= totalChunks {
-			return nil, fmt.Errorf("invalid chunk index %d", chunk.Metadata.ChunkIndex)
+		index := chunk.Metadata.ChunkIndex
+		if index < 0 || index >= totalChunks || chunk.Metadata.TotalChunks != totalChunks {
+			return nil, fmt.Errorf("invalid chunk index %d of %d", index, chunk.Metadata.TotalChunks)
+		}
+		if sortedChunks[index] != nil {
+			return nil, fmt.Errorf("duplicate chunk index %d", index)
 		}
-		sortedChunks[chunk.Metadata.ChunkIndex] = chunk
+		sortedChunks[index] = chunk
 	}
 
 	// Decrypt and reassemble
@@ -177,7 +197,11 @@ func (es *EncryptionService) DecryptChunked(chunks []*EncryptedData) ([]byte, er
 			return nil, fmt.Errorf("missing chunk at index %d", i)
 		}
 
-		decrypted, err := es.Decrypt(chunk)
+		var additionalData []byte
+		if chunk.Metadata.BoundChunk {
+			additionalData = chunkAAD(i, totalChunks)
+		}
+		decrypted, err := es.open(chunk, additionalData)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt chunk %d: %w", i, err)
 		}
@@ -188,6 +212,15 @@ func (es *EncryptionService) DecryptChunked(chunks []*EncryptedData) ([]byte, er
 	return result, nil
 }
 
+// chunkAAD is the additional data a chunk is sealed with, so that chunks
+// cannot be reordered, duplicated or moved to a shorter or longer set
+func chunkAAD(index, total int) []byte {
+	aad := make([]byte, 16)
+	binary.BigEndian.PutUint64(aad, uint64(index))
+	binary.BigEndian.PutUint64(aad[8:], uint64(total))
+	return aad
+}
+
 // SerializeEncryptedData converts EncryptedData to JSON bytes
 func SerializeEncryptedData(data *EncryptedData) ([]byte, error) {
 	return json.Marshal(data)
@@ -202,6 +235,14 @@ func DeserializeEncryptedData(data []byte) (*EncryptedData, error) {
 	return &encrypted, nil
 }
 
+// DeriveKey derives a 32-byte key for a separate purpose (e.g. content
+// hashing) from the KEK, so the KEK itself is never reused directly
+func (es *EncryptionService) DeriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, es.kek)
+	mac.Write([]byte("secretly:" + purpose))
+	return mac.Sum(nil)
+}
+
 // RotateKey re-encrypts data with a new key version
 func (es *EncryptionService) RotateKey(encryptedData *EncryptedData, newKeyVersion string) (*EncryptedData, error) {
 	// Decrypt with current key
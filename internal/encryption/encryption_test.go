@@ -129,6 +129,41 @@ func TestChunkedEncryption(t *testing.T) {
 	}
 }
 
+func TestDecryptChunkedRejectsTampering(t *testing.T) {
+	kek, _ := GenerateRandomKey(32)
+	service, err := NewEncryptionService(kek)
+	if err != nil {
+		t.Fatalf("Failed to create encryption service: %v", err)
+	}
+	encrypt := func() []*EncryptedData {
+		chunks, err := service.EncryptChunked([]byte("abcdefghij"), 4, testKeyVersion)
+		if err != nil || len(chunks) != 3 {
+			t.Fatalf("Failed to encrypt chunked: %d chunks, %v", len(chunks), err)
+		}
+		return chunks
+	}
+
+	for name, tamper := range map[string]func([]*EncryptedData){
+		"negative index": func(c []*EncryptedData) { c[0].Metadata.ChunkIndex = -1 },
+		"index too high": func(c []*EncryptedData) { c[0].Metadata.ChunkIndex = 3 },
+		"duplicate":      func(c []*EncryptedData) { c[1] = c[0] },
+		"swapped": func(c []*EncryptedData) {
+			c[0].Metadata.ChunkIndex, c[1].Metadata.ChunkIndex = 1, 0
+		},
+		"unbound": func(c []*EncryptedData) {
+			for _, chunk := range c {
+				chunk.Metadata.BoundChunk = false
+			}
+		},
+	} {
+		chunks := encrypt()
+		tamper(chunks)
+		if _, err := service.DecryptChunked(chunks); err == nil {
+			t.Errorf("%s: expected the chunks to be rejected", name)
+		}
+	}
+}
+
 func TestSerializeDeserialize(t *testing.T) {
 	// Generate a test KEK
 	kek, err := GenerateRandomKey(32)
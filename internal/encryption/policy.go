@@ -0,0 +1,117 @@
+package encryption
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/fips140"
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/config"
+)
+
+// Crypto policy names reported by ActivePolicy
+const (
+	PolicyDefault = "default"
+	PolicyFIPS    = "fips-140-3"
+)
+
+// minRSABits is the smallest RSA modulus accepted in FIPS mode
+const minRSABits = 2048
+
+// CryptoPolicy describes which algorithms the process uses
+type CryptoPolicy struct {
+	Name string
+	// ModuleEnabled reports whether the Go FIPS 140-3 module is active
+	// (binary built with GOFIPS140 or run with GODEBUG=fips140=on)
+	ModuleEnabled bool
+	Encryption    string
+	KeyDerivation string
+	Hashing       string
+	PasswordHash  string
+	TLSKeys       string
+}
+
+// ActivePolicy returns the crypto policy selected by the configuration
+func ActivePolicy(cfg *config.Config) CryptoPolicy {
+	policy := CryptoPolicy{
+		Name:          PolicyDefault,
+		ModuleEnabled: fips140.Enabled(),
+		Encryption:    "AES-256-GCM",
+		KeyDerivation: "PBKDF2-HMAC-SHA256, HMAC-SHA256",
+		Hashing:       "SHA-256, HMAC-SHA256",
+		PasswordHash:  "bcrypt",
+		TLSKeys:       "any",
+	}
+	if cfg.Security.FIPSMode {
+		policy.Name = PolicyFIPS
+		policy.PasswordHash = "PBKDF2-HMAC-SHA256"
+		policy.TLSKeys = fmt.Sprintf("RSA >= %d bits, ECDSA P-256/P-384/P-521", minRSABits)
+	}
+	return policy
+}
+
+// EnforcePolicy checks the configuration against the active crypto policy.
+// In FIPS mode it requires the Go FIPS 140-3 module and rejects TLS keys of
+// non-approved types; in default mode it does nothing.
+func EnforcePolicy(cfg *config.Config) error {
+	if !cfg.Security.FIPSMode {
+		return nil
+	}
+	if !fips140.Enabled() {
+		return fmt.Errorf("fips_mode requires the Go FIPS 140-3 module: build with GOFIPS140=v1.0.0 or run with GODEBUG=fips140=on")
+	}
+	if cfg.Storage.Encryption.Enabled && !cfg.Storage.Encryption.UseKEK {
+		return fmt.Errorf("fips_mode requires storage.encryption.use_kek")
+	}
+
+	servers := map[string]config.ServerInstanceConfig{"http": cfg.Server.HTTP, "grpc": cfg.Server.GRPC}
+	for name, srv := range servers {
+		if !srv.Enabled || !srv.TLS.Enabled {
+			continue
+		}
+		if err := checkTLSKey(srv.TLS.CertFile, srv.TLS.KeyFile); err != nil {
+			return fmt.Errorf("%s TLS key is not FIPS compliant: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func checkTLSKey(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %w", err)
+	}
+
+	switch key := cert.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		if bits := key.N.BitLen(); bits < minRSABits {
+			return fmt.Errorf("RSA key is %d bits, at least %d required", bits, minRSABits)
+		}
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("ECDSA curve %s is not approved", key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("key type %T is not approved", cert.PrivateKey)
+	}
+	return nil
+}
+
+// FIPSTLSConfig returns a TLS configuration limited to FIPS-approved
+// versions, curves and cipher suites
+func FIPSTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	}
+}
@@ -121,6 +121,17 @@ func (s *Service) DecryptSecret(encryptedData []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// DeriveKey derives a purpose-specific key from the active KEK
+func (s *Service) DeriveKey(purpose string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.initialized {
+		return nil, fmt.Errorf("encryption service not initialized")
+	}
+	return s.encryptionService.DeriveKey(purpose), nil
+}
+
 // EncryptLargeSecret encrypts large secrets using chunking
 func (s *Service) EncryptLargeSecret(plaintext []byte, chunkSizeKB int) ([][]byte, [][]byte, error) {
 	s.mu.RLock()
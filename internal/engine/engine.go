@@ -0,0 +1,198 @@
+// Package engine runs secret engines: plugins that mint credentials on
+// demand, such as cloud IAM keys or database users, instead of storing
+// them. Third-party engines are executables in a plugins directory that
+// speak JSON over stdin and stdout (see Process); built-in or embedded
+// engines implement Engine directly and are added with Registry.Register.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is the plugin protocol this release speaks. Plugins
+// report the version they were written for in their handshake.
+const ProtocolVersion = 1
+
+// Capabilities an engine registers in its handshake. Operations it does not
+// register fail with ErrUnsupported without reaching the engine.
+const (
+	// CapabilityIssue mints a new credential for a role
+	CapabilityIssue = "issue"
+	// CapabilityRevoke invalidates a credential by its lease ID before it
+	// expires
+	CapabilityRevoke = "revoke"
+)
+
+var capabilities = []string{CapabilityIssue, CapabilityRevoke}
+
+var (
+	// ErrUnknownEngine is returned for an engine that is not registered
+	ErrUnknownEngine = errors.New("unknown secret engine")
+	// ErrUnsupported is returned for an operation the engine did not
+	// register a capability for
+	ErrUnsupported = errors.New("operation not supported by this secret engine")
+	// ErrUnknownRole is returned for a role the engine does not list
+	ErrUnknownRole = errors.New("unknown secret engine role")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Info describes an engine as reported by its handshake
+type Info struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Description  string   `json:"description,omitempty"`
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+	// Roles lists what the engine issues credentials for, e.g. IAM roles
+	// or database grants; empty when it takes any role
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Supports reports whether the engine registered capability
+func (i Info) Supports(capability string) bool {
+	return slices.Contains(i.Capabilities, capability)
+}
+
+// IssueRequest asks an engine for a credential
+type IssueRequest struct {
+	Role string `json:"role"`
+	// Params are engine-specific options, e.g. a TTL or a database name
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Credential is a credential minted by an engine. It is handed to the
+// caller and never stored.
+type Credential struct {
+	// Value holds the parts of the credential, e.g. access_key_id and
+	// secret_access_key
+	Value map[string]string `json:"value"`
+	// LeaseID identifies the credential to Revoke
+	LeaseID   string     `json:"lease_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Engine is a secret engine
+type Engine interface {
+	Info() Info
+	Issue(ctx context.Context, req IssueRequest) (*Credential, error)
+	Revoke(ctx context.Context, leaseID string) error
+}
+
+// Registry holds the engines a server offers, by name
+type Registry struct {
+	mu      sync.RWMutex
+	engines map[string]Engine
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{engines: make(map[string]Engine)}
+}
+
+// Register adds e after checking its handshake: a valid name not taken
+// yet, this release's protocol version and known capabilities
+func (r *Registry) Register(e Engine) error {
+	info := e.Info()
+	if err := validateInfo(info); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.engines[info.Name]; ok {
+		return fmt.Errorf("secret engine %q is registered twice", info.Name)
+	}
+	r.engines[info.Name] = e
+	return nil
+}
+
+func validateInfo(info Info) error {
+	if !namePattern.MatchString(info.Name) {
+		return fmt.Errorf("invalid secret engine name %q: use lowercase letters, digits, '-' and '_'", info.Name)
+	}
+	if info.Protocol != ProtocolVersion {
+		return fmt.Errorf("secret engine %q speaks protocol %d, this release speaks %d", info.Name, info.Protocol, ProtocolVersion)
+	}
+	if len(info.Capabilities) == 0 {
+		return fmt.Errorf("secret engine %q registers no capabilities", info.Name)
+	}
+	for _, c := range info.Capabilities {
+		if !slices.Contains(capabilities, c) {
+			return fmt.Errorf("secret engine %q registers unknown capability %q", info.Name, c)
+		}
+	}
+	return nil
+}
+
+// List returns the registered engines by name
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]Info, 0, len(r.engines))
+	for _, e := range r.engines {
+		infos = append(infos, e.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Lookup returns the engine called name
+func (r *Registry) Lookup(name string) (Engine, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.engines[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownEngine, name)
+	}
+	return e, nil
+}
+
+// Issue mints a credential with the engine called name, checking that it
+// registered the capability and, if it lists roles, the role
+func (r *Registry) Issue(ctx context.Context, name string, req IssueRequest) (*Credential, error) {
+	e, err := r.lookup(name, CapabilityIssue)
+	if err != nil {
+		return nil, err
+	}
+	if roles := e.Info().Roles; len(roles) > 0 && !slices.Contains(roles, req.Role) {
+		return nil, fmt.Errorf("%w %q for %q", ErrUnknownRole, req.Role, name)
+	}
+	cred, err := e.Issue(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("secret engine %q: %w", name, err)
+	}
+	return cred, nil
+}
+
+// Revoke invalidates a credential the engine called name issued
+func (r *Registry) Revoke(ctx context.Context, name, leaseID string) error {
+	e, err := r.lookup(name, CapabilityRevoke)
+	if err != nil {
+		return err
+	}
+	if leaseID == "" {
+		return fmt.Errorf("a lease ID is required")
+	}
+	if err := e.Revoke(ctx, leaseID); err != nil {
+		return fmt.Errorf("secret engine %q: %w", name, err)
+	}
+	return nil
+}
+
+func (r *Registry) lookup(name, capability string) (Engine, error) {
+	e, err := r.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Info().Supports(capability) {
+		return nil, fmt.Errorf("%w: %q cannot %s", ErrUnsupported, name, capability)
+	}
+	return e, nil
+}
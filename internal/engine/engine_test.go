@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is the plugin the other tests run: the test binary
+// re-executed through a script named like a plugin
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("SECRETLY_ENGINE_PROTOCOL") == "" {
+		return
+	}
+	var req request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(2)
+	}
+	var resp response
+	switch req.Method {
+	case "handshake":
+		resp.Info = &Info{Name: "fake", Version: "1.0.0", Protocol: ProtocolVersion,
+			Capabilities: []string{CapabilityIssue}, Roles: []string{"reader"}}
+	case CapabilityIssue:
+		if req.Config["hang"] != "" {
+			time.Sleep(time.Minute)
+		}
+		env := strings.Join(os.Environ(), " ")
+		resp.Credential = &Credential{
+			Value:   map[string]string{"password": req.Config["prefix"] + req.Params["db"], "env": env},
+			LeaseID: "lease-1",
+		}
+	default:
+		resp.Error = "unexpected method " + req.Method
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(resp)
+	os.Exit(0)
+}
+
+func writePlugin(t *testing.T, dir, name string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts need a POSIX shell")
+	}
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run='^TestHelperPlugin$'\n", os.Args[0])
+	if err := os.WriteFile(filepath.Join(dir, PluginPrefix+name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "fake")
+	t.Setenv("SECRETLY_TEST_LEAK", "server-only")
+	ctx := context.Background()
+
+	registry, err := Discover(ctx, dir, map[string]Sandbox{"fake": {Config: map[string]string{"prefix": "pw-"}}})
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	infos := registry.List()
+	if len(infos) != 1 || infos[0].Name != "fake" || !infos[0].Supports(CapabilityIssue) {
+		t.Fatalf("Expected the fake engine to be registered, got %+v", infos)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "fake.d")); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("Expected a private directory for the plugin, got %v", err)
+	}
+
+	cred, err := registry.Issue(ctx, "fake", IssueRequest{Role: "reader", Params: map[string]string{"db": "orders"}})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if cred.Value["password"] != "pw-orders" || cred.LeaseID != "lease-1" {
+		t.Errorf("Expected the plugin's config and params to be used, got %+v", cred)
+	}
+	if strings.Contains(cred.Value["env"], "SECRETLY_TEST_LEAK") {
+		t.Error("Expected the plugin not to see the server's environment")
+	}
+	if _, err := registry.Issue(ctx, "fake", IssueRequest{Role: "admin"}); err == nil {
+		t.Error("Expected a role the engine does not list to be rejected")
+	}
+	if err := registry.Revoke(ctx, "fake", "lease-1"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected revoke to be unsupported, got %v", err)
+	}
+	if _, err := registry.Issue(ctx, "other", IssueRequest{}); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("Expected an unknown engine, got %v", err)
+	}
+
+	if _, err := Discover(ctx, dir, map[string]Sandbox{"missing": {}}); err == nil {
+		t.Error("Expected configuration for a missing plugin to be rejected")
+	}
+}
+
+func TestProcessSandbox(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "fake")
+	path := filepath.Join(dir, PluginPrefix+"fake")
+	ctx := context.Background()
+
+	p, err := Load(ctx, path, Sandbox{Dir: dir, Config: map[string]string{"hang": "yes"}, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, err := p.Issue(ctx, IssueRequest{Role: "reader"}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a hanging plugin to time out, got %v", err)
+	}
+
+	if err := os.Chmod(path, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(ctx, path, Sandbox{Dir: dir}); err == nil {
+		t.Error("Expected a world-writable plugin to be refused")
+	}
+
+	renamed := filepath.Join(dir, PluginPrefix+"other")
+	if err := os.Chmod(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(ctx, renamed, Sandbox{Dir: dir}); err == nil {
+		t.Error("Expected a plugin whose handshake name differs from its file name to be refused")
+	}
+}
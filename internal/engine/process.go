@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// PluginPrefix starts the file names of engine plugins; the engine name
+	// follows, e.g. secretly-engine-postgres
+	PluginPrefix = "secretly-engine-"
+	// DefaultTimeout bounds a plugin run when Sandbox does not set one
+	DefaultTimeout = 30 * time.Second
+
+	// maxOutput bounds what a plugin may write to stdout, and maxStderr
+	// what of its stderr ends up in error messages
+	maxOutput = 1 << 20
+	maxStderr = 4 << 10
+)
+
+// Sandbox is what a plugin process gets to see of the server
+type Sandbox struct {
+	// Config holds the plugin's own settings (engines.plugins.<name>.config).
+	// It is sent on stdin with every request, never in arguments or the
+	// environment, and no other plugin receives it.
+	Config map[string]string
+	// Dir is the working directory and HOME of the plugin, where it may
+	// keep state
+	Dir     string
+	Timeout time.Duration
+}
+
+// Process is an engine plugin run as a separate program, once per request.
+// It reads one JSON request from stdin and writes one JSON response to
+// stdout, so a crashing or hanging plugin cannot take the server down and
+// plugins need not be written in Go. The process gets none of the
+// server's environment, only PATH, HOME and SECRETLY_ENGINE_PROTOCOL.
+//
+// Requests carry the protocol version, a method ("handshake", "issue" or
+// "revoke"), the plugin's config and the method's arguments ("role" and
+// "params", or "lease_id"). Responses carry "info" for the handshake,
+// "credential" for issue, or "error".
+type Process struct {
+	path    string
+	sandbox Sandbox
+	info    Info
+}
+
+type request struct {
+	Protocol int               `json:"protocol"`
+	Method   string            `json:"method"`
+	Config   map[string]string `json:"config"`
+	IssueRequest
+	LeaseID string `json:"lease_id,omitempty"`
+}
+
+type response struct {
+	Info       *Info       `json:"info,omitempty"`
+	Credential *Credential `json:"credential,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// Load checks the plugin at path and runs its handshake. The plugin must
+// be a regular executable file that only its owner can change, and its
+// handshake name must match its file name.
+func Load(ctx context.Context, path string, sandbox Sandbox) (*Process, error) {
+	if err := checkPluginFile(path); err != nil {
+		return nil, err
+	}
+	if sandbox.Timeout <= 0 {
+		sandbox.Timeout = DefaultTimeout
+	}
+	p := &Process{path: path, sandbox: sandbox}
+	resp, err := p.call(ctx, &request{Method: "handshake"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Info == nil {
+		return nil, fmt.Errorf("plugin %s: handshake returned no info", path)
+	}
+	p.info = *resp.Info
+	if want := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), ".exe"), PluginPrefix); p.info.Name != want {
+		return nil, fmt.Errorf("plugin %s calls itself %q, expected %q", path, p.info.Name, want)
+	}
+	if err := validateInfo(p.info); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Info returns what the plugin registered in its handshake
+func (p *Process) Info() Info {
+	return p.info
+}
+
+func (p *Process) Issue(ctx context.Context, req IssueRequest) (*Credential, error) {
+	resp, err := p.call(ctx, &request{Method: CapabilityIssue, IssueRequest: req})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Credential == nil || len(resp.Credential.Value) == 0 {
+		return nil, fmt.Errorf("plugin returned no credential")
+	}
+	return resp.Credential, nil
+}
+
+func (p *Process) Revoke(ctx context.Context, leaseID string) error {
+	_, err := p.call(ctx, &request{Method: CapabilityRevoke, LeaseID: leaseID})
+	return err
+}
+
+// call runs the plugin with req and decodes its response
+func (p *Process) call(ctx context.Context, req *request) (*response, error) {
+	req.Protocol = ProtocolVersion
+	req.Config = p.sandbox.Config
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.sandbox.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Dir = p.sandbox.Dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + p.sandbox.Dir,
+		fmt.Sprintf("SECRETLY_ENGINE_PROTOCOL=%d", ProtocolVersion),
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: maxOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: maxStderr}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("plugin %s timed out after %s", filepath.Base(p.path), p.sandbox.Timeout)
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w%s", filepath.Base(p.path), err, stderrSuffix(stderr.String()))
+	}
+	var resp response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %w", filepath.Base(p.path), err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+func stderrSuffix(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	return ": " + s
+}
+
+// limitedBuffer fails writes past limit, which stops a plugin flooding
+// the server's memory
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, io.ErrShortWrite
+	}
+	return b.buf.Write(p)
+}
+
+// checkPluginFile refuses files that are not executables or that others
+// than their owner could replace
+func checkPluginFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("plugin %s is not a regular file", path)
+	}
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("plugin %s is not executable", path)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("plugin %s is writable by group or others", path)
+	}
+	return nil
+}
+
+// Discover loads every plugin named PluginPrefix<name> in dir into a new
+// registry. Each plugin gets sandboxes[name], with Dir defaulting to
+// <dir>/<name>.d, which is created private to the server. A sandbox for a
+// plugin that is not in dir is a configuration error.
+func Discover(ctx context.Context, dir string, sandboxes map[string]Sandbox) (*Registry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins directory: %w", err)
+	}
+	registry := NewRegistry()
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(strings.TrimSuffix(entry.Name(), ".exe"), PluginPrefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		found[name] = true
+		sandbox := sandboxes[name]
+		if sandbox.Dir == "" {
+			sandbox.Dir = filepath.Join(dir, name+".d")
+		}
+		if err := os.MkdirAll(sandbox.Dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create directory for plugin %q: %w", name, err)
+		}
+		p, err := Load(ctx, filepath.Join(dir, entry.Name()), sandbox)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	var missing []string
+	for name := range sandboxes {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("no plugin %s%s in %s", PluginPrefix, strings.Join(missing, ", "+PluginPrefix), dir)
+	}
+	return registry, nil
+}
@@ -0,0 +1,331 @@
+// Package envfile reads and writes .env files without losing comments,
+// blank lines or key order, and compares them with stored secrets.
+package envfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/dockerenv"
+	"github.com/secretlyhq/secretly/internal/scan"
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// line is one line of the file; comments and blank lines have no key
+type line struct {
+	raw    string
+	key    string
+	value  string
+	export bool
+	dirty  bool
+}
+
+// File is a parsed .env file
+type File struct {
+	lines []line
+}
+
+// Parse reads a .env file. It accepts "KEY=value", "export KEY=value",
+// single-quoted literals, double-quoted values with \n, \" and \\ escapes,
+// and trailing " # comments" after unquoted values.
+func Parse(data []byte) (*File, error) {
+	f := &File{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			f.lines = append(f.lines, line{raw: raw})
+			continue
+		}
+
+		l := line{raw: raw}
+		if rest, ok := strings.CutPrefix(trimmed, "export "); ok {
+			l.export = true
+			trimmed = strings.TrimSpace(rest)
+		}
+		key, value, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !keyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		parsed, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		l.key, l.value = key, parsed
+		f.lines = append(f.lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return v[1 : end+1], nil
+	case strings.HasPrefix(v, `"`):
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			switch c := v[i]; {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(v):
+				i++
+				switch v[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(v[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quote")
+	default:
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = v[:i]
+		}
+		return strings.TrimSpace(v), nil
+	}
+}
+
+// Keys returns the keys in file order
+func (f *File) Keys() []string {
+	var keys []string
+	for _, l := range f.lines {
+		if l.key != "" {
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value of the last assignment to key
+func (f *File) Get(key string) (string, bool) {
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		if f.lines[i].key == key {
+			return f.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns all key/value pairs; later assignments win
+func (f *File) Values() map[string]string {
+	values := make(map[string]string)
+	for _, l := range f.lines {
+		if l.key != "" {
+			values[l.key] = l.value
+		}
+	}
+	return values
+}
+
+// Set updates key in place, keeping its position and surrounding comments,
+// or appends it when the file does not have it yet
+func (f *File) Set(key, value string) {
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		if f.lines[i].key == key {
+			if f.lines[i].value != value {
+				f.lines[i].value, f.lines[i].dirty = value, true
+			}
+			return
+		}
+	}
+	f.lines = append(f.lines, line{key: key, value: value, dirty: true})
+}
+
+// Bytes renders the file. Unchanged lines are written exactly as read.
+func (f *File) Bytes() []byte {
+	var b bytes.Buffer
+	for _, l := range f.lines {
+		if !l.dirty {
+			b.WriteString(l.raw)
+			b.WriteByte('\n')
+			continue
+		}
+		if l.export {
+			b.WriteString("export ")
+		}
+		b.WriteString(l.key + "=" + Quote(l.value) + "\n")
+	}
+	return b.Bytes()
+}
+
+// Quote returns value as it should appear after "KEY=", quoting only when
+// needed
+func Quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\"'#\\$`") {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// Change kinds reported by Diff
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is a difference for one key between local and remote values
+type Change struct {
+	Key  string
+	Kind string
+}
+
+// Diff reports how local differs from the remote keys: Added keys exist
+// only locally, Removed keys only remotely. equal compares a local value
+// with the stored one, so callers can compare hashes instead of reading
+// secrets. Values are never included so the result is safe to print.
+func Diff(local map[string]string, remoteKeys []string, equal func(key, value string) (bool, error)) ([]Change, error) {
+	remote := make(map[string]bool, len(remoteKeys))
+	for _, key := range remoteKeys {
+		remote[key] = true
+	}
+
+	var changes []Change
+	for key, value := range local {
+		if !remote[key] {
+			changes = append(changes, Change{Key: key, Kind: Added})
+			continue
+		}
+		same, err := equal(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			changes = append(changes, Change{Key: key, Kind: Changed})
+		}
+	}
+	for key := range remote {
+		if _, ok := local[key]; !ok {
+			changes = append(changes, Change{Key: key, Kind: Removed})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+// Profile maps a set of secrets to environment variable names. With
+// Secrets set only the listed keys belong to the profile; otherwise every
+// secret directly under Prefix does, named after dockerenv.EnvKey. Keys are
+// then prefixed with VarPrefix and, with Uppercase, upper-cased.
+type Profile struct {
+	Prefix    string
+	Secrets   map[string]string // env key -> secret name
+	VarPrefix string
+	Uppercase bool
+}
+
+// KeyFor returns the environment key for a secret name, if the secret
+// belongs to the profile
+func (p Profile) KeyFor(name string) (string, bool) {
+	if len(p.Secrets) > 0 {
+		for key, n := range p.Secrets {
+			if n == name {
+				return p.transform(key), true
+			}
+		}
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(name, p.Prefix)
+	if !ok || rest == "" || strings.Contains(rest, "/") {
+		return "", false
+	}
+	return p.transform(dockerenv.EnvKey(rest)), true
+}
+
+// NameFor returns the secret name a new key is pushed to. It is false when
+// the profile lists its secrets explicitly and key is not one of them.
+func (p Profile) NameFor(key string) (string, bool) {
+	varPrefix := p.transform(p.VarPrefix)
+	key, ok := strings.CutPrefix(key, varPrefix)
+	if !ok {
+		return "", false
+	}
+	if len(p.Secrets) > 0 {
+		for k, name := range p.Secrets {
+			if p.transform(k) == varPrefix+key {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	return p.Prefix + strings.ToLower(strings.ReplaceAll(key, "_", "-")), true
+}
+
+// FlatKey returns the key of one leaf of a flattened JSON secret: the
+// secret's key and the leaf's dotted path joined with underscores, e.g.
+// DB_HOST for path "host" of DB
+func (p Profile) FlatKey(key, path string) string {
+	flat := key + "_" + strings.Trim(nonKeyChars.ReplaceAllString(path, "_"), "_")
+	if p.Uppercase {
+		flat = strings.ToUpper(flat)
+	}
+	return flat
+}
+
+func (p Profile) transform(key string) string {
+	key = p.VarPrefix + key
+	if p.Uppercase {
+		key = strings.ToUpper(key)
+	}
+	return key
+}
+
+var (
+	envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	nonKeyChars   = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// ValidKey reports whether key can be used as an environment variable name
+func ValidKey(key string) bool {
+	return envKeyPattern.MatchString(key)
+}
+
+var junkValues = map[string]bool{
+	"todo": true, "fixme": true, "tbd": true, "dummy": true, "test": true, "testing": true,
+	"secret": true, "password": true, "null": true, "nil": true, "none": true, "undefined": true,
+	"foo": true, "bar": true, "123": true, "1234": true, "12345": true, "123456": true,
+}
+
+// Junk returns why value looks like a local placeholder rather than a real
+// secret, or "" if it looks fine. Push refuses such values by default so
+// that a half-filled local .env cannot overwrite shared secrets.
+func Junk(value string) string {
+	trimmed := strings.TrimSpace(value)
+	lower := strings.ToLower(trimmed)
+	switch {
+	case trimmed == "":
+		return "empty value"
+	case junkValues[lower]:
+		return fmt.Sprintf("placeholder value %q", trimmed)
+	case strings.Contains(lower, "localhost") || strings.Contains(lower, "127.0.0.1"):
+		return "points at localhost"
+	case scan.IsPlaceholder(trimmed):
+		return "looks like a placeholder or reference"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package envfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAndSetPreservesComments(t *testing.T) {
+	input := `# database
+DB_HOST=db.internal # primary
+export DB_PASSWORD="p@ss \"word\""
+
+API_KEY='literal $value'
+`
+	f, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	values := f.Values()
+	if values["DB_HOST"] != "db.internal" || values["DB_PASSWORD"] != `p@ss "word"` || values["API_KEY"] != "literal $value" {
+		t.Errorf("Unexpected values: %v", values)
+	}
+
+	f.Set("DB_HOST", "db.internal")
+	f.Set("DB_PASSWORD", "new pass")
+	f.Set("NEW_KEY", "line1\nline2")
+	out := string(f.Bytes())
+
+	for _, want := range []string{"# database\n", "DB_HOST=db.internal # primary\n", "export DB_PASSWORD=\"new pass\"\n", "\nAPI_KEY='literal $value'\n", "NEW_KEY=\"line1\\nline2\"\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	reparsed, err := Parse([]byte(out))
+	if err != nil {
+		t.Fatalf("Failed to reparse output: %v", err)
+	}
+	if v, _ := reparsed.Get("NEW_KEY"); v != "line1\nline2" {
+		t.Errorf("Expected round-tripped multiline value, got %q", v)
+	}
+
+	if _, err := Parse([]byte("not a pair\n")); err == nil {
+		t.Error("Expected error for malformed line")
+	}
+}
+
+func TestDiffProfileAndJunk(t *testing.T) {
+	remote := map[string]string{"DB_PASSWORD": "a", "TOKEN": "b"}
+	changes, err := Diff(map[string]string{"DB_PASSWORD": "changed", "NEW": "x"}, []string{"DB_PASSWORD", "TOKEN"}, func(key, value string) (bool, error) {
+		return remote[key] == value, nil
+	})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := []Change{{"DB_PASSWORD", Changed}, {"NEW", Added}, {"TOKEN", Removed}}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], changes[i])
+		}
+	}
+
+	p := Profile{Prefix: "app1/"}
+	if key, ok := p.KeyFor("app1/db-password"); !ok || key != "DB_PASSWORD" {
+		t.Errorf("Expected DB_PASSWORD, got %q", key)
+	}
+	if _, ok := p.KeyFor("app1/nested/key"); ok {
+		t.Error("Expected nested secret to be outside the profile")
+	}
+	if name, _ := p.NameFor("DB_PASSWORD"); name != "app1/db-password" {
+		t.Errorf("Unexpected secret name %q", name)
+	}
+	if _, ok := (Profile{Secrets: map[string]string{"A": "x/a"}}).NameFor("B"); ok {
+		t.Error("Expected explicit profile to reject unlisted keys")
+	}
+
+	for _, v := range []string{"", "changeme", "TODO", "postgres://localhost/db", "${DB_PASSWORD}"} {
+		if Junk(v) == "" {
+			t.Errorf("Expected %q to be flagged", v)
+		}
+	}
+	if reason := Junk("s3cr3t-Gx81kQ"); reason != "" {
+		t.Errorf("Expected real value to pass, got %q", reason)
+	}
+}
@@ -0,0 +1,277 @@
+// Package escrow splits keys into shares for M-of-N recovery and seals
+// each share to the custodian holding it. Shares use Shamir's secret
+// sharing over GF(256): any threshold of them rebuild the key, fewer
+// reveal nothing about it. Custodians hold X25519 key pairs; a share is
+// sealed to the public key, so only the custodian's private key, which
+// never reaches the server, opens it. A sealed share is an ephemeral
+// X25519 public key, a nonce and the share encrypted with AES-256-GCM
+// under a key derived with HKDF-SHA256 from the shared secret of both keys.
+package escrow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxShares is the most shares a key can be split into
+	MaxShares = 255
+	// KeySize is the size of custodian public and private keys
+	KeySize = 32
+
+	sealInfo = "secretly escrow share"
+)
+
+var (
+	// ErrInvalidShares is returned when shares are malformed, duplicated or
+	// of different keys
+	ErrInvalidShares = errors.New("invalid key shares")
+	// ErrInvalidKey is returned for custodian keys of the wrong size, or
+	// when a sealed share does not open with the key
+	ErrInvalidKey = errors.New("invalid custodian key")
+)
+
+// Lock encrypts value with AES-256-GCM under a new key and splits the key
+// into n shares, threshold of which unlock the ciphertext
+func Lock(value []byte, n, threshold int) (ciphertext []byte, shares [][]byte, err error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	defer clear(key)
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	if shares, err = Split(key, n, threshold); err != nil {
+		return nil, nil, err
+	}
+	return aead.Seal(nonce, nonce, value, nil), shares, nil
+}
+
+// Unlock rebuilds the key of ciphertext from shares and decrypts it. It
+// fails with ErrInvalidShares when the shares are fewer than the threshold
+// or belong to another key.
+func Unlock(ciphertext []byte, shares [][]byte) ([]byte, error) {
+	key, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	aead, err := newGCM(key)
+	if err != nil || len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalidShares
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidShares
+	}
+	return value, nil
+}
+
+// Split divides secret into n shares, threshold of which rebuild it. A
+// share is its x coordinate followed by one byte per byte of secret.
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 1 || threshold > n || n > MaxShares {
+		return nil, fmt.Errorf("threshold must be between 1 and the number of shares, at most %d", MaxShares)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("nothing to split")
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		coefficients[0] = s
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			share[b+1] = evaluate(coefficients, share[0])
+		}
+	}
+	return shares, nil
+}
+
+// Combine rebuilds the secret from at least the threshold of its shares.
+// Fewer shares yield a wrong secret without error, so callers verify the
+// result, e.g. by decrypting with it.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrInvalidShares
+	}
+	size := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != size || size < 2 || share[0] == 0 || seen[share[0]] {
+			return nil, ErrInvalidShares
+		}
+		seen[share[0]] = true
+	}
+	secret := make([]byte, size-1)
+	for b := range secret {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for i, si := range shares {
+			basis := byte(1)
+			for j, sj := range shares {
+				if i != j {
+					basis = mul(basis, div(sj[0], sj[0]^si[0]))
+				}
+			}
+			value ^= mul(si[b+1], basis)
+		}
+		secret[b] = value
+	}
+	return secret, nil
+}
+
+// Digest returns the hex SHA-256 of a share, which identifies it without
+// revealing it
+func Digest(share []byte) string {
+	sum := sha256.Sum256(share)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPublicKey reports whether b is a custodian public key
+func CheckPublicKey(b []byte) error {
+	if _, err := ecdh.X25519().NewPublicKey(b); err != nil {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// GenerateKey returns a new custodian key pair
+func GenerateKey() (publicKey, privateKey []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.PublicKey().Bytes(), priv.Bytes(), nil
+}
+
+// Seal encrypts share to a custodian's public key
+func Seal(share, publicKey []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := sealCipher(ephemeral, recipient, ephemeral.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	sealed := append([]byte(nil), ephemeral.PublicKey().Bytes()...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, share, nil), nil
+}
+
+// Open decrypts a sealed share with the custodian's private key
+func Open(sealed, privateKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	if len(sealed) < KeySize {
+		return nil, ErrInvalidKey
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:KeySize])
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	aead, err := sealCipher(priv, ephemeral, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[KeySize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrInvalidKey
+	}
+	share, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return share, nil
+}
+
+// sealCipher returns the AEAD of a sealed share from one side's private
+// key and the other side's public key
+func sealCipher(priv *ecdh.PrivateKey, peer, ephemeral *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, err := hkdf.Key(sha256.New, shared, ephemeral.Bytes(), sealInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// evaluate returns the polynomial with coefficients at x, by Horner's rule
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// Arithmetic in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+
+var expTable, logTable = tables()
+
+func tables() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = byte(i)
+		// multiply by the generator 3
+		x ^= x<<1 ^ byte(int8(x)>>7)&0x1b
+	}
+	return exp, log
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,65 @@
+package escrow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		got, err := Combine(picked)
+		if err != nil || !bytes.Equal(got, secret) {
+			t.Errorf("Shares %v: expected the secret, got %q, %v", subset, got, err)
+		}
+	}
+	if got, _ := Combine(shares[:2]); bytes.Equal(got, secret) {
+		t.Error("Expected two of three shares not to rebuild the secret")
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); !errors.Is(err, ErrInvalidShares) {
+		t.Errorf("Expected duplicate shares to be rejected, got %v", err)
+	}
+	if _, err := Split(secret, 2, 3); err == nil {
+		t.Error("Expected a threshold above the share count to be rejected")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	sealed, err := Seal([]byte("share"), pub)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if share, err := Open(sealed, priv); err != nil || string(share) != "share" {
+		t.Errorf("Expected the share back, got %q, %v", share, err)
+	}
+	_, otherPriv, _ := GenerateKey()
+	if _, err := Open(sealed, otherPriv); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected another custodian's key to fail, got %v", err)
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	ciphertext, shares, err := Lock([]byte("root password"), 3, 2)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if value, err := Unlock(ciphertext, [][]byte{shares[2], shares[0]}); err != nil || string(value) != "root password" {
+		t.Errorf("Expected two shares to unlock the value, got %q, %v", value, err)
+	}
+	if _, err := Unlock(ciphertext, shares[:1]); !errors.Is(err, ErrInvalidShares) {
+		t.Errorf("Expected one share not to unlock the value, got %v", err)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build chaos
+
+package faults
+
+// Available reports whether the build includes fault injection
+const Available = true
@@ -0,0 +1,159 @@
+// Package faults injects latency and errors into storage and encryption, so
+// that operators can check how clients retry and whether alerts fire. It
+// only works in builds with -tags chaos; release builds leave it out.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+)
+
+// Targets of a rule
+const (
+	TargetStorage    = "storage"
+	TargetEncryption = "encryption"
+)
+
+// Operations of a rule. Storage operations are the GORM callbacks; a rule
+// without an operation matches every operation of its target.
+var operations = map[string][]string{
+	TargetStorage:    {"create", "query", "update", "delete", "row", "raw"},
+	TargetEncryption: {"encrypt", "decrypt"},
+}
+
+// ErrInjected is wrapped by every injected error
+var ErrInjected = errors.New("injected fault")
+
+// maxLatency bounds the latency of a rule
+const maxLatency = time.Minute
+
+// Rule delays matching calls by LatencyMS and fails ErrorRate of them, e.g.
+// 0.1 for one in ten. With Limit it stops failing calls after that many,
+// e.g. to fail the middle of a multi-step change.
+type Rule struct {
+	Target    string `json:"target"`
+	Operation string `json:"operation,omitempty"`
+	// Table limits a storage rule to one table, e.g. secret_nodes
+	Table     string  `json:"table,omitempty"`
+	LatencyMS int     `json:"latency_ms,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	Limit     int     `json:"limit,omitempty"`
+	// Injected counts the errors injected so far
+	Injected int `json:"injected"`
+}
+
+func (r *Rule) validate() error {
+	ops, ok := operations[r.Target]
+	if !ok {
+		return fmt.Errorf("unknown target %q: use %s or %s", r.Target, TargetStorage, TargetEncryption)
+	}
+	if r.Operation != "" && !slices.Contains(ops, r.Operation) {
+		return fmt.Errorf("unknown %s operation %q: use one of %v", r.Target, r.Operation, ops)
+	}
+	if r.Table != "" && r.Target != TargetStorage {
+		return fmt.Errorf("table only applies to %s rules", TargetStorage)
+	}
+	if r.LatencyMS < 0 || time.Duration(r.LatencyMS)*time.Millisecond > maxLatency {
+		return fmt.Errorf("latency_ms must be between 0 and %d", maxLatency.Milliseconds())
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if r.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+func (r *Rule) matches(target, operation, table string) bool {
+	return r.Target == target && (r.Operation == "" || r.Operation == operation) && (r.Table == "" || r.Table == table)
+}
+
+// ConfigRules converts the rules of the faults section
+func ConfigRules(cfg []config.FaultRule) []Rule {
+	rules := make([]Rule, 0, len(cfg))
+	for _, r := range cfg {
+		rules = append(rules, Rule{
+			Target:    r.Target,
+			Operation: r.Operation,
+			Table:     r.Table,
+			LatencyMS: r.LatencyMS,
+			ErrorRate: r.ErrorRate,
+			Limit:     r.Limit,
+		})
+	}
+	return rules
+}
+
+// Injector applies rules, which can be replaced at runtime
+type Injector struct {
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// New creates an injector, or fails in builds without -tags chaos
+func New(rules []Rule) (*Injector, error) {
+	if !Available {
+		return nil, errors.New("fault injection needs a build with -tags chaos")
+	}
+	i := &Injector{}
+	if err := i.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Rules returns the rules with their counts
+func (i *Injector) Rules() []Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return slices.Clone(i.rules)
+}
+
+// SetRules replaces the rules; none turns injection off
+func (i *Injector) SetRules(rules []Rule) error {
+	for n := range rules {
+		if err := rules[n].validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", n+1, err)
+		}
+	}
+	rules = slices.Clone(rules)
+	for n := range rules {
+		rules[n].Injected = 0
+	}
+	i.mu.Lock()
+	i.rules = rules
+	i.mu.Unlock()
+	return nil
+}
+
+// Inject applies the rules matching a call: it sleeps for their latency
+// and returns an error wrapping ErrInjected when one of them fails it
+func (i *Injector) Inject(target, operation, table string) error {
+	var latency time.Duration
+	var err error
+	i.mu.Lock()
+	for n := range i.rules {
+		r := &i.rules[n]
+		if !r.matches(target, operation, table) {
+			continue
+		}
+		latency += time.Duration(r.LatencyMS) * time.Millisecond
+		if err == nil && (r.Limit == 0 || r.Injected < r.Limit) && rand.Float64() < r.ErrorRate {
+			r.Injected++
+			err = fmt.Errorf("%w: %s %s", ErrInjected, target, operation)
+			if table != "" {
+				err = fmt.Errorf("%w on %s", err, table)
+			}
+		}
+	}
+	i.mu.Unlock()
+	time.Sleep(latency)
+	return err
+}
@@ -0,0 +1,99 @@
+package faults
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+func newInjector(t *testing.T, rules ...Rule) *Injector {
+	t.Helper()
+	// New refuses builds without -tags chaos
+	i := &Injector{}
+	if err := i.SetRules(rules); err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+	return i
+}
+
+func TestRules(t *testing.T) {
+	i := newInjector(t, Rule{Target: TargetStorage, Operation: "create", Table: "users", ErrorRate: 1, Limit: 2})
+	for n := 0; n < 3; n++ {
+		err := i.Inject(TargetStorage, "create", "users")
+		if failed := errors.Is(err, ErrInjected); failed != (n < 2) {
+			t.Errorf("Call %d: expected a failure only within the limit, got %v", n+1, err)
+		}
+	}
+	if err := i.Inject(TargetStorage, "create", "secret_nodes"); err != nil {
+		t.Errorf("Expected other tables to pass, got %v", err)
+	}
+	if err := i.Inject(TargetStorage, "query", "users"); err != nil {
+		t.Errorf("Expected other operations to pass, got %v", err)
+	}
+	if rules := i.Rules(); rules[0].Injected != 2 {
+		t.Errorf("Expected 2 injected errors, got %d", rules[0].Injected)
+	}
+
+	for _, bad := range []Rule{
+		{Target: "network"},
+		{Target: TargetEncryption, Operation: "query"},
+		{Target: TargetEncryption, Table: "users"},
+		{Target: TargetStorage, ErrorRate: 1.5},
+		{Target: TargetStorage, LatencyMS: -1},
+	} {
+		if err := i.SetRules([]Rule{bad}); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+	if _, err := New(nil); (err == nil) != Available {
+		t.Errorf("Expected New to work only with -tags chaos, got %v", err)
+	}
+}
+
+func TestInstallGORM(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	i := newInjector(t)
+	if err := InstallGORM(db, i); err != nil {
+		t.Fatalf("InstallGORM failed: %v", err)
+	}
+	store := storage.NewLocalStorage(db)
+	if err := store.Users().Create(&models.User{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("Expected no faults without rules, got %v", err)
+	}
+
+	if err := i.SetRules([]Rule{{Target: TargetStorage, Operation: "query", Table: "users", ErrorRate: 1}}); err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+	if _, err := store.Users().FindByUsername("alice"); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected an injected error, got %v", err)
+	}
+	if _, err := store.Scopes().ListNamespaces(); err != nil {
+		t.Errorf("Expected other tables to pass, got %v", err)
+	}
+}
+
+type deriver struct{}
+
+func (deriver) EncryptSecret(plaintext []byte) ([]byte, []byte, error) { return plaintext, nil, nil }
+func (deriver) DecryptSecret(data []byte) ([]byte, error)              { return data, nil }
+func (deriver) DeriveKey(string) ([]byte, error)                       { return []byte("key"), nil }
+
+func TestWrapEncryptor(t *testing.T) {
+	i := newInjector(t, Rule{Target: TargetEncryption, Operation: "decrypt", ErrorRate: 1})
+	e := WrapEncryptor(deriver{}, i)
+	if _, _, err := e.EncryptSecret([]byte("x")); err != nil {
+		t.Errorf("Expected encryption to pass, got %v", err)
+	}
+	if _, err := e.DecryptSecret([]byte("x")); !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected an injected error, got %v", err)
+	}
+	if _, ok := e.(keyDeriver); !ok {
+		t.Error("Expected key derivation to be kept")
+	}
+}
@@ -0,0 +1,77 @@
+package faults
+
+import "gorm.io/gorm"
+
+// InstallGORM injects storage faults into every statement run through db,
+// before it reaches the database
+func InstallGORM(db *gorm.DB, i *Injector) error {
+	cb := db.Callback()
+	hooks := []struct {
+		op       string
+		register func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		op := h.op
+		err := h.register("faults:"+op, func(tx *gorm.DB) {
+			if err := i.Inject(TargetStorage, op, tx.Statement.Table); err != nil {
+				_ = tx.AddError(err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encryptor is the interface of core.Encryptor
+type Encryptor interface {
+	EncryptSecret(plaintext []byte) ([]byte, []byte, error)
+	DecryptSecret(encryptedData []byte) ([]byte, error)
+}
+
+// keyDeriver is the interface of core.KeyDeriver, which the wrapper keeps
+type keyDeriver interface {
+	DeriveKey(purpose string) ([]byte, error)
+}
+
+// WrapEncryptor injects encryption faults into next. Key derivation is
+// passed through.
+func WrapEncryptor(next Encryptor, i *Injector) Encryptor {
+	e := &encryptor{next: next, faults: i}
+	if d, ok := next.(keyDeriver); ok {
+		return &derivingEncryptor{encryptor: e, keyDeriver: d}
+	}
+	return e
+}
+
+type derivingEncryptor struct {
+	*encryptor
+	keyDeriver
+}
+
+type encryptor struct {
+	next   Encryptor
+	faults *Injector
+}
+
+func (e *encryptor) EncryptSecret(plaintext []byte) ([]byte, []byte, error) {
+	if err := e.faults.Inject(TargetEncryption, "encrypt", ""); err != nil {
+		return nil, nil, err
+	}
+	return e.next.EncryptSecret(plaintext)
+}
+
+func (e *encryptor) DecryptSecret(encryptedData []byte) ([]byte, error) {
+	if err := e.faults.Inject(TargetEncryption, "decrypt", ""); err != nil {
+		return nil, err
+	}
+	return e.next.DecryptSecret(encryptedData)
+}
@@ -0,0 +1,135 @@
+// Package gitops reads the secret manifest of a Git repository: the
+// secrets that should exist, with their folders, owners and policies, but
+// never their values. The server compares the manifest with its secrets
+// and reports the drift.
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/redact"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the manifest read when gitops.path is not set
+const DefaultFile = "secrets.yaml"
+
+// ErrValueInManifest is returned for manifests that contain secret values
+var ErrValueInManifest = errors.New("secret values do not belong in a manifest")
+
+// Manifest declares secrets by path
+type Manifest struct {
+	Secrets []Secret `yaml:"secrets" json:"secrets"`
+}
+
+// Secret is the declared metadata of one secret. Path is its folders and
+// name, like "payments/stripe/api-key". A nil MaxReads, an empty Type or
+// Owner and nil Tags are not managed.
+type Secret struct {
+	Path          string   `yaml:"path" json:"path"`
+	NamespaceID   uint     `yaml:"namespace_id,omitempty" json:"namespace_id,omitempty"`
+	ZoneID        uint     `yaml:"zone_id,omitempty" json:"zone_id,omitempty"`
+	EnvironmentID uint     `yaml:"environment_id,omitempty" json:"environment_id,omitempty"`
+	Type          string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Owner         string   `yaml:"owner,omitempty" json:"owner,omitempty"`
+	Tags          []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	MaxReads      *int     `yaml:"max_reads,omitempty" json:"max_reads,omitempty"`
+
+	// Value is only read to reject manifests that contain one
+	Value yaml.Node `yaml:"value,omitempty" json:"-"`
+}
+
+// Folders returns the folders of the secret's path, outermost first
+func (s *Secret) Folders() []string {
+	parts := strings.Split(s.Path, "/")
+	return parts[:len(parts)-1]
+}
+
+// Name returns the last element of the secret's path
+func (s *Secret) Name() string {
+	return path.Base(s.Path)
+}
+
+// Parse reads a manifest. Unknown fields are errors, so that typos do not
+// go unnoticed, and so are values.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	seen := make(map[string]bool, len(m.Secrets))
+	for i := range m.Secrets {
+		s := &m.Secrets[i]
+		if s.Value.Kind != 0 {
+			return nil, fmt.Errorf("secret %q: %w", s.Path, ErrValueInManifest)
+		}
+		s.Path = strings.Trim(strings.TrimSpace(s.Path), "/")
+		parts := strings.Split(s.Path, "/")
+		if s.Path == "" || slices.Contains(parts, "") || slices.Contains(parts, ".") || slices.Contains(parts, "..") {
+			return nil, fmt.Errorf("secret %d of the manifest has an invalid path %q", i+1, s.Path)
+		}
+		if s.MaxReads != nil && *s.MaxReads <= 0 {
+			return nil, fmt.Errorf("secret %q: max_reads must be positive", s.Path)
+		}
+		key := fmt.Sprintf("%d/%d/%d/%s", s.NamespaceID, s.ZoneID, s.EnvironmentID, s.Name())
+		if seen[key] {
+			return nil, fmt.Errorf("secret %q: the name %q is declared twice in the same scope", s.Path, s.Name())
+		}
+		seen[key] = true
+	}
+	return &m, nil
+}
+
+// Fetch clones the branch of repo, a URL or a local path, and returns the
+// manifest at file with the commit it was read from. An empty branch
+// selects the default one.
+func Fetch(ctx context.Context, repo, branch, file string) (*Manifest, string, error) {
+	dir, err := os.MkdirTemp("", "secretly-gitops-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	cmd := exec.CommandContext(ctx, "git", append(args, "--", repo, dir)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("failed to clone %s: %w: %s", redact.String(repo), err, redact.String(strings.TrimSpace(string(out))))
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the commit of %s: %w", redact.String(repo), err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	if file == "" {
+		file = DefaultFile
+	}
+	target := filepath.Join(dir, filepath.FromSlash(file))
+	if rel, err := filepath.Rel(dir, target); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, "", fmt.Errorf("manifest path %q leaves the repository", file)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s at %s: %w", file, commit, err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s at %s: %w", file, commit, err)
+	}
+	return m, commit, nil
+}
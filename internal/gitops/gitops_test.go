@@ -0,0 +1,69 @@
+package gitops
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(`
+secrets:
+  - path: /payments/stripe/api-key/
+    owner: alice
+    max_reads: 3
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	s := m.Secrets[0]
+	if s.Path != "payments/stripe/api-key" || s.Name() != "api-key" || strings.Join(s.Folders(), "/") != "payments/stripe" {
+		t.Errorf("Unexpected secret %+v", s)
+	}
+	for _, bad := range []string{
+		"secrets:\n  - path: a/../b\n",
+		"secrets:\n  - path: a\n    ownr: bob\n",
+		"secrets:\n  - path: x/a\n  - path: y/a\n",
+		"secrets:\n  - path: a\n    max_reads: 0\n",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	run("init", "--quiet", "--initial-branch", "main")
+	if err := os.MkdirAll(filepath.Join(repo, "deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "deploy", "secrets.yaml"), []byte("secrets:\n  - path: db/password\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", ".")
+	run("commit", "--quiet", "-m", "Declare secrets")
+
+	m, commit, err := Fetch(context.Background(), repo, "main", "deploy/secrets.yaml")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if len(commit) != 40 || len(m.Secrets) != 1 || m.Secrets[0].Path != "db/password" {
+		t.Errorf("Unexpected manifest %+v at %q", m, commit)
+	}
+	if _, _, err := Fetch(context.Background(), repo, "main", "../outside.yaml"); err == nil {
+		t.Error("Expected a path outside the repository to be rejected")
+	}
+}
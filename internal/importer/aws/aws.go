@@ -0,0 +1,331 @@
+// Package aws reads secrets from AWS Secrets Manager and SSM Parameter Store
+// for the importer. It talks to the JSON APIs directly with SigV4 signing to
+// avoid pulling in the AWS SDK.
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/importer"
+)
+
+// Services that can be imported from
+const (
+	ServiceSecretsManager = "secretsmanager"
+	ServiceSSM            = "ssm"
+)
+
+// Credentials are static AWS credentials
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads the standard AWS_* environment variables
+func CredentialsFromEnv() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("AWS credentials not found: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return creds, nil
+}
+
+// RegionFromEnv returns AWS_REGION or AWS_DEFAULT_REGION
+func RegionFromEnv() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// Client calls Secrets Manager and SSM in one region
+type Client struct {
+	Region      string
+	Credentials Credentials
+	// Endpoint overrides the regional endpoint, e.g. for LocalStack
+	Endpoint   string
+	HTTPClient *http.Client
+
+	now func() time.Time
+}
+
+// NewClient creates a client for region
+func NewClient(region string, creds Credentials) *Client {
+	return &Client{
+		Region:      region,
+		Credentials: creds,
+		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+		now:         time.Now,
+	}
+}
+
+// Fetch reads every secret under prefix from service and converts it to
+// importer items. Names are turned into paths: SSM's leading "/" is dropped
+// and the prefix is kept so that imports stay unambiguous.
+func (c *Client) Fetch(ctx context.Context, service, prefix string) ([]importer.Item, error) {
+	switch service {
+	case ServiceSecretsManager:
+		return c.fetchSecretsManager(ctx, prefix)
+	case ServiceSSM:
+		return c.fetchSSM(ctx, prefix)
+	default:
+		return nil, fmt.Errorf("unknown AWS service %q: use %s or %s", service, ServiceSecretsManager, ServiceSSM)
+	}
+}
+
+type tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+func tagMap(tags []tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.Key] = t.Value
+	}
+	return m
+}
+
+func metadata(service, arn string, tags []tag) map[string]interface{} {
+	m := map[string]interface{}{"source": "aws-" + service, "arn": arn}
+	if t := tagMap(tags); t != nil {
+		m["tags"] = t
+	}
+	return m
+}
+
+func (c *Client) fetchSecretsManager(ctx context.Context, prefix string) ([]importer.Item, error) {
+	type listEntry struct {
+		ARN  string `json:"ARN"`
+		Name string `json:"Name"`
+		Tags []tag  `json:"Tags"`
+	}
+
+	var entries []listEntry
+	nextToken := ""
+	for {
+		input := map[string]interface{}{"MaxResults": 100}
+		if prefix != "" {
+			input["Filters"] = []map[string]interface{}{{"Key": "name", "Values": []string{prefix}}}
+		}
+		if nextToken != "" {
+			input["NextToken"] = nextToken
+		}
+		var page struct {
+			SecretList []listEntry `json:"SecretList"`
+			NextToken  string      `json:"NextToken"`
+		}
+		if err := c.call(ctx, ServiceSecretsManager, "secretsmanager.ListSecrets", input, &page); err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.SecretList...)
+		if page.NextToken == "" {
+			break
+		}
+		nextToken = page.NextToken
+	}
+
+	items := make([]importer.Item, 0, len(entries))
+	for _, entry := range entries {
+		// The name filter matches prefixes of any word, so recheck it
+		if !strings.HasPrefix(entry.Name, prefix) {
+			continue
+		}
+		var out struct {
+			SecretString string `json:"SecretString"`
+			SecretBinary string `json:"SecretBinary"`
+		}
+		if err := c.call(ctx, ServiceSecretsManager, "secretsmanager.GetSecretValue", map[string]string{"SecretId": entry.ARN}, &out); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+		value := []byte(out.SecretString)
+		if out.SecretBinary != "" {
+			decoded, err := base64.StdEncoding.DecodeString(out.SecretBinary)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode binary secret %s: %w", entry.Name, err)
+			}
+			value = decoded
+		}
+		items = append(items, importer.Item{
+			Name:     strings.TrimPrefix(entry.Name, "/"),
+			Versions: [][]byte{value},
+			Metadata: metadata(ServiceSecretsManager, entry.ARN, entry.Tags),
+		})
+	}
+	return items, nil
+}
+
+func (c *Client) fetchSSM(ctx context.Context, path string) ([]importer.Item, error) {
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	type parameter struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+		ARN   string `json:"ARN"`
+	}
+
+	var params []parameter
+	nextToken := ""
+	for {
+		input := map[string]interface{}{"Path": path, "Recursive": true, "WithDecryption": true, "MaxResults": 10}
+		if nextToken != "" {
+			input["NextToken"] = nextToken
+		}
+		var page struct {
+			Parameters []parameter `json:"Parameters"`
+			NextToken  string      `json:"NextToken"`
+		}
+		if err := c.call(ctx, ServiceSSM, "AmazonSSM.GetParametersByPath", input, &page); err != nil {
+			return nil, err
+		}
+		params = append(params, page.Parameters...)
+		if page.NextToken == "" {
+			break
+		}
+		nextToken = page.NextToken
+	}
+
+	items := make([]importer.Item, 0, len(params))
+	for _, p := range params {
+		var out struct {
+			TagList []tag `json:"TagList"`
+		}
+		input := map[string]string{"ResourceType": "Parameter", "ResourceId": p.Name}
+		if err := c.call(ctx, ServiceSSM, "AmazonSSM.ListTagsForResource", input, &out); err != nil {
+			return nil, fmt.Errorf("failed to read tags for %s: %w", p.Name, err)
+		}
+		items = append(items, importer.Item{
+			Name:     strings.TrimPrefix(p.Name, "/"),
+			Versions: [][]byte{[]byte(p.Value)},
+			Metadata: metadata(ServiceSSM, p.ARN, out.TagList),
+		})
+	}
+	return items, nil
+}
+
+// call sends a JSON 1.1 request for target and decodes the response into out
+func (c *Client) call(ctx context.Context, service, target string, input, out interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, c.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	c.sign(req, service, body)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("%s returned %d: %s %s", target, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// sign adds SigV4 headers to req
+func (c *Client) sign(req *http.Request, service string, body []byte) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.Region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.Credentials.SecretAccessKey), day)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.Credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
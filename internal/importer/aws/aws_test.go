@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusForbidden)
+			return
+		}
+		var input map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&input)
+
+		var out interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.ListSecrets":
+			if input["NextToken"] == nil {
+				out = map[string]interface{}{
+					"SecretList": []map[string]interface{}{{"ARN": "arn:1", "Name": "prod/db", "Tags": []tag{{Key: "team", Value: "core"}}}},
+					"NextToken":  "page2",
+				}
+			} else {
+				out = map[string]interface{}{"SecretList": []map[string]interface{}{
+					{"ARN": "arn:2", "Name": "prod/bin"},
+					{"ARN": "arn:3", "Name": "staging/prod/db"},
+				}}
+			}
+		case "secretsmanager.GetSecretValue":
+			if input["SecretId"] == "arn:2" {
+				out = map[string]string{"SecretBinary": "AAEC"}
+			} else {
+				out = map[string]string{"SecretString": "s3cret"}
+			}
+		case "AmazonSSM.GetParametersByPath":
+			out = map[string]interface{}{"Parameters": []map[string]string{{"Name": "/app/token", "Value": "tok", "ARN": "arn:ssm"}}}
+		case "AmazonSSM.ListTagsForResource":
+			out = map[string]interface{}{"TagList": []tag{{Key: "env", Value: "prod"}}}
+		default:
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer ts.Close()
+
+	c := NewClient("us-east-1", Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	c.Endpoint = ts.URL
+	ctx := context.Background()
+
+	items, err := c.Fetch(ctx, ServiceSecretsManager, "prod/")
+	if err != nil {
+		t.Fatalf("Secrets Manager fetch failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items after prefix filtering, got %d", len(items))
+	}
+	if items[0].Name != "prod/db" || string(items[0].Current()) != "s3cret" {
+		t.Errorf("Unexpected first item: %+v", items[0])
+	}
+	if tags := items[0].Metadata["tags"].(map[string]string); tags["team"] != "core" {
+		t.Errorf("Expected tags to be preserved, got %v", items[0].Metadata)
+	}
+	if string(items[1].Current()) != "\x00\x01\x02" {
+		t.Errorf("Expected decoded binary secret, got %q", items[1].Current())
+	}
+
+	items, err = c.Fetch(ctx, ServiceSSM, "app")
+	if err != nil {
+		t.Fatalf("SSM fetch failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "app/token" || items[0].Metadata["arn"] != "arn:ssm" {
+		t.Errorf("Unexpected SSM items: %+v", items)
+	}
+
+	c.Credentials.AccessKeyID = "OTHER"
+	if _, err := c.Fetch(ctx, ServiceSSM, "/"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected API error to surface, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package importer copies secrets from external secret stores into Secretly
+// with conflict handling and dry-run reports. Source connectors live in
+// subpackages and only produce Items.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// Strategy decides what happens when a secret with the same name already
+// exists in the target scope
+type Strategy string
+
+// Conflict strategies
+const (
+	StrategySkip      Strategy = "skip"
+	StrategyOverwrite Strategy = "overwrite"
+	StrategyFail      Strategy = "fail"
+)
+
+// ParseStrategy validates a strategy name from the command line
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case StrategySkip, StrategyOverwrite, StrategyFail:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("unknown conflict strategy %q: use skip, overwrite or fail", s)
+}
+
+// Actions reported per item
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionSkip      = "skip"
+	ActionConflict  = "conflict"
+	ActionError     = "error"
+)
+
+// Item is one secret read from a source
+type Item struct {
+	// Name is the path-style secret name, e.g. "prod/db/password"
+	Name string
+	// Versions holds values oldest first; the last one is current
+	Versions [][]byte
+	// Metadata is stored with the secret, e.g. source tags
+	Metadata map[string]interface{}
+}
+
+// Current returns the latest value
+func (i Item) Current() []byte {
+	if len(i.Versions) == 0 {
+		return nil
+	}
+	return i.Versions[len(i.Versions)-1]
+}
+
+// Options control where and how items are imported
+type Options struct {
+	Strategy      Strategy
+	DryRun        bool
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	CreatedBy     string
+}
+
+// Result is the outcome for one item
+type Result struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	SecretID uint   `json:"secret_id,omitempty"`
+	Versions int    `json:"versions,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Permission grants access to secrets under a path
+type Permission struct {
+	Path   string `json:"path"`
+	Access string `json:"access"` // read, write or admin
+}
+
+// RoleSuggestion is a Secretly role derived from a source's access policy.
+// Suggestions are only reported; roles are not created automatically.
+type RoleSuggestion struct {
+	Name        string       `json:"name"`
+	Source      string       `json:"source"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Report summarizes an import run
+type Report struct {
+	Source    string           `json:"source"`
+	DryRun    bool             `json:"dry_run"`
+	StartedAt time.Time        `json:"started_at"`
+	Results   []Result         `json:"results"`
+	Roles     []RoleSuggestion `json:"suggested_roles,omitempty"`
+}
+
+// Counts returns the number of results per action
+func (r *Report) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, res := range r.Results {
+		counts[res.Action]++
+	}
+	return counts
+}
+
+// Failed reports whether any item ended in a conflict or error
+func (r *Report) Failed() bool {
+	counts := r.Counts()
+	return counts[ActionConflict]+counts[ActionError] > 0
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable summary with one line per item
+func (r *Report) WriteText(w io.Writer) error {
+	mode := ""
+	if r.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Fprintf(w, "Import from %s%s\n", r.Source, mode)
+	for _, res := range r.Results {
+		line := fmt.Sprintf("  %-9s %s", res.Action, res.Name)
+		if res.Versions > 1 {
+			line += fmt.Sprintf(" (%d versions)", res.Versions)
+		}
+		if res.Error != "" {
+			line += ": " + res.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	if len(r.Roles) > 0 {
+		fmt.Fprintln(w, "Suggested roles:")
+		for _, role := range r.Roles {
+			fmt.Fprintf(w, "  %s (from %s)\n", role.Name, role.Source)
+			for _, p := range role.Permissions {
+				fmt.Fprintf(w, "    %-5s %s\n", p.Access, p.Path)
+			}
+		}
+	}
+
+	counts := r.Counts()
+	actions := []string{ActionCreate, ActionUpdate, ActionUnchanged, ActionSkip, ActionConflict, ActionError}
+	var parts []string
+	for _, action := range actions {
+		if counts[action] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[action], action))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "nothing to import")
+	}
+	_, err := fmt.Fprintf(w, "Summary: %s\n", strings.Join(parts, ", "))
+	return err
+}
+
+// Import applies items to the core according to opts. Per-item failures are
+// recorded in the report; the returned error is only set when the run could
+// not proceed at all.
+func Import(ctx context.Context, c *core.SecretlyCore, source string, items []Item, opts Options) (*Report, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategySkip
+	}
+	report := &Report{Source: source, DryRun: opts.DryRun, StartedAt: time.Now().UTC()}
+
+	sorted := append([]Item(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, item := range sorted {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, importItem(ctx, c, item, opts))
+	}
+	return report, nil
+}
+
+func importItem(ctx context.Context, c *core.SecretlyCore, item Item, opts Options) Result {
+	result := Result{Name: item.Name, Versions: len(item.Versions)}
+	if len(item.Current()) == 0 {
+		result.Action, result.Error = ActionError, "source value is empty"
+		return result
+	}
+
+	scope := &core.ListSecretsFilter{NamespaceID: opts.NamespaceID, ZoneID: opts.ZoneID, EnvironmentID: opts.EnvironmentID}
+	existing, err := c.FindSecret(ctx, scope, item.Name)
+	switch {
+	case errors.Is(err, core.ErrNotFound):
+		return create(ctx, c, item, opts, result)
+	case err != nil:
+		result.Action, result.Error = ActionError, err.Error()
+		return result
+	}
+
+	result.SecretID = existing.ID
+	same, err := c.ValueMatches(ctx, existing.ID, item.Current())
+	if err != nil {
+		result.Action, result.Error = ActionError, err.Error()
+		return result
+	}
+	if same {
+		result.Action = ActionUnchanged
+		return result
+	}
+
+	switch opts.Strategy {
+	case StrategySkip:
+		result.Action = ActionSkip
+	case StrategyFail:
+		result.Action, result.Error = ActionConflict, "secret already exists with a different value"
+	case StrategyOverwrite:
+		result.Action = ActionUpdate
+		if opts.DryRun {
+			return result
+		}
+		if _, err := c.UpdateSecret(ctx, existing.ID, &core.UpdateSecretRequest{Value: item.Current(), Metadata: item.Metadata}); err != nil {
+			result.Action, result.Error = ActionError, err.Error()
+		}
+	}
+	return result
+}
+
+// create stores a new secret and replays the remaining versions on top of it
+func create(ctx context.Context, c *core.SecretlyCore, item Item, opts Options, result Result) Result {
+	result.Action = ActionCreate
+	if opts.DryRun {
+		return result
+	}
+
+	secret, err := c.CreateSecret(ctx, &core.CreateSecretRequest{
+		Name:          item.Name,
+		NamespaceID:   opts.NamespaceID,
+		ZoneID:        opts.ZoneID,
+		EnvironmentID: opts.EnvironmentID,
+		Value:         item.Versions[0],
+		CreatedBy:     opts.CreatedBy,
+		Metadata:      item.Metadata,
+	})
+	if err != nil {
+		result.Action, result.Error = ActionError, err.Error()
+		return result
+	}
+	result.SecretID = secret.ID
+
+	for _, value := range item.Versions[1:] {
+		if _, err := c.UpdateSecret(ctx, secret.ID, &core.UpdateSecretRequest{Value: value}); err != nil {
+			result.Action, result.Error = ActionError, fmt.Sprintf("created, but replaying versions failed: %v", err)
+			return result
+		}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+)
+
+func TestImportStrategies(t *testing.T) {
+	c := core.NewSecretlyCore(memory.New(), nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+
+	existing, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: "prod/db/password", Value: []byte("old")})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if _, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: "prod/api/key", Value: []byte("same")}); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	items := []Item{
+		{Name: "prod/db/password", Versions: [][]byte{[]byte("new")}},
+		{Name: "prod/api/key", Versions: [][]byte{[]byte("same")}},
+		{Name: "prod/new", Versions: [][]byte{[]byte("v1"), []byte("v2")}, Metadata: map[string]interface{}{"tags": map[string]string{"team": "core"}}},
+	}
+
+	report, err := Import(ctx, c, "test", items, Options{Strategy: StrategySkip, DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	counts := report.Counts()
+	if counts[ActionCreate] != 1 || counts[ActionSkip] != 1 || counts[ActionUnchanged] != 1 {
+		t.Errorf("Unexpected dry-run counts: %v", counts)
+	}
+	if _, err := c.FindSecret(ctx, &core.ListSecretsFilter{}, "prod/new"); err == nil {
+		t.Error("Expected dry run not to create secrets")
+	}
+
+	report, _ = Import(ctx, c, "test", items, Options{Strategy: StrategyFail})
+	if !report.Failed() {
+		t.Error("Expected fail strategy to report a conflict")
+	}
+	created, err := c.FindSecret(ctx, &core.ListSecretsFilter{}, "prod/new")
+	if err != nil {
+		t.Fatalf("Expected new secret to be created: %v", err)
+	}
+	versions, _ := c.GetSecretVersions(ctx, created.ID)
+	if len(versions) != 2 {
+		t.Errorf("Expected 2 replayed versions, got %d", len(versions))
+	}
+
+	if _, err := Import(ctx, c, "test", items, Options{Strategy: StrategyOverwrite}); err != nil {
+		t.Fatalf("Overwrite failed: %v", err)
+	}
+	value, _ := c.GetSecretValue(ctx, existing.ID)
+	if !bytes.Equal(value, []byte("new")) {
+		t.Errorf("Expected overwritten value, got %s", value)
+	}
+}
@@ -0,0 +1,328 @@
+// Package vault reads secrets and ACL policies from a HashiCorp Vault KV v2
+// mount for the importer
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/importer"
+)
+
+// Client walks one KV v2 mount
+type Client struct {
+	Addr      string
+	Token     string
+	Namespace string
+	// Mount is the KV v2 mount, e.g. "kv"
+	Mount      string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for mount. Token and namespace default to
+// VAULT_TOKEN and VAULT_NAMESPACE.
+func NewClient(addr, mount string) *Client {
+	return &Client{
+		Addr:       strings.TrimSuffix(addr, "/"),
+		Token:      os.Getenv("VAULT_TOKEN"),
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		Mount:      strings.Trim(mount, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SplitPath splits "kv/app/prod" into the mount "kv" and the path "app/prod"
+func SplitPath(path string) (mount, prefix string) {
+	path = strings.Trim(path, "/")
+	mount, prefix, _ = strings.Cut(path, "/")
+	return mount, prefix
+}
+
+// Fetch reads every secret under prefix with all of its live versions.
+// Names are the secret's path within the mount. A secret whose data has a
+// single "value" key is imported as that string; otherwise the data is
+// stored as a JSON object.
+func (c *Client) Fetch(ctx context.Context, prefix string) ([]importer.Item, error) {
+	paths, err := c.walk(ctx, strings.Trim(prefix, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]importer.Item, 0, len(paths))
+	for _, path := range paths {
+		item, ok, err := c.fetchSecret(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s: %w", c.Mount, path, err)
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// walk lists secret paths below dir depth-first
+func (c *Client) walk(ctx context.Context, dir string) ([]string, error) {
+	var out struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	found, err := c.get(ctx, c.Mount+"/metadata/"+escapePath(dir), url.Values{"list": {"true"}}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// A prefix may name a single secret rather than a folder
+		if dir != "" {
+			return []string{dir}, nil
+		}
+		return nil, nil
+	}
+
+	var paths []string
+	for _, key := range out.Data.Keys {
+		child := key
+		if dir != "" {
+			child = dir + "/" + key
+		}
+		if strings.HasSuffix(key, "/") {
+			nested, err := c.walk(ctx, strings.TrimSuffix(child, "/"))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, nested...)
+			continue
+		}
+		paths = append(paths, child)
+	}
+	return paths, nil
+}
+
+type versionMeta struct {
+	CreatedTime  string `json:"created_time"`
+	DeletionTime string `json:"deletion_time"`
+	Destroyed    bool   `json:"destroyed"`
+}
+
+func (c *Client) fetchSecret(ctx context.Context, path string) (importer.Item, bool, error) {
+	var meta struct {
+		Data struct {
+			CurrentVersion int                    `json:"current_version"`
+			Versions       map[string]versionMeta `json:"versions"`
+			CustomMetadata map[string]string      `json:"custom_metadata"`
+		} `json:"data"`
+	}
+	found, err := c.get(ctx, c.Mount+"/metadata/"+escapePath(path), nil, &meta)
+	if err != nil || !found {
+		return importer.Item{}, false, err
+	}
+
+	// Deleted and destroyed versions cannot be read and are not replayed
+	var live []int
+	for key, v := range meta.Data.Versions {
+		n, err := strconv.Atoi(key)
+		if err != nil || v.Destroyed || v.DeletionTime != "" {
+			continue
+		}
+		live = append(live, n)
+	}
+	sort.Ints(live)
+	if len(live) == 0 {
+		return importer.Item{}, false, nil
+	}
+
+	item := importer.Item{
+		Name: path,
+		Metadata: map[string]interface{}{
+			"source":        "vault",
+			"vault_path":    c.Mount + "/" + path,
+			"vault_version": meta.Data.CurrentVersion,
+		},
+	}
+	if len(meta.Data.CustomMetadata) > 0 {
+		item.Metadata["tags"] = meta.Data.CustomMetadata
+	}
+
+	for _, n := range live {
+		var out struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		query := url.Values{"version": {strconv.Itoa(n)}}
+		found, err := c.get(ctx, c.Mount+"/data/"+escapePath(path), query, &out)
+		if err != nil {
+			return importer.Item{}, false, err
+		}
+		if !found || out.Data.Data == nil {
+			continue
+		}
+		value, err := encodeData(out.Data.Data)
+		if err != nil {
+			return importer.Item{}, false, err
+		}
+		item.Versions = append(item.Versions, value)
+	}
+	return item, len(item.Versions) > 0, nil
+}
+
+func encodeData(data map[string]interface{}) ([]byte, error) {
+	if len(data) == 1 {
+		if s, ok := data["value"].(string); ok {
+			return []byte(s), nil
+		}
+	}
+	return json.Marshal(data)
+}
+
+// SuggestRoles maps the ACL policies that grant access to this mount to
+// role suggestions. Paths are rewritten relative to the mount; deny rules
+// and the built-in root and default policies are ignored.
+func (c *Client) SuggestRoles(ctx context.Context) ([]importer.RoleSuggestion, error) {
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if _, err := c.get(ctx, "sys/policies/acl", url.Values{"list": {"true"}}, &list); err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+
+	var roles []importer.RoleSuggestion
+	for _, name := range list.Data.Keys {
+		if name == "root" || name == "default" {
+			continue
+		}
+		var out struct {
+			Data struct {
+				Policy string `json:"policy"`
+			} `json:"data"`
+		}
+		if _, err := c.get(ctx, "sys/policies/acl/"+url.PathEscape(name), nil, &out); err != nil {
+			return nil, fmt.Errorf("failed to read policy %s: %w", name, err)
+		}
+		if perms := MapPolicy(c.Mount, out.Data.Policy); len(perms) > 0 {
+			roles = append(roles, importer.RoleSuggestion{Name: "vault-" + name, Source: "vault policy " + name, Permissions: perms})
+		}
+	}
+	return roles, nil
+}
+
+var (
+	pathBlock    = regexp.MustCompile(`path\s+"([^"]+)"\s*\{([^}]*)\}`)
+	capabilities = regexp.MustCompile(`capabilities\s*=\s*\[([^\]]*)\]`)
+)
+
+// MapPolicy converts the path rules of an HCL policy that apply to mount
+// into permissions. sudo maps to admin, create, update, patch and delete to
+// write, and read and list to read.
+func MapPolicy(mount, policy string) []importer.Permission {
+	var perms []importer.Permission
+	for _, block := range pathBlock.FindAllStringSubmatch(policy, -1) {
+		path, ok := mountRelative(mount, block[1])
+		if !ok {
+			continue
+		}
+		caps := capabilities.FindStringSubmatch(block[2])
+		if caps == nil {
+			continue
+		}
+		if access := accessFor(caps[1]); access != "" {
+			perms = append(perms, importer.Permission{Path: path, Access: access})
+		}
+	}
+	return perms
+}
+
+// mountRelative strips "<mount>/data/" or "<mount>/metadata/" from a policy
+// path
+func mountRelative(mount, path string) (string, bool) {
+	for _, prefix := range []string{mount + "/data/", mount + "/metadata/"} {
+		if strings.HasPrefix(path, prefix) {
+			rest := strings.TrimPrefix(path, prefix)
+			if rest == "" {
+				rest = "*"
+			}
+			return rest, true
+		}
+	}
+	if path == mount+"/*" || path == mount+"/+" {
+		return "*", true
+	}
+	return "", false
+}
+
+func accessFor(list string) string {
+	caps := make(map[string]bool)
+	for _, c := range strings.Split(list, ",") {
+		caps[strings.Trim(strings.TrimSpace(c), `"`)] = true
+	}
+	switch {
+	case caps["deny"]:
+		return ""
+	case caps["sudo"]:
+		return "admin"
+	case caps["create"] || caps["update"] || caps["patch"] || caps["delete"]:
+		return "write"
+	case caps["read"] || caps["list"]:
+		return "read"
+	}
+	return ""
+}
+
+// get calls the Vault API and decodes the response into out. It returns
+// false for 404, which Vault uses for empty folders and missing secrets.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) (bool, error) {
+	u := c.Addr + "/v1/" + strings.TrimSuffix(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Vault-Token", c.Token)
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return false, fmt.Errorf("vault returned %d for %s: %s", resp.StatusCode, path, strings.Join(apiErr.Errors, "; "))
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
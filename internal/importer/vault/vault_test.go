@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchAndSuggestRoles(t *testing.T) {
+	responses := map[string]interface{}{
+		"/v1/kv/metadata?list=true":        map[string]interface{}{"keys": []string{"app/", "root-token"}},
+		"/v1/kv/metadata/app?list=true":    map[string]interface{}{"keys": []string{"db"}},
+		"/v1/kv/metadata/root-token":       map[string]interface{}{"current_version": 1, "versions": map[string]interface{}{"1": map[string]interface{}{"destroyed": true}}},
+		"/v1/kv/data/app/db?version=1":     map[string]interface{}{"data": map[string]string{"value": "v1"}},
+		"/v1/kv/data/app/db?version=3":     map[string]interface{}{"data": map[string]string{"user": "app", "password": "v3"}},
+		"/v1/sys/policies/acl?list=true":   map[string]interface{}{"keys": []string{"default", "app-readers"}},
+		"/v1/sys/policies/acl/app-readers": map[string]interface{}{"policy": `path "kv/data/app/*" { capabilities = ["read", "list"] }` + "\n" + `path "secret/data/*" { capabilities = ["update"] }`},
+		"/v1/kv/metadata/app/db": map[string]interface{}{
+			"current_version": 3,
+			"custom_metadata": map[string]string{"owner": "payments"},
+			"versions": map[string]interface{}{
+				"1": map[string]interface{}{},
+				"2": map[string]interface{}{"deletion_time": "2024-01-01T00:00:00Z"},
+				"3": map[string]interface{}{},
+			},
+		},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "kv")
+	c.Token = "token"
+	ctx := context.Background()
+
+	items, err := c.Fetch(ctx, "")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "app/db" {
+		t.Fatalf("Expected only app/db to be imported, got %+v", items)
+	}
+	if len(items[0].Versions) != 2 || string(items[0].Versions[0]) != "v1" {
+		t.Errorf("Expected live versions oldest first, got %q", items[0].Versions)
+	}
+	var current map[string]string
+	if err := json.Unmarshal(items[0].Current(), &current); err != nil || current["password"] != "v3" {
+		t.Errorf("Expected JSON value for multi-key data, got %s", items[0].Current())
+	}
+	if tags := items[0].Metadata["tags"].(map[string]string); tags["owner"] != "payments" {
+		t.Errorf("Expected custom metadata as tags, got %v", items[0].Metadata)
+	}
+
+	roles, err := c.SuggestRoles(ctx)
+	if err != nil {
+		t.Fatalf("SuggestRoles failed: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != "vault-app-readers" || len(roles[0].Permissions) != 1 {
+		t.Fatalf("Unexpected roles: %+v", roles)
+	}
+	if p := roles[0].Permissions[0]; p.Path != "app/*" || p.Access != "read" {
+		t.Errorf("Unexpected permission: %+v", p)
+	}
+}
@@ -0,0 +1,67 @@
+// Package mail sends plain-text notification email over SMTP.
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+)
+
+const defaultPort = 587
+
+// Sender delivers email through one SMTP server. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS or to localhost.
+type Sender struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// NewSender checks cfg and returns a sender for it
+func NewSender(cfg config.SMTPConfig) (*Sender, error) {
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, fmt.Errorf("smtp host and from address are required")
+	}
+	if strings.ContainsAny(cfg.From, "\r\n") {
+		return nil, fmt.Errorf("invalid from address %q", cfg.From)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	s := &Sender{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		host: cfg.Host,
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return s, nil
+}
+
+// Send delivers a plain-text message to one recipient
+func (s *Sender) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid recipient or subject")
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send mail via %s: %w", s.host, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/mail"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Channel types of notifications.channels
+const (
+	TypeEmail     = "email"
+	TypeSlack     = "slack"
+	TypeTeams     = "teams"
+	TypePagerDuty = "pagerduty"
+)
+
+func newChannel(cfg config.NotificationChannelConfig, client *http.Client) (Channel, error) {
+	switch cfg.Type {
+	case TypeEmail:
+		if len(cfg.To) == 0 {
+			return nil, fmt.Errorf("email channels need recipients in to")
+		}
+		sender, err := mail.NewSender(cfg.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		return &emailChannel{sender: sender, to: cfg.To}, nil
+	case TypeSlack, TypeTeams:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("%s channels need a webhook_url", cfg.Type)
+		}
+		if cfg.Type == TypeSlack {
+			return &slackChannel{url: cfg.WebhookURL, client: client}, nil
+		}
+		return &teamsChannel{url: cfg.WebhookURL, client: client}, nil
+	case TypePagerDuty:
+		if cfg.RoutingKey == "" {
+			return nil, fmt.Errorf("pagerduty channels need a routing_key")
+		}
+		url := cfg.URL
+		if url == "" {
+			url = pagerDutyEventsURL
+		}
+		return &pagerDutyChannel{url: url, routingKey: cfg.RoutingKey, client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q: use email, slack, teams or pagerduty", cfg.Type)
+}
+
+// emailChannel mails plain-text notifications to fixed recipients
+type emailChannel struct {
+	sender *mail.Sender
+	to     []string
+}
+
+func (c *emailChannel) Send(ctx context.Context, n Notification) error {
+	body := fmt.Sprintf("%s\n\nEvent:     %s (%s)\nTime:      %s\n", n.Event.Description, n.Event.Type, n.Severity,
+		n.Event.Time.UTC().Format("2006-01-02 15:04:05 MST"))
+	if n.Event.IPAddress != "" {
+		body += fmt.Sprintf("Client:    %s %s\n", n.Event.IPAddress, n.Event.UserAgent)
+	}
+	body += fmt.Sprintf("Audit ID:  %d\n", n.Event.ID)
+	for _, to := range c.to {
+		if err := c.sender.Send(to, n.Summary, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slackChannel posts to a Slack incoming webhook
+type slackChannel struct {
+	url    string
+	client *http.Client
+}
+
+func (c *slackChannel) Send(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("*%s* [%s]\n%s", n.Summary, n.Severity, n.Event.Description)
+	return postJSON(ctx, c.client, c.url, map[string]string{"text": text})
+}
+
+// teamsChannel posts a message card to a Microsoft Teams incoming webhook
+type teamsChannel struct {
+	url    string
+	client *http.Client
+}
+
+// teamsColors are the card accents per severity
+var teamsColors = map[string]string{SeverityInfo: "2F6FEB", SeverityWarning: "D29922", SeverityCritical: "CF222E"}
+
+func (c *teamsChannel) Send(ctx context.Context, n Notification) error {
+	return postJSON(ctx, c.client, c.url, map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    n.Summary,
+		"title":      n.Summary,
+		"themeColor": teamsColors[n.Severity],
+		"text":       n.Event.Description,
+	})
+}
+
+// pagerDutyChannel triggers PagerDuty incidents through the Events API.
+// The audit event ID is the dedup key, so a retried delivery does not
+// open a second incident.
+type pagerDutyChannel struct {
+	url        string
+	routingKey string
+	client     *http.Client
+}
+
+func (c *pagerDutyChannel) Send(ctx context.Context, n Notification) error {
+	source, _ := os.Hostname()
+	return postJSON(ctx, c.client, c.url, map[string]interface{}{
+		"routing_key":  c.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    fmt.Sprintf("secretly-audit-%d", n.Event.ID),
+		"payload": map[string]interface{}{
+			"summary":        n.Summary + ": " + n.Event.Description,
+			"source":         source,
+			"severity":       n.Severity,
+			"timestamp":      n.Event.Time.UTC(),
+			"component":      "secretly",
+			"class":          n.Event.Type,
+			"custom_details": n.Event,
+		},
+	})
+}
+
+// postJSON posts body to url and fails for non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package notify alerts people about audit events through email, Slack,
+// Microsoft Teams or PagerDuty. Routes pick the channels for each event
+// type and namespace; the core hands every event to a Router, which
+// delivers in the background.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+const (
+	// DefaultTimeout bounds one delivery when notifications do not set
+	// timeout_seconds
+	DefaultTimeout = 10 * time.Second
+	// queueSize is how many notifications may wait for delivery before
+	// further ones are dropped
+	queueSize = 256
+)
+
+// Severities of notifications, as understood by PagerDuty
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// eventGroups name sets of event types routes may refer to
+var eventGroups = map[string][]string{
+	// expiry alerts of the secret lifecycle
+	"expiry": {core.EventSecretExpiring, core.EventSecretExpired, core.EventSecretPurged},
+	// secrets shared with, or taken away from, other people
+	"sharing": {core.EventPermissionGranted, core.EventPermissionRevoked, core.EventOwnerTransferred},
+	// scheduled releases of secrets to other people
+	"releases": {core.EventSecretReleaseScheduled, core.EventSecretReleasePending, core.EventSecretReleased,
+		core.EventSecretReleaseCancelled},
+	// recoveries of escrowed secrets by custodians
+	"escrow": {core.EventEscrowRecoveryRequested, core.EventEscrowRecoveryApproved, core.EventEscrowRecovered,
+		core.EventEscrowRecoveryCollected, core.EventEscrowRecoveryExpired},
+	// access that looks like an attack or a leaked credential
+	"anomalies": {core.EventCanaryTriggered, core.EventAccessDenied, core.EventNetworkDenied,
+		core.EventAccessBypassed, core.EventLoginFailed},
+}
+
+// severities of event types; other events are informational
+var severities = map[string]string{
+	core.EventCanaryTriggered:         SeverityCritical,
+	core.EventAccessBypassed:          SeverityWarning,
+	core.EventAccessDenied:            SeverityWarning,
+	core.EventNetworkDenied:           SeverityWarning,
+	core.EventLoginFailed:             SeverityWarning,
+	core.EventSecretExpiring:          SeverityWarning,
+	core.EventSecretExpired:           SeverityWarning,
+	core.EventSecretReleasePending:    SeverityWarning,
+	core.EventEscrowRecoveryRequested: SeverityWarning,
+}
+
+// Notification is an audit event as delivered to a channel
+type Notification struct {
+	Event    core.Event
+	Severity string
+	// Summary is a one-line description, e.g. for subjects and titles
+	Summary string
+}
+
+// Channel delivers notifications to one destination
+type Channel interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+type route struct {
+	events     []string
+	namespaces []uint
+	channels   []string
+}
+
+func (r *route) matches(ev core.Event) bool {
+	if len(r.events) > 0 && !slices.Contains(r.events, ev.Type) {
+		return false
+	}
+	return len(r.namespaces) == 0 || slices.Contains(r.namespaces, ev.NamespaceID)
+}
+
+// Router sends audit events to the channels of the routes they match. It
+// implements core.Notifier.
+type Router struct {
+	channels map[string]Channel
+	routes   []route
+	timeout  time.Duration
+
+	queue     chan core.Event
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New builds the channels and routes of cfg and starts delivering
+func New(cfg config.NotificationsConfig) (*Router, error) {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	channels := make(map[string]Channel, len(cfg.Channels))
+	for name, ch := range cfg.Channels {
+		channel, err := newChannel(ch, client)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %q: %w", name, err)
+		}
+		channels[name] = channel
+	}
+	routes := make([]route, 0, len(cfg.Routes))
+	for i, r := range cfg.Routes {
+		if len(r.Channels) == 0 {
+			return nil, fmt.Errorf("notification route %d has no channels", i+1)
+		}
+		for _, name := range r.Channels {
+			if _, ok := channels[name]; !ok {
+				return nil, fmt.Errorf("notification route %d uses unknown channel %q", i+1, name)
+			}
+		}
+		var events []string
+		for _, e := range r.Events {
+			if group, ok := eventGroups[e]; ok {
+				events = append(events, group...)
+			} else {
+				events = append(events, e)
+			}
+		}
+		routes = append(routes, route{events: events, namespaces: r.Namespaces, channels: r.Channels})
+	}
+	return newRouter(channels, routes, timeout), nil
+}
+
+// newRouter starts delivering to channels by name along routes
+func newRouter(channels map[string]Channel, routes []route, timeout time.Duration) *Router {
+	r := &Router{
+		channels: channels,
+		routes:   routes,
+		timeout:  timeout,
+		queue:    make(chan core.Event, queueSize),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Notify queues ev for delivery. A router that does not keep up drops
+// notifications rather than slowing down the operations that record them.
+func (r *Router) Notify(ev core.Event) {
+	select {
+	case r.queue <- ev:
+	default:
+		log.Printf("⚠️  Notifications are falling behind, dropped event %d", ev.ID)
+	}
+}
+
+// Close delivers the queued notifications and stops the router
+func (r *Router) Close() {
+	r.closeOnce.Do(func() {
+		close(r.queue)
+		<-r.done
+	})
+}
+
+func (r *Router) run() {
+	defer close(r.done)
+	for ev := range r.queue {
+		r.deliver(ev)
+	}
+}
+
+// deliver sends ev once to every channel of the routes it matches
+func (r *Router) deliver(ev core.Event) {
+	var targets []string
+	for i := range r.routes {
+		if !r.routes[i].matches(ev) {
+			continue
+		}
+		for _, name := range r.routes[i].channels {
+			if !slices.Contains(targets, name) {
+				targets = append(targets, name)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	n := Notification{Event: ev, Severity: Severity(ev.Type), Summary: summary(ev)}
+	for _, name := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		if err := r.channels[name].Send(ctx, n); err != nil {
+			log.Printf("⚠️  Failed to notify %s of event %d: %v", name, ev.ID, err)
+		}
+		cancel()
+	}
+}
+
+// Severity returns the severity notifications of eventType are sent with
+func Severity(eventType string) string {
+	if s, ok := severities[eventType]; ok {
+		return s
+	}
+	return SeverityInfo
+}
+
+func summary(ev core.Event) string {
+	s := fmt.Sprintf("Secretly: %s", ev.Type)
+	if ev.SecretID != nil {
+		s += fmt.Sprintf(" (secret %d)", *ev.SecretID)
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// recorder collects the JSON bodies posted to it
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func (rec *recorder) server(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Invalid notification body: %v", err)
+		}
+		rec.mu.Lock()
+		rec.bodies = append(rec.bodies, body)
+		rec.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRouter(t *testing.T) {
+	var slack, pagerDuty recorder
+	router, err := New(config.NotificationsConfig{
+		Channels: map[string]config.NotificationChannelConfig{
+			"chat":   {Type: TypeSlack, WebhookURL: slack.server(t).URL},
+			"oncall": {Type: TypePagerDuty, RoutingKey: "key", URL: pagerDuty.server(t).URL},
+		},
+		Routes: []config.NotificationRouteConfig{
+			{Events: []string{"anomalies"}, Channels: []string{"oncall", "chat"}},
+			{Events: []string{"sharing"}, Namespaces: []uint{2}, Channels: []string{"chat"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	secret := uint(7)
+	now := time.Now()
+	router.Notify(core.Event{ID: 1, Type: core.EventCanaryTriggered, Time: now, Description: "Canary read", SecretID: &secret, NamespaceID: 1})
+	router.Notify(core.Event{ID: 2, Type: core.EventPermissionGranted, Time: now, Description: "Shared in 2", NamespaceID: 2})
+	router.Notify(core.Event{ID: 3, Type: core.EventPermissionGranted, Time: now, Description: "Shared in 3", NamespaceID: 3})
+	router.Notify(core.Event{ID: 4, Type: core.EventSecretRead, Time: now, Description: "Read"})
+	router.Close()
+
+	if len(slack.bodies) != 2 || !strings.Contains(slack.bodies[0]["text"].(string), "Canary read") ||
+		!strings.Contains(slack.bodies[1]["text"].(string), "Shared in 2") {
+		t.Errorf("Expected the canary and the share in namespace 2 on Slack, got %v", slack.bodies)
+	}
+	if len(pagerDuty.bodies) != 1 {
+		t.Fatalf("Expected one PagerDuty event, got %v", pagerDuty.bodies)
+	}
+	event := pagerDuty.bodies[0]
+	payload := event["payload"].(map[string]interface{})
+	if event["routing_key"] != "key" || event["dedup_key"] != "secretly-audit-1" || payload["severity"] != SeverityCritical {
+		t.Errorf("Expected a critical PagerDuty event for the canary, got %v", event)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]config.NotificationsConfig{
+		"unknown type":    {Channels: map[string]config.NotificationChannelConfig{"x": {Type: "fax"}}},
+		"missing webhook": {Channels: map[string]config.NotificationChannelConfig{"x": {Type: TypeTeams}}},
+		"email without to": {Channels: map[string]config.NotificationChannelConfig{
+			"x": {Type: TypeEmail, SMTP: config.SMTPConfig{Host: "smtp.example.com", From: "secretly@example.com"}}}},
+		"unknown channel": {Routes: []config.NotificationRouteConfig{{Channels: []string{"nowhere"}}}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
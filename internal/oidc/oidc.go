@@ -0,0 +1,357 @@
+// Package oidc verifies OpenID Connect ID tokens issued to CI jobs, such as
+// GitHub Actions and GitLab CI/CD tokens.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Well-known CI issuers
+const (
+	GitHubActionsIssuer = "https://token.actions.githubusercontent.com"
+	GitLabIssuer        = "https://gitlab.com"
+)
+
+// leeway tolerates clock skew between the issuer and this server
+const leeway = time.Minute
+
+// minRefreshInterval limits JWKS refetches triggered by unknown key IDs
+const minRefreshInterval = time.Minute
+
+// ErrInvalidToken is returned for any token that fails verification
+var ErrInvalidToken = errors.New("invalid OIDC token")
+
+// Claims are the decoded token payload
+type Claims map[string]interface{}
+
+// String returns a string claim, or "" if it is missing or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Match reports whether every claim named in patterns matches its glob
+// pattern, where "*" matches any sequence of characters including "/".
+// Non-string claims such as booleans are compared by their JSON form.
+func (c Claims) Match(patterns map[string]string) bool {
+	for name, pattern := range patterns {
+		value, ok := c[name]
+		if !ok {
+			return false
+		}
+		s, isString := value.(string)
+		if !isString {
+			encoded, _ := json.Marshal(value)
+			s = string(encoded)
+		}
+		if !matchGlob(pattern, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchGlob(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+// Verifier checks tokens from a single issuer against its published keys
+type Verifier struct {
+	issuer  string
+	jwksURL string
+	client  *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewVerifier creates a verifier for issuer. When jwksURL is empty it is
+// discovered from the issuer's /.well-known/openid-configuration.
+func NewVerifier(issuer, jwksURL string, client *http.Client) *Verifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{
+		issuer:  strings.TrimSuffix(issuer, "/"),
+		jwksURL: jwksURL,
+		client:  client,
+	}
+}
+
+// Issuer returns the issuer this verifier accepts
+func (v *Verifier) Issuer() string {
+	return v.issuer
+}
+
+// Verify checks the signature, issuer, audience and validity period of raw
+// and returns its claims
+func (v *Verifier) Verify(ctx context.Context, raw, audience string) (Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad payload: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkClaims(claims, audience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims Claims, audience string) error {
+	if strings.TrimSuffix(claims.String("iss"), "/") != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.String("iss"))
+	}
+	if !hasAudience(claims["aud"], audience) {
+		return fmt.Errorf("%w: audience does not include %q", ErrInvalidToken, audience)
+	}
+
+	now := time.Now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok || now.After(exp.Add(leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type does not match RS256", ErrInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("%w: key type does not match ES256", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+// key returns the signing key for kid, refetching the JWKS when the key is
+// unknown (issuers rotate keys) but at most once per minRefreshInterval
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.lastRefresh) < minRefreshInterval && v.keys != nil {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	v.lastRefresh = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := v.jwksURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("failed to discover JWKS for %s: %w", v.issuer, err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("issuer %s does not publish jwks_uri", v.issuer)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS for %s: %w", v.issuer, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (v *Verifier) getJSON(ctx context.Context, url string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// PeekIssuer returns the unverified iss claim so the caller can pick the
+// verifier for it; the result must not be trusted on its own
+func PeekIssuer(raw string) string {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(claims.String("iss"), "/")
+}
+
+func decodeSegment(segment string, dst interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
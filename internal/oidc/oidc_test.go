@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	issuer = ts.URL
+
+	claims := map[string]interface{}{
+		"iss":        issuer,
+		"aud":        "secretly",
+		"sub":        "repo:acme/app:ref:refs/heads/main",
+		"repository": "acme/app",
+		"ref":        "refs/heads/main",
+		"exp":        time.Now().Add(5 * time.Minute).Unix(),
+	}
+	v := NewVerifier(issuer, "", nil)
+	ctx := context.Background()
+
+	token := signRS256(t, key, "k1", claims)
+	if PeekIssuer(token) != issuer {
+		t.Errorf("Expected issuer %q, got %q", issuer, PeekIssuer(token))
+	}
+	got, err := v.Verify(ctx, token, "secretly")
+	if err != nil {
+		t.Fatalf("Expected valid token: %v", err)
+	}
+	if !got.Match(map[string]string{"repository": "acme/*", "ref": "refs/heads/main"}) {
+		t.Error("Expected claims to match policy")
+	}
+	if got.Match(map[string]string{"ref": "refs/tags/*"}) {
+		t.Error("Expected tag pattern not to match branch ref")
+	}
+
+	if _, err := v.Verify(ctx, token, "other-audience"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected audience mismatch, got %v", err)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	if _, err := v.Verify(ctx, signRS256(t, key, "k1", claims), "secretly"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected expired token to fail, got %v", err)
+	}
+
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := v.Verify(ctx, signRS256(t, otherKey, "k1", claims), "secretly"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected forged signature to fail, got %v", err)
+	}
+}
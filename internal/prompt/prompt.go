@@ -0,0 +1,182 @@
+// Package prompt implements the line-based terminal questions used by
+// interactive commands
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrAborted is returned when input ends before a question is answered
+var ErrAborted = errors.New("input closed, aborted")
+
+// maxAttempts bounds re-asking after invalid answers
+const maxAttempts = 3
+
+// Prompter asks questions on out and reads answers from in
+type Prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// hide turns terminal echo off and on; nil when input is not a terminal
+	hide func(hidden bool) error
+}
+
+// New creates a prompter for the given streams without echo control
+func New(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), out: out}
+}
+
+// Terminal creates a prompter on stdin and stderr that hides secret input
+// with stty when stdin is a terminal
+func Terminal() *Prompter {
+	p := New(os.Stdin, os.Stderr)
+	if stty("-echo") == nil {
+		_ = stty("echo")
+		p.hide = func(hidden bool) error {
+			if hidden {
+				return stty("-echo")
+			}
+			return stty("echo")
+		}
+	}
+	return p
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func (p *Prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", ErrAborted
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Ask returns the answer, or def when the answer is empty
+func (p *Prompter) Ask(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", label)
+	}
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// AskValid asks until validate accepts the answer
+func (p *Prompter) AskValid(label, def string, validate func(string) error) (string, error) {
+	for attempt := 1; ; attempt++ {
+		answer, err := p.Ask(label, def)
+		if err != nil {
+			return "", err
+		}
+		verr := validate(answer)
+		if verr == nil {
+			return answer, nil
+		}
+		if attempt == maxAttempts {
+			return "", verr
+		}
+		fmt.Fprintf(p.out, "❌ %v\n", verr)
+	}
+}
+
+// Hidden reads a line without echoing it
+func (p *Prompter) Hidden(label string) (string, error) {
+	fmt.Fprintf(p.out, "%s: ", label)
+	if p.hide != nil && p.hide(true) == nil {
+		defer func() {
+			_ = p.hide(false)
+			fmt.Fprintln(p.out)
+		}()
+	}
+	return p.readLine()
+}
+
+// HiddenConfirmed reads a hidden value twice and asks again on mismatch
+func (p *Prompter) HiddenConfirmed(label string, validate func(string) error) (string, error) {
+	for attempt := 1; ; attempt++ {
+		value, err := p.Hidden(label)
+		if err != nil {
+			return "", err
+		}
+		verr := validate(value)
+		if verr == nil {
+			var again string
+			if again, err = p.Hidden("Confirm " + strings.ToLower(label[:1]) + label[1:]); err != nil {
+				return "", err
+			}
+			if again == value {
+				return value, nil
+			}
+			verr = errors.New("values do not match")
+		}
+		if attempt == maxAttempts {
+			return "", verr
+		}
+		fmt.Fprintf(p.out, "❌ %v\n", verr)
+	}
+}
+
+// Confirm asks a yes/no question
+func (p *Prompter) Confirm(label string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	fmt.Fprintf(p.out, "%s [%s]: ", label, hint)
+	answer, err := p.readLine()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Choose lists options numbered from 1 and returns the chosen index. def is
+// the index used for an empty answer, or -1 to require a choice.
+func (p *Prompter) Choose(label string, options []string, def int) (int, error) {
+	fmt.Fprintf(p.out, "%s:\n", label)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, option)
+	}
+	defLabel := ""
+	if def >= 0 && def < len(options) {
+		defLabel = strconv.Itoa(def + 1)
+	}
+	answer, err := p.AskValid("Choose", defLabel, func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > len(options) {
+			return fmt.Errorf("enter a number between 1 and %d", len(options))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, _ := strconv.Atoi(answer)
+	return n - 1, nil
+}
@@ -0,0 +1,44 @@
+package prompt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrompter(t *testing.T) {
+	var out bytes.Buffer
+	p := New(strings.NewReader("\nabc\n7\n2\ns3cret\nother\ns3cret\ns3cret\n"), &out)
+
+	if v, _ := p.Ask("Name", "default"); v != "default" {
+		t.Errorf("Expected default for empty answer, got %q", v)
+	}
+
+	v, err := p.AskValid("Number", "", func(s string) error {
+		if s != "7" {
+			return fmt.Errorf("not seven")
+		}
+		return nil
+	})
+	if err != nil || v != "7" {
+		t.Errorf("Expected retry to accept 7, got %q, %v", v, err)
+	}
+	if !strings.Contains(out.String(), "not seven") {
+		t.Error("Expected validation error to be shown")
+	}
+
+	if choice, _ := p.Choose("Type", []string{"a", "b"}, 0); choice != 1 {
+		t.Errorf("Expected second option, got %d", choice)
+	}
+
+	value, err := p.HiddenConfirmed("Value", func(string) error { return nil })
+	if err != nil || value != "s3cret" {
+		t.Errorf("Expected confirmed value after mismatch, got %q, %v", value, err)
+	}
+
+	if _, err := p.Ask("More", ""); !errors.Is(err, ErrAborted) {
+		t.Errorf("Expected ErrAborted at end of input, got %v", err)
+	}
+}
@@ -0,0 +1,490 @@
+// Package qr encodes short text, such as otpauth:// URIs, as QR codes and
+// renders them for terminals. It supports byte mode at error correction
+// level M for versions 1 to 10, which holds up to 213 bytes.
+package qr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Code is an encoded QR symbol; Modules[y][x] is true for dark modules
+type Code struct {
+	Size    int
+	Modules [][]bool
+}
+
+// versions holds the level M block structure of versions 1 to 10: the
+// number of blocks, error correction codewords per block and alignment
+// pattern centers
+var versions = []struct {
+	blocks    int
+	eccLen    int
+	alignment []int
+}{
+	{1, 10, nil},
+	{1, 16, []int{6, 18}},
+	{1, 26, []int{6, 22}},
+	{2, 18, []int{6, 26}},
+	{2, 24, []int{6, 30}},
+	{4, 16, []int{6, 34}},
+	{4, 18, []int{6, 22, 38}},
+	{4, 22, []int{6, 24, 42}},
+	{5, 22, []int{6, 26, 46}},
+	{5, 26, []int{6, 28, 50}},
+}
+
+// levelM is the format information value of error correction level M
+const levelM = 0
+
+// Encode returns the smallest QR code holding data
+func Encode(data string) (*Code, error) {
+	for v := 1; v <= len(versions); v++ {
+		if len(data) <= dataCodewords(v)-byteModeOverhead(v) {
+			return encode(v, []byte(data)), nil
+		}
+	}
+	return nil, fmt.Errorf("%d bytes do not fit in a version %d QR code", len(data), len(versions))
+}
+
+// byteModeOverhead is the bytes taken by the mode indicator and length
+func byteModeOverhead(version int) int {
+	if version < 10 {
+		return 2 // 4 + 8 bits, rounded up
+	}
+	return 3 // 4 + 16 bits, rounded up
+}
+
+func rawCodewords(version int) int {
+	bits := (16*version+128)*version + 64
+	if version >= 2 {
+		n := version/7 + 2
+		bits -= (25*n-10)*n - 55
+		if version >= 7 {
+			bits -= 36
+		}
+	}
+	return bits / 8
+}
+
+func dataCodewords(version int) int {
+	v := versions[version-1]
+	return rawCodewords(version) - v.blocks*v.eccLen
+}
+
+func encode(version int, data []byte) *Code {
+	// Data bits: byte mode, length, data, terminator, padding
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	if version < 10 {
+		bb.append(len(data), 8)
+	} else {
+		bb.append(len(data), 16)
+	}
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	capacity := dataCodewords(version) * 8
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	codewords := interleave(version, bb.bytes())
+
+	c := newCode(version)
+	c.drawCodewords(codewords)
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // masks are their own inverse
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+	return &Code{Size: c.size, Modules: c.modules}
+}
+
+// interleave splits data into blocks, appends the error correction
+// codewords of each and interleaves them
+func interleave(version int, data []byte) []byte {
+	v := versions[version-1]
+	raw := rawCodewords(version)
+	short := v.blocks - raw%v.blocks
+	shortLen := raw / v.blocks
+	divisor := rsDivisor(v.eccLen)
+
+	var blocks [][]byte
+	k := 0
+	for i := 0; i < v.blocks; i++ {
+		n := shortLen - v.eccLen
+		if i >= short {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < short {
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	var out []byte
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			// Short blocks have a placeholder where long blocks have their
+			// last data codeword
+			if i != shortLen-v.eccLen || j >= short {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of degree n,
+// highest coefficient omitted
+func rsDivisor(n int) []byte {
+	result := make([]byte, n)
+	result[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < n {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>i)&1 == 1)
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	out := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+// symbol is a code under construction; function modules (finder, timing,
+// alignment, format and version patterns) are not masked
+type symbol struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newCode(version int) *symbol {
+	size := version*4 + 17
+	c := &symbol{size: size, modules: grid(size), function: grid(size)}
+
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(size-4, 3)
+	c.drawFinder(3, size-4)
+
+	align := versions[version-1].alignment
+	last := len(align) - 1
+	for i, x := range align {
+		for j, y := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	c.drawFormat(0) // reserves the area; redrawn once the mask is chosen
+	if version >= 7 {
+		bits := versionBits(version)
+		for i := 0; i < 18; i++ {
+			bit := (bits>>i)&1 == 1
+			a, b := size-11+i%3, i/3
+			c.set(a, b, bit)
+			c.set(b, a, bit)
+		}
+	}
+	return c
+}
+
+// versionBits returns the 18-bit version information of versions 7 and up
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+// set draws a function module at column x, row y
+func (c *symbol) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *symbol) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= c.size || y < 0 || y >= c.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (c *symbol) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the 15-bit format information for mask at level M
+func formatBits(mask int) int {
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *symbol) drawFormat(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(i))
+	}
+	c.set(8, c.size-8, true)
+}
+
+// drawCodewords places the data in the two-column zigzag from the bottom
+// right corner
+func (c *symbol) drawCodewords(data []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = (data[i>>3]>>(7-(i&7)))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *symbol) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, following the four rules
+// of ISO/IEC 18004 section 7.8.3
+func (c *symbol) penalty() int {
+	n := c.size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	score := 0
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			// 1:1:3:1:1 finder-like runs with four light modules on a side
+			for x := 0; x+11 <= n; x++ {
+				if matches(at, x, y, transpose, []bool{true, false, true, true, true, false, true, false, false, false, false}) ||
+					matches(at, x, y, transpose, []bool{false, false, false, false, true, false, true, true, true, false, true}) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					score += 3
+				}
+			}
+		}
+	}
+	// Distance of the dark share from 50%, in whole steps of 5%; the total
+	// is odd, so k is never negative
+	total := n * n
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+func matches(at func(x, y int, transpose bool) bool, x, y int, transpose bool, pattern []bool) bool {
+	for k, dark := range pattern {
+		if at(x+k, y, transpose) != dark {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// String renders the code with half-block characters, two rows per line,
+// with the four-module quiet zone scanners need. Light modules are drawn as
+// blocks, so the code scans on terminals with light text on a dark
+// background.
+func (c *Code) String() string {
+	const quiet = 4
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+			return false
+		}
+		return c.Modules[y][x]
+	}
+
+	var sb strings.Builder
+	total := c.Size + 2*quiet
+	for y := 0; y < total; y += 2 {
+		for x := 0; x < total; x++ {
+			top, bottom := !dark(x, y), y+1 < total && !dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonAndFormat(t *testing.T) {
+	// Version 1-M "HELLO WORLD" example from ISO/IEC 18004 annex I
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("Error correction codewords = %v, want %v", got, want)
+	}
+
+	formats := []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+	for mask, want := range formats {
+		if got := formatBits(mask); got != want {
+			t.Errorf("Format bits for mask %d = %015b, want %015b", mask, got, want)
+		}
+	}
+
+	if got := versionBits(7); got != 0x07C94 {
+		t.Errorf("Version bits for version 7 = %018b", got)
+	}
+
+	uri := "otpauth://totp/Secretly:alice?algorithm=SHA1&digits=6&issuer=Secretly&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	code, err := Encode(uri)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// 114 bytes need version 7 (45 modules) at level M
+	if code.Size != 45 || !code.Modules[0][0] || code.Modules[7][7] || !code.Modules[code.Size-8][8] {
+		t.Errorf("Unexpected symbol of size %d", code.Size)
+	}
+	if lines := strings.Count(code.String(), "\n"); lines != (45+8+1)/2 {
+		t.Errorf("Expected %d rendered lines, got %d", (45+8+1)/2, lines)
+	}
+	if _, err := Encode(strings.Repeat("x", 300)); err == nil {
+		t.Error("Expected an error for data that does not fit")
+	}
+}
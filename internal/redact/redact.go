@@ -0,0 +1,124 @@
+// Package redact scrubs values that look like secret material from text
+// before it is logged or returned in error messages.
+package redact
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces redacted material
+const Placeholder = "[REDACTED]"
+
+// sensitiveKeys are parameter and field names whose values are always redacted
+var sensitiveKeys = []string{
+	"password", "passphrase", "secret", "token", "api_key", "apikey",
+	"access_key", "private_key", "client_secret", "authorization", "value",
+}
+
+var patterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// PEM private keys and certificates
+	{regexp.MustCompile(`(?s)-----BEGIN [A-Z ]+-----.*?-----END [A-Z ]+-----`), Placeholder},
+	// Authorization headers
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + Placeholder},
+	// JSON fields: "password": "..."
+	{regexp.MustCompile(`(?i)("(?:` + keyAlternation() + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`), `$1"` + Placeholder + `"`},
+	// key=value pairs; "key: value" is left alone, as wrapped errors such
+	// as "failed to decrypt secret: ..." read the same way
+	{regexp.MustCompile(`(?i)\b((?:` + keyAlternation() + `)\s*=\s*)[^\s&,;"']+`), "$1" + Placeholder},
+	// JWTs
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), Placeholder},
+	// AWS access key IDs
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`), Placeholder},
+	// Long hex strings (hashes, keys)
+	{regexp.MustCompile(`\b[A-Fa-f0-9]{32,}\b`), Placeholder},
+}
+
+// opaque matches base64-like runs; looksRandom decides whether to redact them
+var opaque = regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`)
+
+func keyAlternation() string {
+	keys := make([]string, len(sensitiveKeys))
+	for i, k := range sensitiveKeys {
+		keys[i] = regexp.QuoteMeta(k)
+	}
+	return strings.Join(keys, "|")
+}
+
+// String returns s with anything that looks like secret material replaced
+func String(s string) string {
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return opaque.ReplaceAllStringFunc(s, func(m string) string {
+		if looksRandom(m) {
+			return Placeholder
+		}
+		return m
+	})
+}
+
+// looksRandom tells tokens and keys apart from long identifiers and paths,
+// which rarely mix upper case, lower case and digits
+func looksRandom(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// URL returns the path and query of u with sensitive query values removed
+func URL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query := u.Query()
+	for key := range query {
+		if isSensitiveKey(key) {
+			query.Set(key, Placeholder)
+		}
+	}
+	encoded := strings.ReplaceAll(query.Encode(), url.QueryEscape(Placeholder), Placeholder)
+	return u.Path + "?" + String(encoded)
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer redacts everything written through it. It is meant for line-based
+// output such as the standard logger, where each Write is a complete line.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w, e.g. log.SetOutput(redact.NewWriter(os.Stderr))
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (rw *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
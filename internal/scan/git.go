@@ -0,0 +1,109 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/redact"
+)
+
+// IsGitURL reports whether target looks like a remote repository rather than
+// a local path
+func IsGitURL(target string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://", "git@"} {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone clones url into dir without checking out a working tree; only its
+// history is scanned
+func Clone(url, dir string) error {
+	cmd := exec.Command("git", "clone", "--quiet", "--no-checkout", url, dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone %s: %w: %s", redact.String(url), err, redact.String(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// ScanGitHistory scans lines added in every commit reachable from any ref
+func (s *Scanner) ScanGitHistory(repo string) ([]Finding, error) {
+	out, err := git(repo, "log", "--all", "-p", "--unified=0", "--no-color", "--no-ext-diff", "--format=commit %H")
+	if err != nil {
+		return nil, err
+	}
+	return s.scanDiff(bytes.NewReader(out))
+}
+
+// ScanStaged scans lines added in the index, as a pre-commit hook would see them
+func (s *Scanner) ScanStaged(repo string) ([]Finding, error) {
+	out, err := git(repo, "diff", "--cached", "--unified=0", "--no-color", "--no-ext-diff", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+	return s.scanDiff(bytes.NewReader(out))
+}
+
+// scanDiff scans added lines of unified diff output, tracking the commit,
+// file and new-side line number of each
+func (s *Scanner) scanDiff(r io.Reader) ([]Finding, error) {
+	var (
+		findings []Finding
+		commit   string
+		file     string
+		lineNo   int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "commit "):
+			commit = strings.TrimPrefix(line, "commit ")
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "@@ "):
+			lineNo = hunkStart(line)
+		case strings.HasPrefix(line, "+") && file != "/dev/null":
+			for _, f := range s.scanLine(file, lineNo, line[1:]) {
+				f.Commit = commit
+				findings = append(findings, f)
+			}
+			lineNo++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return findings, fmt.Errorf("failed to read git diff: %w", err)
+	}
+	return findings, nil
+}
+
+// hunkStart parses the new-side start line from "@@ -a,b +c,d @@"
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
+
+func git(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
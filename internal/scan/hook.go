@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies hooks written by InstallHook so they can be replaced
+const hookMarker = "# Installed by secretly scan install-hook"
+
+const hookScript = `#!/bin/sh
+` + hookMarker + `
+# Blocks commits that add plaintext credentials. Mark false positives with
+# "secretly:ignore" on the offending line, or bypass once with --no-verify.
+if ! command -v secretly >/dev/null 2>&1; then
+  echo "secretly not found in PATH; skipping secret scan" >&2
+  exit 0
+fi
+exec secretly scan --staged .
+`
+
+// InstallHook writes a pre-commit hook to the repository's hooks directory
+// and returns its path. An existing hook not written by secretly is only
+// replaced when force is set.
+func InstallHook(repo string, force bool) (string, error) {
+	out, err := git(repo, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %w", err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(repo, hooksDir)
+	}
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+
+	path := filepath.Join(hooksDir, "pre-commit")
+	if existing, err := os.ReadFile(path); err == nil {
+		if !force && !strings.Contains(string(existing), hookMarker) {
+			return "", fmt.Errorf("%s already exists; use --force to replace it", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read existing hook: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(hookScript), 0755); err != nil {
+		return "", fmt.Errorf("failed to write hook: %w", err)
+	}
+	return path, nil
+}
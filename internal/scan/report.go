@@ -0,0 +1,73 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Report summarizes a scan. Matched values are masked.
+type Report struct {
+	Target       string    `json:"target"`
+	Mode         string    `json:"mode"`
+	ScannedAt    time.Time `json:"scanned_at"`
+	FilesScanned int       `json:"files_scanned,omitempty"`
+	Findings     []Finding `json:"findings"`
+}
+
+// Scan modes recorded in reports
+const (
+	ModeFiles   = "files"
+	ModeHistory = "history"
+	ModeStaged  = "staged"
+)
+
+// NewReport builds a report with findings sorted by file and line
+func NewReport(target, mode string, filesScanned int, findings []Finding) *Report {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return &Report{
+		Target:       target,
+		Mode:         mode,
+		ScannedAt:    time.Now().UTC(),
+		FilesScanned: filesScanned,
+		Findings:     findings,
+	}
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable report
+func (r *Report) WriteText(w io.Writer) error {
+	for _, f := range r.Findings {
+		location := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if f.Commit != "" {
+			location = fmt.Sprintf("%s (commit %.12s)", location, f.Commit)
+		}
+		if _, err := fmt.Fprintf(w, "❌ %s: %s [%s] %s\n", location, f.Description, f.RuleID, f.Masked); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n📋 %d potential secrets found", len(r.Findings))
+	if err == nil && r.FilesScanned > 0 {
+		_, err = fmt.Fprintf(w, " in %d files scanned", r.FilesScanned)
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(w)
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package scan
+
+import "regexp"
+
+// Rule is a credential pattern. Group selects the submatch holding the
+// secret itself; 0 means the whole match.
+type Rule struct {
+	ID          string
+	Description string
+	Pattern     *regexp.Regexp
+	Group       int
+}
+
+// DefaultRules covers common cloud, SaaS and generic credential formats
+var DefaultRules = []Rule{
+	{
+		ID:          "aws-access-key-id",
+		Description: "AWS access key ID",
+		Pattern:     regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "aws-secret-access-key",
+		Description: "AWS secret access key",
+		Pattern:     regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "github-token",
+		Description: "GitHub token",
+		Pattern:     regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "gitlab-token",
+		Description: "GitLab personal access token",
+		Pattern:     regexp.MustCompile(`\b(glpat-[A-Za-z0-9_\-]{20})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "slack-token",
+		Description: "Slack token",
+		Pattern:     regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "stripe-secret-key",
+		Description: "Stripe secret key",
+		Pattern:     regexp.MustCompile(`\b((?:sk|rk)_live_[A-Za-z0-9]{24,})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "google-api-key",
+		Description: "Google API key",
+		Pattern:     regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "private-key",
+		Description: "Private key block",
+		Pattern:     regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY( BLOCK)?-----`),
+	},
+	{
+		ID:          "jwt",
+		Description: "JSON Web Token",
+		Pattern:     regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})\b`),
+		Group:       1,
+	},
+	{
+		ID:          "connection-string",
+		Description: "Connection string with embedded password",
+		Pattern:     regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:@/"']+:([^\s@/"']{4,})@[^\s"']+`),
+		Group:       1,
+	},
+	{
+		ID:          "generic-secret",
+		Description: "Hard-coded password, secret or token assignment",
+		Pattern:     regexp.MustCompile(`(?i)\b[a-z0-9_.-]*(?:password|passwd|secret|api_?key|access_?token|auth_?token)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`),
+		Group:       1,
+	},
+}
@@ -0,0 +1,179 @@
+// Package scan detects plaintext credentials in files and git history.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreMarker suppresses findings on the line that contains it
+const IgnoreMarker = "secretly:ignore"
+
+// DefaultMaxFileSize is the largest file scanned by default
+const DefaultMaxFileSize = 1 << 20
+
+// skipDirs are directories never descended into
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	".venv":        true,
+}
+
+// Finding is a credential detected at a location
+type Finding struct {
+	RuleID      string `json:"rule_id"`
+	Description string `json:"description"`
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Commit      string `json:"commit,omitempty"`
+	// Secret is the matched value; it is never written to reports
+	Secret string `json:"-"`
+	Masked string `json:"match"`
+	// Importable is false for matches that only identify a multi-line value
+	Importable bool `json:"importable"`
+}
+
+// Scanner matches rules against text
+type Scanner struct {
+	Rules       []Rule
+	MaxFileSize int64
+}
+
+// NewScanner returns a scanner using DefaultRules
+func NewScanner() *Scanner {
+	return &Scanner{Rules: DefaultRules, MaxFileSize: DefaultMaxFileSize}
+}
+
+// ScanReader scans r line by line, attributing findings to name
+func (s *Scanner) ScanReader(name string, r io.Reader) ([]Finding, error) {
+	var findings []Finding
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		findings = append(findings, s.scanLine(name, lineNo, scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return findings, fmt.Errorf("failed to scan %s: %w", name, err)
+	}
+	return findings, nil
+}
+
+// ScanPath scans a file or every text file below a directory. It returns the
+// findings and the number of files scanned.
+func (s *Scanner) ScanPath(root string) ([]Finding, int, error) {
+	var findings []Finding
+	scanned := 0
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if s.MaxFileSize > 0 && info.Size() > s.MaxFileSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if isBinary(data) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			rel = path
+		}
+		found, err := s.ScanReader(filepath.ToSlash(rel), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		scanned++
+		findings = append(findings, found...)
+		return nil
+	})
+	return findings, scanned, err
+}
+
+func (s *Scanner) scanLine(name string, lineNo int, line string) []Finding {
+	if strings.Contains(line, IgnoreMarker) {
+		return nil
+	}
+
+	var findings []Finding
+	for _, rule := range s.Rules {
+		for _, m := range rule.Pattern.FindAllStringSubmatch(line, -1) {
+			secret := m[0]
+			if rule.Group > 0 && rule.Group < len(m) {
+				secret = m[rule.Group]
+			}
+			if IsPlaceholder(secret) {
+				continue
+			}
+			findings = append(findings, Finding{
+				RuleID:      rule.ID,
+				Description: rule.Description,
+				File:        name,
+				Line:        lineNo,
+				Secret:      secret,
+				Masked:      Mask(secret),
+				Importable:  rule.Group > 0,
+			})
+		}
+	}
+	return findings
+}
+
+// Mask keeps the first four characters of a value for identification
+func Mask(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", 8)
+}
+
+// IsPlaceholder reports values that reference a secret rather than contain
+// one, such as "${DB_PASSWORD}" or "changeme"
+func IsPlaceholder(v string) bool {
+	lower := strings.ToLower(v)
+	for _, prefix := range []string{"${", "$(", "{{", "<", "%", "env:", "vault:", "secretly:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	for _, word := range []string{"example", "changeme", "placeholder", "xxxxxxxx", "your_", "your-"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return v == "" || strings.Trim(v, v[:1]) == ""
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
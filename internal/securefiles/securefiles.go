@@ -71,64 +71,87 @@ func SecureWriteFile(baseDir, path string, data []byte, perm os.FileMode) error
 	return os.WriteFile(cleanPath, data, perm)
 }
 
-// FixFilePerms проверяет права и владельца файлов.
-// Если autofix=true — исправляет несоответствия.
-func FixFilePerms(files []FilePermSpec, autofix bool) error {
+// Finding описывает одно несоответствие прав или владельца файла
+type Finding struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+	// Fixed — несоответствие исправлено автоматически
+	Fixed bool `json:"fixed"`
+}
+
+// CheckFilePerms проверяет права и владельца файлов и возвращает найденные
+// несоответствия. Если autofix=true — исправляет их.
+func CheckFilePerms(files []FilePermSpec, autofix bool) ([]Finding, error) {
 	currentUser, err := user.Current()
 	if err != nil {
-		return fmt.Errorf("cannot get current user: %w", err)
+		return nil, fmt.Errorf("cannot get current user: %w", err)
 	}
 	currentUID, _ := strconv.Atoi(currentUser.Uid)
 
-	hasWarnings := false
-
+	var findings []Finding
 	for _, f := range files {
 		info, err := os.Stat(f.Path)
 		if err != nil {
-			fmt.Printf("[WARN] Cannot stat file %s: %v\n", f.Path, err)
-			hasWarnings = true
+			findings = append(findings, Finding{Path: f.Path, Problem: fmt.Sprintf("Cannot stat file %s: %v", f.Path, err)})
 			continue
 		}
 
 		// Проверка прав доступа
 		actualMode := info.Mode().Perm()
 		if actualMode != f.Mode {
-			msg := fmt.Sprintf("File %s has mode %o but expected %o", f.Path, actualMode, f.Mode)
+			finding := Finding{Path: f.Path, Problem: fmt.Sprintf("File %s has mode %o but expected %o", f.Path, actualMode, f.Mode)}
 			if autofix {
 				if err := os.Chmod(f.Path, f.Mode); err != nil {
-					fmt.Printf("[ERROR] Failed to chmod %s: %v\n", f.Path, err)
-					hasWarnings = true
+					finding.Problem += fmt.Sprintf(" (chmod failed: %v)", err)
 				} else {
-					fmt.Printf("[FIXED] %s\n", msg)
+					finding.Fixed = true
 				}
-			} else {
-				fmt.Printf("[WARN] %s\n", msg)
-				hasWarnings = true
 			}
+			findings = append(findings, finding)
 		}
 
 		// Проверка владельца
 		stat, ok := info.Sys().(*syscall.Stat_t)
 		if !ok {
-			fmt.Printf("[WARN] Cannot get stat_t for %s\n", f.Path)
-			hasWarnings = true
+			findings = append(findings, Finding{Path: f.Path, Problem: fmt.Sprintf("Cannot get stat_t for %s", f.Path)})
 			continue
 		}
 
 		fileUID := int(stat.Uid)
 		if fileUID != currentUID {
-			msg := fmt.Sprintf("File %s is owned by uid %d, expected uid %d", f.Path, fileUID, currentUID)
+			finding := Finding{Path: f.Path, Problem: fmt.Sprintf("File %s is owned by uid %d, expected uid %d", f.Path, fileUID, currentUID)}
 			if autofix {
 				if err := os.Chown(f.Path, currentUID, int(stat.Gid)); err != nil {
-					fmt.Printf("[ERROR] Failed to chown %s: %v\n", f.Path, err)
-					hasWarnings = true
+					finding.Problem += fmt.Sprintf(" (chown failed: %v)", err)
 				} else {
-					fmt.Printf("[FIXED] %s\n", msg)
+					finding.Fixed = true
 				}
-			} else {
-				fmt.Printf("[WARN] %s\n", msg)
-				hasWarnings = true
 			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// FixFilePerms проверяет права и владельца файлов и печатает результат.
+// Если autofix=true — исправляет несоответствия.
+func FixFilePerms(files []FilePermSpec, autofix bool) error {
+	findings, err := CheckFilePerms(files, autofix)
+	if err != nil {
+		return err
+	}
+
+	hasWarnings := false
+	for _, f := range findings {
+		switch {
+		case f.Fixed:
+			fmt.Printf("[FIXED] %s\n", f.Problem)
+		case autofix:
+			fmt.Printf("[ERROR] %s\n", f.Problem)
+			hasWarnings = true
+		default:
+			fmt.Printf("[WARN] %s\n", f.Problem)
+			hasWarnings = true
 		}
 	}
 
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// handleSecretAccess reports who can access a secret and why
+func (s *Server) handleSecretAccess(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read access reports") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	grants, err := s.core.SecretAccess(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeAccessReport(w, r, fmt.Sprintf("secret-%d-access.csv", id), grants)
+}
+
+// handleUserAccess reports every secret a user can access and why
+func (s *Server) handleUserAccess(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read access reports") {
+		return
+	}
+	username := r.PathValue("username")
+	grants, err := s.core.UserAccess(r.Context(), username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeAccessReport(w, r, fmt.Sprintf("user-%s-access.csv", sanitizeFilename(username)), grants)
+}
+
+// writeAccessReport answers with JSON, or CSV for ?format=csv
+func writeAccessReport(w http.ResponseWriter, r *http.Request, filename string, grants []core.AccessGrant) {
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		if grants == nil {
+			grants = []core.AccessGrant{}
+		}
+		writeJSON(w, http.StatusOK, grants)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		if err := core.WriteAccessCSV(w, grants); err != nil {
+			log.Printf("⚠️  Failed to write access report: %v", err)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q: use json or csv", r.URL.Query().Get("format")))
+	}
+}
+
+type grantRequest struct {
+	Level string `json:"level"`
+}
+
+// handleListGrants lists the grants set directly on a folder or secret
+func (s *Server) handleListGrants(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read grants") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok || s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	grants, err := s.core.ListGrants(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, grants)
+}
+
+// handleSetGrant gives a user read or write access to a folder or secret
+func (s *Server) handleSetGrant(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "change grants") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Level == "" {
+		writeDecodeError(w, err, `expected {"level": "read"} or {"level": "write"}`)
+		return
+	}
+	node := s.authorizeSecret(w, r, id, true)
+	if node == nil {
+		return
+	}
+	if s.core.RequiresApproval(node) {
+		op, err := s.core.RequestGrant(r.Context(), id, r.PathValue("username"), req.Level, currentUser(r).Username)
+		writePendingOperation(w, op, err)
+		return
+	}
+	grant, err := s.core.GrantPermission(r.Context(), id, r.PathValue("username"), req.Level, currentUser(r).Username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, core.NodeGrant{
+		Username:  r.PathValue("username"),
+		Level:     grant.Level,
+		GrantedBy: grant.GrantedBy,
+		UpdatedAt: grant.UpdatedAt,
+	})
+}
+
+// handleRevokeGrant removes a user's grant on a folder or secret
+func (s *Server) handleRevokeGrant(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "change grants") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok || s.authorizeSecret(w, r, id, true) == nil {
+		return
+	}
+	if err := s.core.RevokePermission(r.Context(), id, r.PathValue("username"), currentUser(r).Username); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleExplainPermission tells the effective level of a user, by default
+// the caller, on a secret and the folder or secret it comes from
+func (s *Server) handleExplainPermission(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "explain permissions") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	username := r.URL.Query().Get("user")
+	if username == "" {
+		username = currentUser(r).Username
+	}
+	explanation, err := s.core.ExplainPermission(r.Context(), id, username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, explanation)
+}
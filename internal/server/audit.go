@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+type listAuditResponse struct {
+	Events     []core.Event `json:"events"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type listRBACLogsResponse struct {
+	Changes    []core.RBACChangeRecord `json:"changes"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// handleListAudit pages through the audit log. Filters: from and to
+// (RFC 3339, [from, to)), type (comma-separated event types), user
+// (username of the actor) and secret_id. order is desc (newest first,
+// the default) or asc, and fields selects the fields of each event.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read the audit log") {
+		return
+	}
+	q := r.URL.Query()
+	filter := &core.AuditFilter{Username: q.Get("user"), Descending: true}
+	fields, ok := parseFields(w, r, core.Event{})
+	if !ok {
+		return
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q: use RFC 3339, e.g. 2025-07-01T00:00:00Z", p.name, v))
+				return
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			filter.Types = append(filter.Types, strings.TrimSpace(t))
+		}
+	}
+	if v := q.Get("secret_id"); v != "" {
+		filter.SecretID = queryUint(v)
+		if filter.SecretID == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid secret_id %q", v))
+			return
+		}
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Descending = false
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid order %q: use asc or desc", q.Get("order")))
+		return
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	events, next, err := s.core.ListAuditEventsAfter(r.Context(), filter, q.Get("cursor"), limit)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := listAuditResponse{Events: make([]core.Event, 0, len(events)), NextCursor: next}
+	for _, ev := range events {
+		if s.core.EventVisible(r.Context(), ev) {
+			resp.Events = append(resp.Events, ev)
+		}
+	}
+	writeJSON(w, http.StatusOK, fields.apply(resp, "events"))
+}
+
+// handleListRBACLogs pages through the changes access policies made to
+// users, roles, groups, members, assignments and deny rules, newest first,
+// with their before and after snapshots. Filters: from and to (RFC 3339,
+// [from, to)), kind, name and actor.
+func (s *Server) handleListRBACLogs(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read the audit log") {
+		return
+	}
+	q := r.URL.Query()
+	filter := &core.RBACChangeFilter{Kind: q.Get("kind"), Name: q.Get("name"), Actor: q.Get("actor")}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q: use RFC 3339, e.g. 2025-07-01T00:00:00Z", p.name, v))
+				return
+			}
+			*p.dst = t
+		}
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	changes, next, err := s.core.ListRBACChanges(r.Context(), filter, q.Get("cursor"), limit)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, listRBACLogsResponse{Changes: changes, NextCursor: next})
+}
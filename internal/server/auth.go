@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	OTP      string `json:"otp,omitempty"` // TOTP or recovery code
+}
+
+type loginResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+}
+
+type oidcLoginRequest struct {
+	Token string `json:"token"`
+}
+
+type passwordResetRequest struct {
+	Login string `json:"login"`
+}
+
+type confirmPasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+
+	token, session, err := s.core.LoginWithCode(r.Context(), req.Username, req.Password, req.OTP)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: session.ExpiresAt, Scope: session.Scope})
+}
+
+// handleOIDCLogin exchanges a CI identity token (GitHub Actions, GitLab) for
+// a short-lived session scoped by the matching auth.oidc policy
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req oidcLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeDecodeError(w, err, "token is required")
+		return
+	}
+
+	token, session, err := s.core.ExchangeOIDCToken(r.Context(), req.Token)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: session.ExpiresAt, Scope: session.Scope})
+}
+
+// handleRequestPasswordReset emails a reset link to the account with the
+// given username or email address. The response is the same whether or not
+// the account exists.
+func (s *Server) handleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		writeDecodeError(w, err, "login is required")
+		return
+	}
+
+	if err := s.core.RequestPasswordReset(r.Context(), req.Login); err != nil {
+		if errors.Is(err, core.ErrPasswordResetDisabled) {
+			writeCoreError(w, err, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("⚠️  Password reset request failed: %v", err)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status": "if the account exists and has an email address, a reset link has been sent",
+	})
+}
+
+// handleConfirmPasswordReset sets a new password using a reset token
+func (s *Server) handleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req confirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		writeDecodeError(w, err, "token and password are required")
+		return
+	}
+
+	if err := s.core.ConfirmPasswordReset(r.Context(), req.Token, req.Password); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// checkoutResponse describes one check-out of a break-glass secret
+type checkoutResponse struct {
+	ID             uint       `json:"id"`
+	SecretID       uint       `json:"secret_id"`
+	Username       string     `json:"username"`
+	Reason         string     `json:"reason,omitempty"`
+	CheckedOutAt   time.Time  `json:"checked_out_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CheckedInAt    *time.Time `json:"checked_in_at,omitempty"`
+	CheckedInBy    string     `json:"checked_in_by,omitempty"`
+	RotatedVersion int        `json:"rotated_version,omitempty"`
+}
+
+func newCheckoutResponse(co *models.SecretCheckout) checkoutResponse {
+	return checkoutResponse{
+		ID:             co.ID,
+		SecretID:       co.SecretNodeID,
+		Username:       co.Username,
+		Reason:         co.Reason,
+		CheckedOutAt:   co.CheckedOutAt,
+		ExpiresAt:      co.ExpiresAt,
+		CheckedInAt:    co.CheckedInAt,
+		CheckedInBy:    co.CheckedInBy,
+		RotatedVersion: co.RotatedVersion,
+	}
+}
+
+type checkoutRequest struct {
+	// LeaseSeconds is how long the check-out lasts; 0 uses
+	// security.checkout.lease_minutes
+	LeaseSeconds int    `json:"lease_seconds"`
+	Reason       string `json:"reason"`
+}
+
+// handleCheckOutSecret gives the caller the exclusive use of a break-glass
+// secret
+func (s *Server) handleCheckOutSecret(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "check out secrets") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req checkoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid JSON body")
+			return
+		}
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	lease := time.Duration(req.LeaseSeconds) * time.Second
+	checkout, err := s.core.CheckOutSecret(r.Context(), id, currentUser(r).Username, lease, req.Reason)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newCheckoutResponse(checkout))
+}
+
+// handleCheckInSecret ends the caller's check-out, or any check-out for
+// admins
+func (s *Server) handleCheckInSecret(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "check in secrets") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	checkout, err := s.core.CheckInSecret(r.Context(), id, currentUser(r).Username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newCheckoutResponse(checkout))
+}
+
+// handleSecretCustody lists the check-outs of a secret, oldest first
+func (s *Server) handleSecretCustody(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	checkouts, err := s.core.SecretCustody(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]checkoutResponse, 0, len(checkouts))
+	for i := range checkouts {
+		resp = append(resp, newCheckoutResponse(&checkouts[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+const clientsPath = "/api/v1/me/clients"
+
+// clientResponse describes an API client. The secret is only returned when
+// it is issued.
+type clientResponse struct {
+	ClientID                string     `json:"client_id"`
+	ClientSecret            string     `json:"client_secret,omitempty"`
+	Name                    string     `json:"name"`
+	Description             string     `json:"description,omitempty"`
+	Scopes                  []string   `json:"scopes"`
+	NamespaceIDs            []uint     `json:"namespace_ids,omitempty"`
+	Active                  bool       `json:"active"`
+	CreatedAt               time.Time  `json:"created_at"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	LastUsedAt              *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newClientResponse(client *models.APIClient) clientResponse {
+	resp := clientResponse{
+		ClientID:        client.ClientID,
+		Name:            client.Name,
+		Description:     client.Description,
+		Scopes:          core.ClientScopes(client),
+		NamespaceIDs:    core.ClientNamespaceIDs(client),
+		Active:          client.IsActive,
+		CreatedAt:       client.CreatedAt,
+		SecretRotatedAt: client.SecretRotatedAt,
+		LastUsedAt:      client.LastUsedAt,
+	}
+	if exp := client.PreviousSecretExpiresAt; exp != nil && exp.After(time.Now()) {
+		resp.PreviousSecretExpiresAt = exp
+	}
+	return resp
+}
+
+type createClientRequest struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Scopes       []string `json:"scopes"`
+	NamespaceIDs []uint   `json:"namespace_ids"`
+}
+
+type rotateClientSecretRequest struct {
+	// GraceSeconds is how long the old secret keeps working; nil uses
+	// core.DefaultClientSecretGrace and 0 revokes it at once
+	GraceSeconds *int `json:"grace_seconds"`
+}
+
+type clientLoginRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// handleClientLogin exchanges API client credentials for a short-lived
+// session limited to the client's scopes
+func (s *Server) handleClientLogin(w http.ResponseWriter, r *http.Request) {
+	var req clientLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID == "" || req.ClientSecret == "" {
+		writeDecodeError(w, err, "client_id and client_secret are required")
+		return
+	}
+
+	token, session, err := s.core.ExchangeClientCredentials(r.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: session.ExpiresAt, Scope: session.Scope})
+}
+
+// handleListClients lists the caller's API clients
+func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage API clients") {
+		return
+	}
+	clients, err := s.core.ListClients(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]clientResponse, 0, len(clients))
+	for i := range clients {
+		resp = append(resp, newClientResponse(&clients[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCreateClient issues credentials for a new API client acting as the
+// caller
+func (s *Server) handleCreateClient(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage API clients") || !s.requireElevation(w, r) {
+		return
+	}
+	var req createClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	creds, err := s.core.CreateClient(r.Context(), currentUser(r).ID, &core.CreateClientRequest{
+		Name:         req.Name,
+		Description:  req.Description,
+		Scopes:       req.Scopes,
+		NamespaceIDs: req.NamespaceIDs,
+	})
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	resp := newClientResponse(creds.Client)
+	resp.ClientSecret = creds.Secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleRotateClientSecret issues a new secret for one of the caller's
+// clients; the old one works until the grace window ends
+func (s *Server) handleRotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage API clients") || !s.requireElevation(w, r) {
+		return
+	}
+	var req rotateClientSecretRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid JSON body")
+			return
+		}
+	}
+	grace := core.DefaultClientSecretGrace
+	if req.GraceSeconds != nil {
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+	}
+	creds, err := s.core.RotateClientSecret(r.Context(), currentUser(r).ID, r.PathValue("id"), grace)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	resp := newClientResponse(creds.Client)
+	resp.ClientSecret = creds.Secret
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeleteClient removes one of the caller's clients
+func (s *Server) handleDeleteClient(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage API clients") || !s.requireElevation(w, r) {
+		return
+	}
+	if err := s.core.DeleteClient(r.Context(), currentUser(r).ID, r.PathValue("id")); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+)
+
+// handleDebug reports on the running process; ?goroutines=true adds the
+// stacks of every goroutine
+func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read diagnostics") {
+		return
+	}
+	goroutines, _ := strconv.ParseBool(r.URL.Query().Get("goroutines"))
+	report, err := s.core.Diagnostics(r.Context(), goroutines)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handlePprof serves the profiles of net/http/pprof under
+// /api/v1/system/debug/pprof/ to admins. ?seconds= makes cpu and trace
+// record for that long, and turns the others into the difference over it.
+func (s *Server) handlePprof(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read profiles") {
+		return
+	}
+	name := r.PathValue("profile")
+	if r.Method == http.MethodPost && name != "symbol" {
+		writeError(w, http.StatusMethodNotAllowed, "only symbol accepts POST")
+		return
+	}
+	what := "the profile index"
+	if name != "" {
+		what = name + " profile"
+		if seconds, err := strconv.Atoi(r.URL.Query().Get("seconds")); err == nil && seconds > 0 {
+			what += fmt.Sprintf(" over %ds", seconds)
+		}
+	}
+	if err := s.core.AuthorizeDiagnostics(r.Context(), what); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	switch name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
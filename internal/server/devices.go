@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+const (
+	devicesPath     = "/api/v1/devices"
+	deviceLoginPath = "/api/v1/auth/device"
+)
+
+// deviceResponse describes an enrolled device
+type deviceResponse struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	UserID        uint       `json:"user_id"`
+	NamespaceID   uint       `json:"namespace_id,omitempty"`
+	ReadOnly      bool       `json:"read_only"`
+	Fingerprint   string     `json:"fingerprint"`
+	CertExpiresAt time.Time  `json:"certificate_expires_at"`
+	EnrolledBy    string     `json:"enrolled_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newDeviceResponse(dev *models.Device) deviceResponse {
+	return deviceResponse{
+		ID:            dev.ID,
+		Name:          dev.Name,
+		UserID:        dev.UserID,
+		NamespaceID:   dev.NamespaceID,
+		ReadOnly:      dev.ReadOnly,
+		Fingerprint:   dev.Fingerprint,
+		CertExpiresAt: dev.CertExpiresAt,
+		EnrolledBy:    dev.EnrolledBy,
+		CreatedAt:     dev.CreatedAt,
+		LastSeenAt:    dev.LastSeenAt,
+		RevokedAt:     dev.RevokedAt,
+	}
+}
+
+type createEnrollmentTokenRequest struct {
+	Name        string `json:"name"`
+	Username    string `json:"username"`
+	NamespaceID uint   `json:"namespace_id"`
+	ReadOnly    bool   `json:"read_only"`
+	TTLSeconds  int    `json:"ttl_seconds"`
+}
+
+type enrollmentTokenResponse struct {
+	Token     string    `json:"token"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type enrollDeviceRequest struct {
+	Token string `json:"token"`
+	CSR   string `json:"csr"`
+}
+
+type enrollDeviceResponse struct {
+	Device        deviceResponse `json:"device"`
+	Certificate   string         `json:"certificate"`
+	CACertificate string         `json:"ca_certificate"`
+}
+
+type deviceLoginRequest struct {
+	Certificate string `json:"certificate"`
+	Challenge   string `json:"challenge"`
+	// Signature is the base64 signature of the challenge by the device key
+	Signature string `json:"signature"`
+}
+
+// handleCreateEnrollmentToken issues a one-time token a machine enrolls
+// with, for admins
+func (s *Server) handleCreateEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "enroll devices") || !s.requireElevation(w, r) {
+		return
+	}
+	var req createEnrollmentTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	token, record, err := s.core.CreateEnrollmentToken(r.Context(), currentUser(r).Username, &core.EnrollmentTokenRequest{
+		Name:        req.Name,
+		Username:    req.Username,
+		NamespaceID: req.NamespaceID,
+		ReadOnly:    req.ReadOnly,
+		TTL:         time.Duration(req.TTLSeconds) * time.Second,
+	})
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, enrollmentTokenResponse{
+		Token:     token,
+		Name:      record.Name,
+		Username:  record.Username,
+		ExpiresAt: record.ExpiresAt,
+	})
+}
+
+// handleEnrollDevice trades an enrollment token and a CSR for a device
+// certificate
+func (s *Server) handleEnrollDevice(w http.ResponseWriter, r *http.Request) {
+	var req enrollDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.CSR == "" {
+		writeDecodeError(w, err, "token and csr are required")
+		return
+	}
+	enrollment, err := s.core.EnrollDevice(r.Context(), req.Token, []byte(req.CSR))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, enrollDeviceResponse{
+		Device:        newDeviceResponse(enrollment.Device),
+		Certificate:   string(enrollment.CertificatePEM),
+		CACertificate: string(enrollment.CACertificatePEM),
+	})
+}
+
+// handleListDevices lists enrolled devices, for admins
+func (s *Server) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage devices") {
+		return
+	}
+	devices, err := s.core.ListDevices(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]deviceResponse, 0, len(devices))
+	for i := range devices {
+		resp = append(resp, newDeviceResponse(&devices[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevokeDevice blocks a device and its sessions, for admins
+func (s *Server) handleRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage devices") || !s.requireElevation(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid device ID")
+		return
+	}
+	if err := s.core.RevokeDevice(r.Context(), currentUser(r).Username, uint(id)); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeviceChallenge returns a one-time challenge for a device login
+func (s *Server) handleDeviceChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, err := s.core.DeviceChallenge(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"challenge": challenge})
+}
+
+// handleDeviceLogin opens a session for a device that signed a challenge
+// with the key of its certificate
+func (s *Server) handleDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	var req deviceLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Certificate == "" || req.Challenge == "" || req.Signature == "" {
+		writeDecodeError(w, err, "certificate, challenge and signature are required")
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "signature must be base64")
+		return
+	}
+	token, session, err := s.core.DeviceLogin(r.Context(), []byte(req.Certificate), req.Challenge, signature)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: session.ExpiresAt, Scope: session.Scope})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/engine"
+)
+
+type revokeLeaseRequest struct {
+	LeaseID string `json:"lease_id"`
+}
+
+func (s *Server) handleListEngines(w http.ResponseWriter, r *http.Request) {
+	engines, err := s.core.ListEngines(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, engines)
+}
+
+// handleIssueEngineCredential mints a credential; a failing plugin is
+// reported as a bad gateway
+func (s *Server) handleIssueEngineCredential(w http.ResponseWriter, r *http.Request) {
+	var req engine.IssueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid request body")
+		return
+	}
+	cred, err := s.core.IssueEngineCredential(r.Context(), r.PathValue("name"), req)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, cred)
+}
+
+func (s *Server) handleRevokeEngineLease(w http.ResponseWriter, r *http.Request) {
+	var req revokeLeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LeaseID == "" {
+		writeDecodeError(w, err, "lease_id is required")
+		return
+	}
+	if err := s.core.RevokeEngineLease(r.Context(), r.PathValue("name"), req.LeaseID); err != nil {
+		writeCoreError(w, err, http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// escrowResponse describes one escrowed copy of a secret
+type escrowResponse struct {
+	ID            uint      `json:"id"`
+	SecretID      uint      `json:"secret_id"`
+	VersionNumber int       `json:"version_number"`
+	Threshold     int       `json:"threshold"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newEscrowResponse(e *models.Escrow) escrowResponse {
+	return escrowResponse{
+		ID:            e.ID,
+		SecretID:      e.SecretNodeID,
+		VersionNumber: e.VersionNumber,
+		Threshold:     e.Threshold,
+		CreatedBy:     e.CreatedBy,
+		CreatedAt:     e.CreatedAt,
+	}
+}
+
+// recoveryResponse describes a recovery request; shares and the recovered
+// value are never included
+type recoveryResponse struct {
+	ID          uint            `json:"id"`
+	EscrowID    uint            `json:"escrow_id"`
+	RequestedBy string          `json:"requested_by"`
+	Reason      string          `json:"reason"`
+	Status      string          `json:"status"`
+	Approvers   json.RawMessage `json:"approvers"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	RecoveredAt *time.Time      `json:"recovered_at,omitempty"`
+	CollectedAt *time.Time      `json:"collected_at,omitempty"`
+}
+
+func newRecoveryResponse(r *models.EscrowRecovery) recoveryResponse {
+	return recoveryResponse{
+		ID:          r.ID,
+		EscrowID:    r.EscrowID,
+		RequestedBy: r.RequestedBy,
+		Reason:      r.Reason,
+		Status:      r.Status,
+		Approvers:   json.RawMessage(r.Approvers),
+		CreatedAt:   r.CreatedAt,
+		ExpiresAt:   r.ExpiresAt,
+		RecoveredAt: r.RecoveredAt,
+		CollectedAt: r.CollectedAt,
+	}
+}
+
+type escrowLogEntryResponse struct {
+	ID         uint      `json:"id"`
+	EscrowID   uint      `json:"escrow_id"`
+	RecoveryID *uint     `json:"recovery_id,omitempty"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	Detail     string    `json:"detail"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+type escrowKeyRequest struct {
+	PublicKey []byte `json:"public_key"`
+}
+
+type createEscrowRequest struct {
+	Custodians []string `json:"custodians"`
+	Threshold  int      `json:"threshold"`
+}
+
+type recoveryRequest struct {
+	Reason string `json:"reason"`
+}
+
+type approveRecoveryRequest struct {
+	Share []byte `json:"share"`
+}
+
+// handleSetEscrowKey registers the caller's public key for escrow shares
+func (s *Server) handleSetEscrowKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "hold escrow shares") {
+		return
+	}
+	var req escrowKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.PublicKey) == 0 {
+		writeDecodeError(w, err, "public_key is required")
+		return
+	}
+	if err := s.core.SetEscrowKey(r.Context(), req.PublicKey); err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListEscrows(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	escrows, err := s.core.ListEscrows(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]escrowResponse, 0, len(escrows))
+	for i := range escrows {
+		out = append(out, newEscrowResponse(&escrows[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateEscrow escrows the current value of a secret with its
+// custodians
+func (s *Server) handleCreateEscrow(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req createEscrowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	e, err := s.core.CreateEscrow(r.Context(), id, req.Custodians, req.Threshold)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newEscrowResponse(e))
+}
+
+func (s *Server) handleListRecoveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := escrowPathID(w, r, "escrow")
+	if !ok {
+		return
+	}
+	recoveries, err := s.core.ListRecoveries(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]recoveryResponse, 0, len(recoveries))
+	for i := range recoveries {
+		out = append(out, newRecoveryResponse(&recoveries[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleRequestRecovery asks the custodians of an escrow to recover it for
+// the caller
+func (s *Server) handleRequestRecovery(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "request escrow recoveries") {
+		return
+	}
+	id, ok := escrowPathID(w, r, "escrow")
+	if !ok {
+		return
+	}
+	var req recoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Reason == "" {
+		writeDecodeError(w, err, "reason is required")
+		return
+	}
+	recovery, err := s.core.RequestRecovery(r.Context(), id, req.Reason)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newRecoveryResponse(recovery))
+}
+
+// handleRecoveryShare returns the caller's sealed share for a pending
+// recovery, to open with their private key
+func (s *Server) handleRecoveryShare(w http.ResponseWriter, r *http.Request) {
+	id, ok := escrowPathID(w, r, "recovery")
+	if !ok {
+		return
+	}
+	share, err := s.core.RecoveryShare(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]byte{"sealed_share": share.Sealed})
+}
+
+func (s *Server) handleApproveRecovery(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "approve escrow recoveries") {
+		return
+	}
+	id, ok := escrowPathID(w, r, "recovery")
+	if !ok {
+		return
+	}
+	var req approveRecoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Share) == 0 {
+		writeDecodeError(w, err, "share is required")
+		return
+	}
+	recovery, err := s.core.ApproveRecovery(r.Context(), id, req.Share)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRecoveryResponse(recovery))
+}
+
+// handleCollectRecovery hands the recovered value to the requester, once
+func (s *Server) handleCollectRecovery(w http.ResponseWriter, r *http.Request) {
+	id, ok := escrowPathID(w, r, "recovery")
+	if !ok {
+		return
+	}
+	value, err := s.core.CollectRecovery(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{"value": string(value)})
+}
+
+// handleEscrowLog lists the escrow log, of one escrow with ?escrow_id=,
+// and whether its hash chain is intact
+func (s *Server) handleEscrowLog(w http.ResponseWriter, r *http.Request) {
+	entries, report, err := s.core.EscrowLog(r.Context(), queryUint(r.URL.Query().Get("escrow_id")))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]escrowLogEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, escrowLogEntryResponse{
+			ID: e.ID, EscrowID: e.EscrowID, RecoveryID: e.RecoveryID, Action: e.Action, Actor: e.Actor,
+			Detail: e.Detail, CreatedAt: e.CreatedAt, PrevHash: e.PrevHash, Hash: e.Hash,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"verification": report, "entries": out})
+}
+
+func escrowPathID(w http.ResponseWriter, r *http.Request, kind string) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s id %q", kind, r.PathValue("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventsHeartbeat keeps idle event streams open through proxies that close
+// silent connections
+const eventsHeartbeat = 30 * time.Second
+
+// handleEvents streams audit events as server-sent events until the client
+// disconnects. ?types= (comma-separated event types) and ?secret_id=
+// narrow the stream.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "watch events") {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	q := r.URL.Query()
+	var types map[string]bool
+	if v := q.Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	var secretID uint
+	if v := q.Get("secret_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid secret_id %q", v))
+			return
+		}
+		secretID = uint(id)
+	}
+
+	events, cancel := s.core.SubscribeEvents()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Tells the client the subscription is active
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if types != nil && !types[ev.Type] {
+				continue
+			}
+			if secretID != 0 && (ev.SecretID == nil || *ev.SecretID != secretID) {
+				continue
+			}
+			if !s.core.EventVisible(r.Context(), ev) {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("⚠️  Failed to encode event %d: %v", ev.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/envfile"
+)
+
+func (s *Server) handleListExportProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := s.core.ListExportProfiles(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+func (s *Server) handleGetExportProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.core.GetExportProfile(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// handleSaveExportProfile creates or replaces the profile named in the path
+func (s *Server) handleSaveExportProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "change export profiles") {
+		return
+	}
+	var profile core.ExportProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	profile.Name = r.PathValue("name")
+	profile.CreatedBy = currentUser(r).Username
+	saved, err := s.core.SaveExportProfile(r.Context(), &profile)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleDeleteExportProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "change export profiles") {
+		return
+	}
+	if err := s.core.DeleteExportProfile(r.Context(), r.PathValue("name")); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleExportProfileEnv renders a profile as environment variables, as a
+// JSON object or with ?format=dotenv as a .env file. Every secret of the
+// profile must be readable by the session.
+func (s *Server) handleExportProfileEnv(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.core.GetExportProfile(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	vars, err := s.core.ExportProfileVars(r.Context(), profile)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "dotenv" {
+		file := &envfile.File{}
+		for _, v := range vars {
+			file.Set(v.Key, string(v.Value))
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(file.Bytes())
+		return
+	}
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		env[v.Key] = string(v.Value)
+	}
+	writeJSON(w, http.StatusOK, env)
+}
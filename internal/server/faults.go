@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/faults"
+)
+
+type faultRulesRequest struct {
+	Rules []faults.Rule `json:"rules"`
+}
+
+type faultRulesResponse struct {
+	Rules []faults.Rule `json:"rules"`
+}
+
+func (s *Server) handleGetFaults(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read fault rules") {
+		return
+	}
+	rules, err := s.core.FaultRules(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, faultRulesResponse{Rules: rules})
+}
+
+func (s *Server) handleSetFaults(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "inject faults") {
+		return
+	}
+	var req faultRulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	rules, err := s.core.SetFaultRules(r.Context(), req.Rules)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, faultRulesResponse{Rules: rules})
+}
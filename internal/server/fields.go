@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fieldSet is the sparse fieldset a client asked for with ?fields=, by
+// JSON name. A nil set keeps every field.
+type fieldSet map[string]bool
+
+// parseFields reads ?fields=id,name,tags for lists of item, a response
+// struct, and rejects names item does not have with 400
+func parseFields(w http.ResponseWriter, r *http.Request, item any) (fieldSet, bool) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, true
+	}
+	known := make(map[string]bool)
+	for _, name := range jsonFieldNames(reflect.TypeOf(item)) {
+		known[name] = true
+	}
+	fields := make(fieldSet)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			names := make([]string, 0, len(known))
+			for n := range known {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown field %q: use %s", name, strings.Join(names, ", ")))
+			return nil, false
+		}
+		fields[name] = true
+	}
+	return fields, true
+}
+
+// apply returns resp with each item of its list field, named by its JSON
+// name, cut down to the selected fields. Other fields of resp, such as
+// next_cursor, are kept.
+func (f fieldSet) apply(resp any, list string) any {
+	if f == nil {
+		return resp
+	}
+	out := fieldMap(reflect.ValueOf(resp), nil)
+	items := reflect.ValueOf(out[list])
+	if items.Kind() != reflect.Slice {
+		return out
+	}
+	sparse := make([]map[string]any, 0, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		sparse = append(sparse, fieldMap(items.Index(i), f))
+	}
+	out[list] = sparse
+	return out
+}
+
+// fieldMap returns the fields of struct v as encoding/json would encode
+// them, limited to keep unless it is nil. Embedded structs are flattened
+// and empty omitempty fields left out.
+func fieldMap(v reflect.Value, keep fieldSet) map[string]any {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	out := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitEmpty, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		if embedded(field, name) {
+			for k, val := range fieldMap(v.Field(i), keep) {
+				out[k] = val
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if (keep != nil && !keep[name]) || (omitEmpty && v.Field(i).IsZero()) {
+			continue
+		}
+		out[name] = v.Field(i).Interface()
+	}
+	return out
+}
+
+// jsonFieldNames lists the JSON names of the fields of struct type t
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		if embedded(field, name) {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func jsonName(field reflect.StructField) (name string, omitEmpty, ok bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(opts, "omitempty"), true
+}
+
+// embedded reports whether the fields of field are promoted into its
+// parent, as encoding/json does for untagged embedded structs, exported or
+// not
+func embedded(field reflect.StructField, name string) bool {
+	return field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+type createFolderRequest struct {
+	Name          string `json:"name"`
+	NamespaceID   uint   `json:"namespace_id"`
+	ZoneID        uint   `json:"zone_id"`
+	EnvironmentID uint   `json:"environment_id"`
+	ParentID      *uint  `json:"parent_id"`
+}
+
+// treeNodeResponse is a secret or folder with the nodes inside it
+type treeNodeResponse struct {
+	secretResponse
+	Children []treeNodeResponse `json:"children,omitempty"`
+}
+
+type secretTreeResponse struct {
+	Nodes []treeNodeResponse `json:"nodes"`
+}
+
+func newTreeResponse(nodes []*core.TreeNode) []treeNodeResponse {
+	resp := make([]treeNodeResponse, 0, len(nodes))
+	for _, node := range nodes {
+		resp = append(resp, treeNodeResponse{
+			secretResponse: newSecretResponse(&node.SecretNode),
+			Children:       newTreeResponse(node.Children),
+		})
+	}
+	return resp
+}
+
+func (s *Server) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req createFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	if !s.authorizeNew(w, r, &core.CreateSecretRequest{NamespaceID: req.NamespaceID, EnvironmentID: req.EnvironmentID, ParentID: req.ParentID}) {
+		return
+	}
+	folder, err := s.core.CreateFolder(r.Context(), &core.CreateFolderRequest{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		ParentID:      req.ParentID,
+		CreatedBy:     currentUser(r).Username,
+	})
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newSecretResponse(folder))
+}
+
+// handleSecretTree returns the folders and secrets of a scope as a tree,
+// below the folder given by root or from the top level. Nodes the session
+// may not see are pruned.
+func (s *Server) handleSecretTree(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := &core.ListSecretsFilter{
+		NamespaceID:   queryUint(q.Get("namespace_id")),
+		ZoneID:        queryUint(q.Get("zone_id")),
+		EnvironmentID: queryUint(q.Get("environment_id")),
+	}
+	if err := s.core.ScopeFilter(r.Context(), filter); err != nil {
+		writeCoreError(w, err, http.StatusForbidden)
+		return
+	}
+	nodes, err := s.core.SecretTree(r.Context(), filter, queryUint(q.Get("root")))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// A node and everything below it share one namespace
+	visible := nodes[:0]
+	for _, node := range nodes {
+		if s.core.NamespaceReachable(r.Context(), node.NamespaceID) {
+			visible = append(visible, node)
+		}
+	}
+	writeJSON(w, http.StatusOK, secretTreeResponse{Nodes: newTreeResponse(visible)})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/gitops"
+)
+
+// handleGitOpsStatus returns the report of the latest GitOps sync
+func (s *Server) handleGitOpsStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read the GitOps status") {
+		return
+	}
+	report, err := s.core.GitOpsStatus(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleGitOpsSync reads the manifest from the repository now instead of
+// waiting for the next sync
+func (s *Server) handleGitOpsSync(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "sync GitOps") {
+		return
+	}
+	report, err := s.core.SyncGitOps(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleGitOpsPlan compares the manifest in the body, YAML or JSON, with
+// the secrets without changing anything
+func (s *Server) handleGitOpsPlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "plan GitOps changes") {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDecodeError(w, err, "failed to read manifest")
+		return
+	}
+	manifest, err := gitops.Parse(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	report, err := s.core.PlanGitOps(r.Context(), manifest)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/redact"
+)
+
+// SetGRPCHandler serves gRPC on the HTTP port: HTTP/2 requests with a
+// gRPC content type go to h, everything else to the REST API. gRPC clients
+// need HTTP/2, so either enable TLS or list "h2c" in protocol_versions.
+func (s *Server) SetGRPCHandler(h http.Handler) {
+	s.grpcHandler = h
+}
+
+// SetGRPCReadMethods lists the full names of the handler's methods that
+// only read, e.g. "/secretly.v1.Secrets/GetSecret", which read-only mode
+// and replicas serve besides the health service
+func (s *Server) SetGRPCReadMethods(methods []string) {
+	s.grpcReadMethods = methods
+}
+
+// SetGRPCRateLimit limits gRPC calls per client address separately from
+// REST requests, e.g. to server.grpc.ratelimit
+func (s *Server) SetGRPCRateLimit(cfg config.RateLimitConfig) {
+	s.grpcLimiter = newRateLimiter(cfg)
+}
+
+// grpcPublicServices are callable without a session and in every server
+// mode, so that probes keep working
+var grpcPublicServices = []string{"/grpc.health.v1.Health/"}
+
+// grpcHealthMethods are the methods of the health service, which only read
+var grpcHealthMethods = []string{"/grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Watch"}
+
+// routeGRPC sends gRPC calls to the handler set with SetGRPCHandler. They
+// pass the same middleware as REST requests first: correlation ID, request
+// log, client info and locale, rate limit and server mode. Every method
+// but the health service then needs a session; gRPC clients send the token
+// as "authorization: Bearer" metadata, and handlers find the user in
+// core.ClientInfoFrom.
+func (s *Server) routeGRPC(rest http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.servesGRPC(r) {
+			rest.ServeHTTP(w, r)
+			return
+		}
+		if grpcPublic(r.URL.Path) {
+			s.grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		ctx, rej := s.authenticate(r)
+		if rej != nil {
+			reject(w, r, rej)
+			return
+		}
+		s.grpcHandler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// servesGRPC reports whether r goes to the gRPC handler
+func (s *Server) servesGRPC(r *http.Request) bool {
+	return s.grpcHandler != nil && isGRPC(r)
+}
+
+// isGRPC matches application/grpc and its +proto, +json etc. variants
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcPublic reports whether the gRPC method at path is public
+func grpcPublic(path string) bool {
+	for _, prefix := range grpcPublicServices {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcReadOnly reports whether the gRPC method of r only reads. Full method
+// names are matched exactly: a prefix such as "Get" would also let
+// GetOrCreate through.
+func (s *Server) grpcReadOnly(r *http.Request) bool {
+	return slices.Contains(grpcHealthMethods, r.URL.Path) || slices.Contains(s.grpcReadMethods, r.URL.Path)
+}
+
+// grpcCodes maps the statuses of rejections to gRPC status codes
+var grpcCodes = map[int]int{
+	http.StatusBadRequest:          3,  // INVALID_ARGUMENT
+	http.StatusUnauthorized:        16, // UNAUTHENTICATED
+	http.StatusForbidden:           7,  // PERMISSION_DENIED
+	http.StatusNotFound:            5,  // NOT_FOUND
+	http.StatusConflict:            10, // ABORTED
+	http.StatusGone:                9,  // FAILED_PRECONDITION
+	http.StatusPreconditionFailed:  9,  // FAILED_PRECONDITION
+	http.StatusTooManyRequests:     8,  // RESOURCE_EXHAUSTED
+	http.StatusServiceUnavailable:  14, // UNAVAILABLE
+	http.StatusInternalServerError: 13, // INTERNAL
+}
+
+// writeGRPCStatus sends a trailers-only gRPC response. The problem code,
+// which programs should match on, goes in the x-secretly-code metadata.
+func writeGRPCStatus(w http.ResponseWriter, status int, code, detail string) {
+	grpcCode, ok := grpcCodes[status]
+	if !ok {
+		grpcCode = 2 // UNKNOWN
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(grpcCode))
+	h.Set("Grpc-Message", grpcMessage(redact.String(detail)))
+	h.Set("X-Secretly-Code", code)
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcMessage percent-encodes msg as the grpc-message header requires
+func grpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// httpProtocols maps server.http.protocol_versions to the protocols the
+// server accepts. "HTTP/2" is negotiated over TLS; "h2c" accepts HTTP/2
+// with prior knowledge over cleartext, as gRPC clients without TLS use.
+// An empty list keeps the net/http defaults.
+func httpProtocols(versions []string) *http.Protocols {
+	if len(versions) == 0 {
+		return nil
+	}
+	p := new(http.Protocols)
+	for _, v := range versions {
+		switch strings.ToUpper(v) {
+		case "HTTP/1.1", "HTTP/1":
+			p.SetHTTP1(true)
+		case "HTTP/2", "H2":
+			p.SetHTTP2(true)
+		case "H2C":
+			p.SetUnencryptedHTTP2(true)
+		default:
+			log.Printf("⚠️  Ignoring unknown protocol version %q", v)
+		}
+	}
+	return p
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/startup"
+)
+
+// healthCheckTimeout bounds each dependency check
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck tests one dependency the server needs to serve requests
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// SetValidationReport keeps the start-up validation result for
+// /api/v1/system/validation
+func (s *Server) SetValidationReport(result *startup.ValidationResult) {
+	s.validation = result
+}
+
+// SetHealthChecks sets the dependencies checked by /readyz and
+// /api/v1/system/health
+func (s *Server) SetHealthChecks(checks ...HealthCheck) {
+	s.healthChecks = checks
+}
+
+type dependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status       string             `json:"status"`
+	Mode         string             `json:"mode,omitempty"`
+	Dependencies []dependencyHealth `json:"dependencies,omitempty"`
+	// AuditQueue is reported with storage.audit.async
+	AuditQueue *core.AuditQueueStats `json:"audit_queue,omitempty"`
+}
+
+// runHealthChecks runs every check and reports whether all passed
+func (s *Server) runHealthChecks(ctx context.Context) ([]dependencyHealth, bool) {
+	results := make([]dependencyHealth, 0, len(s.healthChecks))
+	healthy := true
+	for _, hc := range s.healthChecks {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		start := time.Now()
+		err := hc.Check(checkCtx)
+		cancel()
+		result := dependencyHealth{
+			Name:      hc.Name,
+			Status:    "ok",
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Status, result.Error = "failing", err.Error()
+			healthy = false
+		}
+		results = append(results, result)
+	}
+	return results, healthy
+}
+
+// handleLiveness reports that the process is up; it checks nothing else so
+// that a slow database does not get the server restarted
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// handleReadiness reports whether every dependency is available. Error
+// details are left out because the endpoint is not authenticated. The
+// server mode is reported but does not make the server unready, so that
+// administrators can still reach it to switch the mode back.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	results, healthy := s.runHealthChecks(r.Context())
+	for i := range results {
+		results[i].Error = ""
+	}
+	resp := healthResponse{Status: "ready", Mode: s.core.Mode().Mode, Dependencies: results}
+	if !healthy {
+		resp.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleSystemHealth reports every dependency with its latency and error
+func (s *Server) handleSystemHealth(w http.ResponseWriter, r *http.Request) {
+	results, healthy := s.runHealthChecks(r.Context())
+	resp := healthResponse{Status: "ok", Mode: s.core.Mode().Mode, Dependencies: results}
+	if !healthy {
+		resp.Status = "degraded"
+	}
+	if stats, ok := s.core.AuditQueueStats(); ok {
+		resp.AuditQueue = &stats
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleValidationReport returns the start-up validation result
+func (s *Server) handleValidationReport(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "read the validation report") {
+		return
+	}
+	if s.validation == nil {
+		writeError(w, http.StatusNotFound, "no start-up validation report")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.validation)
+}
+
+// handleExpirationSummary counts the secrets that expire soon, for
+// dashboards and alerting
+func (s *Server) handleExpirationSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.core.ExpirationSummary(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleStaleSecrets lists the secrets unused for ?days= days, or for the
+// stale policy's threshold, that the session may read
+func (s *Server) handleStaleSecrets(w http.ResponseWriter, r *http.Request) {
+	idle := time.Duration(queryUint(r.URL.Query().Get("days"))) * 24 * time.Hour
+	stale, err := s.core.StaleSecrets(r.Context(), idle)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if stale == nil {
+		stale = []core.StaleSecret{}
+	}
+	writeJSON(w, http.StatusOK, stale)
+}
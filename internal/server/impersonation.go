@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type impersonateRequest struct {
+	User    string `json:"user"`
+	Reason  string `json:"reason"`
+	Minutes int    `json:"minutes"`
+}
+
+type impersonateResponse struct {
+	loginResponse
+	User string `json:"user"`
+}
+
+// handleImpersonate opens a session as another user for an admin who
+// confirmed a second factor
+func (s *Server) handleImpersonate(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "impersonate users") || !s.requireElevation(w, r) {
+		return
+	}
+	var req impersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User == "" {
+		writeDecodeError(w, err, "user is required")
+		return
+	}
+	token, session, err := s.core.Impersonate(r.Context(), req.User, req.Reason, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, impersonateResponse{
+		loginResponse: loginResponse{Token: token, ExpiresAt: session.ExpiresAt, Scope: session.Scope},
+		User:          req.User,
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+)
+
+type secretKeyValueResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// handleListSecretKeys lists the key paths of a structured secret with their
+// read counts; values are not included
+func (s *Server) handleListSecretKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	keys, err := s.core.ListSecretKeys(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) handleGetSecretKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	key := r.PathValue("key")
+	value, err := s.core.GetSecretKey(r.Context(), id, key)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, secretKeyValueResponse{Key: key, Value: string(value)})
+}
+
+// secretPreviewResponse is the partial reveal of a value
+type secretPreviewResponse struct {
+	First  string `json:"first"`
+	Last   string `json:"last"`
+	Length int    `json:"length"`
+	Masked string `json:"masked"`
+}
+
+// handlePreviewSecret reveals the first and last characters of a value
+// (?first=2&last=4) without counting as a read
+func (s *Server) handlePreviewSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	first, last := queryUint(r.URL.Query().Get("first")), queryUint(r.URL.Query().Get("last"))
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	preview, err := s.core.PreviewSecretValue(r.Context(), id, int(first), int(last))
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, secretPreviewResponse{First: preview.First, Last: preview.Last, Length: preview.Length, Masked: preview.Masked()})
+}
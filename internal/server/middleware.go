@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/redact"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// enrollments are the paths open to sessions of users who must enroll a
+// second factor first, by session scope
+var enrollments = map[string]struct{ path, code, detail string }{
+	core.EnrollmentScope: {twoFactorPath, codeEnrollmentRequired,
+		"two-factor authentication is required for this account; enroll with `secretly auth 2fa enroll`"},
+	core.PasskeyEnrollmentScope: {passkeysPath, codePasskeyEnrollment,
+		"a passkey is required for this account; register one with `secretly auth passkeys add`"},
+}
+
+// rejection is a request refused by the shared middleware, sent as a
+// problem to REST clients and as a gRPC status to gRPC clients
+type rejection struct {
+	status int
+	code   string
+	detail string
+}
+
+func coreRejection(err error, fallback int) *rejection {
+	status, code := coreErrorStatus(err, fallback)
+	return &rejection{status: status, code: code, detail: err.Error()}
+}
+
+// reject answers r with rej in the form its transport expects
+func reject(w http.ResponseWriter, r *http.Request, rej *rejection) {
+	if core.ClientInfoFrom(r.Context()).Transport == core.TransportGRPC {
+		writeGRPCStatus(w, rej.status, rej.code, rej.detail)
+		return
+	}
+	writeProblem(w, rej.status, rej.code, rej.detail)
+}
+
+// requireAuth rejects requests without a valid "Authorization: Bearer" session token
+func (s *Server) requireAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, rej := s.authenticate(r)
+		if rej != nil {
+			reject(w, r, rej)
+			return
+		}
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate checks the bearer token of r, which gRPC clients send as
+// authorization metadata, and the session's network and enrollment limits.
+// The returned context acts for the user and session in the core.
+func (s *Server) authenticate(r *http.Request) (context.Context, *rejection) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, &rejection{http.StatusUnauthorized, codeUnauthorized, "missing bearer token"}
+	}
+	user, session, err := s.core.AuthenticateSession(r.Context(), strings.TrimSpace(token))
+	if err != nil {
+		return nil, coreRejection(err, http.StatusUnauthorized)
+	}
+	ctx := core.WithAuth(r.Context(), user, session)
+	if err := s.core.CheckClientNetwork(ctx); err != nil {
+		return nil, coreRejection(err, http.StatusForbidden)
+	}
+	if e, ok := enrollments[session.Scope]; ok && !strings.HasPrefix(r.URL.Path, e.path) {
+		return nil, &rejection{http.StatusForbidden, e.code, e.detail}
+	}
+	return ctx, nil
+}
+
+// withClientInfo passes the client's address, user agent, transport and
+// locale to the core, which records them on the sessions it opens and
+// authenticates and on the audit events of the request
+func (s *Server) withClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		client := core.ClientInfo{IPAddress: ip, UserAgent: r.UserAgent(), Transport: core.TransportHTTP}
+		if s.servesGRPC(r) {
+			client.Transport = core.TransportGRPC
+		}
+		if client.Locale = negotiateLocale(r.Header.Get("Accept-Language"), s.locale); client.Locale != "" {
+			w.Header().Set("Content-Language", client.Locale)
+		}
+		next.ServeHTTP(w, r.WithContext(core.WithClientInfo(r.Context(), client)))
+	})
+}
+
+// negotiateLocale picks the configured language or its fallback, whichever
+// the client prefers by its Accept-Language header, defaulting to the
+// language. Other languages are not served.
+func negotiateLocale(accept string, cfg config.LocaleConfig) string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(accept, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		t := tag{lang: strings.TrimSpace(lang), q: 1}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil {
+				t.q = q
+			}
+		}
+		if t.lang != "" && t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		for _, lang := range []string{cfg.Language, cfg.FallbackLanguage} {
+			if lang != "" && primaryLanguage(t.lang) == primaryLanguage(lang) {
+				return lang
+			}
+		}
+	}
+	return cfg.Language
+}
+
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(tag, "-")
+	return strings.ToLower(primary)
+}
+
+// currentUser returns the authenticated user set by requireAuth
+func currentUser(r *http.Request) *models.User {
+	if auth := core.AuthFrom(r.Context()); auth != nil {
+		return auth.User
+	}
+	return nil
+}
+
+// currentSession returns the session set by requireAuth
+func currentSession(r *http.Request) *models.Session {
+	if auth := core.AuthFrom(r.Context()); auth != nil {
+		return auth.Session
+	}
+	return nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		status := strconv.Itoa(rec.status)
+		if code := w.Header().Get("Grpc-Status"); code != "" {
+			status += " grpc-status=" + code
+		}
+		log.Printf("%s %s %s %s [%s]", r.Method, redact.URL(r.URL), status, time.Since(start).Round(time.Millisecond),
+			w.Header().Get(correlationHeader))
+	})
+}
+
+// correlationHeader carries the ID that ties a response and its log line
+// together, e.g. when a user reports an error
+const correlationHeader = "X-Correlation-ID"
+
+// withCorrelationID sets the correlation ID response header, keeping a
+// well-formed ID sent by the client or a proxy in front of the server
+func withCorrelationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationHeader)
+		if !validCorrelationID(id) {
+			raw := make([]byte, 8)
+			_, _ = rand.Read(raw)
+			id = hex.EncodeToString(raw)
+		}
+		w.Header().Set(correlationHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// modeHeader tells clients, e.g. the CLI banner, that the server is not in
+// normal mode
+const modeHeader = "X-Secretly-Mode"
+
+// Problem codes for requests rejected by the server mode
+const (
+	codeReadOnly    = "read_only"
+	codeMaintenance = "maintenance"
+)
+
+// modeExempt are served in every mode so that probes keep working and an
+// administrator can log in, confirm a second factor and switch the mode
+// back
+var modeExempt = map[string]bool{
+	"/healthz":                     true,
+	"/readyz":                      true,
+	"/api/v1/auth/login":           true,
+	"/api/v1/auth/oidc":            true,
+	"/api/v1/auth/client":          true,
+	deviceLoginPath:                true,
+	deviceLoginPath + "/challenge": true,
+	"/api/v1/system/health":        true,
+	"/api/v1/system/mode":          true,
+	twoFactorPath + "/elevate":     true,
+	passkeyLoginPath + "/begin":    true,
+	passkeyLoginPath + "/finish":   true,
+}
+
+// enforceMode rejects changes in read-only mode and everything in
+// maintenance mode with 503, or UNAVAILABLE for gRPC calls. gRPC methods
+// named like reads are served in read-only mode.
+func (s *Server) enforceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := s.core.Mode()
+		if mode.Mode == core.ModeNormal {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set(modeHeader, mode.Mode)
+		if modeExempt[r.URL.Path] || grpcPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if core.ClientInfoFrom(r.Context()).Transport == core.TransportGRPC {
+			readOnly = s.grpcReadOnly(r)
+		}
+		switch {
+		case mode.Mode == core.ModeReadOnly && !readOnly:
+			reject(w, r, &rejection{http.StatusServiceUnavailable, codeReadOnly, modeDetail("the server is read-only", mode)})
+		case mode.Mode == core.ModeMaintenance:
+			reject(w, r, &rejection{http.StatusServiceUnavailable, codeMaintenance, modeDetail("the server is down for maintenance", mode)})
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func modeDetail(reason string, mode core.ServerMode) string {
+	if mode.Message != "" {
+		return reason + ": " + mode.Message
+	}
+	return reason
+}
+
+type modeResponse struct {
+	Mode      string    `json:"mode"`
+	Message   string    `json:"message,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy string    `json:"changed_by"`
+}
+
+type changeModeRequest struct {
+	Mode    string `json:"mode"`
+	Message string `json:"message"`
+}
+
+func newModeResponse(mode core.ServerMode) modeResponse {
+	return modeResponse{Mode: mode.Mode, Message: mode.Message, ChangedAt: mode.ChangedAt, ChangedBy: mode.ChangedBy}
+}
+
+func (s *Server) handleGetMode(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newModeResponse(s.core.Mode()))
+}
+
+func (s *Server) handleChangeMode(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "change the server mode") || !s.requireElevation(w, r) {
+		return
+	}
+	var req changeModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	mode, err := s.core.ChangeMode(r.Context(), currentUser(r).Username, req.Mode, req.Message)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	if mode.Mode != core.ModeNormal {
+		w.Header().Set(modeHeader, mode.Mode)
+	} else {
+		w.Header().Del(modeHeader)
+	}
+	writeJSON(w, http.StatusOK, newModeResponse(mode))
+}
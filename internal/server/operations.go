@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// operationResponse describes a destructive operation waiting for, or
+// decided by, a second administrator
+type operationResponse struct {
+	ID          uint       `json:"id"`
+	Kind        string     `json:"kind"`
+	SecretID    uint       `json:"secret_id"`
+	Target      string     `json:"target,omitempty"`
+	Level       string     `json:"level,omitempty"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	DecidedBy   string     `json:"decided_by,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+type rejectOperationRequest struct {
+	Reason string `json:"reason"`
+}
+
+func newOperationResponse(op *models.PendingOperation) operationResponse {
+	return operationResponse{
+		ID:          op.ID,
+		Kind:        op.Kind,
+		SecretID:    op.SecretNodeID,
+		Target:      op.Target,
+		Level:       op.Level,
+		Status:      op.Status,
+		RequestedBy: op.RequestedBy,
+		DecidedBy:   op.DecidedBy,
+		Reason:      op.Reason,
+		CreatedAt:   op.CreatedAt,
+		ExpiresAt:   op.ExpiresAt,
+		DecidedAt:   op.DecidedAt,
+	}
+}
+
+// handleListOperations lists operations, optionally filtered by status
+func (s *Server) handleListOperations(w http.ResponseWriter, r *http.Request) {
+	ops, err := s.core.ListOperations(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]operationResponse, 0, len(ops))
+	for i := range ops {
+		resp = append(resp, newOperationResponse(&ops[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetOperation(w http.ResponseWriter, r *http.Request) {
+	id, ok := operationID(w, r)
+	if !ok {
+		return
+	}
+	op, err := s.core.GetOperation(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newOperationResponse(op))
+}
+
+// handleApproveOperation executes a pending operation. Federated sessions
+// act for pipelines rather than people and cannot approve.
+func (s *Server) handleApproveOperation(w http.ResponseWriter, r *http.Request) {
+	id, ok := operationID(w, r)
+	if !ok || !s.requirePersonalSession(w, r, "decide operations") || !s.requireElevation(w, r) {
+		return
+	}
+	op, err := s.core.ApproveOperation(r.Context(), id, currentUser(r).Username)
+	if err != nil {
+		if op != nil {
+			// Approved, but executing the operation failed
+			writeJSON(w, http.StatusInternalServerError, newOperationResponse(op))
+			return
+		}
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newOperationResponse(op))
+}
+
+func (s *Server) handleRejectOperation(w http.ResponseWriter, r *http.Request) {
+	id, ok := operationID(w, r)
+	if !ok || !s.requirePersonalSession(w, r, "decide operations") || !s.requireElevation(w, r) {
+		return
+	}
+	var req rejectOperationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid request body")
+			return
+		}
+	}
+	op, err := s.core.RejectOperation(r.Context(), id, currentUser(r).Username, req.Reason)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newOperationResponse(op))
+}
+
+// requestDeletion answers DELETE on a protected secret with 202 and the
+// pending operation
+func (s *Server) requestDeletion(w http.ResponseWriter, r *http.Request, id uint) {
+	op, err := s.core.RequestOperation(r.Context(), core.OperationDeleteSecret, id, currentUser(r).Username)
+	writePendingOperation(w, op, err)
+}
+
+// writePendingOperation answers a change to a protected secret with 202 and
+// the operation waiting for approval
+func writePendingOperation(w http.ResponseWriter, op *models.PendingOperation, err error) {
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, newOperationResponse(op))
+}
+
+// requirePersonalSession rejects federated (CI) sessions from actions
+// reserved for people
+func (s *Server) requirePersonalSession(w http.ResponseWriter, r *http.Request, action string) bool {
+	if core.IsFederated(currentSession(r)) {
+		writeError(w, http.StatusForbidden, "federated sessions cannot "+action)
+		return false
+	}
+	return true
+}
+
+func operationID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid operation id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/webauthn"
+)
+
+const (
+	// passkeysPath is the only path open to sessions that must register a
+	// passkey first
+	passkeysPath     = "/api/v1/me/passkeys"
+	passkeyLoginPath = "/api/v1/auth/webauthn/login"
+)
+
+// passkeyPage runs the browser side of CLI passkey handoffs
+//
+//go:embed passkey.html
+var passkeyPage []byte
+
+type passkeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newPasskeyResponse(cred *models.WebAuthnCredential) passkeyResponse {
+	return passkeyResponse{ID: cred.ID, Name: cred.Name, CreatedAt: cred.CreatedAt, LastUsedAt: cred.LastUsedAt}
+}
+
+type beginPasskeyLoginRequest struct {
+	Username string `json:"username"`
+}
+
+type finishPasskeyLoginRequest struct {
+	CeremonyID string                     `json:"ceremony_id"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+type finishPasskeyRegistrationRequest struct {
+	CeremonyID string                       `json:"ceremony_id"`
+	Name       string                       `json:"name"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+type finishHandoffRequest struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type registrationHandoffRequest struct {
+	Name string `json:"name"`
+}
+
+type pollHandoffRequest struct {
+	PollToken string `json:"poll_token"`
+}
+
+type pollHandoffResponse struct {
+	Status    string     `json:"status"`
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// handleBeginPasskeyLogin returns a challenge for navigator.credentials.get
+func (s *Server) handleBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req beginPasskeyLoginRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid JSON body")
+			return
+		}
+	}
+	ceremony, err := s.core.BeginPasskeyLogin(r.Context(), req.Username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, ceremony)
+}
+
+// handleFinishPasskeyLogin checks the browser's assertion and returns a
+// session token
+func (s *Server) handleFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req finishPasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CeremonyID == "" {
+		writeDecodeError(w, err, "ceremony_id and credential are required")
+		return
+	}
+	token, session, err := s.core.FinishPasskeyLogin(r.Context(), req.CeremonyID, &req.Credential)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: session.ExpiresAt})
+}
+
+// handleListPasskeys lists the caller's passkeys
+func (s *Server) handleListPasskeys(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage passkeys") {
+		return
+	}
+	creds, err := s.core.ListPasskeys(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]passkeyResponse, 0, len(creds))
+	for i := range creds {
+		resp = append(resp, newPasskeyResponse(&creds[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRemovePasskey deletes one of the caller's passkeys
+func (s *Server) handleRemovePasskey(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage passkeys") || !s.requireElevation(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid passkey id %q", r.PathValue("id")))
+		return
+	}
+	if err := s.core.RemovePasskey(r.Context(), currentUser(r).ID, uint(id)); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBeginPasskeyRegistration returns a challenge for
+// navigator.credentials.create
+func (s *Server) handleBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage passkeys") || !s.requireElevation(w, r) {
+		return
+	}
+	ceremony, err := s.core.BeginPasskeyRegistration(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, ceremony)
+}
+
+// handleFinishPasskeyRegistration stores the passkey the browser created
+func (s *Server) handleFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage passkeys") {
+		return
+	}
+	var req finishPasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CeremonyID == "" {
+		writeDecodeError(w, err, "ceremony_id and credential are required")
+		return
+	}
+	cred, err := s.core.FinishPasskeyRegistration(r.Context(), currentUser(r).ID, req.CeremonyID, req.Name, &req.Credential)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newPasskeyResponse(cred))
+}
+
+// handleStartLoginHandoff starts a CLI login completed in the browser
+func (s *Server) handleStartLoginHandoff(w http.ResponseWriter, r *http.Request) {
+	var req beginPasskeyLoginRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid JSON body")
+			return
+		}
+	}
+	handoff, err := s.core.StartLoginHandoff(r.Context(), req.Username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, handoff)
+}
+
+// handleStartRegistrationHandoff starts registering a passkey for the
+// caller in the browser
+func (s *Server) handleStartRegistrationHandoff(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage passkeys") || !s.requireElevation(w, r) {
+		return
+	}
+	var req registrationHandoffRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err, "invalid JSON body")
+			return
+		}
+	}
+	handoff, err := s.core.StartRegistrationHandoff(r.Context(), currentUser(r).ID, req.Name)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, handoff)
+}
+
+// handleBeginHandoff returns the ceremony for the browser side of a
+// handoff. The unguessable handoff ID authorizes the request.
+func (s *Server) handleBeginHandoff(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := s.core.BeginHandoff(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, ceremony)
+}
+
+// handleFinishHandoff checks the browser's response for a handoff. The
+// session of a login goes to the CLI, never to the browser.
+func (s *Server) handleFinishHandoff(w http.ResponseWriter, r *http.Request) {
+	var req finishHandoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CeremonyID == "" {
+		writeDecodeError(w, err, "ceremony_id and credential are required")
+		return
+	}
+	if err := s.core.FinishHandoff(r.Context(), r.PathValue("id"), req.CeremonyID, req.Credential); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePollHandoff answers the CLI with 202 until the browser finished a
+// handoff, then with the session token of a login
+func (s *Server) handlePollHandoff(w http.ResponseWriter, r *http.Request) {
+	var req pollHandoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PollToken == "" {
+		writeDecodeError(w, err, "poll_token is required")
+		return
+	}
+	token, session, err := s.core.PollPasskeyHandoff(r.Context(), r.PathValue("id"), req.PollToken)
+	if errors.Is(err, core.ErrHandoffPending) {
+		writeJSON(w, http.StatusAccepted, pollHandoffResponse{Status: "pending"})
+		return
+	}
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := pollHandoffResponse{Status: "complete"}
+	if session != nil {
+		resp.Token, resp.ExpiresAt = token, session.ExpiresAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handlePasskeyPage serves the page that completes CLI handoffs in the
+// browser
+func (s *Server) handlePasskeyPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	_, _ = w.Write(passkeyPage)
+}
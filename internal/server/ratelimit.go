@@ -0,0 +1,92 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// maxRateBuckets bounds the clients tracked by a rate limiter; beyond it,
+// clients whose bucket has refilled are forgotten
+const maxRateBuckets = 10000
+
+// rateLimiter is a token bucket per client address
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil when cfg does not enable rate limiting. The
+// burst is at least one second's worth of requests.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if !cfg.Enabled || cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := math.Max(float64(cfg.Burst), float64(cfg.RequestsPerSecond))
+	return &rateLimiter{rate: float64(cfg.RequestsPerSecond), burst: burst, buckets: make(map[string]*rateBucket)}
+}
+
+// allow takes a token for key, or returns how long until one is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.prune(now)
+		}
+		b = &rateBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitRate rejects clients over server.http.ratelimit with 429, and gRPC
+// clients over the limit set with SetGRPCRateLimit with
+// RESOURCE_EXHAUSTED. Health probes are not limited.
+func (s *Server) limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := core.ClientInfoFrom(r.Context())
+		limiter := s.limiter
+		if client.Transport == core.TransportGRPC {
+			limiter = s.grpcLimiter
+		}
+		if limiter == nil || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || grpcPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := limiter.allow(client.IPAddress, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			reject(w, r, &rejection{http.StatusTooManyRequests, codeRateLimited, "too many requests; retry later"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
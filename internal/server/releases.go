@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// releaseResponse describes one scheduled release of a secret
+type releaseResponse struct {
+	ID             uint       `json:"id"`
+	SecretID       uint       `json:"secret_id"`
+	Recipient      string     `json:"recipient"`
+	Status         string     `json:"status"`
+	ReleaseAt      *time.Time `json:"release_at,omitempty"`
+	InactivityDays int        `json:"inactivity_days,omitempty"`
+	Note           string     `json:"note,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// DueAt is when a pending release happens as of now
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	WarnedAt    *time.Time `json:"warned_at,omitempty"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+}
+
+func newReleaseResponse(release *models.SecretRelease, dueAt *time.Time) releaseResponse {
+	return releaseResponse{
+		ID:             release.ID,
+		SecretID:       release.SecretNodeID,
+		Recipient:      release.Recipient,
+		Status:         release.Status,
+		ReleaseAt:      release.ReleaseAt,
+		InactivityDays: release.InactivityDays,
+		Note:           release.Note,
+		CreatedBy:      release.CreatedBy,
+		CreatedAt:      release.CreatedAt,
+		DueAt:          dueAt,
+		WarnedAt:       release.WarnedAt,
+		ReleasedAt:     release.ReleasedAt,
+		CancelledAt:    release.CancelledAt,
+		CancelledBy:    release.CancelledBy,
+	}
+}
+
+func (s *Server) handleListReleases(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	releases, err := s.core.ListReleases(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]releaseResponse, 0, len(releases))
+	for i := range releases {
+		out = append(out, newReleaseResponse(&releases[i].SecretRelease, releases[i].DueAt))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleScheduleRelease schedules a secret to become readable by another
+// user at a time or after its owner's inactivity
+func (s *Server) handleScheduleRelease(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req core.ScheduleReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Recipient == "" {
+		writeDecodeError(w, err, "recipient is required")
+		return
+	}
+	release, err := s.core.ScheduleRelease(r.Context(), id, &req)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newReleaseResponse(release, nil))
+}
+
+func (s *Server) handleCancelRelease(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid release id %q", r.PathValue("id")))
+		return
+	}
+	release, err := s.core.CancelRelease(r.Context(), uint(id))
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newReleaseResponse(release, nil))
+}
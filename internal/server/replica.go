@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// primaryHeader tells clients of a read-only replica where its primary is,
+// so that they can send writes and logins there
+const primaryHeader = "X-Secretly-Primary"
+
+// codeReplica is the problem code of requests a read-only replica cannot
+// serve
+const codeReplica = "read_only_replica"
+
+// modeReplica is sent in the mode header by read-only replicas
+const modeReplica = "replica"
+
+// enforceReplica rejects everything but reads on a read-only replica with
+// 503, or UNAVAILABLE for gRPC calls, naming the primary to use instead.
+// Logins are rejected too since they create sessions; sessions made on the
+// primary reach the replica through replication.
+func (s *Server) enforceReplica(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replica, primary := s.core.Replica()
+		if !replica {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set(modeHeader, modeReplica)
+		if primary != "" {
+			w.Header().Set(primaryHeader, primary)
+		}
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || grpcPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if core.ClientInfoFrom(r.Context()).Transport == core.TransportGRPC {
+			readOnly = s.grpcReadOnly(r)
+		}
+		if !readOnly {
+			reject(w, r, &rejection{http.StatusServiceUnavailable, codeReplica, replicaDetail(primary)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func replicaDetail(primary string) string {
+	if primary == "" {
+		return "this server is a read-only replica: send writes and logins to the primary"
+	}
+	return "this server is a read-only replica: send writes and logins to the primary at " + primary
+}
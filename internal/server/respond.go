@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/engine"
+	"github.com/secretlyhq/secretly/internal/escrow"
+	"github.com/secretlyhq/secretly/internal/redact"
+)
+
+// problem is an RFC 7807 error body. Code is stable across releases and
+// meant for programs; Detail is for people and may change.
+type problem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail"`
+	Code          string `json:"code"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Error codes sent in problem responses
+const (
+	codeBadRequest         = "bad_request"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codeGone               = "gone"
+	codePreconditionFailed = "precondition_failed"
+	codeInternal           = "internal"
+	codeBadGateway         = "bad_gateway"
+	codePayloadTooLarge    = "payload_too_large"
+
+	codeInvalidCursor      = "invalid_cursor"
+	codeInvalidSort        = "invalid_sort"
+	codeInvalidCredentials = "invalid_credentials"
+	codePermissionDenied   = "permission_denied"
+	codeSecretExpired      = "secret_expired"
+	codeOIDCDisabled       = "oidc_disabled"
+	codeApprovalRequired   = "approval_required"
+	codeOperationClosed    = "operation_closed"
+	codeResetDisabled      = "password_reset_disabled"
+	codeSecondFactor       = "second_factor_required"
+	codeElevationRequired  = "elevation_required"
+	codeEnrollmentRequired = "two_factor_enrollment_required"
+	codePasskeysDisabled   = "passkeys_disabled"
+	codePasskeyRequired    = "passkey_required"
+	codePasskeyEnrollment  = "passkey_enrollment_required"
+	codeDevicesDisabled    = "devices_disabled"
+	codeImpersonationOff   = "impersonation_disabled"
+	codeEnginesDisabled    = "engines_disabled"
+	codeEngineUnsupported  = "engine_unsupported"
+	codeEscrowDisabled     = "escrow_disabled"
+	codeInvalidShare       = "invalid_share"
+	codeGitOpsDisabled     = "gitops_disabled"
+	codeDebugDisabled      = "debug_disabled"
+	codeFaultsDisabled     = "faults_disabled"
+	codeAwaitingValue      = "awaiting_value"
+	codeCheckoutRequired   = "checkout_required"
+	codeCheckedOut         = "checked_out"
+	codeNameTaken          = "name_taken"
+	codeNamingPolicy       = "naming_policy"
+	codeInvalidParent      = "invalid_parent"
+	codeInvalidProfile     = "invalid_profile"
+	codeInvalidRBAC        = "invalid_rbac"
+	codeSecretArchived     = "secret_archived"
+	codeRateLimited        = "rate_limited"
+)
+
+// statusCodes are the codes of errors without a more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeBadRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusConflict:              codeConflict,
+	http.StatusGone:                  codeGone,
+	http.StatusPreconditionFailed:    codePreconditionFailed,
+	http.StatusRequestEntityTooLarge: codePayloadTooLarge,
+	http.StatusTooManyRequests:       codeRateLimited,
+	http.StatusBadGateway:            codeBadGateway,
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("⚠️  Failed to encode response: %v", err)
+	}
+}
+
+// writeError sends a problem with the generic code for status
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeProblem(w, status, statusCode(status), message)
+}
+
+// statusCode returns the generic code for status
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return codeInternal
+}
+
+// writeProblem sends an application/problem+json body. The detail is
+// redacted because errors may wrap user input or storage details.
+func writeProblem(w http.ResponseWriter, status int, code, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	body := problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        redact.String(detail),
+		Code:          code,
+		CorrelationID: w.Header().Get(correlationHeader),
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("⚠️  Failed to encode response: %v", err)
+	}
+}
+
+// writeCoreError maps well-known core and storage errors to HTTP statuses and
+// uses fallback for everything else
+func writeCoreError(w http.ResponseWriter, err error, fallback int) {
+	status, code := coreErrorStatus(err, fallback)
+	writeProblem(w, status, code, err.Error())
+}
+
+// coreErrorStatus returns the status and code writeCoreError sends for err
+func coreErrorStatus(err error, fallback int) (status int, code string) {
+	var nameTaken *core.NameConflictError
+	switch {
+	case errors.As(err, &nameTaken):
+		status, code = http.StatusConflict, codeNameTaken
+	case errors.Is(err, core.ErrNamingPolicy):
+		status, code = http.StatusBadRequest, codeNamingPolicy
+	case errors.Is(err, core.ErrInvalidParent):
+		status, code = http.StatusBadRequest, codeInvalidParent
+	case errors.Is(err, core.ErrInvalidProfile):
+		status, code = http.StatusBadRequest, codeInvalidProfile
+	case errors.Is(err, core.ErrInvalidRBAC):
+		status, code = http.StatusBadRequest, codeInvalidRBAC
+	case errors.Is(err, core.ErrNotFound):
+		status, code = http.StatusNotFound, codeNotFound
+	case errors.Is(err, core.ErrInvalidCursor):
+		status, code = http.StatusBadRequest, codeInvalidCursor
+	case errors.Is(err, core.ErrInvalidSort):
+		status, code = http.StatusBadRequest, codeInvalidSort
+	case errors.Is(err, core.ErrInvalidCredentials):
+		status, code = http.StatusUnauthorized, codeInvalidCredentials
+	case errors.Is(err, core.ErrPermissionDenied):
+		status, code = http.StatusForbidden, codePermissionDenied
+	case errors.Is(err, core.ErrPreconditionFailed):
+		status, code = http.StatusPreconditionFailed, codePreconditionFailed
+	case errors.Is(err, core.ErrConflict):
+		status, code = http.StatusConflict, codeConflict
+	case errors.Is(err, core.ErrPlaceholder):
+		status, code = http.StatusConflict, codeAwaitingValue
+	case errors.Is(err, core.ErrArchived):
+		status, code = http.StatusGone, codeSecretArchived
+	case errors.Is(err, core.ErrExpired):
+		status, code = http.StatusGone, codeSecretExpired
+	case errors.Is(err, core.ErrOIDCDisabled):
+		status, code = http.StatusNotFound, codeOIDCDisabled
+	case errors.Is(err, core.ErrPasswordResetDisabled):
+		status, code = http.StatusNotFound, codeResetDisabled
+	case errors.Is(err, core.ErrSecondFactorRequired):
+		status, code = http.StatusUnauthorized, codeSecondFactor
+	case errors.Is(err, core.ErrElevationRequired):
+		status, code = http.StatusForbidden, codeElevationRequired
+	case errors.Is(err, core.ErrPasskeysDisabled):
+		status, code = http.StatusNotFound, codePasskeysDisabled
+	case errors.Is(err, core.ErrDevicesDisabled):
+		status, code = http.StatusNotFound, codeDevicesDisabled
+	case errors.Is(err, core.ErrImpersonationDisabled):
+		status, code = http.StatusNotFound, codeImpersonationOff
+	case errors.Is(err, core.ErrEnginesDisabled):
+		status, code = http.StatusNotFound, codeEnginesDisabled
+	case errors.Is(err, engine.ErrUnsupported), errors.Is(err, engine.ErrUnknownRole):
+		status, code = http.StatusBadRequest, codeEngineUnsupported
+	case errors.Is(err, core.ErrGitOpsDisabled):
+		status, code = http.StatusNotFound, codeGitOpsDisabled
+	case errors.Is(err, core.ErrDiagnosticsDisabled):
+		status, code = http.StatusNotFound, codeDebugDisabled
+	case errors.Is(err, core.ErrFaultsDisabled):
+		status, code = http.StatusNotFound, codeFaultsDisabled
+	case errors.Is(err, core.ErrEscrowDisabled):
+		status, code = http.StatusNotFound, codeEscrowDisabled
+	case errors.Is(err, escrow.ErrInvalidShares), errors.Is(err, escrow.ErrInvalidKey):
+		status, code = http.StatusBadRequest, codeInvalidShare
+	case errors.Is(err, core.ErrPasskeyRequired):
+		status, code = http.StatusUnauthorized, codePasskeyRequired
+	case errors.Is(err, core.ErrApprovalRequired):
+		status, code = http.StatusConflict, codeApprovalRequired
+	case errors.Is(err, core.ErrCheckoutRequired):
+		status, code = http.StatusConflict, codeCheckoutRequired
+	case errors.Is(err, core.ErrCheckedOut):
+		status, code = http.StatusConflict, codeCheckedOut
+	case errors.Is(err, core.ErrOperationClosed):
+		status, code = http.StatusConflict, codeOperationClosed
+	case errors.Is(err, core.ErrReplica):
+		status, code = http.StatusServiceUnavailable, codeReplica
+	default:
+		status, code = fallback, statusCode(fallback)
+	}
+	return status, code
+}
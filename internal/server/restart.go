@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// Environment variables through which a restarting server hands its
+// listening socket to the new process
+const (
+	listenFDEnv  = "SECRETLY_LISTEN_FD"
+	parentPIDEnv = "SECRETLY_PARENT_PID"
+)
+
+// SetReusePort makes the server bind with SO_REUSEPORT, so that another
+// instance can listen on the same port while this one drains
+func (s *Server) SetReusePort(enabled bool) {
+	s.reusePort = enabled
+}
+
+// listen returns the socket inherited from the previous process during a
+// restart, or binds a new one
+func (s *Server) listen() (net.Listener, error) {
+	if fd := os.Getenv(listenFDEnv); fd != "" {
+		// Later restarts of this process must not inherit these
+		os.Unsetenv(listenFDEnv)
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", listenFDEnv, fd)
+		}
+		f := os.NewFile(uintptr(n), "listener")
+		defer f.Close()
+		ln, err := net.FileListener(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inherit listener: %w", err)
+		}
+		log.Printf("🔁 Took over listening socket %s from the previous process", ln.Addr())
+		return ln, nil
+	}
+
+	lc := net.ListenConfig{}
+	if s.reusePort {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = setReusePort(fd)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", s.httpServer.Addr)
+}
+
+// notifyParent asks the process that started this one for a restart to
+// shut down, now that this one accepts connections on the shared socket
+func notifyParent() {
+	pid := os.Getenv(parentPIDEnv)
+	if pid == "" {
+		return
+	}
+	os.Unsetenv(parentPIDEnv)
+	n, err := strconv.Atoi(pid)
+	if err != nil || n != os.Getppid() {
+		return
+	}
+	if err := syscall.Kill(n, syscall.SIGTERM); err != nil {
+		log.Printf("⚠️  Failed to stop previous process %d: %v", n, err)
+		return
+	}
+	log.Printf("🔁 Asked previous process %d to drain and exit", n)
+}
+
+// Restart starts a new server process with the same executable and
+// arguments and hands it the listening socket. The new process runs its own
+// start-up checks and, once serving, sends this one SIGTERM so that it
+// drains in-flight requests and exits. If the new process fails to start,
+// this one keeps serving.
+func (s *Server) Restart() (int, error) {
+	s.mu.Lock()
+	ln := s.listener
+	s.mu.Unlock()
+
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return 0, fmt.Errorf("server is not listening")
+	}
+	f, err := tcp.File()
+	if err != nil {
+		return 0, fmt.Errorf("failed to duplicate listener: %w", err)
+	}
+	defer f.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find executable: %w", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ExtraFiles[0] becomes fd 3 in the new process
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Env = append(os.Environ(),
+		listenFDEnv+"=3",
+		fmt.Sprintf("%s=%d", parentPIDEnv, os.Getpid()),
+	)
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start new process: %w", err)
+	}
+	go cmd.Wait() //nolint:errcheck // reaps the child if it exits before this process
+	return cmd.Process.Pid, nil
+}
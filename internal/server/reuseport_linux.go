@@ -0,0 +1,10 @@
+package server
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT, which the syscall package does not define
+const soReusePort = 0xf
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package server
+
+import "fmt"
+
+func setReusePort(fd uintptr) error {
+	return fmt.Errorf("server.restart.reuse_port is only supported on Linux")
+}
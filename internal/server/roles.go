@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+func (s *Server) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, core.Permissions())
+}
+
+func (s *Server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.core.ListRoles(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, roles)
+}
+
+func (s *Server) handleExplainAccess(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "explain access") {
+		return
+	}
+	query := r.URL.Query()
+	secretID, err := strconv.ParseUint(query.Get("secret"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "secret must be a secret ID")
+		return
+	}
+	user, action := query.Get("user"), query.Get("action")
+	if user == "" {
+		user = currentUser(r).Username
+	}
+	if action == "" {
+		action = core.PermissionSecretsRead
+	}
+	decision, err := s.core.ExplainAccess(r.Context(), user, action, uint(secretID))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, decision)
+}
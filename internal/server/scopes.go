@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+)
+
+type scopeResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s *Server) handleListNamespaces(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := s.core.ListNamespaces(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]scopeResponse, 0, len(namespaces))
+	for _, n := range namespaces {
+		resp = append(resp, scopeResponse{ID: n.ID, Name: n.Name, Description: n.Description})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleListZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := s.core.ListZones(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]scopeResponse, 0, len(zones))
+	for _, z := range zones {
+		resp = append(resp, scopeResponse{ID: z.ID, Name: z.Name, Description: z.Description})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments, err := s.core.ListEnvironments(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]scopeResponse, 0, len(environments))
+	for _, e := range environments {
+		resp = append(resp, scopeResponse{ID: e.ID, Name: e.Name})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
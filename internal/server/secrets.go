@@ -0,0 +1,608 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// secretResponse is the API representation of secret metadata. It never
+// carries the value.
+type secretResponse struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	NamespaceID   uint       `json:"namespace_id"`
+	ZoneID        uint       `json:"zone_id"`
+	EnvironmentID uint       `json:"environment_id"`
+	ParentID      *uint      `json:"parent_id,omitempty"`
+	Folder        bool       `json:"folder,omitempty"`
+	Type          string     `json:"type,omitempty"`
+	MaxReads      *int       `json:"max_reads,omitempty"`
+	Expiration    *time.Time `json:"expiration,omitempty"`
+	Status        string     `json:"status"`
+	Tags          []string   `json:"tags,omitempty"`
+	CreatedBy     string     `json:"created_by,omitempty"`
+	Owner         string     `json:"owner,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func newSecretResponse(s *models.SecretNode) secretResponse {
+	return secretResponse{
+		ID:            s.ID,
+		Name:          s.Name,
+		NamespaceID:   s.NamespaceID,
+		ZoneID:        s.ZoneID,
+		EnvironmentID: s.EnvironmentID,
+		ParentID:      s.ParentID,
+		Folder:        core.IsFolder(s),
+		Type:          s.Type,
+		MaxReads:      s.MaxReads,
+		Expiration:    s.Expiration,
+		Status:        s.Status,
+		Tags:          core.SecretTags(s),
+		CreatedBy:     s.CreatedBy,
+		Owner:         core.SecretOwner(s),
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+	}
+}
+
+// secretStateResponse adds the current version and content hash so clients
+// such as a Terraform provider can detect out-of-band changes without
+// reading the value
+type secretStateResponse struct {
+	secretResponse
+	Version     int    `json:"version"`
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+func newSecretStateResponse(state *core.SecretState) secretStateResponse {
+	return secretStateResponse{
+		secretResponse: newSecretResponse(state.Secret),
+		Version:        state.Version,
+		ContentHash:    state.ContentHash,
+	}
+}
+
+type listSecretsResponse struct {
+	Secrets    []secretResponse `json:"secrets"`
+	Total      *int64           `json:"total,omitempty"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type createSecretRequest struct {
+	Name          string     `json:"name"`
+	NamespaceID   uint       `json:"namespace_id"`
+	ZoneID        uint       `json:"zone_id"`
+	EnvironmentID uint       `json:"environment_id"`
+	Type          string     `json:"type"`
+	Value         string     `json:"value"`
+	MaxReads      *int       `json:"max_reads"`
+	Expiration    *time.Time `json:"expiration"`
+	Tags          []string   `json:"tags"`
+	Canary        bool       `json:"canary"`
+	Decoy         string     `json:"decoy"`
+	ParentID      *uint      `json:"parent_id"`
+}
+
+// updateSecretRequest changes the value and limits of a secret; omitted
+// fields are left unchanged
+type updateSecretRequest struct {
+	Value      *string    `json:"value"`
+	MaxReads   *int       `json:"max_reads"`
+	Expiration *time.Time `json:"expiration"`
+	Canary     *bool      `json:"canary"`
+}
+
+type secretValueResponse struct {
+	Value string `json:"value"`
+}
+
+// handleListSecrets supports offset pagination (page, page_size) and, when
+// cursor or limit is given, keyset pagination with next_cursor. sort, e.g.
+// "name" or "-updated_at", orders offset pages; fields selects the fields
+// of each secret.
+func (s *Server) handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fields, ok := parseFields(w, r, secretResponse{})
+	if !ok {
+		return
+	}
+	filter := &core.ListSecretsFilter{
+		NamespaceID:   queryUint(q.Get("namespace_id")),
+		ZoneID:        queryUint(q.Get("zone_id")),
+		EnvironmentID: queryUint(q.Get("environment_id")),
+		Type:          q.Get("type"),
+		Sort:          q.Get("sort"),
+	}
+
+	var resp listSecretsResponse
+	var nodes []models.SecretNode
+	if q.Has("cursor") || q.Has("limit") {
+		if filter.Sort != "" {
+			writeError(w, http.StatusBadRequest, "sort is only supported with page and page_size")
+			return
+		}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		var err error
+		nodes, resp.NextCursor, err = s.core.ListSecretsAfter(r.Context(), filter, q.Get("cursor"), limit)
+		if err != nil {
+			writeCoreError(w, err, http.StatusInternalServerError)
+			return
+		}
+	} else {
+		filter.Page, _ = strconv.Atoi(q.Get("page"))
+		filter.PageSize, _ = strconv.Atoi(q.Get("page_size"))
+		var total int64
+		var err error
+		nodes, total, err = s.core.ListSecrets(r.Context(), filter)
+		if err != nil {
+			writeCoreError(w, err, http.StatusInternalServerError)
+			return
+		}
+		resp.Total = &total
+	}
+
+	resp.Secrets = make([]secretResponse, 0, len(nodes))
+	for i := range nodes {
+		resp.Secrets = append(resp.Secrets, newSecretResponse(&nodes[i]))
+	}
+	writeJSON(w, http.StatusOK, fields.apply(resp, "secrets"))
+}
+
+func (s *Server) handleCreateSecret(w http.ResponseWriter, r *http.Request) {
+	var req createSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+
+	create := &core.CreateSecretRequest{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		Type:          req.Type,
+		Value:         []byte(req.Value),
+		MaxReads:      req.MaxReads,
+		Expiration:    req.Expiration,
+		CreatedBy:     currentUser(r).Username,
+		Canary:        req.Canary,
+		Decoy:         req.Decoy,
+		ParentID:      req.ParentID,
+	}
+	if len(req.Tags) > 0 {
+		create.Metadata = map[string]interface{}{"tags": req.Tags}
+	}
+	if !s.authorizeNew(w, r, create) {
+		return
+	}
+
+	secret, err := s.core.CreateSecret(r.Context(), create)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	state, err := s.core.GetSecretState(r.Context(), secret.ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeSecretState(w, http.StatusCreated, state)
+}
+
+// handleGetSecret returns metadata with the current version and content hash.
+// It never reads the value, so it does not consume max-reads reads.
+func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	state, err := s.core.GetSecretState(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeSecretState(w, http.StatusOK, state)
+}
+
+// handleLookupSecret resolves a secret by name within a namespace, zone and
+// environment, e.g. for importing existing secrets into Terraform state
+func (s *Server) handleLookupSecret(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	filter := &core.ListSecretsFilter{
+		NamespaceID:   queryUint(q.Get("namespace_id")),
+		ZoneID:        queryUint(q.Get("zone_id")),
+		EnvironmentID: queryUint(q.Get("environment_id")),
+	}
+	if err := s.core.ScopeFilter(r.Context(), filter); err != nil {
+		writeCoreError(w, err, http.StatusForbidden)
+		return
+	}
+	secret, alias, err := s.core.ResolveSecretName(r.Context(), filter, name)
+	if err != nil {
+		writeCoreError(w, err, http.StatusConflict)
+		return
+	}
+	if err := s.core.AuthorizeSecret(r.Context(), secret, false); err != nil {
+		writeCoreError(w, err, http.StatusForbidden)
+		return
+	}
+	state, err := s.core.GetSecretState(r.Context(), secret.ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if alias != nil {
+		warnAlias(w, secret, alias)
+	}
+	writeSecretState(w, http.StatusOK, state)
+}
+
+type countSecretsResponse struct {
+	Count int64 `json:"count"`
+}
+
+type secretExistsResponse struct {
+	Exists bool `json:"exists"`
+}
+
+// presenceFilter reads the scope, type, name and prefix of a count or
+// existence check
+func presenceFilter(q url.Values) *core.ListSecretsFilter {
+	return &core.ListSecretsFilter{
+		NamespaceID:   queryUint(q.Get("namespace_id")),
+		ZoneID:        queryUint(q.Get("zone_id")),
+		EnvironmentID: queryUint(q.Get("environment_id")),
+		Type:          q.Get("type"),
+		Name:          q.Get("name"),
+		Prefix:        q.Get("prefix"),
+	}
+}
+
+// handleCountSecrets counts matching secrets without returning them; the
+// secrets:exists scope suffices
+func (s *Server) handleCountSecrets(w http.ResponseWriter, r *http.Request) {
+	count, err := s.core.CountSecrets(r.Context(), presenceFilter(r.URL.Query()))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, countSecretsResponse{Count: count})
+}
+
+// handleSecretExists answers 200 when the named secret exists and 404 when
+// it does not, so deployment tooling can check with HEAD
+func (s *Server) handleSecretExists(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	exists, err := s.core.SecretExists(r.Context(), presenceFilter(q), name)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		writeProblem(w, http.StatusNotFound, codeNotFound, fmt.Sprintf("no secret named %q", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, secretExistsResponse{Exists: true})
+}
+
+// warnAlias marks a response to a lookup by the former name of a moved
+// secret as deprecated, telling the client the current name
+func warnAlias(w http.ResponseWriter, secret *models.SecretNode, alias *models.SecretAlias) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Sunset", alias.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Warning", fmt.Sprintf(`299 - "secret %q was renamed to %q (id %d); the old name stops resolving at %s"`,
+		alias.Name, secret.Name, secret.ID, alias.ExpiresAt.UTC().Format(time.RFC3339)))
+}
+
+// handleUpdateSecret replaces the value and/or limits of a secret. Sending
+// the current value again does not create a new version.
+func (s *Server) handleUpdateSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req updateSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	if s.authorizeSecret(w, r, id, true) == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+
+	update := &core.UpdateSecretRequest{MaxReads: req.MaxReads, Expiration: req.Expiration, Canary: req.Canary}
+	if req.Value != nil {
+		if *req.Value == "" {
+			writeError(w, http.StatusBadRequest, "value must not be empty")
+			return
+		}
+		update.Value = []byte(*req.Value)
+	}
+	if _, err := s.core.UpdateSecret(r.Context(), id, update); err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	state, err := s.core.GetSecretState(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeSecretState(w, http.StatusOK, state)
+}
+
+func (s *Server) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	secret := s.authorizeSecret(w, r, id, true)
+	if secret == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+	if s.core.RequiresApproval(secret) {
+		s.requestDeletion(w, r, id)
+		return
+	}
+	if err := s.core.DeleteSecret(r.Context(), id); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type transferOwnerRequest struct {
+	Owner string `json:"owner"`
+}
+
+func (s *Server) handleTransferOwner(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "transfer secrets") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req transferOwnerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Owner == "" {
+		writeDecodeError(w, err, `expected {"owner": "<username>"}`)
+		return
+	}
+	secret := s.authorizeSecret(w, r, id, true)
+	if secret == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+	if secret.Owner != req.Owner && s.core.RequiresApproval(secret) {
+		op, err := s.core.RequestTransfer(r.Context(), id, req.Owner, currentUser(r).Username)
+		writePendingOperation(w, op, err)
+		return
+	}
+	secret, err := s.core.TransferOwnership(r.Context(), id, req.Owner, currentUser(r).Username)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSecretResponse(secret))
+}
+
+// handleArchiveSecret takes a secret out of use until it is unarchived
+func (s *Server) handleArchiveSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok || s.authorizeSecret(w, r, id, true) == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+	secret, err := s.core.ArchiveSecret(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSecretResponse(secret))
+}
+
+func (s *Server) handleUnarchiveSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok || s.authorizeSecret(w, r, id, true) == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+	secret, err := s.core.UnarchiveSecret(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSecretResponse(secret))
+}
+
+type moveSecretRequest struct {
+	Name          string `json:"name"`
+	NamespaceID   *uint  `json:"namespace_id"`
+	ZoneID        *uint  `json:"zone_id"`
+	EnvironmentID *uint  `json:"environment_id"`
+	ParentID      *uint  `json:"parent_id"`
+}
+
+// handleMoveSecret renames a secret and/or moves it to another namespace,
+// zone, environment or folder. The old name keeps resolving for a while.
+func (s *Server) handleMoveSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req moveSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	secret := s.authorizeSecret(w, r, id, true)
+	if secret == nil {
+		return
+	}
+	if r, ok = withPrecondition(w, r, id); !ok {
+		return
+	}
+	target := &core.CreateSecretRequest{NamespaceID: secret.NamespaceID, EnvironmentID: secret.EnvironmentID, ParentID: secret.ParentID}
+	if req.ParentID != nil {
+		target.ParentID = req.ParentID
+		if *req.ParentID == 0 {
+			target.ParentID = nil
+		}
+	}
+	if req.NamespaceID != nil {
+		target.NamespaceID = *req.NamespaceID
+	}
+	if req.EnvironmentID != nil {
+		target.EnvironmentID = *req.EnvironmentID
+	}
+	if !s.authorizeNew(w, r, target) {
+		return
+	}
+
+	moved, err := s.core.MoveSecret(r.Context(), id, &core.MoveSecretRequest{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		ParentID:      req.ParentID,
+	})
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	state, err := s.core.GetSecretState(r.Context(), moved.ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeSecretState(w, http.StatusOK, state)
+}
+
+func (s *Server) handleGetSecretValue(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.authorizeSecret(w, r, id, false) == nil {
+		return
+	}
+	value, err := s.core.GetSecretValue(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, secretValueResponse{Value: string(value)})
+}
+
+// authorizeSecret loads a secret, which the core only returns when the
+// current session may read it, and checks that it may modify it when write
+// is set. The core checks again when the operation runs; checking first
+// keeps If-Match and request validation from leaking what the session may
+// not see. On failure it writes the response and returns nil.
+func (s *Server) authorizeSecret(w http.ResponseWriter, r *http.Request, id uint, write bool) *models.SecretNode {
+	secret, err := s.core.GetSecret(r.Context(), id)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return nil
+	}
+	if write {
+		if err := s.core.AuthorizeSecret(r.Context(), secret, true); err != nil {
+			writeCoreError(w, err, http.StatusForbidden)
+			return nil
+		}
+	}
+	return secret
+}
+
+// authorizeNew checks that the current session may create a secret in the
+// requested namespace, environment and folder
+func (s *Server) authorizeNew(w http.ResponseWriter, r *http.Request, req *core.CreateSecretRequest) bool {
+	candidate := &models.SecretNode{NamespaceID: req.NamespaceID, EnvironmentID: req.EnvironmentID, ParentID: req.ParentID}
+	if err := s.core.AuthorizeSecret(r.Context(), candidate, true); err != nil {
+		writeCoreError(w, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// withPrecondition turns If-Match into a precondition on the request
+// context, so that core only changes the secret if it is still in the state
+// the client last read. Requests without If-Match always pass.
+func withPrecondition(w http.ResponseWriter, r *http.Request, id uint) (*http.Request, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return r, true
+	}
+	var version int
+	var updatedAt int64
+	if _, err := fmt.Sscanf(ifMatch, `"%d-%d"`, &version, &updatedAt); err != nil {
+		writeError(w, http.StatusPreconditionFailed, core.ErrPreconditionFailed.Error())
+		return r, false
+	}
+	p := &core.SecretPrecondition{SecretID: id, Version: version, UpdatedAt: time.Unix(0, updatedAt)}
+	return r.WithContext(core.WithPrecondition(r.Context(), p)), true
+}
+
+func writeSecretState(w http.ResponseWriter, status int, state *core.SecretState) {
+	w.Header().Set("ETag", secretETag(state))
+	writeJSON(w, status, newSecretStateResponse(state))
+}
+
+// secretETag changes whenever a new version is written or metadata changes
+func secretETag(state *core.SecretState) string {
+	return fmt.Sprintf(`"%d-%d"`, state.Version, state.Secret.UpdatedAt.UnixNano())
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid secret id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func queryUint(value string) uint {
+	n, _ := strconv.ParseUint(value, 10, 64)
+	return uint(n)
+}
+
+func logStreamError(action string, id uint, err error) {
+	log.Printf("⚠️  %s of secret %d aborted: %v", action, id, err)
+}
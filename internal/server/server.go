@@ -0,0 +1,242 @@
+// Package server exposes SecretlyCore over an HTTP JSON API.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/startup"
+)
+
+// Server is the HTTP API server
+type Server struct {
+	core       *core.SecretlyCore
+	cfg        config.ServerInstanceConfig
+	tlsConfig  *tls.Config
+	httpServer *http.Server
+	reusePort  bool
+
+	grpcHandler     http.Handler
+	grpcReadMethods []string
+
+	limiter     *rateLimiter
+	grpcLimiter *rateLimiter
+	locale      config.LocaleConfig
+	bodyLimits  bodyLimits
+
+	// closing is closed when shutdown starts, ending event streams that
+	// would otherwise hold up draining
+	closing chan struct{}
+
+	mu       sync.Mutex
+	listener net.Listener
+
+	healthChecks []HealthCheck
+	validation   *startup.ValidationResult
+}
+
+// New creates an HTTP server for the given core
+func New(c *core.SecretlyCore, cfg config.ServerInstanceConfig) *Server {
+	s := &Server{core: c, cfg: cfg, tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12}, closing: make(chan struct{})}
+	s.limiter = newRateLimiter(cfg.RateLimit)
+	s.bodyLimits = newBodyLimits(cfg.BodyLimits)
+	s.httpServer = &http.Server{
+		Addr:              listenAddr(cfg.Port),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		Protocols:         httpProtocols(cfg.ProtocolVersions),
+	}
+	s.httpServer.RegisterOnShutdown(func() { close(s.closing) })
+	return s
+}
+
+// Handler returns the root handler with all routes and middleware applied
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", s.handleLiveness)
+	mux.HandleFunc("GET /readyz", s.handleReadiness)
+	mux.Handle("GET /api/v1/system/health", s.requireAuth(s.handleSystemHealth))
+	mux.Handle("GET /api/v1/system/validation", s.requireAuth(s.handleValidationReport))
+	mux.Handle("GET /api/v1/system/expirations", s.requireAuth(s.handleExpirationSummary))
+	mux.Handle("GET /api/v1/system/stale", s.requireAuth(s.handleStaleSecrets))
+	mux.Handle("GET /api/v1/system/mode", s.requireAuth(s.handleGetMode))
+	mux.Handle("PUT /api/v1/system/mode", s.requireAuth(s.handleChangeMode))
+	mux.Handle("GET /api/v1/system/debug", s.requireAuth(s.handleDebug))
+	mux.Handle("GET /api/v1/system/debug/pprof/{$}", s.requireAuth(s.handlePprof))
+	mux.Handle("GET /api/v1/system/debug/pprof/{profile}", s.requireAuth(s.handlePprof))
+	mux.Handle("POST /api/v1/system/debug/pprof/{profile}", s.requireAuth(s.handlePprof))
+	mux.Handle("GET /api/v1/system/faults", s.requireAuth(s.handleGetFaults))
+	mux.Handle("PUT /api/v1/system/faults", s.requireAuth(s.handleSetFaults))
+	mux.HandleFunc("POST /api/v1/auth/login", s.handleLogin)
+	mux.HandleFunc("POST /api/v1/auth/oidc", s.handleOIDCLogin)
+	mux.HandleFunc("POST /api/v1/auth/client", s.handleClientLogin)
+	mux.HandleFunc("POST "+deviceLoginPath, s.handleDeviceLogin)
+	mux.HandleFunc("POST "+deviceLoginPath+"/challenge", s.handleDeviceChallenge)
+	mux.Handle("POST /api/v1/auth/impersonate", s.requireAuth(s.handleImpersonate))
+	mux.HandleFunc("POST /api/v1/auth/password-reset", s.handleRequestPasswordReset)
+	mux.HandleFunc("POST /api/v1/auth/password-reset/confirm", s.handleConfirmPasswordReset)
+	mux.HandleFunc("POST "+passkeyLoginPath+"/begin", s.handleBeginPasskeyLogin)
+	mux.HandleFunc("POST "+passkeyLoginPath+"/finish", s.handleFinishPasskeyLogin)
+	mux.HandleFunc("POST /api/v1/auth/webauthn/handoff", s.handleStartLoginHandoff)
+	mux.HandleFunc("POST /api/v1/auth/webauthn/handoff/{id}/begin", s.handleBeginHandoff)
+	mux.HandleFunc("POST /api/v1/auth/webauthn/handoff/{id}/finish", s.handleFinishHandoff)
+	mux.HandleFunc("POST /api/v1/auth/webauthn/handoff/{id}/poll", s.handlePollHandoff)
+	mux.HandleFunc("GET /passkey", s.handlePasskeyPage)
+
+	mux.Handle("GET /api/v1/namespaces", s.requireAuth(s.handleListNamespaces))
+	mux.Handle("GET /api/v1/zones", s.requireAuth(s.handleListZones))
+	mux.Handle("GET /api/v1/environments", s.requireAuth(s.handleListEnvironments))
+
+	mux.Handle("GET /api/v1/secrets", s.requireAuth(s.handleListSecrets))
+	mux.Handle("POST /api/v1/secrets", s.requireAuth(s.handleCreateSecret))
+	mux.Handle("POST /api/v1/secrets/upload", s.requireAuth(s.handleUploadSecret))
+	mux.Handle("GET /api/v1/secrets/lookup", s.requireAuth(s.handleLookupSecret))
+	mux.Handle("GET /api/v1/secrets/count", s.requireAuth(s.handleCountSecrets))
+	mux.Handle("GET /api/v1/secrets/exists", s.requireAuth(s.handleSecretExists))
+	mux.Handle("GET /api/v1/secrets/tree", s.requireAuth(s.handleSecretTree))
+	mux.Handle("POST /api/v1/folders", s.requireAuth(s.handleCreateFolder))
+	mux.Handle("GET /api/v1/secrets/{id}", s.requireAuth(s.handleGetSecret))
+	mux.Handle("PUT /api/v1/secrets/{id}", s.requireAuth(s.handleUpdateSecret))
+	mux.Handle("DELETE /api/v1/secrets/{id}", s.requireAuth(s.handleDeleteSecret))
+	mux.Handle("PUT /api/v1/secrets/{id}/owner", s.requireAuth(s.handleTransferOwner))
+	mux.Handle("POST /api/v1/secrets/{id}/move", s.requireAuth(s.handleMoveSecret))
+	mux.Handle("POST /api/v1/secrets/{id}/archive", s.requireAuth(s.handleArchiveSecret))
+	mux.Handle("POST /api/v1/secrets/{id}/unarchive", s.requireAuth(s.handleUnarchiveSecret))
+	mux.Handle("GET /api/v1/secrets/{id}/value", s.requireAuth(s.handleGetSecretValue))
+	mux.Handle("GET /api/v1/secrets/{id}/content", s.requireAuth(s.handleDownloadSecret))
+	mux.Handle("GET /api/v1/secrets/{id}/preview", s.requireAuth(s.handlePreviewSecret))
+	mux.Handle("GET /api/v1/secrets/{id}/keys", s.requireAuth(s.handleListSecretKeys))
+	mux.Handle("GET /api/v1/secrets/{id}/keys/{key}", s.requireAuth(s.handleGetSecretKey))
+	mux.Handle("GET /api/v1/secrets/{id}/access", s.requireAuth(s.handleSecretAccess))
+	mux.Handle("GET /api/v1/secrets/{id}/grants", s.requireAuth(s.handleListGrants))
+	mux.Handle("PUT /api/v1/secrets/{id}/grants/{username}", s.requireAuth(s.handleSetGrant))
+	mux.Handle("DELETE /api/v1/secrets/{id}/grants/{username}", s.requireAuth(s.handleRevokeGrant))
+	mux.Handle("GET /api/v1/secrets/{id}/permissions", s.requireAuth(s.handleExplainPermission))
+	mux.Handle("POST /api/v1/secrets/{id}/checkout", s.requireAuth(s.handleCheckOutSecret))
+	mux.Handle("POST /api/v1/secrets/{id}/checkin", s.requireAuth(s.handleCheckInSecret))
+	mux.Handle("GET /api/v1/secrets/{id}/custody", s.requireAuth(s.handleSecretCustody))
+	mux.Handle("GET /api/v1/secrets/{id}/releases", s.requireAuth(s.handleListReleases))
+	mux.Handle("POST /api/v1/secrets/{id}/releases", s.requireAuth(s.handleScheduleRelease))
+	mux.Handle("DELETE /api/v1/releases/{id}", s.requireAuth(s.handleCancelRelease))
+	mux.Handle("GET /api/v1/secrets/{id}/escrows", s.requireAuth(s.handleListEscrows))
+	mux.Handle("POST /api/v1/secrets/{id}/escrows", s.requireAuth(s.handleCreateEscrow))
+	mux.Handle("PUT /api/v1/escrow/key", s.requireAuth(s.handleSetEscrowKey))
+	mux.Handle("GET /api/v1/escrow/log", s.requireAuth(s.handleEscrowLog))
+	mux.Handle("GET /api/v1/escrows/{id}/recoveries", s.requireAuth(s.handleListRecoveries))
+	mux.Handle("POST /api/v1/escrows/{id}/recoveries", s.requireAuth(s.handleRequestRecovery))
+	mux.Handle("GET /api/v1/escrow-recoveries/{id}/share", s.requireAuth(s.handleRecoveryShare))
+	mux.Handle("POST /api/v1/escrow-recoveries/{id}/approve", s.requireAuth(s.handleApproveRecovery))
+	mux.Handle("POST /api/v1/escrow-recoveries/{id}/collect", s.requireAuth(s.handleCollectRecovery))
+	mux.Handle("GET /api/v1/gitops/status", s.requireAuth(s.handleGitOpsStatus))
+	mux.Handle("POST /api/v1/gitops/sync", s.requireAuth(s.handleGitOpsSync))
+	mux.Handle("POST /api/v1/gitops/plan", s.requireAuth(s.handleGitOpsPlan))
+	mux.Handle("GET /api/v1/users/{username}/access", s.requireAuth(s.handleUserAccess))
+	mux.Handle("GET /api/v1/permissions", s.requireAuth(s.handleListPermissions))
+	mux.Handle("GET /api/v1/roles", s.requireAuth(s.handleListRoles))
+	mux.Handle("GET /api/v1/rbac/explain", s.requireAuth(s.handleExplainAccess))
+	mux.Handle("GET /api/v1/service-accounts", s.requireAuth(s.handleListServiceAccounts))
+	mux.Handle("GET /api/v1/service-accounts/{name}/tokens", s.requireAuth(s.handleListServiceTokens))
+	mux.Handle("GET /api/v1/engines", s.requireAuth(s.handleListEngines))
+	mux.Handle("POST /api/v1/engines/{name}/issue", s.requireAuth(s.handleIssueEngineCredential))
+	mux.Handle("POST /api/v1/engines/{name}/revoke", s.requireAuth(s.handleRevokeEngineLease))
+	mux.Handle("GET /api/v1/export-profiles", s.requireAuth(s.handleListExportProfiles))
+	mux.Handle("GET /api/v1/export-profiles/{name}", s.requireAuth(s.handleGetExportProfile))
+	mux.Handle("PUT /api/v1/export-profiles/{name}", s.requireAuth(s.handleSaveExportProfile))
+	mux.Handle("DELETE /api/v1/export-profiles/{name}", s.requireAuth(s.handleDeleteExportProfile))
+	mux.Handle("GET /api/v1/export-profiles/{name}/env", s.requireAuth(s.handleExportProfileEnv))
+
+	mux.Handle("GET /api/v1/operations", s.requireAuth(s.handleListOperations))
+	mux.Handle("GET /api/v1/operations/{id}", s.requireAuth(s.handleGetOperation))
+	mux.Handle("POST /api/v1/operations/{id}/approve", s.requireAuth(s.handleApproveOperation))
+	mux.Handle("POST /api/v1/operations/{id}/reject", s.requireAuth(s.handleRejectOperation))
+
+	mux.Handle("GET /api/v1/audit", s.requireAuth(s.handleListAudit))
+	mux.Handle("GET /api/v1/audit/rbac-logs", s.requireAuth(s.handleListRBACLogs))
+	mux.Handle("GET /api/v1/events", s.requireAuth(s.handleEvents))
+
+	mux.Handle("GET /api/v1/me/sessions", s.requireAuth(s.handleListSessions))
+	mux.Handle("DELETE /api/v1/me/sessions", s.requireAuth(s.handleRevokeOtherSessions))
+	mux.Handle("DELETE /api/v1/me/sessions/{id}", s.requireAuth(s.handleRevokeSession))
+	mux.Handle("GET "+twoFactorPath, s.requireAuth(s.handleTwoFactorStatus))
+	mux.Handle("POST "+twoFactorPath, s.requireAuth(s.handleEnrollTOTP))
+	mux.Handle("DELETE "+twoFactorPath, s.requireAuth(s.handleDisableTOTP))
+	mux.Handle("POST "+twoFactorPath+"/confirm", s.requireAuth(s.handleConfirmTOTP))
+	mux.Handle("POST "+twoFactorPath+"/recovery-codes", s.requireAuth(s.handleRegenerateRecoveryCodes))
+	mux.Handle("POST "+twoFactorPath+"/elevate", s.requireAuth(s.handleElevateSession))
+	mux.Handle("GET "+passkeysPath, s.requireAuth(s.handleListPasskeys))
+	mux.Handle("DELETE "+passkeysPath+"/{id}", s.requireAuth(s.handleRemovePasskey))
+	mux.Handle("POST "+passkeysPath+"/register/begin", s.requireAuth(s.handleBeginPasskeyRegistration))
+	mux.Handle("POST "+passkeysPath+"/register/finish", s.requireAuth(s.handleFinishPasskeyRegistration))
+	mux.Handle("POST "+passkeysPath+"/handoff", s.requireAuth(s.handleStartRegistrationHandoff))
+	mux.Handle("GET "+clientsPath, s.requireAuth(s.handleListClients))
+	mux.Handle("POST "+clientsPath, s.requireAuth(s.handleCreateClient))
+	mux.Handle("DELETE "+clientsPath+"/{id}", s.requireAuth(s.handleDeleteClient))
+	mux.Handle("POST "+clientsPath+"/{id}/rotate-secret", s.requireAuth(s.handleRotateClientSecret))
+
+	mux.HandleFunc("POST "+devicesPath+"/enroll", s.handleEnrollDevice)
+	mux.Handle("POST "+devicesPath+"/enrollment-tokens", s.requireAuth(s.handleCreateEnrollmentToken))
+	mux.Handle("GET "+devicesPath, s.requireAuth(s.handleListDevices))
+	mux.Handle("DELETE "+devicesPath+"/{id}", s.requireAuth(s.handleRevokeDevice))
+
+	return withCorrelationID(logRequests(s.withClientInfo(s.limitRate(s.enforceReplica(s.enforceMode(s.limitBodies(s.routeGRPC(mux))))))))
+}
+
+// SetLocale sets the languages offered to clients by Accept-Language
+func (s *Server) SetLocale(cfg config.LocaleConfig) {
+	s.locale = cfg
+}
+
+// SetTLSConfig overrides the TLS settings used when TLS is enabled, e.g.
+// encryption.FIPSTLSConfig() in FIPS mode
+func (s *Server) SetTLSConfig(cfg *tls.Config) {
+	s.tlsConfig = cfg
+}
+
+// ListenAndServe starts serving and blocks until the server is shut down
+func (s *Server) ListenAndServe() error {
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+	log.Printf("🌐 HTTP server listening on %s", ln.Addr())
+	notifyParent()
+
+	if s.cfg.TLS.Enabled {
+		s.httpServer.TLSConfig = s.tlsConfig
+		err = s.httpServer.ServeTLS(ln, s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+	} else {
+		err = s.httpServer.Serve(ln)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+func listenAddr(port string) string {
+	if port == "" {
+		port = "8080"
+	}
+	if strings.Contains(port, ":") {
+		return port
+	}
+	return fmt.Sprintf(":%s", port)
+}
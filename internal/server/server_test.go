@@ -0,0 +1,928 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// newTestServer uses SQLite so that the real repository queries are
+// exercised; alice is an admin
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	c.SetChunking(config.ChunkingConfig{MaxChunkSizeKB: 1, MaxChunksPerSecret: 100})
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	req := &core.CreateUserRequest{Username: "alice", Password: "s3cret", Roles: []string{"admin"}}
+	if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), req); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	t.Cleanup(ts.Close)
+
+	body, _ := json.Marshal(loginRequest{Username: "alice", Password: "s3cret"})
+	resp, err := http.Post(ts.URL+"/api/v1/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Login request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var login loginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil || login.Token == "" {
+		t.Fatalf("Login failed: status %d", resp.StatusCode)
+	}
+	return ts, login.Token
+}
+
+func do(t *testing.T, method, url, token, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	return resp
+}
+
+func TestStreamingUploadAndDownload(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	value := bytes.Repeat([]byte("0123456789abcdef"), 300) // ~4.7 KB, five 1 KB chunks
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("name", "cert.pem")
+	part, _ := mw.CreateFormFile("value", "cert.pem")
+	_, _ = part.Write(value)
+	_ = mw.Close()
+
+	resp := do(t, http.MethodPost, ts.URL+"/api/v1/secrets/upload", token, mw.FormDataContentType(), &buf)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	var secret secretResponse
+	_ = json.NewDecoder(resp.Body).Decode(&secret)
+
+	download := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/"+strconv.FormatUint(uint64(secret.ID), 10)+"/content", token, "", nil)
+	defer download.Body.Close()
+	got, _ := io.ReadAll(download.Body)
+	if !bytes.Equal(got, value) {
+		t.Errorf("Downloaded %d bytes, expected %d", len(got), len(value))
+	}
+
+	raw := do(t, http.MethodPost, ts.URL+"/api/v1/secrets/upload?name=raw", token, "application/octet-stream", bytes.NewReader(value))
+	raw.Body.Close()
+	if raw.StatusCode != http.StatusCreated {
+		t.Errorf("Expected 201 for raw upload, got %d", raw.StatusCode)
+	}
+
+	del := do(t, http.MethodDelete, ts.URL+"/api/v1/secrets/"+strconv.FormatUint(uint64(secret.ID), 10), token, "", nil)
+	del.Body.Close()
+	if del.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", del.StatusCode)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	srv := New(core.NewSecretlyCore(storage.NewLocalStorage(db), nil), config.ServerInstanceConfig{})
+	failing := errors.New("keys not loaded")
+	srv.SetHealthChecks(
+		HealthCheck{Name: "database", Check: func(context.Context) error { return nil }},
+		HealthCheck{Name: "encryption", Check: func(context.Context) error { return failing }},
+	)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	live := do(t, http.MethodGet, ts.URL+"/healthz", "", "", nil)
+	live.Body.Close()
+	if live.StatusCode != http.StatusOK {
+		t.Errorf("Expected liveness to pass, got %d", live.StatusCode)
+	}
+
+	ready := do(t, http.MethodGet, ts.URL+"/readyz", "", "", nil)
+	defer ready.Body.Close()
+	var health healthResponse
+	if err := json.NewDecoder(ready.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode readiness: %v", err)
+	}
+	if ready.StatusCode != http.StatusServiceUnavailable || len(health.Dependencies) != 2 ||
+		health.Dependencies[1].Status != "failing" || health.Dependencies[1].Error != "" {
+		t.Errorf("Expected unavailable without error details, got %d %+v", ready.StatusCode, health)
+	}
+
+	detail := do(t, http.MethodGet, ts.URL+"/api/v1/system/health", "", "", nil)
+	detail.Body.Close()
+	if detail.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected system health to require authentication, got %d", detail.StatusCode)
+	}
+}
+
+func TestServerModes(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	tokens := make(map[string]string)
+	for name, roles := range map[string][]string{"admin": {"admin"}, "bob": nil} {
+		req := &core.CreateUserRequest{Username: name, Password: "s3cret", Roles: roles}
+		if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), req); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		tokens[name], _, _ = c.Login(context.Background(), name, "s3cret")
+	}
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	setMode := func(user, mode string) int {
+		body, _ := json.Marshal(changeModeRequest{Mode: mode, Message: "restoring backup"})
+		resp := do(t, http.MethodPut, ts.URL+"/api/v1/system/mode", tokens[user], "application/json", bytes.NewReader(body))
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	request := func(method string) *http.Response {
+		body, _ := json.Marshal(createSecretRequest{Name: "db", Value: "x"})
+		resp := do(t, method, ts.URL+"/api/v1/secrets", tokens["bob"], "application/json", bytes.NewReader(body))
+		resp.Body.Close()
+		return resp
+	}
+
+	if status := setMode("bob", core.ModeReadOnly); status != http.StatusForbidden {
+		t.Errorf("Expected users without system.manage to be refused, got %d", status)
+	}
+	if status := setMode("admin", core.ModeReadOnly); status != http.StatusOK {
+		t.Fatalf("Failed to switch to read-only: %d", status)
+	}
+	if resp := request(http.MethodPost); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(modeHeader) != core.ModeReadOnly {
+		t.Errorf("Expected writes to be rejected in read-only mode, got %d", resp.StatusCode)
+	}
+	if resp := request(http.MethodGet); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected reads in read-only mode, got %d", resp.StatusCode)
+	}
+
+	if status := setMode("admin", core.ModeMaintenance); status != http.StatusOK {
+		t.Fatalf("Failed to switch to maintenance: %d", status)
+	}
+	if resp := request(http.MethodGet); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected reads to be rejected in maintenance mode, got %d", resp.StatusCode)
+	}
+	ready := do(t, http.MethodGet, ts.URL+"/readyz", "", "", nil)
+	defer ready.Body.Close()
+	var health healthResponse
+	_ = json.NewDecoder(ready.Body).Decode(&health)
+	if ready.StatusCode != http.StatusOK || health.Mode != core.ModeMaintenance {
+		t.Errorf("Expected readiness to report the mode, got %d %+v", ready.StatusCode, health)
+	}
+
+	if status := setMode("admin", core.ModeNormal); status != http.StatusOK {
+		t.Fatalf("Failed to switch back to normal: %d", status)
+	}
+	if resp := request(http.MethodPost); resp.StatusCode != http.StatusCreated || resp.Header.Get(modeHeader) != "" {
+		t.Errorf("Expected writes in normal mode, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadOnlyReplica(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	primary := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	primary.SetLocalActor("test")
+	ctx := context.Background()
+	if _, err := primary.CreateUser(ctx, &core.CreateUserRequest{Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	maxReads := 1
+	secret, err := primary.CreateSecret(ctx, &core.CreateSecretRequest{Name: "db", Value: []byte("x"), CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	limited, err := primary.CreateSecret(ctx, &core.CreateSecretRequest{Name: "once", Value: []byte("y"), CreatedBy: "alice", MaxReads: &maxReads})
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	token, _, err := primary.Login(ctx, "alice", "s3cret")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	replicaDB, err := storage.OpenSQLiteReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open read-only database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(replicaDB), nil)
+	c.SetReplica(true, "https://primary.example.com")
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	value := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/"+strconv.FormatUint(uint64(secret.ID), 10)+"/value", token, "", nil)
+	value.Body.Close()
+	if value.StatusCode != http.StatusOK || value.Header.Get(modeHeader) != modeReplica {
+		t.Errorf("Expected the replica to serve reads, got %d", value.StatusCode)
+	}
+
+	body, _ := json.Marshal(createSecretRequest{Name: "new", Value: "x"})
+	write := do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewReader(body))
+	defer write.Body.Close()
+	var p problem
+	_ = json.NewDecoder(write.Body).Decode(&p)
+	if write.StatusCode != http.StatusServiceUnavailable || p.Code != codeReplica ||
+		write.Header.Get(primaryHeader) != "https://primary.example.com" || !strings.Contains(p.Detail, "https://primary.example.com") {
+		t.Errorf("Expected writes to be sent to the primary, got %d %+v", write.StatusCode, p)
+	}
+
+	login, _ := json.Marshal(loginRequest{Username: "alice", Password: "s3cret"})
+	if resp := do(t, http.MethodPost, ts.URL+"/api/v1/auth/login", "", "application/json", bytes.NewReader(login)); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected logins to be sent to the primary, got %d", resp.StatusCode)
+	}
+
+	once := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/"+strconv.FormatUint(uint64(limited.ID), 10)+"/value", token, "", nil)
+	once.Body.Close()
+	if once.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected read-limited secrets to be read on the primary, got %d", once.StatusCode)
+	}
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/secrets", "bogus", "", nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected a problem+json body, got %q", ct)
+	}
+	var p problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if p.Status != http.StatusUnauthorized || p.Code != codeInvalidCredentials || p.CorrelationID == "" ||
+		p.CorrelationID != resp.Header.Get(correlationHeader) {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/secrets", nil)
+	req.Header.Set(correlationHeader, "req-42")
+	kept, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	kept.Body.Close()
+	if id := kept.Header.Get(correlationHeader); id != "req-42" {
+		t.Errorf("Expected the client's correlation ID to be kept, got %q", id)
+	}
+}
+
+func TestMetadataNeverIncludesValues(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	const value = "hunter2-do-not-leak"
+	body, _ := json.Marshal(createSecretRequest{Name: "db", Value: value})
+	created := do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewReader(body))
+	var secret secretResponse
+	_ = json.NewDecoder(created.Body).Decode(&secret)
+	created.Body.Close()
+	id := strconv.FormatUint(uint64(secret.ID), 10)
+
+	for _, path := range []string{
+		"/api/v1/secrets",
+		"/api/v1/secrets?limit=10",
+		"/api/v1/secrets/" + id,
+		"/api/v1/secrets/lookup?name=db",
+		"/api/v1/secrets/tree",
+	} {
+		resp := do(t, http.MethodGet, ts.URL+path, token, "", nil)
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, resp.StatusCode)
+			continue
+		}
+		text := strings.ToLower(string(data))
+		for _, leak := range []string{value, base64.StdEncoding.EncodeToString([]byte(value)), "encrypted", `"value"`} {
+			if strings.Contains(text, strings.ToLower(leak)) {
+				t.Errorf("GET %s leaks %q: %s", path, leak, data)
+			}
+		}
+	}
+
+	version, _ := json.Marshal(models.SecretVersion{EncryptedValue: []byte(value)})
+	chunk, _ := json.Marshal(models.SecretChunk{EncryptedValue: []byte(value)})
+	if strings.Contains(string(version)+string(chunk), "EncryptedValue") {
+		t.Errorf("Expected models to never serialize ciphertext, got %s %s", version, chunk)
+	}
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	body, _ := json.Marshal(createSecretRequest{Name: "db", Value: "x", Tags: []string{"prod"}})
+	do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewReader(body)).Body.Close()
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/secrets?fields=id,name,tags", token, "", nil)
+	defer resp.Body.Close()
+	var page struct {
+		Secrets []map[string]any `json:"secrets"`
+		Total   int64            `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to list with fields: %d %v", resp.StatusCode, err)
+	}
+	if page.Total != 1 || len(page.Secrets) != 1 || len(page.Secrets[0]) != 3 || page.Secrets[0]["name"] != "db" || page.Secrets[0]["tags"] == nil {
+		t.Errorf("Expected only id, name and tags, got %+v", page)
+	}
+
+	unknown := do(t, http.MethodGet, ts.URL+"/api/v1/secrets?fields=id,value", token, "", nil)
+	unknown.Body.Close()
+	if unknown.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected unknown fields to be rejected, got %d", unknown.StatusCode)
+	}
+}
+
+func TestListSortingAndPermissionsInSQL(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := c.CreateUser(ctx, &core.CreateUserRequest{Username: name, Password: "s3cret"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	ids := make(map[string]uint)
+	for _, name := range []string{"app/c", "app/a", "App/x", "app/d", "app/b"} {
+		secret, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: name, Value: []byte("x"), CreatedBy: "alice"})
+		if err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+		ids[name] = secret.ID
+	}
+	if _, err := c.GrantPermission(ctx, ids["app/b"], "alice", core.AccessRead, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	if _, err := c.GrantPermission(ctx, ids["app/d"], "bob", core.AccessRead, "alice"); err != nil {
+		t.Fatalf("GrantPermission failed: %v", err)
+	}
+	token, _, _ := c.Login(ctx, "bob", "s3cret")
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	list := func(query string) (int, string, int64) {
+		resp := do(t, http.MethodGet, ts.URL+"/api/v1/secrets?"+query, token, "", nil)
+		defer resp.Body.Close()
+		var page listSecretsResponse
+		_ = json.NewDecoder(resp.Body).Decode(&page)
+		var names []string
+		for _, s := range page.Secrets {
+			names = append(names, s.Name)
+		}
+		var total int64
+		if page.Total != nil {
+			total = *page.Total
+		}
+		return resp.StatusCode, strings.Join(names, ","), total
+	}
+
+	if status, names, total := list("sort=-name&page=1&page_size=2"); status != http.StatusOK || names != "app/d,app/c" || total != 4 {
+		t.Errorf("Expected bob's first page by descending name without app/b, got %d %q %d", status, names, total)
+	}
+	if status, names, total := list("sort=name&page=2&page_size=2"); status != http.StatusOK || names != "app/c,app/d" || total != 4 {
+		t.Errorf("Expected the second page by name, got %d %q %d", status, names, total)
+	}
+	if status, _, _ := list("sort=secret"); status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown sort to be rejected, got %d", status)
+	}
+	if status, _, _ := list("sort=name&limit=2"); status != http.StatusBadRequest {
+		t.Errorf("Expected sort with cursors to be rejected, got %d", status)
+	}
+}
+
+func TestSecretStateAndPreconditions(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	body := `{"name":"db-password","value":"v1","environment_id":2}`
+	resp := do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewBufferString(body))
+	var created secretStateResponse
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Version != 1 || created.ContentHash == "" {
+		t.Fatalf("Expected created state with version 1 and hash, got %d %+v", resp.StatusCode, created)
+	}
+	etag := resp.Header.Get("ETag")
+	secretURL := ts.URL + "/api/v1/secrets/" + strconv.FormatUint(uint64(created.ID), 10)
+
+	lookup := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/lookup?name=db-password&environment_id=2", token, "", nil)
+	var found secretStateResponse
+	_ = json.NewDecoder(lookup.Body).Decode(&found)
+	lookup.Body.Close()
+	if found.ID != created.ID || lookup.Header.Get("ETag") != etag {
+		t.Errorf("Expected lookup to return the created secret, got %+v", found)
+	}
+
+	update := func(ifMatch, value string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPut, secretURL, bytes.NewBufferString(`{"value":"`+value+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		return resp
+	}
+
+	resp = update(etag, "v2")
+	var updated secretStateResponse
+	_ = json.NewDecoder(resp.Body).Decode(&updated)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || updated.Version != 2 || updated.ContentHash == created.ContentHash {
+		t.Fatalf("Expected version 2 with new hash, got %d %+v", resp.StatusCode, updated)
+	}
+
+	resp = update(etag, "v3")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale ETag, got %d", resp.StatusCode)
+	}
+
+	missing := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/lookup?name=nope", token, "", nil)
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown name, got %d", missing.StatusCode)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	create := func(name string) uint {
+		body, _ := json.Marshal(createSecretRequest{Name: name, Value: "x"})
+		resp := do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewReader(body))
+		defer resp.Body.Close()
+		var created secretStateResponse
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		return created.ID
+	}
+	first := create("db")
+
+	stream := do(t, http.MethodGet, ts.URL+"/api/v1/events?types=secret_created", token, "", nil)
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); stream.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", stream.StatusCode, ct)
+	}
+	lines := bufio.NewScanner(stream.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("Expected the connected comment, got %q", lines.Text())
+	}
+
+	// The read is filtered out by ?types, so the next event is the creation
+	do(t, http.MethodGet, ts.URL+"/api/v1/secrets/"+strconv.FormatUint(uint64(first), 10)+"/value", token, "", nil).Body.Close()
+	second := create("api-key")
+
+	var event, data string
+	for lines.Scan() && (event == "" || data == "") {
+		line := lines.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	var ev core.Event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil || event != core.EventSecretCreated || ev.SecretID == nil || *ev.SecretID != second {
+		t.Fatalf("Expected a secret_created event for secret %d, got %q %s", second, event, data)
+	}
+}
+
+func TestAuditListing(t *testing.T) {
+	ts, token := newTestServer(t)
+
+	for _, name := range []string{"a", "b", "c"} {
+		body, _ := json.Marshal(createSecretRequest{Name: name, Value: "x"})
+		do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", bytes.NewReader(body)).Body.Close()
+	}
+
+	list := func(query string) listAuditResponse {
+		resp := do(t, http.MethodGet, ts.URL+"/api/v1/audit?"+query, token, "", nil)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /api/v1/audit?%s: status %d", query, resp.StatusCode)
+		}
+		var page listAuditResponse
+		_ = json.NewDecoder(resp.Body).Decode(&page)
+		return page
+	}
+
+	page := list("type=secret_created&order=asc&limit=2")
+	if len(page.Events) != 2 || page.NextCursor == "" || !strings.Contains(page.Events[0].Description, `"a"`) {
+		t.Fatalf("Expected the first two creations and a cursor, got %+v", page)
+	}
+	page = list("type=secret_created&order=asc&limit=2&cursor=" + page.NextCursor)
+	if len(page.Events) != 1 || page.NextCursor != "" || !strings.Contains(page.Events[0].Description, `"c"`) {
+		t.Fatalf("Expected the last creation, got %+v", page)
+	}
+
+	// Newest first by default; the login and creations are attributed to alice
+	page = list("user=alice")
+	if len(page.Events) != 4 || page.Events[0].Type != core.EventSecretCreated || page.Events[3].Type != core.EventUserLogin {
+		t.Fatalf("Expected alice's creations and login, got %+v", page)
+	}
+	if page = list("user=nobody"); len(page.Events) != 0 {
+		t.Errorf("Expected no events for an unknown user, got %+v", page)
+	}
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/audit?from=yesterday", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid time, got %d", resp.StatusCode)
+	}
+}
+
+func TestRolesEnforced(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	tokens := make(map[string]string)
+	for name, role := range map[string]string{"rita": "read-only", "audrey": "auditor"} {
+		req := &core.CreateUserRequest{Username: name, Password: "s3cret", Roles: []string{role}}
+		if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), req); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		tokens[name], _, _ = c.Login(context.Background(), name, "s3cret")
+	}
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		user, method, path string
+		want               int
+	}{
+		{"rita", http.MethodGet, "/api/v1/audit", http.StatusForbidden},
+		{"rita", http.MethodGet, "/api/v1/users/audrey/access", http.StatusForbidden},
+		{"rita", http.MethodPut, "/api/v1/export-profiles/app", http.StatusForbidden},
+		{"audrey", http.MethodGet, "/api/v1/audit", http.StatusOK},
+		{"audrey", http.MethodGet, "/api/v1/users/rita/access", http.StatusOK},
+	} {
+		body, _ := json.Marshal(core.ExportProfile{Prefix: "app/"})
+		resp := do(t, tc.method, ts.URL+tc.path, tokens[tc.user], "application/json", bytes.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s as %s: expected %d, got %d", tc.method, tc.path, tc.user, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestGRPCSharesPort(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), &core.CreateUserRequest{Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	token, _, err := c.Login(context.Background(), "alice", "s3cret")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	srv := New(c, config.ServerInstanceConfig{ProtocolVersions: []string{"HTTP/1.1", "h2c"}})
+	srv.SetGRPCHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Caller", core.ClientInfoFrom(r.Context()).Username+"/"+core.ClientInfoFrom(r.Context()).Transport)
+	}))
+
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.Config.Protocols = srv.httpServer.Protocols
+	ts.Start()
+	defer ts.Close()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	call := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/secretly.v1.Secrets/Get", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("Content-Type", "application/grpc")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("gRPC request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := call(""); resp.Header.Get("Grpc-Status") != "16" || resp.Header.Get("X-Secretly-Code") != codeUnauthorized {
+		t.Fatalf("Expected UNAUTHENTICATED without a session, got headers %v", resp.Header)
+	}
+	resp := call(token)
+	if resp.ProtoMajor != 2 || resp.Header.Get("Grpc-Status") != "0" {
+		t.Fatalf("gRPC request was not routed to the gRPC handler: %s, headers %v", resp.Proto, resp.Header)
+	}
+	if caller := resp.Header.Get("Caller"); caller != "alice/grpc" {
+		t.Errorf("Expected the handler to see the session user over grpc, got %q", caller)
+	}
+
+	resp, err = client.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("REST request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "" {
+		t.Fatalf("REST request over h2c: status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestGRPCReadOnlyMatchesExactMethods(t *testing.T) {
+	srv := &Server{}
+	srv.SetGRPCReadMethods([]string{"/secretly.v1.Secrets/GetSecret", "/secretly.v1.Secrets/ListSecrets"})
+	for method, want := range map[string]bool{
+		"/grpc.health.v1.Health/Check":            true,
+		"/secretly.v1.Secrets/GetSecret":          true,
+		"/secretly.v1.Secrets/ListSecrets":        true,
+		"/secretly.v1.Secrets/GetOrCreateSecret":  false,
+		"/secretly.v1.Secrets/CheckOutSecret":     false,
+		"/secretly.v1.Secrets/GetSecretAndDelete": false,
+		"/secretly.v1.Other/GetSecret":            false,
+	} {
+		r := httptest.NewRequest(http.MethodPost, method, nil)
+		if got := srv.grpcReadOnly(r); got != want {
+			t.Errorf("grpcReadOnly(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	srv := New(core.NewSecretlyCore(storage.NewLocalStorage(db), nil),
+		config.ServerInstanceConfig{RateLimit: config.RateLimitConfig{Enabled: true, RequestsPerSecond: 1, Burst: 1}})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/secrets", "", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected the first request to pass the limit, got %d", resp.StatusCode)
+	}
+	resp = do(t, http.MethodGet, ts.URL+"/api/v1/secrets", "", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d", resp.StatusCode)
+	}
+	resp = do(t, http.MethodGet, ts.URL+"/healthz", "", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected health probes not to be limited, got %d", resp.StatusCode)
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), &core.CreateUserRequest{Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	token, _, _ := c.Login(context.Background(), "alice", "s3cret")
+	srv := New(c, config.ServerInstanceConfig{BodyLimits: config.BodyLimitsConfig{SecretsKB: 2, SharesKB: 1}})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	create := func(size int, body func([]byte) io.Reader) int {
+		data, _ := json.Marshal(createSecretRequest{Name: "db", Value: strings.Repeat("x", size)})
+		resp := do(t, http.MethodPost, ts.URL+"/api/v1/secrets", token, "application/json", body(data))
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	sized := func(data []byte) io.Reader { return bytes.NewReader(data) }
+	chunked := func(data []byte) io.Reader { return io.MultiReader(bytes.NewReader(data)) }
+
+	if status := create(3000, sized); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a declared length over the limit, got %d", status)
+	}
+	if status := create(3000, chunked); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a chunked body over the limit, got %d", status)
+	}
+	if status := create(1500, sized); status != http.StatusCreated {
+		t.Errorf("Expected bodies within the secrets limit, got %d", status)
+	}
+
+	grant := strings.NewReader(`{"level": "read", "note": "` + strings.Repeat("x", 1500) + `"}`)
+	resp := do(t, http.MethodPut, ts.URL+"/api/v1/secrets/1/grants/bob", token, "application/json", grant)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the shares limit for grants, got %d", resp.StatusCode)
+	}
+}
+
+func TestPresenceChecks(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	c.SetLocalActor("test")
+	ctx := context.Background()
+	alice, err := c.CreateUser(ctx, &core.CreateUserRequest{Username: "alice", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for _, name := range []string{"app/db-password", "app/api-key", "other/token"} {
+		if _, err := c.CreateSecret(ctx, &core.CreateSecretRequest{Name: name, Value: []byte("x"), NamespaceID: 1, ZoneID: 1, EnvironmentID: 1, CreatedBy: "alice"}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+	creds, err := c.CreateClient(ctx, alice.ID, &core.CreateClientRequest{Name: "deploy", Scopes: []string{core.ClientScopeExists}})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	token, _, err := c.ExchangeClientCredentials(ctx, creds.Client.ClientID, creds.Secret)
+	if err != nil {
+		t.Fatalf("ExchangeClientCredentials failed: %v", err)
+	}
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/secrets/count?namespace_id=1&prefix=app/", token, "", nil)
+	var counted countSecretsResponse
+	_ = json.NewDecoder(resp.Body).Decode(&counted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || counted.Count != 2 {
+		t.Errorf("Expected two secrets under app/, got %d %+v", resp.StatusCode, counted)
+	}
+	for name, want := range map[string]int{"app/db-password": http.StatusOK, "app/missing": http.StatusNotFound} {
+		resp := do(t, http.MethodHead, ts.URL+"/api/v1/secrets/exists?name="+name, token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("HEAD exists %s: expected %d, got %d", name, want, resp.StatusCode)
+		}
+	}
+	resp = do(t, http.MethodGet, ts.URL+"/api/v1/secrets", token, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the exists scope not to list secrets, got %d", resp.StatusCode)
+	}
+}
+
+func TestGitOpsRefusesFederatedSessions(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	req := &core.CreateUserRequest{Username: "admin", Password: "s3cret", Roles: []string{"admin"}}
+	if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), req); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	token, session, _ := c.Login(context.Background(), "admin", "s3cret")
+	db.Model(&models.Session{}).Where("id = ?", session.ID).Update("scope", "deploy")
+	for _, call := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/gitops/status"},
+		{http.MethodPost, "/api/v1/gitops/sync"},
+		{http.MethodPost, "/api/v1/gitops/plan"},
+	} {
+		resp := do(t, call.method, ts.URL+call.path, token, "application/yaml", strings.NewReader("secrets: []\n"))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected a federated session to be refused %s %s, got %d", call.method, call.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	db, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	c := core.NewSecretlyCore(storage.NewLocalStorage(db), nil)
+	if err := c.SeedRoleTemplates(); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	tokens := make(map[string]string)
+	for name, roles := range map[string][]string{"admin": {"admin"}, "bob": nil} {
+		req := &core.CreateUserRequest{Username: name, Password: "s3cret", Roles: roles}
+		if _, err := c.CreateUser(core.WithSystemActor(context.Background(), "test"), req); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		tokens[name], _, _ = c.Login(context.Background(), name, "s3cret")
+	}
+	ts := httptest.NewServer(New(c, config.ServerInstanceConfig{}).Handler())
+	defer ts.Close()
+
+	disabled := do(t, http.MethodGet, ts.URL+"/api/v1/system/debug", tokens["admin"], "", nil)
+	disabled.Body.Close()
+	if disabled.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without server.debug, got %d", disabled.StatusCode)
+	}
+
+	c.SetDiagnostics(true)
+	refused := do(t, http.MethodGet, ts.URL+"/api/v1/system/debug/pprof/heap", tokens["bob"], "", nil)
+	refused.Body.Close()
+	if refused.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected users without system.manage to be refused, got %d", refused.StatusCode)
+	}
+
+	resp := do(t, http.MethodGet, ts.URL+"/api/v1/system/debug?goroutines=true", tokens["admin"], "", nil)
+	defer resp.Body.Close()
+	var report core.DiagnosticsReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode diagnostics: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || report.Goroutines == 0 || report.Memory.HeapAlloc == 0 ||
+		report.Build.GoVersion == "" || !strings.Contains(report.GoroutineDump, "goroutine ") {
+		t.Errorf("Unexpected diagnostics: %d %+v", resp.StatusCode, report)
+	}
+
+	heap := do(t, http.MethodGet, ts.URL+"/api/v1/system/debug/pprof/heap", tokens["admin"], "", nil)
+	defer heap.Body.Close()
+	profile, _ := io.ReadAll(heap.Body)
+	// Profiles are gzipped protocol buffers
+	if heap.StatusCode != http.StatusOK || !bytes.HasPrefix(profile, []byte{0x1f, 0x8b}) {
+		t.Errorf("Expected a heap profile, got %d with %d bytes", heap.StatusCode, len(profile))
+	}
+
+	events, _ := c.Storage().Audit().ListBetween(time.Time{}, time.Now().Add(time.Minute))
+	var reads int
+	for _, e := range events {
+		if e.EventType == core.EventDiagnosticsRead {
+			reads++
+		}
+	}
+	if reads != 2 {
+		t.Errorf("Expected both reads to be audited, got %d", reads)
+	}
+
+	// Federated sessions act for pipelines, even when they map to an admin
+	token, session, _ := c.Login(context.Background(), "admin", "s3cret")
+	db.Model(&models.Session{}).Where("id = ?", session.ID).Update("scope", "deploy")
+	for _, path := range []string{"/api/v1/system/debug", "/api/v1/system/debug/pprof/heap", "/api/v1/system/faults"} {
+		resp := do(t, http.MethodGet, ts.URL+path, token, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected a federated session to be refused %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
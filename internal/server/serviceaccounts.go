@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+)
+
+func (s *Server) handleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "list service accounts") {
+		return
+	}
+	accounts, err := s.core.ListServiceAccounts(r.Context())
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) handleListServiceTokens(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "list service account tokens") {
+		return
+	}
+	tokens, err := s.core.ListServiceTokens(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
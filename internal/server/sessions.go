@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// sessionResponse describes one of the caller's sessions. The token is
+// never returned; Current marks the session making the request.
+type sessionResponse struct {
+	ID         uint       `json:"id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	Scope      string     `json:"scope,omitempty"`
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+func newSessionResponse(session *models.Session, currentID uint) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		Device:     describeDevice(session.UserAgent),
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		Scope:      session.Scope,
+		Current:    session.ID == currentID,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
+
+// handleListSessions lists the caller's active sessions
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage sessions") {
+		return
+	}
+	sessions, err := s.core.ListSessions(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]sessionResponse, 0, len(sessions))
+	for i := range sessions {
+		resp = append(resp, newSessionResponse(&sessions[i], currentSession(r).ID))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevokeSession ends one of the caller's sessions, including the
+// current one
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage sessions") {
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid session id %q", r.PathValue("id")))
+		return
+	}
+	if err := s.core.RevokeSession(r.Context(), currentUser(r).ID, uint(id)); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeOtherSessions ends every session of the caller except the
+// one making the request
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage sessions") {
+		return
+	}
+	n, err := s.core.RevokeOtherSessions(r.Context(), currentUser(r).ID, currentSession(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": n})
+}
+
+// describeDevice turns a User-Agent header into a short label such as
+// "Firefox on Linux" or "secretly CLI"
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "unknown"
+	}
+	product, _, _ := strings.Cut(userAgent, " ")
+	name, _, _ := strings.Cut(product, "/")
+	switch {
+	case name == "secretly-cli":
+		return "secretly CLI"
+	case name != "Mozilla":
+		// curl/8.5.0, Go-http-client/1.1, python-requests/2.31 ...
+		return name
+	}
+
+	browser := "Browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// maxFieldSize bounds multipart metadata fields; only the value part is streamed
+const maxFieldSize = 4096
+
+// handleUploadSecret creates a secret from a streamed body without buffering
+// it. Two request forms are accepted:
+//
+//   - multipart/form-data: metadata fields (name, namespace_id, zone_id,
+//     environment_id, type, max_reads, expiration) followed by a "value" part.
+//     Fields after the value part are ignored.
+//   - any other content type: the raw body is the value and metadata is taken
+//     from query parameters. Chunked transfer encoding is supported.
+func (s *Server) handleUploadSecret(w http.ResponseWriter, r *http.Request) {
+	fields := r.URL.Query()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		s.createFromStream(w, r, fields, r.Body)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, `multipart body has no "value" part`)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if part.FormName() == "value" {
+			s.createFromStream(w, r, fields, part)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(data) > maxFieldSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("field %q is too large", part.FormName()))
+			return
+		}
+		fields.Set(part.FormName(), string(data))
+	}
+}
+
+func (s *Server) createFromStream(w http.ResponseWriter, r *http.Request, fields url.Values, body io.Reader) {
+	req, err := uploadRequest(fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.CreatedBy = currentUser(r).Username
+	if !s.authorizeNew(w, r, req) {
+		return
+	}
+
+	secret, err := s.core.CreateSecretFromReader(r.Context(), req, body)
+	if err != nil {
+		writeCoreError(w, err, http.StatusBadRequest)
+		return
+	}
+	state, err := s.core.GetSecretState(r.Context(), secret.ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeSecretState(w, http.StatusCreated, state)
+}
+
+func uploadRequest(fields url.Values) (*core.CreateSecretRequest, error) {
+	req := &core.CreateSecretRequest{
+		Name:          fields.Get("name"),
+		NamespaceID:   queryUint(fields.Get("namespace_id")),
+		ZoneID:        queryUint(fields.Get("zone_id")),
+		EnvironmentID: queryUint(fields.Get("environment_id")),
+		Type:          fields.Get("type"),
+	}
+	if v := fields.Get("max_reads"); v != "" {
+		maxReads, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_reads %q", v)
+		}
+		req.MaxReads = &maxReads
+	}
+	if v := fields.Get("expiration"); v != "" {
+		expiration, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration %q: expected RFC 3339", v)
+		}
+		req.Expiration = &expiration
+	}
+	return req, nil
+}
+
+// handleDownloadSecret streams the decrypted value as application/octet-stream
+func (s *Server) handleDownloadSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	secret := s.authorizeSecret(w, r, id, false)
+	if secret == nil {
+		return
+	}
+
+	out := &lazyHeaderWriter{w: w, filename: secret.Name}
+	written, err := s.core.StreamSecretValue(r.Context(), id, out)
+	if err != nil {
+		if written == 0 && !out.started {
+			writeCoreError(w, err, http.StatusBadRequest)
+			return
+		}
+		// Headers are already sent; the client sees a truncated body
+		logStreamError("Download", id, err)
+	}
+}
+
+// lazyHeaderWriter sends download headers on the first write so that errors
+// detected before any data is produced can still be reported as JSON
+type lazyHeaderWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (l *lazyHeaderWriter) Write(p []byte) (int, error) {
+	if !l.started {
+		l.started = true
+		h := l.w.Header()
+		h.Set("Content-Type", "application/octet-stream")
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": sanitizeFilename(l.filename)}))
+		h.Set("Cache-Control", "no-store")
+		l.w.WriteHeader(http.StatusOK)
+	}
+	n, err := l.w.Write(p)
+	if f, ok := l.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "secret"
+	}
+	return name
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/core"
+)
+
+// twoFactorPath is the only path open to sessions that must enroll first
+const twoFactorPath = "/api/v1/me/2fa"
+
+type twoFactorStatusResponse struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	ElevatedUntil     *time.Time `json:"elevated_until,omitempty"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type elevateResponse struct {
+	ElevatedUntil time.Time `json:"elevated_until"`
+}
+
+// handleTwoFactorStatus reports the caller's two-factor settings
+func (s *Server) handleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	user, session := currentUser(r), currentSession(r)
+	resp := twoFactorStatusResponse{
+		Enabled:           user.TOTPEnabledAt != nil,
+		Required:          s.core.TwoFactorRequired(user),
+		EnabledAt:         user.TOTPEnabledAt,
+		RecoveryCodesLeft: core.RecoveryCodesLeft(user),
+	}
+	if session.ElevatedUntil != nil && session.ElevatedUntil.After(time.Now()) {
+		resp.ElevatedUntil = session.ElevatedUntil
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleEnrollTOTP starts enrollment and returns the key for the
+// authenticator app
+func (s *Server) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage two-factor authentication") {
+		return
+	}
+	enrollment, err := s.core.EnrollTOTP(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+// handleConfirmTOTP enables two-factor authentication with a first code
+// and returns the recovery codes. Sessions that were limited to enrollment
+// stay limited; the user logs in again with a code.
+func (s *Server) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage two-factor authentication") {
+		return
+	}
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		writeDecodeError(w, err, "code is required")
+		return
+	}
+	codes, err := s.core.ConfirmTOTP(r.Context(), currentUser(r).ID, req.Code)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// handleDisableTOTP turns two-factor authentication off
+func (s *Server) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage two-factor authentication") || !s.requireElevation(w, r) {
+		return
+	}
+	if err := s.core.DisableTOTP(r.Context(), currentUser(r).ID); err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRegenerateRecoveryCodes replaces the caller's recovery codes
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "manage two-factor authentication") || !s.requireElevation(w, r) {
+		return
+	}
+	codes, err := s.core.RegenerateRecoveryCodes(r.Context(), currentUser(r).ID)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// handleElevateSession unlocks sensitive operations for the current
+// session after checking a code
+func (s *Server) handleElevateSession(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePersonalSession(w, r, "elevate sessions") {
+		return
+	}
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		writeDecodeError(w, err, "code is required")
+		return
+	}
+	until, err := s.core.ElevateSession(r.Context(), currentUser(r), currentSession(r), req.Code)
+	if err != nil {
+		writeCoreError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, elevateResponse{ElevatedUntil: until})
+}
+
+// requireElevation rejects sensitive actions until the session confirms a
+// second factor
+func (s *Server) requireElevation(w http.ResponseWriter, r *http.Request) bool {
+	if err := s.core.RequireElevation(currentUser(r), currentSession(r)); err != nil {
+		writeCoreError(w, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -1,10 +1,15 @@
 package startup
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/secretlyhq/secretly/internal/config"
 	"github.com/secretlyhq/secretly/internal/securefiles"
@@ -17,23 +22,29 @@ const (
 
 // ValidationResult contains the results of startup validation
 type ValidationResult struct {
-	ConfigValid   bool
-	PermissionsOK bool
-	EncryptionOK  bool
-	DatabaseOK    bool
-	Warnings      []string
-	Errors        []string
+	CheckedAt     time.Time `json:"checked_at"`
+	Skipped       bool      `json:"skipped"`
+	ConfigValid   bool      `json:"config_valid"`
+	PermissionsOK bool      `json:"permissions_ok"`
+	EncryptionOK  bool      `json:"encryption_ok"`
+	DatabaseOK    bool      `json:"database_ok"`
+	TLSOK         bool      `json:"tls_ok"`
+	Warnings      []string  `json:"warnings"`
+	Errors        []string  `json:"errors"`
 }
 
+// sqliteHeader starts every SQLite 3 database file
+const sqliteHeader = "SQLite format 3\x00"
+
+// certExpiryWarning is how long before expiry a TLS certificate is reported
+const certExpiryWarning = 30 * 24 * time.Hour
+
 // ValidateStartup performs comprehensive startup validation
 func ValidateStartup(configPath string) (*ValidationResult, error) {
 	result := &ValidationResult{
-		ConfigValid:   false,
-		PermissionsOK: false,
-		EncryptionOK:  false,
-		DatabaseOK:    false,
-		Warnings:      []string{},
-		Errors:        []string{},
+		CheckedAt: time.Now().UTC(),
+		Warnings:  []string{},
+		Errors:    []string{},
 	}
 
 	cfg, err := config.Load(configPath)
@@ -41,10 +52,14 @@ func ValidateStartup(configPath string) (*ValidationResult, error) {
 		result.Errors = append(result.Errors, fmt.Sprintf("Failed to load config: %v", err))
 		return result, fmt.Errorf("configuration validation failed: %w", err)
 	}
+	if err := validateConfig(cfg); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Invalid config: %v", err))
+		return result, fmt.Errorf("configuration validation failed: %w", err)
+	}
 	result.ConfigValid = true
 
 	if cfg.Security.EnableFilePermissionCheck {
-		if err := validateFilePermissions(cfg, result); err != nil {
+		if err := validateFilePermissions(configPath, cfg, result); err != nil {
 			if !cfg.Security.AllowUnsafeFilePermissions {
 				return result, fmt.Errorf("file permission validation failed: %w", err)
 			}
@@ -74,14 +89,43 @@ func ValidateStartup(configPath string) (*ValidationResult, error) {
 	}
 	result.DatabaseOK = true
 
+	if err := validateTLS(cfg.Server.HTTP.TLS, result); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("TLS validation failed: %v", err))
+		return result, fmt.Errorf("TLS validation failed: %w", err)
+	}
+	result.TLSOK = true
+
 	return result, nil
 }
 
-func validateFilePermissions(cfg *config.Config, result *ValidationResult) error {
+// validateConfig catches settings that would only fail once the server is
+// running
+func validateConfig(cfg *config.Config) error {
+	if port := cfg.Server.HTTP.Port; port != "" && !strings.Contains(port, ":") {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("server.http.port %q is not a valid port", port)
+		}
+	}
+	if cfg.Server.HTTP.TLS.Enabled && (cfg.Server.HTTP.TLS.CertFile == "" || cfg.Server.HTTP.TLS.KeyFile == "") {
+		return fmt.Errorf("server.http.tls needs cert_file and key_file when enabled")
+	}
+	if cfg.Storage.Encryption.Enabled && (cfg.Storage.Encryption.KEKPath == "" || cfg.Storage.Encryption.DEKPath == "") {
+		return fmt.Errorf("storage.encryption needs kek_path and dek_path when enabled")
+	}
+	if cfg.Storage.Database.Path == "" {
+		return fmt.Errorf("storage.database.path is required")
+	}
+	return nil
+}
+
+// CriticalFiles lists the files whose mode and ownership the security
+// settings protect: the config file, the encryption keys, the database and
+// the TLS certificates and keys
+func CriticalFiles(configPath string, cfg *config.Config) []securefiles.FilePermSpec {
 	var files []securefiles.FilePermSpec
 
 	files = append(files, securefiles.FilePermSpec{
-		Path: filepath.Clean("secretly.yaml"),
+		Path: filepath.Clean(configPath),
 		Mode: 0600,
 	})
 
@@ -109,8 +153,21 @@ func validateFilePermissions(cfg *config.Config, result *ValidationResult) error
 			securefiles.FilePermSpec{Path: filepath.Clean(cfg.Server.GRPC.TLS.KeyFile), Mode: 0600},
 		)
 	}
+	return files
+}
 
-	if err := securefiles.FixFilePerms(files, cfg.Security.AutoFixFilePermissions); err != nil {
+func validateFilePermissions(configPath string, cfg *config.Config, result *ValidationResult) error {
+	files := CriticalFiles(configPath, cfg)
+
+	// Missing keys are reported by validateEncryption, and a missing
+	// database is created on first use
+	existing := files[:0]
+	for _, f := range files {
+		if _, err := os.Stat(f.Path); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if err := securefiles.FixFilePerms(existing, cfg.Security.AutoFixFilePermissions); err != nil {
 		return fmt.Errorf("file permission validation failed: %w", err)
 	}
 
@@ -130,7 +187,7 @@ func validateEncryption(cfg *config.Config, result *ValidationResult) error {
 		{cfg.Storage.Encryption.DEKPath, "DEK"},
 	} {
 		path := filepath.Clean(key.Path)
-		if strings.Contains(path, "..") || !filepath.IsAbs(path) {
+		if strings.Contains(path, "..") {
 			return fmt.Errorf("%s path is invalid or unsafe: %s", key.Name, path)
 		}
 		if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -157,8 +214,8 @@ func validateKeyFile(path, keyType string) error {
 func validateDatabase(cfg *config.Config, result *ValidationResult) error {
 	dbPath := filepath.Clean(cfg.Storage.Database.Path)
 
-	if strings.Contains(dbPath, "..") || !filepath.IsAbs(dbPath) {
-		return fmt.Errorf("unsafe or relative database path: %s", dbPath)
+	if strings.Contains(dbPath, "..") {
+		return fmt.Errorf("unsafe database path: %s", dbPath)
 	}
 
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
@@ -170,10 +227,41 @@ func validateDatabase(cfg *config.Config, result *ValidationResult) error {
 	if err != nil {
 		return fmt.Errorf("cannot open database file %s: %w", dbPath, err)
 	}
-	if err := file.Close(); err != nil {
-		return fmt.Errorf("failed to close database file: %w", err)
+	defer file.Close()
+
+	// An empty file is initialized by the first migration
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(file, header)
+	if n == 0 && (err == io.EOF || err == nil) {
+		return nil
+	}
+	if err != nil || string(header) != sqliteHeader {
+		return fmt.Errorf("database file %s is not a SQLite 3 database", dbPath)
 	}
+	return nil
+}
 
+// validateTLS loads the certificate and key and warns about certificates
+// that expire soon
+func validateTLS(cfg config.TLSConfig, result *ValidationResult) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load certificate %s and key %s: %w", cfg.CertFile, cfg.KeyFile, err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("cannot parse certificate %s: %w", cfg.CertFile, err)
+	}
+	now := time.Now()
+	switch {
+	case now.After(cert.NotAfter):
+		return fmt.Errorf("certificate %s expired on %s", cfg.CertFile, cert.NotAfter.Format("2006-01-02"))
+	case now.Add(certExpiryWarning).After(cert.NotAfter):
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Certificate %s expires on %s", cfg.CertFile, cert.NotAfter.Format("2006-01-02")))
+	}
 	return nil
 }
 
@@ -193,6 +281,7 @@ func PrintValidationResult(result *ValidationResult) {
 	printStatus("Permissions", result.PermissionsOK)
 	printStatus("Encryption", result.EncryptionOK)
 	printStatus("Database", result.DatabaseOK)
+	printStatus("TLS", result.TLSOK)
 
 	if len(result.Warnings) > 0 {
 		fmt.Println("\n⚠️  Warnings:")
@@ -207,7 +296,7 @@ func PrintValidationResult(result *ValidationResult) {
 		}
 	}
 
-	if result.ConfigValid && result.PermissionsOK && result.EncryptionOK && result.DatabaseOK {
+	if result.ConfigValid && result.PermissionsOK && result.EncryptionOK && result.DatabaseOK && result.TLSOK {
 		fmt.Println("\n🎉 All validations passed!")
 	} else {
 		fmt.Println("\n⚠️  Some validations failed. Please review the output above.")
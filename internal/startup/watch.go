@@ -0,0 +1,162 @@
+package startup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/securefiles"
+)
+
+const defaultDriftWebhookTimeout = 10 * time.Second
+
+// DriftReport describes one permission check that found drift: files whose
+// mode or owner no longer match the security settings
+type DriftReport struct {
+	Text     string                `json:"text"`
+	Event    string                `json:"event"`
+	Severity string                `json:"severity"`
+	Time     time.Time             `json:"time"`
+	Host     string                `json:"host"`
+	Findings []securefiles.Finding `json:"findings"`
+}
+
+// PermissionWatcher periodically re-checks the critical files and reports
+// drift. With security.auto_fix_file_permissions set it also restores the
+// expected mode and owner.
+type PermissionWatcher struct {
+	files   []securefiles.FilePermSpec
+	autofix bool
+	notify  func(DriftReport)
+
+	// last holds the unfixed problems of the previous check, so that drift
+	// is reported once rather than on every tick
+	last map[string]bool
+}
+
+// NewPermissionWatcher creates a watcher for the critical files of cfg.
+// notify is called for every check that finds new drift or fixes a file.
+func NewPermissionWatcher(configPath string, cfg *config.Config, notify func(DriftReport)) *PermissionWatcher {
+	return &PermissionWatcher{
+		files:   CriticalFiles(configPath, cfg),
+		autofix: cfg.Security.AutoFixFilePermissions,
+		notify:  notify,
+		last:    map[string]bool{},
+	}
+}
+
+// Run checks the files every interval until ctx is cancelled
+func (w *PermissionWatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.Check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs one pass over the files and returns its findings
+func (w *PermissionWatcher) Check() []securefiles.Finding {
+	findings, err := securefiles.CheckFilePerms(w.files, w.autofix)
+	if err != nil {
+		log.Printf("⚠️  File permission check failed: %v", err)
+		return nil
+	}
+
+	current := make(map[string]bool, len(findings))
+	changed := false
+	for _, f := range findings {
+		if f.Fixed {
+			changed = true
+			continue
+		}
+		current[f.Problem] = true
+		if !w.last[f.Problem] {
+			changed = true
+		}
+	}
+	if len(current) == 0 && len(w.last) > 0 {
+		log.Println("✅ File permission drift resolved")
+	}
+	w.last = current
+
+	if changed && w.notify != nil {
+		w.notify(newDriftReport(findings))
+	}
+	return findings
+}
+
+func newDriftReport(findings []securefiles.Finding) DriftReport {
+	host, _ := os.Hostname()
+	report := DriftReport{
+		Event:    "file_permission_drift",
+		Severity: "warning",
+		Time:     time.Now().UTC(),
+		Host:     host,
+		Findings: findings,
+	}
+	lines := make([]string, 0, len(findings))
+	for _, f := range findings {
+		if f.Fixed {
+			lines = append(lines, "fixed: "+f.Problem)
+			continue
+		}
+		report.Severity = "critical"
+		lines = append(lines, f.Problem)
+	}
+	report.Text = fmt.Sprintf("⚠️ File permission drift on %s:\n%s", host, strings.Join(lines, "\n"))
+	return report
+}
+
+// LogDrift writes a drift report to the log
+func LogDrift(report DriftReport) {
+	for _, f := range report.Findings {
+		if f.Fixed {
+			log.Printf("🔧 [FIXED] %s", f.Problem)
+		} else {
+			log.Printf("⚠️  [DRIFT] %s", f.Problem)
+		}
+	}
+}
+
+// DriftNotifier returns a notify function for NewPermissionWatcher that logs
+// every report and, when cfg has a webhook URL, posts it there as JSON
+// (Slack-compatible "text" field plus details)
+func DriftNotifier(cfg config.FileAuditConfig) func(DriftReport) {
+	if cfg.WebhookURL == "" {
+		return LogDrift
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultDriftWebhookTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	return func(report DriftReport) {
+		LogDrift(report)
+		body, err := json.Marshal(report)
+		if err != nil {
+			log.Printf("⚠️  Failed to encode drift report: %v", err)
+			return
+		}
+		resp, err := client.Post(cfg.WebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("⚠️  Failed to send drift report: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("⚠️  Drift webhook returned %d", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package memory provides a thread-safe in-memory Storage implementation.
+// It is intended for tests and for embedding Secretly where a SQLite database
+// is not wanted; data is lost when the process exits.
+package memory
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Storage is an in-memory implementation of storage.Storage
+type Storage struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex
+
+	nextID map[string]uint
+
+	secretNodes    map[uint]models.SecretNode
+	secretVersions map[uint]models.SecretVersion
+	secretChunks   map[uint]models.SecretChunk
+	secretKeyReads map[uint]models.SecretKeyRead
+	users          map[uint]models.User
+	sessions       map[uint]models.Session
+	auditEvents    map[uint]models.AuditEvent
+	configuration  map[string]string
+	namespaces     map[uint]models.Namespace
+	zones          map[uint]models.Zone
+	environments   map[uint]models.Environment
+	operations     map[uint]models.PendingOperation
+	passwordResets map[uint]models.PasswordReset
+	passkeys       map[uint]models.WebAuthnCredential
+	apiClients     map[uint]models.APIClient
+	deviceTokens   map[uint]models.DeviceEnrollmentToken
+	devices        map[uint]models.Device
+	checkouts      map[uint]models.SecretCheckout
+	aliases        map[uint]models.SecretAlias
+	grants         map[uint]models.SecretGrant
+	exports        map[uint]models.ExportProfile
+	roles          map[uint]models.Role
+	groups         map[uint]models.Group
+	members        map[[2]uint]models.UserGroup // by group and user ID
+	userRoles      map[[2]uint]models.UserRole  // by user and role ID
+	groupRoles     map[[2]uint]models.GroupRole // by group and role ID
+	denyRules      map[uint]models.DenyRule
+	rbacChanges    map[uint]models.RBACChangeLog
+	services       map[uint]models.ServiceAccount
+	releases       map[uint]models.SecretRelease
+	custodians     map[uint]models.EscrowCustodian // by user ID
+	escrows        map[uint]models.Escrow
+	escrowShares   map[uint]models.EscrowShare
+	recoveries     map[uint]models.EscrowRecovery
+	escrowLog      map[uint]models.EscrowLogEntry
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+// New creates an empty in-memory storage
+func New() *Storage {
+	return &Storage{
+		nextID:         make(map[string]uint),
+		secretNodes:    make(map[uint]models.SecretNode),
+		secretVersions: make(map[uint]models.SecretVersion),
+		secretChunks:   make(map[uint]models.SecretChunk),
+		secretKeyReads: make(map[uint]models.SecretKeyRead),
+		users:          make(map[uint]models.User),
+		sessions:       make(map[uint]models.Session),
+		auditEvents:    make(map[uint]models.AuditEvent),
+		configuration:  make(map[string]string),
+		namespaces:     make(map[uint]models.Namespace),
+		zones:          make(map[uint]models.Zone),
+		environments:   make(map[uint]models.Environment),
+		operations:     make(map[uint]models.PendingOperation),
+		passwordResets: make(map[uint]models.PasswordReset),
+		passkeys:       make(map[uint]models.WebAuthnCredential),
+		apiClients:     make(map[uint]models.APIClient),
+		deviceTokens:   make(map[uint]models.DeviceEnrollmentToken),
+		devices:        make(map[uint]models.Device),
+		checkouts:      make(map[uint]models.SecretCheckout),
+		aliases:        make(map[uint]models.SecretAlias),
+		grants:         make(map[uint]models.SecretGrant),
+		exports:        make(map[uint]models.ExportProfile),
+		roles:          make(map[uint]models.Role),
+		groups:         make(map[uint]models.Group),
+		members:        make(map[[2]uint]models.UserGroup),
+		userRoles:      make(map[[2]uint]models.UserRole),
+		groupRoles:     make(map[[2]uint]models.GroupRole),
+		denyRules:      make(map[uint]models.DenyRule),
+		rbacChanges:    make(map[uint]models.RBACChangeLog),
+		services:       make(map[uint]models.ServiceAccount),
+		releases:       make(map[uint]models.SecretRelease),
+		custodians:     make(map[uint]models.EscrowCustodian),
+		escrows:        make(map[uint]models.Escrow),
+		escrowShares:   make(map[uint]models.EscrowShare),
+		recoveries:     make(map[uint]models.EscrowRecovery),
+		escrowLog:      make(map[uint]models.EscrowLogEntry),
+	}
+}
+
+// Secrets returns the in-memory secret repository
+func (s *Storage) Secrets() repository.SecretRepository { return &secretRepo{s} }
+
+// Users returns the in-memory user repository
+func (s *Storage) Users() repository.UserRepository { return &userRepo{s} }
+
+// Sessions returns the in-memory session repository
+func (s *Storage) Sessions() repository.SessionRepository { return &sessionRepo{s} }
+
+// Audit returns the in-memory audit repository
+func (s *Storage) Audit() repository.AuditRepository { return &auditRepo{s} }
+
+// Config returns the in-memory configuration repository
+func (s *Storage) Config() repository.ConfigRepository { return &configRepo{s} }
+
+// Scopes returns the in-memory namespace, zone and environment repository
+func (s *Storage) Scopes() repository.ScopeRepository { return &scopeRepo{s} }
+
+// Operations returns the in-memory pending operation repository
+func (s *Storage) Operations() repository.OperationRepository { return &operationRepo{s} }
+
+// PasswordResets returns the in-memory password reset repository
+func (s *Storage) PasswordResets() repository.PasswordResetRepository {
+	return &passwordResetRepo{s}
+}
+
+// WebAuthnCredentials returns the in-memory passkey repository
+func (s *Storage) WebAuthnCredentials() repository.WebAuthnCredentialRepository {
+	return &passkeyRepo{s}
+}
+
+// APIClients returns the in-memory API client repository
+func (s *Storage) APIClients() repository.APIClientRepository { return &apiClientRepo{s} }
+
+// Devices returns the in-memory device repository
+func (s *Storage) Devices() repository.DeviceRepository { return &deviceRepo{s} }
+
+// Checkouts returns the in-memory secret checkout repository
+func (s *Storage) Checkouts() repository.CheckoutRepository { return &checkoutRepo{s} }
+
+// Aliases returns the in-memory secret alias repository
+func (s *Storage) Aliases() repository.AliasRepository { return &aliasRepo{s} }
+
+// Grants returns the in-memory secret grant repository
+func (s *Storage) Grants() repository.GrantRepository { return &grantRepo{s} }
+
+// ExportProfiles returns the in-memory export profile repository
+func (s *Storage) ExportProfiles() repository.ExportProfileRepository { return &exportProfileRepo{s} }
+
+// RBAC returns the in-memory role and group repository
+func (s *Storage) RBAC() repository.RBACRepository { return &rbacRepo{s} }
+
+// ServiceAccounts returns the in-memory service account repository
+func (s *Storage) ServiceAccounts() repository.ServiceAccountRepository {
+	return &serviceAccountRepo{s}
+}
+
+// Releases returns the in-memory scheduled release repository
+func (s *Storage) Releases() repository.ReleaseRepository { return &releaseRepo{s} }
+
+// Escrows returns the in-memory escrow repository
+func (s *Storage) Escrows() repository.EscrowRepository { return &escrowRepo{s} }
+
+// WithTransaction runs fn and, if it fails, restores every table to its state
+// before fn. Transactions are serialized with each other but not with plain
+// repository calls, whose writes made while fn runs are lost on rollback.
+func (s *Storage) WithTransaction(fn func(tx storage.Storage) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	snap := s.snapshot()
+	if err := fn(s); err != nil {
+		s.restore(snap)
+		return err
+	}
+	return nil
+}
+
+// snapshot copies the tables; only the maps are used
+func (s *Storage) snapshot() *Storage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Storage{
+		secretNodes:    maps.Clone(s.secretNodes),
+		secretVersions: maps.Clone(s.secretVersions),
+		secretChunks:   maps.Clone(s.secretChunks),
+		secretKeyReads: maps.Clone(s.secretKeyReads),
+		users:          maps.Clone(s.users),
+		sessions:       maps.Clone(s.sessions),
+		auditEvents:    maps.Clone(s.auditEvents),
+		configuration:  maps.Clone(s.configuration),
+		namespaces:     maps.Clone(s.namespaces),
+		zones:          maps.Clone(s.zones),
+		environments:   maps.Clone(s.environments),
+		operations:     maps.Clone(s.operations),
+		passwordResets: maps.Clone(s.passwordResets),
+		passkeys:       maps.Clone(s.passkeys),
+		apiClients:     maps.Clone(s.apiClients),
+		deviceTokens:   maps.Clone(s.deviceTokens),
+		devices:        maps.Clone(s.devices),
+		checkouts:      maps.Clone(s.checkouts),
+		aliases:        maps.Clone(s.aliases),
+		grants:         maps.Clone(s.grants),
+		exports:        maps.Clone(s.exports),
+		roles:          maps.Clone(s.roles),
+		groups:         maps.Clone(s.groups),
+		members:        maps.Clone(s.members),
+		userRoles:      maps.Clone(s.userRoles),
+		groupRoles:     maps.Clone(s.groupRoles),
+		denyRules:      maps.Clone(s.denyRules),
+		rbacChanges:    maps.Clone(s.rbacChanges),
+		services:       maps.Clone(s.services),
+		releases:       maps.Clone(s.releases),
+		custodians:     maps.Clone(s.custodians),
+		escrows:        maps.Clone(s.escrows),
+		escrowShares:   maps.Clone(s.escrowShares),
+		recoveries:     maps.Clone(s.recoveries),
+		escrowLog:      maps.Clone(s.escrowLog),
+	}
+}
+
+// restore puts back the tables of snap. IDs allocated since are not reused.
+func (s *Storage) restore(snap *Storage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secretNodes = snap.secretNodes
+	s.secretVersions = snap.secretVersions
+	s.secretChunks = snap.secretChunks
+	s.secretKeyReads = snap.secretKeyReads
+	s.users = snap.users
+	s.sessions = snap.sessions
+	s.auditEvents = snap.auditEvents
+	s.configuration = snap.configuration
+	s.namespaces = snap.namespaces
+	s.zones = snap.zones
+	s.environments = snap.environments
+	s.operations = snap.operations
+	s.passwordResets = snap.passwordResets
+	s.passkeys = snap.passkeys
+	s.apiClients = snap.apiClients
+	s.deviceTokens = snap.deviceTokens
+	s.devices = snap.devices
+	s.checkouts = snap.checkouts
+	s.aliases = snap.aliases
+	s.grants = snap.grants
+	s.exports = snap.exports
+	s.roles = snap.roles
+	s.groups = snap.groups
+	s.members = snap.members
+	s.userRoles = snap.userRoles
+	s.groupRoles = snap.groupRoles
+	s.denyRules = snap.denyRules
+	s.rbacChanges = snap.rbacChanges
+	s.services = snap.services
+	s.releases = snap.releases
+	s.custodians = snap.custodians
+	s.escrows = snap.escrows
+	s.escrowShares = snap.escrowShares
+	s.recoveries = snap.recoveries
+	s.escrowLog = snap.escrowLog
+}
+
+// allocID returns the next auto-increment ID for a table; callers must hold mu
+func (s *Storage) allocID(table string) uint {
+	s.nextID[table]++
+	return s.nextID[table]
+}
@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+func TestSecretLifecycle(t *testing.T) {
+	s := New()
+
+	secret := &models.SecretNode{Name: "api-key", IsSecret: true}
+	if err := s.Secrets().Create(secret); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	if secret.ID == 0 {
+		t.Fatal("Expected ID to be assigned")
+	}
+
+	got, err := s.Secrets().GetByID(secret.ID)
+	if err != nil {
+		t.Fatalf("Failed to get secret: %v", err)
+	}
+	if got.Name != "api-key" || got.Status != "active" {
+		t.Errorf("Unexpected secret: %+v", got)
+	}
+
+	// Mutating the returned copy must not affect stored data
+	got.Name = "changed"
+	again, _ := s.Secrets().GetByID(secret.ID)
+	if again.Name != "api-key" {
+		t.Error("Stored secret was modified through returned pointer")
+	}
+
+	if err := s.Secrets().Delete(secret.ID); err != nil {
+		t.Fatalf("Failed to delete secret: %v", err)
+	}
+	if _, err := s.Secrets().GetByID(secret.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestUserUniqueness(t *testing.T) {
+	s := New()
+
+	if err := s.Users().Create(&models.User{Username: "alice"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := s.Users().Create(&models.User{Username: "alice"}); err == nil {
+		t.Error("Expected error for duplicate username")
+	}
+
+	user, err := s.Users().FindByUsername("alice")
+	if err != nil || user.Username != "alice" {
+		t.Errorf("Failed to find user: %v", err)
+	}
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	s := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = s.Users().Create(&models.User{Username: fmt.Sprintf("user-%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := s.Users().List()
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 50 {
+		t.Errorf("Expected 50 users, got %d", len(users))
+	}
+	for i, u := range users {
+		if u.ID != uint(i+1) {
+			t.Errorf("Expected sequential IDs, got %d at position %d", u.ID, i)
+		}
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	s := New()
+	kept := &models.SecretNode{Name: "kept"}
+	if err := s.Secrets().Create(kept); err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+
+	failure := errors.New("version failed")
+	err := s.WithTransaction(func(tx storage.Storage) error {
+		if err := tx.Secrets().Create(&models.SecretNode{Name: "orphan"}); err != nil {
+			return err
+		}
+		if err := tx.Secrets().Delete(kept.ID); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+	secrets, _ := s.Secrets().List()
+	if len(secrets) != 1 || secrets[0].Name != "kept" {
+		t.Errorf("Expected only %q after rollback, got %+v", kept.Name, secrets)
+	}
+}
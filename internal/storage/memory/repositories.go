@@ -0,0 +1,2026 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Not-found and duplicate-key conditions return storage.ErrNotFound and
+// storage.ErrConflict so callers behave the same way regardless of the
+// backing store.
+
+type secretRepo struct{ s *Storage }
+
+func (r *secretRepo) Create(secret *models.SecretNode) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.nameTaken(secret) {
+		return storage.ErrConflict
+	}
+	now := time.Now()
+	secret.ID = r.s.allocID("secret_nodes")
+	if secret.Status == "" {
+		secret.Status = "active"
+	}
+	secret.CreatedAt = now
+	secret.UpdatedAt = now
+	r.s.secretNodes[secret.ID] = *secret
+	return nil
+}
+
+func (r *secretRepo) GetByID(id uint) (*models.SecretNode, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	secret, ok := r.s.secretNodes[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &secret, nil
+}
+
+func (r *secretRepo) GetByIDs(ids []uint) ([]models.SecretNode, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var secrets []models.SecretNode
+	for _, id := range ids {
+		if secret, ok := r.s.secretNodes[id]; ok {
+			secrets = append(secrets, secret)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].ID < secrets[j].ID })
+	return secrets, nil
+}
+
+func (r *secretRepo) List() ([]models.SecretNode, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	secrets := make([]models.SecretNode, 0, len(r.s.secretNodes))
+	for _, secret := range r.s.secretNodes {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].ID < secrets[j].ID })
+	return secrets, nil
+}
+
+func (r *secretRepo) ListAfter(q repository.SecretQuery) ([]models.SecretNode, error) {
+	all, _ := r.List()
+
+	var secrets []models.SecretNode
+	for _, secret := range all {
+		if secret.ID <= q.AfterID || !r.matches(&secret, &q) {
+			continue
+		}
+		secrets = append(secrets, secret)
+		if q.Limit > 0 && len(secrets) == q.Limit {
+			break
+		}
+	}
+	return secrets, nil
+}
+
+func (r *secretRepo) Query(q repository.SecretQuery) ([]models.SecretNode, error) {
+	all, _ := r.List()
+
+	secrets := all[:0]
+	for _, secret := range all {
+		if r.matches(&secret, &q) {
+			secrets = append(secrets, secret)
+		}
+	}
+	sort.SliceStable(secrets, func(i, j int) bool {
+		a, b := &secrets[i], &secrets[j]
+		if q.Descending {
+			a, b = b, a
+		}
+		switch q.Sort {
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case "created_at":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case "updated_at":
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+		case "expiration":
+			// NULLs sort first, as in SQLite and MySQL
+			switch {
+			case a.Expiration == nil && b.Expiration != nil:
+				return true
+			case a.Expiration != nil && b.Expiration == nil:
+				return false
+			case a.Expiration != nil && !a.Expiration.Equal(*b.Expiration):
+				return a.Expiration.Before(*b.Expiration)
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	start := min(max(q.Offset, 0), len(secrets))
+	secrets = secrets[start:]
+	if q.Limit > 0 && len(secrets) > q.Limit {
+		secrets = secrets[:q.Limit]
+	}
+	return secrets, nil
+}
+
+func (r *secretRepo) Count(q repository.SecretQuery) (int64, error) {
+	q.Offset, q.Limit = 0, 0
+	secrets, err := r.Query(q)
+	return int64(len(secrets)), err
+}
+
+// matchesNameKey matches by the name index, and secrets without one by name
+func matchesNameKey(secret *models.SecretNode, q *repository.SecretQuery) bool {
+	if secret.NameKey == nil {
+		return secret.Name == q.Name
+	}
+	return *secret.NameKey == q.NameKey
+}
+
+// matches reports whether secret passes the filters of q
+func (r *secretRepo) matches(secret *models.SecretNode, q *repository.SecretQuery) bool {
+	switch {
+	case q.NamespaceID != 0 && secret.NamespaceID != q.NamespaceID,
+		q.ZoneID != 0 && secret.ZoneID != q.ZoneID,
+		q.EnvironmentID != 0 && secret.EnvironmentID != q.EnvironmentID,
+		q.Type != "" && secret.Type != q.Type,
+		q.NameKey != "" && !matchesNameKey(secret, q),
+		q.NameKey == "" && q.Name != "" && secret.Name != q.Name,
+		!strings.HasPrefix(secret.Name, q.Prefix),
+		q.IsSecret != nil && secret.IsSecret != *q.IsSecret:
+		return false
+	}
+	if q.ReadableBy == nil || (secret.Owner != "" && secret.Owner == q.ReadableBy.Username) {
+		return true
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	granted, readable := false, false
+	for _, grant := range r.s.grants {
+		if grant.SecretNodeID == secret.ID {
+			granted = true
+			if grant.UserID == q.ReadableBy.UserID && (grant.Level == "read" || grant.Level == "write") {
+				readable = true
+			}
+		}
+	}
+	return !granted || readable
+}
+
+func (r *secretRepo) Update(secret *models.SecretNode) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.secretNodes[secret.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	if r.nameTaken(secret) {
+		return storage.ErrConflict
+	}
+	secret.UpdatedAt = time.Now()
+	r.s.secretNodes[secret.ID] = *secret
+	return nil
+}
+
+func (r *secretRepo) TouchIfUnchanged(id uint, updatedAt time.Time) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	secret, ok := r.s.secretNodes[id]
+	if !ok || !secret.UpdatedAt.Equal(updatedAt) {
+		return false, nil
+	}
+	secret.UpdatedAt = time.Now()
+	r.s.secretNodes[id] = secret
+	return true, nil
+}
+
+func (r *secretRepo) FindByNameKey(namespaceID, zoneID, environmentID uint, nameKey string) (*models.SecretNode, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, secret := range r.s.secretNodes {
+		if secret.NamespaceID == namespaceID && secret.ZoneID == zoneID && secret.EnvironmentID == environmentID &&
+			secret.NameKey != nil && *secret.NameKey == nameKey {
+			return &secret, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *secretRepo) ListChildren(parentID uint) ([]models.SecretNode, error) {
+	all, _ := r.List()
+
+	var children []models.SecretNode
+	for _, node := range all {
+		if node.ParentID != nil && *node.ParentID == parentID {
+			children = append(children, node)
+		}
+	}
+	return children, nil
+}
+
+// nameTaken enforces the unique name key of the secret's scope; callers
+// must hold mu
+func (r *secretRepo) nameTaken(secret *models.SecretNode) bool {
+	if secret.NameKey == nil {
+		return false
+	}
+	for id, other := range r.s.secretNodes {
+		if id != secret.ID && other.NamespaceID == secret.NamespaceID && other.ZoneID == secret.ZoneID &&
+			other.EnvironmentID == secret.EnvironmentID && other.NameKey != nil && *other.NameKey == *secret.NameKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *secretRepo) GetVersions(secretID uint) ([]models.SecretVersion, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var versions []models.SecretVersion
+	for _, v := range r.s.secretVersions {
+		if v.SecretNodeID == secretID {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions, nil
+}
+
+func (r *secretRepo) CreateVersion(version *models.SecretVersion) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, other := range r.s.secretVersions {
+		if other.SecretNodeID == version.SecretNodeID && other.VersionNumber == version.VersionNumber {
+			return storage.ErrConflict
+		}
+	}
+	version.ID = r.s.allocID("secret_versions")
+	version.CreatedAt = time.Now()
+	r.s.secretVersions[version.ID] = *version
+	return nil
+}
+
+func (r *secretRepo) UpdateVersion(version *models.SecretVersion) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.secretVersions[version.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.secretVersions[version.ID] = *version
+	return nil
+}
+
+func (r *secretRepo) UpdateVersionContent(version *models.SecretVersion) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.secretVersions[version.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	stored.EncryptionMetadata, stored.ChunkCount = version.EncryptionMetadata, version.ChunkCount
+	stored.Compression, stored.ContentHash = version.Compression, version.ContentHash
+	r.s.secretVersions[version.ID] = stored
+	return nil
+}
+
+func (r *secretRepo) ConsumeRead(versionID uint, maxReads *int) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	version, ok := r.s.secretVersions[versionID]
+	if !ok || (maxReads != nil && version.ReadCount >= *maxReads) {
+		return 0, nil
+	}
+	version.ReadCount++
+	r.s.secretVersions[versionID] = version
+	return version.ReadCount, nil
+}
+
+func (r *secretRepo) CreateChunk(chunk *models.SecretChunk) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	chunk.ID = r.s.allocID("secret_chunks")
+	chunk.CreatedAt = time.Now()
+	r.s.secretChunks[chunk.ID] = *chunk
+	return nil
+}
+
+func (r *secretRepo) GetChunk(versionID uint, index int) (*models.SecretChunk, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, c := range r.s.secretChunks {
+		if c.SecretVersionID == versionID && c.ChunkIndex == index {
+			return &c, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *secretRepo) RecordKeyRead(versionID uint, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, read := range r.s.secretKeyReads {
+		if read.SecretVersionID == versionID && read.Key == key {
+			read.ReadCount++
+			read.LastReadAt = time.Now()
+			r.s.secretKeyReads[id] = read
+			return nil
+		}
+	}
+	id := r.s.allocID("secret_key_reads")
+	r.s.secretKeyReads[id] = models.SecretKeyRead{ID: id, SecretVersionID: versionID, Key: key, ReadCount: 1, LastReadAt: time.Now()}
+	return nil
+}
+
+func (r *secretRepo) GetKeyReads(versionID uint) ([]models.SecretKeyRead, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var reads []models.SecretKeyRead
+	for _, read := range r.s.secretKeyReads {
+		if read.SecretVersionID == versionID {
+			reads = append(reads, read)
+		}
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].Key < reads[j].Key })
+	return reads, nil
+}
+
+func (r *secretRepo) Delete(secretID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, v := range r.s.secretVersions {
+		if v.SecretNodeID == secretID {
+			for chunkID, c := range r.s.secretChunks {
+				if c.SecretVersionID == id {
+					delete(r.s.secretChunks, chunkID)
+				}
+			}
+			for readID, read := range r.s.secretKeyReads {
+				if read.SecretVersionID == id {
+					delete(r.s.secretKeyReads, readID)
+				}
+			}
+			delete(r.s.secretVersions, id)
+		}
+	}
+	for id, alias := range r.s.aliases {
+		if alias.SecretNodeID == secretID {
+			delete(r.s.aliases, id)
+		}
+	}
+	for id, grant := range r.s.grants {
+		if grant.SecretNodeID == secretID {
+			delete(r.s.grants, id)
+		}
+	}
+	delete(r.s.secretNodes, secretID)
+	return nil
+}
+
+type userRepo struct{ s *Storage }
+
+func (r *userRepo) Create(user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, u := range r.s.users {
+		if u.Username == user.Username {
+			return storage.ErrConflict
+		}
+	}
+	user.ID = r.s.allocID("users")
+	user.CreatedAt = time.Now()
+	r.s.users[user.ID] = *user
+	return nil
+}
+
+func (r *userRepo) FindByUsername(username string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if u.Username == username {
+			user := u
+			return &user, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *userRepo) FindByEmailIndex(emailIndex string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var found *models.User
+	for _, u := range r.s.users {
+		if u.EmailIndex == emailIndex && (found == nil || u.ID < found.ID) {
+			user := u
+			found = &user
+		}
+	}
+	if found == nil {
+		return nil, storage.ErrNotFound
+	}
+	return found, nil
+}
+
+func (r *userRepo) FindByID(id uint) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *userRepo) FindByIDs(ids []uint) ([]models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var users []models.User
+	for _, id := range ids {
+		if user, ok := r.s.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *userRepo) List() ([]models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.s.users))
+	for _, u := range r.s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *userRepo) ListAfter(afterID uint, limit int) ([]models.User, error) {
+	all, _ := r.List()
+
+	var users []models.User
+	for _, u := range all {
+		if u.ID <= afterID {
+			continue
+		}
+		users = append(users, u)
+		if limit > 0 && len(users) == limit {
+			break
+		}
+	}
+	return users, nil
+}
+
+func (r *userRepo) SetDeactivated(id uint, at *time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.DeactivatedAt = at
+	r.s.users[id] = user
+	return nil
+}
+
+func (r *userRepo) SetEmail(id uint, email, emailIndex string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.Email = email
+	user.EmailIndex = emailIndex
+	r.s.users[id] = user
+	return nil
+}
+
+func (r *userRepo) SetPasswordHash(id uint, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.PasswordHash = hash
+	r.s.users[id] = user
+	return nil
+}
+
+func (r *userRepo) SetTwoFactor(id uint, tf models.TwoFactor) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.TwoFactor = tf
+	r.s.users[id] = user
+	return nil
+}
+
+func (r *userRepo) Delete(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.users, id)
+	return nil
+}
+
+type sessionRepo struct{ s *Storage }
+
+func (r *sessionRepo) Create(session *models.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.sessions {
+		if existing.SessionToken == session.SessionToken {
+			return storage.ErrConflict
+		}
+	}
+	session.ID = r.s.allocID("sessions")
+	session.CreatedAt = time.Now()
+	r.s.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *sessionRepo) GetByToken(token string) (*models.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, existing := range r.s.sessions {
+		if subtle.ConstantTimeCompare([]byte(existing.SessionToken), []byte(token)) == 1 {
+			session := existing
+			return &session, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *sessionRepo) DeleteExpired() error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range r.s.sessions {
+		if session.ExpiresAt != nil && session.ExpiresAt.Before(now) {
+			delete(r.s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *sessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, session := range r.s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+func (r *sessionRepo) Touch(id uint, seenAt time.Time, ipAddress, userAgent string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	session.LastSeenAt = &seenAt
+	session.IPAddress, session.UserAgent = ipAddress, userAgent
+	r.s.sessions[id] = session
+	return nil
+}
+
+func (r *sessionRepo) SetElevated(id uint, until *time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	session.ElevatedUntil = until
+	r.s.sessions[id] = session
+	return nil
+}
+
+func (r *sessionRepo) Delete(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.sessions, id)
+	return nil
+}
+
+func (r *sessionRepo) DeleteOthers(userID, keepID uint) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var n int64
+	for id, session := range r.s.sessions {
+		if session.UserID == userID && id != keepID {
+			delete(r.s.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type auditRepo struct{ s *Storage }
+
+func (r *auditRepo) LogEvent(event *models.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	event.ID = r.s.allocID("audit_events")
+	r.s.auditEvents[event.ID] = *event
+	return nil
+}
+
+func (r *auditRepo) LogEvents(events []*models.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, event := range events {
+		event.ID = r.s.allocID("audit_events")
+		r.s.auditEvents[event.ID] = *event
+	}
+	return nil
+}
+
+func (r *auditRepo) ListByUser(userID uint) ([]models.AuditEvent, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for _, e := range r.s.auditEvents {
+		if e.UserID != nil && *e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *auditRepo) ListBetween(from, to time.Time) ([]models.AuditEvent, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for _, e := range r.s.auditEvents {
+		if !e.EventTime.Before(from) && e.EventTime.Before(to) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].EventTime.Equal(events[j].EventTime) {
+			return events[i].EventTime.Before(events[j].EventTime)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+func (r *auditRepo) ListAfter(q repository.AuditQuery) ([]models.AuditEvent, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for _, e := range r.s.auditEvents {
+		if q.Descending && q.AfterID != 0 && e.ID >= q.AfterID || !q.Descending && e.ID <= q.AfterID {
+			continue
+		}
+		if !q.From.IsZero() && e.EventTime.Before(q.From) || !q.To.IsZero() && !e.EventTime.Before(q.To) {
+			continue
+		}
+		if len(q.Types) > 0 && !slices.Contains(q.Types, e.EventType) {
+			continue
+		}
+		if q.UserID != 0 && (e.UserID == nil || *e.UserID != q.UserID) {
+			continue
+		}
+		if q.SecretID != 0 && (e.SecretNodeID == nil || *e.SecretNodeID != q.SecretID) {
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if q.Descending {
+			return events[i].ID > events[j].ID
+		}
+		return events[i].ID < events[j].ID
+	})
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[:q.Limit]
+	}
+	return events, nil
+}
+
+type configRepo struct{ s *Storage }
+
+func (r *configRepo) Get(key string) (string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.s.configuration[key], nil
+}
+
+func (r *configRepo) Set(key string, value string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.configuration[key] = value
+	return nil
+}
+
+type scopeRepo struct{ s *Storage }
+
+func (r *scopeRepo) CreateNamespace(namespace *models.Namespace) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, n := range r.s.namespaces {
+		if n.Name == namespace.Name {
+			return storage.ErrConflict
+		}
+	}
+	namespace.ID = r.s.allocID("namespaces")
+	namespace.CreatedAt = time.Now()
+	namespace.UpdatedAt = namespace.CreatedAt
+	r.s.namespaces[namespace.ID] = *namespace
+	return nil
+}
+
+func (r *scopeRepo) ListNamespaces() ([]models.Namespace, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	namespaces := make([]models.Namespace, 0, len(r.s.namespaces))
+	for _, n := range r.s.namespaces {
+		namespaces = append(namespaces, n)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].ID < namespaces[j].ID })
+	return namespaces, nil
+}
+
+func (r *scopeRepo) CreateZone(zone *models.Zone) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, z := range r.s.zones {
+		if z.Name == zone.Name {
+			return storage.ErrConflict
+		}
+	}
+	zone.ID = r.s.allocID("zones")
+	zone.CreatedAt = time.Now()
+	zone.UpdatedAt = zone.CreatedAt
+	r.s.zones[zone.ID] = *zone
+	return nil
+}
+
+func (r *scopeRepo) ListZones() ([]models.Zone, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	zones := make([]models.Zone, 0, len(r.s.zones))
+	for _, z := range r.s.zones {
+		zones = append(zones, z)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ID < zones[j].ID })
+	return zones, nil
+}
+
+func (r *scopeRepo) CreateEnvironment(environment *models.Environment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, e := range r.s.environments {
+		if e.Name == environment.Name {
+			return storage.ErrConflict
+		}
+	}
+	environment.ID = r.s.allocID("environments")
+	r.s.environments[environment.ID] = *environment
+	return nil
+}
+
+func (r *scopeRepo) ListEnvironments() ([]models.Environment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	environments := make([]models.Environment, 0, len(r.s.environments))
+	for _, e := range r.s.environments {
+		environments = append(environments, e)
+	}
+	sort.Slice(environments, func(i, j int) bool { return environments[i].ID < environments[j].ID })
+	return environments, nil
+}
+
+type operationRepo struct{ s *Storage }
+
+func (r *operationRepo) Create(op *models.PendingOperation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	op.ID = r.s.allocID("pending_operations")
+	op.CreatedAt = time.Now()
+	if op.Status == "" {
+		op.Status = "pending"
+	}
+	r.s.operations[op.ID] = *op
+	return nil
+}
+
+func (r *operationRepo) GetByID(id uint) (*models.PendingOperation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	op, ok := r.s.operations[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &op, nil
+}
+
+func (r *operationRepo) List(status string) ([]models.PendingOperation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var ops []models.PendingOperation
+	for _, op := range r.s.operations {
+		if status == "" || op.Status == status {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+	return ops, nil
+}
+
+func (r *operationRepo) Update(op *models.PendingOperation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.operations[op.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.operations[op.ID] = *op
+	return nil
+}
+
+func (r *operationRepo) UpdateIfPending(op *models.PendingOperation) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.operations[op.ID]
+	if !ok || stored.Status != "pending" {
+		return false, nil
+	}
+	stored.Status, stored.DecidedBy, stored.DecidedAt, stored.Reason = op.Status, op.DecidedBy, op.DecidedAt, op.Reason
+	r.s.operations[op.ID] = stored
+	return true, nil
+}
+
+type checkoutRepo struct{ s *Storage }
+
+func (r *checkoutRepo) Create(co *models.SecretCheckout) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	co.ID = r.s.allocID("secret_checkouts")
+	r.s.checkouts[co.ID] = *co
+	return nil
+}
+
+func (r *checkoutRepo) Active(secretID uint) (*models.SecretCheckout, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var active *models.SecretCheckout
+	for _, co := range r.s.checkouts {
+		if co.SecretNodeID == secretID && co.CheckedInAt == nil && (active == nil || co.ID > active.ID) {
+			co := co
+			active = &co
+		}
+	}
+	if active == nil {
+		return nil, storage.ErrNotFound
+	}
+	return active, nil
+}
+
+func (r *checkoutRepo) Update(co *models.SecretCheckout) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.checkouts[co.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.checkouts[co.ID] = *co
+	return nil
+}
+
+func (r *checkoutRepo) ListBySecret(secretID uint) ([]models.SecretCheckout, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var checkouts []models.SecretCheckout
+	for _, co := range r.s.checkouts {
+		if co.SecretNodeID == secretID {
+			checkouts = append(checkouts, co)
+		}
+	}
+	sort.Slice(checkouts, func(i, j int) bool { return checkouts[i].ID < checkouts[j].ID })
+	return checkouts, nil
+}
+
+type releaseRepo struct{ s *Storage }
+
+func (r *releaseRepo) Create(release *models.SecretRelease) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	release.ID = r.s.allocID("secret_releases")
+	if release.CreatedAt.IsZero() {
+		release.CreatedAt = time.Now()
+	}
+	r.s.releases[release.ID] = *release
+	return nil
+}
+
+func (r *releaseRepo) Get(id uint) (*models.SecretRelease, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	release, ok := r.s.releases[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &release, nil
+}
+
+func (r *releaseRepo) Update(release *models.SecretRelease) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.releases[release.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.releases[release.ID] = *release
+	return nil
+}
+
+func (r *releaseRepo) ListBySecret(secretID uint) ([]models.SecretRelease, error) {
+	return r.list(func(release models.SecretRelease) bool { return release.SecretNodeID == secretID })
+}
+
+func (r *releaseRepo) ListByStatus(status string) ([]models.SecretRelease, error) {
+	return r.list(func(release models.SecretRelease) bool { return release.Status == status })
+}
+
+func (r *releaseRepo) list(match func(models.SecretRelease) bool) ([]models.SecretRelease, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var releases []models.SecretRelease
+	for _, release := range r.s.releases {
+		if match(release) {
+			releases = append(releases, release)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].ID < releases[j].ID })
+	return releases, nil
+}
+
+type escrowRepo struct{ s *Storage }
+
+func (r *escrowRepo) SetCustodian(custodian *models.EscrowCustodian) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	custodian.UpdatedAt = time.Now()
+	r.s.custodians[custodian.UserID] = *custodian
+	return nil
+}
+
+func (r *escrowRepo) GetCustodian(userID uint) (*models.EscrowCustodian, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	custodian, ok := r.s.custodians[userID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &custodian, nil
+}
+
+func (r *escrowRepo) Create(escrow *models.Escrow, shares []models.EscrowShare) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	escrow.ID = r.s.allocID("escrows")
+	if escrow.CreatedAt.IsZero() {
+		escrow.CreatedAt = time.Now()
+	}
+	r.s.escrows[escrow.ID] = *escrow
+	for i := range shares {
+		shares[i].ID = r.s.allocID("escrow_shares")
+		shares[i].EscrowID = escrow.ID
+		r.s.escrowShares[shares[i].ID] = shares[i]
+	}
+	return nil
+}
+
+func (r *escrowRepo) Get(id uint) (*models.Escrow, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	escrow, ok := r.s.escrows[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &escrow, nil
+}
+
+func (r *escrowRepo) ListBySecret(secretID uint) ([]models.Escrow, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var escrows []models.Escrow
+	for _, escrow := range r.s.escrows {
+		if escrow.SecretNodeID == secretID {
+			escrows = append(escrows, escrow)
+		}
+	}
+	sort.Slice(escrows, func(i, j int) bool { return escrows[i].ID < escrows[j].ID })
+	return escrows, nil
+}
+
+func (r *escrowRepo) ListShares(escrowID uint) ([]models.EscrowShare, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var shares []models.EscrowShare
+	for _, share := range r.s.escrowShares {
+		if share.EscrowID == escrowID {
+			shares = append(shares, share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].ID < shares[j].ID })
+	return shares, nil
+}
+
+func (r *escrowRepo) CreateRecovery(recovery *models.EscrowRecovery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	recovery.ID = r.s.allocID("escrow_recoveries")
+	if recovery.CreatedAt.IsZero() {
+		recovery.CreatedAt = time.Now()
+	}
+	r.s.recoveries[recovery.ID] = *recovery
+	return nil
+}
+
+func (r *escrowRepo) GetRecovery(id uint) (*models.EscrowRecovery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	recovery, ok := r.s.recoveries[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &recovery, nil
+}
+
+func (r *escrowRepo) UpdateRecovery(recovery *models.EscrowRecovery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.recoveries[recovery.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.recoveries[recovery.ID] = *recovery
+	return nil
+}
+
+func (r *escrowRepo) ListRecoveries(escrowID uint) ([]models.EscrowRecovery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var recoveries []models.EscrowRecovery
+	for _, recovery := range r.s.recoveries {
+		if recovery.EscrowID == escrowID {
+			recoveries = append(recoveries, recovery)
+		}
+	}
+	sort.Slice(recoveries, func(i, j int) bool { return recoveries[i].ID < recoveries[j].ID })
+	return recoveries, nil
+}
+
+func (r *escrowRepo) AppendLog(entry *models.EscrowLogEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	entry.ID = r.s.allocID("escrow_log_entries")
+	r.s.escrowLog[entry.ID] = *entry
+	return nil
+}
+
+func (r *escrowRepo) LastLog() (*models.EscrowLogEntry, error) {
+	entries, err := r.ListLog()
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[len(entries)-1], nil
+}
+
+func (r *escrowRepo) ListLog() ([]models.EscrowLogEntry, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	entries := make([]models.EscrowLogEntry, 0, len(r.s.escrowLog))
+	for _, entry := range r.s.escrowLog {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+type aliasRepo struct{ s *Storage }
+
+func (r *aliasRepo) Create(alias *models.SecretAlias) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	alias.ID = r.s.allocID("secret_aliases")
+	alias.CreatedAt = time.Now()
+	r.s.aliases[alias.ID] = *alias
+	return nil
+}
+
+func (r *aliasRepo) FindByNameKey(nameKey string) ([]models.SecretAlias, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var aliases []models.SecretAlias
+	for _, alias := range r.s.aliases {
+		if alias.NameKey == nameKey {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].ID > aliases[j].ID })
+	return aliases, nil
+}
+
+func (r *aliasRepo) List() ([]models.SecretAlias, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	aliases := make([]models.SecretAlias, 0, len(r.s.aliases))
+	for _, alias := range r.s.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].ID < aliases[j].ID })
+	return aliases, nil
+}
+
+func (r *aliasRepo) SetNameKey(id uint, nameKey string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	alias, ok := r.s.aliases[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	alias.NameKey = nameKey
+	r.s.aliases[id] = alias
+	return nil
+}
+
+func (r *aliasRepo) ListBySecret(secretID uint) ([]models.SecretAlias, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var aliases []models.SecretAlias
+	for _, alias := range r.s.aliases {
+		if alias.SecretNodeID == secretID {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].ID < aliases[j].ID })
+	return aliases, nil
+}
+
+type grantRepo struct{ s *Storage }
+
+func (r *grantRepo) Set(grant *models.SecretGrant) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range r.s.grants {
+		if existing.SecretNodeID == grant.SecretNodeID && existing.UserID == grant.UserID {
+			existing.Level, existing.GrantedBy, existing.UpdatedAt = grant.Level, grant.GrantedBy, now
+			r.s.grants[id] = existing
+			*grant = existing
+			return nil
+		}
+	}
+	grant.ID = r.s.allocID("secret_grants")
+	grant.CreatedAt, grant.UpdatedAt = now, now
+	r.s.grants[grant.ID] = *grant
+	return nil
+}
+
+func (r *grantRepo) Delete(nodeID, userID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, grant := range r.s.grants {
+		if grant.SecretNodeID == nodeID && grant.UserID == userID {
+			delete(r.s.grants, id)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+func (r *grantRepo) ListByNode(nodeID uint) ([]models.SecretGrant, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var grants []models.SecretGrant
+	for _, grant := range r.s.grants {
+		if grant.SecretNodeID == nodeID {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].ID < grants[j].ID })
+	return grants, nil
+}
+
+func (r *grantRepo) ListByNodes(nodeIDs []uint) ([]models.SecretGrant, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(nodeIDs))
+	for _, id := range nodeIDs {
+		wanted[id] = true
+	}
+	var grants []models.SecretGrant
+	for _, grant := range r.s.grants {
+		if wanted[grant.SecretNodeID] {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].ID < grants[j].ID })
+	return grants, nil
+}
+
+func (r *grantRepo) HasFolderGrants() (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, grant := range r.s.grants {
+		if node, ok := r.s.secretNodes[grant.SecretNodeID]; ok && !node.IsSecret {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type exportProfileRepo struct{ s *Storage }
+
+func (r *exportProfileRepo) Save(profile *models.ExportProfile) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range r.s.exports {
+		if existing.Name == profile.Name {
+			profile.ID, profile.CreatedAt, profile.UpdatedAt = id, existing.CreatedAt, now
+			r.s.exports[id] = *profile
+			return nil
+		}
+	}
+	profile.ID = r.s.allocID("export_profiles")
+	profile.CreatedAt, profile.UpdatedAt = now, now
+	r.s.exports[profile.ID] = *profile
+	return nil
+}
+
+func (r *exportProfileRepo) FindByName(name string) (*models.ExportProfile, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, profile := range r.s.exports {
+		if profile.Name == name {
+			return &profile, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *exportProfileRepo) List() ([]models.ExportProfile, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	profiles := make([]models.ExportProfile, 0, len(r.s.exports))
+	for _, profile := range r.s.exports {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+func (r *exportProfileRepo) Delete(name string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, profile := range r.s.exports {
+		if profile.Name == name {
+			delete(r.s.exports, id)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+type rbacRepo struct{ s *Storage }
+
+func (r *rbacRepo) ListRoles() ([]models.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	roles := make([]models.Role, 0, len(r.s.roles))
+	for _, role := range r.s.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *rbacRepo) SaveRole(role *models.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, existing := range r.s.roles {
+		if existing.Name == role.Name {
+			role.ID = id
+			r.s.roles[id] = *role
+			return nil
+		}
+	}
+	role.ID = r.s.allocID("roles")
+	r.s.roles[role.ID] = *role
+	return nil
+}
+
+func (r *rbacRepo) DeleteRole(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.roles[id]; !ok {
+		return storage.ErrNotFound
+	}
+	for key := range r.s.userRoles {
+		if key[1] == id {
+			delete(r.s.userRoles, key)
+		}
+	}
+	for key := range r.s.groupRoles {
+		if key[1] == id {
+			delete(r.s.groupRoles, key)
+		}
+	}
+	delete(r.s.roles, id)
+	return nil
+}
+
+func (r *rbacRepo) ListGroups() ([]models.Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	groups := make([]models.Group, 0, len(r.s.groups))
+	for _, group := range r.s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (r *rbacRepo) SaveGroup(group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, existing := range r.s.groups {
+		if existing.Name == group.Name {
+			group.ID = id
+			r.s.groups[id] = *group
+			return nil
+		}
+	}
+	group.ID = r.s.allocID("groups")
+	r.s.groups[group.ID] = *group
+	return nil
+}
+
+func (r *rbacRepo) DeleteGroup(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.groups[id]; !ok {
+		return storage.ErrNotFound
+	}
+	for key := range r.s.members {
+		if key[0] == id {
+			delete(r.s.members, key)
+		}
+	}
+	for key := range r.s.groupRoles {
+		if key[0] == id {
+			delete(r.s.groupRoles, key)
+		}
+	}
+	delete(r.s.groups, id)
+	return nil
+}
+
+func (r *rbacRepo) ListMembers() ([]models.UserGroup, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	members := make([]models.UserGroup, 0, len(r.s.members))
+	for _, member := range r.s.members {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].GroupID != members[j].GroupID {
+			return members[i].GroupID < members[j].GroupID
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+func (r *rbacRepo) AddMember(member *models.UserGroup) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.members[[2]uint{member.GroupID, member.UserID}] = *member
+	return nil
+}
+
+func (r *rbacRepo) RemoveMember(member *models.UserGroup) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.members, [2]uint{member.GroupID, member.UserID})
+	return nil
+}
+
+func (r *rbacRepo) ListUserRoles() ([]models.UserRole, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	assignments := make([]models.UserRole, 0, len(r.s.userRoles))
+	for _, assignment := range r.s.userRoles {
+		assignments = append(assignments, assignment)
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].UserID != assignments[j].UserID {
+			return assignments[i].UserID < assignments[j].UserID
+		}
+		return assignments[i].RoleID < assignments[j].RoleID
+	})
+	return assignments, nil
+}
+
+func (r *rbacRepo) AssignUserRole(assignment *models.UserRole) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.userRoles[[2]uint{assignment.UserID, assignment.RoleID}] = *assignment
+	return nil
+}
+
+func (r *rbacRepo) UnassignUserRole(assignment *models.UserRole) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.userRoles, [2]uint{assignment.UserID, assignment.RoleID})
+	return nil
+}
+
+func (r *rbacRepo) ListGroupRoles() ([]models.GroupRole, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	assignments := make([]models.GroupRole, 0, len(r.s.groupRoles))
+	for _, assignment := range r.s.groupRoles {
+		assignments = append(assignments, assignment)
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].GroupID != assignments[j].GroupID {
+			return assignments[i].GroupID < assignments[j].GroupID
+		}
+		return assignments[i].RoleID < assignments[j].RoleID
+	})
+	return assignments, nil
+}
+
+func (r *rbacRepo) AssignGroupRole(assignment *models.GroupRole) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.groupRoles[[2]uint{assignment.GroupID, assignment.RoleID}] = *assignment
+	return nil
+}
+
+func (r *rbacRepo) UnassignGroupRole(assignment *models.GroupRole) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.groupRoles, [2]uint{assignment.GroupID, assignment.RoleID})
+	return nil
+}
+
+func (r *rbacRepo) ListDenyRules() ([]models.DenyRule, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	rules := make([]models.DenyRule, 0, len(r.s.denyRules))
+	for _, rule := range r.s.denyRules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+func (r *rbacRepo) SaveDenyRule(rule *models.DenyRule) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range r.s.denyRules {
+		if existing.Name == rule.Name {
+			rule.ID, rule.CreatedAt, rule.UpdatedAt = id, existing.CreatedAt, now
+			r.s.denyRules[id] = *rule
+			return nil
+		}
+	}
+	rule.ID = r.s.allocID("deny_rules")
+	rule.CreatedAt, rule.UpdatedAt = now, now
+	r.s.denyRules[rule.ID] = *rule
+	return nil
+}
+
+func (r *rbacRepo) DeleteDenyRule(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.denyRules[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(r.s.denyRules, id)
+	return nil
+}
+
+func (r *rbacRepo) LogChange(change *models.RBACChangeLog) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	change.ID = r.s.allocID("rbac_change_logs")
+	r.s.rbacChanges[change.ID] = *change
+	return nil
+}
+
+func (r *rbacRepo) ListChanges(q repository.RBACChangeQuery) ([]models.RBACChangeLog, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var changes []models.RBACChangeLog
+	for _, ch := range r.s.rbacChanges {
+		if q.AfterID != 0 && ch.ID >= q.AfterID {
+			continue
+		}
+		if !q.From.IsZero() && ch.ChangedAt.Before(q.From) || !q.To.IsZero() && !ch.ChangedAt.Before(q.To) {
+			continue
+		}
+		if q.Kind != "" && ch.Kind != q.Kind || q.Name != "" && ch.Name != q.Name || q.Actor != "" && ch.Actor != q.Actor {
+			continue
+		}
+		changes = append(changes, ch)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID > changes[j].ID })
+	if q.Limit > 0 && len(changes) > q.Limit {
+		changes = changes[:q.Limit]
+	}
+	return changes, nil
+}
+
+type serviceAccountRepo struct{ s *Storage }
+
+func (r *serviceAccountRepo) Create(account *models.ServiceAccount) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.services {
+		if existing.UserID == account.UserID {
+			return storage.ErrConflict
+		}
+	}
+	account.ID = r.s.allocID("service_accounts")
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = time.Now()
+	}
+	r.s.services[account.ID] = *account
+	return nil
+}
+
+func (r *serviceAccountRepo) GetByUserID(userID uint) (*models.ServiceAccount, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, account := range r.s.services {
+		if account.UserID == userID {
+			return &account, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *serviceAccountRepo) List() ([]models.ServiceAccount, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	accounts := make([]models.ServiceAccount, 0, len(r.s.services))
+	for _, account := range r.s.services {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+type passwordResetRepo struct{ s *Storage }
+
+func (r *passwordResetRepo) Create(reset *models.PasswordReset) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.passwordResets {
+		if existing.Token == reset.Token {
+			return storage.ErrConflict
+		}
+	}
+	reset.ID = r.s.allocID("password_resets")
+	reset.CreatedAt = time.Now()
+	r.s.passwordResets[reset.ID] = *reset
+	return nil
+}
+
+func (r *passwordResetRepo) GetByToken(token string) (*models.PasswordReset, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, existing := range r.s.passwordResets {
+		if subtle.ConstantTimeCompare([]byte(existing.Token), []byte(token)) == 1 {
+			reset := existing
+			return &reset, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *passwordResetRepo) Consume(token string, now time.Time) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, existing := range r.s.passwordResets {
+		if subtle.ConstantTimeCompare([]byte(existing.Token), []byte(token)) == 1 {
+			if existing.ExpiresAt != nil && !existing.ExpiresAt.After(now) {
+				return false, nil
+			}
+			delete(r.s.passwordResets, id)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *passwordResetRepo) CountSince(userID uint, since time.Time) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var n int64
+	for _, reset := range r.s.passwordResets {
+		if reset.UserID == userID && !reset.CreatedAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *passwordResetRepo) DeleteByUser(userID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, reset := range r.s.passwordResets {
+		if reset.UserID == userID {
+			delete(r.s.passwordResets, id)
+		}
+	}
+	return nil
+}
+
+type passkeyRepo struct{ s *Storage }
+
+func (r *passkeyRepo) Create(cred *models.WebAuthnCredential) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.passkeys {
+		if bytes.Equal(existing.CredentialID, cred.CredentialID) {
+			return storage.ErrConflict
+		}
+	}
+	cred.ID = r.s.allocID("web_authn_credentials")
+	cred.CreatedAt = time.Now()
+	r.s.passkeys[cred.ID] = *cred
+	return nil
+}
+
+func (r *passkeyRepo) ListByUser(userID uint) ([]models.WebAuthnCredential, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var creds []models.WebAuthnCredential
+	for _, cred := range r.s.passkeys {
+		if cred.UserID == userID {
+			creds = append(creds, cred)
+		}
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].ID < creds[j].ID })
+	return creds, nil
+}
+
+func (r *passkeyRepo) GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, existing := range r.s.passkeys {
+		if bytes.Equal(existing.CredentialID, credentialID) {
+			cred := existing
+			return &cred, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *passkeyRepo) RecordUse(id uint, signCount uint32, usedAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cred, ok := r.s.passkeys[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	cred.SignCount, cred.LastUsedAt = signCount, &usedAt
+	r.s.passkeys[id] = cred
+	return nil
+}
+
+func (r *passkeyRepo) Delete(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.passkeys, id)
+	return nil
+}
+
+type apiClientRepo struct{ s *Storage }
+
+func (r *apiClientRepo) Create(client *models.APIClient) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.apiClients {
+		if existing.ClientID == client.ClientID {
+			return storage.ErrConflict
+		}
+	}
+	client.ID = r.s.allocID("api_clients")
+	client.CreatedAt = time.Now()
+	r.s.apiClients[client.ID] = *client
+	return nil
+}
+
+func (r *apiClientRepo) GetByClientID(clientID string) (*models.APIClient, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, existing := range r.s.apiClients {
+		if existing.ClientID == clientID {
+			client := existing
+			return &client, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *apiClientRepo) ListByUser(userID uint) ([]models.APIClient, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var clients []models.APIClient
+	for _, client := range r.s.apiClients {
+		if client.UserID == userID {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func (r *apiClientRepo) Update(client *models.APIClient) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.apiClients[client.ID]; !ok {
+		return storage.ErrNotFound
+	}
+	r.s.apiClients[client.ID] = *client
+	return nil
+}
+
+func (r *apiClientRepo) RecordUse(id uint, usedAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	client, ok := r.s.apiClients[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	client.LastUsedAt = &usedAt
+	r.s.apiClients[id] = client
+	return nil
+}
+
+func (r *apiClientRepo) Delete(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.apiClients, id)
+	return nil
+}
+
+type deviceRepo struct{ s *Storage }
+
+func (r *deviceRepo) CreateToken(token *models.DeviceEnrollmentToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token.ID = r.s.allocID("device_enrollment_tokens")
+	token.CreatedAt = time.Now()
+	r.s.deviceTokens[token.ID] = *token
+	return nil
+}
+
+func (r *deviceRepo) ConsumeToken(tokenHash string, usedAt time.Time) (*models.DeviceEnrollmentToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.deviceTokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(usedAt) {
+			token.UsedAt = &usedAt
+			r.s.deviceTokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *deviceRepo) Create(device *models.Device) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.devices {
+		if existing.Fingerprint == device.Fingerprint {
+			return storage.ErrConflict
+		}
+	}
+	device.ID = r.s.allocID("devices")
+	device.CreatedAt = time.Now()
+	r.s.devices[device.ID] = *device
+	return nil
+}
+
+func (r *deviceRepo) GetByID(id uint) (*models.Device, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	device, ok := r.s.devices[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &device, nil
+}
+
+func (r *deviceRepo) GetByFingerprint(fingerprint string) (*models.Device, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, existing := range r.s.devices {
+		if existing.Fingerprint == fingerprint {
+			device := existing
+			return &device, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *deviceRepo) List() ([]models.Device, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	devices := make([]models.Device, 0, len(r.s.devices))
+	for _, device := range r.s.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
+
+func (r *deviceRepo) RecordUse(id uint, usedAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	device, ok := r.s.devices[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	device.LastSeenAt = &usedAt
+	r.s.devices[id] = device
+	return nil
+}
+
+func (r *deviceRepo) Revoke(id uint, revokedAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	device, ok := r.s.devices[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if device.RevokedAt == nil {
+		device.RevokedAt = &revokedAt
+		r.s.devices[id] = device
+	}
+	return nil
+}
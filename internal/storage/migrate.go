@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SchemaVersion is the number of the latest migration in migrations/.
+// Migrate records it in system_metadata under SchemaVersionKey; bump it
+// with every new migration.
+const SchemaVersion = 36
+
+// SchemaVersionKey is the system_metadata key of the schema version
+const SchemaVersionKey = "schema_version"
+
+// Models lists every persistent model in migration order
+func Models() []interface{} {
+	return []interface{}{
+		&models.Namespace{},
+		&models.Zone{},
+		&models.Environment{},
+		&models.User{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.Group{},
+		&models.UserGroup{},
+		&models.GroupRole{},
+		&models.DenyRule{},
+		&models.RBACChangeLog{},
+		&models.ServiceAccount{},
+		&models.SecretNode{},
+		&models.SecretVersion{},
+		&models.SecretChunk{},
+		&models.SecretKeyRead{},
+		&models.SecretAccessLog{},
+		&models.SecretMetadataHistory{},
+		&models.Session{},
+		&models.PasswordReset{},
+		&models.WebAuthnCredential{},
+		&models.DeviceEnrollmentToken{},
+		&models.Device{},
+		&models.Tag{},
+		&models.SecretTag{},
+		&models.Notification{},
+		&models.AuditEvent{},
+		&models.PendingOperation{},
+		&models.SecretCheckout{},
+		&models.SecretRelease{},
+		&models.EscrowCustodian{},
+		&models.Escrow{},
+		&models.EscrowShare{},
+		&models.EscrowRecovery{},
+		&models.EscrowLogEntry{},
+		&models.SecretAlias{},
+		&models.SecretGrant{},
+		&models.ExportProfile{},
+		&models.Setting{},
+		&models.SystemMetadata{},
+		&repository.Configuration{},
+		&models.APIClient{},
+		&models.APIToken{},
+		&models.RateLimit{},
+		&models.APICallLog{},
+		&models.GRPCService{},
+		&models.IdentityProvider{},
+		&models.ExternalIdentity{},
+	}
+}
+
+// Migrate applies schema migrations for all models, then the data
+// migrations, which are safe to repeat, and records the schema version
+func Migrate(db *gorm.DB) error {
+	if err := renumberVersions(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(Models()...); err != nil {
+		return err
+	}
+	if err := backfillSecretOwners(db); err != nil {
+		return err
+	}
+	return db.Save(&models.SystemMetadata{Key: SchemaVersionKey, Value: strconv.Itoa(SchemaVersion)}).Error
+}
+
+// backfillSecretOwners makes users the owners of the secrets they created
+// before owners were recorded (see migrations/019_backfill_secret_owner.sql)
+func backfillSecretOwners(db *gorm.DB) error {
+	return db.Model(&models.SecretNode{}).
+		Where("(owner IS NULL OR owner = '') AND created_by IN (?)", db.Model(&models.User{}).Select("username")).
+		Update("owner", gorm.Expr("created_by")).Error
+}
+
+// renumberVersions gives the versions of secrets where concurrent updates
+// took the same number consecutive numbers in creation order, so that the
+// unique index can be created (see migrations/033_unique_version_numbers.sql)
+func renumberVersions(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.SecretVersion{}) {
+		return nil
+	}
+	duplicated := db.Model(&models.SecretVersion{}).Select("secret_node_id").
+		Group("secret_node_id, version_number").Having("COUNT(*) > 1")
+	return db.Model(&models.SecretVersion{}).Where("secret_node_id IN (?)", duplicated).
+		Update("version_number", gorm.Expr("(SELECT COUNT(*) FROM secret_versions AS earlier"+
+			" WHERE earlier.secret_node_id = secret_versions.secret_node_id AND earlier.id <= secret_versions.id)")).Error
+}
+
+// OpenSQLite opens the SQLite database at path and applies migrations
+func OpenSQLite(path string) (*gorm.DB, error) {
+	// TranslateError turns unique constraint violations into ErrConflict
+	db, err := gorm.Open(sqlite.Open(filepath.Clean(path)), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return db, nil
+}
+
+// OpenSQLiteReadOnly opens the SQLite database at path for reading only,
+// without migrations, e.g. a replica kept up to date by another process
+func OpenSQLiteReadOnly(path string) (*gorm.DB, error) {
+	dsn := "file:" + filepath.ToSlash(filepath.Clean(path)) + "?mode=ro"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,730 @@
+// Package mock provides configurable test doubles for the storage repositories.
+// Every method delegates to the matching ...Func field; calling a method whose
+// field is nil panics so that unexpected storage access fails the test loudly.
+package mock
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// Storage is a storage.Storage whose repositories are supplied by the test
+type Storage struct {
+	SecretRepo  *SecretRepository
+	UserRepo    *UserRepository
+	SessionRepo *SessionRepository
+	AuditRepo   *AuditRepository
+	ConfigRepo  *ConfigRepository
+	ScopeRepo   *ScopeRepository
+	OpRepo      *OperationRepository
+	ResetRepo   *PasswordResetRepository
+	PasskeyRepo *WebAuthnCredentialRepository
+	ClientRepo  *APIClientRepository
+	DeviceRepo  *DeviceRepository
+	LeaseRepo   *CheckoutRepository
+	AliasRepo   *AliasRepository
+	GrantRepo   *GrantRepository
+	ExportRepo  *ExportProfileRepository
+	RBACRepo    *RBACRepository
+	ServiceRepo *ServiceAccountRepository
+	ReleaseRepo *ReleaseRepository
+	EscrowRepo  *EscrowRepository
+
+	// WithTransactionFunc replaces WithTransaction, which otherwise runs fn
+	// on the mock storage itself
+	WithTransactionFunc func(fn func(tx storage.Storage) error) error
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+// NewStorage creates a mock storage with empty repositories
+func NewStorage() *Storage {
+	return &Storage{
+		SecretRepo:  &SecretRepository{},
+		UserRepo:    &UserRepository{},
+		SessionRepo: &SessionRepository{},
+		AuditRepo:   &AuditRepository{},
+		ConfigRepo:  &ConfigRepository{},
+		ScopeRepo:   &ScopeRepository{},
+		OpRepo:      &OperationRepository{},
+		ResetRepo:   &PasswordResetRepository{},
+		PasskeyRepo: &WebAuthnCredentialRepository{},
+		ClientRepo:  &APIClientRepository{},
+		DeviceRepo:  &DeviceRepository{},
+		LeaseRepo:   &CheckoutRepository{},
+		AliasRepo:   &AliasRepository{},
+		GrantRepo:   &GrantRepository{},
+		ExportRepo:  &ExportProfileRepository{},
+		RBACRepo:    &RBACRepository{},
+		ServiceRepo: &ServiceAccountRepository{},
+		ReleaseRepo: &ReleaseRepository{},
+		EscrowRepo:  &EscrowRepository{},
+	}
+}
+
+// Secrets returns the mock secret repository
+func (s *Storage) Secrets() repository.SecretRepository { return s.SecretRepo }
+
+// Users returns the mock user repository
+func (s *Storage) Users() repository.UserRepository { return s.UserRepo }
+
+// Sessions returns the mock session repository
+func (s *Storage) Sessions() repository.SessionRepository { return s.SessionRepo }
+
+// Audit returns the mock audit repository
+func (s *Storage) Audit() repository.AuditRepository { return s.AuditRepo }
+
+// Config returns the mock configuration repository
+func (s *Storage) Config() repository.ConfigRepository { return s.ConfigRepo }
+
+// Scopes returns the mock scope repository
+func (s *Storage) Scopes() repository.ScopeRepository { return s.ScopeRepo }
+
+// Checkouts returns the mock secret checkout repository
+func (s *Storage) Checkouts() repository.CheckoutRepository { return s.LeaseRepo }
+
+// Aliases returns the mock secret alias repository
+func (s *Storage) Aliases() repository.AliasRepository { return s.AliasRepo }
+
+// Grants returns the mock secret grant repository
+func (s *Storage) Grants() repository.GrantRepository { return s.GrantRepo }
+
+// ExportProfiles returns the mock export profile repository
+func (s *Storage) ExportProfiles() repository.ExportProfileRepository { return s.ExportRepo }
+
+// RBAC returns the mock role and group repository
+func (s *Storage) RBAC() repository.RBACRepository { return s.RBACRepo }
+
+// ServiceAccounts returns the mock service account repository
+func (s *Storage) ServiceAccounts() repository.ServiceAccountRepository { return s.ServiceRepo }
+
+// Releases returns the mock scheduled release repository
+func (s *Storage) Releases() repository.ReleaseRepository { return s.ReleaseRepo }
+
+// Escrows returns the mock escrow repository
+func (s *Storage) Escrows() repository.EscrowRepository { return s.EscrowRepo }
+
+// Operations returns the mock pending operation repository
+func (s *Storage) Operations() repository.OperationRepository { return s.OpRepo }
+
+// PasswordResets returns the mock password reset repository
+func (s *Storage) PasswordResets() repository.PasswordResetRepository { return s.ResetRepo }
+
+// WebAuthnCredentials returns the mock passkey repository
+func (s *Storage) WebAuthnCredentials() repository.WebAuthnCredentialRepository {
+	return s.PasskeyRepo
+}
+
+// APIClients returns the mock API client repository
+func (s *Storage) APIClients() repository.APIClientRepository { return s.ClientRepo }
+
+// Devices returns the mock device repository
+func (s *Storage) Devices() repository.DeviceRepository { return s.DeviceRepo }
+
+// WithTransaction calls WithTransactionFunc if set and fn otherwise
+func (s *Storage) WithTransaction(fn func(tx storage.Storage) error) error {
+	if s.WithTransactionFunc != nil {
+		return s.WithTransactionFunc(fn)
+	}
+	return fn(s)
+}
+
+// SecretRepository is a mock repository.SecretRepository
+type SecretRepository struct {
+	CreateFunc               func(secret *models.SecretNode) error
+	GetByIDFunc              func(id uint) (*models.SecretNode, error)
+	GetByIDsFunc             func(ids []uint) ([]models.SecretNode, error)
+	ListFunc                 func() ([]models.SecretNode, error)
+	ListAfterFunc            func(q repository.SecretQuery) ([]models.SecretNode, error)
+	QueryFunc                func(q repository.SecretQuery) ([]models.SecretNode, error)
+	CountFunc                func(q repository.SecretQuery) (int64, error)
+	FindByNameKeyFunc        func(namespaceID, zoneID, environmentID uint, nameKey string) (*models.SecretNode, error)
+	ListChildrenFunc         func(parentID uint) ([]models.SecretNode, error)
+	UpdateFunc               func(secret *models.SecretNode) error
+	TouchFunc                func(id uint, updatedAt time.Time) (bool, error)
+	GetVersionsFunc          func(secretID uint) ([]models.SecretVersion, error)
+	CreateVersionFunc        func(version *models.SecretVersion) error
+	UpdateVersionFunc        func(version *models.SecretVersion) error
+	UpdateVersionContentFunc func(version *models.SecretVersion) error
+	ConsumeReadFunc          func(versionID uint, maxReads *int) (int, error)
+	CreateChunkFunc          func(chunk *models.SecretChunk) error
+	GetChunkFunc             func(versionID uint, index int) (*models.SecretChunk, error)
+	RecordKeyReadFunc        func(versionID uint, key string) error
+	GetKeyReadsFunc          func(versionID uint) ([]models.SecretKeyRead, error)
+	DeleteFunc               func(secretID uint) error
+}
+
+var _ repository.SecretRepository = (*SecretRepository)(nil)
+
+func (m *SecretRepository) Create(secret *models.SecretNode) error { return m.CreateFunc(secret) }
+func (m *SecretRepository) GetByID(id uint) (*models.SecretNode, error) {
+	return m.GetByIDFunc(id)
+}
+func (m *SecretRepository) GetByIDs(ids []uint) ([]models.SecretNode, error) {
+	return m.GetByIDsFunc(ids)
+}
+func (m *SecretRepository) List() ([]models.SecretNode, error) { return m.ListFunc() }
+func (m *SecretRepository) ListAfter(q repository.SecretQuery) ([]models.SecretNode, error) {
+	return m.ListAfterFunc(q)
+}
+func (m *SecretRepository) Query(q repository.SecretQuery) ([]models.SecretNode, error) {
+	return m.QueryFunc(q)
+}
+func (m *SecretRepository) Count(q repository.SecretQuery) (int64, error) { return m.CountFunc(q) }
+func (m *SecretRepository) FindByNameKey(namespaceID, zoneID, environmentID uint, nameKey string) (*models.SecretNode, error) {
+	return m.FindByNameKeyFunc(namespaceID, zoneID, environmentID, nameKey)
+}
+func (m *SecretRepository) ListChildren(parentID uint) ([]models.SecretNode, error) {
+	return m.ListChildrenFunc(parentID)
+}
+func (m *SecretRepository) Update(secret *models.SecretNode) error { return m.UpdateFunc(secret) }
+func (m *SecretRepository) TouchIfUnchanged(id uint, updatedAt time.Time) (bool, error) {
+	return m.TouchFunc(id, updatedAt)
+}
+func (m *SecretRepository) GetVersions(secretID uint) ([]models.SecretVersion, error) {
+	return m.GetVersionsFunc(secretID)
+}
+func (m *SecretRepository) CreateVersion(version *models.SecretVersion) error {
+	return m.CreateVersionFunc(version)
+}
+func (m *SecretRepository) UpdateVersion(version *models.SecretVersion) error {
+	return m.UpdateVersionFunc(version)
+}
+func (m *SecretRepository) UpdateVersionContent(version *models.SecretVersion) error {
+	return m.UpdateVersionContentFunc(version)
+}
+func (m *SecretRepository) ConsumeRead(versionID uint, maxReads *int) (int, error) {
+	return m.ConsumeReadFunc(versionID, maxReads)
+}
+func (m *SecretRepository) CreateChunk(chunk *models.SecretChunk) error {
+	return m.CreateChunkFunc(chunk)
+}
+func (m *SecretRepository) GetChunk(versionID uint, index int) (*models.SecretChunk, error) {
+	return m.GetChunkFunc(versionID, index)
+}
+func (m *SecretRepository) RecordKeyRead(versionID uint, key string) error {
+	return m.RecordKeyReadFunc(versionID, key)
+}
+func (m *SecretRepository) GetKeyReads(versionID uint) ([]models.SecretKeyRead, error) {
+	return m.GetKeyReadsFunc(versionID)
+}
+func (m *SecretRepository) Delete(secretID uint) error { return m.DeleteFunc(secretID) }
+
+// UserRepository is a mock repository.UserRepository
+type UserRepository struct {
+	CreateFunc           func(user *models.User) error
+	FindByUsernameFunc   func(username string) (*models.User, error)
+	FindByEmailIndexFunc func(emailIndex string) (*models.User, error)
+	FindByIDFunc         func(id uint) (*models.User, error)
+	FindByIDsFunc        func(ids []uint) ([]models.User, error)
+	ListFunc             func() ([]models.User, error)
+	ListAfterFunc        func(afterID uint, limit int) ([]models.User, error)
+	DeleteFunc           func(id uint) error
+	SetDeactivatedFunc   func(id uint, at *time.Time) error
+	SetEmailFunc         func(id uint, email, emailIndex string) error
+	SetPasswordHashFunc  func(id uint, hash string) error
+	SetTwoFactorFunc     func(id uint, tf models.TwoFactor) error
+}
+
+var _ repository.UserRepository = (*UserRepository)(nil)
+
+func (m *UserRepository) Create(user *models.User) error { return m.CreateFunc(user) }
+func (m *UserRepository) FindByUsername(username string) (*models.User, error) {
+	return m.FindByUsernameFunc(username)
+}
+func (m *UserRepository) FindByEmailIndex(emailIndex string) (*models.User, error) {
+	return m.FindByEmailIndexFunc(emailIndex)
+}
+func (m *UserRepository) FindByID(id uint) (*models.User, error) { return m.FindByIDFunc(id) }
+func (m *UserRepository) FindByIDs(ids []uint) ([]models.User, error) {
+	return m.FindByIDsFunc(ids)
+}
+func (m *UserRepository) List() ([]models.User, error) { return m.ListFunc() }
+func (m *UserRepository) ListAfter(afterID uint, limit int) ([]models.User, error) {
+	return m.ListAfterFunc(afterID, limit)
+}
+func (m *UserRepository) Delete(id uint) error { return m.DeleteFunc(id) }
+func (m *UserRepository) SetDeactivated(id uint, at *time.Time) error {
+	return m.SetDeactivatedFunc(id, at)
+}
+func (m *UserRepository) SetEmail(id uint, email, emailIndex string) error {
+	return m.SetEmailFunc(id, email, emailIndex)
+}
+func (m *UserRepository) SetPasswordHash(id uint, hash string) error {
+	return m.SetPasswordHashFunc(id, hash)
+}
+func (m *UserRepository) SetTwoFactor(id uint, tf models.TwoFactor) error {
+	return m.SetTwoFactorFunc(id, tf)
+}
+
+// SessionRepository is a mock repository.SessionRepository
+type SessionRepository struct {
+	CreateFunc        func(session *models.Session) error
+	GetByTokenFunc    func(token string) (*models.Session, error)
+	DeleteExpiredFunc func() error
+	ListByUserFunc    func(userID uint) ([]models.Session, error)
+	TouchFunc         func(id uint, seenAt time.Time, ipAddress, userAgent string) error
+	DeleteFunc        func(id uint) error
+	DeleteOthersFunc  func(userID, keepID uint) (int64, error)
+	SetElevatedFunc   func(id uint, until *time.Time) error
+}
+
+var _ repository.SessionRepository = (*SessionRepository)(nil)
+
+func (m *SessionRepository) Create(session *models.Session) error { return m.CreateFunc(session) }
+func (m *SessionRepository) GetByToken(token string) (*models.Session, error) {
+	return m.GetByTokenFunc(token)
+}
+func (m *SessionRepository) DeleteExpired() error { return m.DeleteExpiredFunc() }
+func (m *SessionRepository) ListByUser(userID uint) ([]models.Session, error) {
+	return m.ListByUserFunc(userID)
+}
+func (m *SessionRepository) Touch(id uint, seenAt time.Time, ipAddress, userAgent string) error {
+	return m.TouchFunc(id, seenAt, ipAddress, userAgent)
+}
+func (m *SessionRepository) Delete(id uint) error { return m.DeleteFunc(id) }
+func (m *SessionRepository) DeleteOthers(userID, keepID uint) (int64, error) {
+	return m.DeleteOthersFunc(userID, keepID)
+}
+func (m *SessionRepository) SetElevated(id uint, until *time.Time) error {
+	return m.SetElevatedFunc(id, until)
+}
+
+// AuditRepository is a mock repository.AuditRepository
+type AuditRepository struct {
+	LogEventFunc    func(event *models.AuditEvent) error
+	LogEventsFunc   func(events []*models.AuditEvent) error
+	ListByUserFunc  func(userID uint) ([]models.AuditEvent, error)
+	ListBetweenFunc func(from, to time.Time) ([]models.AuditEvent, error)
+	ListAfterFunc   func(q repository.AuditQuery) ([]models.AuditEvent, error)
+}
+
+var _ repository.AuditRepository = (*AuditRepository)(nil)
+
+func (m *AuditRepository) LogEvent(event *models.AuditEvent) error { return m.LogEventFunc(event) }
+func (m *AuditRepository) LogEvents(events []*models.AuditEvent) error {
+	return m.LogEventsFunc(events)
+}
+func (m *AuditRepository) ListByUser(userID uint) ([]models.AuditEvent, error) {
+	return m.ListByUserFunc(userID)
+}
+func (m *AuditRepository) ListBetween(from, to time.Time) ([]models.AuditEvent, error) {
+	return m.ListBetweenFunc(from, to)
+}
+func (m *AuditRepository) ListAfter(q repository.AuditQuery) ([]models.AuditEvent, error) {
+	return m.ListAfterFunc(q)
+}
+
+// ConfigRepository is a mock repository.ConfigRepository
+type ConfigRepository struct {
+	GetFunc func(key string) (string, error)
+	SetFunc func(key string, value string) error
+}
+
+var _ repository.ConfigRepository = (*ConfigRepository)(nil)
+
+func (m *ConfigRepository) Get(key string) (string, error)     { return m.GetFunc(key) }
+func (m *ConfigRepository) Set(key string, value string) error { return m.SetFunc(key, value) }
+
+// ScopeRepository is a mock repository.ScopeRepository
+type ScopeRepository struct {
+	CreateNamespaceFunc   func(namespace *models.Namespace) error
+	ListNamespacesFunc    func() ([]models.Namespace, error)
+	CreateZoneFunc        func(zone *models.Zone) error
+	ListZonesFunc         func() ([]models.Zone, error)
+	CreateEnvironmentFunc func(environment *models.Environment) error
+	ListEnvironmentsFunc  func() ([]models.Environment, error)
+}
+
+var _ repository.ScopeRepository = (*ScopeRepository)(nil)
+
+func (m *ScopeRepository) CreateNamespace(namespace *models.Namespace) error {
+	return m.CreateNamespaceFunc(namespace)
+}
+func (m *ScopeRepository) ListNamespaces() ([]models.Namespace, error) {
+	return m.ListNamespacesFunc()
+}
+func (m *ScopeRepository) CreateZone(zone *models.Zone) error { return m.CreateZoneFunc(zone) }
+func (m *ScopeRepository) ListZones() ([]models.Zone, error)  { return m.ListZonesFunc() }
+func (m *ScopeRepository) CreateEnvironment(environment *models.Environment) error {
+	return m.CreateEnvironmentFunc(environment)
+}
+func (m *ScopeRepository) ListEnvironments() ([]models.Environment, error) {
+	return m.ListEnvironmentsFunc()
+}
+
+// OperationRepository is a mock repository.OperationRepository
+type OperationRepository struct {
+	CreateFunc          func(op *models.PendingOperation) error
+	GetByIDFunc         func(id uint) (*models.PendingOperation, error)
+	ListFunc            func(status string) ([]models.PendingOperation, error)
+	UpdateFunc          func(op *models.PendingOperation) error
+	UpdateIfPendingFunc func(op *models.PendingOperation) (bool, error)
+}
+
+var _ repository.OperationRepository = (*OperationRepository)(nil)
+
+func (m *OperationRepository) Create(op *models.PendingOperation) error { return m.CreateFunc(op) }
+func (m *OperationRepository) GetByID(id uint) (*models.PendingOperation, error) {
+	return m.GetByIDFunc(id)
+}
+func (m *OperationRepository) List(status string) ([]models.PendingOperation, error) {
+	return m.ListFunc(status)
+}
+func (m *OperationRepository) Update(op *models.PendingOperation) error { return m.UpdateFunc(op) }
+func (m *OperationRepository) UpdateIfPending(op *models.PendingOperation) (bool, error) {
+	return m.UpdateIfPendingFunc(op)
+}
+
+// CheckoutRepository is a mock repository.CheckoutRepository
+type CheckoutRepository struct {
+	CreateFunc       func(co *models.SecretCheckout) error
+	ActiveFunc       func(secretID uint) (*models.SecretCheckout, error)
+	UpdateFunc       func(co *models.SecretCheckout) error
+	ListBySecretFunc func(secretID uint) ([]models.SecretCheckout, error)
+}
+
+var _ repository.CheckoutRepository = (*CheckoutRepository)(nil)
+
+func (m *CheckoutRepository) Create(co *models.SecretCheckout) error { return m.CreateFunc(co) }
+func (m *CheckoutRepository) Active(secretID uint) (*models.SecretCheckout, error) {
+	return m.ActiveFunc(secretID)
+}
+func (m *CheckoutRepository) Update(co *models.SecretCheckout) error { return m.UpdateFunc(co) }
+func (m *CheckoutRepository) ListBySecret(secretID uint) ([]models.SecretCheckout, error) {
+	return m.ListBySecretFunc(secretID)
+}
+
+// AliasRepository is a mock repository.AliasRepository
+type AliasRepository struct {
+	CreateFunc        func(alias *models.SecretAlias) error
+	FindByNameKeyFunc func(nameKey string) ([]models.SecretAlias, error)
+	ListBySecretFunc  func(secretID uint) ([]models.SecretAlias, error)
+	ListFunc          func() ([]models.SecretAlias, error)
+	SetNameKeyFunc    func(id uint, nameKey string) error
+}
+
+var _ repository.AliasRepository = (*AliasRepository)(nil)
+
+func (m *AliasRepository) Create(alias *models.SecretAlias) error { return m.CreateFunc(alias) }
+func (m *AliasRepository) FindByNameKey(nameKey string) ([]models.SecretAlias, error) {
+	return m.FindByNameKeyFunc(nameKey)
+}
+func (m *AliasRepository) ListBySecret(secretID uint) ([]models.SecretAlias, error) {
+	return m.ListBySecretFunc(secretID)
+}
+func (m *AliasRepository) List() ([]models.SecretAlias, error) { return m.ListFunc() }
+func (m *AliasRepository) SetNameKey(id uint, nameKey string) error {
+	return m.SetNameKeyFunc(id, nameKey)
+}
+
+// GrantRepository is a mock repository.GrantRepository
+type GrantRepository struct {
+	SetFunc             func(grant *models.SecretGrant) error
+	DeleteFunc          func(nodeID, userID uint) error
+	ListByNodeFunc      func(nodeID uint) ([]models.SecretGrant, error)
+	ListByNodesFunc     func(nodeIDs []uint) ([]models.SecretGrant, error)
+	HasFolderGrantsFunc func() (bool, error)
+}
+
+var _ repository.GrantRepository = (*GrantRepository)(nil)
+
+func (m *GrantRepository) Set(grant *models.SecretGrant) error { return m.SetFunc(grant) }
+func (m *GrantRepository) Delete(nodeID, userID uint) error    { return m.DeleteFunc(nodeID, userID) }
+func (m *GrantRepository) ListByNode(nodeID uint) ([]models.SecretGrant, error) {
+	return m.ListByNodeFunc(nodeID)
+}
+func (m *GrantRepository) ListByNodes(nodeIDs []uint) ([]models.SecretGrant, error) {
+	return m.ListByNodesFunc(nodeIDs)
+}
+func (m *GrantRepository) HasFolderGrants() (bool, error) { return m.HasFolderGrantsFunc() }
+
+// ExportProfileRepository is a mock repository.ExportProfileRepository
+type ExportProfileRepository struct {
+	SaveFunc       func(profile *models.ExportProfile) error
+	FindByNameFunc func(name string) (*models.ExportProfile, error)
+	ListFunc       func() ([]models.ExportProfile, error)
+	DeleteFunc     func(name string) error
+}
+
+var _ repository.ExportProfileRepository = (*ExportProfileRepository)(nil)
+
+func (m *ExportProfileRepository) Save(profile *models.ExportProfile) error {
+	return m.SaveFunc(profile)
+}
+func (m *ExportProfileRepository) FindByName(name string) (*models.ExportProfile, error) {
+	return m.FindByNameFunc(name)
+}
+func (m *ExportProfileRepository) List() ([]models.ExportProfile, error) { return m.ListFunc() }
+func (m *ExportProfileRepository) Delete(name string) error              { return m.DeleteFunc(name) }
+
+// RBACRepository is a mock repository.RBACRepository
+type RBACRepository struct {
+	ListRolesFunc         func() ([]models.Role, error)
+	SaveRoleFunc          func(role *models.Role) error
+	DeleteRoleFunc        func(id uint) error
+	ListGroupsFunc        func() ([]models.Group, error)
+	SaveGroupFunc         func(group *models.Group) error
+	DeleteGroupFunc       func(id uint) error
+	ListMembersFunc       func() ([]models.UserGroup, error)
+	AddMemberFunc         func(member *models.UserGroup) error
+	RemoveMemberFunc      func(member *models.UserGroup) error
+	ListUserRolesFunc     func() ([]models.UserRole, error)
+	AssignUserRoleFunc    func(assignment *models.UserRole) error
+	UnassignUserRoleFunc  func(assignment *models.UserRole) error
+	ListGroupRolesFunc    func() ([]models.GroupRole, error)
+	AssignGroupRoleFunc   func(assignment *models.GroupRole) error
+	UnassignGroupRoleFunc func(assignment *models.GroupRole) error
+	ListDenyRulesFunc     func() ([]models.DenyRule, error)
+	SaveDenyRuleFunc      func(rule *models.DenyRule) error
+	DeleteDenyRuleFunc    func(id uint) error
+	LogChangeFunc         func(change *models.RBACChangeLog) error
+	ListChangesFunc       func(q repository.RBACChangeQuery) ([]models.RBACChangeLog, error)
+}
+
+var _ repository.RBACRepository = (*RBACRepository)(nil)
+
+func (m *RBACRepository) ListRoles() ([]models.Role, error)        { return m.ListRolesFunc() }
+func (m *RBACRepository) SaveRole(role *models.Role) error         { return m.SaveRoleFunc(role) }
+func (m *RBACRepository) DeleteRole(id uint) error                 { return m.DeleteRoleFunc(id) }
+func (m *RBACRepository) ListGroups() ([]models.Group, error)      { return m.ListGroupsFunc() }
+func (m *RBACRepository) SaveGroup(group *models.Group) error      { return m.SaveGroupFunc(group) }
+func (m *RBACRepository) DeleteGroup(id uint) error                { return m.DeleteGroupFunc(id) }
+func (m *RBACRepository) ListMembers() ([]models.UserGroup, error) { return m.ListMembersFunc() }
+func (m *RBACRepository) AddMember(member *models.UserGroup) error {
+	return m.AddMemberFunc(member)
+}
+func (m *RBACRepository) RemoveMember(member *models.UserGroup) error {
+	return m.RemoveMemberFunc(member)
+}
+func (m *RBACRepository) ListUserRoles() ([]models.UserRole, error) { return m.ListUserRolesFunc() }
+func (m *RBACRepository) AssignUserRole(assignment *models.UserRole) error {
+	return m.AssignUserRoleFunc(assignment)
+}
+func (m *RBACRepository) UnassignUserRole(assignment *models.UserRole) error {
+	return m.UnassignUserRoleFunc(assignment)
+}
+func (m *RBACRepository) ListGroupRoles() ([]models.GroupRole, error) { return m.ListGroupRolesFunc() }
+func (m *RBACRepository) AssignGroupRole(assignment *models.GroupRole) error {
+	return m.AssignGroupRoleFunc(assignment)
+}
+func (m *RBACRepository) UnassignGroupRole(assignment *models.GroupRole) error {
+	return m.UnassignGroupRoleFunc(assignment)
+}
+func (m *RBACRepository) ListDenyRules() ([]models.DenyRule, error) { return m.ListDenyRulesFunc() }
+func (m *RBACRepository) SaveDenyRule(rule *models.DenyRule) error  { return m.SaveDenyRuleFunc(rule) }
+func (m *RBACRepository) DeleteDenyRule(id uint) error              { return m.DeleteDenyRuleFunc(id) }
+func (m *RBACRepository) LogChange(change *models.RBACChangeLog) error {
+	return m.LogChangeFunc(change)
+}
+func (m *RBACRepository) ListChanges(q repository.RBACChangeQuery) ([]models.RBACChangeLog, error) {
+	return m.ListChangesFunc(q)
+}
+
+// ServiceAccountRepository is a mock repository.ServiceAccountRepository
+type ServiceAccountRepository struct {
+	CreateFunc      func(account *models.ServiceAccount) error
+	GetByUserIDFunc func(userID uint) (*models.ServiceAccount, error)
+	ListFunc        func() ([]models.ServiceAccount, error)
+}
+
+var _ repository.ServiceAccountRepository = (*ServiceAccountRepository)(nil)
+
+func (m *ServiceAccountRepository) Create(account *models.ServiceAccount) error {
+	return m.CreateFunc(account)
+}
+func (m *ServiceAccountRepository) GetByUserID(userID uint) (*models.ServiceAccount, error) {
+	return m.GetByUserIDFunc(userID)
+}
+func (m *ServiceAccountRepository) List() ([]models.ServiceAccount, error) { return m.ListFunc() }
+
+// ReleaseRepository is a mock repository.ReleaseRepository
+type ReleaseRepository struct {
+	CreateFunc       func(release *models.SecretRelease) error
+	GetFunc          func(id uint) (*models.SecretRelease, error)
+	UpdateFunc       func(release *models.SecretRelease) error
+	ListBySecretFunc func(secretID uint) ([]models.SecretRelease, error)
+	ListByStatusFunc func(status string) ([]models.SecretRelease, error)
+}
+
+var _ repository.ReleaseRepository = (*ReleaseRepository)(nil)
+
+func (m *ReleaseRepository) Create(release *models.SecretRelease) error {
+	return m.CreateFunc(release)
+}
+func (m *ReleaseRepository) Get(id uint) (*models.SecretRelease, error) { return m.GetFunc(id) }
+func (m *ReleaseRepository) Update(release *models.SecretRelease) error {
+	return m.UpdateFunc(release)
+}
+func (m *ReleaseRepository) ListBySecret(secretID uint) ([]models.SecretRelease, error) {
+	return m.ListBySecretFunc(secretID)
+}
+func (m *ReleaseRepository) ListByStatus(status string) ([]models.SecretRelease, error) {
+	return m.ListByStatusFunc(status)
+}
+
+// EscrowRepository is a mock repository.EscrowRepository
+type EscrowRepository struct {
+	SetCustodianFunc   func(custodian *models.EscrowCustodian) error
+	GetCustodianFunc   func(userID uint) (*models.EscrowCustodian, error)
+	CreateFunc         func(escrow *models.Escrow, shares []models.EscrowShare) error
+	GetFunc            func(id uint) (*models.Escrow, error)
+	ListBySecretFunc   func(secretID uint) ([]models.Escrow, error)
+	ListSharesFunc     func(escrowID uint) ([]models.EscrowShare, error)
+	CreateRecoveryFunc func(recovery *models.EscrowRecovery) error
+	GetRecoveryFunc    func(id uint) (*models.EscrowRecovery, error)
+	UpdateRecoveryFunc func(recovery *models.EscrowRecovery) error
+	ListRecoveriesFunc func(escrowID uint) ([]models.EscrowRecovery, error)
+	AppendLogFunc      func(entry *models.EscrowLogEntry) error
+	LastLogFunc        func() (*models.EscrowLogEntry, error)
+	ListLogFunc        func() ([]models.EscrowLogEntry, error)
+}
+
+var _ repository.EscrowRepository = (*EscrowRepository)(nil)
+
+func (m *EscrowRepository) SetCustodian(custodian *models.EscrowCustodian) error {
+	return m.SetCustodianFunc(custodian)
+}
+func (m *EscrowRepository) GetCustodian(userID uint) (*models.EscrowCustodian, error) {
+	return m.GetCustodianFunc(userID)
+}
+func (m *EscrowRepository) Create(escrow *models.Escrow, shares []models.EscrowShare) error {
+	return m.CreateFunc(escrow, shares)
+}
+func (m *EscrowRepository) Get(id uint) (*models.Escrow, error) { return m.GetFunc(id) }
+func (m *EscrowRepository) ListBySecret(secretID uint) ([]models.Escrow, error) {
+	return m.ListBySecretFunc(secretID)
+}
+func (m *EscrowRepository) ListShares(escrowID uint) ([]models.EscrowShare, error) {
+	return m.ListSharesFunc(escrowID)
+}
+func (m *EscrowRepository) CreateRecovery(recovery *models.EscrowRecovery) error {
+	return m.CreateRecoveryFunc(recovery)
+}
+func (m *EscrowRepository) GetRecovery(id uint) (*models.EscrowRecovery, error) {
+	return m.GetRecoveryFunc(id)
+}
+func (m *EscrowRepository) UpdateRecovery(recovery *models.EscrowRecovery) error {
+	return m.UpdateRecoveryFunc(recovery)
+}
+func (m *EscrowRepository) ListRecoveries(escrowID uint) ([]models.EscrowRecovery, error) {
+	return m.ListRecoveriesFunc(escrowID)
+}
+func (m *EscrowRepository) AppendLog(entry *models.EscrowLogEntry) error {
+	return m.AppendLogFunc(entry)
+}
+func (m *EscrowRepository) LastLog() (*models.EscrowLogEntry, error) { return m.LastLogFunc() }
+func (m *EscrowRepository) ListLog() ([]models.EscrowLogEntry, error) {
+	return m.ListLogFunc()
+}
+
+// PasswordResetRepository is a mock repository.PasswordResetRepository
+type PasswordResetRepository struct {
+	CreateFunc       func(reset *models.PasswordReset) error
+	GetByTokenFunc   func(token string) (*models.PasswordReset, error)
+	ConsumeFunc      func(token string, now time.Time) (bool, error)
+	CountSinceFunc   func(userID uint, since time.Time) (int64, error)
+	DeleteByUserFunc func(userID uint) error
+}
+
+var _ repository.PasswordResetRepository = (*PasswordResetRepository)(nil)
+
+func (m *PasswordResetRepository) Create(reset *models.PasswordReset) error {
+	return m.CreateFunc(reset)
+}
+func (m *PasswordResetRepository) GetByToken(token string) (*models.PasswordReset, error) {
+	return m.GetByTokenFunc(token)
+}
+func (m *PasswordResetRepository) Consume(token string, now time.Time) (bool, error) {
+	return m.ConsumeFunc(token, now)
+}
+func (m *PasswordResetRepository) CountSince(userID uint, since time.Time) (int64, error) {
+	return m.CountSinceFunc(userID, since)
+}
+func (m *PasswordResetRepository) DeleteByUser(userID uint) error { return m.DeleteByUserFunc(userID) }
+
+// WebAuthnCredentialRepository is a mock repository.WebAuthnCredentialRepository
+type WebAuthnCredentialRepository struct {
+	CreateFunc            func(cred *models.WebAuthnCredential) error
+	ListByUserFunc        func(userID uint) ([]models.WebAuthnCredential, error)
+	GetByCredentialIDFunc func(credentialID []byte) (*models.WebAuthnCredential, error)
+	RecordUseFunc         func(id uint, signCount uint32, usedAt time.Time) error
+	DeleteFunc            func(id uint) error
+}
+
+var _ repository.WebAuthnCredentialRepository = (*WebAuthnCredentialRepository)(nil)
+
+func (m *WebAuthnCredentialRepository) Create(cred *models.WebAuthnCredential) error {
+	return m.CreateFunc(cred)
+}
+func (m *WebAuthnCredentialRepository) ListByUser(userID uint) ([]models.WebAuthnCredential, error) {
+	return m.ListByUserFunc(userID)
+}
+func (m *WebAuthnCredentialRepository) GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	return m.GetByCredentialIDFunc(credentialID)
+}
+func (m *WebAuthnCredentialRepository) RecordUse(id uint, signCount uint32, usedAt time.Time) error {
+	return m.RecordUseFunc(id, signCount, usedAt)
+}
+func (m *WebAuthnCredentialRepository) Delete(id uint) error { return m.DeleteFunc(id) }
+
+// APIClientRepository is a mock repository.APIClientRepository
+type APIClientRepository struct {
+	CreateFunc        func(client *models.APIClient) error
+	GetByClientIDFunc func(clientID string) (*models.APIClient, error)
+	ListByUserFunc    func(userID uint) ([]models.APIClient, error)
+	UpdateFunc        func(client *models.APIClient) error
+	RecordUseFunc     func(id uint, usedAt time.Time) error
+	DeleteFunc        func(id uint) error
+}
+
+var _ repository.APIClientRepository = (*APIClientRepository)(nil)
+
+func (m *APIClientRepository) Create(client *models.APIClient) error { return m.CreateFunc(client) }
+func (m *APIClientRepository) GetByClientID(clientID string) (*models.APIClient, error) {
+	return m.GetByClientIDFunc(clientID)
+}
+func (m *APIClientRepository) ListByUser(userID uint) ([]models.APIClient, error) {
+	return m.ListByUserFunc(userID)
+}
+func (m *APIClientRepository) Update(client *models.APIClient) error { return m.UpdateFunc(client) }
+func (m *APIClientRepository) RecordUse(id uint, usedAt time.Time) error {
+	return m.RecordUseFunc(id, usedAt)
+}
+func (m *APIClientRepository) Delete(id uint) error { return m.DeleteFunc(id) }
+
+// DeviceRepository is a mock repository.DeviceRepository
+type DeviceRepository struct {
+	CreateTokenFunc      func(token *models.DeviceEnrollmentToken) error
+	ConsumeTokenFunc     func(tokenHash string, usedAt time.Time) (*models.DeviceEnrollmentToken, error)
+	CreateFunc           func(device *models.Device) error
+	GetByIDFunc          func(id uint) (*models.Device, error)
+	GetByFingerprintFunc func(fingerprint string) (*models.Device, error)
+	ListFunc             func() ([]models.Device, error)
+	RecordUseFunc        func(id uint, usedAt time.Time) error
+	RevokeFunc           func(id uint, revokedAt time.Time) error
+}
+
+var _ repository.DeviceRepository = (*DeviceRepository)(nil)
+
+func (m *DeviceRepository) CreateToken(token *models.DeviceEnrollmentToken) error {
+	return m.CreateTokenFunc(token)
+}
+func (m *DeviceRepository) ConsumeToken(tokenHash string, usedAt time.Time) (*models.DeviceEnrollmentToken, error) {
+	return m.ConsumeTokenFunc(tokenHash, usedAt)
+}
+func (m *DeviceRepository) Create(device *models.Device) error      { return m.CreateFunc(device) }
+func (m *DeviceRepository) GetByID(id uint) (*models.Device, error) { return m.GetByIDFunc(id) }
+func (m *DeviceRepository) GetByFingerprint(fingerprint string) (*models.Device, error) {
+	return m.GetByFingerprintFunc(fingerprint)
+}
+func (m *DeviceRepository) List() ([]models.Device, error) { return m.ListFunc() }
+func (m *DeviceRepository) RecordUse(id uint, usedAt time.Time) error {
+	return m.RecordUseFunc(id, usedAt)
+}
+func (m *DeviceRepository) Revoke(id uint, revokedAt time.Time) error {
+	return m.RevokeFunc(id, revokedAt)
+}
@@ -28,17 +28,43 @@ type Environment struct {
 }
 
 type User struct {
-	ID           uint   `gorm:"primaryKey"`
-	Username     string `gorm:"uniqueIndex;not null"`
-	Email        string
+	ID       uint   `gorm:"primaryKey"`
+	Username string `gorm:"uniqueIndex;not null"`
+	Email    string
+	// EmailIndex is the blind index of the normalized email, which lookups
+	// by email go through
+	EmailIndex   string `gorm:"index"`
 	PasswordHash string
 	CreatedAt    time.Time
+	// DeactivatedAt is set while the account is deactivated; it cannot log
+	// in but keeps its history and ownership
+	DeactivatedAt *time.Time
+	TwoFactor     `gorm:"embedded"`
+}
+
+// TwoFactor is a user's second login factor
+type TwoFactor struct {
+	// TOTPSecret is the authenticator key, encrypted when storage
+	// encryption is enabled
+	TOTPSecret []byte
+	// TOTPEnabledAt is set once enrollment is confirmed with a valid code
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the time step of the last accepted code, which may
+	// not be used again
+	TOTPLastStep int64
+	// RecoveryCodes holds SHA-256 hashes of the unused recovery codes, one
+	// per line
+	RecoveryCodes string
 }
 
 type Role struct {
 	ID          uint   `gorm:"primaryKey"`
 	Name        string `gorm:"unique;not null"`
 	Description string
+	// Permissions is a comma-separated list of permission catalog names
+	Permissions string
+	// Builtin marks the role templates seeded on startup
+	Builtin bool
 }
 
 type UserRole struct {
@@ -64,34 +90,106 @@ type GroupRole struct {
 	NamespaceID *uint
 }
 
+// DenyRule takes a permission away from users even where their roles,
+// grants or ownership allow it. Rules are checked in name order.
+type DenyRule struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"uniqueIndex;not null"`
+	Permission string `gorm:"not null"`
+	// NamespaceID limits the rule to one namespace; nil applies everywhere
+	NamespaceID *uint
+	// Group limits the rule to the members of a group; empty applies to
+	// every user
+	Group string
+	// ExceptRoles is a comma-separated list of roles whose holders the
+	// rule does not apply to
+	ExceptRoles string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RBACChangeLog is one change an access policy made, with the role, group,
+// member, assignment, deny rule or user before and after it as JSON. Before
+// is empty for creations and After for removals.
+type RBACChangeLog struct {
+	ID uint `gorm:"primaryKey"`
+	// AuditEventID is the rbac_changed event recorded with the change
+	AuditEventID uint   `gorm:"index"`
+	Actor        string `gorm:"index"`
+	Action       string
+	Kind         string `gorm:"index"`
+	Name         string
+	Before       datatypes.JSON
+	After        datatypes.JSON
+	ChangedAt    time.Time `gorm:"index"`
+}
+
 type SecretNode struct {
-	ID            uint `gorm:"primaryKey"`
-	ParentID      *uint
-	NamespaceID   uint
-	ZoneID        uint
-	EnvironmentID uint
+	ID uint `gorm:"primaryKey"`
+	// ParentID is the folder holding the node, nil at the top level.
+	// Folders are nodes with IsSecret unset; they have no versions.
+	ParentID      *uint  `gorm:"index"`
+	NamespaceID   uint   `gorm:"uniqueIndex:idx_secret_nodes_name_key"`
+	ZoneID        uint   `gorm:"uniqueIndex:idx_secret_nodes_name_key"`
+	EnvironmentID uint   `gorm:"uniqueIndex:idx_secret_nodes_name_key"`
 	Name          string `gorm:"not null"`
-	IsSecret      bool   `gorm:"default:false"`
-	Type          string
-	MaxReads      *int
-	Expiration    *time.Time
-	Metadata      datatypes.JSON
-	Status        string `gorm:"default:'active'"`
-	CreatedBy     string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	// NameKey is the blind index of the normalized name, unique within the
+	// namespace, zone and environment. It is nil for older secrets whose
+	// name collides with another one.
+	NameKey    *string `gorm:"uniqueIndex:idx_secret_nodes_name_key"`
+	IsSecret   bool    `gorm:"default:false"`
+	Type       string
+	MaxReads   *int
+	Expiration *time.Time
+	Metadata   datatypes.JSON
+	Status     string `gorm:"default:'active'"`
+	CreatedBy  string
+	// Owner is the user responsible for the secret; empty for secrets
+	// created by tools rather than users
+	Owner     string `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Canary secrets exist only to be found: every read raises an alert
+	Canary bool `gorm:"default:false"`
 }
 
+// SecretVersion is one value of a secret. EncryptedValue is never
+// serialized, so a version handed to an encoder by mistake cannot leak it;
+// APIs describe secrets with their own response types. VersionNumber is
+// unique per secret, so concurrent updates cannot take the same number.
 type SecretVersion struct {
-	ID                 uint `gorm:"primaryKey"`
-	SecretNodeID       uint
-	VersionNumber      int
-	EncryptedValue     []byte
+	ID                 uint   `gorm:"primaryKey"`
+	SecretNodeID       uint   `gorm:"uniqueIndex:idx_secret_versions_node_number"`
+	VersionNumber      int    `gorm:"uniqueIndex:idx_secret_versions_node_number"`
+	EncryptedValue     []byte `json:"-"`
 	EncryptionMetadata datatypes.JSON
 	ReadCount          int
+	ChunkCount         int
+	Compression        string
+	ContentHash        string
 	CreatedAt          time.Time
 }
 
+// SecretChunk holds one encrypted part of a streamed SecretVersion
+// (ChunkCount > 0); such versions keep EncryptedValue empty
+type SecretChunk struct {
+	ID              uint `gorm:"primaryKey"`
+	SecretVersionID uint `gorm:"index"`
+	ChunkIndex      int
+	EncryptedValue  []byte `json:"-"`
+	CreatedAt       time.Time
+}
+
+// SecretKeyRead counts reads of one key of a structured (JSON) secret
+// version, e.g. "db.password"
+type SecretKeyRead struct {
+	ID              uint   `gorm:"primaryKey"`
+	SecretVersionID uint   `gorm:"uniqueIndex:idx_secret_key_reads_version_key"`
+	Key             string `gorm:"uniqueIndex:idx_secret_key_reads_version_key"`
+	ReadCount       int
+	LastReadAt      time.Time
+}
+
 type SecretAccessLog struct {
 	ID              uint `gorm:"primaryKey"`
 	SecretNodeID    uint
@@ -116,13 +214,91 @@ type Session struct {
 	ID           uint `gorm:"primaryKey"`
 	UserID       uint
 	SessionToken string `gorm:"unique"`
-	CreatedAt    time.Time
-	ExpiresAt    *time.Time
+	// Scope names the OIDC policy restricting a federated session; empty for
+	// password logins, which act with the user's full access
+	Scope   string
+	Subject string
+	// Client the session was opened from and last used by
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt *time.Time
+	ExpiresAt  *time.Time
+	// ElevatedUntil is set when the user confirmed a second factor for
+	// sensitive operations
+	ElevatedUntil *time.Time
+	// ImpersonatorID is the admin acting as the user in an impersonation
+	// session
+	ImpersonatorID *uint
+}
+
+// WebAuthnCredential is a passkey or security key a user logs in with
+type WebAuthnCredential struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	Name   string
+	// CredentialID is the authenticator's identifier for the credential
+	CredentialID []byte `gorm:"uniqueIndex"`
+	// PublicKey is the credential's COSE-encoded public key
+	PublicKey []byte
+	// SignCount is the authenticator's signature counter at the last login
+	SignCount  uint32
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// DeviceEnrollmentToken lets one machine enroll. Only the hash of the token
+// is stored.
+type DeviceEnrollmentToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	TokenHash string `gorm:"uniqueIndex"`
+	// Name, Username, NamespaceID and ReadOnly are copied to the device
+	Name        string
+	Username    string
+	NamespaceID uint
+	ReadOnly    bool
+	CreatedBy   string
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+	CreatedAt   time.Time
+}
+
+// Device is an enrolled machine that logs in with its certificate and acts
+// as UserID within NamespaceID and ReadOnly
+type Device struct {
+	ID          uint `gorm:"primaryKey"`
+	Name        string
+	UserID      uint `gorm:"index"`
+	NamespaceID uint
+	ReadOnly    bool
+	// Fingerprint is the SHA-256 of the device's public key
+	Fingerprint   string `gorm:"uniqueIndex"`
+	CertSerial    string
+	CertExpiresAt time.Time
+	EnrolledBy    string
+	CreatedAt     time.Time
+	LastSeenAt    *time.Time
+	RevokedAt     *time.Time
+}
+
+// ServiceAccount is a non-interactive identity for automation. It acts as
+// the user UserID, which has no password: the account authenticates with
+// tokens only, while grants, roles and secret ownership refer to it like to
+// any user.
+type ServiceAccount struct {
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint `gorm:"uniqueIndex"`
+	Description string
+	// Owner is the username of the person accountable for the account
+	Owner     string `gorm:"index"`
+	CreatedBy string
+	CreatedAt time.Time
 }
 
 type PasswordReset struct {
-	ID        uint `gorm:"primaryKey"`
-	UserID    uint
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	// Token is the SHA-256 hash of the token sent to the user
 	Token     string `gorm:"unique"`
 	ExpiresAt *time.Time
 	CreatedAt time.Time
@@ -148,13 +324,194 @@ type Notification struct {
 	CreatedAt    time.Time
 }
 
+// PendingOperation is a destructive change on a protected secret that waits
+// for a second administrator to approve it before it is executed
+type PendingOperation struct {
+	ID           uint   `gorm:"primaryKey"`
+	Kind         string `gorm:"not null"`
+	SecretNodeID uint   `gorm:"index"`
+	// Target is the new owner or the grantee, and Level the granted level,
+	// of ownership transfers and grants
+	Target      string
+	Level       string
+	Status      string `gorm:"index;default:'pending'"`
+	RequestedBy string
+	DecidedBy   string
+	Reason      string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	DecidedAt   *time.Time
+}
+
+// SecretGrant gives a user read or write access to a folder or secret. The
+// grants of the nearest node with any grants decide who may access a
+// secret; nodes without grants inherit them from their folder.
+type SecretGrant struct {
+	ID           uint   `gorm:"primaryKey"`
+	SecretNodeID uint   `gorm:"uniqueIndex:idx_secret_grants_node_user"`
+	UserID       uint   `gorm:"uniqueIndex:idx_secret_grants_node_user"`
+	Level        string `gorm:"not null"`
+	GrantedBy    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ExportProfile maps secrets of one namespace, zone and environment to
+// environment variable names for secretly run, env pull and CSI mounts.
+// Secrets holds an explicit env key -> secret name map as JSON; without it
+// every secret directly under Prefix belongs to the profile.
+type ExportProfile struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"uniqueIndex;not null"`
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Prefix        string
+	Secrets       datatypes.JSON
+	VarPrefix     string
+	Uppercase     bool
+	FlattenJSON   bool
+	CreatedBy     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SecretAlias is a former name of a secret. Lookups by that name resolve to
+// the secret until ExpiresAt, so that clients can move to the new name.
+type SecretAlias struct {
+	ID            uint `gorm:"primaryKey"`
+	SecretNodeID  uint `gorm:"index"`
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Name          string `gorm:"not null"`
+	NameKey       string `gorm:"index"`
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+// SecretCheckout is an exclusive lease on a secret that requires check-out.
+// The checkouts of a secret, oldest first, are its custody chain.
+type SecretCheckout struct {
+	ID           uint   `gorm:"primaryKey"`
+	SecretNodeID uint   `gorm:"index"`
+	Username     string `gorm:"not null"`
+	Reason       string
+	CheckedOutAt time.Time
+	ExpiresAt    time.Time
+	CheckedInAt  *time.Time
+	// CheckedInBy is the holder, an admin who forced the check-in, or
+	// "system" for a lease that lapsed
+	CheckedInBy string
+	// RotatedVersion is the version created when the value was rotated on
+	// check-in, 0 if it was not
+	RotatedVersion int
+}
+
+// SecretRelease makes a secret readable by a recipient later: at
+// ReleaseAt, or once the secret's owner has shown no activity for
+// InactivityDays (a dead man's switch)
+type SecretRelease struct {
+	ID             uint   `gorm:"primaryKey"`
+	SecretNodeID   uint   `gorm:"index"`
+	Recipient      string `gorm:"not null"`
+	ReleaseAt      *time.Time
+	InactivityDays int
+	Note           string
+	// Status is pending until the release happens or is cancelled
+	Status    string `gorm:"index"`
+	CreatedBy string
+	CreatedAt time.Time
+	// WarnedAt is when the owner was warned that the release is near
+	WarnedAt    *time.Time
+	ReleasedAt  *time.Time
+	CancelledAt *time.Time
+	CancelledBy string
+}
+
+// EscrowCustodian is a user's public key for receiving escrow key shares.
+// The private key stays with the user.
+type EscrowCustodian struct {
+	UserID    uint `gorm:"primaryKey"`
+	PublicKey []byte
+	UpdatedAt time.Time
+}
+
+// Escrow holds a copy of a secret's value encrypted with a key that exists
+// only as shares sealed to its custodians; Threshold of them must approve
+// a recovery
+type Escrow struct {
+	ID            uint `gorm:"primaryKey"`
+	SecretNodeID  uint `gorm:"index"`
+	VersionNumber int
+	Threshold     int
+	Ciphertext    []byte
+	CreatedBy     string
+	CreatedAt     time.Time
+}
+
+// EscrowShare is one custodian's share of an escrow key
+type EscrowShare struct {
+	ID       uint `gorm:"primaryKey"`
+	EscrowID uint `gorm:"index"`
+	UserID   uint
+	Sealed   []byte
+	// Digest is the SHA-256 of the share, to recognize it when the
+	// custodian hands it back
+	Digest string
+}
+
+// EscrowRecovery is a request to recover an escrowed value
+type EscrowRecovery struct {
+	ID          uint `gorm:"primaryKey"`
+	EscrowID    uint `gorm:"index"`
+	RequestedBy string
+	Reason      string
+	Status      string `gorm:"index"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	// Approvers are the custodians who handed back their share
+	Approvers datatypes.JSON
+	// Shares are the handed-back shares, and Value the recovered value
+	// until the requester collects it; both are encrypted when storage
+	// encryption is enabled and cleared once no longer needed
+	Shares      []byte
+	Value       []byte
+	RecoveredAt *time.Time
+	CollectedAt *time.Time
+}
+
+// EscrowLogEntry is an entry of the escrow log. Each entry's Hash covers
+// its content and the previous entry's hash, so changing or removing an
+// entry breaks the chain.
+type EscrowLogEntry struct {
+	ID         uint `gorm:"primaryKey"`
+	EscrowID   uint `gorm:"index"`
+	RecoveryID *uint
+	Action     string
+	Actor      string
+	Detail     string
+	CreatedAt  time.Time
+	PrevHash   string
+	Hash       string
+}
+
 type AuditEvent struct {
-	ID           uint `gorm:"primaryKey"`
-	EventType    string
-	UserID       *uint
-	SecretNodeID *uint
+	ID           uint   `gorm:"primaryKey"`
+	EventType    string `gorm:"index"`
+	UserID       *uint  `gorm:"index"`
+	SecretNodeID *uint  `gorm:"index"`
 	Description  string
-	EventTime    time.Time
+	IPAddress    string
+	UserAgent    string
+	Transport    string
+	// ActorKind is "service_account" for events caused by a service
+	// account's token, empty for people and background jobs
+	ActorKind string
+	// ImpersonatorID is the admin who caused the event while impersonating
+	// UserID
+	ImpersonatorID *uint     `gorm:"index"`
+	EventTime      time.Time `gorm:"index"`
 }
 
 type Setting struct {
@@ -170,15 +527,27 @@ type SystemMetadata struct {
 	UpdatedAt time.Time
 }
 
+// APIClient is a machine credential that acts as UserID, limited to its
+// scopes and namespaces
 type APIClient struct {
-	ID           uint `gorm:"primaryKey"`
-	Name         string
-	Description  string
-	ClientID     string `gorm:"unique"`
-	ClientSecret string
-	Scopes       string
-	IsActive     bool
-	CreatedAt    time.Time
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint `gorm:"index"`
+	Name        string
+	Description string
+	ClientID    string `gorm:"unique"`
+	// ClientSecret is encrypted when storage encryption is enabled
+	ClientSecret []byte
+	// PreviousSecret is the secret replaced by the last rotation; it keeps
+	// working until PreviousSecretExpiresAt
+	PreviousSecret          []byte
+	PreviousSecretExpiresAt *time.Time
+	// Scopes and NamespaceIDs are comma-separated; no namespaces means all
+	Scopes          string
+	NamespaceIDs    string
+	IsActive        bool
+	SecretRotatedAt *time.Time
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
 }
 
 type APIToken struct {
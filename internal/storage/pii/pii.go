@@ -0,0 +1,250 @@
+// Package pii encrypts the personal data of users and sessions at rest:
+// emails, and the IP addresses and user agents sessions were used from.
+// Lookups by email go through the blind index kept next to it, so the
+// address itself is never compared in SQL.
+package pii
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+)
+
+// encryptedPrefix marks an encrypted field; fields without it were written
+// before encryption was turned on and are returned as they are
+const encryptedPrefix = "enc:"
+
+// Cipher encrypts and decrypts field values; *encryption.Service
+// satisfies it
+type Cipher interface {
+	EncryptSecret(plaintext []byte) ([]byte, []byte, error)
+	DecryptSecret(encryptedData []byte) ([]byte, error)
+}
+
+// Storage encrypts user and session fields on their way into the wrapped
+// storage and decrypts them on their way out
+type Storage struct {
+	storage.Storage
+	cipher Cipher
+}
+
+// Wrap returns s with the personal data of users and sessions encrypted
+// by cipher
+func Wrap(s storage.Storage, cipher Cipher) *Storage {
+	return &Storage{Storage: s, cipher: cipher}
+}
+
+func (s *Storage) Users() repository.UserRepository {
+	return &userRepo{UserRepository: s.Storage.Users(), s: s}
+}
+
+func (s *Storage) Sessions() repository.SessionRepository {
+	return &sessionRepo{SessionRepository: s.Storage.Sessions(), s: s}
+}
+
+func (s *Storage) WithTransaction(fn func(tx storage.Storage) error) error {
+	return s.Storage.WithTransaction(func(tx storage.Storage) error {
+		return fn(Wrap(tx, s.cipher))
+	})
+}
+
+// EncryptExisting encrypts the emails of users stored before encryption
+// was turned on and returns how many it encrypted. Sessions are left to
+// expire.
+func (s *Storage) EncryptExisting() (int, error) {
+	encrypted := 0
+	var afterID uint
+	for {
+		users, err := s.Storage.Users().ListAfter(afterID, 500)
+		if err != nil {
+			return encrypted, fmt.Errorf("failed to list users: %w", err)
+		}
+		if len(users) == 0 {
+			return encrypted, nil
+		}
+		for _, user := range users {
+			if user.Email == "" || strings.HasPrefix(user.Email, encryptedPrefix) {
+				continue
+			}
+			email, err := s.encrypt(user.Email)
+			if err != nil {
+				return encrypted, err
+			}
+			if err := s.Storage.Users().SetEmail(user.ID, email, user.EmailIndex); err != nil {
+				return encrypted, fmt.Errorf("failed to encrypt email of user %q: %w", user.Username, err)
+			}
+			encrypted++
+		}
+		afterID = users[len(users)-1].ID
+	}
+}
+
+func (s *Storage) encrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	data, _, err := s.cipher.EncryptSecret([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt personal data: %w", err)
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (s *Storage) decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode personal data: %w", err)
+	}
+	plaintext, err := s.cipher.DecryptSecret(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt personal data: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+type userRepo struct {
+	repository.UserRepository
+	s *Storage
+}
+
+func (r *userRepo) decryptUser(user *models.User, err error) (*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	if user.Email, err = r.s.decrypt(user.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepo) decryptUsers(users []models.User, err error) ([]models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if _, err := r.decryptUser(&users[i], nil); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// Create stores user with its email encrypted; user keeps the plaintext
+func (r *userRepo) Create(user *models.User) error {
+	stored := *user
+	var err error
+	if stored.Email, err = r.s.encrypt(user.Email); err != nil {
+		return err
+	}
+	err = r.UserRepository.Create(&stored)
+	stored.Email = user.Email
+	*user = stored
+	return err
+}
+
+func (r *userRepo) FindByUsername(username string) (*models.User, error) {
+	return r.decryptUser(r.UserRepository.FindByUsername(username))
+}
+
+func (r *userRepo) FindByEmailIndex(emailIndex string) (*models.User, error) {
+	return r.decryptUser(r.UserRepository.FindByEmailIndex(emailIndex))
+}
+
+func (r *userRepo) FindByID(id uint) (*models.User, error) {
+	return r.decryptUser(r.UserRepository.FindByID(id))
+}
+
+func (r *userRepo) FindByIDs(ids []uint) ([]models.User, error) {
+	return r.decryptUsers(r.UserRepository.FindByIDs(ids))
+}
+
+func (r *userRepo) List() ([]models.User, error) {
+	return r.decryptUsers(r.UserRepository.List())
+}
+
+func (r *userRepo) ListAfter(afterID uint, limit int) ([]models.User, error) {
+	return r.decryptUsers(r.UserRepository.ListAfter(afterID, limit))
+}
+
+func (r *userRepo) SetEmail(id uint, email, emailIndex string) error {
+	encrypted, err := r.s.encrypt(email)
+	if err != nil {
+		return err
+	}
+	return r.UserRepository.SetEmail(id, encrypted, emailIndex)
+}
+
+type sessionRepo struct {
+	repository.SessionRepository
+	s *Storage
+}
+
+func (r *sessionRepo) decryptSession(session *models.Session) error {
+	var err error
+	if session.IPAddress, err = r.s.decrypt(session.IPAddress); err != nil {
+		return err
+	}
+	session.UserAgent, err = r.s.decrypt(session.UserAgent)
+	return err
+}
+
+// Create stores session with its client encrypted; session keeps the
+// plaintext
+func (r *sessionRepo) Create(session *models.Session) error {
+	stored := *session
+	var err error
+	if stored.IPAddress, err = r.s.encrypt(session.IPAddress); err != nil {
+		return err
+	}
+	if stored.UserAgent, err = r.s.encrypt(session.UserAgent); err != nil {
+		return err
+	}
+	err = r.SessionRepository.Create(&stored)
+	stored.IPAddress, stored.UserAgent = session.IPAddress, session.UserAgent
+	*session = stored
+	return err
+}
+
+func (r *sessionRepo) GetByToken(token string) (*models.Session, error) {
+	session, err := r.SessionRepository.GetByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	sessions, err := r.SessionRepository.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if err := r.decryptSession(&sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepo) Touch(id uint, seenAt time.Time, ipAddress, userAgent string) error {
+	ipAddress, err := r.s.encrypt(ipAddress)
+	if err != nil {
+		return err
+	}
+	if userAgent, err = r.s.encrypt(userAgent); err != nil {
+		return err
+	}
+	return r.SessionRepository.Touch(id, seenAt, ipAddress, userAgent)
+}
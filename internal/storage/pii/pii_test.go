@@ -0,0 +1,82 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// reverser stands in for the encryption service
+type reverser struct{}
+
+func (reverser) EncryptSecret(plaintext []byte) ([]byte, []byte, error) {
+	out := make([]byte, len(plaintext))
+	for i, b := range plaintext {
+		out[len(plaintext)-1-i] = b
+	}
+	return out, nil, nil
+}
+
+func (r reverser) DecryptSecret(data []byte) ([]byte, error) {
+	out, _, err := r.EncryptSecret(data)
+	return out, err
+}
+
+func TestUsersAndSessions(t *testing.T) {
+	raw := memory.New()
+	legacy := &models.User{Username: "bob", Email: "bob@example.com", EmailIndex: "bob-index"}
+	if err := raw.Users().Create(legacy); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	s := Wrap(raw, reverser{})
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", EmailIndex: "alice-index"}
+	if err := s.Users().Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.ID == 0 || user.Email != "alice@example.com" {
+		t.Errorf("Expected the caller's user to keep its email and get an ID, got %+v", user)
+	}
+	stored, _ := raw.Users().FindByID(user.ID)
+	if !strings.HasPrefix(stored.Email, encryptedPrefix) || strings.Contains(stored.Email, "alice") {
+		t.Errorf("Expected the stored email to be encrypted, got %q", stored.Email)
+	}
+	found, err := s.Users().FindByEmailIndex("alice-index")
+	if err != nil || found.Email != "alice@example.com" {
+		t.Errorf("Expected to find alice by email index, got %+v, %v", found, err)
+	}
+
+	if n, err := s.EncryptExisting(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 email to be encrypted, got %d, %v", n, err)
+	}
+	if stored, _ := raw.Users().FindByID(legacy.ID); !strings.HasPrefix(stored.Email, encryptedPrefix) {
+		t.Errorf("Expected the existing email to be encrypted, got %q", stored.Email)
+	}
+	users, err := s.Users().List()
+	if err != nil || len(users) != 2 || users[0].Email != "bob@example.com" {
+		t.Errorf("Expected decrypted users, got %+v, %v", users, err)
+	}
+
+	err = s.WithTransaction(func(tx storage.Storage) error {
+		session := &models.Session{UserID: user.ID, SessionToken: "token", IPAddress: "192.0.2.1", UserAgent: "curl/8.0"}
+		if err := tx.Sessions().Create(session); err != nil {
+			return err
+		}
+		return tx.Sessions().Touch(session.ID, time.Now(), "192.0.2.2", "curl/8.0")
+	})
+	if err != nil {
+		t.Fatalf("Failed to store session: %v", err)
+	}
+	rawSession, _ := raw.Sessions().GetByToken("token")
+	if strings.Contains(rawSession.IPAddress, "192.0.2") || strings.Contains(rawSession.UserAgent, "curl") {
+		t.Errorf("Expected the stored client to be encrypted, got %+v", rawSession)
+	}
+	session, err := s.Sessions().GetByToken("token")
+	if err != nil || session.IPAddress != "192.0.2.2" || session.UserAgent != "curl/8.0" {
+		t.Errorf("Expected the decrypted client, got %+v, %v", session, err)
+	}
+}
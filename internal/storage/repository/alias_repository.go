@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// AliasRepository хранит прежние имена переименованных и перемещённых
+// секретов
+type AliasRepository interface {
+	Create(alias *models.SecretAlias) error
+	FindByNameKey(nameKey string) ([]models.SecretAlias, error)
+	ListBySecret(secretID uint) ([]models.SecretAlias, error)
+	List() ([]models.SecretAlias, error)
+	SetNameKey(id uint, nameKey string) error
+}
+
+type aliasRepo struct {
+	db *gorm.DB
+}
+
+func NewAliasRepository(db *gorm.DB) AliasRepository {
+	return &aliasRepo{db}
+}
+
+// Create сохраняет прежнее имя секрета
+func (r *aliasRepo) Create(alias *models.SecretAlias) error {
+	return r.db.Create(alias).Error
+}
+
+// FindByNameKey возвращает псевдонимы с данным слепым индексом имени во
+// всех пространствах имён, начиная с самого нового
+func (r *aliasRepo) FindByNameKey(nameKey string) ([]models.SecretAlias, error) {
+	var aliases []models.SecretAlias
+	err := r.db.Where("name_key = ?", nameKey).Order("id DESC").Find(&aliases).Error
+	return aliases, err
+}
+
+// ListBySecret возвращает все прежние имена секрета по ID
+func (r *aliasRepo) ListBySecret(secretID uint) ([]models.SecretAlias, error) {
+	var aliases []models.SecretAlias
+	err := r.db.Where("secret_node_id = ?", secretID).Order("id").Find(&aliases).Error
+	return aliases, err
+}
+
+// List возвращает все прежние имена по ID
+func (r *aliasRepo) List() ([]models.SecretAlias, error) {
+	var aliases []models.SecretAlias
+	err := r.db.Order("id").Find(&aliases).Error
+	return aliases, err
+}
+
+// SetNameKey заменяет слепой индекс прежнего имени
+func (r *aliasRepo) SetNameKey(id uint, nameKey string) error {
+	return r.db.Model(&models.SecretAlias{}).Where("id = ?", id).Update("name_key", nameKey).Error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// APIClientRepository хранит учётные данные API-клиентов
+type APIClientRepository interface {
+	Create(client *models.APIClient) error
+	GetByClientID(clientID string) (*models.APIClient, error)
+	ListByUser(userID uint) ([]models.APIClient, error)
+	Update(client *models.APIClient) error
+	RecordUse(id uint, usedAt time.Time) error
+	Delete(id uint) error
+}
+
+type apiClientRepo struct {
+	db *gorm.DB
+}
+
+func NewAPIClientRepository(db *gorm.DB) APIClientRepository {
+	return &apiClientRepo{db}
+}
+
+// Create сохраняет нового клиента
+func (r *apiClientRepo) Create(client *models.APIClient) error {
+	return r.db.Create(client).Error
+}
+
+// GetByClientID возвращает клиента по публичному идентификатору
+func (r *apiClientRepo) GetByClientID(clientID string) (*models.APIClient, error) {
+	var client models.APIClient
+	if err := r.db.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListByUser возвращает клиентов пользователя в порядке создания
+func (r *apiClientRepo) ListByUser(userID uint) ([]models.APIClient, error) {
+	var clients []models.APIClient
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&clients).Error
+	return clients, err
+}
+
+// Update сохраняет все поля клиента
+func (r *apiClientRepo) Update(client *models.APIClient) error {
+	return r.db.Save(client).Error
+}
+
+// RecordUse сохраняет время последнего входа клиента
+func (r *apiClientRepo) RecordUse(id uint, usedAt time.Time) error {
+	return r.db.Model(&models.APIClient{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
+
+// Delete удаляет клиента по ID
+func (r *apiClientRepo) Delete(id uint) error {
+	return r.db.Delete(&models.APIClient{}, id).Error
+}
@@ -1,13 +1,34 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/secretlyhq/secretly/internal/storage/models"
 	"gorm.io/gorm"
 )
 
+// AuditQuery фильтрует список событий аудита с keyset-пагинацией. Нулевые
+// значения означают «без фильтра»; Limit 0 возвращает все оставшиеся события.
+// События упорядочены по ID, который следует порядку записи; с Descending
+// новые идут первыми, а AfterID в обоих случаях — последний ID предыдущей
+// страницы.
+type AuditQuery struct {
+	From       time.Time
+	To         time.Time
+	Types      []string
+	UserID     uint
+	SecretID   uint
+	AfterID    uint
+	Descending bool
+	Limit      int
+}
+
 type AuditRepository interface {
 	LogEvent(event *models.AuditEvent) error
+	LogEvents(events []*models.AuditEvent) error
 	ListByUser(userID uint) ([]models.AuditEvent, error)
+	ListBetween(from, to time.Time) ([]models.AuditEvent, error)
+	ListAfter(q AuditQuery) ([]models.AuditEvent, error)
 }
 
 type auditRepo struct {
@@ -23,9 +44,60 @@ func (r *auditRepo) LogEvent(event *models.AuditEvent) error {
 	return r.db.Create(event).Error
 }
 
+// LogEvents сохраняет пачку событий аудита одной транзакцией и проставляет
+// им ID. Вставка идёт по 50 строк, чтобы не превысить предел переменных
+// SQLite в одном запросе.
+func (r *auditRepo) LogEvents(events []*models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(events, 50).Error
+}
+
 // ListByUser возвращает список событий аудита для пользователя по userID
 func (r *auditRepo) ListByUser(userID uint) ([]models.AuditEvent, error) {
 	var events []models.AuditEvent
 	err := r.db.Where("user_id = ?", userID).Find(&events).Error
 	return events, err
 }
+
+// ListBetween возвращает события аудита в интервале [from, to) по порядку
+func (r *auditRepo) ListBetween(from, to time.Time) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := r.db.Where("event_time >= ? AND event_time < ?", from, to).Order("event_time, id").Find(&events).Error
+	return events, err
+}
+
+// ListAfter возвращает события аудита по фильтру q, начиная после q.AfterID
+func (r *auditRepo) ListAfter(q AuditQuery) ([]models.AuditEvent, error) {
+	query := r.db.Model(&models.AuditEvent{})
+	if q.Descending {
+		if q.AfterID != 0 {
+			query = query.Where("id < ?", q.AfterID)
+		}
+		query = query.Order("id DESC")
+	} else {
+		query = query.Where("id > ?", q.AfterID).Order("id")
+	}
+	if !q.From.IsZero() {
+		query = query.Where("event_time >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("event_time < ?", q.To)
+	}
+	if len(q.Types) > 0 {
+		query = query.Where("event_type IN ?", q.Types)
+	}
+	if q.UserID != 0 {
+		query = query.Where("user_id = ?", q.UserID)
+	}
+	if q.SecretID != 0 {
+		query = query.Where("secret_node_id = ?", q.SecretID)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var events []models.AuditEvent
+	err := query.Find(&events).Error
+	return events, err
+}
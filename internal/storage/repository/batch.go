@@ -0,0 +1,22 @@
+package repository
+
+import "gorm.io/gorm"
+
+// maxInParams ограничивает число параметров в одном IN (...): у SQLite есть
+// предел на число переменных в запросе
+const maxInParams = 500
+
+// findIn загружает записи, у которых column входит в ids, запросами по
+// maxInParams значений и упорядочивает каждую порцию по id
+func findIn[T any](db *gorm.DB, column string, ids []uint) ([]T, error) {
+	var rows []T
+	for start := 0; start < len(ids); start += maxInParams {
+		var batch []T
+		end := min(start+maxInParams, len(ids))
+		if err := db.Where(column+" IN ?", ids[start:end]).Order("id").Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		rows = append(rows, batch...)
+	}
+	return rows, nil
+}
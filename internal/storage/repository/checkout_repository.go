@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// CheckoutRepository хранит аренды секретов, требующих выдачи (check-out),
+// и тем самым историю того, у кого секрет находился
+type CheckoutRepository interface {
+	Create(co *models.SecretCheckout) error
+	Active(secretID uint) (*models.SecretCheckout, error)
+	Update(co *models.SecretCheckout) error
+	ListBySecret(secretID uint) ([]models.SecretCheckout, error)
+}
+
+type checkoutRepo struct {
+	db *gorm.DB
+}
+
+func NewCheckoutRepository(db *gorm.DB) CheckoutRepository {
+	return &checkoutRepo{db}
+}
+
+// Create сохраняет новую аренду
+func (r *checkoutRepo) Create(co *models.SecretCheckout) error {
+	return r.db.Create(co).Error
+}
+
+// Active возвращает последнюю невозвращённую аренду секрета
+// (gorm.ErrRecordNotFound, если секрет никем не взят)
+func (r *checkoutRepo) Active(secretID uint) (*models.SecretCheckout, error) {
+	var co models.SecretCheckout
+	err := r.db.Where("secret_node_id = ? AND checked_in_at IS NULL", secretID).Order("id DESC").First(&co).Error
+	if err != nil {
+		return nil, err
+	}
+	return &co, nil
+}
+
+// Update сохраняет изменения аренды
+func (r *checkoutRepo) Update(co *models.SecretCheckout) error {
+	return r.db.Save(co).Error
+}
+
+// ListBySecret возвращает все аренды секрета по ID
+func (r *checkoutRepo) ListBySecret(secretID uint) ([]models.SecretCheckout, error) {
+	var checkouts []models.SecretCheckout
+	err := r.db.Where("secret_node_id = ?", secretID).Order("id").Find(&checkouts).Error
+	return checkouts, err
+}
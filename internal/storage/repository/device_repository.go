@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// DeviceRepository хранит зарегистрированные машины и токены регистрации
+type DeviceRepository interface {
+	CreateToken(token *models.DeviceEnrollmentToken) error
+	ConsumeToken(tokenHash string, usedAt time.Time) (*models.DeviceEnrollmentToken, error)
+	Create(device *models.Device) error
+	GetByID(id uint) (*models.Device, error)
+	GetByFingerprint(fingerprint string) (*models.Device, error)
+	List() ([]models.Device, error)
+	RecordUse(id uint, usedAt time.Time) error
+	Revoke(id uint, revokedAt time.Time) error
+}
+
+type deviceRepo struct {
+	db *gorm.DB
+}
+
+func NewDeviceRepository(db *gorm.DB) DeviceRepository {
+	return &deviceRepo{db}
+}
+
+// CreateToken сохраняет новый токен регистрации
+func (r *deviceRepo) CreateToken(token *models.DeviceEnrollmentToken) error {
+	return r.db.Create(token).Error
+}
+
+// ConsumeToken помечает неиспользованный и неистёкший токен использованным
+// и возвращает его; токен можно использовать только один раз
+func (r *deviceRepo) ConsumeToken(tokenHash string, usedAt time.Time) (*models.DeviceEnrollmentToken, error) {
+	res := r.db.Model(&models.DeviceEnrollmentToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, usedAt).
+		Update("used_at", usedAt)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var token models.DeviceEnrollmentToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Create сохраняет новую машину
+func (r *deviceRepo) Create(device *models.Device) error {
+	return r.db.Create(device).Error
+}
+
+// GetByID возвращает машину по ID
+func (r *deviceRepo) GetByID(id uint) (*models.Device, error) {
+	var device models.Device
+	if err := r.db.First(&device, id).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetByFingerprint возвращает машину по отпечатку её открытого ключа
+func (r *deviceRepo) GetByFingerprint(fingerprint string) (*models.Device, error) {
+	var device models.Device
+	if err := r.db.Where("fingerprint = ?", fingerprint).First(&device).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// List возвращает все машины в порядке регистрации
+func (r *deviceRepo) List() ([]models.Device, error) {
+	var devices []models.Device
+	err := r.db.Order("id").Find(&devices).Error
+	return devices, err
+}
+
+// RecordUse сохраняет время последнего входа машины
+func (r *deviceRepo) RecordUse(id uint, usedAt time.Time) error {
+	return r.db.Model(&models.Device{}).Where("id = ?", id).Update("last_seen_at", usedAt).Error
+}
+
+// Revoke отзывает машину; повторный отзыв сохраняет первое время
+func (r *deviceRepo) Revoke(id uint, revokedAt time.Time) error {
+	return r.db.Model(&models.Device{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", revokedAt).Error
+}
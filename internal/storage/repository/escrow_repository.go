@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// EscrowRepository хранит ключи хранителей, депонированные значения
+// секретов с долями ключей, запросы на восстановление и журнал депонирования
+type EscrowRepository interface {
+	SetCustodian(custodian *models.EscrowCustodian) error
+	GetCustodian(userID uint) (*models.EscrowCustodian, error)
+	Create(escrow *models.Escrow, shares []models.EscrowShare) error
+	Get(id uint) (*models.Escrow, error)
+	ListBySecret(secretID uint) ([]models.Escrow, error)
+	ListShares(escrowID uint) ([]models.EscrowShare, error)
+	CreateRecovery(recovery *models.EscrowRecovery) error
+	GetRecovery(id uint) (*models.EscrowRecovery, error)
+	UpdateRecovery(recovery *models.EscrowRecovery) error
+	ListRecoveries(escrowID uint) ([]models.EscrowRecovery, error)
+	AppendLog(entry *models.EscrowLogEntry) error
+	LastLog() (*models.EscrowLogEntry, error)
+	ListLog() ([]models.EscrowLogEntry, error)
+}
+
+type escrowRepo struct {
+	db *gorm.DB
+}
+
+func NewEscrowRepository(db *gorm.DB) EscrowRepository {
+	return &escrowRepo{db}
+}
+
+// SetCustodian сохраняет или заменяет открытый ключ хранителя
+func (r *escrowRepo) SetCustodian(custodian *models.EscrowCustodian) error {
+	return r.db.Save(custodian).Error
+}
+
+// GetCustodian возвращает открытый ключ хранителя по ID пользователя
+func (r *escrowRepo) GetCustodian(userID uint) (*models.EscrowCustodian, error) {
+	var custodian models.EscrowCustodian
+	if err := r.db.First(&custodian, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &custodian, nil
+}
+
+// Create сохраняет депонированное значение вместе с долями ключа в одной
+// транзакции
+func (r *escrowRepo) Create(escrow *models.Escrow, shares []models.EscrowShare) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(escrow).Error; err != nil {
+			return err
+		}
+		for i := range shares {
+			shares[i].EscrowID = escrow.ID
+		}
+		if len(shares) == 0 {
+			return nil
+		}
+		return tx.Create(&shares).Error
+	})
+}
+
+// Get возвращает депонированное значение по ID
+func (r *escrowRepo) Get(id uint) (*models.Escrow, error) {
+	var escrow models.Escrow
+	if err := r.db.First(&escrow, id).Error; err != nil {
+		return nil, err
+	}
+	return &escrow, nil
+}
+
+// ListBySecret возвращает депонированные значения секрета по ID
+func (r *escrowRepo) ListBySecret(secretID uint) ([]models.Escrow, error) {
+	var escrows []models.Escrow
+	err := r.db.Where("secret_node_id = ?", secretID).Order("id").Find(&escrows).Error
+	return escrows, err
+}
+
+// ListShares возвращает доли ключа депонированного значения
+func (r *escrowRepo) ListShares(escrowID uint) ([]models.EscrowShare, error) {
+	var shares []models.EscrowShare
+	err := r.db.Where("escrow_id = ?", escrowID).Order("id").Find(&shares).Error
+	return shares, err
+}
+
+// CreateRecovery сохраняет новый запрос на восстановление
+func (r *escrowRepo) CreateRecovery(recovery *models.EscrowRecovery) error {
+	return r.db.Create(recovery).Error
+}
+
+// GetRecovery возвращает запрос на восстановление по ID
+func (r *escrowRepo) GetRecovery(id uint) (*models.EscrowRecovery, error) {
+	var recovery models.EscrowRecovery
+	if err := r.db.First(&recovery, id).Error; err != nil {
+		return nil, err
+	}
+	return &recovery, nil
+}
+
+// UpdateRecovery сохраняет изменения запроса на восстановление
+func (r *escrowRepo) UpdateRecovery(recovery *models.EscrowRecovery) error {
+	return r.db.Save(recovery).Error
+}
+
+// ListRecoveries возвращает запросы на восстановление депонированного
+// значения
+func (r *escrowRepo) ListRecoveries(escrowID uint) ([]models.EscrowRecovery, error) {
+	var recoveries []models.EscrowRecovery
+	err := r.db.Where("escrow_id = ?", escrowID).Order("id").Find(&recoveries).Error
+	return recoveries, err
+}
+
+// AppendLog добавляет запись в журнал депонирования
+func (r *escrowRepo) AppendLog(entry *models.EscrowLogEntry) error {
+	return r.db.Create(entry).Error
+}
+
+// LastLog возвращает последнюю запись журнала или nil, если журнал пуст
+func (r *escrowRepo) LastLog() (*models.EscrowLogEntry, error) {
+	var entry models.EscrowLogEntry
+	err := r.db.Order("id DESC").First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListLog возвращает весь журнал депонирования по порядку
+func (r *escrowRepo) ListLog() ([]models.EscrowLogEntry, error) {
+	var entries []models.EscrowLogEntry
+	err := r.db.Order("id").Find(&entries).Error
+	return entries, err
+}
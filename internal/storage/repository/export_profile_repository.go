@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// ExportProfileRepository хранит профили экспорта секретов в переменные
+// окружения
+type ExportProfileRepository interface {
+	Save(profile *models.ExportProfile) error
+	FindByName(name string) (*models.ExportProfile, error)
+	List() ([]models.ExportProfile, error)
+	Delete(name string) error
+}
+
+type exportProfileRepo struct {
+	db *gorm.DB
+}
+
+func NewExportProfileRepository(db *gorm.DB) ExportProfileRepository {
+	return &exportProfileRepo{db}
+}
+
+// Save создаёт профиль или заменяет профиль с тем же именем
+func (r *exportProfileRepo) Save(profile *models.ExportProfile) error {
+	var existing models.ExportProfile
+	err := r.db.Where("name = ?", profile.Name).First(&existing).Error
+	switch {
+	case err == nil:
+		profile.ID, profile.CreatedAt = existing.ID, existing.CreatedAt
+		return r.db.Save(profile).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return r.db.Create(profile).Error
+	}
+	return err
+}
+
+// FindByName возвращает профиль по имени
+func (r *exportProfileRepo) FindByName(name string) (*models.ExportProfile, error) {
+	var profile models.ExportProfile
+	if err := r.db.Where("name = ?", name).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// List возвращает все профили по имени
+func (r *exportProfileRepo) List() ([]models.ExportProfile, error) {
+	var profiles []models.ExportProfile
+	err := r.db.Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+// Delete удаляет профиль (gorm.ErrRecordNotFound, если его нет)
+func (r *exportProfileRepo) Delete(name string) error {
+	result := r.db.Where("name = ?", name).Delete(&models.ExportProfile{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// GrantRepository хранит права пользователей на папки и секреты
+type GrantRepository interface {
+	Set(grant *models.SecretGrant) error
+	Delete(nodeID, userID uint) error
+	ListByNode(nodeID uint) ([]models.SecretGrant, error)
+	ListByNodes(nodeIDs []uint) ([]models.SecretGrant, error)
+	HasFolderGrants() (bool, error)
+}
+
+type grantRepo struct {
+	db *gorm.DB
+}
+
+func NewGrantRepository(db *gorm.DB) GrantRepository {
+	return &grantRepo{db}
+}
+
+// Set создаёт право пользователя на узел или меняет уровень существующего
+func (r *grantRepo) Set(grant *models.SecretGrant) error {
+	return r.db.Where("secret_node_id = ? AND user_id = ?", grant.SecretNodeID, grant.UserID).
+		Assign(models.SecretGrant{Level: grant.Level, GrantedBy: grant.GrantedBy}).
+		FirstOrCreate(grant).Error
+}
+
+// Delete отзывает право пользователя на узел (gorm.ErrRecordNotFound, если
+// его не было)
+func (r *grantRepo) Delete(nodeID, userID uint) error {
+	result := r.db.Where("secret_node_id = ? AND user_id = ?", nodeID, userID).Delete(&models.SecretGrant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListByNode возвращает права, выданные непосредственно на узел
+func (r *grantRepo) ListByNode(nodeID uint) ([]models.SecretGrant, error) {
+	var grants []models.SecretGrant
+	err := r.db.Where("secret_node_id = ?", nodeID).Order("id").Find(&grants).Error
+	return grants, err
+}
+
+// ListByNodes возвращает права, выданные непосредственно на любой из узлов,
+// несколькими запросами вместо запроса на каждый узел
+func (r *grantRepo) ListByNodes(nodeIDs []uint) ([]models.SecretGrant, error) {
+	return findIn[models.SecretGrant](r.db, "secret_node_id", nodeIDs)
+}
+
+// HasFolderGrants сообщает, есть ли права хотя бы на одну папку, то есть
+// могут ли секреты наследовать права
+func (r *grantRepo) HasFolderGrants() (bool, error) {
+	var count int64
+	err := r.db.Model(&models.SecretGrant{}).
+		Joins("JOIN secret_nodes ON secret_nodes.id = secret_grants.secret_node_id").
+		Where("secret_nodes.is_secret = ?", false).Limit(1).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// OperationRepository хранит операции, ожидающие подтверждения вторым
+// администратором
+type OperationRepository interface {
+	Create(op *models.PendingOperation) error
+	GetByID(id uint) (*models.PendingOperation, error)
+	List(status string) ([]models.PendingOperation, error)
+	Update(op *models.PendingOperation) error
+	UpdateIfPending(op *models.PendingOperation) (bool, error)
+}
+
+type operationRepo struct {
+	db *gorm.DB
+}
+
+func NewOperationRepository(db *gorm.DB) OperationRepository {
+	return &operationRepo{db}
+}
+
+// Create сохраняет новую операцию
+func (r *operationRepo) Create(op *models.PendingOperation) error {
+	return r.db.Create(op).Error
+}
+
+// GetByID возвращает операцию по ID
+func (r *operationRepo) GetByID(id uint) (*models.PendingOperation, error) {
+	var op models.PendingOperation
+	if err := r.db.First(&op, id).Error; err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// List возвращает операции с указанным статусом (все при пустом статусе) по ID
+func (r *operationRepo) List(status string) ([]models.PendingOperation, error) {
+	query := r.db.Order("id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var ops []models.PendingOperation
+	err := query.Find(&ops).Error
+	return ops, err
+}
+
+// Update сохраняет изменения операции
+func (r *operationRepo) Update(op *models.PendingOperation) error {
+	return r.db.Save(op).Error
+}
+
+// UpdateIfPending сохраняет решение по операции, только если она всё ещё
+// ожидает подтверждения; false означает, что решение уже принято другим
+// запросом
+func (r *operationRepo) UpdateIfPending(op *models.PendingOperation) (bool, error) {
+	result := r.db.Model(&models.PendingOperation{}).Where("id = ? AND status = ?", op.ID, "pending").
+		UpdateColumns(map[string]interface{}{
+			"status":     op.Status,
+			"decided_by": op.DecidedBy,
+			"decided_at": op.DecidedAt,
+			"reason":     op.Reason,
+		})
+	return result.RowsAffected == 1, result.Error
+}
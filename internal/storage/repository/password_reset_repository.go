@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// PasswordResetRepository хранит запросы на сброс пароля
+type PasswordResetRepository interface {
+	Create(reset *models.PasswordReset) error
+	GetByToken(token string) (*models.PasswordReset, error)
+	Consume(token string, now time.Time) (bool, error)
+	CountSince(userID uint, since time.Time) (int64, error)
+	DeleteByUser(userID uint) error
+}
+
+type passwordResetRepo struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &passwordResetRepo{db}
+}
+
+// Create сохраняет новый запрос на сброс
+func (r *passwordResetRepo) Create(reset *models.PasswordReset) error {
+	return r.db.Create(reset).Error
+}
+
+// GetByToken возвращает запрос по хешу токена
+func (r *passwordResetRepo) GetByToken(token string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := r.db.Where("token = ?", token).First(&reset).Error; err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// Consume удаляет запрос с этим хешем токена, если срок его действия не
+// истёк к моменту now; false означает, что токен уже использован другим
+// запросом, истёк или не существует
+func (r *passwordResetRepo) Consume(token string, now time.Time) (bool, error) {
+	result := r.db.Where("token = ? AND (expires_at IS NULL OR expires_at > ?)", token, now).Delete(&models.PasswordReset{})
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountSince возвращает число запросов пользователя, созданных начиная с since
+func (r *passwordResetRepo) CountSince(userID uint, since time.Time) (int64, error) {
+	var n int64
+	err := r.db.Model(&models.PasswordReset{}).Where("user_id = ? AND created_at >= ?", userID, since).Count(&n).Error
+	return n, err
+}
+
+// DeleteByUser удаляет все запросы пользователя
+func (r *passwordResetRepo) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.PasswordReset{}).Error
+}
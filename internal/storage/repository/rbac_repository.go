@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// RBACChangeQuery фильтрует список изменений политики доступа с
+// keyset-пагинацией, новые первыми. Нулевые значения означают «без фильтра»;
+// AfterID — последний ID предыдущей страницы, Limit 0 возвращает все
+// оставшиеся изменения.
+type RBACChangeQuery struct {
+	From    time.Time
+	To      time.Time
+	Kind    string
+	Name    string
+	Actor   string
+	AfterID uint
+	Limit   int
+}
+
+// RBACRepository хранит роли, группы, членство пользователей в группах и
+// назначения ролей пользователям и группам
+type RBACRepository interface {
+	ListRoles() ([]models.Role, error)
+	SaveRole(role *models.Role) error
+	DeleteRole(id uint) error
+	ListGroups() ([]models.Group, error)
+	SaveGroup(group *models.Group) error
+	DeleteGroup(id uint) error
+	ListMembers() ([]models.UserGroup, error)
+	AddMember(member *models.UserGroup) error
+	RemoveMember(member *models.UserGroup) error
+	ListUserRoles() ([]models.UserRole, error)
+	AssignUserRole(assignment *models.UserRole) error
+	UnassignUserRole(assignment *models.UserRole) error
+	ListGroupRoles() ([]models.GroupRole, error)
+	AssignGroupRole(assignment *models.GroupRole) error
+	UnassignGroupRole(assignment *models.GroupRole) error
+	ListDenyRules() ([]models.DenyRule, error)
+	SaveDenyRule(rule *models.DenyRule) error
+	DeleteDenyRule(id uint) error
+	LogChange(change *models.RBACChangeLog) error
+	ListChanges(q RBACChangeQuery) ([]models.RBACChangeLog, error)
+}
+
+type rbacRepo struct {
+	db *gorm.DB
+}
+
+func NewRBACRepository(db *gorm.DB) RBACRepository {
+	return &rbacRepo{db}
+}
+
+// ListRoles возвращает все роли по имени
+func (r *rbacRepo) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// SaveRole создаёт роль или обновляет роль с тем же именем
+func (r *rbacRepo) SaveRole(role *models.Role) error {
+	var existing []models.Role
+	if err := r.db.Where("name = ?", role.Name).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return r.db.Create(role).Error
+	}
+	role.ID = existing[0].ID
+	return r.db.Save(role).Error
+}
+
+// DeleteRole удаляет роль вместе с её назначениями
+func (r *rbacRepo) DeleteRole(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.GroupRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, id).Error
+	})
+}
+
+// ListGroups возвращает все группы по имени
+func (r *rbacRepo) ListGroups() ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.Order("name").Find(&groups).Error
+	return groups, err
+}
+
+// SaveGroup создаёт группу или обновляет группу с тем же именем
+func (r *rbacRepo) SaveGroup(group *models.Group) error {
+	var existing []models.Group
+	if err := r.db.Where("name = ?", group.Name).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return r.db.Create(group).Error
+	}
+	group.ID = existing[0].ID
+	return r.db.Save(group).Error
+}
+
+// DeleteGroup удаляет группу вместе с участниками и назначенными ролями
+func (r *rbacRepo) DeleteGroup(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&models.UserGroup{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&models.GroupRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Group{}, id).Error
+	})
+}
+
+// ListMembers возвращает членство всех пользователей во всех группах
+func (r *rbacRepo) ListMembers() ([]models.UserGroup, error) {
+	var members []models.UserGroup
+	err := r.db.Order("group_id, user_id").Find(&members).Error
+	return members, err
+}
+
+// AddMember добавляет пользователя в группу, если его там ещё нет
+func (r *rbacRepo) AddMember(member *models.UserGroup) error {
+	return r.db.Where(member).FirstOrCreate(member).Error
+}
+
+// RemoveMember исключает пользователя из группы
+func (r *rbacRepo) RemoveMember(member *models.UserGroup) error {
+	return r.db.Where("group_id = ? AND user_id = ?", member.GroupID, member.UserID).Delete(&models.UserGroup{}).Error
+}
+
+// ListUserRoles возвращает роли, назначенные пользователям напрямую
+func (r *rbacRepo) ListUserRoles() ([]models.UserRole, error) {
+	var assignments []models.UserRole
+	err := r.db.Order("user_id, role_id").Find(&assignments).Error
+	return assignments, err
+}
+
+// AssignUserRole назначает роль пользователю или меняет пространство имён
+// существующего назначения
+func (r *rbacRepo) AssignUserRole(assignment *models.UserRole) error {
+	return r.db.Save(assignment).Error
+}
+
+// UnassignUserRole снимает роль с пользователя
+func (r *rbacRepo) UnassignUserRole(assignment *models.UserRole) error {
+	return r.db.Where("user_id = ? AND role_id = ?", assignment.UserID, assignment.RoleID).Delete(&models.UserRole{}).Error
+}
+
+// ListGroupRoles возвращает роли, назначенные группам
+func (r *rbacRepo) ListGroupRoles() ([]models.GroupRole, error) {
+	var assignments []models.GroupRole
+	err := r.db.Order("group_id, role_id").Find(&assignments).Error
+	return assignments, err
+}
+
+// AssignGroupRole назначает роль группе или меняет пространство имён
+// существующего назначения
+func (r *rbacRepo) AssignGroupRole(assignment *models.GroupRole) error {
+	return r.db.Save(assignment).Error
+}
+
+// UnassignGroupRole снимает роль с группы
+func (r *rbacRepo) UnassignGroupRole(assignment *models.GroupRole) error {
+	return r.db.Where("group_id = ? AND role_id = ?", assignment.GroupID, assignment.RoleID).Delete(&models.GroupRole{}).Error
+}
+
+// ListDenyRules возвращает все запрещающие правила по имени
+func (r *rbacRepo) ListDenyRules() ([]models.DenyRule, error) {
+	var rules []models.DenyRule
+	err := r.db.Order("name").Find(&rules).Error
+	return rules, err
+}
+
+// SaveDenyRule создаёт запрещающее правило или заменяет правило с тем же именем
+func (r *rbacRepo) SaveDenyRule(rule *models.DenyRule) error {
+	var existing []models.DenyRule
+	if err := r.db.Where("name = ?", rule.Name).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return r.db.Create(rule).Error
+	}
+	rule.ID, rule.CreatedAt = existing[0].ID, existing[0].CreatedAt
+	return r.db.Save(rule).Error
+}
+
+// DeleteDenyRule удаляет запрещающее правило
+func (r *rbacRepo) DeleteDenyRule(id uint) error {
+	return r.db.Delete(&models.DenyRule{}, id).Error
+}
+
+// LogChange сохраняет изменение политики доступа со снимками до и после
+func (r *rbacRepo) LogChange(change *models.RBACChangeLog) error {
+	return r.db.Create(change).Error
+}
+
+// ListChanges возвращает изменения политики доступа по фильтру q, новые первыми
+func (r *rbacRepo) ListChanges(q RBACChangeQuery) ([]models.RBACChangeLog, error) {
+	query := r.db.Model(&models.RBACChangeLog{}).Order("id DESC")
+	if q.AfterID != 0 {
+		query = query.Where("id < ?", q.AfterID)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("changed_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("changed_at < ?", q.To)
+	}
+	if q.Kind != "" {
+		query = query.Where("kind = ?", q.Kind)
+	}
+	if q.Name != "" {
+		query = query.Where("name = ?", q.Name)
+	}
+	if q.Actor != "" {
+		query = query.Where("actor = ?", q.Actor)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var changes []models.RBACChangeLog
+	err := query.Find(&changes).Error
+	return changes, err
+}
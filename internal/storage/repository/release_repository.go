@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// ReleaseRepository хранит запланированные раскрытия секретов получателям
+type ReleaseRepository interface {
+	Create(release *models.SecretRelease) error
+	Get(id uint) (*models.SecretRelease, error)
+	Update(release *models.SecretRelease) error
+	ListBySecret(secretID uint) ([]models.SecretRelease, error)
+	ListByStatus(status string) ([]models.SecretRelease, error)
+}
+
+type releaseRepo struct {
+	db *gorm.DB
+}
+
+func NewReleaseRepository(db *gorm.DB) ReleaseRepository {
+	return &releaseRepo{db}
+}
+
+// Create сохраняет новое раскрытие
+func (r *releaseRepo) Create(release *models.SecretRelease) error {
+	return r.db.Create(release).Error
+}
+
+// Get возвращает раскрытие по ID
+func (r *releaseRepo) Get(id uint) (*models.SecretRelease, error) {
+	var release models.SecretRelease
+	if err := r.db.First(&release, id).Error; err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// Update сохраняет изменения раскрытия
+func (r *releaseRepo) Update(release *models.SecretRelease) error {
+	return r.db.Save(release).Error
+}
+
+// ListBySecret возвращает все раскрытия секрета по ID
+func (r *releaseRepo) ListBySecret(secretID uint) ([]models.SecretRelease, error) {
+	var releases []models.SecretRelease
+	err := r.db.Where("secret_node_id = ?", secretID).Order("id").Find(&releases).Error
+	return releases, err
+}
+
+// ListByStatus возвращает раскрытия в заданном состоянии по ID
+func (r *releaseRepo) ListByStatus(status string) ([]models.SecretRelease, error) {
+	var releases []models.SecretRelease
+	err := r.db.Where("status = ?", status).Order("id").Find(&releases).Error
+	return releases, err
+}
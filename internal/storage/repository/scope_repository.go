@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// ScopeRepository хранит пространства имён, зоны и окружения, в которых
+// размещаются секреты
+type ScopeRepository interface {
+	CreateNamespace(namespace *models.Namespace) error
+	ListNamespaces() ([]models.Namespace, error)
+	CreateZone(zone *models.Zone) error
+	ListZones() ([]models.Zone, error)
+	CreateEnvironment(environment *models.Environment) error
+	ListEnvironments() ([]models.Environment, error)
+}
+
+type scopeRepo struct {
+	db *gorm.DB
+}
+
+func NewScopeRepository(db *gorm.DB) ScopeRepository {
+	return &scopeRepo{db}
+}
+
+// CreateNamespace добавляет пространство имён
+func (r *scopeRepo) CreateNamespace(namespace *models.Namespace) error {
+	return r.db.Create(namespace).Error
+}
+
+// ListNamespaces возвращает все пространства имён по ID
+func (r *scopeRepo) ListNamespaces() ([]models.Namespace, error) {
+	var namespaces []models.Namespace
+	err := r.db.Order("id").Find(&namespaces).Error
+	return namespaces, err
+}
+
+// CreateZone добавляет зону
+func (r *scopeRepo) CreateZone(zone *models.Zone) error {
+	return r.db.Create(zone).Error
+}
+
+// ListZones возвращает все зоны по ID
+func (r *scopeRepo) ListZones() ([]models.Zone, error) {
+	var zones []models.Zone
+	err := r.db.Order("id").Find(&zones).Error
+	return zones, err
+}
+
+// CreateEnvironment добавляет окружение
+func (r *scopeRepo) CreateEnvironment(environment *models.Environment) error {
+	return r.db.Create(environment).Error
+}
+
+// ListEnvironments возвращает все окружения по ID
+func (r *scopeRepo) ListEnvironments() ([]models.Environment, error) {
+	var environments []models.Environment
+	err := r.db.Order("id").Find(&environments).Error
+	return environments, err
+}
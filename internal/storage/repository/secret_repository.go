@@ -1,14 +1,73 @@
 package repository
 
 import (
+	"slices"
+	"time"
+	"unicode/utf8"
+
 	"github.com/secretlyhq/secretly/internal/storage/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// SecretQuery фильтрует список секретов. Нулевые значения означают «без
+// фильтра»; Limit 0 возвращает все оставшиеся секреты.
+type SecretQuery struct {
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	// Name сравнивается с именем целиком, а Prefix — с его началом, с учётом
+	// регистра. С NameKey секреты ищутся по слепому индексу имени, и лишь
+	// секреты без него, чьи имена совпадают с другими, — по Name.
+	Name    string
+	NameKey string
+	Prefix  string
+	// IsSecret при true выбирает только секреты, при false — только папки;
+	// nil выбирает и те, и другие
+	IsSecret *bool
+	// ReadableBy исключает узлы с собственными правами доступа, ни одно из
+	// которых не разрешает читателю чтение, если читатель ими не владеет
+	ReadableBy *SecretReader
+	AfterID    uint // только для ListAfter
+	// Sort — один из SecretSorts, по умолчанию "id"; равные упорядочиваются
+	// по ID. ListAfter игнорирует Sort, Descending и Offset.
+	Sort       string
+	Descending bool
+	Offset     int
+	Limit      int
+}
+
+// SecretReader — пользователь, для которого фильтруется список
+type SecretReader struct {
+	UserID   uint
+	Username string
+}
+
+// SecretSorts — столбцы, по которым можно упорядочить список секретов
+var SecretSorts = []string{"id", "name", "created_at", "updated_at", "expiration"}
+
 type SecretRepository interface {
 	Create(secret *models.SecretNode) error
 	GetByID(id uint) (*models.SecretNode, error)
+	GetByIDs(ids []uint) ([]models.SecretNode, error)
+	List() ([]models.SecretNode, error)
+	ListAfter(q SecretQuery) ([]models.SecretNode, error)
+	Query(q SecretQuery) ([]models.SecretNode, error)
+	Count(q SecretQuery) (int64, error)
+	FindByNameKey(namespaceID, zoneID, environmentID uint, nameKey string) (*models.SecretNode, error)
+	ListChildren(parentID uint) ([]models.SecretNode, error)
+	Update(secret *models.SecretNode) error
+	TouchIfUnchanged(id uint, updatedAt time.Time) (bool, error)
 	GetVersions(secretID uint) ([]models.SecretVersion, error)
+	CreateVersion(version *models.SecretVersion) error
+	UpdateVersion(version *models.SecretVersion) error
+	UpdateVersionContent(version *models.SecretVersion) error
+	ConsumeRead(versionID uint, maxReads *int) (int, error)
+	CreateChunk(chunk *models.SecretChunk) error
+	GetChunk(versionID uint, index int) (*models.SecretChunk, error)
+	RecordKeyRead(versionID uint, key string) error
+	GetKeyReads(versionID uint) ([]models.SecretKeyRead, error)
 	Delete(secretID uint) error
 }
 
@@ -33,12 +92,236 @@ func (r *secretRepo) GetByID(id uint) (*models.SecretNode, error) {
 	return &secret, nil
 }
 
+// GetByIDs возвращает узлы с указанными ID, упорядоченные по ID;
+// отсутствующие пропускает
+func (r *secretRepo) GetByIDs(ids []uint) ([]models.SecretNode, error) {
+	return findIn[models.SecretNode](r.db, "id", ids)
+}
+
+func (r *secretRepo) List() ([]models.SecretNode, error) {
+	var secrets []models.SecretNode
+	err := r.db.Order("id").Find(&secrets).Error
+	return secrets, err
+}
+
+// ListAfter возвращает секреты с ID больше q.AfterID, упорядоченные по ID
+func (r *secretRepo) ListAfter(q SecretQuery) ([]models.SecretNode, error) {
+	query := r.where(q).Where("id > ?", q.AfterID)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	var secrets []models.SecretNode
+	err := query.Order("id").Find(&secrets).Error
+	return secrets, err
+}
+
+// Query возвращает секреты, подходящие под q, в порядке q.Sort, пропуская
+// первые q.Offset
+func (r *secretRepo) Query(q SecretQuery) ([]models.SecretNode, error) {
+	column := "id"
+	if slices.Contains(SecretSorts, q.Sort) {
+		column = q.Sort
+	}
+	query := r.where(q).Order(clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: q.Descending})
+	if column != "id" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: q.Descending})
+	}
+	if q.Offset > 0 {
+		// В SQLite и MySQL Offset требует лимита; -1 означает его отсутствие
+		query = query.Offset(q.Offset).Limit(-1)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	var secrets []models.SecretNode
+	err := query.Find(&secrets).Error
+	return secrets, err
+}
+
+// Count возвращает число секретов, подходящих под q, без учёта порядка и
+// пагинации
+func (r *secretRepo) Count(q SecretQuery) (int64, error) {
+	var count int64
+	err := r.where(q).Model(&models.SecretNode{}).Count(&count).Error
+	return count, err
+}
+
+// where применяет фильтры q
+func (r *secretRepo) where(q SecretQuery) *gorm.DB {
+	query := r.db.Model(&models.SecretNode{})
+	if q.NamespaceID != 0 {
+		query = query.Where("namespace_id = ?", q.NamespaceID)
+	}
+	if q.ZoneID != 0 {
+		query = query.Where("zone_id = ?", q.ZoneID)
+	}
+	if q.EnvironmentID != 0 {
+		query = query.Where("environment_id = ?", q.EnvironmentID)
+	}
+	if q.Type != "" {
+		query = query.Where("type = ?", q.Type)
+	}
+	switch {
+	case q.NameKey != "":
+		query = query.Where("(name_key = ? OR (name_key IS NULL AND name = ?))", q.NameKey, q.Name)
+	case q.Name != "":
+		query = query.Where("name = ?", q.Name)
+	}
+	if q.Prefix != "" {
+		// LIKE в SQLite не учитывает регистр, поэтому сравниваем начальные символы
+		query = query.Where("SUBSTR(name, 1, ?) = ?", utf8.RuneCountInString(q.Prefix), q.Prefix)
+	}
+	if q.IsSecret != nil {
+		query = query.Where("is_secret = ?", *q.IsSecret)
+	}
+	if q.ReadableBy != nil {
+		query = query.Where("(owner <> '' AND owner = ?) OR NOT EXISTS (SELECT 1 FROM secret_grants g WHERE g.secret_node_id = secret_nodes.id)"+
+			" OR EXISTS (SELECT 1 FROM secret_grants g WHERE g.secret_node_id = secret_nodes.id AND g.user_id = ? AND g.level IN ?)",
+			q.ReadableBy.Username, q.ReadableBy.UserID, []string{"read", "write"})
+	}
+	return query
+}
+
+// FindByNameKey ищет секрет по нормализованному имени в пространстве имён,
+// зоне и окружении
+func (r *secretRepo) FindByNameKey(namespaceID, zoneID, environmentID uint, nameKey string) (*models.SecretNode, error) {
+	var secret models.SecretNode
+	err := r.db.Where("namespace_id = ? AND zone_id = ? AND environment_id = ? AND name_key = ?",
+		namespaceID, zoneID, environmentID, nameKey).First(&secret).Error
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// ListChildren возвращает узлы, непосредственно вложенные в папку
+func (r *secretRepo) ListChildren(parentID uint) ([]models.SecretNode, error) {
+	var children []models.SecretNode
+	err := r.db.Where("parent_id = ?", parentID).Order("id").Find(&children).Error
+	return children, err
+}
+
+func (r *secretRepo) Update(secret *models.SecretNode) error {
+	return r.db.Save(secret).Error
+}
+
+// TouchIfUnchanged переносит время изменения секрета на текущее, только если
+// оно всё ещё равно updatedAt; false означает, что секрет успели изменить
+// или удалить
+func (r *secretRepo) TouchIfUnchanged(id uint, updatedAt time.Time) (bool, error) {
+	result := r.db.Model(&models.SecretNode{}).Where("id = ? AND updated_at = ?", id, updatedAt).
+		UpdateColumn("updated_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
 func (r *secretRepo) GetVersions(secretID uint) ([]models.SecretVersion, error) {
 	var versions []models.SecretVersion
-	err := r.db.Where("secret_node_id = ?", secretID).Find(&versions).Error
+	err := r.db.Where("secret_node_id = ?", secretID).Order("version_number").Find(&versions).Error
 	return versions, err
 }
 
+func (r *secretRepo) CreateVersion(version *models.SecretVersion) error {
+	return r.db.Create(version).Error
+}
+
+func (r *secretRepo) UpdateVersion(version *models.SecretVersion) error {
+	return r.db.Save(version).Error
+}
+
+// UpdateVersionContent сохраняет только описание содержимого версии: частей,
+// сжатия, шифрования и хеша. Счётчик чтений не перезаписывается, чтобы не
+// отменить чтения, учтённые ConsumeRead после загрузки версии
+func (r *secretRepo) UpdateVersionContent(version *models.SecretVersion) error {
+	result := r.db.Model(&models.SecretVersion{}).Where("id = ?", version.ID).UpdateColumns(map[string]interface{}{
+		"encryption_metadata": version.EncryptionMetadata,
+		"chunk_count":         version.ChunkCount,
+		"compression":         version.Compression,
+		"content_hash":        version.ContentHash,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ConsumeRead атомарно увеличивает счётчик чтений версии и возвращает его
+// новое значение. При заданном maxReads счётчик увеличивается, только пока
+// он меньше лимита; 0 означает, что лимит уже исчерпан
+func (r *secretRepo) ConsumeRead(versionID uint, maxReads *int) (int, error) {
+	var count int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.SecretVersion{}).Where("id = ?", versionID)
+		if maxReads != nil {
+			query = query.Where("read_count < ?", *maxReads)
+		}
+		result := query.UpdateColumn("read_count", gorm.Expr("read_count + 1"))
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.SecretVersion{}).Where("id = ?", versionID).Pluck("read_count", &count).Error
+	})
+	return count, err
+}
+
+func (r *secretRepo) CreateChunk(chunk *models.SecretChunk) error {
+	return r.db.Create(chunk).Error
+}
+
+func (r *secretRepo) GetChunk(versionID uint, index int) (*models.SecretChunk, error) {
+	var chunk models.SecretChunk
+	err := r.db.Where("secret_version_id = ? AND chunk_index = ?", versionID, index).First(&chunk).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// RecordKeyRead увеличивает счётчик чтений одного ключа версии
+func (r *secretRepo) RecordKeyRead(versionID uint, key string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		read := models.SecretKeyRead{SecretVersionID: versionID, Key: key}
+		if err := tx.Where(&read).FirstOrCreate(&read).Error; err != nil {
+			return err
+		}
+		return tx.Model(&read).Updates(map[string]interface{}{
+			"read_count":   gorm.Expr("read_count + 1"),
+			"last_read_at": time.Now(),
+		}).Error
+	})
+}
+
+// GetKeyReads возвращает счётчики чтений ключей версии, упорядоченные по ключу
+func (r *secretRepo) GetKeyReads(versionID uint) ([]models.SecretKeyRead, error) {
+	var reads []models.SecretKeyRead
+	err := r.db.Where("secret_version_id = ?", versionID).Order("key").Find(&reads).Error
+	return reads, err
+}
+
+// Delete удаляет секрет вместе со всеми его версиями, частями и счётчиками
+// чтений ключей
 func (r *secretRepo) Delete(secretID uint) error {
-	return r.db.Delete(&models.SecretNode{}, secretID).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		versionIDs := tx.Model(&models.SecretVersion{}).Select("id").Where("secret_node_id = ?", secretID)
+		if err := tx.Where("secret_version_id IN (?)", versionIDs).Delete(&models.SecretChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("secret_version_id IN (?)", versionIDs).Delete(&models.SecretKeyRead{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("secret_node_id = ?", secretID).Delete(&models.SecretVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("secret_node_id = ?", secretID).Delete(&models.SecretAlias{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("secret_node_id = ?", secretID).Delete(&models.SecretGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SecretNode{}, secretID).Error
+	})
 }
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// ServiceAccountRepository хранит сервисные учётные записи
+type ServiceAccountRepository interface {
+	Create(account *models.ServiceAccount) error
+	GetByUserID(userID uint) (*models.ServiceAccount, error)
+	List() ([]models.ServiceAccount, error)
+}
+
+type serviceAccountRepo struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountRepository(db *gorm.DB) ServiceAccountRepository {
+	return &serviceAccountRepo{db}
+}
+
+// Create сохраняет новую сервисную учётную запись
+func (r *serviceAccountRepo) Create(account *models.ServiceAccount) error {
+	return r.db.Create(account).Error
+}
+
+// GetByUserID возвращает сервисную учётную запись пользователя userID
+func (r *serviceAccountRepo) GetByUserID(userID uint) (*models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	if err := r.db.Where("user_id = ?", userID).Limit(1).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &accounts[0], nil
+}
+
+// List возвращает все сервисные учётные записи в порядке создания
+func (r *serviceAccountRepo) List() ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	err := r.db.Order("id").Find(&accounts).Error
+	return accounts, err
+}
@@ -11,6 +11,11 @@ type SessionRepository interface {
 	Create(session *models.Session) error
 	GetByToken(token string) (*models.Session, error)
 	DeleteExpired() error
+	ListByUser(userID uint) ([]models.Session, error)
+	Touch(id uint, seenAt time.Time, ipAddress, userAgent string) error
+	Delete(id uint) error
+	DeleteOthers(userID, keepID uint) (int64, error)
+	SetElevated(id uint, until *time.Time) error
 }
 
 type sessionRepo struct {
@@ -29,7 +34,7 @@ func (r *sessionRepo) Create(session *models.Session) error {
 // GetByToken возвращает сессию по токену
 func (r *sessionRepo) GetByToken(token string) (*models.Session, error) {
 	var session models.Session
-	err := r.db.Where("token = ?", token).First(&session).Error
+	err := r.db.Where("session_token = ?", token).First(&session).Error
 	if err != nil {
 		return nil, err
 	}
@@ -40,3 +45,35 @@ func (r *sessionRepo) GetByToken(token string) (*models.Session, error) {
 func (r *sessionRepo) DeleteExpired() error {
 	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.Session{}).Error
 }
+
+// ListByUser возвращает все сессии пользователя, новые первыми
+func (r *sessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch обновляет время последнего использования сессии и адрес клиента
+func (r *sessionRepo) Touch(id uint, seenAt time.Time, ipAddress, userAgent string) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": seenAt,
+		"ip_address":   ipAddress,
+		"user_agent":   userAgent,
+	}).Error
+}
+
+// SetElevated задаёт срок повышенных прав сессии
+func (r *sessionRepo) SetElevated(id uint, until *time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("elevated_until", until).Error
+}
+
+// Delete удаляет сессию по ID
+func (r *sessionRepo) Delete(id uint) error {
+	return r.db.Delete(&models.Session{}, id).Error
+}
+
+// DeleteOthers удаляет все сессии пользователя, кроме keepID, и возвращает их число
+func (r *sessionRepo) DeleteOthers(userID, keepID uint) (int64, error) {
+	result := r.db.Where("user_id = ? AND id <> ?", userID, keepID).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
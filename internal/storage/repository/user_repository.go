@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/secretlyhq/secretly/internal/storage/models"
 	"gorm.io/gorm"
 )
@@ -8,9 +10,16 @@ import (
 type UserRepository interface {
 	Create(user *models.User) error
 	FindByUsername(username string) (*models.User, error)
+	FindByEmailIndex(emailIndex string) (*models.User, error)
 	FindByID(id uint) (*models.User, error)
+	FindByIDs(ids []uint) ([]models.User, error)
 	List() ([]models.User, error)
+	ListAfter(afterID uint, limit int) ([]models.User, error)
 	Delete(id uint) error
+	SetDeactivated(id uint, at *time.Time) error
+	SetEmail(id uint, email, emailIndex string) error
+	SetPasswordHash(id uint, hash string) error
+	SetTwoFactor(id uint, tf models.TwoFactor) error
 }
 
 type userRepo struct {
@@ -36,6 +45,17 @@ func (r *userRepo) FindByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByEmailIndex ищет пользователя по слепому индексу адреса почты; при
+// совпадении возвращает первого по ID
+func (r *userRepo) FindByEmailIndex(emailIndex string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("email_index = ?", emailIndex).Order("id").First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // FindByID ищет пользователя по ID
 func (r *userRepo) FindByID(id uint) (*models.User, error) {
 	var user models.User
@@ -46,6 +66,12 @@ func (r *userRepo) FindByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByIDs возвращает пользователей с указанными ID; отсутствующих
+// пропускает
+func (r *userRepo) FindByIDs(ids []uint) ([]models.User, error) {
+	return findIn[models.User](r.db, "id", ids)
+}
+
 // List возвращает всех пользователей
 func (r *userRepo) List() ([]models.User, error) {
 	var users []models.User
@@ -53,6 +79,40 @@ func (r *userRepo) List() ([]models.User, error) {
 	return users, err
 }
 
+// ListAfter возвращает до limit пользователей с ID больше afterID (keyset-пагинация)
+func (r *userRepo) ListAfter(afterID uint, limit int) ([]models.User, error) {
+	query := r.db.Where("id > ?", afterID).Order("id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var users []models.User
+	err := query.Find(&users).Error
+	return users, err
+}
+
+// SetDeactivated задаёт время деактивации пользователя; nil снимает деактивацию
+func (r *userRepo) SetDeactivated(id uint, at *time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("deactivated_at", at).Error
+}
+
+// SetEmail заменяет адрес электронной почты пользователя и его слепой индекс
+func (r *userRepo) SetEmail(id uint, email, emailIndex string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "email_index": emailIndex}).Error
+}
+
+// SetPasswordHash заменяет хеш пароля пользователя
+func (r *userRepo) SetPasswordHash(id uint, hash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password_hash", hash).Error
+}
+
+// SetTwoFactor заменяет настройки второго фактора пользователя
+func (r *userRepo) SetTwoFactor(id uint, tf models.TwoFactor) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).
+		Select("TOTPSecret", "TOTPEnabledAt", "TOTPLastStep", "RecoveryCodes").
+		Updates(&models.User{TwoFactor: tf}).Error
+}
+
 // Delete удаляет пользователя по ID
 func (r *userRepo) Delete(id uint) error {
 	return r.db.Delete(&models.User{}, id).Error
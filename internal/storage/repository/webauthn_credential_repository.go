@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredentialRepository хранит ключи доступа (passkeys) пользователей
+type WebAuthnCredentialRepository interface {
+	Create(cred *models.WebAuthnCredential) error
+	ListByUser(userID uint) ([]models.WebAuthnCredential, error)
+	GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error)
+	RecordUse(id uint, signCount uint32, usedAt time.Time) error
+	Delete(id uint) error
+}
+
+type webAuthnCredentialRepo struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnCredentialRepository(db *gorm.DB) WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepo{db}
+}
+
+// Create сохраняет новый ключ доступа
+func (r *webAuthnCredentialRepo) Create(cred *models.WebAuthnCredential) error {
+	return r.db.Create(cred).Error
+}
+
+// ListByUser возвращает ключи пользователя в порядке регистрации
+func (r *webAuthnCredentialRepo) ListByUser(userID uint) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&creds).Error
+	return creds, err
+}
+
+// GetByCredentialID возвращает ключ по идентификатору, выданному аутентификатором
+func (r *webAuthnCredentialRepo) GetByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	var cred models.WebAuthnCredential
+	if err := r.db.Where("credential_id = ?", credentialID).First(&cred).Error; err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// RecordUse сохраняет счётчик подписей и время входа
+func (r *webAuthnCredentialRepo) RecordUse(id uint, signCount uint32, usedAt time.Time) error {
+	return r.db.Model(&models.WebAuthnCredential{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": usedAt,
+	}).Error
+}
+
+// Delete удаляет ключ по ID
+func (r *webAuthnCredentialRepo) Delete(id uint) error {
+	return r.db.Delete(&models.WebAuthnCredential{}, id).Error
+}
@@ -1,8 +1,134 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/secretlyhq/secretly/internal/storage/repository"
+	"gorm.io/gorm"
+)
+
+// Errors returned by every Storage implementation. They are the GORM
+// sentinels, so the GORM repositories return them without translation.
+var (
+	// ErrNotFound means the requested record does not exist
+	ErrNotFound = gorm.ErrRecordNotFound
+	// ErrConflict means a record with the same unique key already exists
+	ErrConflict = gorm.ErrDuplicatedKey
+)
+
+// Storage groups the repositories used by the application so that the
+// backing store (SQLite, in-memory, mocks) can be swapped as a unit
+type Storage interface {
+	Secrets() repository.SecretRepository
+	Users() repository.UserRepository
+	Sessions() repository.SessionRepository
+	Audit() repository.AuditRepository
+	Config() repository.ConfigRepository
+	Scopes() repository.ScopeRepository
+	Operations() repository.OperationRepository
+	PasswordResets() repository.PasswordResetRepository
+	WebAuthnCredentials() repository.WebAuthnCredentialRepository
+	APIClients() repository.APIClientRepository
+	Devices() repository.DeviceRepository
+	Checkouts() repository.CheckoutRepository
+	Aliases() repository.AliasRepository
+	Grants() repository.GrantRepository
+	ExportProfiles() repository.ExportProfileRepository
+	RBAC() repository.RBACRepository
+	ServiceAccounts() repository.ServiceAccountRepository
+	Releases() repository.ReleaseRepository
+	Escrows() repository.EscrowRepository
+
+	// WithTransaction runs fn with a Storage whose writes are committed
+	// together if fn returns nil and rolled back otherwise
+	WithTransaction(fn func(tx Storage) error) error
+}
 
 func Connect() error {
 	fmt.Println("Connecting to database...")
 	return nil
 }
+
+// localStorage is the GORM-backed Storage implementation
+type localStorage struct {
+	db *gorm.DB
+
+	secrets  repository.SecretRepository
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	audit    repository.AuditRepository
+	config   repository.ConfigRepository
+	scopes   repository.ScopeRepository
+	ops      repository.OperationRepository
+	resets   repository.PasswordResetRepository
+	passkeys repository.WebAuthnCredentialRepository
+	clients  repository.APIClientRepository
+	devices  repository.DeviceRepository
+	leases   repository.CheckoutRepository
+	aliases  repository.AliasRepository
+	grants   repository.GrantRepository
+	exports  repository.ExportProfileRepository
+	rbac     repository.RBACRepository
+	services repository.ServiceAccountRepository
+	releases repository.ReleaseRepository
+	escrows  repository.EscrowRepository
+}
+
+// NewLocalStorage creates a Storage backed by the given database
+func NewLocalStorage(db *gorm.DB) Storage {
+	return &localStorage{
+		db:       db,
+		secrets:  repository.NewSecretRepository(db),
+		users:    repository.NewUserRepository(db),
+		sessions: repository.NewSessionRepository(db),
+		audit:    repository.NewAuditRepository(db),
+		config:   repository.NewConfigRepository(db),
+		scopes:   repository.NewScopeRepository(db),
+		ops:      repository.NewOperationRepository(db),
+		resets:   repository.NewPasswordResetRepository(db),
+		passkeys: repository.NewWebAuthnCredentialRepository(db),
+		clients:  repository.NewAPIClientRepository(db),
+		devices:  repository.NewDeviceRepository(db),
+		leases:   repository.NewCheckoutRepository(db),
+		aliases:  repository.NewAliasRepository(db),
+		grants:   repository.NewGrantRepository(db),
+		exports:  repository.NewExportProfileRepository(db),
+		rbac:     repository.NewRBACRepository(db),
+		services: repository.NewServiceAccountRepository(db),
+		releases: repository.NewReleaseRepository(db),
+		escrows:  repository.NewEscrowRepository(db),
+	}
+}
+
+func (s *localStorage) Secrets() repository.SecretRepository               { return s.secrets }
+func (s *localStorage) Users() repository.UserRepository                   { return s.users }
+func (s *localStorage) Sessions() repository.SessionRepository             { return s.sessions }
+func (s *localStorage) Audit() repository.AuditRepository                  { return s.audit }
+func (s *localStorage) Config() repository.ConfigRepository                { return s.config }
+func (s *localStorage) Scopes() repository.ScopeRepository                 { return s.scopes }
+func (s *localStorage) Operations() repository.OperationRepository         { return s.ops }
+func (s *localStorage) PasswordResets() repository.PasswordResetRepository { return s.resets }
+func (s *localStorage) WebAuthnCredentials() repository.WebAuthnCredentialRepository {
+	return s.passkeys
+}
+func (s *localStorage) APIClients() repository.APIClientRepository { return s.clients }
+func (s *localStorage) Devices() repository.DeviceRepository       { return s.devices }
+func (s *localStorage) Checkouts() repository.CheckoutRepository   { return s.leases }
+func (s *localStorage) Aliases() repository.AliasRepository        { return s.aliases }
+func (s *localStorage) Grants() repository.GrantRepository         { return s.grants }
+func (s *localStorage) ExportProfiles() repository.ExportProfileRepository {
+	return s.exports
+}
+func (s *localStorage) RBAC() repository.RBACRepository { return s.rbac }
+func (s *localStorage) ServiceAccounts() repository.ServiceAccountRepository {
+	return s.services
+}
+func (s *localStorage) Releases() repository.ReleaseRepository { return s.releases }
+func (s *localStorage) Escrows() repository.EscrowRepository   { return s.escrows }
+
+// WithTransaction runs fn in a database transaction
+func (s *localStorage) WithTransaction(fn func(tx Storage) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewLocalStorage(tx))
+	})
+}
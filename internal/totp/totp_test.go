@@ -0,0 +1,36 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 appendix B SHA-1 key, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Errorf("Code at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	if step, ok := Verify(secret, "005924", now.Add(Period), 1); !ok || step != Step(now) {
+		t.Errorf("Expected the previous step to verify within skew, got %d, %v", step, ok)
+	}
+	if _, ok := Verify(secret, "005924", now.Add(2*Period), 1); ok {
+		t.Error("Expected a code two steps old to be rejected")
+	}
+	if uri := URI("Secretly", "alice", "ABC"); !strings.HasPrefix(uri, "otpauth://totp/Secretly:alice?") {
+		t.Errorf("Unexpected URI %q", uri)
+	}
+}
@@ -0,0 +1,142 @@
+// Package valuediff describes how a secret value changes without revealing
+// it: JSON objects are compared key by key, other values by size only.
+package valuediff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// Value kinds
+const (
+	KindJSON   = "json"
+	KindText   = "text"
+	KindBinary = "binary"
+)
+
+// Change kinds
+const (
+	Added     = "added"
+	Removed   = "removed"
+	Changed   = "changed"
+	Unchanged = "unchanged"
+)
+
+// Change describes one JSON key, or the whole value for non-JSON values.
+// Lengths are in bytes of the JSON encoding for JSON values.
+type Change struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	OldLen int    `json:"old_length,omitempty"`
+	NewLen int    `json:"new_length,omitempty"`
+}
+
+// Result is the redacted difference between two values
+type Result struct {
+	Kind    string   `json:"kind"`
+	Changes []Change `json:"changes"`
+}
+
+// Changed reports whether anything differs
+func (r *Result) Changed() bool {
+	for _, c := range r.Changes {
+		if c.Kind != Unchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare diffs two values. When both are JSON objects, nested keys are
+// flattened to dotted paths such as "db.password"; arrays count as one leaf.
+func Compare(oldValue, newValue []byte) *Result {
+	oldObj, oldIsJSON := object(oldValue)
+	newObj, newIsJSON := object(newValue)
+	if oldIsJSON && newIsJSON {
+		oldLeaves, newLeaves := make(map[string][]byte), make(map[string][]byte)
+		flatten("", oldObj, oldLeaves)
+		flatten("", newObj, newLeaves)
+		return &Result{Kind: KindJSON, Changes: compareLeaves(oldLeaves, newLeaves)}
+	}
+
+	kind := KindText
+	if !utf8.Valid(oldValue) || !utf8.Valid(newValue) {
+		kind = KindBinary
+	}
+	change := Change{Path: "(value)", Kind: Unchanged, OldLen: len(oldValue), NewLen: len(newValue)}
+	if !bytes.Equal(oldValue, newValue) {
+		change.Kind = Changed
+	}
+	return &Result{Kind: kind, Changes: []Change{change}}
+}
+
+func object(data []byte) (map[string]interface{}, bool) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func flatten(prefix string, obj map[string]interface{}, leaves map[string][]byte) {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flatten(path, nested, leaves)
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		leaves[path] = encoded
+	}
+}
+
+func compareLeaves(oldLeaves, newLeaves map[string][]byte) []Change {
+	var changes []Change
+	for path, oldValue := range oldLeaves {
+		newValue, ok := newLeaves[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Kind: Removed, OldLen: len(oldValue)})
+		case bytes.Equal(oldValue, newValue):
+			changes = append(changes, Change{Path: path, Kind: Unchanged, OldLen: len(oldValue), NewLen: len(newValue)})
+		default:
+			changes = append(changes, Change{Path: path, Kind: Changed, OldLen: len(oldValue), NewLen: len(newValue)})
+		}
+	}
+	for path, newValue := range newLeaves {
+		if _, ok := oldLeaves[path]; !ok {
+			changes = append(changes, Change{Path: path, Kind: Added, NewLen: len(newValue)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// Write prints one line per change, e.g. "~ db.password  12 → 16 bytes"
+func (r *Result) Write(w io.Writer) error {
+	symbols := map[string]string{Added: "+", Removed: "-", Changed: "~", Unchanged: " "}
+	for _, c := range r.Changes {
+		var size string
+		switch c.Kind {
+		case Added:
+			size = fmt.Sprintf("%d bytes", c.NewLen)
+		case Removed:
+			size = fmt.Sprintf("%d bytes", c.OldLen)
+		case Changed:
+			size = fmt.Sprintf("%d → %d bytes", c.OldLen, c.NewLen)
+		default:
+			size = "unchanged"
+		}
+		if _, err := fmt.Fprintf(w, "  %s %-30s %s\n", symbols[c.Kind], c.Path, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package valuediff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	oldValue := []byte(`{"db":{"user":"app","password":"hunter2"},"api_key":"k1","legacy":true}`)
+	newValue := []byte(`{"db":{"user":"app","password":"correct-horse"},"api_key":"k1","region":"eu"}`)
+
+	r := Compare(oldValue, newValue)
+	if r.Kind != KindJSON || !r.Changed() {
+		t.Fatalf("Expected changed JSON diff, got %+v", r)
+	}
+	want := map[string]string{"api_key": Unchanged, "db.password": Changed, "db.user": Unchanged, "legacy": Removed, "region": Added}
+	if len(r.Changes) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), r.Changes)
+	}
+	for _, c := range r.Changes {
+		if want[c.Path] != c.Kind {
+			t.Errorf("Expected %s to be %s, got %s", c.Path, want[c.Path], c.Kind)
+		}
+	}
+
+	var out bytes.Buffer
+	_ = r.Write(&out)
+	for _, secret := range []string{"hunter2", "correct-horse", "k1", "eu"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("Diff output leaks %q:\n%s", secret, out.String())
+		}
+	}
+
+	text := Compare([]byte("old"), []byte("newer"))
+	if text.Kind != KindText || text.Changes[0].OldLen != 3 || text.Changes[0].NewLen != 5 {
+		t.Errorf("Unexpected text diff: %+v", text)
+	}
+	if Compare([]byte("same"), []byte("same")).Changed() {
+		t.Error("Expected identical values to be unchanged")
+	}
+}
@@ -0,0 +1,128 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth bounds nesting so that hostile input cannot exhaust the stack
+const maxCBORDepth = 16
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the single CBOR item at the start of data, as used in
+// attestation objects and COSE keys, and returns it with the remaining
+// bytes. Integers decode to int64, byte strings to []byte, text strings to
+// string, arrays to []interface{} and maps to map[interface{}]interface{}.
+// Indefinite lengths, tags and floats are not used by authenticators and
+// are rejected.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22:
+			return nil, data[1:], nil
+		}
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+	n, rest, err := decodeLength(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), rest, nil
+	case 1:
+		if n > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), rest, nil
+	case 2, 3:
+		if uint64(len(rest)) < n {
+			return nil, nil, errTruncated
+		}
+		if major == 2 {
+			return append([]byte(nil), rest[:n]...), rest[n:], nil
+		}
+		return string(rest[:n]), rest[n:], nil
+	case 4:
+		// Every item takes at least one byte
+		if uint64(len(rest)) < n {
+			return nil, nil, errTruncated
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item interface{}
+			if item, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if uint64(len(rest)) < 2*n {
+			return nil, nil, errTruncated
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var key, value interface{}
+			if key, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key %T", key)
+			}
+			if value, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if _, dup := m[key]; dup {
+				return nil, nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			m[key] = value
+		}
+		return m, rest, nil
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+// decodeLength returns the argument of the item header at the start of data
+func decodeLength(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	case info >= 24 && info <= 27:
+		return 0, nil, errTruncated
+	}
+	return 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
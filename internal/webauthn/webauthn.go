@@ -0,0 +1,396 @@
+// Package webauthn verifies WebAuthn (FIDO2) registrations and assertions
+// for passkeys and security keys. Attestation statements are not checked:
+// credentials are requested with attestation "none" and trusted on first
+// use, which is what browsers offer for synced passkeys anyway.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// COSE algorithm identifiers of the supported public keys
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// ErrVerification is wrapped by every error about a response that does not
+// check out
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Bytes is binary data encoded as unpadded base64url in JSON, as the
+// WebAuthn JSON serialization does
+type Bytes []byte
+
+// MarshalJSON encodes b as unpadded base64url
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts base64url with or without padding
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is the site credentials are registered with. ID is the
+// domain (e.g. "secretly.example.com"); Origins are the exact origins the
+// browser pages run on (e.g. "https://secretly.example.com").
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// CredentialDescriptor names a registered credential
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// CredentialParameter is an accepted key type
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// RelyingPartyEntity identifies the relying party to the authenticator
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the account a credential is created for
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// AuthenticatorSelection states the authenticator requirements
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed as publicKey to navigator.credentials.create
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed as publicKey to navigator.credentials.get
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the credential returned by
+// navigator.credentials.create, with binary fields base64url-encoded
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential returned by
+// navigator.credentials.get, with binary fields base64url-encoded
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a verified registration to store for later logins
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// NewChallenge returns a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// NewCreationOptions asks for a discoverable credential with user
+// verification for the user with handle userID. exclude lists the user's
+// existing credentials so the same authenticator is not registered twice.
+func (rp *RelyingParty) NewCreationOptions(challenge, userID []byte, name string, exclude [][]byte, timeout time.Duration) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: userID, Name: name, DisplayName: name},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:                timeout.Milliseconds(),
+		ExcludeCredentials:     descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "preferred", UserVerification: "required"},
+		Attestation:            "none",
+	}
+}
+
+// NewRequestOptions asks for an assertion with user verification from one
+// of allow, or from any discoverable credential when allow is empty
+func (rp *RelyingParty) NewRequestOptions(challenge []byte, allow [][]byte, timeout time.Duration) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	var out []CredentialDescriptor
+	for _, id := range ids {
+		out = append(out, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return out
+}
+
+// VerifyRegistration checks a response to CreationOptions with challenge
+// and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge []byte) (*Credential, error) {
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	obj, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrVerification, err)
+	}
+	fields, _ := obj.(map[interface{}]interface{})
+	authData, ok := fields["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object has no authenticator data", ErrVerification)
+	}
+	data, err := rp.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if data.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrVerification)
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, data.credentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrVerification)
+	}
+	if _, _, err := parsePublicKey(data.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{ID: data.credentialID, PublicKey: data.publicKey, SignCount: data.signCount}, nil
+}
+
+// VerifyAssertion checks a response to RequestOptions with challenge
+// against the stored credential and returns the new signature counter.
+// A counter that did not increase indicates a cloned authenticator.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge []byte, cred Credential) (uint32, error) {
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	data, err := rp.parseAuthData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	alg, key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !verifySignature(alg, key, signed, resp.Response.Signature) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+	if (data.signCount != 0 || cred.SignCount != 0) && data.signCount <= cred.SignCount {
+		return 0, fmt.Errorf("%w: signature counter went from %d to %d; the authenticator may be cloned",
+			ErrVerification, cred.SignCount, data.signCount)
+	}
+	return data.signCount, nil
+}
+
+// verifyClientData checks the type, challenge and origin the browser signed
+func (rp *RelyingParty) verifyClientData(raw []byte, typ string, challenge []byte) error {
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrVerification, err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("%w: client data type %q, expected %q", ErrVerification, cd.Type, typ)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrVerification, cd.Origin)
+	}
+	return nil
+}
+
+type authData struct {
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthData checks the relying party hash and the user presence and
+// verification flags, and extracts the attested credential if present
+func (rp *RelyingParty) parseAuthData(raw []byte) (*authData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(raw[:32], rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: credential belongs to another relying party", ErrVerification)
+	}
+	flags := raw[32]
+	if flags&flagUserPresent == 0 || flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user presence and verification are required", ErrVerification)
+	}
+	data := &authData{signCount: binary.BigEndian.Uint32(raw[33:37])}
+	if flags&flagAttested == 0 {
+		return data, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("%w: invalid credential ID length", ErrVerification)
+	}
+	data.credentialID = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %v", ErrVerification, err)
+	}
+	data.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+	return data, nil
+}
+
+// parsePublicKey decodes a COSE_Key with one of the supported algorithms
+func parsePublicKey(cose []byte) (int64, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(cose)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: public key: %v", ErrVerification, err)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: public key is not a COSE key", ErrVerification)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	x, _ := m[int64(-2)].([]byte)
+
+	switch {
+	case kty == 2 && alg == AlgES256 && crv == 1:
+		y, _ := m[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("%w: invalid P-256 key", ErrVerification)
+		}
+		// ecdh rejects points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return 0, nil, fmt.Errorf("%w: invalid P-256 key: %v", ErrVerification, err)
+		}
+		return alg, &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case kty == 1 && alg == AlgEdDSA && crv == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("%w: invalid Ed25519 key", ErrVerification)
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, fmt.Errorf("%w: RSA keys must have at least 2048 bits", ErrVerification)
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrVerification, kty, alg)
+}
+
+func verifySignature(alg int64, key crypto.PublicKey, signed, sig []byte) bool {
+	switch alg {
+	case AlgES256:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], sig)
+	case AlgEdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), signed, sig)
+	case AlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
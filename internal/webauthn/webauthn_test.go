@@ -0,0 +1,108 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// encodeCBOR is the small subset of CBOR encoding an authenticator uses
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n int) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 256:
+			return []byte{major<<5 | 24, byte(n)}
+		}
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, -1-v)
+		}
+		return head(0, v)
+	case []byte:
+		return append(head(2, len(v)), v...)
+	case string:
+		return append(head(3, len(v)), v...)
+	case [][2]interface{}:
+		out := head(5, len(v))
+		for _, kv := range v {
+			out = append(out, encodeCBOR(kv[0])...)
+			out = append(out, encodeCBOR(kv[1])...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("unsupported %T", v))
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := &RelyingParty{ID: "secretly.example.com", Name: "Secretly", Origins: []string{"https://secretly.example.com"}}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cose := encodeCBOR([][2]interface{}{
+		{1, 2}, {3, AlgES256}, {-1, 1},
+		{-2, key.X.FillBytes(make([]byte, 32))},
+		{-3, key.Y.FillBytes(make([]byte, 32))},
+	})
+	credID := []byte("credential-1")
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	authData := func(flags byte, count uint32, attested bool) []byte {
+		out := append(append([]byte(nil), rpIDHash[:]...), flags)
+		out = binary.BigEndian.AppendUint32(out, count)
+		if attested {
+			out = append(out, make([]byte, 16)...)
+			out = binary.BigEndian.AppendUint16(out, uint16(len(credID)))
+			out = append(append(out, credID...), cose...)
+		}
+		return out
+	}
+	clientData := func(typ string, challenge []byte, origin string) []byte {
+		return []byte(fmt.Sprintf(`{"type":%q,"challenge":%q,"origin":%q}`,
+			typ, base64.RawURLEncoding.EncodeToString(challenge), origin))
+	}
+
+	challenge, _ := NewChallenge()
+	var reg AttestationResponse
+	reg.RawID = credID
+	reg.Response.ClientDataJSON = clientData("webauthn.create", challenge, "https://secretly.example.com")
+	reg.Response.AttestationObject = encodeCBOR([][2]interface{}{
+		{"fmt", "none"}, {"attStmt", [][2]interface{}{}}, {"authData", authData(0x45, 0, true)},
+	})
+	cred, err := rp.VerifyRegistration(&reg, challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration failed: %v", err)
+	}
+	if string(cred.ID) != string(credID) {
+		t.Errorf("Unexpected credential ID %q", cred.ID)
+	}
+	if _, err := rp.VerifyRegistration(&reg, []byte("other challenge")); !errors.Is(err, ErrVerification) {
+		t.Errorf("Expected a wrong challenge to fail, got %v", err)
+	}
+
+	assert := func(count uint32, origin string) (uint32, error) {
+		var resp AssertionResponse
+		resp.Response.ClientDataJSON = clientData("webauthn.get", challenge, origin)
+		resp.Response.AuthenticatorData = authData(0x05, count, false)
+		hash := sha256.Sum256(resp.Response.ClientDataJSON)
+		digest := sha256.Sum256(append(append([]byte(nil), resp.Response.AuthenticatorData...), hash[:]...))
+		resp.Response.Signature, _ = ecdsa.SignASN1(rand.Reader, key, digest[:])
+		return rp.VerifyAssertion(&resp, challenge, Credential{ID: cred.ID, PublicKey: cred.PublicKey, SignCount: 3})
+	}
+	if count, err := assert(4, "https://secretly.example.com"); err != nil || count != 4 {
+		t.Errorf("VerifyAssertion = %d, %v", count, err)
+	}
+	if _, err := assert(3, "https://secretly.example.com"); !errors.Is(err, ErrVerification) {
+		t.Errorf("Expected a stale counter to fail, got %v", err)
+	}
+	if _, err := assert(5, "https://evil.example.com"); !errors.Is(err, ErrVerification) {
+		t.Errorf("Expected a foreign origin to fail, got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+-- Streamed secrets store their value as a sequence of separately encrypted chunks
+
+ALTER TABLE secret_versions ADD COLUMN chunk_count INTEGER DEFAULT 0;
+
+CREATE TABLE secret_chunks (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_version_id INTEGER NOT NULL REFERENCES secret_versions(id) ON DELETE CASCADE,
+  chunk_index INTEGER NOT NULL,
+  encrypted_value BLOB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_secret_chunks_secret_version_id ON secret_chunks(secret_version_id);
@@ -0,0 +1,3 @@
+-- Compression applied to a version's payload before encryption ('' = none, 'zstd')
+
+ALTER TABLE secret_versions ADD COLUMN compression TEXT DEFAULT '';
@@ -0,0 +1,4 @@
+-- Content hash of the plaintext ("hmac-sha256:<hex>" or "sha256:<hex>") used for
+-- deduplication and integrity checks
+
+ALTER TABLE secret_versions ADD COLUMN content_hash TEXT DEFAULT '';
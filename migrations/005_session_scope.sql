@@ -0,0 +1,5 @@
+-- Sessions issued by OIDC federation record the policy that scopes them and
+-- the external subject (e.g. "repo:acme/app:ref:refs/heads/main")
+
+ALTER TABLE sessions ADD COLUMN scope TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN subject TEXT DEFAULT '';
@@ -0,0 +1,11 @@
+-- Structured (JSON) secrets count reads of individual keys per version
+
+CREATE TABLE secret_key_reads (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_version_id INTEGER NOT NULL REFERENCES secret_versions(id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  read_count INTEGER DEFAULT 0,
+  last_read_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_secret_key_reads_version_key ON secret_key_reads(secret_version_id, key);
@@ -0,0 +1,18 @@
+-- Destructive operations on protected secrets wait for a second
+-- administrator's approval (two-person rule)
+
+CREATE TABLE pending_operations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind TEXT NOT NULL,
+  secret_node_id INTEGER NOT NULL,
+  status TEXT DEFAULT 'pending',
+  requested_by TEXT,
+  decided_by TEXT,
+  reason TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  decided_at TIMESTAMP
+);
+
+CREATE INDEX idx_pending_operations_secret_node_id ON pending_operations(secret_node_id);
+CREATE INDEX idx_pending_operations_status ON pending_operations(status);
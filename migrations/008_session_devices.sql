@@ -0,0 +1,8 @@
+-- Sessions remember the client they were opened from and when they were last
+-- used, so users can review and revoke their sessions
+
+ALTER TABLE sessions ADD COLUMN user_agent TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip_address TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP;
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
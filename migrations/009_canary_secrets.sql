@@ -0,0 +1,3 @@
+-- Canary (honeypot) secrets raise an alert on every read
+
+ALTER TABLE secret_nodes ADD COLUMN canary BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,6 @@
+-- Indexes for filtering and sorting the audit log
+
+CREATE INDEX idx_audit_events_event_type ON audit_events(event_type);
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id);
+CREATE INDEX idx_audit_events_secret_node_id ON audit_events(secret_node_id);
+CREATE INDEX idx_audit_events_event_time ON audit_events(event_time);
@@ -0,0 +1,6 @@
+-- Secrets record the user responsible for them; secrets whose owner is gone
+-- or deactivated are listed as orphaned
+
+ALTER TABLE secret_nodes ADD COLUMN owner TEXT DEFAULT '';
+
+CREATE INDEX idx_secret_nodes_owner ON secret_nodes(owner);
@@ -0,0 +1,3 @@
+-- Deactivated users cannot log in but keep their history and ownership
+
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
@@ -0,0 +1,3 @@
+-- Password reset requests are counted and removed per user
+
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
@@ -0,0 +1,8 @@
+-- TOTP two-factor authentication with recovery codes, and sessions elevated
+-- for sensitive operations by a recent code
+
+ALTER TABLE users ADD COLUMN totp_secret BLOB;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0;
+ALTER TABLE users ADD COLUMN recovery_codes TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN elevated_until TIMESTAMP;
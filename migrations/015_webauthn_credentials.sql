@@ -0,0 +1,15 @@
+-- Passkeys and security keys (WebAuthn) registered by users
+
+CREATE TABLE web_authn_credentials (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  name TEXT,
+  credential_id BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  sign_count INTEGER DEFAULT 0,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_web_authn_credentials_user_id ON web_authn_credentials(user_id);
+CREATE UNIQUE INDEX idx_web_authn_credentials_credential_id ON web_authn_credentials(credential_id);
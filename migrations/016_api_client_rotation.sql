@@ -0,0 +1,11 @@
+-- API clients act as their owner, can be limited to namespaces and keep the
+-- previous secret valid for a grace window after a rotation
+
+ALTER TABLE api_clients ADD COLUMN user_id INTEGER REFERENCES users(id);
+ALTER TABLE api_clients ADD COLUMN previous_secret BLOB;
+ALTER TABLE api_clients ADD COLUMN previous_secret_expires_at TIMESTAMP;
+ALTER TABLE api_clients ADD COLUMN namespace_ids TEXT;
+ALTER TABLE api_clients ADD COLUMN secret_rotated_at TIMESTAMP;
+ALTER TABLE api_clients ADD COLUMN last_used_at TIMESTAMP;
+
+CREATE INDEX idx_api_clients_user_id ON api_clients(user_id);
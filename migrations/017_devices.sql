@@ -0,0 +1,34 @@
+-- Machines enrolled with a one-time token and identified by a certificate
+
+CREATE TABLE device_enrollment_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token_hash TEXT NOT NULL,
+  name TEXT,
+  username TEXT NOT NULL,
+  namespace_id INTEGER DEFAULT 0,
+  read_only BOOLEAN DEFAULT FALSE,
+  created_by TEXT,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_device_enrollment_tokens_token_hash ON device_enrollment_tokens(token_hash);
+
+CREATE TABLE devices (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  namespace_id INTEGER DEFAULT 0,
+  read_only BOOLEAN DEFAULT FALSE,
+  fingerprint TEXT NOT NULL,
+  cert_serial TEXT,
+  cert_expires_at TIMESTAMP,
+  enrolled_by TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at TIMESTAMP,
+  revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_devices_user_id ON devices(user_id);
+CREATE UNIQUE INDEX idx_devices_fingerprint ON devices(fingerprint);
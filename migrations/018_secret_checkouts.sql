@@ -0,0 +1,16 @@
+-- Exclusive check-out leases on break-glass secrets; the rows of a secret
+-- are its custody chain
+
+CREATE TABLE secret_checkouts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_node_id INTEGER NOT NULL REFERENCES secret_nodes(id) ON DELETE CASCADE,
+  username TEXT NOT NULL,
+  reason TEXT,
+  checked_out_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  checked_in_at TIMESTAMP,
+  checked_in_by TEXT,
+  rotated_version INTEGER DEFAULT 0
+);
+
+CREATE INDEX idx_secret_checkouts_secret_node_id ON secret_checkouts(secret_node_id);
@@ -0,0 +1,8 @@
+-- Owners are no longer derived from created_by when secrets are read.
+-- Secrets created by a user before owners were recorded get that user as
+-- their owner; secrets created by tools keep no owner.
+
+UPDATE secret_nodes
+SET owner = created_by
+WHERE (owner IS NULL OR owner = '')
+  AND created_by IN (SELECT username FROM users);
@@ -0,0 +1,8 @@
+-- Secret names are unique per namespace, zone and environment after
+-- normalization (trimmed, NFC, optionally case-folded). name_key is filled
+-- in by the application; older secrets whose names collide keep NULL and
+-- are listed by 'secretly secret collisions'.
+
+ALTER TABLE secret_nodes ADD COLUMN name_key TEXT;
+
+CREATE UNIQUE INDEX idx_secret_nodes_name_key ON secret_nodes(namespace_id, zone_id, environment_id, name_key);
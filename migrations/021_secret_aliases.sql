@@ -0,0 +1,17 @@
+-- Former names of renamed and moved secrets; lookups by an alias resolve to
+-- the secret until the alias expires
+
+CREATE TABLE secret_aliases (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_node_id INTEGER NOT NULL REFERENCES secret_nodes(id) ON DELETE CASCADE,
+  namespace_id INTEGER,
+  zone_id INTEGER,
+  environment_id INTEGER,
+  name TEXT NOT NULL,
+  name_key TEXT,
+  created_at TIMESTAMP,
+  expires_at TIMESTAMP
+);
+
+CREATE INDEX idx_secret_aliases_secret_node_id ON secret_aliases(secret_node_id);
+CREATE INDEX idx_secret_aliases_name_key ON secret_aliases(name_key);
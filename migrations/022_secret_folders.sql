@@ -0,0 +1,4 @@
+-- Folders are secret_nodes with is_secret = false; parent_id links a node
+-- to the folder holding it
+
+CREATE INDEX idx_secret_nodes_parent_id ON secret_nodes(parent_id);
@@ -0,0 +1,15 @@
+-- Per-user access to folders and secrets. The grants of the nearest node
+-- with any grants decide access to a secret; nodes without grants inherit
+-- them from their folder.
+
+CREATE TABLE secret_grants (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_node_id INTEGER NOT NULL REFERENCES secret_nodes(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  level TEXT NOT NULL,
+  granted_by TEXT,
+  created_at TIMESTAMP,
+  updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_secret_grants_node_user ON secret_grants(secret_node_id, user_id);
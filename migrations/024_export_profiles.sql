@@ -0,0 +1,20 @@
+-- Named profiles mapping secrets to environment variable names for
+-- secretly run, env pull and CSI mounts.
+
+CREATE TABLE export_profiles (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  namespace_id INTEGER,
+  zone_id INTEGER,
+  environment_id INTEGER,
+  prefix TEXT,
+  secrets TEXT,
+  var_prefix TEXT,
+  uppercase BOOLEAN,
+  flatten_json BOOLEAN,
+  created_by TEXT,
+  created_at TIMESTAMP,
+  updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_export_profiles_name ON export_profiles(name);
@@ -0,0 +1,6 @@
+-- Client address, user agent and transport ('http', 'grpc', 'cli') of the
+-- request that caused an audit event
+
+ALTER TABLE audit_events ADD COLUMN ip_address TEXT DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN user_agent TEXT DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN transport TEXT DEFAULT '';
@@ -0,0 +1,5 @@
+-- Permissions of roles, from the permission catalog, and the built-in role
+-- templates seeded on startup
+
+ALTER TABLE roles ADD COLUMN permissions TEXT DEFAULT '';
+ALTER TABLE roles ADD COLUMN builtin BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,15 @@
+-- Deny rules, which take a permission away from users in a namespace or
+-- everywhere, overriding roles, grants and ownership
+
+CREATE TABLE deny_rules (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  permission TEXT NOT NULL,
+  namespace_id INTEGER REFERENCES namespaces(id),
+  "group" TEXT,
+  except_roles TEXT,
+  created_at TIMESTAMP,
+  updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_deny_rules_name ON deny_rules(name);
@@ -0,0 +1,19 @@
+-- Before and after snapshots of the changes access policies make, linked to
+-- their rbac_changed audit events
+
+CREATE TABLE rbac_change_logs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  audit_event_id INTEGER REFERENCES audit_events(id),
+  actor TEXT,
+  action TEXT,
+  kind TEXT,
+  name TEXT,
+  before TEXT,
+  after TEXT,
+  changed_at TIMESTAMP
+);
+
+CREATE INDEX idx_rbac_change_logs_audit_event_id ON rbac_change_logs(audit_event_id);
+CREATE INDEX idx_rbac_change_logs_actor ON rbac_change_logs(actor);
+CREATE INDEX idx_rbac_change_logs_kind ON rbac_change_logs(kind);
+CREATE INDEX idx_rbac_change_logs_changed_at ON rbac_change_logs(changed_at);
@@ -0,0 +1,16 @@
+-- Service accounts: token-only identities for automation, each backed by a
+-- user without a password, and the actor kind on audit events
+
+CREATE TABLE service_accounts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  description TEXT,
+  owner TEXT,
+  created_by TEXT,
+  created_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_service_accounts_user_id ON service_accounts(user_id);
+CREATE INDEX idx_service_accounts_owner ON service_accounts(owner);
+
+ALTER TABLE audit_events ADD COLUMN actor_kind TEXT DEFAULT '';
@@ -0,0 +1,7 @@
+-- Impersonation: the admin acting as the user of a session, and stamped on
+-- the audit events it causes
+
+ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER REFERENCES users(id);
+ALTER TABLE audit_events ADD COLUMN impersonator_id INTEGER REFERENCES users(id);
+
+CREATE INDEX idx_audit_events_impersonator_id ON audit_events(impersonator_id);
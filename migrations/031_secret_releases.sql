@@ -0,0 +1,21 @@
+-- Scheduled releases: read access for a recipient at a time or after the
+-- owner's inactivity (dead man's switch)
+
+CREATE TABLE secret_releases (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_node_id INTEGER NOT NULL REFERENCES secret_nodes(id) ON DELETE CASCADE,
+  recipient TEXT NOT NULL,
+  release_at TIMESTAMP,
+  inactivity_days INTEGER DEFAULT 0,
+  note TEXT,
+  status TEXT,
+  created_by TEXT,
+  created_at TIMESTAMP,
+  warned_at TIMESTAMP,
+  released_at TIMESTAMP,
+  cancelled_at TIMESTAMP,
+  cancelled_by TEXT
+);
+
+CREATE INDEX idx_secret_releases_secret_node_id ON secret_releases(secret_node_id);
+CREATE INDEX idx_secret_releases_status ON secret_releases(status);
@@ -0,0 +1,60 @@
+-- Escrow: copies of secret values encrypted with a key split among
+-- custodians, M of whom must approve a recovery, and a hash-chained log
+
+CREATE TABLE escrow_custodians (
+  user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  public_key BLOB,
+  updated_at TIMESTAMP
+);
+
+CREATE TABLE escrows (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  secret_node_id INTEGER NOT NULL REFERENCES secret_nodes(id) ON DELETE CASCADE,
+  version_number INTEGER,
+  threshold INTEGER,
+  ciphertext BLOB,
+  created_by TEXT,
+  created_at TIMESTAMP
+);
+
+CREATE TABLE escrow_shares (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  escrow_id INTEGER NOT NULL REFERENCES escrows(id) ON DELETE CASCADE,
+  user_id INTEGER REFERENCES users(id),
+  sealed BLOB,
+  digest TEXT
+);
+
+CREATE TABLE escrow_recoveries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  escrow_id INTEGER NOT NULL REFERENCES escrows(id) ON DELETE CASCADE,
+  requested_by TEXT,
+  reason TEXT,
+  status TEXT,
+  created_at TIMESTAMP,
+  expires_at TIMESTAMP,
+  approvers TEXT,
+  shares BLOB,
+  value BLOB,
+  recovered_at TIMESTAMP,
+  collected_at TIMESTAMP
+);
+
+-- The log outlives the escrows it records, so it has no foreign keys
+CREATE TABLE escrow_log_entries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  escrow_id INTEGER,
+  recovery_id INTEGER,
+  action TEXT,
+  actor TEXT,
+  detail TEXT,
+  created_at TIMESTAMP,
+  prev_hash TEXT,
+  hash TEXT
+);
+
+CREATE INDEX idx_escrows_secret_node_id ON escrows(secret_node_id);
+CREATE INDEX idx_escrow_shares_escrow_id ON escrow_shares(escrow_id);
+CREATE INDEX idx_escrow_recoveries_escrow_id ON escrow_recoveries(escrow_id);
+CREATE INDEX idx_escrow_recoveries_status ON escrow_recoveries(status);
+CREATE INDEX idx_escrow_log_entries_escrow_id ON escrow_log_entries(escrow_id);
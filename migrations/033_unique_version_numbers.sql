@@ -0,0 +1,18 @@
+-- Version numbers are unique per secret. Concurrent updates could give two
+-- versions the same number; such versions are renumbered in creation order
+-- before the index is created. Updates that lose the race for a number
+-- retry with the next one.
+
+UPDATE secret_versions
+SET version_number = (
+  SELECT COUNT(*) FROM secret_versions AS earlier
+  WHERE earlier.secret_node_id = secret_versions.secret_node_id
+    AND earlier.id <= secret_versions.id
+)
+WHERE secret_node_id IN (
+  SELECT secret_node_id FROM secret_versions
+  GROUP BY secret_node_id, version_number
+  HAVING COUNT(*) > 1
+);
+
+CREATE UNIQUE INDEX idx_secret_versions_node_number ON secret_versions(secret_node_id, version_number);
@@ -0,0 +1,9 @@
+-- Users are looked up by a blind index of their email, and secrets and
+-- aliases by one of their name in name_key. With encryption enabled the
+-- indexes are HMACs keyed from the KEK, so that they reveal neither emails
+-- nor names. They are filled in, and rebuilt after a key rotation, at the
+-- next start of the server.
+
+ALTER TABLE users ADD COLUMN email_index TEXT DEFAULT '';
+
+CREATE INDEX idx_users_email_index ON users(email_index);
@@ -0,0 +1,6 @@
+-- Ownership transfers and grants of protected secrets wait for approval
+-- like deletions; target is the new owner or the grantee, and level the
+-- granted level.
+
+ALTER TABLE pending_operations ADD COLUMN target TEXT DEFAULT '';
+ALTER TABLE pending_operations ADD COLUMN level TEXT DEFAULT '';
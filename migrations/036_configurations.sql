@@ -0,0 +1,9 @@
+-- Keys and certificates created on first use: the device CA and, with an
+-- encryptor that does not derive keys, the per-install key content hashes
+-- are computed with, so that the hashes shown to clients cannot be used to
+-- brute-force low-entropy values. Both are encrypted like secret values.
+
+CREATE TABLE configurations (
+  key TEXT PRIMARY KEY,
+  value TEXT
+);
@@ -0,0 +1,23 @@
+// Package secretly is the supported Go API for embedding Secretly secret
+// management in other services.
+//
+// Everything under internal/ may change between releases; this package
+// follows semantic versioning. Within a major version, exported identifiers
+// are not removed or changed incompatibly, and new fields are only added to
+// structs in a backwards-compatible way.
+//
+// A minimal in-memory setup:
+//
+//	key, _ := secretly.GenerateKey()
+//	client, err := secretly.New(secretly.Options{InMemory: true, EncryptionKey: key})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer client.Close()
+//
+//	secret, _ := client.CreateSecret(ctx, secretly.CreateSecretRequest{Name: "db-password", Value: []byte("s3cr3t")})
+//	value, _ := client.GetSecretValue(ctx, secret.ID)
+//
+// To reuse an existing installation, use NewFromConfig with the path to
+// secretly.yaml.
+package secretly
@@ -0,0 +1,290 @@
+package secretly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/config"
+	"github.com/secretlyhq/secretly/internal/core"
+	"github.com/secretlyhq/secretly/internal/di"
+	"github.com/secretlyhq/secretly/internal/encryption"
+	"github.com/secretlyhq/secretly/internal/storage"
+	"github.com/secretlyhq/secretly/internal/storage/memory"
+	"gorm.io/gorm"
+)
+
+// KeySize is the required length of EncryptionKey in bytes (AES-256)
+const KeySize = 32
+
+// Options configures an embedded Client
+type Options struct {
+	// DatabasePath is the SQLite database file; ignored when InMemory is set
+	DatabasePath string
+	// InMemory keeps all data in process memory, no database is used
+	InMemory bool
+	// EncryptionKey is a KeySize-byte key used to encrypt secret values.
+	// When nil, values are stored unencrypted.
+	EncryptionKey []byte
+	// CacheTTL enables an in-process cache of decrypted values for secrets
+	// without a read limit. It is rounded up to whole seconds; zero disables
+	// caching.
+	CacheTTL time.Duration
+	// CacheMaxEntries bounds the cache size; zero means unbounded
+	CacheMaxEntries int
+}
+
+// Client is an embedded Secretly instance. It is safe for concurrent use.
+type Client struct {
+	core *core.SecretlyCore
+	db   *gorm.DB
+	svc  *encryption.Service
+}
+
+// GenerateKey returns a new random encryption key suitable for Options.EncryptionKey
+func GenerateKey() ([]byte, error) {
+	return encryption.GenerateRandomKey(KeySize)
+}
+
+// New creates a Client from explicit options
+func New(opts Options) (*Client, error) {
+	var encryptor core.Encryptor
+	if opts.EncryptionKey != nil {
+		es, err := encryption.NewEncryptionService(opts.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		encryptor = &keyEncryptor{es: es}
+	}
+
+	client := &Client{}
+	if opts.InMemory {
+		client.core = core.NewSecretlyCore(memory.New(), encryptor)
+	} else {
+		if opts.DatabasePath == "" {
+			return nil, fmt.Errorf("database path is required unless InMemory is set")
+		}
+		db, err := storage.OpenSQLite(opts.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		client.db = db
+		client.core = core.NewSecretlyCore(storage.NewLocalStorage(db), encryptor)
+	}
+
+	// The embedding program has the database anyway
+	client.core.SetLocalActor("embedded client")
+	if err := client.core.SeedRoleTemplates(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if opts.CacheTTL > 0 {
+		client.core.EnableValueCache(config.CacheConfig{
+			Enabled:     true,
+			TTLSeconds:  int((opts.CacheTTL + time.Second - 1) / time.Second),
+			MaxEntries:  opts.CacheMaxEntries,
+			SkipLimited: true,
+		})
+	}
+	return client, nil
+}
+
+// NewFromConfig creates a Client using an existing secretly.yaml, its
+// database and its KEK/DEK files. As with the CLI, relative paths are
+// resolved against the working directory.
+func NewFromConfig(configPath string) (*Client, error) {
+	app, err := di.NewApp(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{core: app.Core, db: app.DB, svc: app.Encryption}, nil
+}
+
+// Close releases the database connection and wipes keys from memory
+func (c *Client) Close() error {
+	if c.svc != nil {
+		c.svc.Shutdown()
+	}
+	if c.db != nil {
+		sqlDB, err := c.db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+	return nil
+}
+
+// CreateSecret stores a new secret
+func (c *Client) CreateSecret(ctx context.Context, req CreateSecretRequest) (*Secret, error) {
+	node, err := c.core.CreateSecret(ctx, &core.CreateSecretRequest{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		Type:          req.Type,
+		Value:         req.Value,
+		MaxReads:      req.MaxReads,
+		Expiration:    req.Expiration,
+		CreatedBy:     req.CreatedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secretFromModel(node), nil
+}
+
+// CreateSecretFromReader stores a new secret whose value is read from r in
+// separately encrypted chunks, so large values are never held in memory as a
+// whole. req.Value is ignored.
+func (c *Client) CreateSecretFromReader(ctx context.Context, req CreateSecretRequest, r io.Reader) (*Secret, error) {
+	node, err := c.core.CreateSecretFromReader(ctx, &core.CreateSecretRequest{
+		Name:          req.Name,
+		NamespaceID:   req.NamespaceID,
+		ZoneID:        req.ZoneID,
+		EnvironmentID: req.EnvironmentID,
+		Type:          req.Type,
+		MaxReads:      req.MaxReads,
+		Expiration:    req.Expiration,
+		CreatedBy:     req.CreatedBy,
+	}, r)
+	if err != nil {
+		return nil, err
+	}
+	return secretFromModel(node), nil
+}
+
+// GetSecret returns secret metadata without the value
+func (c *Client) GetSecret(ctx context.Context, id uint) (*Secret, error) {
+	node, err := c.core.GetSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return secretFromModel(node), nil
+}
+
+// GetSecretValue returns the decrypted value of the latest version
+func (c *Client) GetSecretValue(ctx context.Context, id uint) ([]byte, error) {
+	return c.core.GetSecretValue(ctx, id)
+}
+
+// GetSecretKey returns one key of a "json" secret by its dotted path, e.g.
+// "db.password". The read counts against MaxReads.
+func (c *Client) GetSecretKey(ctx context.Context, id uint, key string) ([]byte, error) {
+	return c.core.GetSecretKey(ctx, id, key)
+}
+
+// WriteSecretValue streams the decrypted value of the latest version to w and
+// returns the number of bytes written. The read counts against MaxReads even
+// if writing fails part way.
+func (c *Client) WriteSecretValue(ctx context.Context, id uint, w io.Writer) (int64, error) {
+	return c.core.StreamSecretValue(ctx, id, w)
+}
+
+// ListSecrets returns secrets matching opts and the total number of matches
+func (c *Client) ListSecrets(ctx context.Context, opts ListSecretsOptions) ([]*Secret, int64, error) {
+	nodes, total, err := c.core.ListSecrets(ctx, &core.ListSecretsFilter{
+		NamespaceID:   opts.NamespaceID,
+		ZoneID:        opts.ZoneID,
+		EnvironmentID: opts.EnvironmentID,
+		Type:          opts.Type,
+		Page:          opts.Page,
+		PageSize:      opts.PageSize,
+		Sort:          opts.Sort,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	secrets := make([]*Secret, 0, len(nodes))
+	for i := range nodes {
+		secrets = append(secrets, secretFromModel(&nodes[i]))
+	}
+	return secrets, total, nil
+}
+
+// ListSecretsAfter returns up to limit secrets matching opts that follow
+// cursor, together with the cursor of the next page ("" when there are no
+// more results). Pass an empty cursor to start from the beginning. Page and
+// PageSize in opts are ignored; cursors are opaque and should not be parsed.
+func (c *Client) ListSecretsAfter(ctx context.Context, opts ListSecretsOptions, cursor string, limit int) ([]*Secret, string, error) {
+	nodes, next, err := c.core.ListSecretsAfter(ctx, &core.ListSecretsFilter{
+		NamespaceID:   opts.NamespaceID,
+		ZoneID:        opts.ZoneID,
+		EnvironmentID: opts.EnvironmentID,
+		Type:          opts.Type,
+	}, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	secrets := make([]*Secret, 0, len(nodes))
+	for i := range nodes {
+		secrets = append(secrets, secretFromModel(&nodes[i]))
+	}
+	return secrets, next, nil
+}
+
+// UpdateSecret stores a new version of the value and/or updates limits
+func (c *Client) UpdateSecret(ctx context.Context, id uint, req UpdateSecretRequest) (*Secret, error) {
+	node, err := c.core.UpdateSecret(ctx, id, &core.UpdateSecretRequest{
+		Value:      req.Value,
+		MaxReads:   req.MaxReads,
+		Expiration: req.Expiration,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secretFromModel(node), nil
+}
+
+// DeleteSecret removes a secret and all of its versions
+func (c *Client) DeleteSecret(ctx context.Context, id uint) error {
+	return c.core.DeleteSecret(ctx, id)
+}
+
+// CacheStats returns value cache statistics; all fields are zero when the
+// cache is disabled
+func (c *Client) CacheStats() CacheStats {
+	stats := c.core.CacheStats()
+	return CacheStats{
+		Enabled:   stats.Enabled,
+		Entries:   stats.Entries,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+	}
+}
+
+// keyEncryptor adapts a raw-key EncryptionService to core.Encryptor
+type keyEncryptor struct {
+	es *encryption.EncryptionService
+}
+
+func (k *keyEncryptor) EncryptSecret(plaintext []byte) ([]byte, []byte, error) {
+	encrypted, err := k.es.Encrypt(plaintext, "embedded")
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := encryption.SerializeEncryptedData(encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata, err := json.Marshal(encrypted.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, metadata, nil
+}
+
+func (k *keyEncryptor) DeriveKey(purpose string) ([]byte, error) {
+	return k.es.DeriveKey(purpose), nil
+}
+
+func (k *keyEncryptor) DecryptSecret(encryptedData []byte) ([]byte, error) {
+	encrypted, err := encryption.DeserializeEncryptedData(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	return k.es.Decrypt(encrypted)
+}
@@ -0,0 +1,84 @@
+package secretly
+
+import (
+	"time"
+
+	"github.com/secretlyhq/secretly/internal/storage/models"
+)
+
+// Secret is the public representation of secret metadata. It never contains
+// the secret value.
+type Secret struct {
+	ID            uint
+	Name          string
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	MaxReads      *int
+	Expiration    *time.Time
+	Status        string
+	CreatedBy     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// CacheStats reports how effective the value cache is
+type CacheStats struct {
+	Enabled   bool
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CreateSecretRequest describes a secret to create
+type CreateSecretRequest struct {
+	Name          string
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	Value         []byte
+	MaxReads      *int
+	Expiration    *time.Time
+	CreatedBy     string
+}
+
+// UpdateSecretRequest describes changes to a secret; nil fields are unchanged
+type UpdateSecretRequest struct {
+	Value      []byte
+	MaxReads   *int
+	Expiration *time.Time
+}
+
+// ListSecretsOptions filters and paginates ListSecrets. Zero values mean
+// "no filter"; PageSize 0 returns all results.
+type ListSecretsOptions struct {
+	NamespaceID   uint
+	ZoneID        uint
+	EnvironmentID uint
+	Type          string
+	Page          int
+	PageSize      int
+	// Sort orders ListSecrets by id, name, created_at, updated_at or
+	// expiration, descending with a leading "-"; ListSecretsAfter ignores it
+	Sort string
+}
+
+func secretFromModel(n *models.SecretNode) *Secret {
+	return &Secret{
+		ID:            n.ID,
+		Name:          n.Name,
+		NamespaceID:   n.NamespaceID,
+		ZoneID:        n.ZoneID,
+		EnvironmentID: n.EnvironmentID,
+		Type:          n.Type,
+		MaxReads:      n.MaxReads,
+		Expiration:    n.Expiration,
+		Status:        n.Status,
+		CreatedBy:     n.CreatedBy,
+		CreatedAt:     n.CreatedAt,
+		UpdatedAt:     n.UpdatedAt,
+	}
+}